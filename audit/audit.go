@@ -0,0 +1,288 @@
+// Package audit provides the audit trail of the runner. Every action on
+// the infrastructure, instances created, claimed and destroyed, scripts
+// and steps executed and api calls received, is recorded as an event. Each
+// event holds the hash of the previous one, so that removed or altered
+// events break the chain. Sinks are registered by name and enabled with
+// DRONE_AUDIT_SINKS.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Actions recorded in the audit trail.
+const (
+	ActionInstanceCreate    = "instance.create"
+	ActionInstanceClaim     = "instance.claim"
+	ActionInstanceDestroy   = "instance.destroy"
+	ActionInstanceHibernate = "instance.hibernate"
+	ActionInstanceStart     = "instance.start"
+	ActionInstanceReconcile = "instance.reconcile"
+	ActionInstanceKeep      = "instance.keep"
+	ActionScriptRun         = "script.run"
+	ActionStepRun           = "step.run"
+	ActionStagePreempt      = "stage.preempt"
+	ActionStageDeny         = "stage.deny"
+	ActionAPICall           = "api.call"
+)
+
+// Event is an entry of the audit trail.
+type Event struct {
+	Seq      uint64            `json:"seq"`
+	Time     time.Time         `json:"time"`
+	Runner   string            `json:"runner,omitempty"`
+	Action   string            `json:"action"`
+	Pool     string            `json:"pool,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Stage    string            `json:"stage,omitempty"`
+	Owner    string            `json:"owner,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+	Prev     string            `json:"prev"`
+	Hash     string            `json:"hash,omitempty"`
+}
+
+// hash returns the hash of the event, computed over the event without
+// its hash.
+func (e *Event) hash() (string, error) {
+	c := *e
+	c.Hash = ""
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink stores the events of the trail. Sinks must only append.
+type Sink interface {
+	Write(ctx context.Context, event *Event, line []byte) error
+}
+
+// Tailer is implemented by sinks that can return the last event they
+// stored, so that the chain continues across restarts.
+type Tailer interface {
+	Tail() (*Event, error)
+}
+
+// Factory creates a sink from the runner configuration.
+type Factory func(env *config.EnvConfig) (Sink, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a sink available by name. It panics if the name is
+// already registered.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("audit: sink registered twice: " + name)
+	}
+	factories[name] = factory
+}
+
+// Names returns the sorted names of the registered sinks.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Trail records events to its sinks, chained by their hashes.
+type Trail struct {
+	runner string
+	sinks  []Sink
+
+	mu   sync.Mutex
+	seq  uint64
+	prev string
+}
+
+// New returns a trail recording the events of the runner to the sinks.
+// The chain continues after the last event of the first sink that can
+// return it.
+func New(runner string, sinks ...Sink) (*Trail, error) {
+	t := &Trail{runner: runner, sinks: sinks}
+	for _, sink := range sinks {
+		tailer, ok := sink.(Tailer)
+		if !ok {
+			continue
+		}
+		last, err := tailer.Tail()
+		if err != nil {
+			return nil, fmt.Errorf("audit: cannot read the last event: %w", err)
+		}
+		if last != nil {
+			t.seq, t.prev = last.Seq, last.Hash
+		}
+		break
+	}
+	return t, nil
+}
+
+// Record adds the event to the trail. The errors of the sinks are logged
+// so that a failing sink does not affect the others or the runner.
+func (t *Trail) Record(ctx context.Context, event *Event) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	event.Seq = t.seq + 1
+	event.Runner = t.runner
+	event.Prev = t.prev
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	hash, err := event.hash()
+	if err != nil {
+		logrus.WithError(err).WithField("action", event.Action).Errorln("audit: cannot hash the event")
+		return
+	}
+	event.Hash = hash
+	line, err := json.Marshal(event)
+	if err != nil {
+		logrus.WithError(err).WithField("action", event.Action).Errorln("audit: cannot encode the event")
+		return
+	}
+	t.seq, t.prev = event.Seq, event.Hash
+
+	for _, sink := range t.sinks {
+		if err := sink.Write(ctx, event, line); err != nil {
+			logrus.WithError(err).WithField("action", event.Action).WithField("sink", fmt.Sprintf("%T", sink)).
+				Errorln("audit: failed to record the event")
+		}
+	}
+}
+
+// Verify reads the events of a trail, one per line, and returns an error
+// if an event was altered, removed or reordered.
+func Verify(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20) //nolint:gomnd
+	var prev *Event
+	for line := 1; scanner.Scan(); line++ {
+		event := new(Event)
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return fmt.Errorf("audit: line %d: %w", line, err)
+		}
+		hash, err := event.hash()
+		if err != nil {
+			return fmt.Errorf("audit: line %d: %w", line, err)
+		}
+		if hash != event.Hash {
+			return fmt.Errorf("audit: line %d: event %d was altered", line, event.Seq)
+		}
+		if prev != nil && (event.Prev != prev.Hash || event.Seq != prev.Seq+1) {
+			return fmt.Errorf("audit: line %d: event %d does not follow event %d", line, event.Seq, prev.Seq)
+		}
+		prev = event
+	}
+	return scanner.Err()
+}
+
+var std *Trail
+
+// Open creates the default trail with the sinks enabled in the runner
+// configuration. The default trail records nothing if no sink is enabled.
+func Open(env *config.EnvConfig) error {
+	if len(env.Audit.Sinks) == 0 {
+		return nil
+	}
+	sinks := make([]Sink, 0, len(env.Audit.Sinks))
+	for _, name := range env.Audit.Sinks {
+		mu.RLock()
+		factory, ok := factories[name]
+		mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("audit: unknown sink %q, registered sinks are %v", name, Names())
+		}
+		sink, err := factory(env)
+		if err != nil {
+			return fmt.Errorf("audit: cannot create sink %q: %w", name, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	trail, err := New(env.Runner.Name, sinks...)
+	if err != nil {
+		return err
+	}
+	std = trail
+	return nil
+}
+
+// Record adds the event to the default trail. The pool, instance, stage
+// and owner of the context are used when the event does not set them.
+func Record(ctx context.Context, event *Event) {
+	if std == nil {
+		return
+	}
+	if s, ok := ctx.Value(scopeKey{}).(*Scope); ok {
+		if event.Pool == "" {
+			event.Pool = s.Pool
+		}
+		if event.Instance == "" {
+			event.Instance = s.Instance
+		}
+		if event.Stage == "" {
+			event.Stage = s.Stage
+		}
+		if event.Owner == "" {
+			event.Owner = s.Owner
+		}
+	}
+	std.Record(ctx, event)
+}
+
+// Scope is the build the actions of a context are taken for.
+type Scope struct {
+	Pool     string
+	Instance string
+	Stage    string
+	Owner    string
+}
+
+type scopeKey struct{}
+
+// WithScope returns a context whose events are attributed to the scope.
+func WithScope(ctx context.Context, scope *Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// Digest returns the sha256 of the data, to identify scripts and commands
+// without recording them.
+func Digest(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// ErrorOf returns the message of the error, or an empty string.
+func ErrorOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
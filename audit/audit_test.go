@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type memorySink struct {
+	bytes.Buffer
+}
+
+func (s *memorySink) Write(_ context.Context, _ *Event, line []byte) error {
+	s.Buffer.Write(line)
+	s.Buffer.WriteByte('\n')
+	return nil
+}
+
+func TestTrail(t *testing.T) {
+	ctx := context.Background()
+	sink := &memorySink{}
+	trail, err := New("runner", sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail.Record(ctx, &Event{Action: ActionInstanceCreate, Pool: "linux", Instance: "i-1"})
+	trail.Record(ctx, &Event{Action: ActionInstanceClaim, Pool: "linux", Instance: "i-1", Owner: "octocat"})
+	trail.Record(ctx, &Event{Action: ActionInstanceDestroy, Pool: "linux", Instance: "i-1"})
+
+	trailLog := sink.String()
+	if err = Verify(strings.NewReader(trailLog)); err != nil {
+		t.Errorf("Want the trail verified, got %s", err)
+	}
+
+	lines := strings.SplitAfter(trailLog, "\n")
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{
+			name: "altered event",
+			log:  strings.Replace(trailLog, "octocat", "hubot", 1),
+		},
+		{
+			name: "removed event",
+			log:  lines[0] + lines[2],
+		},
+		{
+			name: "reordered events",
+			log:  lines[1] + lines[0] + lines[2],
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Verify(strings.NewReader(test.log)); err == nil {
+				t.Errorf("Want the trail rejected")
+			}
+		})
+	}
+}
+
+func TestFile_Tail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+
+	sink, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail, err := New("runner", sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail.Record(ctx, &Event{Action: ActionInstanceCreate})
+	trail.Record(ctx, &Event{Action: ActionInstanceDestroy})
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted runner continues the chain.
+	sink, err = NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	trail, err = New("runner", sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail.Record(ctx, &Event{Action: ActionInstanceCreate})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(data), "\n"), 3; got != want {
+		t.Errorf("Want %d events, got %d", want, got)
+	}
+	if err = Verify(bytes.NewReader(data)); err != nil {
+		t.Errorf("Want the trail verified across restarts, got %s", err)
+	}
+}
+
+func TestRecord_Scope(t *testing.T) {
+	sink := &memorySink{}
+	trail, err := New("runner", sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std = trail
+	defer func() { std = nil }()
+
+	ctx := WithScope(context.Background(), &Scope{Pool: "linux", Instance: "i-1", Stage: "stage", Owner: "octocat"})
+	Record(ctx, &Event{Action: ActionScriptRun, Instance: "i-2"})
+
+	for _, want := range []string{`"pool":"linux"`, `"instance":"i-2"`, `"stage":"stage"`, `"owner":"octocat"`} {
+		if !strings.Contains(sink.String(), want) {
+			t.Errorf("Want %s in the event, got %s", want, sink.String())
+		}
+	}
+}
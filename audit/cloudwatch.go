@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func init() {
+	Register("cloudwatch", func(env *config.EnvConfig) (Sink, error) {
+		return NewCloudWatch(env.Audit.CloudWatchGroup, env.Audit.CloudWatchStream, env.Audit.CloudWatchRegion)
+	})
+}
+
+// CloudWatch is a sink which puts the events in a CloudWatch Logs stream.
+type CloudWatch struct {
+	group  string
+	stream string
+	client *cloudwatchlogs.CloudWatchLogs
+
+	mu sync.Mutex
+}
+
+// NewCloudWatch returns a sink putting events in the stream of the log
+// group, the stream is created if it does not exist. Credentials are taken
+// from the default AWS credential chain.
+func NewCloudWatch(group, stream, region string) (*CloudWatch, error) {
+	if group == "" || stream == "" {
+		return nil, errors.New("the cloudwatch sink requires DRONE_AUDIT_CLOUDWATCH_GROUP and DRONE_AUDIT_CLOUDWATCH_STREAM")
+	}
+	cfg := fips.AWS(aws.NewConfig())
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := cloudwatchlogs.New(sess)
+	_, err = client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+	})
+	var aerr awserr.Error
+	if err != nil && !(errors.As(err, &aerr) && aerr.Code() == cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+		return nil, err
+	}
+	return &CloudWatch{group: group, stream: stream, client: client}, nil
+}
+
+func (s *CloudWatch) Write(ctx context.Context, event *Event, line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.client.PutLogEventsWithContext(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{
+				Message:   aws.String(string(line)),
+				Timestamp: aws.Int64(event.Time.UnixMilli()),
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+func init() {
+	Register("file", func(env *config.EnvConfig) (Sink, error) {
+		return NewFile(env.Audit.File)
+	})
+}
+
+// File is a sink which appends the events to a file, one per line.
+type File struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFile returns a sink appending to the file at path.
+func NewFile(path string) (*File, error) {
+	if path == "" {
+		return nil, errors.New("the file sink requires DRONE_AUDIT_FILE")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gomnd
+	if err != nil {
+		return nil, err
+	}
+	return &File{path: path, file: f}, nil
+}
+
+func (s *File) Write(_ context.Context, _ *Event, line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Tail returns the last event of the file, or nil if it is empty.
+func (s *File) Tail() (*Event, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20) //nolint:gomnd
+	var last []byte
+	for scanner.Scan() {
+		last = append(last[:0], scanner.Bytes()...)
+	}
+	if err = scanner.Err(); err != nil || len(last) == 0 {
+		return nil, err
+	}
+	event := new(Event)
+	if err = json.Unmarshal(last, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Close closes the file.
+func (s *File) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func init() {
+	Register("s3", func(env *config.EnvConfig) (Sink, error) {
+		return NewS3(env.Audit.S3Bucket, env.Audit.S3Prefix, env.Audit.S3Region)
+	})
+}
+
+// S3 is a sink which stores every event as an object of an S3 bucket,
+// under the prefix and the runner name. Object lock on the bucket makes
+// the trail immutable.
+type S3 struct {
+	bucket string
+	prefix string
+	client *s3.S3
+}
+
+// NewS3 returns a sink storing events in the bucket, under the prefix.
+// Credentials are taken from the default AWS credential chain.
+func NewS3(bucket, prefix, region string) (*S3, error) {
+	if bucket == "" {
+		return nil, errors.New("the s3 sink requires DRONE_AUDIT_S3_BUCKET")
+	}
+	cfg := fips.AWS(aws.NewConfig())
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{bucket: bucket, prefix: prefix, client: s3.New(sess)}, nil
+}
+
+func (s *S3) Write(ctx context.Context, event *Event, line []byte) error {
+	// the sequence is zero padded so that the objects are listed in order.
+	key := path.Join(s.prefix, event.Runner, fmt.Sprintf("%020d.json", event.Seq))
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(line),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
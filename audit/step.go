@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"strconv"
+	"strings"
+
+	leapi "github.com/harness/lite-engine/api"
+)
+
+// StepEvent returns the event of a step started on an instance. The
+// command is recorded by its digest, it may hold secrets.
+func StepEvent(req *leapi.StartStepRequest, err error) *Event {
+	details := map[string]string{
+		"step":           req.ID,
+		"name":           req.Name,
+		"command_sha256": Digest(strings.Join(append(append([]string{}, req.Run.Entrypoint...), req.Run.Command...), "\n")),
+	}
+	if req.Image != "" {
+		details["image"] = req.Image
+		details["privileged"] = strconv.FormatBool(req.Privileged)
+	}
+	return &Event{
+		Action:  ActionStepRun,
+		Error:   ErrorOf(err),
+		Details: details,
+	}
+}
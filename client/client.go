@@ -0,0 +1,278 @@
+// Package client provides a Go client for the delegate HTTP API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = time.Second
+)
+
+// Error is returned when the delegate responds with a non 2xx status.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("delegate: %d: %s", e.Code, e.Message)
+}
+
+// ExecResult is the result of a script executed with Exec.
+type ExecResult struct {
+	ExitCode int
+	Error    string
+}
+
+// Client is a client for the delegate HTTP API.
+type Client struct {
+	endpoint   string
+	token      string
+	username   string
+	password   string
+	retries    int
+	retryDelay time.Duration
+	client     *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken returns an option to set the bearer token sent with every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithBasicAuth returns an option to set the dashboard credentials, sent
+// instead of the bearer token when the log streams are read.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithHTTPClient returns an option to set the underlying http client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithRetries returns an option to set how many times failed requests are
+// retried and the initial delay between attempts. Only the requests safe to
+// send twice are retried: the reads and the destruction of an instance.
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryDelay = delay
+	}
+}
+
+// New returns a client for the delegate listening at endpoint,
+// e.g. http://localhost:3000.
+func New(endpoint string, opts ...Option) *Client {
+	c := &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		retries:    defaultRetries,
+		retryDelay: defaultRetryDelay,
+		client:     http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetupInstance provisions an instance from the requested pool and sets up lite-engine on it.
+// SetupInstance is not retried, as a request failing after the delegate
+// received it may have provisioned an instance already.
+func (c *Client) SetupInstance(ctx context.Context, in *vmapi.SetupVMRequest) (*vmapi.SetupVMResponse, error) {
+	out := new(vmapi.SetupVMResponse)
+	err := c.do(ctx, http.MethodPost, "/setup", in, out)
+	return out, err
+}
+
+// RunStep runs a step on an instance and returns once the step has exited.
+// RunStep is not retried, as the step may not be safe to run twice.
+func (c *Client) RunStep(ctx context.Context, in *vmapi.ExecuteVMRequest) (*api.PollStepResponse, error) {
+	out := new(api.PollStepResponse)
+	err := c.do(ctx, http.MethodPost, "/step", in, out)
+	return out, err
+}
+
+// DestroyInstance destroys the instance setup for a stage.
+func (c *Client) DestroyInstance(ctx context.Context, in *vmapi.DestroyVMRequest) error {
+	return c.retry(ctx, func() error {
+		return c.do(ctx, http.MethodPost, "/destroy", in, nil)
+	})
+}
+
+// ListInstances lists the instances of a pool.
+func (c *Client) ListInstances(ctx context.Context, pool string) ([]*types.Instance, error) {
+	var out []*types.Instance
+	err := c.retry(ctx, func() error {
+		return c.do(ctx, http.MethodGet, "/instances?pool="+url.QueryEscape(pool), nil, &out)
+	})
+	return out, err
+}
+
+// Status returns the pools, instances and recent errors of the runner.
+func (c *Client) Status(ctx context.Context) (*vmapi.RunnerStatus, error) {
+	out := new(vmapi.RunnerStatus)
+	err := c.retry(ctx, func() error {
+		return c.do(ctx, http.MethodGet, "/status", nil, out)
+	})
+	return out, err
+}
+
+// Exec runs a script on an instance and copies its output to w as it is produced.
+// Exec is not retried, as the script may not be safe to run twice.
+func (c *Client) Exec(ctx context.Context, in *vmapi.ExecVMRequest, w io.Writer) (*ExecResult, error) {
+	res, err := c.open(ctx, http.MethodPost, "/exec", in)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if _, err = io.Copy(w, res.Body); err != nil {
+		return nil, err
+	}
+	result := &ExecResult{Error: res.Trailer.Get("X-Error")}
+	code := res.Trailer.Get("X-Exit-Code")
+	if code == "" {
+		return result, fmt.Errorf("delegate: exec did not complete: %s", result.Error)
+	}
+	if result.ExitCode, err = strconv.Atoi(code); err != nil {
+		return result, fmt.Errorf("delegate: invalid exit code %q: %w", code, err)
+	}
+	return result, nil
+}
+
+// StreamLogs calls fn for every line written to the log key until the
+// stream is closed by the delegate or ctx is canceled. The log streams
+// require the dashboard credentials, see WithBasicAuth.
+func (c *Client) StreamLogs(ctx context.Context, key string, fn func(*logstream.Line)) error {
+	res, err := c.open(ctx, http.MethodGet, "/logs/"+url.PathEscape(key)+"/stream", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) //nolint:gomnd
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case text == "event: eof":
+			return nil
+		case strings.HasPrefix(text, "data: "):
+			line := new(logstream.Line)
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(text, "data: ")), line); err != nil {
+				return err
+			}
+			fn(line)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// retry calls fn until it succeeds, returns a non retryable error,
+// or the retries are exhausted.
+func (c *Client) retry(ctx context.Context, fn func() error) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = c.retryDelay
+	policy := backoff.WithContext(backoff.WithMaxRetries(b, uint64(c.retries)), ctx)
+	return backoff.Retry(func() error {
+		err := fn()
+		if e, ok := err.(*Error); ok && !retryable(e.Code) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, policy)
+}
+
+func retryable(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout ||
+		code == http.StatusTooManyRequests
+}
+
+// do sends a json encoded request and decodes the json response into out.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	res, err := c.open(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// open sends the request and returns the response if it has a 2xx status.
+func (c *Client) open(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(in); err != nil {
+			return nil, err
+		}
+		body = buf
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.password != "" && strings.HasPrefix(path, "/logs/"):
+		req.SetBasicAuth(c.username, c.password)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode > 299 { //nolint:gomnd
+		defer res.Body.Close()
+		out := struct {
+			Message string `json:"error_msg"`
+		}{}
+		raw, _ := io.ReadAll(res.Body)
+		if json.Unmarshal(raw, &out) != nil || out.Message == "" {
+			out.Message = strings.TrimSpace(string(raw))
+		}
+		return nil, &Error{Code: res.StatusCode, Message: out.Message}
+	}
+	return res, nil
+}
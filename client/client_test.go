@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
+	"github.com/harness/lite-engine/logstream"
+)
+
+func TestClient_SetupInstance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("Authorization"), "Bearer secret"; got != want {
+			t.Errorf("Want authorization header %q, got %q", want, got)
+		}
+		_, _ = w.Write([]byte(`{"ip_address":"1.2.3.4","instance_id":"i-1"}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, WithToken("secret"), WithRetries(2, 0))
+	resp, err := c.SetupInstance(context.Background(), &vmapi.SetupVMRequest{ID: "stage", PoolID: "pool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.InstanceID != "i-1" || resp.IPAddress != "1.2.3.4" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestClient_SetupInstanceNotRetried(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, WithRetries(2, 0))
+	if _, err := c.SetupInstance(context.Background(), &vmapi.SetupVMRequest{ID: "stage"}); err == nil {
+		t.Errorf("Want error")
+	}
+	if attempts != 1 {
+		t.Errorf("Setup must not be retried, got %d attempts", attempts)
+	}
+}
+
+func TestClient_DestroyInstance(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, WithRetries(2, 0))
+	if err := c.DestroyInstance(context.Background(), &vmapi.DestroyVMRequest{ID: "stage"}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("Want 2 attempts, got %d", attempts)
+	}
+}
+
+func TestClient_Error(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error_msg":"mandatory field 'id' in the request body is empty"}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, WithRetries(2, 0))
+	_, err := c.SetupInstance(context.Background(), &vmapi.SetupVMRequest{})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Want *Error, got %v", err)
+	}
+	if e.Code != http.StatusBadRequest || e.Message != "mandatory field 'id' in the request body is empty" {
+		t.Errorf("Unexpected error %+v", e)
+	}
+	if attempts != 1 {
+		t.Errorf("Bad requests must not be retried, got %d attempts", attempts)
+	}
+}
+
+func TestClient_StreamLogs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("data: {\"Message\":\"hello\\n\"}\n\nevent: eof\ndata: {}\n\n"))
+	}))
+	defer ts.Close()
+
+	var lines []*logstream.Line
+	c := New(ts.URL, WithToken("secret"), WithBasicAuth("admin", "password"))
+	if err := c.StreamLogs(context.Background(), "key", func(line *logstream.Line) {
+		lines = append(lines, line)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Message != "hello\n" {
+		t.Errorf("Unexpected lines %+v", lines)
+	}
+
+	err := New(ts.URL, WithToken("secret")).StreamLogs(context.Background(), "key", func(*logstream.Line) {})
+	if e, ok := err.(*Error); !ok || e.Code != http.StatusUnauthorized {
+		t.Errorf("Want unauthorized error, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package check
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
+	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/signal"
+	"github.com/harness/lite-engine/api"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	runnerName      = "check"
+	healthCheckWait = time.Minute * 10
+	checkTimeout    = 120 // seconds
+)
+
+type checkCommand struct {
+	envFile      string
+	poolFile     string
+	pool         string
+	minDiskGB    int
+	maxClockSkew time.Duration
+	keep         bool
+}
+
+// result is the outcome of a single check.
+type result struct {
+	name   string
+	passed bool
+	detail string
+}
+
+// check is a script run on the instance. The check passes when the
+// script exits with code zero and verify, if set, accepts the output.
+type check struct {
+	name   string
+	script string
+	verify func(output string) error
+}
+
+func (c *checkCommand) run(*kingpin.ParseContext) error { //nolint:funlen
+	// load environment variables from file.
+	err := godotenv.Load(c.envFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	env, err := config.FromEnviron()
+	if err != nil {
+		return err
+	}
+	env.Runner.Name = runnerName
+
+	logger.Default = logger.Logrus(logrus.NewEntry(logrus.StandardLogger()))
+	if env.Debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+	if env.Trace {
+		logrus.SetLevel(logrus.TraceLevel)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = signal.WithContextFunc(ctx, func() {
+		println("check: received signal, terminating process")
+		cancel()
+	})
+
+	// use a single instance db, as we only need one machine
+	store, _, err := database.ProvideStore(database.SingleInstance, "")
+	if err != nil {
+		return fmt.Errorf("check: unable to start the database: %w", err)
+	}
+	poolManager := drivers.New(ctx, store, &env)
+
+	configPool, err := poolfile.ConfigPoolFile(c.poolFile, &env)
+	if err != nil {
+		return fmt.Errorf("check: unable to load pool file: %w", err)
+	}
+	pools, err := poolfile.ProcessPool(configPool, runnerName)
+	if err != nil {
+		return fmt.Errorf("check: unable to process pool file: %w", err)
+	}
+	if err = poolManager.Add(pools...); err != nil {
+		return fmt.Errorf("check: unable to add pools: %w", err)
+	}
+	if c.pool == "" && len(pools) == 1 {
+		c.pool = pools[0].Name
+	}
+	if !poolManager.Exists(c.pool) {
+		return fmt.Errorf("check: pool %q not found in the pool file", c.pool)
+	}
+
+	start := time.Now()
+	logrus.WithField("pool", c.pool).Infoln("check: provisioning instance")
+	instance, err := poolManager.Provision(ctx, c.pool, runnerName, runnerName, "drone", "", &env, nil)
+	if err != nil {
+		return fmt.Errorf("check: unable to provision instance: %w", err)
+	}
+	logrus.WithField("instance", instance.ID).WithField("ip", instance.Address).
+		Infof("check: instance provisioned in %s", time.Since(start).Truncate(time.Second))
+	if !c.keep {
+		defer func() {
+			if destroyErr := poolManager.Destroy(context.Background(), c.pool, instance.ID); destroyErr != nil {
+				logrus.WithError(destroyErr).WithField("instance", instance.ID).Errorln("check: unable to destroy instance")
+			}
+		}()
+	}
+
+	results := []*result{{name: "provision", passed: true, detail: time.Since(start).Truncate(time.Second).String()}}
+	ready, err := c.setupInstance(ctx, poolManager, &env, instance)
+	results = append(results, ready)
+	if err == nil {
+		for _, chk := range c.checks(instance.Platform.OS) {
+			results = append(results, c.runCheck(ctx, poolManager, &env, instance, chk))
+		}
+	} else {
+		out, logErr := poolManager.InstanceLogs(ctx, c.pool, instance.ID)
+		if logErr == nil {
+			logrus.Infof("check: instance logs for %s: %s", instance.ID, out)
+		}
+	}
+
+	failed := printReport(os.Stdout, c.pool, instance, results)
+	if failed > 0 {
+		return fmt.Errorf("check: %d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// setupInstance waits for lite-engine on the instance and sets it up.
+func (c *checkCommand) setupInstance(ctx context.Context, poolManager drivers.IManager, env *config.EnvConfig, instance *types.Instance) (*result, error) {
+	start := time.Now()
+	res := &result{name: "lite-engine"}
+	leClient, err := lehelper.GetClient(instance, runnerName, instance.Port, env.LiteEngine.EnableMock, env.LiteEngine.MockStepTimeoutSecs)
+	if err != nil {
+		res.detail = err.Error()
+		return res, err
+	}
+	performDNSLookup := drivers.ShouldPerformDNSLookup(ctx, instance.Platform.OS)
+	if _, err = leClient.RetryHealth(ctx, healthCheckWait, performDNSLookup); err != nil {
+		res.detail = err.Error()
+		return res, err
+	}
+	setup := &api.SetupRequest{}
+	// docker is not available on mac instances
+	if instance.Platform.OS == oshelp.OSMac {
+		b := false
+		setup.MountDockerSocket = &b
+	}
+	if _, err = leClient.Setup(ctx, setup); err != nil {
+		res.detail = err.Error()
+		return res, err
+	}
+	res.passed = true
+	res.detail = "healthy after " + time.Since(start).Truncate(time.Second).String()
+	return res, nil
+}
+
+func (c *checkCommand) runCheck(ctx context.Context, poolManager drivers.IManager, env *config.EnvConfig, instance *types.Instance, chk *check) *result {
+	res := &result{name: chk.name}
+	var buf bytes.Buffer
+	resp, err := harness.HandleExec(ctx, &harness.ExecVMRequest{
+		InstanceID:    instance.ID,
+		CorrelationID: runnerName,
+		Script:        chk.script,
+		Timeout:       checkTimeout,
+	}, instance, env, poolManager, &buf)
+	output := strings.TrimSpace(buf.String())
+	switch {
+	case err != nil:
+		res.detail = err.Error()
+	case resp.ExitCode != 0:
+		res.detail = fmt.Sprintf("exit code %d: %s", resp.ExitCode, output)
+	case chk.verify != nil:
+		if err = chk.verify(output); err != nil {
+			res.detail = err.Error()
+		} else {
+			res.passed = true
+			res.detail = output
+		}
+	default:
+		res.passed = true
+		res.detail = output
+	}
+	return res
+}
+
+// checks returns the checks for the operating system of the instance.
+func (c *checkCommand) checks(platformOS string) []*check {
+	minDiskKB := int64(c.minDiskGB) * 1024 * 1024 //nolint:gomnd
+	clock := &check{name: "clock skew", verify: c.verifyClock}
+	var checks []*check
+	switch platformOS {
+	case oshelp.OSWindows:
+		clock.script = "[DateTimeOffset]::UtcNow.ToUnixTimeSeconds()"
+		checks = []*check{
+			{name: "docker", script: "docker version --format '{{.Server.Version}}'"},
+			{name: "git", script: "git --version"},
+			{name: "disk space", script: fmt.Sprintf(
+				"$free = [math]::Floor((Get-PSDrive C).Free / 1024); \"$free KB available\"; if ($free -lt %d) { exit 1 }", minDiskKB)},
+		}
+	default:
+		clock.script = "date +%s"
+		checks = []*check{
+			{name: "git", script: "git --version"},
+			{name: "disk space", script: fmt.Sprintf(
+				"free=$(df -Pk / | awk 'NR==2 {print $4}'); echo \"${free} KB available\"; [ \"$free\" -ge %d ]", minDiskKB)},
+		}
+		// docker is not available on mac instances
+		if platformOS != oshelp.OSMac {
+			checks = append([]*check{{name: "docker", script: "docker version --format '{{.Server.Version}}'"}}, checks...)
+		}
+	}
+	return append(checks, clock)
+}
+
+func (c *checkCommand) verifyClock(output string) error {
+	remote, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot parse instance time %q", output)
+	}
+	skew := time.Since(time.Unix(remote, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > c.maxClockSkew {
+		return fmt.Errorf("clock skew %s exceeds %s", skew, c.maxClockSkew)
+	}
+	return nil
+}
+
+// printReport prints the check results and returns the number of failed checks.
+func printReport(out io.Writer, pool string, instance *types.Instance, results []*result) int {
+	fmt.Fprintf(out, "\npool %s, instance %s (%s) %s/%s\n\n", pool, instance.ID, instance.Address, instance.Platform.OS, instance.Platform.Arch)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+	failed := 0
+	for _, r := range results {
+		status := "ok"
+		if !r.passed {
+			status = "FAILED"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.name, status, strings.ReplaceAll(r.detail, "\n", " "))
+	}
+	w.Flush()
+	return failed
+}
+
+// Register the check command.
+func Register(app *kingpin.Application) {
+	c := new(checkCommand)
+
+	cmd := app.Command("check", "provisions an instance from a pool, verifies it is ready for builds and tears it down").
+		Action(c.run)
+	cmd.Flag("envfile", "load the environment variable file").
+		Default(".env").
+		StringVar(&c.envFile)
+	cmd.Flag("pool-file", "file with the pool definitions").
+		StringVar(&c.poolFile)
+	cmd.Flag("pool", "name of the pool to check, optional if the pool file has a single pool").
+		StringVar(&c.pool)
+	cmd.Flag("min-disk", "minimum free disk space in GB").
+		Default("10").
+		IntVar(&c.minDiskGB)
+	cmd.Flag("max-clock-skew", "maximum allowed difference between the instance and local clock").
+		Default("30s").
+		DurationVar(&c.maxClockSkew)
+	cmd.Flag("keep", "do not destroy the instance after the checks").
+		BoolVar(&c.keep)
+}
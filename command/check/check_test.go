@@ -0,0 +1,32 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package check
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyClock(t *testing.T) {
+	c := &checkCommand{maxClockSkew: 30 * time.Second}
+	now := time.Now().Unix()
+	tests := []struct {
+		output string
+		err    bool
+	}{
+		{output: fmt.Sprint(now), err: false},
+		{output: fmt.Sprint(now+10) + "\n", err: false},
+		{output: fmt.Sprint(now - 120), err: true},
+		{output: fmt.Sprint(now + 120), err: true},
+		{output: "not a number", err: true},
+	}
+	for _, test := range tests {
+		err := c.verifyClock(test.output)
+		if test.err != (err != nil) {
+			t.Errorf("Unexpected result for output %q: %v", test.output, err)
+		}
+	}
+}
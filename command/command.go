@@ -8,11 +8,17 @@ import (
 	"context"
 	"os"
 
+	"github.com/drone-runners/drone-runner-aws/command/check"
 	"github.com/drone-runners/drone-runner-aws/command/daemon"
+	"github.com/drone-runners/drone-runner-aws/command/encrypt"
 	"github.com/drone-runners/drone-runner-aws/command/harness/delegate"
 	"github.com/drone-runners/drone-runner-aws/command/harness/delegate/tester"
 	"github.com/drone-runners/drone-runner-aws/command/harness/dlite"
+	"github.com/drone-runners/drone-runner-aws/command/lint"
+	"github.com/drone-runners/drone-runner-aws/command/schema"
 	"github.com/drone-runners/drone-runner-aws/command/setup"
+	"github.com/drone-runners/drone-runner-aws/command/status"
+	"github.com/drone-runners/drone-runner-aws/command/tail"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -28,10 +34,16 @@ func Command() {
 	app := kingpin.New("drone", "drone aws runner")
 	registerCompile(app)
 	registerExec(app)
+	check.Register(app)
 	daemon.Register(app)
+	encrypt.Register(app)
 	delegate.RegisterDelegate(app)
 	dlite.RegisterDlite(app)
+	lint.Register(app)
+	schema.Register(app)
 	setup.Register(app)
+	status.Register(app)
+	tail.Register(app)
 	tester.Register(app)
 
 	kingpin.Version(version)
@@ -48,6 +48,11 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	// the pipelines with a matrix are expanded, as by the conversion extension of the daemon.
+	rawsource, err = resource.Expand(rawsource)
+	if err != nil {
+		return err
+	}
 
 	envs := environ.Combine(
 		c.Environ,
@@ -82,7 +87,11 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 		return err
 	}
 
-	poolFile, err := config.ParseFile(c.Pool)
+	envConfig, err := config.FromEnviron()
+	if err != nil {
+		return err
+	}
+	poolFile, err := config.ParseFile(c.Pool, config.WithDecrypter(poolfile.NewDecrypter(&envConfig)), config.WithLookup(envConfig.PoolFileEnv()))
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("compile: unable to parse pool file")
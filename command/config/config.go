@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 	"unicode"
 	utf8 "unicode/utf8"
@@ -18,38 +19,135 @@ type (
 	PoolFile struct {
 		Version   string     `json:"version" yaml:"version"`
 		Instances []Instance `json:"instances" yaml:"instances"`
+		// Include are files, or patterns of files, whose instances and
+		// bases are added to the pool file. They are resolved when the
+		// pool file is parsed.
+		Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+		// Bases are partial instances that instances extend, by name.
+		Bases map[string]interface{} `json:"bases,omitempty" yaml:"bases,omitempty"`
 	}
 
 	Instance struct {
-		Name     string         `json:"name"`
-		Default  bool           `json:"default"`
-		Type     string         `json:"type"`
-		Pool     int            `json:"pool"`
-		Limit    int            `json:"limit"`
-		Platform types.Platform `json:"platform,omitempty" yaml:"platform,omitempty"`
-		Spec     interface{}    `json:"spec,omitempty"`
+		Name      string         `json:"name"`
+		Default   bool           `json:"default"`
+		Type      string         `json:"type"`
+		Pool      int            `json:"pool"`
+		Limit     int            `json:"limit"`
+		Platform  types.Platform `json:"platform,omitempty" yaml:"platform,omitempty"`
+		Timezone  string         `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+		Locale    string         `json:"locale,omitempty" yaml:"locale,omitempty"`
+		Toolcache []types.Tool   `json:"toolcache,omitempty" yaml:"toolcache,omitempty"`
+		Mirror    *types.Mirror  `json:"mirror,omitempty" yaml:"mirror,omitempty"`
+		// DockerDaemon is the content of the docker daemon.json of the instances.
+		DockerDaemon map[string]interface{} `json:"docker_daemon,omitempty" yaml:"docker_daemon,omitempty"`
+		// NestedVirtualization requires kvm on the instances.
+		NestedVirtualization bool `json:"nested_virtualization,omitempty" yaml:"nested_virtualization,omitempty"`
+		// Untrusted blocks the instance metadata service from build steps.
+		Untrusted bool `json:"untrusted,omitempty" yaml:"untrusted,omitempty"`
+		// Reserved free instances are only claimed by stages with a priority.
+		Reserved int `json:"reserved,omitempty" yaml:"reserved,omitempty"`
+		// Workspace is the directory the pipelines are built in, e.g. a
+		// mounted instance store or D:\ on windows, the drone directory
+		// of the root directory if empty.
+		Workspace string `json:"workspace,omitempty" yaml:"workspace,omitempty"`
+		// TmpfsSize is the size of the tmpfs mounted on the script and
+		// home directories of linux instances, e.g. 64m, so that secrets
+		// never reach the disks. Disabled if empty.
+		TmpfsSize string `json:"tmpfs_size,omitempty" yaml:"tmpfs_size,omitempty"`
+		// SwapSize is the size of the swap file enabled on linux instances
+		// during the setup, e.g. 4g. Disabled if empty.
+		SwapSize string `json:"swap_size,omitempty" yaml:"swap_size,omitempty"`
+		// Sysctl are the kernel parameters set on linux instances during
+		// the setup, e.g. vm.max_map_count.
+		Sysctl map[string]string `json:"sysctl,omitempty" yaml:"sysctl,omitempty"`
+		// SELinux is the selinux mode of linux instances, permissive or
+		// enforcing. The image default is kept if empty.
+		SELinux string `json:"selinux,omitempty" yaml:"selinux,omitempty"`
+		// AppArmorProfile is the apparmor profile of the build containers,
+		// named docker-default. The docker profile is kept if empty.
+		AppArmorProfile string `json:"apparmor_profile,omitempty" yaml:"apparmor_profile,omitempty"`
+		// NetworkSubnet is the subnet the docker networks of linux instances
+		// are allocated from, e.g. 10.200.0.0/16. The docker default if empty.
+		NetworkSubnet string `json:"network_subnet,omitempty" yaml:"network_subnet,omitempty"`
+		// NetworkMTU is the MTU of the docker networks of linux instances.
+		// The docker default if 0.
+		NetworkMTU int `json:"network_mtu,omitempty" yaml:"network_mtu,omitempty"`
+		// Firewall restricts the traffic of linux instances and of their
+		// containers to the listed destinations and sources.
+		Firewall *types.Firewall `json:"firewall,omitempty" yaml:"firewall,omitempty"`
+		// Extends is the base the instance overrides, maps are merged and
+		// other values replaced. It is resolved when the pool file is parsed.
+		Extends string      `json:"extends,omitempty" yaml:"extends,omitempty"`
+		Spec    interface{} `json:"spec,omitempty"`
 	}
 
 	// Amazon specifies the configuration for an AWS instance.
 	Amazon struct {
-		Account       AmazonAccount     `json:"account,omitempty"`
-		Name          string            `json:"name,omitempty" yaml:"name,omitempty"`
-		Size          string            `json:"size,omitempty"`
-		SizeAlt       string            `json:"size_alt,omitempty" yaml:"size_alt,omitempty"`
-		AMI           string            `json:"ami,omitempty"`
-		VPC           string            `json:"vpc,omitempty" yaml:"vpc,omitempty"`
-		Tags          map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
-		Type          string            `json:"type,omitempty" yaml:"type,omitempty"`
-		UserData      string            `json:"user_data,omitempty" yaml:"user_data,omitempty"`
-		UserDataPath  string            `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
-		Disk          disk              `json:"disk,omitempty" yaml:"disk,omitempty"`
-		Network       AmazonNetwork     `json:"network,omitempty" yaml:"network,omitempty"`
-		DeviceName    string            `json:"device_name,omitempty" yaml:"device_name,omitempty"`
-		IamProfileArn string            `json:"iam_profile_arn,omitempty" yaml:"iam_profile_arn,omitempty"`
-		MarketType    string            `json:"market_type,omitempty" yaml:"market_type,omitempty"`
-		RootDirectory string            `json:"root_directory,omitempty" yaml:"root_directory,omitempty"`
-		Hibernate     bool              `json:"hibernate,omitempty"`
-		User          string            `json:"user,omitempty" yaml:"user,omitempty"`
+		Account         AmazonAccount     `json:"account,omitempty"`
+		Name            string            `json:"name,omitempty" yaml:"name,omitempty"`
+		Size            string            `json:"size,omitempty"`
+		SizeAlt         string            `json:"size_alt,omitempty" yaml:"size_alt,omitempty"`
+		AMI             string            `json:"ami,omitempty"`
+		VPC             string            `json:"vpc,omitempty" yaml:"vpc,omitempty"`
+		Tags            map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+		Type            string            `json:"type,omitempty" yaml:"type,omitempty"`
+		UserData        string            `json:"user_data,omitempty" yaml:"user_data,omitempty"`
+		UserDataPath    string            `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
+		UserDataPersist bool              `json:"user_data_persist,omitempty" yaml:"user_data_persist,omitempty"` // run the windows userdata on every boot
+		NameTemplate    string            `json:"name_template,omitempty" yaml:"name_template,omitempty"`         // template of the Name tag, e.g. drone-{{pool}}-{{build}}-{{short-id}}
+		SerialConsole   bool              `json:"serial_console,omitempty" yaml:"serial_console,omitempty"`       // enable the serial console access of the account and fetch the latest console output of unreachable instances
+		Disk            disk              `json:"disk,omitempty" yaml:"disk,omitempty"`
+		Network         AmazonNetwork     `json:"network,omitempty" yaml:"network,omitempty"`
+		DeviceName      string            `json:"device_name,omitempty" yaml:"device_name,omitempty"` // root device the disk settings apply to, the root device of the AMI if empty
+		IamProfileArn   string            `json:"iam_profile_arn,omitempty" yaml:"iam_profile_arn,omitempty"`
+		MarketType      string            `json:"market_type,omitempty" yaml:"market_type,omitempty"`
+		RootDirectory   string            `json:"root_directory,omitempty" yaml:"root_directory,omitempty"`
+		Hibernate       bool              `json:"hibernate,omitempty"`
+		User            string            `json:"user,omitempty" yaml:"user,omitempty"`
+		Failover        []AmazonFailover  `json:"failover,omitempty" yaml:"failover,omitempty"`
+		Cheapest        *AmazonCheapest   `json:"cheapest,omitempty" yaml:"cheapest,omitempty"`
+		Stack           *AmazonStack      `json:"stack,omitempty" yaml:"stack,omitempty"`
+		Metadata        *AmazonMetadata   `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	}
+
+	// AmazonMetadata configures the instance metadata service. Tokens is
+	// optional or required, required enforces IMDSv2.
+	AmazonMetadata struct {
+		Tokens   string `json:"tokens,omitempty" yaml:"tokens,omitempty"`
+		HopLimit int64  `json:"hop_limit,omitempty" yaml:"hop_limit,omitempty"`
+		Disabled bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	}
+
+	// AmazonStack is a CloudFormation template created with each instance
+	// and deleted with it, inline or read from the template path.
+	AmazonStack struct {
+		Template     string            `json:"template,omitempty" yaml:"template,omitempty"`
+		TemplatePath string            `json:"template_path,omitempty" yaml:"template_path,omitempty"`
+		Parameters   map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+		Capabilities []string          `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+		TimeoutMins  int               `json:"timeout_mins,omitempty" yaml:"timeout_mins,omitempty"`
+	}
+
+	// AmazonCheapest selects the cheapest of the instance sizes and zones
+	// when an instance is created. Spot prices are compared for spot pools.
+	AmazonCheapest struct {
+		Sizes        []string `json:"sizes,omitempty" yaml:"sizes,omitempty"`
+		Zones        []string `json:"zones,omitempty" yaml:"zones,omitempty"`
+		MinVCPUs     int64    `json:"min_vcpus,omitempty" yaml:"min_vcpus,omitempty"`
+		MinMemoryMiB int64    `json:"min_memory_mib,omitempty" yaml:"min_memory_mib,omitempty"`
+		RefreshMins  int      `json:"refresh_mins,omitempty" yaml:"refresh_mins,omitempty"`
+	}
+
+	// AmazonFailover is a secondary region used when the pool region has no
+	// capacity or is unavailable. Without an AMI the image with the name of
+	// the pool AMI is looked up in the region.
+	AmazonFailover struct {
+		Region           string   `json:"region,omitempty" yaml:"region,omitempty"`
+		AvailabilityZone string   `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
+		AMI              string   `json:"ami,omitempty" yaml:"ami,omitempty"`
+		SubnetID         string   `json:"subnet_id,omitempty" yaml:"subnet_id,omitempty"`
+		VPC              string   `json:"vpc,omitempty" yaml:"vpc,omitempty"`
+		SecurityGroups   []string `json:"security_groups,omitempty" yaml:"security_groups,omitempty"`
 	}
 
 	AmazonAccount struct {
@@ -64,10 +162,18 @@ type (
 
 	// AmazonNetwork provides AmazonNetwork settings.
 	AmazonNetwork struct {
-		VPCSecurityGroups []string `json:"vpc_security_group_ids,omitempty" yaml:"vpc_security_groups"`
-		SecurityGroups    []string `json:"security_groups,omitempty" yaml:"security_groups"`
-		SubnetID          string   `json:"subnet_id,omitempty" yaml:"subnet_id"`
-		PrivateIP         bool     `json:"private_ip,omitempty" yaml:"private_ip"`
+		VPCSecurityGroups []string              `json:"vpc_security_group_ids,omitempty" yaml:"vpc_security_groups"`
+		SecurityGroups    []string              `json:"security_groups,omitempty" yaml:"security_groups"`
+		SubnetID          string                `json:"subnet_id,omitempty" yaml:"subnet_id"`
+		PrivateIP         bool                  `json:"private_ip,omitempty" yaml:"private_ip"`
+		AuditInterface    *AmazonAuditInterface `json:"audit_interface,omitempty" yaml:"audit_interface,omitempty"`
+	}
+
+	// AmazonAuditInterface is a network interface attached to each instance
+	// and tagged with the build, for flow log capture.
+	AmazonAuditInterface struct {
+		SubnetID       string   `json:"subnet_id,omitempty" yaml:"subnet_id,omitempty"`
+		SecurityGroups []string `json:"security_groups,omitempty" yaml:"security_groups,omitempty"`
 	}
 
 	// Anka specifies the configuration for an Anka instance.
@@ -129,6 +235,117 @@ type (
 		DiskSize string `json:"disk_size" yaml:"disk_size"`
 	}
 
+	// LXD specifies the configuration for an LXD system container or virtual machine.
+	LXD struct {
+		Hosts         []LXDHost         `json:"hosts,omitempty" yaml:"hosts"`
+		Project       string            `json:"project,omitempty" yaml:"project,omitempty"`
+		Image         string            `json:"image,omitempty" yaml:"image"`
+		ImageServer   string            `json:"image_server,omitempty" yaml:"image_server,omitempty"`
+		ImageProtocol string            `json:"image_protocol,omitempty" yaml:"image_protocol,omitempty"`
+		Type          string            `json:"type,omitempty" yaml:"type,omitempty"`
+		Profiles      []string          `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+		CPUs          string            `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+		Memory        string            `json:"memory,omitempty" yaml:"memory,omitempty"`
+		Config        map[string]string `json:"config,omitempty" yaml:"config,omitempty"`
+		RootDirectory string            `json:"root_directory,omitempty" yaml:"root_directory"`
+		UserData      string            `json:"user_data,omitempty" yaml:"user_data,omitempty"`
+		UserDataPath  string            `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
+	}
+
+	LXDHost struct {
+		Address        string `json:"address" yaml:"address"`
+		ClientCertPath string `json:"client_cert_path,omitempty" yaml:"client_cert_path"`
+		ClientKeyPath  string `json:"client_key_path,omitempty" yaml:"client_key_path"`
+		ServerCertPath string `json:"server_cert_path,omitempty" yaml:"server_cert_path"`
+		Insecure       bool   `json:"insecure,omitempty" yaml:"insecure" default:"false"`
+	}
+
+	// OpenStack specifies the configuration for an OpenStack (Nova) instance.
+	OpenStack struct {
+		Account          OpenStackAccount  `json:"account,omitempty" yaml:"account,omitempty"`
+		Cloud            string            `json:"cloud,omitempty" yaml:"cloud,omitempty"`
+		CloudsFile       string            `json:"clouds_file,omitempty" yaml:"clouds_file,omitempty"`
+		Region           string            `json:"region,omitempty" yaml:"region,omitempty"`
+		Flavor           string            `json:"flavor,omitempty" yaml:"flavor"`
+		Image            string            `json:"image,omitempty" yaml:"image"`
+		Network          string            `json:"network,omitempty" yaml:"network"`
+		SecurityGroups   []string          `json:"security_groups,omitempty" yaml:"security_groups,omitempty"`
+		AvailabilityZone string            `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
+		Metadata         map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+		UserData         string            `json:"user_data,omitempty" yaml:"user_data,omitempty"`
+		UserDataPath     string            `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
+	}
+
+	// OpenStackAccount holds the credentials used when no cloud from clouds.yaml is set.
+	OpenStackAccount struct {
+		AuthURL                     string `json:"auth_url,omitempty" yaml:"auth_url"`
+		Username                    string `json:"username,omitempty" yaml:"username,omitempty"`
+		Password                    string `json:"password,omitempty" yaml:"password,omitempty"`
+		DomainName                  string `json:"domain_name,omitempty" yaml:"domain_name,omitempty"`
+		ProjectID                   string `json:"project_id,omitempty" yaml:"project_id,omitempty"`
+		ApplicationCredentialID     string `json:"application_credential_id,omitempty" yaml:"application_credential_id,omitempty"`
+		ApplicationCredentialSecret string `json:"application_credential_secret,omitempty" yaml:"application_credential_secret,omitempty"`
+	}
+
+	// VSphere specifies the configuration for a VMware vSphere virtual machine.
+	VSphere struct {
+		Account      VSphereAccount `json:"account,omitempty" yaml:"account"`
+		Datacenter   string         `json:"datacenter,omitempty" yaml:"datacenter,omitempty"`
+		Template     string         `json:"template,omitempty" yaml:"template"`
+		Snapshot     string         `json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+		LinkedClone  *bool          `json:"linked_clone,omitempty" yaml:"linked_clone,omitempty"`
+		Folder       string         `json:"folder,omitempty" yaml:"folder,omitempty"`
+		ResourcePool string         `json:"resource_pool,omitempty" yaml:"resource_pool,omitempty"`
+		Datastore    string         `json:"datastore,omitempty" yaml:"datastore,omitempty"`
+		CPUs         int32          `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+		MemoryMB     int64          `json:"memory_mb,omitempty" yaml:"memory_mb,omitempty"`
+		UserData     string         `json:"user_data,omitempty" yaml:"user_data,omitempty"`
+		UserDataPath string         `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
+	}
+
+	VSphereAccount struct {
+		Address  string `json:"address,omitempty" yaml:"address"`
+		Username string `json:"username,omitempty" yaml:"username"`
+		Password string `json:"password,omitempty" yaml:"password"`
+		Insecure bool   `json:"insecure,omitempty" yaml:"insecure" default:"false"`
+	}
+
+	// OCI specifies the configuration for an Oracle Cloud Infrastructure instance.
+	OCI struct {
+		Account            OCIAccount        `json:"account,omitempty" yaml:"account,omitempty"`
+		Compartment        string            `json:"compartment,omitempty" yaml:"compartment"`
+		AvailabilityDomain string            `json:"availability_domain,omitempty" yaml:"availability_domain"`
+		Shape              string            `json:"shape,omitempty" yaml:"shape"`
+		OCPUs              float32           `json:"ocpus,omitempty" yaml:"ocpus,omitempty"`
+		MemoryGBs          float32           `json:"memory_gbs,omitempty" yaml:"memory_gbs,omitempty"`
+		Image              string            `json:"image,omitempty" yaml:"image"`
+		BootVolumeGBs      int64             `json:"boot_volume_gbs,omitempty" yaml:"boot_volume_gbs,omitempty"`
+		Subnet             string            `json:"subnet,omitempty" yaml:"subnet"`
+		AssignPublicIP     bool              `json:"assign_public_ip,omitempty" yaml:"assign_public_ip,omitempty"`
+		Tags               map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+		RootDirectory      string            `json:"root_directory,omitempty" yaml:"root_directory"`
+		UserData           string            `json:"user_data,omitempty" yaml:"user_data,omitempty"`
+		UserDataPath       string            `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
+	}
+
+	// OCIAccount selects the credentials, the oci cli config file or the
+	// instance principal of the runner host.
+	OCIAccount struct {
+		ConfigFile        string `json:"config_file,omitempty" yaml:"config_file,omitempty"`
+		Profile           string `json:"profile,omitempty" yaml:"profile,omitempty"`
+		InstancePrincipal bool   `json:"instance_principal,omitempty" yaml:"instance_principal,omitempty"`
+		Region            string `json:"region,omitempty" yaml:"region,omitempty"`
+	}
+
+	// Tart specifies the configuration for a Tart virtual machine on Apple silicon.
+	Tart struct {
+		Image        string `json:"image,omitempty" yaml:"image"`
+		CPUs         int    `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+		MemoryMB     int    `json:"memory_mb,omitempty" yaml:"memory_mb,omitempty"`
+		UserData     string `json:"user_data,omitempty" yaml:"user_data,omitempty"`
+		UserDataPath string `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
+	}
+
 	// Azure specifies the configuration for an Azure instance.
 	Azure struct {
 		Account           AzureAccount      `json:"account,omitempty"`
@@ -245,6 +462,7 @@ type (
 type EnvConfig struct {
 	Debug bool `envconfig:"DRONE_DEBUG"`
 	Trace bool `envconfig:"DRONE_TRACE"`
+	FIPS  bool `envconfig:"DRONE_FIPS"` // restrict TLS and ssh to FIPS approved algorithms
 
 	Anka struct {
 		VMName string `envconfig:"ANKA_VM_NAME"`
@@ -286,6 +504,10 @@ type EnvConfig struct {
 		Realm    string `envconfig:"DRONE_UI_REALM" default:"MyRealm"`
 	}
 
+	Convert struct {
+		Secret string `envconfig:"DRONE_CONVERT_SECRET"` // serve the conversion extension expanding the matrices on /convert, disabled if empty
+	}
+
 	DigitalOcean struct {
 		PAT string `envconfig:"DIGITAL_OCEAN_PAT"`
 	}
@@ -303,15 +525,28 @@ type EnvConfig struct {
 	}
 
 	Runner struct {
-		Name        string            `envconfig:"DRONE_RUNNER_NAME"`
-		Capacity    int               `envconfig:"DRONE_RUNNER_CAPACITY" default:"6"`
-		Procs       int64             `envconfig:"DRONE_RUNNER_MAX_PROCS"`
-		Environ     map[string]string `envconfig:"DRONE_RUNNER_ENVIRON"`
-		EnvFile     string            `envconfig:"DRONE_RUNNER_ENV_FILE"`
-		Secrets     map[string]string `envconfig:"DRONE_RUNNER_SECRETS"`
-		Labels      map[string]string `envconfig:"DRONE_RUNNER_LABELS"`
-		NetworkOpts map[string]string `envconfig:"DRONE_RUNNER_NETWORK_OPTS"`
-		Volumes     []string          `envconfig:"DRONE_RUNNER_VOLUMES"`
+		Name                string            `envconfig:"DRONE_RUNNER_NAME"`
+		Capacity            int               `envconfig:"DRONE_RUNNER_CAPACITY" default:"6"`
+		PlatformCapacity    map[string]int    `envconfig:"DRONE_RUNNER_PLATFORM_CAPACITY"` // capacity of each platform, e.g. linux/amd64:4,windows:2, replaces the capacity
+		Procs               int64             `envconfig:"DRONE_RUNNER_MAX_PROCS"`
+		Environ             map[string]string `envconfig:"DRONE_RUNNER_ENVIRON"`
+		EnvFile             string            `envconfig:"DRONE_RUNNER_ENV_FILE"`
+		Secrets             map[string]string `envconfig:"DRONE_RUNNER_SECRETS"`
+		Labels              map[string]string `envconfig:"DRONE_RUNNER_LABELS"`  // only stages with the same labels are routed to the runner
+		OS                  string            `envconfig:"DRONE_RUNNER_OS"`      // only stages of the os are routed to the runner, empty for any
+		Arch                string            `envconfig:"DRONE_RUNNER_ARCH"`    // only stages of the architecture are routed to the runner, empty for any
+		Variant             string            `envconfig:"DRONE_RUNNER_VARIANT"` // only stages of the architecture variant are routed to the runner, empty for any
+		Kernel              string            `envconfig:"DRONE_RUNNER_KERNEL"`  // only stages of the kernel are routed to the runner, empty for any
+		NetworkOpts         map[string]string `envconfig:"DRONE_RUNNER_NETWORK_OPTS"`
+		Volumes             []string          `envconfig:"DRONE_RUNNER_VOLUMES"`
+		CreateWorkingDir    bool              `envconfig:"DRONE_RUNNER_CREATE_WORKING_DIR"`   // create the working directory of host steps if missing
+		DetectOOM           bool              `envconfig:"DRONE_RUNNER_DETECT_OOM"`           // look for OOM killer events when a step fails
+		MaxClockSkewSecs    int               `envconfig:"DRONE_RUNNER_MAX_CLOCK_SKEW_SECS"`  // sync the instance clock above this skew, 0 disables the check
+		PrivilegedImages    []string          `envconfig:"DRONE_RUNNER_PRIVILEGED_IMAGES"`    // images allowed to run privileged, empty allows all
+		AllowedDevices      []string          `envconfig:"DRONE_RUNNER_ALLOWED_DEVICES"`      // host devices steps may mount, empty allows all
+		AllowedCapabilities []string          `envconfig:"DRONE_RUNNER_ALLOWED_CAPABILITIES"` // capabilities steps may add
+		ScriptSigningKey    string            `envconfig:"DRONE_RUNNER_SCRIPT_SIGNING_KEY"`   // ed25519 PEM key signing the scripts of linux host steps, disabled if empty
+		VMSteps             bool              `envconfig:"DRONE_RUNNER_VM_STEPS"`             // show the setup and the destruction of the instance as the Initialize VM and Cleanup VM steps
 	}
 
 	Dlite struct {
@@ -326,21 +561,105 @@ type EnvConfig struct {
 	}
 
 	Settings struct {
-		DefaultDriver        string `envconfig:"DRONE_DEFAULT_DRIVER" default:"amazon"`
-		ReusePool            bool   `envconfig:"DRONE_REUSE_POOL" default:"false"`
-		BusyMaxAge           int64  `envconfig:"DRONE_SETTINGS_BUSY_MAX_AGE" default:"24"`
-		FreeMaxAge           int64  `envconfig:"DRONE_SETTINGS_FREE_MAX_AGE" default:"720"`
-		MinPoolSize          int    `envconfig:"DRONE_MIN_POOL_SIZE" default:"1"`
-		MaxPoolSize          int    `envconfig:"DRONE_MAX_POOL_SIZE" default:"2"`
-		EnableAutoPool       bool   `envconfig:"DRONE_ENABLE_AUTO_POOL" default:"false"`
-		HarnessTestBinaryURI string `envconfig:"DRONE_HARNESS_TEST_BINARY_URI"`
-		PluginBinaryURI      string `envconfig:"DRONE_PLUGIN_BINARY_URI" default:"https://github.com/drone/plugin/releases/download/v0.3.6-beta"`
-		PurgerTime           int64  `envconfig:"DRONE_PURGER_TIME_MINUTES" default:"30"`
+		DefaultDriver        string            `envconfig:"DRONE_DEFAULT_DRIVER" default:"amazon"`
+		ReusePool            bool              `envconfig:"DRONE_REUSE_POOL" default:"false"`
+		BusyMaxAge           int64             `envconfig:"DRONE_SETTINGS_BUSY_MAX_AGE" default:"24"`
+		FreeMaxAge           int64             `envconfig:"DRONE_SETTINGS_FREE_MAX_AGE" default:"720"`
+		MinPoolSize          int               `envconfig:"DRONE_MIN_POOL_SIZE" default:"1"`
+		MaxPoolSize          int               `envconfig:"DRONE_MAX_POOL_SIZE" default:"2"`
+		EnableAutoPool       bool              `envconfig:"DRONE_ENABLE_AUTO_POOL" default:"false"`
+		HarnessTestBinaryURI string            `envconfig:"DRONE_HARNESS_TEST_BINARY_URI"`
+		PluginBinaryURI      string            `envconfig:"DRONE_PLUGIN_BINARY_URI" default:"https://github.com/drone/plugin/releases/download/v0.3.6-beta"`
+		PurgerTime           int64             `envconfig:"DRONE_PURGER_TIME_MINUTES" default:"30"`
+		SSHKeyDir            string            `envconfig:"DRONE_SSH_KEY_DIR"`                 // rotate an ssh key of the linux instances and keep it in this directory, disabled if empty
+		SSHKeyUser           string            `envconfig:"DRONE_SSH_KEY_USER" default:"root"` // user of the instances authorizing the key
+		SSHKeyRotationMins   int64             `envconfig:"DRONE_SSH_KEY_ROTATION_MINUTES" default:"1440"`
+		DiskGCMins           int64             `envconfig:"DRONE_SETTINGS_DISK_GC_MINS"`                    // free the disks of the free instances every this many minutes, disabled if 0
+		DiskGCThreshold      int               `envconfig:"DRONE_SETTINGS_DISK_GC_THRESHOLD" default:"80"`  // disk usage in percent from which a disk is freed
+		DiskGCPruneAgeHours  int64             `envconfig:"DRONE_SETTINGS_DISK_GC_PRUNE_AGE" default:"24"`  // remove the docker images, containers and build cache unused for this many hours
+		CapacityWaitSecs     int64             `envconfig:"DRONE_SETTINGS_CAPACITY_WAIT_SECS"`              // wait for a saturated pool, stages are served round-robin per project; fail at once if 0
+		MaxPriority          int               `envconfig:"DRONE_SETTINGS_MAX_PRIORITY"`                    // highest priority of a stage, higher priorities are lowered
+		PriorityCaps         map[string]int    `envconfig:"DRONE_SETTINGS_PRIORITY_CAPS"`                   // highest priority per account, e.g. account1:10,account2:5
+		PreemptPriority      int               `envconfig:"DRONE_SETTINGS_PREEMPT_PRIORITY"`                // stages of this priority or higher waiting for a saturated pool preempt a running stage of a lower priority, disabled if 0
+		PoolFileEnv          bool              `envconfig:"DRONE_SETTINGS_POOL_FILE_ENV"`                   // interpolate ${VAR} in the string values of the pool file, $${ is a literal ${
+		SetupTimeoutMins     int64             `envconfig:"DRONE_SETTINGS_SETUP_TIMEOUT_MINS" default:"15"` // terminate the instances claimed by a stage whose setup did not complete in this time, disabled if 0
+		ClaimSLOMillis       int64             `envconfig:"DRONE_SETTINGS_CLAIM_SLO_MILLIS"`                // warn about the claims of an instance taking longer, with the time spent on the lock, the store and the cloud api, disabled if 0
+		InstanceNameTemplate string            `envconfig:"DRONE_SETTINGS_INSTANCE_NAME_TEMPLATE"`          // template of the Name tag of amazon instances, e.g. drone-{{pool}}-{{build}}-{{short-id}}, the name_template of a pool overrides it
+		InstanceTags         map[string]string `envconfig:"DRONE_SETTINGS_INSTANCE_TAGS"`                   // tags of every amazon instance overriding the tags of the pools, e.g. cost-center:ci,owner:platform
+		RequiredTags         []string          `envconfig:"DRONE_SETTINGS_REQUIRED_TAGS"`                   // tags every amazon pool must set, the runner does not start otherwise
+	}
+	Policy struct {
+		Untrusted            bool     `envconfig:"DRONE_POLICY_UNTRUSTED"`              // restrict the pipelines of the repositories drone does not mark trusted
+		UntrustedPools       []string `envconfig:"DRONE_POLICY_UNTRUSTED_POOLS"`        // pools untrusted pipelines are moved to, any pool if empty
+		UntrustedTimeoutMins int64    `envconfig:"DRONE_POLICY_UNTRUSTED_TIMEOUT_MINS"` // stop the steps of untrusted stages after this many minutes, the repository timeout if 0
+	}
+	Admission struct {
+		Endpoint    string `envconfig:"DRONE_ADMISSION_ENDPOINT"` // decision of an Open Policy Agent server evaluated before the setup of stages, e.g. http://localhost:8181/v1/data/drone/admission/deny, disabled if empty
+		Token       string `envconfig:"DRONE_ADMISSION_TOKEN"`
+		FailOpen    bool   `envconfig:"DRONE_ADMISSION_FAIL_OPEN"` // admit the stages if the decision cannot be queried
+		TimeoutSecs int64  `envconfig:"DRONE_ADMISSION_TIMEOUT_SECS" default:"10"`
+	}
+	PoolSecrets struct {
+		KMSRegion       string `envconfig:"DRONE_POOL_SECRETS_KMS_REGION"`        // region of the KMS keys of encrypted pool file values, defaults to AWS_DEFAULT_REGION
+		AgeIdentityFile string `envconfig:"DRONE_POOL_SECRETS_AGE_IDENTITY_FILE"` // age identities decrypting encrypted pool file values
+	}
+	LiveLog struct {
+		SpillDir          string   `envconfig:"DRONE_LIVELOG_SPILL_DIR"`                       // spill log lines to this directory, disabled if empty
+		Stdout            bool     `envconfig:"DRONE_LIVELOG_STDOUT"`                          // echo log lines to the runner stdout
+		StdoutRateLimit   int      `envconfig:"DRONE_LIVELOG_STDOUT_RATE_LIMIT" default:"100"` // lines per second, 0 is unlimited
+		Sinks             []string `envconfig:"DRONE_LIVELOG_SINKS"`                           // additional log sinks, e.g. file,s3
+		FileDir           string   `envconfig:"DRONE_LIVELOG_FILE_DIR"`
+		S3Bucket          string   `envconfig:"DRONE_LIVELOG_S3_BUCKET"`
+		S3Prefix          string   `envconfig:"DRONE_LIVELOG_S3_PREFIX"`
+		S3Region          string   `envconfig:"DRONE_LIVELOG_S3_REGION"`
+		Limit             int      `envconfig:"DRONE_LIVELOG_LIMIT" default:"5242880"`           // bytes of log kept for the final upload
+		StepLimit         int      `envconfig:"DRONE_LIVELOG_STEP_LIMIT"`                        // bytes of output of a drone step, the rest is truncated but for its last lines, unlimited if 0
+		StepTailLines     int      `envconfig:"DRONE_LIVELOG_STEP_TAIL_LINES" default:"200"`     // last lines of a truncated step output
+		IntervalMilliSecs int      `envconfig:"DRONE_LIVELOG_INTERVAL_MILLISECS" default:"1000"` // interval between two streamed batches
+		MaxLineLength     int      `envconfig:"DRONE_LIVELOG_MAX_LINE_LENGTH" default:"2048"`    // longer lines are truncated
+		StripANSI         bool     `envconfig:"DRONE_LIVELOG_STRIP_ANSI"`                        // strip color codes and collapse carriage return rewrites
+		Offsets           bool     `envconfig:"DRONE_LIVELOG_OFFSETS"`                           // prefix the log lines with their offset from the start of the stream
+		Timestamps        bool     `envconfig:"DRONE_LIVELOG_TIMESTAMPS"`                        // prefix the log lines with their RFC3339 time
+		ErrorPatterns     []string `envconfig:"DRONE_LIVELOG_ERROR_PATTERNS"`                    // regular expressions of error lines, replaces the defaults
+		WarnPatterns      []string `envconfig:"DRONE_LIVELOG_WARN_PATTERNS"`                     // regular expressions of warning lines, replaces the defaults
+		RedactDefaults    bool     `envconfig:"DRONE_LIVELOG_REDACT_DEFAULTS"`                   // redact the AWS keys and the JSON web tokens of the log lines
+		RedactPatterns    []string `envconfig:"DRONE_LIVELOG_REDACT_PATTERNS"`                   // regular expressions redacted from the log lines, their groups if they have any
+	}
+	Audit struct {
+		Sinks            []string `envconfig:"DRONE_AUDIT_SINKS"` // audit trail sinks, e.g. file,s3,cloudwatch, disabled if empty
+		File             string   `envconfig:"DRONE_AUDIT_FILE"`
+		S3Bucket         string   `envconfig:"DRONE_AUDIT_S3_BUCKET"`
+		S3Prefix         string   `envconfig:"DRONE_AUDIT_S3_PREFIX"`
+		S3Region         string   `envconfig:"DRONE_AUDIT_S3_REGION"`
+		CloudWatchGroup  string   `envconfig:"DRONE_AUDIT_CLOUDWATCH_GROUP"`
+		CloudWatchStream string   `envconfig:"DRONE_AUDIT_CLOUDWATCH_STREAM"`
+		CloudWatchRegion string   `envconfig:"DRONE_AUDIT_CLOUDWATCH_REGION"`
+	}
+	Notify struct {
+		Sinks        []string `envconfig:"DRONE_NOTIFY_SINKS"` // infrastructure alert notifiers, e.g. slack,webhook, disabled if empty
+		SlackWebhook string   `envconfig:"DRONE_NOTIFY_SLACK_WEBHOOK"`
+		WebhookURL   string   `envconfig:"DRONE_NOTIFY_WEBHOOK_URL"`
+		Template     string   `envconfig:"DRONE_NOTIFY_TEMPLATE"`                    // text/template of the messages, executed with the alert
+		IntervalSecs int64    `envconfig:"DRONE_NOTIFY_INTERVAL_SECS" default:"900"` // send at most one alert of a kind and pool in this interval, 0 sends all
+	}
+	Diagnostics struct {
+		Dir      string `envconfig:"DRONE_DIAGNOSTICS_DIR"`       // archive the diagnostics of the instances failing with an infrastructure error in this directory, disabled if empty
+		S3Bucket string `envconfig:"DRONE_DIAGNOSTICS_S3_BUCKET"` // upload the diagnostics to this bucket, replaces the directory
+		S3Prefix string `envconfig:"DRONE_DIAGNOSTICS_S3_PREFIX"`
+		S3Region string `envconfig:"DRONE_DIAGNOSTICS_S3_REGION"`
+	}
+	Snapshot struct {
+		S3Bucket   string `envconfig:"DRONE_SNAPSHOT_S3_BUCKET"` // hand the workspaces over between stages through this bucket, disabled if empty
+		S3Prefix   string `envconfig:"DRONE_SNAPSHOT_S3_PREFIX"`
+		S3Region   string `envconfig:"DRONE_SNAPSHOT_S3_REGION"`
+		ExpiryMins int64  `envconfig:"DRONE_SNAPSHOT_EXPIRY_MINS" default:"60"` // the presigned urls of the snapshots expire after this time
 	}
 	LiteEngine struct {
 		Path                string `envconfig:"DRONE_LITE_ENGINE_PATH" default:"https://github.com/harness/lite-engine/releases/download/v0.5.72/"`
 		EnableMock          bool   `envconfig:"DRONE_LITE_ENGINE_ENABLE_MOCK"`
 		MockStepTimeoutSecs int    `envconfig:"DRONE_LITE_ENGINE_MOCK_STEP_TIMEOUT_SECS" default:"120"`
+		HeartbeatSecs       int    `envconfig:"DRONE_LITE_ENGINE_HEARTBEAT_SECS" default:"30"`        // health check interval while a step runs, 0 disables it
+		MaxUnreachableSecs  int    `envconfig:"DRONE_LITE_ENGINE_MAX_UNREACHABLE_SECS" default:"300"` // fail the step when lite-engine is unreachable for longer
 	}
 
 	Server struct {
@@ -348,6 +667,11 @@ type EnvConfig struct {
 		Proto string `envconfig:"DRONE_HTTP_PROTO"`
 		Host  string `envconfig:"DRONE_HTTP_HOST"`
 		Acme  bool   `envconfig:"DRONE_HTTP_ACME"`
+
+		RateLimit        float64 `envconfig:"DRONE_HTTP_RATE_LIMIT"` // requests per second per caller, 0 disables
+		RateLimitBurst   int     `envconfig:"DRONE_HTTP_RATE_LIMIT_BURST" default:"20"`
+		MaxSetups        int     `envconfig:"DRONE_HTTP_MAX_CONCURRENT_SETUPS"`            // 0 disables
+		MaxBodySizeBytes int64   `envconfig:"DRONE_HTTP_MAX_BODY_SIZE" default:"10485760"` // 10MB
 	}
 
 	Environ struct {
@@ -431,6 +755,11 @@ func FromEnviron() (EnvConfig, error) {
 	if config.Dashboard.Password == "" {
 		config.Dashboard.Disabled = true
 	}
+	for _, p := range config.LiveLog.RedactPatterns {
+		if _, err = regexp.Compile(p); err != nil {
+			return config, fmt.Errorf("invalid log redaction pattern %q: %w", p, err)
+		}
+	}
 	config.Client.Address = fmt.Sprintf(
 		"%s://%s",
 		config.Client.Proto,
@@ -453,30 +782,57 @@ func FromEnviron() (EnvConfig, error) {
 	return config, nil
 }
 
-// Populates the Spec field of the Instance struct based on the Type field.
-func (s *Instance) populateSpec() error {
-	switch s.Type {
+// InstanceTypes are the instance types of the pool file, with aliases.
+var InstanceTypes = []string{
+	string(types.Amazon), "aws", string(types.Anka), string(types.AnkaBuild), string(types.Azure),
+	string(types.DigitalOcean), string(types.Google), "gcp", string(types.VMFusion), string(types.Noop),
+	string(types.Nomad), string(types.LXD), string(types.OpenStack), string(types.VSphere), string(types.OCI),
+	string(types.Tart),
+}
+
+// NewSpec returns an empty spec of the instance type.
+func NewSpec(instanceType string) (interface{}, error) {
+	switch instanceType {
 	case string(types.Amazon), "aws":
-		s.Spec = new(Amazon)
+		return new(Amazon), nil
 	case string(types.Anka):
-		s.Spec = new(Anka)
+		return new(Anka), nil
 	case string(types.AnkaBuild):
-		s.Spec = new(AnkaBuild)
+		return new(AnkaBuild), nil
 	case string(types.Azure):
-		s.Spec = new(Azure)
+		return new(Azure), nil
 	case string(types.DigitalOcean):
-		s.Spec = new(DigitalOcean)
+		return new(DigitalOcean), nil
 	case string(types.Google), "gcp":
-		s.Spec = new(Google)
+		return new(Google), nil
 	case string(types.VMFusion):
-		s.Spec = new(VMFusion)
+		return new(VMFusion), nil
 	case string(types.Noop):
-		s.Spec = new(Noop)
+		return new(Noop), nil
 	case string(types.Nomad):
-		s.Spec = new(Nomad)
+		return new(Nomad), nil
+	case string(types.LXD):
+		return new(LXD), nil
+	case string(types.OpenStack):
+		return new(OpenStack), nil
+	case string(types.VSphere):
+		return new(VSphere), nil
+	case string(types.OCI):
+		return new(OCI), nil
+	case string(types.Tart):
+		return new(Tart), nil
 	default:
-		return fmt.Errorf("unknown instance type %s", s.Type)
+		return nil, fmt.Errorf("unknown instance type %s", instanceType)
+	}
+}
+
+// Populates the Spec field of the Instance struct based on the Type field.
+func (s *Instance) populateSpec() error {
+	spec, err := NewSpec(s.Type)
+	if err != nil {
+		return err
 	}
+	s.Spec = spec
 	return nil
 }
 
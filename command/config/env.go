@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// LookupEnv returns the value of an environment variable and whether it
+// is set, like os.LookupEnv.
+type LookupEnv func(name string) (string, bool)
+
+// PoolFileEnv returns the lookup interpolating the environment variables
+// of the pool file, nil if interpolation is disabled.
+func (c *EnvConfig) PoolFileEnv() LookupEnv {
+	if !c.Settings.PoolFileEnv {
+		return nil
+	}
+	return os.LookupEnv
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolateEnv replaces the expressions of a pool file value with the
+// environment variables they name:
+//
+//	${NAME}           the value, empty if unset
+//	${NAME:-default}  the default if unset or empty
+//	${NAME-default}   the default if unset
+//	${NAME:?message}  fails if unset or empty
+//	${NAME?message}   fails if unset
+//
+// $${ is a literal ${. Values are never part of an error.
+func interpolateEnv(s string, lookup LookupEnv, path string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("pool file: %s: unterminated ${", path)
+		}
+		value, err := expandEnv(s[i+2:i+end], lookup)
+		if err != nil {
+			return "", fmt.Errorf("pool file: %s: %w", path, err)
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// expandEnv returns the value of the expression between ${ and }.
+func expandEnv(expr string, lookup LookupEnv) (string, error) {
+	name, op, arg := expr, "", ""
+	if i := strings.IndexAny(expr, ":-?"); i >= 0 {
+		name, op = expr[:i], expr[i:i+1]
+		if op == ":" && i+1 < len(expr) {
+			op = expr[i : i+2]
+		}
+		arg = expr[i+len(op):]
+	}
+	if !envNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid environment variable name %q", name)
+	}
+	value, set := lookup(name)
+	switch op {
+	case "":
+		return value, nil
+	case ":-":
+		if value == "" {
+			return arg, nil
+		}
+		return value, nil
+	case "-":
+		if !set {
+			return arg, nil
+		}
+		return value, nil
+	case ":?", "?":
+		if (op == ":?" && value == "") || !set {
+			if arg == "" {
+				return "", fmt.Errorf("environment variable %s is required", name)
+			}
+			return "", fmt.Errorf("environment variable %s is required: %s", name, arg)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported expression ${%s}, use ${%s}, ${%s:-default} or ${%s:?message}", expr, name, name, name)
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_interpolateEnv(t *testing.T) {
+	env := map[string]string{"SUBNET": "subnet-1", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "no variables", want: "no variables"},
+		{value: "${SUBNET}", want: "subnet-1"},
+		{value: "a-${SUBNET}-b-${SUBNET}", want: "a-subnet-1-b-subnet-1"},
+		{value: "${UNSET}", want: ""},
+		{value: "${UNSET:-ami-1}", want: "ami-1"},
+		{value: "${EMPTY:-ami-1}", want: "ami-1"},
+		{value: "${EMPTY-ami-1}", want: ""},
+		{value: "${SUBNET:?set the subnet}", want: "subnet-1"},
+		{value: "${EMPTY?set the subnet}", want: ""},
+		{value: "echo $${HOME}", want: "echo ${HOME}"},
+		{value: "${UNSET:?set the subnet}", wantErr: "pool file: spec.subnet: environment variable UNSET is required: set the subnet"},
+		{value: "${EMPTY:?}", wantErr: "pool file: spec.subnet: environment variable EMPTY is required"},
+		{value: "${UNSET?}", wantErr: "pool file: spec.subnet: environment variable UNSET is required"},
+		{value: "${SUBNET", wantErr: "pool file: spec.subnet: unterminated ${"},
+		{value: "${1SUBNET}", wantErr: `pool file: spec.subnet: invalid environment variable name "1SUBNET"`},
+		{value: "${SUBNET:0:3}", wantErr: "pool file: spec.subnet: unsupported expression ${SUBNET:0:3}, use ${SUBNET}, ${SUBNET:-default} or ${SUBNET:?message}"},
+	}
+	for _, test := range tests {
+		got, err := interpolateEnv(test.value, lookup, "spec.subnet")
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("%s: want error %q, got %v", test.value, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.value, err)
+		} else if got != test.want {
+			t.Errorf("%s: want %q, got %q", test.value, test.want, got)
+		}
+	}
+}
+
+func TestParse_Env(t *testing.T) {
+	data := `
+version: "1"
+instances:
+- name: ${POOL_NAME:-ubuntu}
+  type: amazon
+  pool: 1
+  spec:
+    ami: ${AMI:?}
+    network:
+      subnet_id: ${SUBNET}
+`
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"AMI": "ami-1", "SUBNET": "subnet-1"}[name]
+		return v, ok
+	}
+	pool, err := Parse(strings.NewReader(data), WithLookup(lookup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := pool.Instances[0].Spec.(*Amazon)
+	if pool.Instances[0].Name != "ubuntu" || spec.AMI != "ami-1" || spec.Network.SubnetID != "subnet-1" {
+		t.Errorf("want the variables interpolated, got %s %s %s", pool.Instances[0].Name, spec.AMI, spec.Network.SubnetID)
+	}
+
+	// interpolation is disabled without a lookup.
+	pool, err = Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.Instances[0].Spec.(*Amazon).AMI; got != "${AMI:?}" {
+		t.Errorf("want the value as it is, got %s", got)
+	}
+}
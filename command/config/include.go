@@ -0,0 +1,304 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// ResolveFile reads the pool file at the path, or the pool files of a
+// directory in name order, with the files they include, and resolves the
+// bases the instances extend. Values are neither interpolated nor
+// decrypted.
+func ResolveFile(path string) (map[string]interface{}, error) {
+	r := &resolver{loading: map[string]bool{}}
+	doc, err := r.load(path)
+	if err != nil {
+		return nil, err
+	}
+	return doc, resolveBases(doc)
+}
+
+// resolve decodes a pool file and resolves the files it includes,
+// relative to dir, and the bases the instances extend.
+func resolve(data []byte, dir string) (map[string]interface{}, error) {
+	doc, err := decodeRaw(data)
+	if err != nil {
+		return nil, err
+	}
+	r := &resolver{loading: map[string]bool{}}
+	if err = r.includes(doc, dir); err != nil {
+		return nil, err
+	}
+	return doc, resolveBases(doc)
+}
+
+// resolver loads pool files and the files they include.
+type resolver struct {
+	loading map[string]bool // files being loaded, an include of one is a cycle
+}
+
+func (r *resolver) load(path string) (map[string]interface{}, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return r.loadFile(path)
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, globErr := filepath.Glob(filepath.Join(path, pattern))
+		if globErr != nil {
+			return nil, globErr
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("pool file: no pool files in the directory %s", path)
+	}
+	sort.Strings(files)
+	doc := map[string]interface{}{}
+	for _, file := range files {
+		included, loadErr := r.loadFile(file)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if err = mergeInclude(doc, included, file); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (r *resolver) loadFile(path string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.loading[abs] {
+		return nil, fmt.Errorf("pool file: %s includes itself", path)
+	}
+	r.loading[abs] = true
+	defer delete(r.loading, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeRaw(data)
+	if err != nil {
+		return nil, fmt.Errorf("pool file: %s: %w", path, err)
+	}
+	return doc, r.includes(doc, filepath.Dir(path))
+}
+
+// includes merges the files the pool file includes into it. Patterns are
+// relative to dir.
+func (r *resolver) includes(doc map[string]interface{}, dir string) error {
+	value, ok := doc["include"]
+	if !ok {
+		return nil
+	}
+	delete(doc, "include")
+	patterns, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("pool file: include is a list of files")
+	}
+	for _, p := range patterns {
+		pattern, isString := p.(string)
+		if !isString {
+			return fmt.Errorf("pool file: include is a list of files")
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("pool file: include %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("pool file: include %s matches no files", pattern)
+		}
+		for _, match := range matches {
+			included, err := r.load(match)
+			if err != nil {
+				return err
+			}
+			if err = mergeInclude(doc, included, match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeInclude adds the instances and bases of an included pool file.
+func mergeInclude(doc, included map[string]interface{}, path string) error {
+	if _, ok := doc["version"]; !ok && included["version"] != nil {
+		doc["version"] = included["version"]
+	}
+	if value, ok := included["instances"]; ok {
+		instances, isList := value.([]interface{})
+		if !isList {
+			return fmt.Errorf("pool file: %s: instances is a list", path)
+		}
+		existing, _ := doc["instances"].([]interface{})
+		doc["instances"] = append(existing, instances...)
+	}
+	if value, ok := included["bases"]; ok {
+		bases, isMap := value.(map[string]interface{})
+		if !isMap {
+			return fmt.Errorf("pool file: %s: bases is a map of names to instances", path)
+		}
+		existing, _ := doc["bases"].(map[string]interface{})
+		if existing == nil {
+			existing = map[string]interface{}{}
+			doc["bases"] = existing
+		}
+		for name, base := range bases {
+			if _, defined := existing[name]; defined {
+				return fmt.Errorf("pool file: %s: base %s is already defined", path, name)
+			}
+			existing[name] = base
+		}
+	}
+	return nil
+}
+
+// resolveBases replaces the instances extending a base with the base
+// overridden by the values of the instance. Bases may extend bases.
+func resolveBases(doc map[string]interface{}) error {
+	value, ok := doc["bases"]
+	delete(doc, "bases")
+	bases, _ := value.(map[string]interface{})
+	if ok && bases == nil && value != nil {
+		return fmt.Errorf("pool file: bases is a map of names to instances")
+	}
+
+	resolved := map[string]map[string]interface{}{}
+	var resolveBase func(name string, chain []string) (map[string]interface{}, error)
+	resolveBase = func(name string, chain []string) (map[string]interface{}, error) {
+		if base, done := resolved[name]; done {
+			return base, nil
+		}
+		for _, c := range chain {
+			if c == name {
+				return nil, fmt.Errorf("bases extend each other: %s", strings.Join(append(chain, name), " -> "))
+			}
+		}
+		base, isMap := bases[name].(map[string]interface{})
+		if !isMap {
+			return nil, fmt.Errorf("unknown base %s", name)
+		}
+		parent, err := extends(base)
+		if err != nil {
+			return nil, err
+		}
+		if parent != "" {
+			parentBase, err := resolveBase(parent, append(chain, name))
+			if err != nil {
+				return nil, err
+			}
+			base = mergeValues(parentBase, base).(map[string]interface{})
+		}
+		resolved[name] = base
+		return base, nil
+	}
+
+	instances, _ := doc["instances"].([]interface{})
+	for i, value := range instances {
+		instance, isMap := value.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		name, err := extends(instance)
+		if err == nil && name != "" {
+			var base map[string]interface{}
+			if base, err = resolveBase(name, nil); err == nil {
+				instances[i] = mergeValues(base, instance)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("pool file: instances[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// extends removes the name of the base an instance extends from it and
+// returns the name, empty if it extends none.
+func extends(instance map[string]interface{}) (string, error) {
+	value, ok := instance["extends"]
+	if !ok {
+		return "", nil
+	}
+	delete(instance, "extends")
+	name, isString := value.(string)
+	if !isString {
+		return "", fmt.Errorf("extends is the name of a base")
+	}
+	return name, nil
+}
+
+// mergeValues returns the base overridden by the value. Maps are merged,
+// other values replace the base. The base is not modified.
+func mergeValues(base, value interface{}) interface{} {
+	b, baseIsMap := base.(map[string]interface{})
+	v, valueIsMap := value.(map[string]interface{})
+	if !baseIsMap || !valueIsMap {
+		return copyValue(value)
+	}
+	out := make(map[string]interface{}, len(b)+len(v))
+	for key, item := range b {
+		out[key] = copyValue(item)
+	}
+	for key, item := range v {
+		out[key] = mergeValues(out[key], item)
+	}
+	return out
+}
+
+func copyValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			out[key] = copyValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			out[i] = copyValue(item)
+		}
+		return out
+	}
+	return value
+}
+
+// decodeRaw decodes a pool file into generic values, numbers are kept as
+// they are written.
+func decodeRaw(data []byte) (map[string]interface{}, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	if len(bytes.TrimSpace(data)) == 0 || bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return doc, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil { //nolint:gomnd
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseFile_Include(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"pool.yml": `
+version: "1"
+include:
+- pools/*.yml
+bases:
+  amazon:
+    type: amazon
+    pool: 1
+    spec:
+      account:
+        region: us-east-2
+      size: t3.large
+      tags:
+        team: ci
+  large:
+    extends: amazon
+    spec:
+      size: t3.2xlarge
+instances:
+- name: ubuntu
+  extends: amazon
+  spec:
+    ami: ami-1
+    tags:
+      os: linux
+`,
+		"pools/arm.yml": `
+instances:
+- name: arm
+  extends: large
+  pool: 2
+  spec:
+    ami: ami-2
+`,
+	})
+
+	pool, err := ParseFile(filepath.Join(dir, "pool.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Instances) != 2 {
+		t.Fatalf("want the included instance added, got %d instances", len(pool.Instances))
+	}
+
+	ubuntu, arm := pool.Instances[0], pool.Instances[1]
+	spec := ubuntu.Spec.(*Amazon)
+	if ubuntu.Type != "amazon" || ubuntu.Pool != 1 || spec.Account.Region != "us-east-2" || spec.Size != "t3.large" || spec.AMI != "ami-1" {
+		t.Errorf("want the values of the base, got %s %d %s %s %s", ubuntu.Type, ubuntu.Pool, spec.Account.Region, spec.Size, spec.AMI)
+	}
+	if spec.Tags["team"] != "ci" || spec.Tags["os"] != "linux" {
+		t.Errorf("want the maps merged, got %v", spec.Tags)
+	}
+
+	spec = arm.Spec.(*Amazon)
+	if arm.Type != "amazon" || arm.Pool != 2 || spec.Size != "t3.2xlarge" || spec.AMI != "ami-2" || spec.Account.Region != "us-east-2" {
+		t.Errorf("want the base extending a base, got %s %d %s %s %s", arm.Type, arm.Pool, spec.Size, spec.AMI, spec.Account.Region)
+	}
+}
+
+func TestParse_Dir(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"pool.yml":       "version: \"1\"\ninclude:\n- pools/*.yml\ninstances: []\n",
+		"pools/base.yml": "instances:\n- name: included\n  type: amazon\n  spec:\n    ami: ami-1\n",
+	})
+	data, err := os.ReadFile(filepath.Join(dir, "pool.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the includes are resolved relative to the directory, as ParseFile does.
+	for _, parse := range []func() (*PoolFile, error){
+		func() (*PoolFile, error) { return Parse(bytes.NewReader(data), WithDir(dir)) },
+		func() (*PoolFile, error) { return ParseFile(filepath.Join(dir, "pool.yml")) },
+	} {
+		pool, err := parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pool.Instances) != 1 || pool.Instances[0].Name != "included" {
+			t.Errorf("want the included instance, got %d instances", len(pool.Instances))
+		}
+	}
+
+	// the working directory is the default.
+	if _, err = Parse(bytes.NewReader(data)); err == nil {
+		t.Errorf("want an error, the include is not relative to the working directory")
+	}
+}
+
+func TestParseFile_Directory(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"b.yaml": "instances:\n- name: second\n  type: amazon\n  spec:\n    ami: ami-2\n",
+		"a.yml":  "version: \"1\"\ninstances:\n- name: first\n  type: amazon\n  spec:\n    ami: ami-1\n",
+		"README": "not a pool file",
+	})
+
+	pool, err := ParseFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, instance := range pool.Instances {
+		names = append(names, instance.Name)
+	}
+	if got := strings.Join(names, ","); got != "first,second" || pool.Version != "1" {
+		t.Errorf("want the files loaded in name order, got %s version %q", got, pool.Version)
+	}
+}
+
+func TestParseFile_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "unknown base",
+			files:   map[string]string{"pool.yml": "instances:\n- name: a\n  extends: missing\n"},
+			wantErr: "pool file: instances[0]: unknown base missing",
+		},
+		{
+			name: "bases extending each other",
+			files: map[string]string{"pool.yml": `
+bases:
+  a:
+    extends: b
+  b:
+    extends: a
+instances:
+- name: a
+  extends: a
+`},
+			wantErr: "pool file: instances[0]: bases extend each other: a -> b -> a",
+		},
+		{
+			name: "base defined twice",
+			files: map[string]string{
+				"pool.yml":  "include:\n- other.yml\nbases:\n  a:\n    type: amazon\n",
+				"other.yml": "bases:\n  a:\n    type: amazon\n",
+			},
+			wantErr: "base a is already defined",
+		},
+		{
+			name:    "file including itself",
+			files:   map[string]string{"pool.yml": "include:\n- pool.yml\n"},
+			wantErr: "includes itself",
+		},
+		{
+			name:    "include matching no files",
+			files:   map[string]string{"pool.yml": "include:\n- missing/*.yml\n"},
+			wantErr: "matches no files",
+		},
+	}
+	for _, test := range tests {
+		dir := writeFiles(t, test.files)
+		_, err := ParseFile(filepath.Join(dir, "pool.yml"))
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: want error %q, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
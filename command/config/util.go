@@ -2,33 +2,108 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"os"
-
-	"github.com/ghodss/yaml"
+	"strings"
 )
 
-func ParseFile(rawFile string) (*PoolFile, error) {
-	f, err := os.Open(rawFile)
-	if err != nil {
-		return nil, err
+// EncryptedPrefix is the prefix of the encrypted values of the pool file.
+// An encrypted value has the form encrypted:<scheme>:<ciphertext>.
+const EncryptedPrefix = "encrypted:"
+
+// Decrypter decrypts the encrypted values of the pool file.
+type Decrypter interface {
+	Decrypt(scheme, ciphertext string) (string, error)
+}
+
+// ParseOption configures the parsing of a pool file.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	dir       string
+	decrypter Decrypter
+	lookup    LookupEnv
+}
+
+// WithDecrypter returns an option to decrypt the encrypted values with the
+// decrypter. Parsing fails if the pool file contains encrypted values and
+// no decrypter is set.
+func WithDecrypter(decrypter Decrypter) ParseOption {
+	return func(o *parseOptions) {
+		o.decrypter = decrypter
 	}
-	defer f.Close()
+}
+
+// WithLookup returns an option to interpolate the environment variables of
+// the string values with lookup. Values are not interpolated by default.
+func WithLookup(lookup LookupEnv) ParseOption {
+	return func(o *parseOptions) {
+		o.lookup = lookup
+	}
+}
+
+// WithDir returns an option to resolve the files included by the pool file
+// relative to dir, the working directory by default. ParseFile resolves
+// them relative to the directory of the pool file.
+func WithDir(dir string) ParseOption {
+	return func(o *parseOptions) {
+		o.dir = dir
+	}
+}
+
+func newParseOptions(opts []ParseOption) *parseOptions {
+	o := &parseOptions{dir: "."}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
 
-	inst, err := Parse(f)
+// ParseFile parses the pool file at the path, or the pool files of a
+// directory, with the files they include.
+func ParseFile(rawFile string, opts ...ParseOption) (*PoolFile, error) {
+	o := newParseOptions(opts)
+	raw, err := ResolveFile(rawFile)
 	if err != nil {
 		return nil, err
 	}
-	return inst, nil
+	return decode(raw, o.decrypter, o.lookup)
 }
 
 // Parse parses the configuration from io.Reader r.
-func Parse(r io.Reader) (*PoolFile, error) {
+func Parse(r io.Reader, opts ...ParseOption) (*PoolFile, error) {
+	o := newParseOptions(opts)
 	b, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	b, err = yaml.YAMLToJSON(b)
+	raw, err := resolve(b, o.dir)
+	if err != nil {
+		return nil, err
+	}
+	return decode(raw, o.decrypter, o.lookup)
+}
+
+// decode interpolates and decrypts the values of the resolved pool file
+// and decodes it.
+func decode(raw map[string]interface{}, decrypter Decrypter, lookup LookupEnv) (*PoolFile, error) {
+	var v interface{} = raw
+	var err error
+	// interpolated values may be encrypted.
+	if lookup != nil {
+		if v, err = walkStrings(v, "", func(path, s string) (string, error) {
+			return interpolateEnv(s, lookup, path)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if v, err = walkStrings(v, "", func(path, s string) (string, error) {
+		return decryptValue(s, decrypter, path)
+	}); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
@@ -36,3 +111,55 @@ func Parse(r io.Reader) (*PoolFile, error) {
 	err = json.Unmarshal(b, out)
 	return out, err
 }
+
+// walkStrings replaces the strings of the decoded pool file with the
+// result of fn. The path names the value in errors.
+func walkStrings(v interface{}, path string, fn func(path, s string) (string, error)) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			name := key
+			if path != "" {
+				name = path + "." + key
+			}
+			replaced, err := walkStrings(value, name, fn)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = replaced
+		}
+	case []interface{}:
+		for i, value := range v {
+			replaced, err := walkStrings(value, fmt.Sprintf("%s[%d]", path, i), fn)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = replaced
+		}
+	case string:
+		return fn(path, v)
+	}
+	return v, nil
+}
+
+// decryptValue returns the plaintext of an encrypted value, other values
+// are returned as they are. The plaintext is never part of an error.
+func decryptValue(v string, decrypter Decrypter, path string) (string, error) {
+	if !strings.HasPrefix(v, EncryptedPrefix) {
+		return v, nil
+	}
+	if decrypter == nil {
+		return "", fmt.Errorf("pool file: %s is encrypted but no decrypter is configured", path)
+	}
+	scheme, ciphertext, ok := strings.Cut(strings.TrimPrefix(v, EncryptedPrefix), ":")
+	if !ok || ciphertext == "" {
+		return "", fmt.Errorf("pool file: %s: %w", path, errMalformedEncrypted)
+	}
+	plaintext, err := decrypter.Decrypt(scheme, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("pool file: cannot decrypt %s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+var errMalformedEncrypted = errors.New("encrypted values have the form encrypted:<scheme>:<ciphertext>")
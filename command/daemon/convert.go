@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/drone-runners/drone-runner-aws/engine/resource"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/sirupsen/logrus"
+)
+
+// matrixConverter is the conversion extension expanding the vm pipelines
+// with a matrix, so that the server creates a stage per combination.
+type matrixConverter struct{}
+
+func (matrixConverter) Convert(_ context.Context, req *converter.Request) (*drone.Config, error) {
+	data, err := resource.Expand([]byte(req.Config.Data))
+	if err != nil {
+		return nil, err
+	}
+	// the configuration is left to the server if it has no matrix.
+	if string(data) == req.Config.Data {
+		return nil, nil
+	}
+	return &drone.Config{Data: string(data)}, nil
+}
+
+// withConverter serves the conversion extension on /convert, if the
+// secret is set, and the handler otherwise.
+func withConverter(handler http.Handler, secret string) http.Handler {
+	if secret == "" {
+		return handler
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/convert", converter.Handler(matrixConverter{}, secret, logrus.StandardLogger()))
+	mux.Handle("/", handler)
+	return mux
+}
@@ -10,15 +10,19 @@ import (
 	"os"
 	"time"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/engine"
 	"github.com/drone-runners/drone-runner-aws/engine/compiler"
 	"github.com/drone-runners/drone-runner-aws/engine/linter"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/internal/match"
 	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
+	"github.com/drone-runners/drone-runner-aws/notify"
 	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/environ/provider"
 	"github.com/drone/runner-go/handler/router"
@@ -96,6 +100,17 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 		),
 	)
 
+	fips.Enable(env.FIPS)
+	if fips.Enabled() {
+		logrus.WithField("boringcrypto", fips.Boring()).Infoln("FIPS mode enabled")
+	}
+	if err := audit.Open(&env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to open the audit trail")
+	}
+	if err := notify.Open(&env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to open the notifiers")
+	}
+
 	store, _, err := database.ProvideStore(env.Database.Driver, env.Database.Datasource)
 	if err != nil {
 		logrus.WithError(err).Fatalln("Unable to start the database")
@@ -141,6 +156,34 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 			Errorln("delegate: failed to start instance purger")
 		return err
 	}
+	if env.Settings.SetupTimeoutMins > 0 {
+		setupTimeout := time.Minute * time.Duration(env.Settings.SetupTimeoutMins)
+		err = poolManager.StartInstanceReconciler(ctx, setupTimeout)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("daemon: failed to start instance reconciler")
+			return err
+		}
+	}
+	if env.Settings.SSHKeyDir != "" {
+		rotation := time.Minute * time.Duration(env.Settings.SSHKeyRotationMins)
+		err = poolManager.StartSSHKeyRotation(ctx, env.Settings.SSHKeyDir, env.Settings.SSHKeyUser, rotation)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("daemon: failed to start ssh key rotation")
+			return err
+		}
+	}
+	if env.Settings.DiskGCMins > 0 {
+		interval := time.Minute * time.Duration(env.Settings.DiskGCMins)
+		pruneAge := time.Hour * time.Duration(env.Settings.DiskGCPruneAgeHours)
+		err = poolManager.StartDiskGC(ctx, interval, env.Settings.DiskGCThreshold, pruneAge)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("daemon: failed to start disk gc")
+			return err
+		}
+	}
 
 	opts := engine.Opts{
 		Repopulate: true,
@@ -157,8 +200,28 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 	hook := loghistory.New()
 	logrus.AddHook(hook)
 
+	privileges := &resource.Privileges{
+		Images:       env.Runner.PrivilegedImages,
+		Devices:      env.Runner.AllowedDevices,
+		Capabilities: env.Runner.AllowedCapabilities,
+	}
+	var policy *resource.Policy
+	if env.Policy.Untrusted {
+		policy = &resource.Policy{
+			Pools:   env.Policy.UntrustedPools,
+			Timeout: time.Minute * time.Duration(env.Policy.UntrustedTimeoutMins),
+		}
+		for _, pool := range policy.Pools {
+			if !poolManager.Exists(pool) {
+				logrus.WithField("pool", pool).
+					Fatalln("daemon: the pool of untrusted repositories does not exist")
+			}
+		}
+	}
 	daemonLint := linter.New(env.Settings.EnableAutoPool)
 	daemonLint.PoolManager = poolManager
+	daemonLint.Privileges = privileges
+	daemonLint.Policy = policy
 	runner := &runtime.Runner{
 		Client:   cli,
 		Machine:  env.Runner.Name,
@@ -179,8 +242,12 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 					env.Environ.SkipVerify,
 				),
 			),
-			NetworkOpts: env.Runner.NetworkOpts,
-			Volumes:     env.Runner.Volumes,
+			NetworkOpts:      env.Runner.NetworkOpts,
+			Volumes:          env.Runner.Volumes,
+			CreateWorkingDir: env.Runner.CreateWorkingDir,
+			VMSteps:          env.Runner.VMSteps,
+			Privileges:       privileges,
+			Policy:           policy,
 			Secret: secret.Combine(
 				secret.StaticVars(
 					env.Runner.Secrets,
@@ -220,24 +287,46 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 		).Exec,
 	}
 
-	pollerInstance := &poller.Poller{
-		Client:   cli,
-		Dispatch: runner.Run,
-		Filter: &client.Filter{
-			Kind:   resource.Kind,
-			Type:   resource.Type,
-			Labels: env.Runner.Labels,
-		},
+	// the server routes the stages matching the filter to the runner.
+	filter := &client.Filter{
+		Kind:    resource.Kind,
+		Type:    resource.Type,
+		OS:      env.Runner.OS,
+		Arch:    env.Runner.Arch,
+		Variant: env.Runner.Variant,
+		Kernel:  env.Runner.Kernel,
+		Labels:  env.Runner.Labels,
+	}
+	// the runner polls the stages of each platform with a share of its
+	// capacity if the capacity is partitioned, or all stages with all its
+	// capacity.
+	partitions := []partition{{os: env.Runner.OS, arch: env.Runner.Arch, capacity: env.Runner.Capacity}}
+	if len(env.Runner.PlatformCapacity) != 0 {
+		if env.Runner.OS != "" || env.Runner.Arch != "" {
+			logrus.Fatalln("daemon: DRONE_RUNNER_PLATFORM_CAPACITY cannot be combined with DRONE_RUNNER_OS or DRONE_RUNNER_ARCH")
+		}
+		if partitions, err = parsePartitions(env.Runner.PlatformCapacity); err != nil {
+			logrus.WithError(err).Fatalln("daemon: invalid platform capacity")
+		}
+	}
+	pollers := make([]*poller.Poller, len(partitions))
+	for i, p := range partitions {
+		f := p.filter(filter)
+		pollers[i] = &poller.Poller{
+			Client:   cli,
+			Dispatch: dispatch(f, runner.Run),
+			Filter:   f,
+		}
 	}
 
 	var g errgroup.Group
 	serverInstance := server.Server{
 		Addr: env.Server.Port,
-		Handler: router.New(tracer, hook, router.Config{
+		Handler: withConverter(router.New(tracer, hook, router.Config{
 			Username: env.Dashboard.Username,
 			Password: env.Dashboard.Password,
 			Realm:    env.Dashboard.Realm,
-		}),
+		}), env.Convert.Secret),
 	}
 
 	logrus.WithField("addr", env.Server.Port).
@@ -268,16 +357,22 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 		}
 	}
 
-	g.Go(func() error {
-		logrus.WithField("capacity", env.Runner.Capacity).
-			WithField("endpoint", env.Client.Address).
-			WithField("kind", resource.Kind).
-			WithField("type", resource.Type).
-			Infoln("daemon: polling the remote drone server")
-
-		pollerInstance.Poll(ctx, env.Runner.Capacity)
-		return nil
-	})
+	for i, p := range partitions {
+		pollerInstance, capacity := pollers[i], p.capacity
+		g.Go(func() error {
+			logrus.WithField("capacity", capacity).
+				WithField("endpoint", env.Client.Address).
+				WithField("kind", resource.Kind).
+				WithField("type", resource.Type).
+				WithField("os", pollerInstance.Filter.OS).
+				WithField("arch", pollerInstance.Filter.Arch).
+				WithField("labels", env.Runner.Labels).
+				Infoln("daemon: polling the remote drone server")
+
+			pollerInstance.Poll(ctx, capacity)
+			return nil
+		})
+	}
 	// if there is no keyfiles lets remove any old instances.
 	if !env.Settings.ReusePool {
 		cleanErr := poolManager.CleanPools(ctx, true, true)
@@ -319,6 +414,26 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 	return err
 }
 
+// dispatch returns the dispatch function of a poller. A stage is not
+// accepted if it does not match the filter, the server routes it to
+// another runner.
+func dispatch(filter *client.Filter, run func(context.Context, *drone.Stage) error) func(context.Context, *drone.Stage) error {
+	matchStage := match.Stage(filter)
+	return func(ctx context.Context, stage *drone.Stage) error {
+		if !matchStage(stage) {
+			logger.FromContext(ctx).
+				WithField("stage.id", stage.ID).
+				WithField("stage.type", stage.Type).
+				WithField("stage.os", stage.OS).
+				WithField("stage.arch", stage.Arch).
+				WithField("stage.labels", stage.Labels).
+				Warnln("daemon: stage does not match the runner, not accepted")
+			return nil
+		}
+		return run(ctx, stage)
+	}
+}
+
 func setupLogger(c *config.EnvConfig) {
 	logger.Default = logger.Logrus(
 		logrus.NewEntry(
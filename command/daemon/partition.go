@@ -0,0 +1,74 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone/runner-go/client"
+)
+
+// partition is a share of the capacity of the runner polling the server
+// for the stages of one platform, so the stages of a slow platform
+// cannot take the capacity of the others.
+type partition struct {
+	os       string
+	arch     string // empty for any architecture
+	capacity int
+}
+
+func (p partition) String() string {
+	if p.arch == "" {
+		return p.os
+	}
+	return p.os + "/" + p.arch
+}
+
+// parsePartitions parses the capacity of the platforms, keyed by os or
+// os/arch, e.g. linux/amd64:4,linux/arm64:2,windows:1. The partitions are
+// sorted by platform.
+func parsePartitions(capacities map[string]int) ([]partition, error) {
+	var partitions []partition
+	for platform, capacity := range capacities {
+		os, arch, _ := strings.Cut(platform, "/")
+		switch os {
+		case oshelp.OSLinux, oshelp.OSWindows, oshelp.OSMac:
+		default:
+			return nil, fmt.Errorf("daemon: platform %s: unsupported os %q", platform, os)
+		}
+		switch arch {
+		case "", oshelp.ArchAMD64, oshelp.ArchARM64:
+		default:
+			return nil, fmt.Errorf("daemon: platform %s: unsupported arch %q", platform, arch)
+		}
+		if capacity <= 0 {
+			return nil, fmt.Errorf("daemon: platform %s: capacity must be positive", platform)
+		}
+		partitions = append(partitions, partition{os: os, arch: arch, capacity: capacity})
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].String() < partitions[j].String()
+	})
+	for i := 1; i < len(partitions); i++ {
+		prev, p := partitions[i-1], partitions[i]
+		// the server would route the stages of a platform to both.
+		if prev.os == p.os && (prev.arch == "" || p.arch == "") {
+			return nil, fmt.Errorf("daemon: platforms %s and %s overlap", prev, p)
+		}
+	}
+	return partitions, nil
+}
+
+// filter returns the filter of the runner restricted to the platform of
+// the partition.
+func (p partition) filter(base *client.Filter) *client.Filter {
+	f := *base
+	f.OS = p.os
+	f.Arch = p.arch
+	return &f
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"testing"
+
+	"github.com/drone/runner-go/client"
+)
+
+func TestParsePartitions(t *testing.T) {
+	tests := []struct {
+		capacities map[string]int
+		want       []partition
+		wantErr    string
+	}{
+		{
+			capacities: map[string]int{"windows": 1, "linux/arm64": 2, "linux/amd64": 4},
+			want: []partition{
+				{os: "linux", arch: "amd64", capacity: 4},
+				{os: "linux", arch: "arm64", capacity: 2},
+				{os: "windows", capacity: 1},
+			},
+		},
+		{
+			capacities: map[string]int{"solaris": 1},
+			wantErr:    `daemon: platform solaris: unsupported os "solaris"`,
+		},
+		{
+			capacities: map[string]int{"linux/386": 1},
+			wantErr:    `daemon: platform linux/386: unsupported arch "386"`,
+		},
+		{
+			capacities: map[string]int{"linux": 0},
+			wantErr:    "daemon: platform linux: capacity must be positive",
+		},
+		{
+			capacities: map[string]int{"linux": 2, "linux/arm64": 1},
+			wantErr:    "daemon: platforms linux and linux/arm64 overlap",
+		},
+	}
+	for _, test := range tests {
+		got, err := parsePartitions(test.capacities)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("%v: want error %q, got %v", test.capacities, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %s", test.capacities, err)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%v: want %v, got %v", test.capacities, test.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%v: want %v, got %v", test.capacities, test.want, got)
+			}
+		}
+	}
+}
+
+func TestPartition_Filter(t *testing.T) {
+	base := &client.Filter{Kind: "pipeline", Type: "vm", Labels: map[string]string{"pool": "aws"}}
+	f := partition{os: "windows", arch: "amd64", capacity: 1}.filter(base)
+	if f.Kind != "pipeline" || f.Type != "vm" || f.OS != "windows" || f.Arch != "amd64" || f.Labels["pool"] != "aws" {
+		t.Errorf("want the filter of the runner for the platform, got %+v", f)
+	}
+	if base.OS != "" {
+		t.Errorf("want the filter of the runner unchanged")
+	}
+}
@@ -0,0 +1,65 @@
+package encrypt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
+
+	"filippo.io/age"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type encryptCommand struct {
+	kmsKeyID      string
+	kmsRegion     string
+	ageRecipients []string
+}
+
+func (c *encryptCommand) run(*kingpin.ParseContext) error {
+	if (c.kmsKeyID == "") == (len(c.ageRecipients) == 0) {
+		return errors.New("encrypt: either --kms-key-id or --age-recipient is required")
+	}
+	plaintext, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+
+	var value string
+	if c.kmsKeyID != "" {
+		client, clientErr := poolfile.NewKMSClient(c.kmsRegion)
+		if clientErr != nil {
+			return fmt.Errorf("encrypt: %w", clientErr)
+		}
+		value, err = poolfile.EncryptKMS(client, c.kmsKeyID, plaintext)
+	} else {
+		recipients, parseErr := age.ParseRecipients(strings.NewReader(strings.Join(c.ageRecipients, "\n")))
+		if parseErr != nil {
+			return fmt.Errorf("encrypt: %w", parseErr)
+		}
+		value, err = poolfile.EncryptAge(recipients, plaintext)
+	}
+	if err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// Register the encrypt command.
+func Register(app *kingpin.Application) {
+	c := new(encryptCommand)
+
+	cmd := app.Command("encrypt", "encrypts a pool file value read from stdin").
+		Action(c.run)
+	cmd.Flag("kms-key-id", "id, alias or arn of the KMS key encrypting the data key").
+		StringVar(&c.kmsKeyID)
+	cmd.Flag("kms-region", "region of the KMS key").
+		Envar("DRONE_POOL_SECRETS_KMS_REGION").
+		StringVar(&c.kmsRegion)
+	cmd.Flag("age-recipient", "age public key encrypting the value, can be repeated").
+		StringsVar(&c.ageRecipients)
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/command/internal"
 	"github.com/drone-runners/drone-runner-aws/engine"
@@ -20,6 +21,7 @@ import (
 	"github.com/drone-runners/drone-runner-aws/engine/linter"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
 	"github.com/drone-runners/drone-runner-aws/store/database"
 	"github.com/drone/drone-go/drone"
@@ -63,6 +65,11 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 	if err != nil {
 		return err
 	}
+	// the pipelines with a matrix are expanded, as by the conversion extension of the daemon.
+	rawsource, err = resource.Expand(rawsource)
+	if err != nil {
+		return err
+	}
 	// load the environment configuration from the environment
 	envConfig, err := config.FromEnviron()
 	if err != nil {
@@ -143,12 +150,25 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 	logrus.WithField("lite_engine_url", envConfig.LiteEngine.Path).Infoln("Using lite engine base url")
 
 	envConfig.Runner.Name = runnerName
+	fips.Enable(envConfig.FIPS)
+	if fips.Enabled() {
+		logrus.WithField("boringcrypto", fips.Boring()).Infoln("FIPS mode enabled")
+	}
+	if err = audit.Open(&envConfig); err != nil {
+		logrus.WithError(err).Fatalln("Unable to open the audit trail")
+	}
 	poolManager := drivers.New(ctx, store, &envConfig)
 	err = poolManager.Add(pools...)
 	if err != nil {
 		return err
 	}
 
+	privileges := &resource.Privileges{
+		Images:       envConfig.Runner.PrivilegedImages,
+		Devices:      envConfig.Runner.AllowedDevices,
+		Capabilities: envConfig.Runner.AllowedCapabilities,
+	}
+
 	// compile the pipeline to an intermediate representation.
 	comp := &compiler.Compiler{
 		Environ:     provider.Static(c.Environ),
@@ -157,11 +177,13 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 		Volumes:     c.Volumes,
 		PoolManager: poolManager,
 		Registry:    nil,
+		Privileges:  privileges,
 	}
 
 	// lint the pipeline and return an error if any linting rules are broken
 	lint := linter.New(envConfig.Settings.EnableAutoPool)
 	lint.PoolManager = poolManager
+	lint.Privileges = privileges
 	err = lint.Lint(res, c.Repo)
 	if err != nil {
 		return err
@@ -0,0 +1,157 @@
+package harness
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxPendingLine is the size an incomplete line is cut to, if the
+	// lines have no maximum length.
+	maxPendingLine = 1 << 20
+	// escapeSlack is the room left in an incomplete line for the escape
+	// sequences stripped from it.
+	escapeSlack = 4096
+)
+
+// ansiEscape matches the CSI (colors, cursor movement), OSC (window title,
+// hyperlinks) and two character escape sequences.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// cleanWriter is an io.WriteCloser which cleans up the lines before they
+// reach the log writer. It optionally strips ANSI escape sequences and
+// collapses carriage return rewrites, e.g. of progress bars, into the
+// final text of the line, and truncates the lines longer than the maximum
+// line length. This keeps the log within the size limit and readable in
+// the log viewer. An incomplete line is cut once it is longer than a line
+// can be, the rest of the line is dropped, so that the output of a step
+// which never ends its line does not grow the buffer.
+type cleanWriter struct {
+	w     io.WriteCloser
+	strip bool
+	max   int
+
+	mu        sync.Mutex
+	buf       []byte // incomplete line
+	truncated bool   // the incomplete line was cut
+	dropping  bool   // the rest of the incomplete line is dropped
+}
+
+func newCleanWriter(w io.WriteCloser, stripANSI bool, maxLineLength int) io.WriteCloser {
+	return &cleanWriter{w: w, strip: stripANSI, max: maxLineLength}
+}
+
+func (c *cleanWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := p
+	if c.dropping {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		// the newline ends the line which was cut.
+		data, c.dropping = data[i:], false
+	}
+	c.buf = append(c.buf, data...)
+	i := bytes.LastIndexByte(c.buf, '\n')
+	if i < 0 {
+		c.collapsePending()
+		c.capPending()
+		return len(p), nil
+	}
+	var out []byte
+	for _, line := range bytes.SplitAfter(c.buf[:i+1], []byte("\n")) {
+		out = append(out, c.cleanLine(line, c.truncated)...)
+		c.truncated = false
+	}
+	c.buf = append(c.buf[:0], c.buf[i+1:]...)
+	c.collapsePending()
+	c.capPending()
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *cleanWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) > 0 {
+		if out := c.cleanLine(c.buf, c.truncated); len(out) > 0 {
+			c.w.Write(out) //nolint:errcheck
+		}
+		c.buf = nil
+	}
+	return c.w.Close()
+}
+
+// collapsePending drops the text of the incomplete line which has already
+// been rewritten, so a progress bar which never ends the line does not
+// grow the buffer. A trailing carriage return is kept, it may be the
+// first half of a \r\n line ending.
+func (c *cleanWriter) collapsePending() {
+	if !c.strip {
+		return
+	}
+	if n := len(c.buf); n > 1 {
+		if i := bytes.LastIndexByte(c.buf[:n-1], '\r'); i >= 0 {
+			c.buf = append(c.buf[:0], c.buf[i+1:]...)
+		}
+	}
+}
+
+// capPending cuts the incomplete line once it is longer than a line can
+// be, the rest of the line is dropped until it ends.
+func (c *cleanWriter) capPending() {
+	limit := maxPendingLine
+	if c.max > 0 {
+		limit = c.max
+		if c.strip {
+			limit += escapeSlack
+		}
+	}
+	if len(c.buf) > limit {
+		c.buf = c.buf[:runeStart(c.buf, limit)]
+		c.truncated, c.dropping = true, true
+	}
+}
+
+// cleanLine returns the text of the line as displayed by a terminal,
+// without the escape sequences, truncated to the maximum line length.
+func (c *cleanWriter) cleanLine(line []byte, truncated bool) []byte {
+	var newline []byte
+	if bytes.HasSuffix(line, []byte("\n")) {
+		line, newline = line[:len(line)-1], []byte("\n")
+	}
+	if c.strip {
+		line = bytes.TrimRight(line, "\r")
+		if i := bytes.LastIndexByte(line, '\r'); i >= 0 {
+			line = line[i+1:]
+		}
+		line = ansiEscape.ReplaceAll(line, nil)
+	}
+	if c.max > 0 && len(line) > c.max {
+		n := runeStart(line, c.max)
+		line, truncated = line[:n:n], true
+	}
+	if truncated {
+		line = append(line[:len(line):len(line)], "... (log line truncated)"...)
+	}
+	return append(line, newline...)
+}
+
+// runeStart returns the largest index not above n which does not split a
+// utf-8 encoded character of the text.
+func runeStart(text []byte, n int) int {
+	for i := n; i > 0 && i > n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(text[i]) {
+			return i
+		}
+	}
+	return n
+}
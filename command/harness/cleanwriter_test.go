@@ -0,0 +1,116 @@
+package harness
+
+import (
+	"bytes"
+	"testing"
+)
+
+type nopWriteCloser struct {
+	bytes.Buffer
+}
+
+func (*nopWriteCloser) Close() error { return nil }
+
+func TestCleanWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		max    int
+		want   string
+	}{
+		{
+			name:   "colors",
+			writes: []string{"\x1b[1;32mok\x1b[0m done\n"},
+			want:   "ok done\n",
+		},
+		{
+			name:   "progress",
+			writes: []string{"[   ] 0%\r[#  ] 33%", "\r[## ] 66%\r[###] 100%\n"},
+			want:   "[###] 100%\n",
+		},
+		{
+			name:   "crlf split across writes",
+			writes: []string{"line one\r", "\nline two\r\n"},
+			want:   "line one\nline two\n",
+		},
+		{
+			name:   "escape split across writes",
+			writes: []string{"\x1b[3", "1merror\x1b[0m\n"},
+			want:   "error\n",
+		},
+		{
+			name:   "hyperlink",
+			writes: []string{"see \x1b]8;;https://example.com\x07docs\x1b]8;;\x07\n"},
+			want:   "see docs\n",
+		},
+		{
+			name:   "unterminated line",
+			writes: []string{"downloading 10%\rdownloading 100%"},
+			want:   "downloading 100%",
+		},
+		{
+			name:   "long line",
+			writes: []string{"abcdefgh\nabc\n"},
+			max:    4,
+			want:   "abcd... (log line truncated)\nabc\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := new(nopWriteCloser)
+			w := newCleanWriter(out, true, test.max)
+			for _, s := range test.writes {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != test.want {
+				t.Errorf("Want %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCleanWriter_NoStrip(t *testing.T) {
+	out := new(nopWriteCloser)
+	w := newCleanWriter(out, false, 0)
+	if _, err := w.Write([]byte("\x1b[32m10%\r100%\x1b[0m\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x1b[32m10%\r100%\x1b[0m\n"; out.String() != want {
+		t.Errorf("Want %q, got %q", want, out.String())
+	}
+}
+
+func TestCleanWriter_PendingLine(t *testing.T) {
+	out := new(nopWriteCloser)
+	w := newCleanWriter(out, false, 4)
+	for _, s := range []string{"abc", "defgh", "ijk", "l\nmn\n"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(w.(*cleanWriter).buf); n > 4 {
+			t.Errorf("Want the incomplete line cut to the maximum line length, got %d bytes", n)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "abcd... (log line truncated)\nmn\n"; out.String() != want {
+		t.Errorf("Want %q, got %q", want, out.String())
+	}
+}
+
+func TestCleanWriter_UTF8(t *testing.T) {
+	out := new(nopWriteCloser)
+	w := newCleanWriter(out, false, 4)
+	if _, err := w.Write([]byte("aéé\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "aé... (log line truncated)\n"; out.String() != want {
+		t.Errorf("Want %q, got %q", want, out.String())
+	}
+}
@@ -0,0 +1,166 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
+)
+
+// Concurrency runs one stage of a group at a time.
+type Concurrency = vmapi.Concurrency
+
+// ErrSuperseded is returned to a waiting stage when a newer stage of its
+// concurrency group supersedes it.
+var ErrSuperseded = errors.New("superseded by a newer stage of the concurrency group")
+
+var (
+	groups     *concurrencyGroups
+	groupsOnce sync.Once
+)
+
+// concurrencyGroups tracks the running and waiting stages of the groups.
+// Groups are kept in memory, runners do not share them.
+type concurrencyGroups struct {
+	mu     sync.Mutex
+	groups map[string]*concurrencyGroup
+	stages map[string]string // stage runtime ID to the group it runs in
+}
+
+type concurrencyGroup struct {
+	holder  string
+	since   time.Time
+	waiters []*groupWaiter
+}
+
+type groupWaiter struct {
+	stage      string
+	ready      chan struct{}
+	superseded bool
+}
+
+func concurrency() *concurrencyGroups {
+	groupsOnce.Do(func() {
+		groups = &concurrencyGroups{
+			groups: map[string]*concurrencyGroup{},
+			stages: map[string]string{},
+		}
+	})
+	return groups
+}
+
+// acquire returns once the stage runs in the group. A stage holding the
+// group longer than maxHold is assumed lost and the group is passed on,
+// maxHold is unlimited if zero. waiting is called if the stage waits.
+func (c *concurrencyGroups) acquire(ctx context.Context, group, stage string, supersede bool, maxHold time.Duration, waiting func()) error {
+	c.mu.Lock()
+	g, ok := c.groups[group]
+	if !ok {
+		g = &concurrencyGroup{}
+		c.groups[group] = g
+	}
+	if g.holder == stage {
+		c.mu.Unlock()
+		return nil
+	}
+	if g.holder == "" {
+		c.hold(g, group, stage)
+		c.mu.Unlock()
+		return nil
+	}
+	if supersede {
+		for _, w := range g.waiters {
+			w.superseded = true
+			close(w.ready)
+		}
+		g.waiters = nil
+	}
+	w := &groupWaiter{stage: stage, ready: make(chan struct{})}
+	g.waiters = append(g.waiters, w)
+	c.mu.Unlock()
+
+	waiting()
+	for {
+		if done, err := c.wait(ctx, g, w, maxHold); done {
+			return err
+		}
+	}
+}
+
+// wait waits until the group is passed to the waiter, the waiter is
+// superseded or its context is done. It returns false if the holder of the
+// group expired instead, the group is then passed on.
+func (c *concurrencyGroups) wait(ctx context.Context, g *concurrencyGroup, w *groupWaiter, maxHold time.Duration) (bool, error) {
+	var expired <-chan time.Time
+	if maxHold > 0 {
+		c.mu.Lock()
+		timer := time.NewTimer(time.Until(g.since.Add(maxHold)))
+		c.mu.Unlock()
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-w.ready:
+		if w.superseded {
+			return true, ErrSuperseded
+		}
+		return true, nil
+	case <-expired:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if g.holder != "" && time.Since(g.since) >= maxHold {
+			c.releaseLocked(g.holder)
+		}
+		return false, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i := range g.waiters {
+			if g.waiters[i] == w {
+				g.waiters = append(g.waiters[:i], g.waiters[i+1:]...)
+				break
+			}
+		}
+		// the group may have been passed to the waiter meanwhile.
+		if g.holder == w.stage {
+			c.releaseLocked(w.stage)
+		}
+		return true, ctx.Err()
+	}
+}
+
+// release passes the group of the stage to the next waiting stage. It is a
+// no-op if the stage does not run in a group.
+func (c *concurrencyGroups) release(stage string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.releaseLocked(stage)
+}
+
+func (c *concurrencyGroups) hold(g *concurrencyGroup, group, stage string) {
+	g.holder = stage
+	g.since = time.Now()
+	c.stages[stage] = group
+}
+
+func (c *concurrencyGroups) releaseLocked(stage string) {
+	group, ok := c.stages[stage]
+	if !ok {
+		return
+	}
+	delete(c.stages, stage)
+	g := c.groups[group]
+	if g == nil || g.holder != stage {
+		return
+	}
+	if len(g.waiters) == 0 {
+		delete(c.groups, group)
+		return
+	}
+	next := g.waiters[0]
+	g.waiters = g.waiters[1:]
+	c.hold(g, group, next.stage)
+	close(next.ready)
+}
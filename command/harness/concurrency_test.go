@@ -0,0 +1,115 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newConcurrencyGroups() *concurrencyGroups {
+	return &concurrencyGroups{groups: map[string]*concurrencyGroup{}, stages: map[string]string{}}
+}
+
+// acquireAsync acquires the group in a goroutine and waits until the stage
+// is queued.
+func acquireAsync(ctx context.Context, c *concurrencyGroups, stage string, supersede bool, maxHold time.Duration) <-chan error {
+	queued := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.acquire(ctx, "group", stage, supersede, maxHold, func() { close(queued) })
+	}()
+	select {
+	case <-queued:
+	case err := <-done:
+		done <- err
+	}
+	return done
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	c := newConcurrencyGroups()
+	ctx := context.Background()
+	if err := c.acquire(ctx, "group", "a", false, 0, func() { t.Error("want the first stage not to wait") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.acquire(ctx, "other", "x", false, 0, func() { t.Error("want groups to be independent") }); err != nil {
+		t.Fatal(err)
+	}
+	b := acquireAsync(ctx, c, "b", false, 0)
+	cc := acquireAsync(ctx, c, "c", false, 0)
+
+	c.release("a")
+	if err := <-b; err != nil {
+		t.Fatalf("want b to run after a, got %v", err)
+	}
+	select {
+	case <-cc:
+		t.Fatal("want c to wait for b")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.release("b")
+	if err := <-cc; err != nil {
+		t.Fatalf("want c to run after b, got %v", err)
+	}
+	c.release("c")
+	if _, ok := c.groups["group"]; ok {
+		t.Error("want the group to be removed once released")
+	}
+}
+
+func TestConcurrencySupersede(t *testing.T) {
+	c := newConcurrencyGroups()
+	ctx := context.Background()
+	if err := c.acquire(ctx, "group", "a", true, 0, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	b := acquireAsync(ctx, c, "b", true, 0)
+	cc := acquireAsync(ctx, c, "c", true, 0)
+	if err := <-b; !errors.Is(err, ErrSuperseded) {
+		t.Fatalf("want b to be superseded by c, got %v", err)
+	}
+	c.release("a")
+	if err := <-cc; err != nil {
+		t.Fatalf("want c to run after a, got %v", err)
+	}
+}
+
+func TestConcurrencyCancel(t *testing.T) {
+	c := newConcurrencyGroups()
+	if err := c.acquire(context.Background(), "group", "a", false, 0, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := acquireAsync(ctx, c, "b", false, 0)
+	cancel()
+	if err := <-b; !errors.Is(err, context.Canceled) {
+		t.Fatalf("want b to be canceled, got %v", err)
+	}
+	c.release("a")
+	if _, ok := c.groups["group"]; ok {
+		t.Error("want a canceled stage not to hold the group")
+	}
+}
+
+func TestConcurrencyMaxHold(t *testing.T) {
+	c := newConcurrencyGroups()
+	ctx := context.Background()
+	if err := c.acquire(ctx, "group", "a", false, 0, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	b := acquireAsync(ctx, c, "b", false, 20*time.Millisecond)
+	select {
+	case err := <-b:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want the group to be passed on once the holder expired")
+	}
+	// the lost stage is destroyed late, the group stays with b.
+	c.release("a")
+	if got := c.groups["group"].holder; got != "b" {
+		t.Errorf("want b to hold the group, got %q", got)
+	}
+}
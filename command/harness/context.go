@@ -3,17 +3,12 @@ package harness
 import (
 	"strconv"
 
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
+
 	"github.com/sirupsen/logrus"
 )
 
-type Context struct {
-	AccountID   string `json:"account_id,omitempty"`
-	OrgID       string `json:"org_id,omitempty"`
-	ProjectID   string `json:"project_id,omitempty"`
-	PipelineID  string `json:"pipeline_id,omitempty"`
-	RunSequence int    `json:"run_sequence,omitempty"`
-	TaskID      string `json:"task_id,omitempty"`
-}
+type Context = vmapi.Context
 
 func AddContext(logr *logrus.Entry, context *Context, tags map[string]string) *logrus.Entry {
 	return logr.WithField("account_id", GetAccountID(context, tags)).
@@ -0,0 +1,73 @@
+package delegate
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/drone-runners/drone-runner-aws/internal/httprender"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"since": func(unix int64) string {
+		if unix == 0 {
+			return "-"
+		}
+		return time.Since(time.Unix(unix, 0)).Truncate(time.Second).String()
+	},
+	"time": func(unix int64) string {
+		return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+	},
+}).Parse(dashboardHTML))
+
+type dashboardData struct {
+	*harness.RunnerStatus
+	LogKey string
+}
+
+// dashboardRouter returns the routes of the status dashboard, protected
+// with basic authentication.
+func (c *delegateCommand) dashboardRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(c.dashboardAuth())
+	r.Get("/", c.handleDashboard)
+	r.Get("/logs/{key}", c.handleDashboardLogs)
+	return r
+}
+
+// dashboardAuth returns the basic authentication of the dashboard.
+func (c *delegateCommand) dashboardAuth() func(http.Handler) http.Handler {
+	return middleware.BasicAuth(c.env.Dashboard.Realm, map[string]string{
+		c.env.Dashboard.Username: c.env.Dashboard.Password,
+	})
+}
+
+func (c *delegateCommand) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	c.renderDashboard(w, r, "")
+}
+
+func (c *delegateCommand) handleDashboardLogs(w http.ResponseWriter, r *http.Request) {
+	c.renderDashboard(w, r, chi.URLParam(r, "key"))
+}
+
+func (c *delegateCommand) renderDashboard(w http.ResponseWriter, r *http.Request, logKey string) {
+	data := &dashboardData{
+		RunnerStatus: harness.GetStatus(r.Context(), c.poolManager, c.history),
+		LogKey:       logKey,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		httprender.InternalError(w, "could not render dashboard", err, nil)
+	}
+}
+
+func (c *delegateCommand) handleStatus(w http.ResponseWriter, r *http.Request) {
+	httprender.OK(w, harness.GetStatus(r.Context(), c.poolManager, c.history))
+}
@@ -0,0 +1,36 @@
+package delegate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestDashboardTemplate(t *testing.T) {
+	data := &dashboardData{RunnerStatus: &harness.RunnerStatus{
+		Pools: []*harness.PoolStatus{
+			{
+				Name:   "linux-amd64",
+				Driver: "amazon",
+				Busy:   []*types.Instance{{Name: "runner-1", State: types.StateInUse, Started: time.Now().Unix(), Stage: "stage-1"}},
+				Free:   []*types.Instance{{Name: "runner-2", State: types.StateCreated}},
+			},
+		},
+		Errors: []*harness.StatusError{{Message: "could not provision a VM"}},
+		Logs:   []string{"setup-log"},
+	}}
+
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"linux-amd64", "runner-1", "stage-1", "runner-2", "could not provision a VM", "/dashboard/logs/setup-log"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Want %q in the rendered dashboard", s)
+		}
+	}
+}
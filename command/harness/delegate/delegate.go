@@ -3,15 +3,21 @@ package delegate
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/internal/httprender"
 	errors "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/notify"
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/store/database"
 	loghistory "github.com/drone/runner-go/logger/history"
@@ -32,17 +38,32 @@ type delegateCommand struct {
 	poolManager     *drivers.Manager
 	metrics         *metric.Metrics
 	stageOwnerStore store.StageOwnerStore
+	history         *loghistory.Hook
 }
 
 func (c *delegateCommand) delegateListener() http.Handler {
 	mux := chi.NewMux()
 
 	mux.Use(harness.Middleware)
+	mux.Use(harness.MaxBodySize(c.env.Server.MaxBodySizeBytes))
+	mux.Use(harness.RateLimit(c.env.Server.RateLimit, c.env.Server.RateLimitBurst))
 
 	mux.Post("/pool_owner", c.handlePoolOwner)
-	mux.Post("/setup", c.handleSetup)
+	mux.Get("/instances", c.handleListInstances)
+	mux.Get("/status", c.handleStatus)
+	mux.With(harness.ConcurrencyLimit(c.env.Server.MaxSetups)).Post("/setup", c.handleSetup)
 	mux.Post("/destroy", c.handleDestroy)
 	mux.Post("/step", c.handleStep)
+	mux.Post("/exec", c.handleExec)
+	mux.Get("/openapi.json", c.handleOpenAPI)
+
+	// the dashboard is only served when a password is configured. The live
+	// logs of the builds may hold secrets, they are streamed with the
+	// dashboard, behind the same basic authentication.
+	if !c.env.Dashboard.Disabled {
+		mux.With(c.dashboardAuth()).Get("/logs/{key}/stream", c.handleLogStream)
+		mux.Mount("/dashboard", c.dashboardRouter())
+	}
 
 	return mux
 }
@@ -98,6 +119,20 @@ func (c *delegateCommand) run(*kingpin.ParseContext) error {
 		cancel()
 	})
 
+	fips.Enable(c.env.FIPS)
+	if fips.Enabled() {
+		logrus.WithField("boringcrypto", fips.Boring()).Infoln("FIPS mode enabled")
+	}
+	if err := audit.Open(&c.env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to open the audit trail")
+	}
+	if err := notify.Open(&c.env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to open the notifiers")
+	}
+	if err := harness.OpenLogStreams(&c.env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to set up the log streams")
+	}
+
 	instanceStore, stageOwnerStore, err := database.ProvideStore(c.env.Database.Driver, c.env.Database.Datasource)
 	if err != nil {
 		logrus.WithError(err).Fatalln("Unable to start the database")
@@ -115,8 +150,8 @@ func (c *delegateCommand) run(*kingpin.ParseContext) error {
 	// Initialize metrics
 	c.registerMetrics(instanceStore)
 
-	hook := loghistory.New()
-	logrus.AddHook(hook)
+	c.history = loghistory.New()
+	logrus.AddHook(c.history)
 
 	var g errgroup.Group
 	runnerServer := server.Server{
@@ -181,6 +216,32 @@ func (c *delegateCommand) handlePoolOwner(w http.ResponseWriter, r *http.Request
 	httprender.OK(w, poolOwnerResponse{Owner: true})
 }
 
+// handleListInstances lists the instances of a pool. Key material is
+// never returned.
+func (c *delegateCommand) handleListInstances(w http.ResponseWriter, r *http.Request) {
+	poolName := r.URL.Query().Get("pool")
+	if poolName == "" {
+		httprender.BadRequest(w, "mandatory URL parameter 'pool' is missing", nil)
+		return
+	}
+	if !c.poolManager.Exists(poolName) {
+		httprender.NotFound(w, "pool not found: "+poolName, nil)
+		return
+	}
+	instances, err := c.poolManager.GetInstanceStore().List(r.Context(), poolName, nil)
+	if err != nil {
+		httprender.InternalError(w, "could not list instances", err, logrus.WithField("pool", poolName))
+		return
+	}
+	for _, instance := range instances {
+		instance.CAKey = nil
+		instance.CACert = nil
+		instance.TLSKey = nil
+		instance.TLSCert = nil
+	}
+	httprender.OK(w, instances)
+}
+
 func (c *delegateCommand) handleSetup(w http.ResponseWriter, r *http.Request) {
 	req := &harness.SetupVMRequest{}
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
@@ -216,14 +277,56 @@ func (c *delegateCommand) handleStep(w http.ResponseWriter, r *http.Request) {
 	httprender.OK(w, resp)
 }
 
+// handleExec runs a script on an instance. The script output is streamed
+// in the response body and the exit code is sent in the X-Exit-Code trailer.
+func (c *delegateCommand) handleExec(w http.ResponseWriter, r *http.Request) {
+	req := &harness.ExecVMRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		logrus.WithError(err).Error("could not decode VM exec request body")
+		httprender.BadRequest(w, err.Error(), nil)
+		return
+	}
+	// the request is checked before the status is written, the errors of
+	// the script itself are sent in the trailers.
+	inst, err := harness.ExecInstance(r.Context(), req, c.poolManager)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Trailer", "X-Exit-Code, X-Error")
+	w.WriteHeader(http.StatusOK)
+
+	resp, err := harness.HandleExec(r.Context(), req, inst, &c.env, c.poolManager, &flushWriter{w: w})
+	if err != nil {
+		logrus.WithField("instance_id", req.InstanceID).WithField("correlation_id", req.CorrelationID).
+			WithError(err).Error("could not exec script on VM")
+		w.Header().Set("X-Error", err.Error())
+		return
+	}
+	if resp.Error != "" {
+		w.Header().Set("X-Error", resp.Error)
+	}
+	w.Header().Set("X-Exit-Code", strconv.Itoa(resp.ExitCode))
+}
+
+// flushWriter flushes the response after every write so that output
+// is delivered to the client as it is produced.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
 func (c *delegateCommand) handleDestroy(w http.ResponseWriter, r *http.Request) {
-	// TODO: Change the java object to match VmCleanupRequest
-	rs := &struct {
-		ID            string `json:"id"`
-		InstanceID    string `json:"instance_id"`
-		PoolID        string `json:"pool_id"`
-		CorrelationID string `json:"correlation_id"`
-	}{}
+	rs := &vmapi.DestroyVMRequest{}
 	if err := json.NewDecoder(r.Body).Decode(rs); err != nil {
 		logrus.WithError(err).Error("could not decode VM destroy request body")
 		httprender.BadRequest(w, err.Error(), nil)
@@ -244,12 +347,55 @@ func (c *delegateCommand) handleDestroy(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleLogStream streams the lines written to a log key as server-sent
+// events until the log stream is closed or the client disconnects.
+func (c *delegateCommand) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httprender.InternalError(w, "streaming is not supported", nil, nil)
+		return
+	}
+
+	lines, cancel := harness.Logs().Subscribe(key)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, open := <-lines:
+			if !open {
+				fmt.Fprint(w, "event: eof\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			fmt.Fprint(w, "data: ")
+			if err := enc.Encode(line); err != nil {
+				logrus.WithError(err).WithField("key", key).Debugln("failed to encode log line")
+				return
+			}
+			fmt.Fprint(w, "\n")
+			flusher.Flush()
+		}
+	}
+}
+
 func writeError(w http.ResponseWriter, err error) {
 	switch err.(type) {
 	case *errors.BadRequestError:
 		httphelper.WriteBadRequest(w, err)
 	case *errors.NotFoundError:
 		httphelper.WriteNotFound(w, err)
+	case *errors.ConflictError:
+		httprender.Error(w, err.Error(), http.StatusConflict)
 	default:
 		httphelper.WriteInternalError(w, err)
 	}
@@ -0,0 +1,136 @@
+package delegate
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/certs"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/store/database/ldb"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/harness/lite-engine/api"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// fakeLiteEngine serves the steps of lite-engine, the steps print the
+// output and exit with the poll response.
+func fakeLiteEngine(t *testing.T, opts *types.InstanceCreateOpts, output string, poll *api.PollStepResponse) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start_step", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(&api.StartStepResponse{})
+	})
+	mux.HandleFunc("/poll_step", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(poll)
+	})
+	mux.HandleFunc("/stream_output", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, output)
+	})
+	cert, err := tls.X509KeyPair(opts.TLSCert, opts.TLSKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}
+	srv.StartTLS()
+	return srv
+}
+
+func TestHandleExec(t *testing.T) {
+	const runner = "runner-1"
+	opts, err := certs.Generate(runner, runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		req        string
+		status     int
+		body       string
+		exitCode   string
+		errTrailer string
+	}{
+		{
+			name:     "exit code",
+			req:      `{"instance_id": "i-1", "stage_runtime_id": "stage-1", "script": "make"}`,
+			status:   http.StatusOK,
+			body:     "building\ndone\n",
+			exitCode: "2",
+		},
+		{
+			name:       "error",
+			req:        `{"instance_id": "i-1", "stage_runtime_id": "stage-1", "script": "make"}`,
+			status:     http.StatusOK,
+			body:       "building\ndone\n",
+			exitCode:   "2",
+			errTrailer: "step failed",
+		},
+		{name: "bad request", req: `{"instance_id": "i-1"}`, status: http.StatusBadRequest},
+		{name: "not found", req: `{"instance_id": "i-2", "script": "make"}`, status: http.StatusNotFound},
+		{name: "other stage", req: `{"instance_id": "i-1", "stage_runtime_id": "stage-2", "script": "make"}`, status: http.StatusConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			le := fakeLiteEngine(t, opts, "building\ndone\n", &api.PollStepResponse{Exited: true, ExitCode: 2, Error: test.errTrailer})
+			defer le.Close()
+			host, port, err := net.SplitHostPort(le.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			leport, _ := strconv.ParseInt(port, 10, 64)
+
+			db, err := leveldb.Open(storage.NewMemStorage(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			instanceStore := ldb.NewInstanceStore(db)
+			if err = instanceStore.Create(context.Background(), &types.Instance{
+				ID: "i-1", Address: host, Port: leport, State: types.StateInUse, Stage: "stage-1",
+				Platform: types.Platform{OS: "linux"},
+				CACert:   opts.CACert, TLSCert: opts.TLSCert, TLSKey: opts.TLSKey,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			c := &delegateCommand{}
+			c.env.Runner.Name = runner
+			c.poolManager = drivers.New(context.Background(), instanceStore, &config.EnvConfig{Runner: c.env.Runner})
+
+			srv := httptest.NewServer(http.HandlerFunc(c.handleExec))
+			defer srv.Close()
+			res, err := http.Post(srv.URL, "application/json", bytes.NewBufferString(test.req))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.status {
+				t.Fatalf("Want status %d, got %d: %s", test.status, res.StatusCode, body)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if string(body) != test.body {
+				t.Errorf("Want body %q, got %q", test.body, body)
+			}
+			if got := res.Trailer.Get("X-Exit-Code"); got != test.exitCode {
+				t.Errorf("Want exit code trailer %q, got %q", test.exitCode, got)
+			}
+			if got := res.Trailer.Get("X-Error"); got != test.errTrailer {
+				t.Errorf("Want error trailer %q, got %q", test.errTrailer, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package delegate
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/harness/lite-engine/logstream"
+)
+
+type nopLogClient struct{}
+
+func (nopLogClient) Upload(context.Context, string, []*logstream.Line) error { return nil }
+func (nopLogClient) Open(context.Context, string) error                      { return nil }
+func (nopLogClient) Close(context.Context, string) error                     { return nil }
+func (nopLogClient) Write(context.Context, string, []*logstream.Line) error  { return nil }
+
+// openLogStream requests the log stream of the key, the handler has
+// subscribed to the key once the response headers are received.
+func openLogStream(t *testing.T, ctx context.Context, key, username, password string) *http.Response {
+	t.Helper()
+	c := &delegateCommand{}
+	c.env.Dashboard.Username = "admin"
+	c.env.Dashboard.Password = "password"
+	ts := httptest.NewServer(c.delegateListener())
+	t.Cleanup(ts.Close)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/logs/"+key+"/stream", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth(username, password)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestHandleLogStream(t *testing.T) {
+	ctx := context.Background()
+	client := harness.Logs().Client(nopLogClient{})
+	if err := client.Open(ctx, "stream-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	res := openLogStream(t, ctx, "stream-key", "admin", "password")
+	if got, want := res.Header.Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("Want content type %s, got %s", want, got)
+	}
+	if err := client.Write(ctx, "stream-key", []*logstream.Line{{Message: "hello"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(ctx, "stream-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if text := scanner.Text(); text != "" {
+			events = append(events, text)
+		}
+	}
+	want := []string{
+		`data: {"Level":"","Message":"hello","ElaspedTime":0,"Number":0,"Timestamp":"0001-01-01T00:00:00Z"}`,
+		"event: eof",
+		"data: {}",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Want events %q, got %q", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("Want event %q, got %q", want[i], events[i])
+		}
+	}
+}
+
+func TestHandleLogStream_Disconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	openLogStream(t, ctx, "disconnect-key", "admin", "password")
+	if got := harness.Logs().Subscribers("disconnect-key"); got != 1 {
+		t.Fatalf("Want 1 subscriber, got %d", got)
+	}
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for harness.Logs().Subscribers("disconnect-key") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Want the subscriber removed once the client disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleLogStream_Unauthorized(t *testing.T) {
+	res := openLogStream(t, context.Background(), "auth-key", "admin", "wrong")
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Want status %d, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+	if got := harness.Logs().Subscribers("auth-key"); got != 0 {
+		t.Errorf("Want no subscriber, got %d", got)
+	}
+}
+
+func TestHandleLogStream_DashboardDisabled(t *testing.T) {
+	c := &delegateCommand{}
+	c.env.Dashboard.Disabled = true
+	ts := httptest.NewServer(c.delegateListener())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/logs/key/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Want status %d, got %d", http.StatusNotFound, res.StatusCode)
+	}
+}
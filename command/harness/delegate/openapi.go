@@ -0,0 +1,244 @@
+package delegate
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
+	"github.com/drone-runners/drone-runner-aws/internal/httprender"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+)
+
+// schema is a subset of the OpenAPI 3 schema object.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+type operation struct {
+	Summary     string               `json:"summary"`
+	Parameters  []parameter          `json:"parameters,omitempty"`
+	RequestBody *body                `json:"requestBody,omitempty"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type body struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       map[string]string                `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// route describes a delegate endpoint for the OpenAPI document.
+type route struct {
+	method, path, summary string
+	params                []parameter
+	in, out               interface{}
+	contentType           string // response content type, defaults to application/json
+}
+
+// routes are the endpoints of delegateListener, TestRoutes fails when they
+// differ.
+var routes = []route{
+	{method: http.MethodPost, path: "/pool_owner", summary: "Check if the runner owns a pool",
+		params: []parameter{queryParam("pool", true), queryParam("stageId", false)},
+		out: struct {
+			Owner bool `json:"owner"`
+		}{}},
+	{method: http.MethodGet, path: "/instances", summary: "List the instances of a pool",
+		params: []parameter{queryParam("pool", true)}, out: []*types.Instance{}},
+	{method: http.MethodGet, path: "/status", summary: "Pools, instances and recent errors of the runner",
+		out: harness.RunnerStatus{}},
+	{method: http.MethodPost, path: "/setup", summary: "Provision an instance and setup lite-engine",
+		in: harness.SetupVMRequest{}, out: harness.SetupVMResponse{}},
+	{method: http.MethodPost, path: "/step", summary: "Run a step on an instance",
+		in: harness.ExecuteVMRequest{}, out: api.PollStepResponse{}},
+	{method: http.MethodPost, path: "/exec", summary: "Run a script on an instance and stream its output",
+		in: harness.ExecVMRequest{}, contentType: "text/plain"},
+	{method: http.MethodPost, path: "/destroy", summary: "Destroy the instance of a stage",
+		in: vmapi.DestroyVMRequest{}},
+	{method: http.MethodGet, path: "/logs/{key}/stream", summary: "Stream log lines as server-sent events, with the basic authentication of the dashboard",
+		params: []parameter{{Name: "key", In: "path", Required: true, Schema: &schema{Type: "string"}}},
+		out:    logstream.Line{}, contentType: "text/event-stream"},
+}
+
+func queryParam(name string, required bool) parameter {
+	return parameter{Name: name, In: "query", Required: required, Schema: &schema{Type: "string"}}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  *document
+)
+
+func (c *delegateCommand) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIDoc = buildOpenAPI(routes)
+	})
+	httprender.OK(w, openAPIDoc)
+}
+
+// buildOpenAPI generates an OpenAPI 3 document for the routes.
+func buildOpenAPI(rs []route) *document {
+	doc := &document{
+		OpenAPI: "3.0.3",
+		Info:    map[string]string{"title": "drone-runner-aws delegate API", "version": "1.0"},
+		Paths:   map[string]map[string]*operation{},
+	}
+	doc.Components.Schemas = map[string]*schema{}
+	g := &generator{components: doc.Components.Schemas}
+
+	for _, rt := range rs {
+		op := &operation{
+			Summary:    rt.summary,
+			Parameters: rt.params,
+			Responses:  map[string]*response{"200": {Description: "OK"}},
+		}
+		if rt.in != nil {
+			op.RequestBody = &body{
+				Required: true,
+				Content:  map[string]mediaType{"application/json": {Schema: g.schemaOf(reflect.TypeOf(rt.in))}},
+			}
+		}
+		contentType := rt.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		if rt.out != nil {
+			op.Responses["200"].Content = map[string]mediaType{contentType: {Schema: g.schemaOf(reflect.TypeOf(rt.out))}}
+		} else if rt.contentType != "" {
+			op.Responses["200"].Content = map[string]mediaType{contentType: {Schema: &schema{Type: "string"}}}
+		}
+		op.Responses["default"] = &response{
+			Description: "Error",
+			Content:     map[string]mediaType{"application/json": {Schema: g.schemaOf(reflect.TypeOf(errorResponse{}))}},
+		}
+		if doc.Paths[rt.path] == nil {
+			doc.Paths[rt.path] = map[string]*operation{}
+		}
+		doc.Paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+	return doc
+}
+
+type errorResponse struct {
+	Message string `json:"error_msg"`
+}
+
+// generator converts go types to OpenAPI schemas. Named struct types
+// are added to the components and referenced.
+type generator struct {
+	components map[string]*schema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *generator) schemaOf(t reflect.Type) *schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &schema{Type: "string", Format: "byte"}
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structOf(t)
+		}
+		name := strings.ReplaceAll(t.String(), "*", "")
+		if _, ok := g.components[name]; !ok {
+			// reserve the name first so recursive types terminate.
+			g.components[name] = &schema{}
+			*g.components[name] = *g.structOf(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &schema{}
+	}
+}
+
+func (g *generator) structOf(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: map[string]*schema{}}
+	g.addFields(s, t)
+	return s
+}
+
+func (g *generator) addFields(s *schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		// embedded structs without a json name are inlined.
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schemaOf(f.Type)
+	}
+}
@@ -0,0 +1,64 @@
+package delegate
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBuildOpenAPI(t *testing.T) {
+	doc := buildOpenAPI(routes)
+
+	for _, rt := range routes {
+		if _, ok := doc.Paths[rt.path]; !ok {
+			t.Errorf("Want path %s in the document", rt.path)
+		}
+	}
+
+	setup, ok := doc.Components.Schemas["vmapi.SetupVMRequest"]
+	if !ok {
+		t.Fatalf("Want schema vmapi.SetupVMRequest in the components")
+	}
+	for _, name := range []string{"id", "pool_id", "setup_request", "context"} {
+		if _, ok := setup.Properties[name]; !ok {
+			t.Errorf("Want property %s in vmapi.SetupVMRequest", name)
+		}
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRoutes checks that the OpenAPI routes are the endpoints the delegate
+// serves, the document is not generated from the router.
+func TestRoutes(t *testing.T) {
+	c := &delegateCommand{}
+	c.env.Dashboard.Password = "password"
+	served := map[string]bool{}
+	err := chi.Walk(c.delegateListener().(chi.Routes), func(method, path string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if path != "/openapi.json" && !strings.HasPrefix(path, "/dashboard/") {
+			served[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	for _, rt := range routes {
+		documented[rt.method+" "+rt.path] = true
+		if !served[rt.method+" "+rt.path] {
+			t.Errorf("Want %s %s served, it is documented", rt.method, rt.path)
+		}
+	}
+	for route := range served {
+		if !documented[route] {
+			t.Errorf("Want %s documented, it is served", route)
+		}
+	}
+}
@@ -101,6 +101,18 @@ func handleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerS
 
 	logr.Infoln("starting the destroy process")
 
+	// the instance of a preempted stage is already destroyed.
+	if by, ok := runningStagesOf().preemptedBy(r.StageRuntimeID); ok {
+		logr.WithField("preempted_by", by).Infoln("stage was preempted, its instance is already destroyed")
+		runningStagesOf().remove(r.StageRuntimeID)
+		envState().Delete(r.StageRuntimeID)
+		concurrency().release(r.StageRuntimeID)
+		if err = s.Delete(ctx, r.StageRuntimeID); err != nil {
+			logr.WithError(err).Errorln("failed to delete stage owner entity")
+		}
+		return nil, nil
+	}
+
 	inst, err := poolManager.GetInstanceByStageID(ctx, poolID, r.StageRuntimeID)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get the instance by tag: %w", err)
@@ -162,9 +174,12 @@ func handleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerS
 	if err = poolManager.Destroy(ctx, poolID, inst.ID); err != nil {
 		return nil, fmt.Errorf("cannot destroy the instance: %w", err)
 	}
+	fairQueueOf().notify(poolID)
 	logr.Infoln("destroyed instance")
 
+	runningStagesOf().remove(r.StageRuntimeID)
 	envState().Delete(r.StageRuntimeID)
+	concurrency().release(r.StageRuntimeID)
 
 	if err = s.Delete(ctx, r.StageRuntimeID); err != nil {
 		logr.WithError(err).Errorln("failed to delete stage owner entity")
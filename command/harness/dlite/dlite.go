@@ -4,10 +4,13 @@ import (
 	"context"
 	"time"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/command/harness"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/notify"
 	"github.com/drone-runners/drone-runner-aws/store/database"
 	"github.com/drone-runners/drone-runner-aws/types"
 	loghistory "github.com/drone/runner-go/logger/history"
@@ -111,6 +114,20 @@ func (c *dliteCommand) run(*kingpin.ParseContext) error {
 	// Initialize metrics
 	c.registerMetrics()
 
+	fips.Enable(c.env.FIPS)
+	if fips.Enabled() {
+		logrus.WithField("boringcrypto", fips.Boring()).Infoln("FIPS mode enabled")
+	}
+	if err = audit.Open(&c.env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to open the audit trail")
+	}
+	if err = notify.Open(&c.env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to open the notifiers")
+	}
+	if err = harness.OpenLogStreams(&c.env); err != nil {
+		logrus.WithError(err).Fatalln("Unable to set up the log streams")
+	}
+
 	ctx = context.WithValue(ctx, types.Hosted, true)
 	var poolConfig *config.PoolFile
 
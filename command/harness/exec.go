@@ -0,0 +1,84 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	ierrors "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExecVMRequest runs an arbitrary script on a provisioned instance.
+type ExecVMRequest = vmapi.ExecVMRequest
+
+var defaultExecTimeout = time.Hour
+
+// ExecInstance validates the request and returns the instance the script
+// runs on. The instance must be in use, by the stage of the request if it
+// is set up for a stage.
+func ExecInstance(ctx context.Context, r *ExecVMRequest, poolManager drivers.IManager) (*types.Instance, error) {
+	if r.InstanceID == "" {
+		return nil, ierrors.NewBadRequestError("mandatory field 'instance_id' in the request body is empty")
+	}
+	if r.Script == "" {
+		return nil, ierrors.NewBadRequestError("mandatory field 'script' in the request body is empty")
+	}
+
+	inst, err := poolManager.Find(ctx, r.InstanceID)
+	if err != nil {
+		return nil, ierrors.NewNotFoundError(fmt.Sprintf("cannot get the instance by Id %s: %s", r.InstanceID, err))
+	}
+	if inst.State != types.StateInUse {
+		return nil, ierrors.NewConflictError(fmt.Sprintf("instance %s is not in use", r.InstanceID))
+	}
+	if inst.Stage != "" && inst.Stage != r.StageRuntimeID {
+		return nil, ierrors.NewConflictError(fmt.Sprintf("instance %s is not set up for stage %q", r.InstanceID, r.StageRuntimeID))
+	}
+	return inst, nil
+}
+
+// HandleExec uploads the script in the request to the instance returned by
+// ExecInstance, runs it and writes the combined stdout/stderr of the script
+// to output as it is produced. It returns once the script has exited.
+func HandleExec(ctx context.Context, r *ExecVMRequest, inst *types.Instance, env *config.EnvConfig, poolManager drivers.IManager, output io.Writer) (*api.PollStepResponse, error) {
+	logr := logrus.
+		WithField("api", "dlite:exec").
+		WithField("instance_id", r.InstanceID).
+		WithField("correlation_id", r.CorrelationID)
+
+	logr = logr.WithField("ip", inst.Address)
+	ctx = logger.WithContext(ctx, logr)
+
+	client, err := lehelper.GetClient(inst, poolManager.GetTLSServerName(), inst.Port, env.LiteEngine.EnableMock, env.LiteEngine.MockStepTimeoutSecs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	timeout := defaultExecTimeout
+	if r.Timeout > 0 {
+		timeout = time.Duration(r.Timeout) * time.Second
+	}
+
+	pollResponse, err := lehelper.RunScript(ctx, client, inst.Platform.OS, &lehelper.Script{
+		Data:       r.Script,
+		Envs:       r.Envs,
+		WorkingDir: r.WorkingDir,
+		Timeout:    timeout,
+	}, output)
+	if err != nil {
+		return nil, err
+	}
+
+	logr.WithField("exit_code", pollResponse.ExitCode).Traceln("completed exec")
+	return pollResponse, nil
+}
@@ -0,0 +1,60 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	ierrors "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// fakeManager finds the instances of the map.
+type fakeManager struct {
+	drivers.IManager
+	instances map[string]*types.Instance
+}
+
+func (m *fakeManager) Find(_ context.Context, id string) (*types.Instance, error) {
+	if inst, ok := m.instances[id]; ok {
+		return inst, nil
+	}
+	return nil, errors.New("instance not found")
+}
+
+func TestExecInstance(t *testing.T) {
+	manager := &fakeManager{instances: map[string]*types.Instance{
+		"free":   {ID: "free", State: types.StateCreated},
+		"staged": {ID: "staged", State: types.StateInUse, Stage: "stage-1"},
+		"check":  {ID: "check", State: types.StateInUse},
+	}}
+	tests := []struct {
+		name    string
+		req     *ExecVMRequest
+		wantErr interface{}
+	}{
+		{name: "no instance", req: &ExecVMRequest{Script: "ls"}, wantErr: new(*ierrors.BadRequestError)},
+		{name: "no script", req: &ExecVMRequest{InstanceID: "staged"}, wantErr: new(*ierrors.BadRequestError)},
+		{name: "not found", req: &ExecVMRequest{InstanceID: "unknown", Script: "ls"}, wantErr: new(*ierrors.NotFoundError)},
+		{name: "not in use", req: &ExecVMRequest{InstanceID: "free", Script: "ls"}, wantErr: new(*ierrors.ConflictError)},
+		{name: "other stage", req: &ExecVMRequest{InstanceID: "staged", StageRuntimeID: "stage-2", Script: "ls"}, wantErr: new(*ierrors.ConflictError)},
+		{name: "no stage", req: &ExecVMRequest{InstanceID: "staged", Script: "ls"}, wantErr: new(*ierrors.ConflictError)},
+		{name: "stage", req: &ExecVMRequest{InstanceID: "staged", StageRuntimeID: "stage-1", Script: "ls"}},
+		{name: "instance without stage", req: &ExecVMRequest{InstanceID: "check", Script: "ls"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inst, err := ExecInstance(context.Background(), test.req, manager)
+			if test.wantErr == nil {
+				if err != nil || inst == nil || inst.ID != test.req.InstanceID {
+					t.Errorf("Want instance %s, got %v %v", test.req.InstanceID, inst, err)
+				}
+				return
+			}
+			if !errors.As(err, test.wantErr) {
+				t.Errorf("Want error %T, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// fairQueuePoll is the interval at which the next waiting stage retries,
+// capacity is also freed by the purger and failed setups.
+var fairQueuePoll = 5 * time.Second
+
+var (
+	queues     *fairQueues
+	queuesOnce sync.Once
+)
+
+// fairQueues holds the stages waiting for a saturated pool. Each pool
+// serves its waiting stages by priority, then round-robin per project,
+// and in arrival order within a project, so that the stages of one busy
+// project do not take all the capacity of the pool.
+type fairQueues struct {
+	mu    sync.Mutex
+	pools map[string]*fairQueue
+}
+
+type fairQueue struct {
+	levels  []*fairLevel // by descending priority, levels[0] is served next
+	changed chan struct{}
+}
+
+// fairLevel holds the waiting stages of a priority.
+type fairLevel struct {
+	priority int
+	keys     []string // keys with waiting stages, keys[0] is served next
+	waiters  map[string][]*fairWaiter
+}
+
+type fairWaiter struct {
+	key      string
+	priority int
+}
+
+func fairQueueOf() *fairQueues {
+	queuesOnce.Do(func() {
+		queues = &fairQueues{pools: map[string]*fairQueue{}}
+	})
+	return queues
+}
+
+// provision calls provision until it returns an instance. If the pool is
+// saturated, or stages of the same or a higher priority wait for it, the
+// stage waits for its turn up to maxWait. waiting is called if the stage
+// waits.
+func (q *fairQueues) provision(ctx context.Context, pool, key string, priority int, maxWait time.Duration, waiting func(),
+	provision func() (*types.Instance, error)) (*types.Instance, error) {
+	q.mu.Lock()
+	fq := q.queue(pool)
+	queued := len(fq.levels) != 0 && fq.levels[0].priority >= priority
+	q.mu.Unlock()
+
+	if !queued {
+		inst, err := provision()
+		if !errors.Is(err, drivers.ErrorNoInstanceAvailable) {
+			return inst, err
+		}
+	}
+
+	w := &fairWaiter{key: key, priority: priority}
+	q.mu.Lock()
+	fq.push(w)
+	q.mu.Unlock()
+	waiting()
+
+	ctx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+	ticker := time.NewTicker(fairQueuePoll)
+	defer ticker.Stop()
+	for {
+		q.mu.Lock()
+		next := fq.next() == w
+		changed := fq.changed
+		q.mu.Unlock()
+
+		if next {
+			inst, err := provision()
+			if !errors.Is(err, drivers.ErrorNoInstanceAvailable) {
+				q.mu.Lock()
+				fq.remove(w, true)
+				q.mu.Unlock()
+				return inst, err
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case <-ctx.Done():
+			q.mu.Lock()
+			fq.remove(w, false)
+			q.mu.Unlock()
+			return nil, fmt.Errorf("waited %s for the pool: %w", maxWait, drivers.ErrorNoInstanceAvailable)
+		}
+	}
+}
+
+// notify wakes the next waiting stage of the pool, an instance of the pool
+// was freed.
+func (q *fairQueues) notify(pool string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if fq, ok := q.pools[pool]; ok {
+		fq.notify()
+	}
+}
+
+func (q *fairQueues) queue(pool string) *fairQueue {
+	fq, ok := q.pools[pool]
+	if !ok {
+		fq = &fairQueue{changed: make(chan struct{})}
+		q.pools[pool] = fq
+	}
+	return fq
+}
+
+func (fq *fairQueue) push(w *fairWaiter) {
+	i := 0
+	for i < len(fq.levels) && fq.levels[i].priority > w.priority {
+		i++
+	}
+	if i == len(fq.levels) || fq.levels[i].priority != w.priority {
+		level := &fairLevel{priority: w.priority, waiters: map[string][]*fairWaiter{}}
+		fq.levels = append(fq.levels[:i:i], append([]*fairLevel{level}, fq.levels[i:]...)...)
+	}
+	level := fq.levels[i]
+	if len(level.waiters[w.key]) == 0 {
+		level.keys = append(level.keys, w.key)
+	}
+	level.waiters[w.key] = append(level.waiters[w.key], w)
+	// a stage of a higher priority is served next.
+	fq.notify()
+}
+
+func (fq *fairQueue) next() *fairWaiter {
+	if len(fq.levels) == 0 {
+		return nil
+	}
+	level := fq.levels[0]
+	return level.waiters[level.keys[0]][0]
+}
+
+// remove removes the waiter. A served key moves to the end of the
+// round-robin order of its priority if it has more waiting stages.
+func (fq *fairQueue) remove(w *fairWaiter, served bool) {
+	defer fq.notify()
+	for l, level := range fq.levels {
+		if level.priority != w.priority {
+			continue
+		}
+		waiters := level.waiters[w.key]
+		for i := range waiters {
+			if waiters[i] == w {
+				waiters = append(waiters[:i:i], waiters[i+1:]...)
+				break
+			}
+		}
+		level.waiters[w.key] = waiters
+		for i, key := range level.keys {
+			if key != w.key {
+				continue
+			}
+			if len(waiters) == 0 {
+				delete(level.waiters, w.key)
+				level.keys = append(level.keys[:i:i], level.keys[i+1:]...)
+			} else if served {
+				level.keys = append(append(level.keys[:i:i], level.keys[i+1:]...), w.key)
+			}
+			break
+		}
+		if len(level.keys) == 0 {
+			fq.levels = append(fq.levels[:l:l], fq.levels[l+1:]...)
+		}
+		return
+	}
+}
+
+func (fq *fairQueue) notify() {
+	close(fq.changed)
+	fq.changed = make(chan struct{})
+}
@@ -0,0 +1,139 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// fakeCapacity provisions instances while it has capacity.
+type fakeCapacity struct {
+	mu   sync.Mutex
+	free int
+}
+
+func (c *fakeCapacity) provision(id string) func() (*types.Instance, error) {
+	return func() (*types.Instance, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.free == 0 {
+			return nil, drivers.ErrorNoInstanceAvailable
+		}
+		c.free--
+		return &types.Instance{ID: id}, nil
+	}
+}
+
+func (c *fakeCapacity) add() {
+	c.mu.Lock()
+	c.free++
+	c.mu.Unlock()
+}
+
+type queuedStage struct {
+	key      string
+	id       string
+	priority int
+}
+
+// queueStages queues the stages in order, served receives the ids of the
+// stages that got an instance.
+func queueStages(t *testing.T, q *fairQueues, capacity *fakeCapacity, stages []queuedStage) <-chan string {
+	served := make(chan string, len(stages))
+	for _, stage := range stages {
+		queued := make(chan struct{})
+		go func(stage queuedStage) {
+			inst, err := q.provision(context.Background(), "pool", stage.key, stage.priority, time.Minute, func() { close(queued) }, capacity.provision(stage.id))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			served <- inst.ID
+		}(stage)
+		<-queued
+	}
+	return served
+}
+
+func TestFairQueueRoundRobin(t *testing.T) {
+	q := &fairQueues{pools: map[string]*fairQueue{}}
+	capacity := &fakeCapacity{}
+	served := queueStages(t, q, capacity, []queuedStage{{key: "a", id: "a1"}, {key: "a", id: "a2"}, {key: "a", id: "a3"}, {key: "b", id: "b1"}})
+
+	want := []string{"a1", "b1", "a2", "a3"}
+	for _, id := range want {
+		capacity.add()
+		q.notify("pool")
+		select {
+		case got := <-served:
+			if got != id {
+				t.Fatalf("want %s to be served, got %s", id, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("want %s to be served", id)
+		}
+	}
+	if len(q.pools["pool"].levels) != 0 {
+		t.Errorf("want an empty queue, got %d levels", len(q.pools["pool"].levels))
+	}
+}
+
+func TestFairQueueTimeout(t *testing.T) {
+	q := &fairQueues{pools: map[string]*fairQueue{}}
+	capacity := &fakeCapacity{}
+	_, err := q.provision(context.Background(), "pool", "a", 0, 10*time.Millisecond, func() {}, capacity.provision("a1"))
+	if !errors.Is(err, drivers.ErrorNoInstanceAvailable) {
+		t.Fatalf("want no instance available, got %v", err)
+	}
+	if len(q.pools["pool"].levels) != 0 {
+		t.Error("want the timed out stage to leave the queue")
+	}
+
+	capacity.add()
+	inst, err := q.provision(context.Background(), "pool", "a", 0, time.Minute, func() { t.Error("want no wait with free capacity") }, capacity.provision("a2"))
+	if err != nil || inst.ID != "a2" {
+		t.Errorf("want a2 provisioned at once, got %v %v", inst, err)
+	}
+}
+
+func TestFairQueuePriority(t *testing.T) {
+	q := &fairQueues{pools: map[string]*fairQueue{}}
+	capacity := &fakeCapacity{}
+	served := queueStages(t, q, capacity, []queuedStage{
+		{key: "a", id: "a1"},
+		{key: "b", id: "b1", priority: -1},
+		{key: "a", id: "hotfix", priority: 5},
+		{key: "c", id: "c1"},
+	})
+
+	for _, id := range []string{"hotfix", "a1", "c1", "b1"} {
+		capacity.add()
+		q.notify("pool")
+		select {
+		case got := <-served:
+			if got != id {
+				t.Fatalf("want %s to be served, got %s", id, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("want %s to be served", id)
+		}
+	}
+}
+
+func TestFairQueuePriorityJumpsTheQueue(t *testing.T) {
+	q := &fairQueues{pools: map[string]*fairQueue{}}
+	capacity := &fakeCapacity{}
+	queueStages(t, q, capacity, []queuedStage{{key: "a", id: "a1"}})
+
+	// an instance is freed before the waiting stage retries.
+	capacity.add()
+	inst, err := q.provision(context.Background(), "pool", "b", 1, time.Minute, func() { t.Error("want a higher priority not to wait") }, capacity.provision("b1"))
+	if err != nil || inst.ID != "b1" {
+		t.Errorf("want b1 provisioned at once, got %v %v", inst, err)
+	}
+}
@@ -2,28 +2,77 @@ package harness
 
 import (
 	"hash/fnv"
+	"io"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/logsink"
 	leapi "github.com/harness/lite-engine/api"
 	lelivelog "github.com/harness/lite-engine/livelog"
+	"github.com/harness/lite-engine/logstream"
 	lestream "github.com/harness/lite-engine/logstream/remote"
 	"github.com/sirupsen/logrus"
 )
 
-func getStreamLogger(cfg leapi.LogConfig, logKey, correlationID string) *lelivelog.Writer {
-	client := lestream.NewHTTPClient(cfg.URL, cfg.AccountID,
+func getStreamLogger(env *config.EnvConfig, cfg leapi.LogConfig, limits *LogLimits, logKey, correlationID string) io.WriteCloser {
+	var client logstream.Client = lestream.NewHTTPClient(cfg.URL, cfg.AccountID,
 		cfg.Token, cfg.IndirectUpload, false)
-	wc := lelivelog.New(client, logKey, correlationID, nil, true)
+	if env.LiveLog.SpillDir != "" {
+		client = newSpillClient(client, env.LiveLog.SpillDir, logKey)
+	}
+	if len(streams.sinks) > 0 {
+		client = logsink.Fanout(client, streams.sinks...)
+	}
+	// the lines are classified before they are prefixed with their offset.
+	client = newOffsetClient(client, env.LiveLog.Offsets, env.LiveLog.Timestamps)
+	client = newLevelClient(client, env.LiveLog.ErrorPatterns, env.LiveLog.WarnPatterns)
+	if env.LiveLog.Stdout {
+		client = newStdoutClient(client, correlationID, env.LiveLog.StdoutRateLimit)
+	}
+	limit, interval, maxLineLength := logLimits(env, limits)
+	// the lines are redacted before they are published to the log hub.
+	redactor := newRedactClient(Logs().Client(client), streams.redact)
+	wc := lelivelog.New(redactor, logKey, correlationID, nil, false)
+	if limit > 0 {
+		wc.SetLimit(limit)
+	}
+	if interval > 0 {
+		wc.SetInterval(time.Duration(interval) * time.Millisecond)
+	}
 	go func() {
 		if err := wc.Open(); err != nil {
 			logrus.WithError(err).Debugln("failed to open log stream")
 		}
 	}()
+	if env.LiveLog.StripANSI || maxLineLength > 0 {
+		return newCleanWriter(wc, env.LiveLog.StripANSI, maxLineLength)
+	}
 	return wc
 }
 
+// logLimits returns the log limits of the runner configuration, lowered by
+// the limits of the pipeline. A pipeline cannot raise the limits configured
+// on the runner, only the limits the runner does not set.
+func logLimits(env *config.EnvConfig, limits *LogLimits) (limit, interval, maxLineLength int) {
+	limit, interval, maxLineLength = env.LiveLog.Limit, env.LiveLog.IntervalMilliSecs, env.LiveLog.MaxLineLength
+	if limits == nil {
+		return limit, interval, maxLineLength
+	}
+	if limits.Limit > 0 && (limit <= 0 || limits.Limit < limit) {
+		limit = limits.Limit
+	}
+	if limits.IntervalMilliSecs > 0 {
+		interval = limits.IntervalMilliSecs
+	}
+	if limits.MaxLineLength > 0 && (maxLineLength <= 0 || limits.MaxLineLength < maxLineLength) {
+		maxLineLength = limits.MaxLineLength
+	}
+	return limit, interval, maxLineLength
+}
+
 // generate a id from the filename
 // /path/to/a.txt and /other/path/to/a.txt should generate different hashes
 // eg - a-txt10098 and a-txt-270089
@@ -0,0 +1,35 @@
+package harness
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+func TestLogLimits(t *testing.T) {
+	env := &config.EnvConfig{}
+	env.LiveLog.Limit = 1000
+	env.LiveLog.IntervalMilliSecs = 1000
+
+	tests := []struct {
+		limits                         *LogLimits
+		limit, interval, maxLineLength int
+	}{
+		{limits: nil, limit: 1000, interval: 1000},
+		{limits: &LogLimits{Limit: 500, IntervalMilliSecs: 2000}, limit: 500, interval: 2000},
+		{limits: &LogLimits{Limit: 5000}, limit: 1000, interval: 1000},
+		{limits: &LogLimits{MaxLineLength: 100}, limit: 1000, interval: 1000, maxLineLength: 100},
+	}
+	for _, test := range tests {
+		limit, interval, maxLineLength := logLimits(env, test.limits)
+		if limit != test.limit || interval != test.interval || maxLineLength != test.maxLineLength {
+			t.Errorf("Want limits %d %d %d for %+v, got %d %d %d", test.limit, test.interval, test.maxLineLength,
+				test.limits, limit, interval, maxLineLength)
+		}
+	}
+
+	env.LiveLog.MaxLineLength = 200
+	if _, _, maxLineLength := logLimits(env, &LogLimits{MaxLineLength: 500}); maxLineLength != 200 {
+		t.Errorf("Want the maximum line length of the runner, got %d", maxLineLength)
+	}
+}
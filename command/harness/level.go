@@ -0,0 +1,91 @@
+package harness
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/harness/lite-engine/logstream"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	levelError = "error"
+	levelWarn  = "warn"
+)
+
+// default patterns match the logrus fields of the runner log entries and
+// the usual prefixes of compiler, package manager and shell errors.
+var (
+	defaultErrorPatterns = []string{
+		`\blevel=(error|fatal|panic)\b`,
+		`(?i)^\s*(error|fatal|panic|failed)\b\s*[:!]`,
+		`(?i)^\s*E\d{4}\b`,
+	}
+	defaultWarnPatterns = []string{
+		`\blevel=warn(ing)?\b`,
+		`(?i)^\s*warn(ing)?\b\s*[:!]`,
+	}
+)
+
+// levelClient is a logstream.Client which sets the level of every line
+// that matches an error or warning pattern, so the log viewer can
+// highlight failures. Other lines keep the level set by the log writer.
+type levelClient struct {
+	logstream.Client
+
+	errors []*regexp.Regexp
+	warns  []*regexp.Regexp
+}
+
+func newLevelClient(client logstream.Client, errorPatterns, warnPatterns []string) logstream.Client {
+	if len(errorPatterns) == 0 {
+		errorPatterns = defaultErrorPatterns
+	}
+	if len(warnPatterns) == 0 {
+		warnPatterns = defaultWarnPatterns
+	}
+	return &levelClient{
+		Client: client,
+		errors: compilePatterns(errorPatterns),
+		warns:  compilePatterns(warnPatterns),
+	}
+}
+
+func (c *levelClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	for _, line := range lines {
+		if level := c.classify(line.Message); level != "" {
+			line.Level = level
+		}
+	}
+	return c.Client.Write(ctx, key, lines)
+}
+
+// classify returns the level of the message, or an empty string if the
+// message matches no pattern.
+func (c *levelClient) classify(msg string) string {
+	for _, re := range c.errors {
+		if re.MatchString(msg) {
+			return levelError
+		}
+	}
+	for _, re := range c.warns {
+		if re.MatchString(msg) {
+			return levelWarn
+		}
+	}
+	return ""
+}
+
+// compilePatterns compiles the patterns, skipping and logging the invalid ones.
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			logrus.WithError(err).WithField("pattern", p).Warnln("ignoring invalid log level pattern")
+			continue
+		}
+		res = append(res, re)
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package harness
+
+import (
+	"context"
+	"testing"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+func TestLevelClient(t *testing.T) {
+	tests := []struct {
+		msg   string
+		level string
+	}{
+		{msg: "Requesting a VM from pool linux", level: "info"},
+		{msg: `time="2022-11-03T10:00:00Z" level=error msg="could not setup instance"`, level: levelError},
+		{msg: `time="2022-11-03T10:00:00Z" level=warning msg="retrying"`, level: levelWarn},
+		{msg: "error: pathspec 'main' did not match any file(s) known to git", level: levelError},
+		{msg: "npm WARN deprecated", level: "info"},
+		{msg: "Warning: apt does not have a stable CLI interface.", level: levelWarn},
+		{msg: "FATAL: no such host", level: levelError},
+		{msg: "0 errors, 0 warnings", level: "info"},
+	}
+	upstream := &fakeLogClient{}
+	client := newLevelClient(upstream, nil, nil)
+	for _, test := range tests {
+		line := &logstream.Line{Level: "info", Message: test.msg}
+		if err := client.Write(context.Background(), "key", []*logstream.Line{line}); err != nil {
+			t.Fatal(err)
+		}
+		if line.Level != test.level {
+			t.Errorf("Want level %q for %q, got %q", test.level, test.msg, line.Level)
+		}
+	}
+}
+
+func TestLevelClient_CustomPatterns(t *testing.T) {
+	client := newLevelClient(&fakeLogClient{}, []string{`\bBUILD FAILED\b`, `(`}, []string{`^npm WARN`})
+	line := &logstream.Line{Level: "info", Message: "npm WARN deprecated"}
+	if err := client.Write(context.Background(), "key", []*logstream.Line{line}); err != nil {
+		t.Fatal(err)
+	}
+	if line.Level != levelWarn {
+		t.Errorf("Want level %q, got %q", levelWarn, line.Level)
+	}
+	if got := client.(*levelClient).classify("error: not a custom pattern"); got != "" {
+		t.Errorf("Want the default patterns replaced, got level %q", got)
+	}
+}
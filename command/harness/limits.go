@@ -0,0 +1,163 @@
+package harness
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/httprender"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTimeout is how long a per caller rate limiter is kept after its last request.
+const limiterIdleTimeout = 10 * time.Minute
+
+// MaxBodySize returns a middleware which rejects request bodies larger than n bytes.
+func MaxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				httprender.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit returns a middleware which limits every caller to rps requests per
+// second with the given burst. Callers are identified by their bearer token, by
+// the account of the request, or by their remote address without either. The
+// tokens are not validated by the delegate, the delegate is expected to be
+// served behind a proxy validating them.
+func RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rps <= 0 {
+			return next
+		}
+		l := &callerLimiter{rps: rate.Limit(rps), burst: burst, callers: map[string]*callerRate{}}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.allow(callerKey(r)) {
+				w.Header().Set("Retry-After", "1")
+				httprender.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConcurrencyLimit returns a middleware which allows at most n requests to be
+// processed at the same time. Requests over the limit are not queued, they are
+// rejected immediately with 429 Too Many Requests and a Retry-After header.
+func ConcurrencyLimit(n int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		sem := make(chan struct{}, n)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "5")
+				httprender.Error(w, "too many concurrent requests", http.StatusTooManyRequests)
+			}
+		})
+	}
+}
+
+type callerRate struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+type callerLimiter struct {
+	mu      sync.Mutex
+	rps     rate.Limit
+	burst   int
+	callers map[string]*callerRate
+	swept   time.Time
+}
+
+func (l *callerLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	// drop the limiters of callers which went away
+	if now.Sub(l.swept) > limiterIdleTimeout {
+		for k, c := range l.callers {
+			if now.Sub(c.seen) > limiterIdleTimeout {
+				delete(l.callers, k)
+			}
+		}
+		l.swept = now
+	}
+
+	c, ok := l.callers[key]
+	if !ok {
+		c = &callerRate{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.callers[key] = c
+	}
+	c.seen = now
+	return c.limiter.Allow()
+}
+
+// callerKey identifies the caller of the request by its bearer token, by the
+// account of the request body, or by its remote address.
+func callerKey(r *http.Request) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != r.Header.Get("Authorization") && token != "" {
+		// the digest of the token is kept, not the token.
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:])
+	}
+	if account := requestAccount(r); account != "" {
+		return "account:" + account
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "addr:" + r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// requestAccount returns the account id of the context of the request body,
+// the body is restored for the handler.
+func requestAccount(r *http.Request) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	raw, err := io.ReadAll(r.Body)
+	// the handler reads the error of a body too large again.
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(raw), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	in := struct {
+		Context struct {
+			AccountID string `json:"account_id"`
+		} `json:"context"`
+	}{}
+	if json.Unmarshal(raw, &in) != nil {
+		return ""
+	}
+	return in.Context.AccountID
+}
@@ -0,0 +1,98 @@
+package harness
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	var bodies []string
+	h := RateLimit(1, 2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+
+	// callers are limited by token, then by account, then by address.
+	callers := []struct {
+		addr, token, body string
+		code              int
+	}{
+		{addr: "10.0.0.1:1234", token: "a", code: http.StatusOK},
+		{addr: "10.0.0.2:1234", token: "a", code: http.StatusOK},
+		{addr: "10.0.0.3:1234", token: "a", code: http.StatusTooManyRequests},
+		{addr: "10.0.0.1:1235", token: "b", code: http.StatusOK},
+		{addr: "10.0.0.1:1236", body: `{"context":{"account_id":"acct"}}`, code: http.StatusOK},
+		{addr: "10.0.0.2:1236", body: `{"context":{"account_id":"acct"}}`, code: http.StatusOK},
+		{addr: "10.0.0.3:1236", body: `{"context":{"account_id":"acct"}}`, code: http.StatusTooManyRequests},
+		{addr: "10.0.0.4:1234", code: http.StatusOK},
+		{addr: "10.0.0.4:1235", body: `{}`, code: http.StatusOK},
+		{addr: "10.0.0.4:1236", body: `not json`, code: http.StatusTooManyRequests},
+	}
+	for i, caller := range callers {
+		r := httptest.NewRequest(http.MethodPost, "/setup", strings.NewReader(caller.body))
+		r.RemoteAddr = caller.addr
+		if caller.token != "" {
+			r.Header.Set("Authorization", "Bearer "+caller.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != caller.code {
+			t.Errorf("Want status %d for request %d, got %d", caller.code, i, w.Code)
+		}
+	}
+	// the bodies read to find the account are restored for the handler.
+	if len(bodies) != 7 || bodies[4] != `{"context":{"account_id":"acct"}}` {
+		t.Errorf("Want the request bodies passed to the handler, got %q", bodies)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h := MaxBodySize(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{body: "abc", code: http.StatusOK},
+		{body: "abcdef", code: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/setup", strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Want status %d for body %q, got %d", test.code, test.body, w.Code)
+		}
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := ConcurrencyLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/setup", http.NoBody))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/setup", http.NoBody))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Want status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,134 @@
+package harness
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+// subscriberBuffer is the number of lines buffered for a single
+// subscriber. Lines are dropped for subscribers that fall behind so
+// that a slow reader never blocks the upstream log stream.
+const subscriberBuffer = 1000
+
+// LogHub fans out log lines written by the runner to local subscribers,
+// e.g. clients tailing the delegate /logs/{key}/stream endpoint.
+type LogHub struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan *logstream.Line]struct{}
+	active map[string]struct{}
+}
+
+var logHub = &LogHub{
+	subs:   map[string]map[chan *logstream.Line]struct{}{},
+	active: map[string]struct{}{},
+}
+
+// Logs returns the process wide log hub.
+func Logs() *LogHub {
+	return logHub
+}
+
+// Subscribe registers a subscriber for the log key. The returned channel
+// is closed when the log stream is closed or the cancel function is called.
+func (h *LogHub) Subscribe(key string) (lines <-chan *logstream.Line, cancel func()) {
+	ch := make(chan *logstream.Line, subscriberBuffer)
+	h.mu.Lock()
+	if h.subs[key] == nil {
+		h.subs[key] = map[chan *logstream.Line]struct{}{}
+	}
+	h.subs[key][ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() { h.unsubscribe(key, ch) }
+}
+
+func (h *LogHub) unsubscribe(key string, ch chan *logstream.Line) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[key][ch]; !ok {
+		return
+	}
+	delete(h.subs[key], ch)
+	if len(h.subs[key]) == 0 {
+		delete(h.subs, key)
+	}
+	close(ch)
+}
+
+// Subscribers returns the number of subscribers of the log key.
+func (h *LogHub) Subscribers(key string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[key])
+}
+
+// Active returns the sorted keys of the log streams which are currently open.
+func (h *LogHub) Active() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.active))
+	for key := range h.active {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *LogHub) open(key string) {
+	h.mu.Lock()
+	h.active[key] = struct{}{}
+	h.mu.Unlock()
+}
+
+func (h *LogHub) publish(key string, lines []*logstream.Line) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[key] {
+		for _, line := range lines {
+			select {
+			case ch <- line:
+			default:
+			}
+		}
+	}
+}
+
+func (h *LogHub) close(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[key] {
+		close(ch)
+	}
+	delete(h.subs, key)
+	delete(h.active, key)
+}
+
+// Client returns a logstream.Client which writes to client and publishes
+// the written lines to the hub.
+func (h *LogHub) Client(client logstream.Client) logstream.Client {
+	return &hubClient{Client: client, hub: h}
+}
+
+// hubClient is a logstream.Client which forwards all calls to the
+// underlying client and publishes the written lines to the hub.
+type hubClient struct {
+	logstream.Client
+	hub *LogHub
+}
+
+func (c *hubClient) Open(ctx context.Context, key string) error {
+	c.hub.open(key)
+	return c.Client.Open(ctx, key)
+}
+
+func (c *hubClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	c.hub.publish(key, lines)
+	return c.Client.Write(ctx, key, lines)
+}
+
+func (c *hubClient) Close(ctx context.Context, key string) error {
+	c.hub.close(key)
+	return c.Client.Close(ctx, key)
+}
@@ -0,0 +1,102 @@
+package harness
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+func newTestHub() *LogHub {
+	return &LogHub{
+		subs:   map[string]map[chan *logstream.Line]struct{}{},
+		active: map[string]struct{}{},
+	}
+}
+
+func TestLogHub_Publish(t *testing.T) {
+	hub := newTestHub()
+	first, cancelFirst := hub.Subscribe("key")
+	defer cancelFirst()
+	second, cancelSecond := hub.Subscribe("key")
+	defer cancelSecond()
+	other, cancelOther := hub.Subscribe("other")
+	defer cancelOther()
+
+	hub.publish("key", []*logstream.Line{{Message: "hello"}, {Message: "world"}})
+
+	for _, lines := range []<-chan *logstream.Line{first, second} {
+		for _, want := range []string{"hello", "world"} {
+			if got := (<-lines).Message; got != want {
+				t.Errorf("Want line %q, got %q", want, got)
+			}
+		}
+	}
+	if len(other) != 0 {
+		t.Errorf("Want no line published to another key, got %d", len(other))
+	}
+}
+
+func TestLogHub_PublishFull(t *testing.T) {
+	hub := newTestHub()
+	lines, cancel := hub.Subscribe("key")
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		hub.publish("key", []*logstream.Line{{Number: i}})
+	}
+	if got := len(lines); got != subscriberBuffer {
+		t.Errorf("Want %d lines buffered, got %d", subscriberBuffer, got)
+	}
+}
+
+func TestLogHub_Unsubscribe(t *testing.T) {
+	hub := newTestHub()
+	lines, cancel := hub.Subscribe("key")
+	cancel()
+
+	if _, open := <-lines; open {
+		t.Errorf("Want the channel closed once unsubscribed")
+	}
+	if hub.Subscribers("key") != 0 {
+		t.Errorf("Want the key removed with its last subscriber")
+	}
+	// canceling twice or publishing without subscribers is a no-op.
+	cancel()
+	hub.publish("key", []*logstream.Line{{Message: "hello"}})
+}
+
+func TestLogHub_Close(t *testing.T) {
+	hub := newTestHub()
+	client := hub.Client(&fakeLogClient{})
+	ctx := context.Background()
+	if err := client.Open(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Open(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hub.Active(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want active keys %v, got %v", want, got)
+	}
+
+	lines, cancel := hub.Subscribe("b")
+	if err := client.Write(ctx, "b", []*logstream.Line{{Message: "hello"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := (<-lines).Message; got != "hello" {
+		t.Errorf("Want the buffered line read after the close, got %q", got)
+	}
+	if _, open := <-lines; open {
+		t.Errorf("Want the channel closed with the log stream")
+	}
+	if got, want := hub.Active(), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want active keys %v, got %v", want, got)
+	}
+	// the subscriber cancels once the stream is closed.
+	cancel()
+}
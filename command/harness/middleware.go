@@ -2,9 +2,11 @@ package harness
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sirupsen/logrus"
 )
@@ -28,6 +30,15 @@ func Middleware(next http.Handler) http.Handler {
 		if strings.Contains(r.URL.RequestURI(), "healthz") {
 			return
 		}
+		audit.Record(r.Context(), &audit.Event{
+			Action: audit.ActionAPICall,
+			Details: map[string]string{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"caller": r.RemoteAddr,
+				"status": strconv.Itoa(status),
+			},
+		})
 		if status >= http.StatusInternalServerError {
 			logr.Errorln(logLine)
 		} else {
@@ -0,0 +1,65 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+// offsetClient is a logstream.Client which prefixes the message of every
+// line with its offset from the start of the stream, and optionally with
+// its time, so that the log viewer shows where the time went. The elapsed
+// time of the lines is set from the same start.
+type offsetClient struct {
+	logstream.Client
+
+	started    time.Time
+	offsets    bool
+	timestamps bool
+}
+
+func newOffsetClient(client logstream.Client, offsets, timestamps bool) logstream.Client {
+	if !offsets && !timestamps {
+		return client
+	}
+	return &offsetClient{Client: client, started: time.Now(), offsets: offsets, timestamps: timestamps}
+}
+
+func (c *offsetClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	for _, line := range lines {
+		at := line.Timestamp
+		if at.IsZero() {
+			at = time.Now()
+		}
+		offset := at.Sub(c.started)
+		if offset < 0 {
+			offset = 0
+		}
+		line.ElaspedTime = int64(offset.Seconds())
+		line.Message = c.prefix(at, offset) + line.Message
+	}
+	return c.Client.Write(ctx, key, lines)
+}
+
+func (c *offsetClient) prefix(at time.Time, offset time.Duration) string {
+	switch {
+	case c.offsets && c.timestamps:
+		return fmt.Sprintf("[%s %s] ", at.UTC().Format(time.RFC3339), formatOffset(offset))
+	case c.timestamps:
+		return fmt.Sprintf("[%s] ", at.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("[%s] ", formatOffset(offset))
+}
+
+// formatOffset formats the offset as minutes, seconds and milliseconds,
+// e.g. +02:05.120, with the hours if it is an hour or more.
+func formatOffset(offset time.Duration) string {
+	ms := offset.Milliseconds()
+	h, m, s := ms/3600000, ms/60000%60, ms/1000%60
+	if h > 0 {
+		return fmt.Sprintf("+%d:%02d:%02d.%03d", h, m, s, ms%1000)
+	}
+	return fmt.Sprintf("+%02d:%02d.%03d", m, s, ms%1000)
+}
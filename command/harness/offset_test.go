@@ -0,0 +1,45 @@
+package harness
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+func TestOffsetClient(t *testing.T) {
+	started := time.Date(2022, 11, 3, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		offsets, timestamps bool
+		at                  time.Duration
+		want                string
+		elapsed             int64
+	}{
+		{offsets: true, at: 2*time.Minute + 5120*time.Millisecond, want: "[+02:05.120] make", elapsed: 125},
+		{offsets: true, at: time.Hour + 3*time.Second, want: "[+1:00:03.000] make", elapsed: 3603},
+		{timestamps: true, at: 3 * time.Second, want: "[2022-11-03T10:00:03Z] make", elapsed: 3},
+		{offsets: true, timestamps: true, at: 3 * time.Second, want: "[2022-11-03T10:00:03Z +00:03.000] make", elapsed: 3},
+	}
+	for _, test := range tests {
+		client := newOffsetClient(&fakeLogClient{}, test.offsets, test.timestamps)
+		client.(*offsetClient).started = started
+		line := &logstream.Line{Message: "make", Timestamp: started.Add(test.at)}
+		if err := client.Write(context.Background(), "key", []*logstream.Line{line}); err != nil {
+			t.Fatal(err)
+		}
+		if line.Message != test.want {
+			t.Errorf("Want message %q, got %q", test.want, line.Message)
+		}
+		if line.ElaspedTime != test.elapsed {
+			t.Errorf("Want elapsed time %d, got %d", test.elapsed, line.ElaspedTime)
+		}
+	}
+}
+
+func TestOffsetClient_Disabled(t *testing.T) {
+	upstream := &fakeLogClient{}
+	if client := newOffsetClient(upstream, false, false); client != upstream {
+		t.Errorf("Want the client as is")
+	}
+}
@@ -52,6 +52,34 @@ func SetupPool(ctx context.Context, env *config.EnvConfig, poolManager drivers.I
 			Errorln("failed to start instance purger")
 		return configPool, err
 	}
+	if env.Settings.SetupTimeoutMins > 0 {
+		setupTimeout := time.Minute * time.Duration(env.Settings.SetupTimeoutMins)
+		err = poolManager.StartInstanceReconciler(ctx, setupTimeout)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("failed to start instance reconciler")
+			return configPool, err
+		}
+	}
+	if env.Settings.SSHKeyDir != "" {
+		rotation := time.Minute * time.Duration(env.Settings.SSHKeyRotationMins)
+		err = poolManager.StartSSHKeyRotation(ctx, env.Settings.SSHKeyDir, env.Settings.SSHKeyUser, rotation)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("failed to start ssh key rotation")
+			return configPool, err
+		}
+	}
+	if env.Settings.DiskGCMins > 0 {
+		interval := time.Minute * time.Duration(env.Settings.DiskGCMins)
+		pruneAge := time.Hour * time.Duration(env.Settings.DiskGCPruneAgeHours)
+		err = poolManager.StartDiskGC(ctx, interval, env.Settings.DiskGCThreshold, pruneAge)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("failed to start disk gc")
+			return configPool, err
+		}
+	}
 	// lets remove any old instances.
 	if !env.Settings.ReusePool {
 		cleanErr := poolManager.CleanPools(ctx, true, true)
@@ -0,0 +1,130 @@
+package harness
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/audit"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	running     *runningStages
+	runningOnce sync.Once
+)
+
+// runningStages tracks the stages running on an instance of a pool, so
+// that an urgent stage waiting for a saturated pool can preempt one of a
+// lower priority. Stages are kept in memory, runners do not share them.
+type runningStages struct {
+	mu        sync.Mutex
+	stages    map[string]*runningStage
+	preempted map[string]string // preempted stage runtime ID to the stage that preempted it
+}
+
+type runningStage struct {
+	stage    string
+	pool     string
+	owner    string
+	instance string
+	priority int
+	started  time.Time
+}
+
+func runningStagesOf() *runningStages {
+	runningOnce.Do(func() {
+		running = &runningStages{
+			stages:    map[string]*runningStage{},
+			preempted: map[string]string{},
+		}
+	})
+	return running
+}
+
+// add records a stage running on an instance of the pool.
+func (r *runningStages) add(s *runningStage) {
+	r.mu.Lock()
+	r.stages[s.stage] = s
+	r.mu.Unlock()
+}
+
+// remove forgets a destroyed stage.
+func (r *runningStages) remove(stage string) {
+	r.mu.Lock()
+	delete(r.stages, stage)
+	delete(r.preempted, stage)
+	r.mu.Unlock()
+}
+
+// preemptedBy returns the stage that preempted the stage, if it was
+// preempted.
+func (r *runningStages) preemptedBy(stage string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	by, ok := r.preempted[stage]
+	return by, ok
+}
+
+// victim picks the stage of the pool to preempt for a stage of the
+// priority and marks it as preempted: the stage of the lowest priority
+// below it, the most recently started one if several, as it lost the
+// least work. It returns nil if no stage has a lower priority.
+func (r *runningStages) victim(pool, stage string, priority int) *runningStage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var victim *runningStage
+	for _, s := range r.stages {
+		if s.pool != pool || s.priority >= priority {
+			continue
+		}
+		if victim == nil || s.priority < victim.priority ||
+			(s.priority == victim.priority && s.started.After(victim.started)) {
+			victim = s
+		}
+	}
+	if victim != nil {
+		delete(r.stages, victim.stage)
+		r.preempted[victim.stage] = stage
+	}
+	return victim
+}
+
+// preempt destroys the instance of a running stage of the pool with a
+// lower priority than the urgent stage, so that the urgent stage gets the
+// next instance of the pool. The preempted stage fails its next step and
+// is to be retried by its pipeline.
+func preempt(ctx context.Context, logr *logrus.Entry, poolManager drivers.IManager, pool, stage string, priority int) {
+	victim := runningStagesOf().victim(pool, stage, priority)
+	if victim == nil {
+		logr.WithField("pool_id", pool).Infoln("no running stage of a lower priority to preempt")
+		return
+	}
+	logr = logr.WithField("pool_id", pool).
+		WithField("preempted_stage_runtime_id", victim.stage).
+		WithField("preempted_priority", victim.priority).
+		WithField("preempted_instance_id", victim.instance)
+	logr.Warnln("preempting a running stage of a lower priority for an urgent stage")
+
+	audit.Record(ctx, &audit.Event{
+		Action:   audit.ActionStagePreempt,
+		Pool:     pool,
+		Instance: victim.instance,
+		Stage:    victim.stage,
+		Owner:    victim.owner,
+		Details: map[string]string{
+			"preempted_by": stage,
+			"priority":     strconv.Itoa(victim.priority),
+		},
+	})
+
+	if err := poolManager.Destroy(context.Background(), pool, victim.instance); err != nil {
+		logr.WithError(err).Errorln("failed to destroy the instance of the preempted stage")
+		return
+	}
+	fairQueueOf().notify(pool)
+	logr.Infoln("destroyed the instance of the preempted stage")
+}
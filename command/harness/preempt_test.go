@@ -0,0 +1,57 @@
+package harness
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_runningStages_victim(t *testing.T) {
+	now := time.Now()
+	stages := []*runningStage{
+		{stage: "old-low", pool: "linux", priority: 0, started: now.Add(-time.Hour)},
+		{stage: "new-low", pool: "linux", priority: 0, started: now},
+		{stage: "mid", pool: "linux", priority: 5, started: now},
+		{stage: "other-pool", pool: "windows", priority: -1, started: now},
+	}
+
+	tests := []struct {
+		name     string
+		priority int
+		want     []string
+	}{
+		{name: "no lower priority", priority: 0, want: []string{""}},
+		{name: "most recent of the lowest priority first", priority: 10, want: []string{"new-low", "old-low", "mid", ""}},
+		{name: "only lower priorities", priority: 5, want: []string{"new-low", "old-low", ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &runningStages{stages: map[string]*runningStage{}, preempted: map[string]string{}}
+			for _, s := range stages {
+				r.add(s)
+			}
+			for _, want := range test.want {
+				got := ""
+				if v := r.victim("linux", "urgent", test.priority); v != nil {
+					got = v.stage
+				}
+				if got != want {
+					t.Fatalf("want victim %q, got %q", want, got)
+				}
+				if want == "" {
+					continue
+				}
+				if by, ok := r.preemptedBy(want); !ok || by != "urgent" {
+					t.Errorf("want %s preempted by urgent, got %q", want, by)
+				}
+			}
+		})
+	}
+
+	r := &runningStages{stages: map[string]*runningStage{}, preempted: map[string]string{}}
+	r.add(stages[0])
+	r.victim("linux", "urgent", 1)
+	r.remove("old-low")
+	if _, ok := r.preemptedBy("old-low"); ok {
+		t.Errorf("want a destroyed stage forgotten")
+	}
+}
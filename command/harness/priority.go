@@ -0,0 +1,19 @@
+package harness
+
+import (
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+// stagePriority returns the priority requested by a stage of the account,
+// lowered to the cap of the account, or to the highest priority if the
+// account has no cap.
+func stagePriority(env *config.EnvConfig, account string, requested int) int {
+	limit := env.Settings.MaxPriority
+	if c, ok := env.Settings.PriorityCaps[account]; ok {
+		limit = c
+	}
+	if requested > limit {
+		return limit
+	}
+	return requested
+}
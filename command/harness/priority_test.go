@@ -0,0 +1,31 @@
+package harness
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+func Test_stagePriority(t *testing.T) {
+	env := &config.EnvConfig{}
+	env.Settings.MaxPriority = 2
+	env.Settings.PriorityCaps = map[string]int{"trusted": 10, "restricted": 0}
+
+	tests := []struct {
+		account   string
+		requested int
+		want      int
+	}{
+		{account: "other", requested: 1, want: 1},
+		{account: "other", requested: 5, want: 2},
+		{account: "other", requested: -3, want: -3},
+		{account: "trusted", requested: 5, want: 5},
+		{account: "trusted", requested: 50, want: 10},
+		{account: "restricted", requested: 5, want: 0},
+	}
+	for _, test := range tests {
+		if got := stagePriority(env, test.account, test.requested); got != test.want {
+			t.Errorf("want priority %d for %d requested by %s, got %d", test.want, test.requested, test.account, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+const redacted = "********"
+
+// defaultRedactPatterns match the AWS access key ids, the values of the
+// AWS secret keys and session tokens, and the JSON web tokens.
+var defaultRedactPatterns = []string{
+	`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`,
+	`(?i)\baws_?(?:secret_?access_?key|session_?token)["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{16,})`,
+	`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+}
+
+// redactClient is a logstream.Client which redacts the text of the lines
+// matching the redaction patterns before they are streamed, published to
+// the log hub or uploaded. The groups of a pattern with groups are
+// redacted, e.g. the value of a key, the whole match otherwise. This is
+// defense in depth, the secrets of the steps are masked by lite-engine.
+type redactClient struct {
+	logstream.Client
+
+	patterns []*regexp.Regexp
+}
+
+// compileRedactPatterns compiles the redaction patterns, with the default
+// patterns first if enabled.
+func compileRedactPatterns(defaults bool, patterns []string) ([]*regexp.Regexp, error) {
+	if defaults {
+		patterns = append(append([]string{}, defaultRedactPatterns...), patterns...)
+	}
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log redaction pattern %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func newRedactClient(client logstream.Client, patterns []*regexp.Regexp) logstream.Client {
+	if len(patterns) == 0 {
+		return client
+	}
+	return &redactClient{Client: client, patterns: patterns}
+}
+
+func (c *redactClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	c.redactLines(lines)
+	return c.Client.Write(ctx, key, lines)
+}
+
+func (c *redactClient) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
+	c.redactLines(lines)
+	return c.Client.Upload(ctx, key, lines)
+}
+
+func (c *redactClient) redactLines(lines []*logstream.Line) {
+	for _, line := range lines {
+		line.Message = c.redact(line.Message)
+	}
+}
+
+// redact returns the message with the matches of the patterns redacted.
+func (c *redactClient) redact(msg string) string {
+	for _, re := range c.patterns {
+		matches := re.FindAllStringSubmatchIndex(msg, -1)
+		if matches == nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			// the groups of the pattern, or the match.
+			spans := m[2:]
+			if len(spans) == 0 {
+				spans = m[:2]
+			}
+			for i := 0; i < len(spans); i += 2 {
+				start, end := spans[i], spans[i+1]
+				if start < last {
+					continue // the group did not participate, or overlaps the previous one.
+				}
+				b.WriteString(msg[last:start])
+				b.WriteString(redacted)
+				last = end
+			}
+		}
+		b.WriteString(msg[last:])
+		msg = b.String()
+	}
+	return msg
+}
@@ -12,36 +12,30 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 	"github.com/drone-runners/drone-runner-aws/metric"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
+	"github.com/drone-runners/drone-runner-aws/internal/diagnostics"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	errors "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/types"
-	"github.com/harness/lite-engine/api"
+	dlogger "github.com/drone/runner-go/logger"
+	lehttp "github.com/harness/lite-engine/cli/client"
 	lespec "github.com/harness/lite-engine/engine/spec"
 	"github.com/harness/lite-engine/logger"
 
 	"github.com/sirupsen/logrus"
 )
 
-type SetupVMRequest struct {
-	ID               string            `json:"id"` // stage runtime ID
-	PoolID           string            `json:"pool_id"`
-	FallbackPoolIDs  []string          `json:"fallback_pool_ids"`
-	Tags             map[string]string `json:"tags"`
-	CorrelationID    string            `json:"correlation_id"`
-	LogKey           string            `json:"log_key"`
-	Context          Context           `json:"context,omitempty"`
-	ResourceClass    string            `json:"resource_class"`
-	api.SetupRequest `json:"setup_request"`
-}
-
-type SetupVMResponse struct {
-	IPAddress  string `json:"ip_address"`
-	InstanceID string `json:"instance_id"`
-}
+type (
+	SetupVMRequest  = vmapi.SetupVMRequest
+	SetupVMResponse = vmapi.SetupVMResponse
+	LogLimits       = vmapi.LogLimits
+)
 
 var (
 	healthCheckTimeout = 5 * time.Minute
@@ -66,17 +60,23 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 	// Sets up logger to stream the logs in case log config is set
 	log := logrus.New()
 	var logr *logrus.Entry
+	progress := func(string, ...interface{}) {}
 	if r.SetupRequest.LogConfig.URL == "" {
 		log.Out = os.Stdout
 		logr = log.WithField("api", "dlite:setup").WithField("correlationID", r.CorrelationID)
 	} else {
-		wc := getStreamLogger(r.SetupRequest.LogConfig, r.LogKey, r.CorrelationID)
+		wc := getStreamLogger(env, r.SetupRequest.LogConfig, r.LogLimits, r.LogKey, r.CorrelationID)
 		defer func() {
 			if err := wc.Close(); err != nil {
 				log.WithError(err).Debugln("failed to close log stream")
 			}
 		}()
 
+		// human readable progress lines, so users see what is happening while the vm is provisioned.
+		progress = func(format string, args ...interface{}) {
+			fmt.Fprintf(wc, format+"\n", args...)
+		}
+
 		log.Out = wc
 		log.SetLevel(logrus.TraceLevel)
 		logr = log.WithField("stage_runtime_id", stageRuntimeID)
@@ -124,6 +124,26 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 		owner = GetAccountID(&r.Context, r.Tags)
 	}
 
+	// stages of a concurrency group wait before an instance is provisioned,
+	// the group is released when the stage is destroyed or its setup fails.
+	if c := r.Concurrency; c != nil && c.Group != "" {
+		maxHold := time.Hour * time.Duration(env.Settings.BusyMaxAge)
+		err := concurrency().acquire(ctx, owner+"/"+c.Group, stageRuntimeID, c.Supersede, maxHold, func() {
+			logr.WithField("concurrency_group", c.Group).Infoln("waiting for the running stage of the concurrency group")
+			progress("Waiting for the running stage of concurrency group %s", c.Group)
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("concurrency group %s: %w", c.Group, err)
+		}
+		st = time.Now()
+	}
+	setupDone := false
+	defer func() {
+		if !setupDone {
+			concurrency().release(stageRuntimeID)
+		}
+	}()
+
 	// try to provision an instance with fallbacks
 	for idx, p := range pools {
 		if idx > 0 {
@@ -131,9 +151,24 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 		}
 		pool := fetchPool(r.SetupRequest.LogConfig.AccountID, p, env.Dlite.PoolMapByAccount)
 		logr.WithField("pool_id", pool).Traceln("starting the setup process")
-		instance, poolErr = handleSetup(ctx, logr, r, env, poolManager, pool, owner)
+		if fallback {
+			progress("Falling back to pool %s", pool)
+		}
+		timing := &drivers.ClaimTiming{}
+		instance, poolErr = handleSetup(drivers.WithClaimTiming(ctx, timing), logr, progress, r, env, poolManager, pool, owner)
+		if timing.Total > 0 {
+			_, _, poolDriver := poolManager.Inspect(pool)
+			for phase, d := range timing.Phases() {
+				// zero if the phase was skipped, e.g. no instance was created.
+				if d == 0 {
+					continue
+				}
+				metrics.ClaimDurationCount.WithLabelValues(pool, poolDriver, phase, strconv.FormatBool(poolManager.IsDistributed())).Observe(d.Seconds())
+			}
+		}
 		if poolErr != nil {
 			logr.WithField("pool_id", pool).WithError(poolErr).Errorln("could not setup instance")
+			progress("Could not setup a VM in pool %s: %s", pool, poolErr)
 			continue
 		}
 		selectedPool = pool
@@ -185,6 +220,7 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 		WithField("tried_pools", pools).
 		Traceln("VM setup is complete")
 
+	setupDone = true
 	return resp, selectedPoolDriver, nil
 }
 
@@ -195,6 +231,7 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 func handleSetup(
 	ctx context.Context,
 	logr *logrus.Entry,
+	progress func(format string, args ...interface{}),
 	r *SetupVMRequest,
 	env *config.EnvConfig,
 	poolManager drivers.IManager,
@@ -204,7 +241,18 @@ func handleSetup(
 		return nil, fmt.Errorf("could not find pool: %s", pool)
 	}
 
+	// untrusted pipelines do not run on the platforms without the firewall.
+	platform, _, _ := poolManager.Inspect(pool)
+	blockMetadata, err := lehelper.MustBlockMetadata(platform.OS, poolManager.InspectSettings(pool).Untrusted, r.Untrusted)
+	if err != nil {
+		return nil, fmt.Errorf("cannot run the untrusted stage on pool %s: %w", pool, err)
+	}
+
 	stageRuntimeID := r.ID
+	scope := &audit.Scope{Pool: pool, Stage: stageRuntimeID, Owner: owner}
+	ctx = audit.WithScope(ctx, scope)
+	priority := stagePriority(env, owner, r.Priority)
+	ctx = drivers.WithPriority(ctx, priority)
 
 	// try to provision an instance from the pool manager.
 	var query *types.QueryParams
@@ -213,10 +261,34 @@ func handleSetup(
 			RunnerName: env.Runner.Name,
 		}
 	}
-	instance, err := poolManager.Provision(ctx, pool, env.Runner.Name, poolManager.GetTLSServerName(), owner, r.ResourceClass, env, query)
+	st := time.Now()
+	progress("Requesting a VM from pool %s", pool)
+	provision := func() (*types.Instance, error) {
+		return poolManager.Provision(ctx, pool, env.Runner.Name, poolManager.GetTLSServerName(), owner, r.ResourceClass, env, query)
+	}
+	var instance *types.Instance
+	if env.Settings.CapacityWaitSecs > 0 {
+		key := strings.Join([]string{owner, getOrgID(&r.Context, r.Tags), getProjectID(&r.Context, r.Tags)}, "/")
+		maxWait := time.Second * time.Duration(env.Settings.CapacityWaitSecs)
+		instance, err = fairQueueOf().provision(ctx, pool, key, priority, maxWait, func() {
+			logr.WithField("pool_id", pool).Infoln("pool is at capacity, waiting for an instance")
+			progress("Pool %s is at capacity, waiting for a VM", pool)
+			if env.Settings.PreemptPriority > 0 && priority >= env.Settings.PreemptPriority {
+				progress("Preempting a running stage of a lower priority in pool %s", pool)
+				preempt(ctx, logr, poolManager, pool, stageRuntimeID, priority)
+			}
+		}, provision)
+	} else {
+		instance, err = provision()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to provision instance: %w", err)
 	}
+	if instance.Zone != "" {
+		progress("VM %s (%s) is running in %s", instance.Name, instance.ID, instance.Zone)
+	} else {
+		progress("VM %s (%s) is running", instance.Name, instance.ID)
+	}
 
 	logr = logr.WithField("pool_id", pool).
 		WithField("ip", instance.Address).
@@ -224,13 +296,20 @@ func handleSetup(
 		WithField("instance_name", instance.Name)
 
 	logr.Traceln("successfully provisioned VM in pool")
+	scope.Instance = instance.ID
 
 	instanceID := instance.ID
 	instanceName := instance.Name
 	instanceIP := instance.Address
 
+	// the diagnostics of the instance are collected through lite-engine, once its client is created.
+	var client lehttp.Client
+
 	// cleanUpInstanceFn is a function to terminate the instance if an error occurs later in the handleSetup function
 	cleanUpInstanceFn := func(consoleLogs bool) {
+		if consoleLogs && client != nil {
+			collectDiagnostics(logr, env, client, instance)
+		}
 		if consoleLogs {
 			out, logErr := poolManager.InstanceLogs(context.Background(), pool, instanceID)
 			if logErr != nil {
@@ -253,6 +332,7 @@ func handleSetup(
 	}
 
 	if instance.IsHibernated {
+		progress("Resuming hibernated VM %s", instance.Name)
 		instance, err = poolManager.StartInstance(ctx, pool, instance.ID)
 		if err != nil {
 			go cleanUpInstanceFn(false)
@@ -274,7 +354,7 @@ func handleSetup(
 		return nil, fmt.Errorf("failed to add tags to the instance: %w", err)
 	}
 
-	client, err := lehelper.GetClient(instance, poolManager.GetTLSServerName(), instance.Port,
+	client, err = lehelper.GetClient(instance, poolManager.GetTLSServerName(), instance.Port,
 		env.LiteEngine.EnableMock, env.LiteEngine.MockStepTimeoutSecs)
 	if err != nil {
 		go cleanUpInstanceFn(false)
@@ -283,6 +363,7 @@ func handleSetup(
 
 	// try the healthcheck api on the lite-engine until it responds ok
 	logr.Traceln("running healthcheck and waiting for an ok response")
+	progress("Waiting for the VM at %s to become ready", instance.Address)
 	performDNSLookup := drivers.ShouldPerformDNSLookup(ctx, instance.Platform.OS)
 
 	if _, err = client.RetryHealth(ctx, healthCheckTimeout, performDNSLookup); err != nil {
@@ -298,11 +379,67 @@ func handleSetup(
 		r.SetupRequest.MountDockerSocket = &b
 	}
 
-	_, err = client.Setup(ctx, &r.SetupRequest)
+	progress("VM is ready, setting up the build environment")
+
+	// the request is shared by the pools tried, the envs added are of this pool.
+	settings := poolManager.InspectSettings(pool)
+	setupRequest := r.SetupRequest
+	lehelper.PrepareSetup(&setupRequest, instance.Platform.OS, settings)
+
+	_, err = client.Setup(ctx, &setupRequest)
 	if err != nil {
 		go cleanUpInstanceFn(true)
 		return nil, fmt.Errorf("failed to call setup lite-engine: %w", err)
 	}
 
+	signer, err := lehelper.LoadSigner(env.Runner.ScriptSigningKey)
+	if err != nil {
+		go cleanUpInstanceFn(false)
+		return nil, fmt.Errorf("failed to load the script signing key: %w", err)
+	}
+
+	if err = lehelper.ConfigureHost(ctx, client, instance.Platform.OS, &lehelper.HostConfig{
+		Settings:      settings,
+		Signer:        signer,
+		BlockMetadata: blockMetadata,
+		FIPS:          fips.Enabled(),
+		MaxClockSkew:  time.Duration(env.Runner.MaxClockSkewSecs) * time.Second,
+	}, dlogger.Logrus(logr)); err != nil {
+		go cleanUpInstanceFn(true)
+		return nil, fmt.Errorf("%s pool: %w", pool, err)
+	}
+
+	progress("Build environment is ready (%s)", time.Since(st).Truncate(time.Second))
+
+	runningStagesOf().add(&runningStage{
+		stage:    stageRuntimeID,
+		pool:     pool,
+		owner:    owner,
+		instance: instance.ID,
+		priority: priority,
+		started:  time.Now(),
+	})
 	return instance, nil
 }
+
+// collectDiagnostics archives the diagnostics of an instance whose setup
+// failed, if enabled, before it is destroyed.
+func collectDiagnostics(logr *logrus.Entry, env *config.EnvConfig, client lehttp.Client, instance *types.Instance) {
+	const diagnoseTimeout = 3 * time.Minute
+
+	store, err := diagnostics.Open(env)
+	if err != nil || store == nil {
+		if err != nil {
+			logr.WithError(err).Warnln("failed to open the diagnostics store")
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	defer cancel()
+	location, err := diagnostics.Collect(ctx, store, client, instance)
+	if err != nil {
+		logr.WithError(err).Warnln("failed to collect the diagnostics of the instance")
+		return
+	}
+	logr.WithField("bundle", location).Infoln("collected the diagnostics of the instance")
+}
@@ -0,0 +1,109 @@
+package harness
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/harness/lite-engine/logstream"
+	"github.com/sirupsen/logrus"
+)
+
+// spillClient is a logstream.Client which writes every line to a file on
+// the runner host before streaming it. Lines that could not be streamed
+// because the log service was unreachable are replayed with the next
+// successful write, and the final upload contains every line, including
+// the lines dropped from the in-memory history of the log writer.
+type spillClient struct {
+	logstream.Client
+
+	mu       sync.Mutex
+	file     *os.File
+	enc      *json.Encoder
+	total    int // number of lines in the file
+	streamed int // number of lines streamed successfully
+}
+
+func newSpillClient(client logstream.Client, dir, key string) logstream.Client {
+	file, err := os.CreateTemp(dir, "livelog-*.jsonl")
+	if err != nil {
+		logrus.WithError(err).WithField("key", key).Warnln("could not create log spill file, logs are only buffered in memory")
+		return client
+	}
+	return &spillClient{Client: client, file: file, enc: json.NewEncoder(file)}
+}
+
+func (c *spillClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, line := range lines {
+		if err := c.enc.Encode(line); err != nil {
+			logrus.WithError(err).WithField("key", key).Warnln("could not spill log line")
+			return c.Client.Write(ctx, key, lines)
+		}
+	}
+	c.total += len(lines)
+
+	pending := lines
+	if backlog := c.total - len(lines) - c.streamed; backlog > 0 {
+		spilled, err := c.read(c.streamed, backlog)
+		if err != nil {
+			logrus.WithError(err).WithField("key", key).Warnln("could not read spilled log lines")
+		} else {
+			pending = append(spilled, lines...)
+		}
+	}
+	if err := c.Client.Write(ctx, key, pending); err != nil {
+		return err
+	}
+	c.streamed = c.total
+	return nil
+}
+
+func (c *spillClient) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
+	c.mu.Lock()
+	if c.total > len(lines) {
+		if spilled, err := c.read(0, c.total); err == nil {
+			lines = spilled
+		} else {
+			logrus.WithError(err).WithField("key", key).Warnln("could not read spilled log lines, uploading the buffered lines")
+		}
+	}
+	c.mu.Unlock()
+	return c.Client.Upload(ctx, key, lines)
+}
+
+func (c *spillClient) Close(ctx context.Context, key string) error {
+	c.mu.Lock()
+	c.file.Close()
+	os.Remove(c.file.Name())
+	c.mu.Unlock()
+	return c.Client.Close(ctx, key)
+}
+
+// read returns count lines from the spill file, starting at line offset.
+func (c *spillClient) read(offset, count int) ([]*logstream.Line, error) {
+	file, err := os.Open(c.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := make([]*logstream.Line, 0, count)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) //nolint:gomnd
+	for i := 0; scanner.Scan() && len(lines) < count; i++ {
+		if i < offset {
+			continue
+		}
+		line := new(logstream.Line)
+		if err := json.Unmarshal(scanner.Bytes(), line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,73 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+type fakeLogClient struct {
+	fail     bool
+	written  []*logstream.Line
+	uploaded []*logstream.Line
+}
+
+func (c *fakeLogClient) Open(context.Context, string) error  { return nil }
+func (c *fakeLogClient) Close(context.Context, string) error { return nil }
+
+func (c *fakeLogClient) Write(_ context.Context, _ string, lines []*logstream.Line) error {
+	if c.fail {
+		return errors.New("log service unreachable")
+	}
+	c.written = append(c.written, lines...)
+	return nil
+}
+
+func (c *fakeLogClient) Upload(_ context.Context, _ string, lines []*logstream.Line) error {
+	c.uploaded = lines
+	return nil
+}
+
+func TestSpillClient(t *testing.T) {
+	ctx := context.Background()
+	upstream := &fakeLogClient{}
+	client := newSpillClient(upstream, t.TempDir(), "key")
+
+	line := func(n int) []*logstream.Line {
+		return []*logstream.Line{{Number: n, Message: "line"}}
+	}
+
+	if err := client.Write(ctx, "key", line(0)); err != nil {
+		t.Fatal(err)
+	}
+	upstream.fail = true
+	if err := client.Write(ctx, "key", line(1)); err == nil {
+		t.Errorf("Want error when the log service is unreachable")
+	}
+	upstream.fail = false
+	if err := client.Write(ctx, "key", line(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(upstream.written), 3; got != want {
+		t.Fatalf("Want %d lines streamed, got %d", want, got)
+	}
+	for i, l := range upstream.written {
+		if l.Number != i {
+			t.Errorf("Want line %d, got %d", i, l.Number)
+		}
+	}
+
+	// the writer history only has the last line, the upload must have all.
+	if err := client.Upload(ctx, "key", line(2)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(upstream.uploaded), 3; got != want {
+		t.Errorf("Want %d lines uploaded, got %d", want, got)
+	}
+	if err := client.Close(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+package harness
+
+import (
+	"context"
+
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/types"
+	loghistory "github.com/drone/runner-go/logger/history"
+)
+
+// maxStatusErrors is the number of recent errors reported in the status.
+const maxStatusErrors = 20
+
+type (
+	RunnerStatus = vmapi.RunnerStatus
+	PoolStatus   = vmapi.PoolStatus
+	StatusError  = vmapi.StatusError
+)
+
+// GetStatus returns the status of all pools. The recent errors are taken
+// from the log history, if it is not nil.
+func GetStatus(ctx context.Context, poolManager *drivers.Manager, history *loghistory.Hook) *RunnerStatus {
+	status := &RunnerStatus{Logs: Logs().Active()}
+
+	for _, name := range poolManager.PoolNames() {
+		platform, _, driver := poolManager.Inspect(name)
+		pool := &PoolStatus{Name: name, Driver: driver, Platform: platform}
+		instances, err := poolManager.GetInstanceStore().List(ctx, name, nil)
+		if err != nil {
+			pool.Error = err.Error()
+		}
+		for _, instance := range instances {
+			instance.CAKey = nil
+			instance.CACert = nil
+			instance.TLSKey = nil
+			instance.TLSCert = nil
+			switch instance.State {
+			case types.StateInUse:
+				pool.Busy = append(pool.Busy, instance)
+			case types.StateHibernating, types.StatePreparing:
+				pool.Hibernating = append(pool.Hibernating, instance)
+			default:
+				pool.Free = append(pool.Free, instance)
+			}
+		}
+		status.Pools = append(status.Pools, pool)
+	}
+
+	if history != nil {
+		errs := history.Filter(func(e *loghistory.Entry) bool {
+			return e.Level == loghistory.LevelError
+		})
+		// most recent first
+		for i := len(errs) - 1; i >= 0 && len(status.Errors) < maxStatusErrors; i-- {
+			status.Errors = append(status.Errors, &StatusError{Unix: errs[i].Unix, Message: errs[i].Message, Fields: errs[i].Data})
+		}
+	}
+	return status
+}
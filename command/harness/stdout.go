@@ -0,0 +1,74 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/harness/lite-engine/logstream"
+
+	"golang.org/x/time/rate"
+)
+
+// stdoutClient is a logstream.Client which echoes the written lines to
+// the runner stdout, prefixed with the log key. The echo is rate limited
+// so that verbose builds cannot flood the runner logs; lines over the
+// limit are dropped and counted.
+type stdoutClient struct {
+	logstream.Client
+
+	mu      sync.Mutex
+	out     io.Writer
+	prefix  string
+	limiter *rate.Limiter
+	dropped int
+}
+
+func newStdoutClient(client logstream.Client, prefix string, linesPerSecond int) logstream.Client {
+	limit := rate.Inf
+	if linesPerSecond > 0 {
+		limit = rate.Limit(linesPerSecond)
+	}
+	return &stdoutClient{
+		Client:  client,
+		out:     os.Stdout,
+		prefix:  prefix,
+		limiter: rate.NewLimiter(limit, linesPerSecond),
+	}
+}
+
+func (c *stdoutClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	c.echo(lines)
+	return c.Client.Write(ctx, key, lines)
+}
+
+func (c *stdoutClient) Close(ctx context.Context, key string) error {
+	c.mu.Lock()
+	c.flushDropped()
+	c.mu.Unlock()
+	return c.Client.Close(ctx, key)
+}
+
+func (c *stdoutClient) echo(lines []*logstream.Line) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range lines {
+		if !c.limiter.Allow() {
+			c.dropped++
+			continue
+		}
+		c.flushDropped()
+		fmt.Fprintf(c.out, "[%s] %s\n", c.prefix, strings.TrimRight(line.Message, "\n"))
+	}
+}
+
+func (c *stdoutClient) flushDropped() {
+	if c.dropped == 0 {
+		return
+	}
+	fmt.Fprintf(c.out, "[%s] ... %d lines not echoed (rate limited)\n", c.prefix, c.dropped)
+	c.dropped = 0
+}
@@ -0,0 +1,32 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+func TestStdoutClient(t *testing.T) {
+	var buf bytes.Buffer
+	client := newStdoutClient(&fakeLogClient{}, "stage-1", 2).(*stdoutClient)
+	client.out = &buf
+
+	lines := []*logstream.Line{{Message: "one\n"}, {Message: "two\n"}, {Message: "three\n"}, {Message: "four\n"}}
+	if err := client.Write(context.Background(), "key", lines); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(context.Background(), "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[stage-1] one\n[stage-1] two\n[stage-1] ... 2 lines not echoed (rate limited)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if strings.Contains(buf.String(), "three") {
+		t.Errorf("Rate limited lines must not be echoed")
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/command/harness/scripts"
+	"github.com/drone-runners/drone-runner-aws/command/harness/vmapi"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
@@ -24,16 +26,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-type ExecuteVMRequest struct {
-	StageRuntimeID       string `json:"stage_runtime_id"`
-	InstanceID           string `json:"instance_id"`
-	IPAddress            string `json:"ip_address"`
-	PoolID               string `json:"pool_id"`
-	CorrelationID        string `json:"correlation_id"`
-	TaskID               string `json:"task_id,omitempty"`
-	Distributed          bool   `json:"distributed,omitempty"`
-	api.StartStepRequest `json:"start_step_request"`
-}
+type ExecuteVMRequest = vmapi.ExecuteVMRequest
 
 var (
 	StepTimeout = 10 * time.Hour
@@ -55,6 +48,10 @@ func HandleStep(ctx context.Context,
 		return nil, errors.Wrap(err, fmt.Sprintf("failed to find stage owner entity for stage: %s", r.StageRuntimeID))
 	}
 
+	if by, ok := runningStagesOf().preemptedBy(r.StageRuntimeID); ok {
+		return nil, fmt.Errorf("stage was preempted by the urgent stage %s and its VM destroyed, retry the stage", by)
+	}
+
 	poolID := entity.PoolName
 	logr := logrus.
 		WithField("api", "dlite:step").
@@ -127,7 +124,19 @@ func HandleStep(ctx context.Context,
 			}
 		}
 	}
+	if r.StartStepRequest.Image == "" {
+		signer, signErr := lehelper.LoadSigner(env.Runner.ScriptSigningKey)
+		if signErr != nil {
+			return nil, fmt.Errorf("failed to load the script signing key: %w", signErr)
+		}
+		r.StartStepRequest.Run.Command = lehelper.SignCommand(inst.Platform.OS, signer,
+			r.StartStepRequest.Run.Entrypoint, r.StartStepRequest.Run.Command, r.StartStepRequest.Files)
+	}
+	started := time.Now()
 	startStepResponse, err := client.RetryStartStep(ctx, &r.StartStepRequest)
+	event := audit.StepEvent(&r.StartStepRequest, err)
+	event.Pool, event.Instance, event.Stage, event.Owner = poolID, inst.ID, r.StageRuntimeID, inst.OwnerID
+	audit.Record(ctx, event)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call LE.RetryStartStep: %w", err)
 	}
@@ -137,13 +146,23 @@ func HandleStep(ctx context.Context,
 	pollResponse := &api.PollStepResponse{}
 
 	if !async {
-		pollResponse, err = client.RetryPollStep(ctx, &api.PollStepRequest{ID: r.StartStepRequest.ID}, StepTimeout)
+		pollResponse, err = lehelper.PollStep(ctx, client, r.StartStepRequest.ID, StepTimeout,
+			time.Duration(env.LiteEngine.HeartbeatSecs)*time.Second,
+			time.Duration(env.LiteEngine.MaxUnreachableSecs)*time.Second)
 		if err != nil {
 			return nil, fmt.Errorf("failed to call LE.RetryPollStep: %w", err)
 		}
 	}
 
 	logr.WithField("pollResponse", pollResponse).Traceln("completed LE.RetryPollStep")
+	if !async {
+		events, oomErr := lehelper.CheckOOM(ctx, client, inst.Platform.OS, started, pollResponse, env.Runner.DetectOOM)
+		if oomErr != nil {
+			logr.WithError(oomErr).Warnln("failed to look for OOM killer events")
+		} else if events != "" {
+			logr.WithField("events", events).Infoln("step was killed by the OOM killer")
+		}
+	}
 	if len(pollResponse.Envs) > 0 {
 		envState().Add(r.StageRuntimeID, pollResponse.Envs)
 	}
@@ -0,0 +1,35 @@
+package harness
+
+import (
+	"regexp"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/logsink"
+	"github.com/harness/lite-engine/logstream"
+)
+
+// logStreams is the configuration the log streams of the stages share,
+// created once at startup.
+type logStreams struct {
+	redact []*regexp.Regexp
+	sinks  []logstream.Client
+}
+
+var streams = &logStreams{}
+
+// OpenLogStreams compiles the redaction patterns and opens the log sinks
+// of the runner configuration, shared by the log streams of every stage.
+func OpenLogStreams(env *config.EnvConfig) error {
+	redact, err := compileRedactPatterns(env.LiveLog.RedactDefaults, env.LiveLog.RedactPatterns)
+	if err != nil {
+		return err
+	}
+	var sinks []logstream.Client
+	if len(env.LiveLog.Sinks) > 0 {
+		if sinks, err = logsink.Open(env, env.LiveLog.Sinks...); err != nil {
+			return err
+		}
+	}
+	streams = &logStreams{redact: redact, sinks: sinks}
+	return nil
+}
@@ -0,0 +1,27 @@
+package harness
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+func TestOpenLogStreams(t *testing.T) {
+	defer func(prev *logStreams) { streams = prev }(streams)
+
+	env := &config.EnvConfig{}
+	env.LiveLog.Sinks = []string{"file"}
+	env.LiveLog.FileDir = t.TempDir()
+	env.LiveLog.RedactPatterns = []string{`token=(\w+)`}
+	if err := OpenLogStreams(env); err != nil {
+		t.Fatal(err)
+	}
+	if len(streams.sinks) != 1 || len(streams.redact) != 1 {
+		t.Errorf("Want the sink and the pattern shared by the streams, got %d sinks and %d patterns", len(streams.sinks), len(streams.redact))
+	}
+
+	env.LiveLog.Sinks = []string{"unknown"}
+	if err := OpenLogStreams(env); err == nil {
+		t.Errorf("Want an error for the unknown sink")
+	}
+}
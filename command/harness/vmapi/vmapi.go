@@ -0,0 +1,116 @@
+// Package vmapi defines the requests and responses of the delegate HTTP
+// API. It has no dependency on the runner, so that clients of the API can
+// import it without pulling in the drivers and the store.
+package vmapi
+
+import (
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/harness/lite-engine/api"
+)
+
+type SetupVMRequest struct {
+	ID               string            `json:"id"` // stage runtime ID
+	PoolID           string            `json:"pool_id"`
+	FallbackPoolIDs  []string          `json:"fallback_pool_ids"`
+	Tags             map[string]string `json:"tags"`
+	CorrelationID    string            `json:"correlation_id"`
+	LogKey           string            `json:"log_key"`
+	Context          Context           `json:"context,omitempty"`
+	ResourceClass    string            `json:"resource_class"`
+	LogLimits        *LogLimits        `json:"log_limits,omitempty"`
+	Concurrency      *Concurrency      `json:"concurrency,omitempty"`
+	Priority         int               `json:"priority,omitempty"`  // higher priorities are served first, capped by the runner
+	Untrusted        bool              `json:"untrusted,omitempty"` // the repository is untrusted, the instance metadata is blocked
+	api.SetupRequest `json:"setup_request"`
+}
+
+// LogLimits overrides the log limits of the runner configuration for a
+// single pipeline. Zero values keep the configured limit, the limit and the
+// maximum line length cannot be raised above the configured ones.
+type LogLimits struct {
+	Limit             int `json:"limit,omitempty"`              // bytes of log kept for the final upload
+	IntervalMilliSecs int `json:"interval_millisecs,omitempty"` // interval between two streamed batches
+	MaxLineLength     int `json:"max_line_length,omitempty"`
+}
+
+type SetupVMResponse struct {
+	IPAddress  string `json:"ip_address"`
+	InstanceID string `json:"instance_id"`
+}
+
+type Context struct {
+	AccountID   string `json:"account_id,omitempty"`
+	OrgID       string `json:"org_id,omitempty"`
+	ProjectID   string `json:"project_id,omitempty"`
+	PipelineID  string `json:"pipeline_id,omitempty"`
+	RunSequence int    `json:"run_sequence,omitempty"`
+	TaskID      string `json:"task_id,omitempty"`
+}
+
+// Concurrency runs one stage of a group at a time. The other stages of the
+// group wait for the running stage to be destroyed, in the order they
+// arrived.
+type Concurrency struct {
+	Group string `json:"group"`
+	// Supersede fails the waiting stages of the group when a newer stage
+	// arrives, so that only the latest of rapid consecutive pushes builds.
+	Supersede bool `json:"supersede,omitempty"`
+}
+
+type ExecuteVMRequest struct {
+	StageRuntimeID       string `json:"stage_runtime_id"`
+	InstanceID           string `json:"instance_id"`
+	IPAddress            string `json:"ip_address"`
+	PoolID               string `json:"pool_id"`
+	CorrelationID        string `json:"correlation_id"`
+	TaskID               string `json:"task_id,omitempty"`
+	Distributed          bool   `json:"distributed,omitempty"`
+	api.StartStepRequest `json:"start_step_request"`
+}
+
+// ExecVMRequest runs an arbitrary script on a provisioned instance. The
+// stage runtime ID must be the one of the stage the instance is set up for.
+type ExecVMRequest struct {
+	InstanceID     string            `json:"instance_id"`
+	StageRuntimeID string            `json:"stage_runtime_id,omitempty"`
+	CorrelationID  string            `json:"correlation_id"`
+	Script         string            `json:"script"`
+	Envs           map[string]string `json:"envs,omitempty"`
+	WorkingDir     string            `json:"working_dir,omitempty"`
+	Timeout        int               `json:"timeout,omitempty"` // in seconds
+}
+
+// DestroyVMRequest requests the destruction of the instance setup for a
+// stage.
+type DestroyVMRequest struct {
+	ID            string `json:"id"` // stage runtime ID
+	InstanceID    string `json:"instance_id"`
+	PoolID        string `json:"pool_id"`
+	CorrelationID string `json:"correlation_id"`
+}
+
+// RunnerStatus is a snapshot of the pools and instances of the runner.
+type RunnerStatus struct {
+	Pools  []*PoolStatus  `json:"pools"`
+	Errors []*StatusError `json:"errors,omitempty"`
+	Logs   []string       `json:"logs,omitempty"` // keys of the open log streams
+}
+
+// PoolStatus is a snapshot of the instances of a pool. Key material is
+// removed from the instances.
+type PoolStatus struct {
+	Name        string            `json:"name"`
+	Driver      string            `json:"driver"`
+	Platform    types.Platform    `json:"platform"`
+	Busy        []*types.Instance `json:"busy"`
+	Free        []*types.Instance `json:"free"`
+	Hibernating []*types.Instance `json:"hibernating"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// StatusError is a recent error logged by the runner.
+type StatusError struct {
+	Unix    int64                  `json:"unix"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
@@ -0,0 +1,86 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/engine/linter"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type lintCommand struct {
+	source   string
+	poolFile string
+}
+
+func (c *lintCommand) run(*kingpin.ParseContext) error {
+	var pools map[string]types.Platform
+	count := 0
+	if c.poolFile != "" {
+		// a directory of pool files is resolved but only its pools are
+		// checked.
+		if info, err := os.Stat(c.poolFile); err == nil && !info.IsDir() {
+			data, readErr := os.ReadFile(c.poolFile)
+			if readErr != nil {
+				return fmt.Errorf("lint: %w", readErr)
+			}
+			problems, lintErr := linter.LintPoolYAML(data)
+			if lintErr != nil {
+				return fmt.Errorf("lint: %s: %w", c.poolFile, lintErr)
+			}
+			count += printProblems(c.poolFile, problems)
+		}
+		// the pools come from the pool file with its includes and bases
+		// resolved.
+		doc, err := config.ResolveFile(c.poolFile)
+		if err != nil {
+			return fmt.Errorf("lint: %w", err)
+		}
+		resolved, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("lint: %s: %w", c.poolFile, err)
+		}
+		if pools, err = linter.PoolPlatforms(resolved); err != nil {
+			return fmt.Errorf("lint: %s: %w", c.poolFile, err)
+		}
+	}
+
+	data, err := os.ReadFile(c.source)
+	if err != nil {
+		return fmt.Errorf("lint: %w", err)
+	}
+	problems, err := linter.LintPipelineYAML(data, pools)
+	if err != nil {
+		return fmt.Errorf("lint: %s: %w", c.source, err)
+	}
+	count += printProblems(c.source, problems)
+
+	if count != 0 {
+		return fmt.Errorf("lint: found %d problems", count)
+	}
+	return nil
+}
+
+func printProblems(file string, problems []linter.Problem) int {
+	for _, p := range problems {
+		fmt.Printf("%s:%d: %s: %s\n", file, p.Line, p.Path, p.Message)
+	}
+	return len(problems)
+}
+
+// Register the lint command.
+func Register(app *kingpin.Application) {
+	c := new(lintCommand)
+
+	cmd := app.Command("lint", "checks the pool and platform sections of the vm pipelines, and the pool file").
+		Action(c.run)
+	cmd.Arg("source", "pipeline file").
+		Default(".drone.yml").
+		StringVar(&c.source)
+	cmd.Flag("pool-file", "pool file, the pools the pipelines use are checked against it").
+		StringVar(&c.poolFile)
+}
@@ -0,0 +1,35 @@
+package schema
+
+import (
+	"encoding/json"
+	"os"
+
+	jsonschema "github.com/drone-runners/drone-runner-aws/internal/schema"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type schemaCommand struct {
+	format string
+}
+
+func (c *schemaCommand) run(*kingpin.ParseContext) error {
+	s := jsonschema.Pool()
+	if c.format == "pipeline" {
+		s = jsonschema.Pipeline()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Register the schema command.
+func Register(app *kingpin.Application) {
+	c := new(schemaCommand)
+
+	cmd := app.Command("schema", "prints the JSON Schema of the pool file or the vm pipelines").
+		Action(c.run)
+	cmd.Arg("format", "pool or pipeline").
+		Default("pool").
+		EnumVar(&c.format, "pool", "pipeline")
+}
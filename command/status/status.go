@@ -0,0 +1,136 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/client"
+	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/drone/signal"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type statusCommand struct {
+	server   string
+	token    string
+	watch    bool
+	interval time.Duration
+	errors   int
+}
+
+func (c *statusCommand) run(*kingpin.ParseContext) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = signal.WithContextFunc(ctx, func() {
+		cancel()
+	})
+
+	cli := client.New(c.server, client.WithToken(c.token), client.WithRetries(0, 0))
+	for {
+		status, err := cli.Status(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("status: cannot get the runner status from %s: %w", c.server, err)
+		}
+		if c.watch {
+			// clear the screen and move the cursor to the top left corner
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("%s  (every %s)\n\n", time.Now().Format(time.RFC1123), c.interval)
+		}
+		printStatus(os.Stdout, status, c.errors)
+		if !c.watch {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+func printStatus(out io.Writer, status *harness.RunnerStatus, maxErrors int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(w, "POOL\tDRIVER\tPLATFORM\tBUSY\tFREE\tHIBERNATING")
+	for _, pool := range status.Pools {
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%d\t%d\t%d\n", pool.Name, pool.Driver, pool.Platform.OS, pool.Platform.Arch,
+			len(pool.Busy), len(pool.Free), len(pool.Hibernating))
+	}
+	w.Flush()
+
+	var builds []string
+	for _, pool := range status.Pools {
+		for _, instance := range pool.Busy {
+			builds = append(builds, fmt.Sprintf("%s\t%s\t%s\t%s\t%s", pool.Name, instance.Name, instance.Address,
+				instance.Stage, age(instance.Started)))
+		}
+	}
+	sort.Strings(builds)
+	fmt.Fprintln(out)
+	if len(builds) == 0 {
+		fmt.Fprintln(out, "No builds in flight.")
+	} else {
+		fmt.Fprintln(w, "POOL\tINSTANCE\tADDRESS\tSTAGE\tAGE")
+		for _, build := range builds {
+			fmt.Fprintln(w, build)
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintln(out)
+	if len(status.Errors) == 0 {
+		fmt.Fprintln(out, "No recent failures.")
+		return
+	}
+	fmt.Fprintln(w, "TIME\tERROR")
+	for i, e := range status.Errors {
+		if i >= maxErrors {
+			break
+		}
+		msg := e.Message
+		if err, ok := e.Fields["error"]; ok {
+			msg = fmt.Sprintf("%s: %v", msg, err)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", time.Unix(e.Unix, 0).Format(time.RFC3339), strings.TrimSpace(msg))
+	}
+	w.Flush()
+}
+
+func age(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Since(time.Unix(unix, 0)).Truncate(time.Second).String()
+}
+
+// Register the status command.
+func Register(app *kingpin.Application) {
+	c := new(statusCommand)
+
+	cmd := app.Command("status", "prints the pools, instances and recent failures of a running delegate").
+		Action(c.run)
+	cmd.Flag("server", "address of the delegate").
+		Default("http://localhost:3000").
+		Envar("DRONE_STATUS_SERVER").
+		StringVar(&c.server)
+	cmd.Flag("token", "bearer token sent to the delegate").
+		Envar("DRONE_STATUS_TOKEN").
+		StringVar(&c.token)
+	cmd.Flag("watch", "refresh the status periodically").
+		BoolVar(&c.watch)
+	cmd.Flag("interval", "refresh interval in watch mode").
+		Default("5s").
+		DurationVar(&c.interval)
+	cmd.Flag("errors", "maximum number of recent failures to print").
+		Default("10").
+		IntVar(&c.errors)
+}
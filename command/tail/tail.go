@@ -0,0 +1,96 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/client"
+	"github.com/drone-runners/drone-runner-aws/command/harness"
+	"github.com/drone/signal"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// scripts print the log of a source, the %s verb is replaced with
+// the flags of the tail command.
+var scripts = map[string]string{
+	"cloud-init":  "tail %s /var/log/cloud-init-output.log",
+	"docker":      "journalctl --no-pager -u docker %s",
+	"lite-engine": "tail %s /var/log/lite-engine.log",
+}
+
+type tailCommand struct {
+	server   string
+	token    string
+	instance string
+	stage    string
+	source   string
+	lines    int
+	follow   bool
+	timeout  int
+}
+
+func (c *tailCommand) run(*kingpin.ParseContext) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = signal.WithContextFunc(ctx, func() {
+		cancel()
+	})
+
+	flags := fmt.Sprintf("-n %d", c.lines)
+	if c.follow {
+		flags += " -f"
+	}
+
+	cli := client.New(c.server, client.WithToken(c.token))
+	res, err := cli.Exec(ctx, &harness.ExecVMRequest{
+		InstanceID:     c.instance,
+		StageRuntimeID: c.stage,
+		Script:         fmt.Sprintf(scripts[c.source], flags),
+		Timeout:        c.timeout,
+	}, os.Stdout)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("tail: %w", err)
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("tail: exit code %d %s", res.ExitCode, res.Error)
+	}
+	return nil
+}
+
+// Register the tail command.
+func Register(app *kingpin.Application) {
+	c := new(tailCommand)
+
+	cmd := app.Command("tail", "prints the cloud-init, docker or lite-engine log of an instance").
+		Action(c.run)
+	cmd.Arg("instance", "id of the instance").
+		Required().
+		StringVar(&c.instance)
+	cmd.Flag("stage", "runtime id of the stage the instance is set up for").
+		StringVar(&c.stage)
+	cmd.Flag("server", "address of the delegate").
+		Default("http://localhost:3000").
+		Envar("DRONE_STATUS_SERVER").
+		StringVar(&c.server)
+	cmd.Flag("token", "bearer token sent to the delegate").
+		Envar("DRONE_STATUS_TOKEN").
+		StringVar(&c.token)
+	cmd.Flag("source", "log to print").
+		Default("cloud-init").
+		EnumVar(&c.source, "cloud-init", "docker", "lite-engine")
+	cmd.Flag("lines", "number of lines to print").
+		Short('n').
+		Default("100").
+		IntVar(&c.lines)
+	cmd.Flag("follow", "keep printing lines as they are written").
+		Short('f').
+		BoolVar(&c.follow)
+	cmd.Flag("timeout", "maximum time to follow the log, in seconds").
+		Default("3600").
+		IntVar(&c.timeout)
+}
@@ -7,13 +7,18 @@ package compiler
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-aws/engine"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
+	"github.com/drone-runners/drone-runner-aws/internal/admission"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/encoder"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/drone-go/drone"
 
 	"github.com/drone/runner-go/clone"
@@ -62,8 +67,22 @@ type (
 		// Volumes provides a set of volumes that should be mounted to each pipeline container
 		Volumes []string
 
+		// CreateWorkingDir creates the working directory of host steps
+		// if it does not exist.
+		CreateWorkingDir bool
+
+		// Privileges limit the images that run in privileged mode.
+		Privileges *resource.Privileges
+
+		// Policy restricts the pipelines of untrusted repositories.
+		Policy *resource.Policy
+
 		// Tmate provides global configration options for tmate live debugging.
 		Tmate
+
+		// VMSteps adds the steps setting up the instance, first, and
+		// destroying it, last, with their own output.
+		VMSteps bool
 	}
 )
 
@@ -83,17 +102,39 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 		targetPool = c.PoolManager.MatchPoolNameFromPlatform(&pipeline.Platform)
 	}
 
+	// untrusted pipelines are moved to the pools of the policy, the linter checks one runs them.
+	untrusted := c.Policy.Untrusted(args.Repo)
+	if untrusted {
+		platformOf := func(pool string) types.Platform {
+			platform, _, _ := c.PoolManager.Inspect(pool)
+			return platform
+		}
+		if pool, err := c.Policy.PoolFor(targetPool, pipeline.Platform, platformOf); err == nil {
+			targetPool = pool
+		}
+		spec.Untrusted = true
+		if c.Policy.Timeout > 0 {
+			spec.Deadline = time.Now().Add(c.Policy.Timeout)
+		}
+	}
+
 	pipelinePlatform, pipelineRoot, _ := c.PoolManager.Inspect(targetPool)
 
 	// move the pool from the `mapping of pools` into the spec of this pipeline.
 	spec.CloudInstance.PoolName = targetPool
+	spec.CloudInstance.Tags = buildTags(args.Repo, args.Build, args.Stage)
+	spec.Reuse, spec.Keep = stageKeys(pipeline, args.Manifest, args.Build, poolReuse)
+	spec.Restore, spec.Snapshot = stageKeys(pipeline, args.Manifest, args.Build, workspaceRestore)
 
 	// create directories
 	// * homeDir is home directory on the host machine where netrc file will be placed
 	// * sourceDir is directory on the host machine where source code will be pulled
 	// * scriptDir is directory on the host machine where script files (with commands) will be placed
-	directories, homeDir, sourceDir := createDirectories(pipelinePlatform.OS, pipelineRoot)
+	// * workspaceDir is the directory of the pool the source directory is in, by default
+	directories, homeDir, workspaceDir, sourceDir := createDirectories(pipelinePlatform.OS, pipelineRoot,
+		c.PoolManager.InspectSettings(targetPool).Workspace, pipeline.Workspace.Path)
 	spec.Files = append(spec.Files, directories...)
+	spec.Workspace = workspaceDir
 
 	// create netrc file if needed
 	if netrc := args.Netrc; netrc != nil && netrc.Password != "" {
@@ -190,6 +231,21 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 			RunPolicy: runtime.RunAlways,
 		})
 	}
+	// create the compose steps, maybe. the logs of the compose services are streamed by a detached step.
+	composeProject := ""
+	if pipeline.Compose != nil {
+		composeProject = pipeline.Compose.Project
+		if composeProject == "" {
+			composeProject = strings.ToLower(oshelp.Random())
+		}
+		spec.Steps = append(spec.Steps,
+			createHostStep(pipelinePlatform, pipelineRoot, sourceDir, composeStep,
+				composeCommand(pipeline.Compose, composeProject, "up", "--detach", "--wait"), envs),
+			createHostStep(pipelinePlatform, pipelineRoot, sourceDir, composeLogsStep,
+				composeCommand(pipeline.Compose, composeProject, "logs", "--follow", "--no-color"), envs),
+		)
+		spec.Steps[len(spec.Steps)-1].Detach = true
+	}
 	// match object is used to determine is a step should be executed or not
 	match := manifest.Match{
 		Action:   args.Build.Action,
@@ -203,13 +259,28 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 	}
 	// create steps
 	haveImageSteps := false // should be true if there is at least one step that uses an image
+	workspaceMount := workspaceVolume(pipelinePlatform.OS, pipelineRoot, workspaceDir, sourceDir)
+	serviceHosts := map[string]string{}
 	for _, src := range pipeline.Services {
 		src.Detach = true // services are the same as steps, but are executed first and are detached
+		serviceHosts[lehelper.ServiceHostEnv(src.Name)] = src.Name
 	}
 	for _, src := range append(pipeline.Services, pipeline.Steps...) { // combine: services+steps
 		stepID := oshelp.Random()
 
 		stepEnv := environ.Combine(envs, environ.Expand(convertStaticEnv(src.Environment)))
+		// containers resolve services by name on the build network, host steps reach the published ports.
+		if !src.Detach {
+			for key, host := range serviceHosts {
+				if _, ok := stepEnv[key]; ok {
+					continue
+				}
+				if src.Image == "" {
+					host = "localhost"
+				}
+				stepEnv[key] = host
+			}
+		}
 		stepSecrets := convertSecretEnv(src.Environment)
 
 		var entrypoint []string
@@ -218,13 +289,13 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 
 		// set entrypoint if running on the host or if the container has commands
 		if src.Image == "" || (src.Image != "" && len(src.Commands) > 0) {
-			entrypoint = oshelp.GetEntrypoint(pipelinePlatform.OS)
+			entrypoint = oshelp.GetShellEntrypoint(pipelinePlatform.OS, src.Shell)
 		}
 
 		// build the script of commands we will execute
 		if len(src.Commands) > 0 {
-			scriptToExecute := oshelp.GenScript(pipelinePlatform.OS, pipelinePlatform.Arch, src.Commands)
-			scriptPath := oshelp.JoinPaths(pipelinePlatform.OS, pipelineRoot, "opt", oshelp.GetExt(pipelinePlatform.OS, stepID))
+			scriptToExecute := oshelp.GenShellScript(pipelinePlatform.OS, pipelinePlatform.Arch, src.Shell, src.Commands)
+			scriptPath := oshelp.JoinPaths(pipelinePlatform.OS, pipelineRoot, "opt", oshelp.GetShellExt(pipelinePlatform.OS, src.Shell, stepID))
 
 			files = []*lespec.File{
 				{
@@ -249,6 +320,9 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 
 			// mount the root drone directory in the container
 			volumeMounts = append(volumeMounts, &lespec.VolumeMount{Name: "pipeline_root", Path: pipelineRoot})
+			if workspaceMount != "" {
+				volumeMounts = append(volumeMounts, &lespec.VolumeMount{Name: "pipeline_workspace", Path: workspaceMount})
+			}
 
 			if len(src.Entrypoint) > 0 {
 				entrypoint = src.Entrypoint
@@ -258,6 +332,19 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 				files = nil
 			}
 		}
+		// the working directory of host steps is created before the step runs, or checked by the engine.
+		// containers run in the source directory.
+		workingDir := sourceDir
+		checkWorkingDir := false
+		if src.Image == "" && src.WorkingDir != "" {
+			workingDir = stepWorkingDir(pipelinePlatform.OS, sourceDir, src.WorkingDir)
+			if c.CreateWorkingDir {
+				files = append([]*lespec.File{{Path: workingDir, Mode: 0700, IsDir: true}}, files...)
+			} else {
+				checkWorkingDir = true
+			}
+		}
+
 		// appends the devices to the container def.
 		var devices []*lespec.VolumeDevice
 		for _, vol := range src.Devices {
@@ -314,10 +401,33 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 			errorPolicy = runtime.ErrFailFast
 		}
 
+		// steps wait until detached steps with a health check are healthy.
+		var health *types.ServiceHealth
+		if src.Detach && src.Health != nil {
+			health = &types.ServiceHealth{
+				Ports:    src.Health.Ports,
+				Test:     src.Health.Test,
+				Interval: time.Duration(src.Health.Interval) * time.Second,
+				Timeout:  time.Duration(src.Health.Timeout) * time.Second,
+			}
+		}
+
+		// limit the step resources. the cpu limit is in millicores, the quota in microseconds per period.
+		var cpuPeriod, cpuQuota, memLimit int64
+		if src.Resources != nil {
+			if src.Resources.Limits.CPU > 0 {
+				cpuPeriod = cpuPeriodMicros
+				cpuQuota = src.Resources.Limits.CPU * cpuPeriodMicros / 1000 //nolint:gomnd
+			}
+			memLimit = int64(src.Resources.Limits.Memory)
+		}
+
 		// create the step
 		spec.Steps = append(spec.Steps, &engine.Step{
 			Step: lespec.Step{
 				Command:      command,
+				CPUPeriod:    cpuPeriod,
+				CPUQuota:     cpuQuota,
 				Detach:       src.Detach,
 				Devices:      devices,
 				DNS:          src.DNS,
@@ -328,23 +438,33 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 				Files:        files,
 				ID:           stepID,
 				Image:        src.Image,
+				MemLimit:     memLimit,
 				Name:         src.Name,
 				Network:      src.Network,
 				Networks:     nil, // not used by the runner
 				PortBindings: src.PortBindings,
-				Privileged:   src.Image != "", // all steps that use images, run in privileged mode
+				Privileged:   !untrusted && c.Privileges.IsPrivileged(src),
 				Pull:         convertPullPolicy(src.Pull),
 				Secrets:      stepSecrets,
 				ShmSize:      int64(src.ShmSize),
 				User:         src.User,
 				Volumes:      volumeMounts,
-				WorkingDir:   sourceDir,
+				WorkingDir:   workingDir,
 			},
-			DependsOn: src.DependsOn,
-			ErrPolicy: errorPolicy,
-			RunPolicy: runPolicy,
+			DependsOn:       src.DependsOn,
+			ErrPolicy:       errorPolicy,
+			RunPolicy:       runPolicy,
+			Health:          health,
+			CheckWorkingDir: checkWorkingDir,
 		})
 	}
+	if pipeline.Compose != nil {
+		down := createHostStep(pipelinePlatform, pipelineRoot, sourceDir, composeDownStep,
+			composeCommand(pipeline.Compose, composeProject, "down", "--volumes", "--remove-orphans"), envs)
+		down.ErrPolicy = runtime.ErrIgnore
+		down.RunPolicy = runtime.RunAlways
+		spec.Steps = append(spec.Steps, down)
+	}
 	var creds = []*drone.Registry{}
 	// get registry credentials from registry plugins
 	if c.Registry != nil {
@@ -455,16 +575,31 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 					Labels: systemLabels,
 				},
 			})
+		if workspaceMount != "" {
+			spec.Volumes = append(spec.Volumes,
+				&lespec.Volume{ // a mount for the workspace outside of the pipeline root
+					HostPath: &lespec.VolumeHostPath{
+						ID:     "pipeline_workspace_" + oshelp.Random(),
+						Name:   "pipeline_workspace",
+						Path:   workspaceMount,
+						Labels: systemLabels,
+					},
+				})
+		}
 	}
 
 	// set step dependencies
-	if !isGraph(spec) {
+	graph := isGraph(spec)
+	if !graph {
 		configureSerial(spec)
 	} else if !pipeline.Clone.Disable {
 		configureCloneDeps(spec)
 	} else if pipeline.Clone.Disable {
 		removeCloneDeps(spec)
 	}
+	if pipeline.Compose != nil && graph {
+		configureComposeDeps(spec)
+	}
 
 	// set secret values
 	for _, step := range spec.Steps {
@@ -476,6 +611,12 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 		}
 	}
 
+	spec.Admission = c.admissionInput(spec, &args)
+
+	if c.VMSteps {
+		addVMSteps(spec, args.Stage, time.Now())
+	}
+
 	return spec
 }
 
@@ -505,19 +646,84 @@ func (c *Compiler) findSecret(ctx context.Context, args runtime.CompilerArgs, na
 	return found.Data, true
 }
 
-func createDirectories(pipelineOS, pipelineRoot string) (directories []*lespec.File, homeDir, sourceDir string) {
+// admissionInput returns the input of the admission policies of the stage,
+// with the sorted names of the secrets requested by its steps.
+func (c *Compiler) admissionInput(spec *engine.Spec, args *runtime.CompilerArgs) *admission.Input {
+	pool := spec.CloudInstance.PoolName
+	platform, _, driver := c.PoolManager.Inspect(pool)
+	machineType, diskSize := c.PoolManager.InspectSize(pool)
+	input := &admission.Input{
+		Pool: admission.Pool{
+			Name:        pool,
+			Driver:      driver,
+			OS:          platform.OS,
+			Arch:        platform.Arch,
+			MachineType: machineType,
+			DiskSize:    diskSize,
+		},
+		Untrusted: spec.Untrusted,
+	}
+	if repo := args.Repo; repo != nil {
+		input.Repo = admission.Repo{Slug: repo.Slug, Private: repo.Private, Trusted: repo.Trusted}
+	}
+	if build := args.Build; build != nil {
+		input.Build = admission.Build{
+			Number: build.Number,
+			Event:  build.Event,
+			Action: build.Action,
+			Ref:    build.Ref,
+			Branch: build.Target,
+			Deploy: build.Deploy,
+			Author: build.Author,
+		}
+	}
+	if stage := args.Stage; stage != nil {
+		input.Stage = admission.Stage{Name: stage.Name, Number: stage.Number}
+	}
+	for _, step := range spec.Steps {
+		var secrets []string
+		seen := map[string]bool{}
+		for _, s := range step.Secrets {
+			if !seen[s.Name] {
+				seen[s.Name] = true
+				secrets = append(secrets, s.Name)
+			}
+		}
+		sort.Strings(secrets)
+		input.Steps = append(input.Steps, &admission.Step{
+			Name:       step.Name,
+			Image:      step.Image,
+			Privileged: step.Privileged,
+			Detach:     step.Detach,
+			Secrets:    secrets,
+		})
+	}
+	return input
+}
+
+// createDirectories returns the directories of the pipeline. The workspace
+// of the pool replaces the drone directory of the root directory, and the
+// workspace path of the pipeline, relative to it unless absolute, replaces
+// its src directory.
+func createDirectories(pipelineOS, pipelineRoot, workspace, workspacePath string) (directories []*lespec.File, homeDir, workspaceDir, sourceDir string) {
 	homeRootDir := oshelp.JoinPaths(pipelineOS, pipelineRoot, "home")
 	homeDir = oshelp.JoinPaths(pipelineOS, homeRootDir, "drone")
 
-	droneDir := oshelp.JoinPaths(pipelineOS, pipelineRoot, "drone")
-	sourceDir = oshelp.JoinPaths(pipelineOS, droneDir, "src")
+	workspaceDir = oshelp.NormalizePath(pipelineOS, workspace)
+	if workspaceDir == "" {
+		workspaceDir = oshelp.JoinPaths(pipelineOS, pipelineRoot, "drone")
+	}
+	if workspacePath == "" {
+		workspacePath = "src"
+	}
+	sourceDir = stepWorkingDir(pipelineOS, workspaceDir, workspacePath)
 
 	scriptDir := oshelp.JoinPaths(pipelineOS, pipelineRoot, "opt")
 
 	directories = []*lespec.File{
 		{Path: homeRootDir, Mode: 0700, IsDir: true},
 		{Path: homeDir, Mode: 0700, IsDir: true},
-		{Path: droneDir, Mode: 0700, IsDir: true},
+		{Path: workspaceDir, Mode: 0700, IsDir: true},
 		{Path: sourceDir, Mode: 0700, IsDir: true},
 		{Path: scriptDir, Mode: 0700, IsDir: true},
 	}
@@ -45,6 +45,11 @@ func TestCompile_Serial(t *testing.T) {
 	testCompile(t, "testdata/serial.yml", "testdata/serial.json")
 }
 
+// This test verifies the cpu and memory limits of the steps.
+func TestCompile_Resources(t *testing.T) {
+	testCompile(t, "testdata/resources.yml", "testdata/resources.json")
+}
+
 // This test verifies the pipeline dependency graph. It also
 // verifies that pipeline steps with no dependencies depend on
 // the initial clone step.
@@ -52,6 +57,15 @@ func TestCompile_Graph(t *testing.T) {
 	testCompile(t, "testdata/graph.yml", "testdata/graph.json")
 }
 
+// This test verifies the compose project is started after the
+// clone step and stopped after the pipeline steps.
+func TestCompile_Compose(t *testing.T) {
+	ir := testCompile(t, "testdata/compose.yml", "testdata/compose.json")
+	if ir.Steps[4].RunPolicy != runtime.RunAlways {
+		t.Errorf("Expect the compose project is always stopped")
+	}
+}
+
 // This test verifies no clone step exists in the pipeline if
 // cloning is disabled.
 func TestCompile_CloneDisabled_Serial(t *testing.T) {
@@ -95,11 +109,36 @@ func TestCompile_RunFailure(t *testing.T) {
 	}
 }
 
+// This test verifies that the status conditions of the steps are
+// combined with their other conditions: steps running on failure
+// whose branch does not match never run.
+func TestCompile_RunConditions(t *testing.T) {
+	ir := testCompile(t, "testdata/run_conditions.yml", "testdata/run_conditions.json")
+	want := []runtime.RunPolicy{runtime.RunOnSuccess, runtime.RunOnFailure, runtime.RunNever, runtime.RunAlways}
+	for i, policy := range want {
+		if got := ir.Steps[i].RunPolicy; got != policy {
+			t.Errorf("Expect step %s to run %s, got %s", ir.Steps[i].Name, policy, got)
+		}
+	}
+}
+
 // This test verifies the pipelines with container images and services.
 func TestCompile_Image(t *testing.T) {
 	testCompile(t, "testdata/image.yml", "testdata/image.json")
 }
 
+// This test verifies the pipelines with services gated on their health
+// checks, and the service hostnames injected in the steps.
+func TestCompile_Services(t *testing.T) {
+	ir := testCompile(t, "testdata/services.yml", "testdata/services.json")
+	if got, want := ir.Steps[2].Envs["DRONE_SERVICE_REDIS_HOST"], "redis"; got != want {
+		t.Errorf("Want service host %q, got %q", want, got)
+	}
+	if _, ok := ir.Steps[1].Envs["DRONE_SERVICE_REDIS_HOST"]; ok {
+		t.Errorf("Want no service host in the service")
+	}
+}
+
 // This test verifies the pipelines with container images that use volumes.
 func TestCompile_Plugin(t *testing.T) {
 	ir := testCompile(t, "testdata/plugins.yml", "testdata/plugins.json")
@@ -161,6 +200,20 @@ func TestCompile_Secrets(t *testing.T) {
 	}
 }
 
+// This test verifies the admission input of the pipeline, with the
+// pool and the secrets requested by the steps.
+func TestCompile_Admission(t *testing.T) {
+	ir := testCompile(t, "testdata/secret.yml", "testdata/secret.json")
+
+	input := ir.Admission
+	if input == nil || input.Pool.Name != "ubuntu" || input.Pool.OS != "linux" {
+		t.Fatalf("Want the admission input of the pool, got %+v", input)
+	}
+	if diff := cmp.Diff(input.Steps[0].Secrets, []string{"my_password", "my_username"}); diff != "" {
+		t.Errorf("Want the secrets requested by the step in the admission input: %s", diff)
+	}
+}
+
 // helper function parses and compiles the source file and then
 // compares to a golden json file.
 func testCompile(t *testing.T, source, golden string) *engine.Spec {
@@ -250,7 +303,7 @@ func testCompile(t *testing.T, source, golden string) *engine.Spec {
 	}
 
 	opts := cmp.Options{
-		cmpopts.IgnoreFields(engine.Spec{}, "Network"),
+		cmpopts.IgnoreFields(engine.Spec{}, "Network", "Admission"),
 		cmpopts.IgnoreFields(engine.Step{}, "Envs", "Secrets", "Files"),
 		cmpopts.IgnoreFields(lespec.Network{}, "Labels"),
 		cmpopts.IgnoreFields(lespec.VolumeHostPath{}, "Labels"),
@@ -5,17 +5,35 @@
 package compiler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-aws/engine"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
+	"github.com/drone/runner-go/pipeline/runtime"
 	lespec "github.com/harness/lite-engine/engine/spec"
 )
 
-const cloneStep = "clone"
+const (
+	cloneStep       = "clone"
+	composeStep     = "compose"
+	composeLogsStep = "compose-logs"
+	composeDownStep = "compose-down"
+	initializeStep  = "Initialize VM"
+	cleanupStep     = "Cleanup VM"
+
+	defaultComposeFile = "docker-compose.yml"
+
+	cpuPeriodMicros = 100000
+)
 
 // helper function returns true if the step is configured to
 // always run regardless of status.
@@ -61,6 +79,72 @@ func configureSerial(spec *engine.Spec) {
 	}
 }
 
+// helper function adds the steps setting up the instance, first,
+// and destroying it, last, so that they show with their output and
+// durations. They are added once the dependencies of the steps are
+// set.
+func addVMSteps(spec *engine.Spec, stage *drone.Stage, accepted time.Time) {
+	for _, step := range spec.Steps {
+		if step.Name == initializeStep || step.Name == cleanupStep {
+			return
+		}
+	}
+	spec.Provisioning = &engine.Provisioning{Accepted: accepted}
+	if stage != nil && stage.Created > 0 {
+		spec.Provisioning.Queued = accepted.Sub(time.Unix(stage.Created, 0))
+	}
+
+	names := []string{initializeStep}
+	for _, step := range spec.Steps {
+		if len(step.DependsOn) == 0 {
+			step.DependsOn = []string{initializeStep}
+		}
+		names = append(names, step.Name)
+	}
+	initialize := &engine.Step{
+		Step: lespec.Step{
+			ID:   oshelp.Random(),
+			Name: initializeStep,
+		},
+		ErrPolicy: runtime.ErrFail,
+		RunPolicy: runtime.RunAlways,
+		Synthetic: engine.SyntheticInitialize,
+	}
+	// a failed cleanup does not fail the build, the instance is
+	// destroyed again with the pipeline environment.
+	cleanup := &engine.Step{
+		Step: lespec.Step{
+			ID:   oshelp.Random(),
+			Name: cleanupStep,
+		},
+		DependsOn: names,
+		ErrPolicy: runtime.ErrIgnore,
+		RunPolicy: runtime.RunAlways,
+		Synthetic: engine.SyntheticCleanup,
+	}
+	spec.Steps = append(append([]*engine.Step{initialize}, spec.Steps...), cleanup)
+}
+
+// helper function returns the tags of the instance running the
+// stage, which attribute the instance and its resources to the
+// build. Keys are limited to characters all drivers accept.
+func buildTags(repo *drone.Repo, build *drone.Build, stage *drone.Stage) map[string]string {
+	tags := map[string]string{}
+	if repo != nil && repo.Slug != "" {
+		tags["drone_repo"] = repo.Slug
+	}
+	if build != nil && build.Number != 0 {
+		tags["drone_build"] = strconv.FormatInt(build.Number, 10)
+	}
+	if stage != nil && stage.Name != "" {
+		tags["drone_stage"] = stage.Name
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
 // helper function converts the environment variables to a map,
 // returning only inline environment variables not derived from
 // a secret.
@@ -110,6 +194,69 @@ func configureCloneDeps(spec *engine.Spec) {
 	}
 }
 
+// helper function modifies the pipeline dependency graph so
+// steps run once the compose project is up, and the project
+// is stopped after all other steps.
+func configureComposeDeps(spec *engine.Spec) {
+	var names []string
+	for _, step := range spec.Steps {
+		switch step.Name {
+		case composeDownStep:
+			continue
+		case cloneStep, composeStep:
+		case composeLogsStep:
+			step.DependsOn = []string{composeStep}
+		default:
+			if len(step.DependsOn) == 0 ||
+				(len(step.DependsOn) == 1 && step.DependsOn[0] == cloneStep) {
+				step.DependsOn = []string{composeStep}
+			}
+		}
+		names = append(names, step.Name)
+	}
+	for _, step := range spec.Steps {
+		if step.Name == composeDownStep {
+			step.DependsOn = names
+		}
+	}
+}
+
+// helper function returns the docker compose command line
+// of the pipeline compose project.
+func composeCommand(compose *resource.Compose, project string, args ...string) string {
+	file := compose.File
+	if file == "" {
+		file = defaultComposeFile
+	}
+	return strings.Join(append([]string{"docker", "compose", "--file", file, "--project-name", project}, args...), " ")
+}
+
+// helper function returns a step running the command on the
+// host in the workspace.
+func createHostStep(platform types.Platform, root, workingDir, name, command string, envs map[string]string) *engine.Step {
+	path := oshelp.JoinPaths(platform.OS, root, "opt", oshelp.GetExt(platform.OS, name))
+	return &engine.Step{
+		Step: lespec.Step{
+			ID:         oshelp.Random(),
+			Name:       name,
+			Entrypoint: oshelp.GetEntrypoint(platform.OS),
+			Command:    []string{path},
+			Envs:       envs,
+			Secrets:    []*lespec.Secret{},
+			WorkingDir: workingDir,
+			Files: []*lespec.File{
+				{
+					Path: path,
+					Mode: 0700,
+					Data: oshelp.GenScript(platform.OS, platform.Arch, []string{command}),
+				},
+			},
+		},
+		ErrPolicy: runtime.ErrFail,
+		RunPolicy: runtime.RunOnSuccess,
+	}
+}
+
 // helper function modifies the pipeline dependency graph to
 // account for a disabled clone step.
 func removeCloneDeps(spec *engine.Spec) {
@@ -140,3 +287,73 @@ func convertPullPolicy(s string) lespec.PullPolicy {
 		return lespec.PullDefault
 	}
 }
+
+// stepWorkingDir returns the working directory of a host step, with the
+// separators of the platform. A relative working directory is relative to
+// the source directory.
+func stepWorkingDir(pipelineOS, sourceDir, workingDir string) string {
+	switch {
+	case workingDir == "":
+		return sourceDir
+	case oshelp.IsAbs(pipelineOS, workingDir):
+		return oshelp.NormalizePath(pipelineOS, workingDir)
+	default:
+		return oshelp.NormalizePath(pipelineOS, oshelp.JoinPaths(pipelineOS, sourceDir, workingDir))
+	}
+}
+
+// workspaceVolume returns the directory of the source mounted in the
+// containers besides the pipeline root, empty if the source directory is
+// in the pipeline root.
+func workspaceVolume(pipelineOS, pipelineRoot, workspaceDir, sourceDir string) string {
+	dir := workspaceDir
+	if !withinDir(pipelineOS, sourceDir, workspaceDir) {
+		dir = sourceDir
+	}
+	if withinDir(pipelineOS, dir, pipelineRoot) {
+		return ""
+	}
+	return dir
+}
+
+// withinDir returns true if the path is the directory or is in it.
+func withinDir(pipelineOS, path, dir string) bool {
+	sep := "/"
+	if pipelineOS == oshelp.OSWindows {
+		sep = `\`
+		path, dir = strings.ToLower(path), strings.ToLower(dir)
+	}
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, sep)+sep)
+}
+
+// helper function returns the key of the stage the pipeline refers to
+// with ref, e.g. the stage whose instance it reuses, and the key of the
+// pipeline if a stage of the manifest refers to it. The keys are unique
+// to the build.
+func stageKeys(pipeline *resource.Pipeline, mfst *manifest.Manifest, build *drone.Build, ref func(*resource.Pipeline) string) (from, to string) {
+	if build == nil {
+		return "", ""
+	}
+	if stage := ref(pipeline); stage != "" {
+		from = buildStageKey(build.ID, stage)
+	}
+	if mfst == nil {
+		return from, ""
+	}
+	for _, r := range mfst.Resources {
+		if other, ok := r.(*resource.Pipeline); ok && ref(other) != "" && ref(other) == pipeline.Name {
+			return from, buildStageKey(build.ID, pipeline.Name)
+		}
+	}
+	return from, ""
+}
+
+func poolReuse(pipeline *resource.Pipeline) string        { return pipeline.Pool.Reuse }
+func workspaceRestore(pipeline *resource.Pipeline) string { return pipeline.Workspace.Restore }
+
+// helper function returns the key of the stage of the build, hashed
+// to fit the stage of the instance.
+func buildStageKey(buildID int64, stage string) string {
+	sum := sha256.Sum256([]byte(strconv.FormatInt(buildID, 10) + "/" + stage))
+	return hex.EncodeToString(sum[:16])
+}
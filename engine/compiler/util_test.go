@@ -6,11 +6,13 @@ package compiler
 
 import (
 	"testing"
+	"time"
 
 	lespec "github.com/harness/lite-engine/engine/spec"
 
 	"github.com/drone-runners/drone-runner-aws/engine"
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
+	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
 
 	"github.com/google/go-cmp/cmp"
@@ -105,6 +107,59 @@ func Test_convertStaticEnv(t *testing.T) {
 	}
 }
 
+func Test_buildTags(t *testing.T) {
+	tags := buildTags(
+		&drone.Repo{Slug: "octocat/hello-world"},
+		&drone.Build{Number: 42},
+		&drone.Stage{Name: "default"},
+	)
+	want := map[string]string{
+		"drone_repo":  "octocat/hello-world",
+		"drone_build": "42",
+		"drone_stage": "default",
+	}
+	if diff := cmp.Diff(tags, want); diff != "" {
+		t.Errorf("Unexpected tags")
+		t.Log(diff)
+	}
+	if tags := buildTags(&drone.Repo{}, &drone.Build{}, &drone.Stage{}); tags != nil {
+		t.Errorf("Want no tags, got %v", tags)
+	}
+}
+
+func Test_addVMSteps(t *testing.T) {
+	spec := &engine.Spec{Steps: []*engine.Step{
+		{Step: lespec.Step{Name: "clone"}},
+		{Step: lespec.Step{Name: "build"}, DependsOn: []string{"clone"}},
+	}}
+	accepted := time.Unix(1000, 0)
+	addVMSteps(spec, &drone.Stage{Created: 940}, accepted)
+	if len(spec.Steps) != 4 {
+		t.Fatalf("Want the initialize and cleanup steps added, got %d steps", len(spec.Steps))
+	}
+	initialize, cleanup := spec.Steps[0], spec.Steps[3]
+	if initialize.Name != initializeStep || initialize.Synthetic != engine.SyntheticInitialize || len(initialize.DependsOn) != 0 {
+		t.Errorf("Want the initialize step first without dependencies, got %+v", initialize)
+	}
+	if diff := cmp.Diff(spec.Steps[1].DependsOn, []string{initializeStep}); diff != "" {
+		t.Errorf("Want the steps without dependencies after the initialize step: %s", diff)
+	}
+	if diff := cmp.Diff(spec.Steps[2].DependsOn, []string{"clone"}); diff != "" {
+		t.Errorf("Want the other dependencies unchanged: %s", diff)
+	}
+	if diff := cmp.Diff(cleanup.DependsOn, []string{initializeStep, "clone", "build"}); diff != "" || cleanup.Synthetic != engine.SyntheticCleanup {
+		t.Errorf("Want the cleanup step after all steps: %s", diff)
+	}
+	if spec.Provisioning == nil || spec.Provisioning.Queued != time.Minute || !spec.Provisioning.Accepted.Equal(accepted) {
+		t.Errorf("Want the time the stage was queued, got %+v", spec.Provisioning)
+	}
+
+	addVMSteps(spec, nil, accepted)
+	if len(spec.Steps) != 4 {
+		t.Errorf("Want the steps added once")
+	}
+}
+
 func Test_convertSecretEnv(t *testing.T) {
 	vars := map[string]*manifest.Variable{
 		"USERNAME": {Value: "octocat"},
@@ -149,6 +204,35 @@ func Test_configureCloneDeps(t *testing.T) {
 	}
 }
 
+func Test_configureComposeDeps(t *testing.T) {
+	before := new(engine.Spec)
+	before.Steps = []*engine.Step{
+		{Step: lespec.Step{Name: "clone"}},
+		{Step: lespec.Step{Name: "compose"}, DependsOn: []string{"clone"}},
+		{Step: lespec.Step{Name: "compose-logs"}, DependsOn: []string{"clone"}},
+		{Step: lespec.Step{Name: "backend"}, DependsOn: []string{"clone"}},
+		{Step: lespec.Step{Name: "deploy"}, DependsOn: []string{"backend"}},
+		{Step: lespec.Step{Name: "compose-down"}, DependsOn: []string{"clone"}},
+	}
+
+	after := new(engine.Spec)
+	after.Steps = []*engine.Step{
+		{Step: lespec.Step{Name: "clone"}},
+		{Step: lespec.Step{Name: "compose"}, DependsOn: []string{"clone"}},
+		{Step: lespec.Step{Name: "compose-logs"}, DependsOn: []string{"compose"}},
+		{Step: lespec.Step{Name: "backend"}, DependsOn: []string{"compose"}},
+		{Step: lespec.Step{Name: "deploy"}, DependsOn: []string{"backend"}},
+		{Step: lespec.Step{Name: "compose-down"}, DependsOn: []string{"clone", "compose", "compose-logs", "backend", "deploy"}},
+	}
+	configureComposeDeps(before)
+
+	opts := cmpopts.IgnoreUnexported(engine.Spec{})
+	if diff := cmp.Diff(before, after, opts); diff != "" {
+		t.Errorf("Unexpected compose dependency adjustment")
+		t.Log(diff)
+	}
+}
+
 func Test_removeCloneDeps(t *testing.T) {
 	before := new(engine.Spec)
 	before.Steps = []*engine.Step{
@@ -192,3 +276,81 @@ func Test_removeCloneDeps_CloneEnabled(t *testing.T) {
 		t.Log(diff)
 	}
 }
+
+func Test_stepWorkingDir(t *testing.T) {
+	tests := []struct {
+		os, dir, want string
+	}{
+		{os: "linux", dir: "", want: "/tmp/drone/src"},
+		{os: "linux", dir: "web", want: "/tmp/drone/src/web"},
+		{os: "linux", dir: "/opt/build", want: "/opt/build"},
+		{os: "windows", dir: "", want: `C:\drone\src`},
+		{os: "windows", dir: `C:\build`, want: `C:\build`},
+		{os: "windows", dir: "C:/build", want: `C:\build`},
+		{os: "windows", dir: "web", want: `C:\drone\src\web`},
+		{os: "windows", dir: "web/app", want: `C:\drone\src\web\app`},
+		{os: "windows", dir: `\\server\share`, want: `\\server\share`},
+	}
+	for _, test := range tests {
+		sourceDir := "/tmp/drone/src"
+		if test.os == "windows" {
+			sourceDir = `C:\drone\src`
+		}
+		if got := stepWorkingDir(test.os, sourceDir, test.dir); got != test.want {
+			t.Errorf("Want working dir %s for %s on %s, got %s", test.want, test.dir, test.os, got)
+		}
+	}
+}
+
+func Test_createDirectories_workspace(t *testing.T) {
+	tests := []struct {
+		os, root, workspace, path string
+		wantSource, wantMount     string
+	}{
+		{os: "linux", root: "/tmp", wantSource: "/tmp/drone/src"},
+		{os: "linux", root: "/tmp", path: "src/github.com/octocat", wantSource: "/tmp/drone/src/github.com/octocat"},
+		{os: "linux", root: "/tmp", workspace: "/mnt/nvme/drone", wantSource: "/mnt/nvme/drone/src", wantMount: "/mnt/nvme/drone"},
+		{os: "linux", root: "/tmp", workspace: "/mnt/nvme", path: "/build", wantSource: "/build", wantMount: "/build"},
+		{os: "linux", root: "/tmp", path: "/tmp/build", wantSource: "/tmp/build"},
+		{os: "windows", root: `C:\h`, workspace: `D:\`, wantSource: `D:\src`, wantMount: `D:\`},
+		{os: "windows", root: `C:\h`, workspace: "d:/drone", path: "app", wantSource: `d:\drone\app`, wantMount: `d:\drone`},
+		{os: "windows", root: `C:\h`, workspace: `c:\H\drone`, wantSource: `c:\H\drone\src`},
+	}
+	for _, test := range tests {
+		directories, _, workspaceDir, sourceDir := createDirectories(test.os, test.root, test.workspace, test.path)
+		if sourceDir != test.wantSource {
+			t.Errorf("Want source dir %s for workspace %q and path %q, got %s", test.wantSource, test.workspace, test.path, sourceDir)
+		}
+		created := false
+		for _, dir := range directories {
+			created = created || dir.Path == sourceDir
+		}
+		if !created {
+			t.Errorf("Want the source dir %s created", sourceDir)
+		}
+		if got := workspaceVolume(test.os, test.root, workspaceDir, sourceDir); got != test.wantMount {
+			t.Errorf("Want the workspace mount %q for workspace %q and path %q, got %q", test.wantMount, test.workspace, test.path, got)
+		}
+	}
+}
+
+func Test_composeCommand(t *testing.T) {
+	tests := []struct {
+		compose *resource.Compose
+		want    string
+	}{
+		{
+			compose: &resource.Compose{},
+			want:    "docker compose --file docker-compose.yml --project-name random up --detach --wait",
+		},
+		{
+			compose: &resource.Compose{File: "test/compose.yml"},
+			want:    "docker compose --file test/compose.yml --project-name random up --detach --wait",
+		},
+	}
+	for _, test := range tests {
+		if got := composeCommand(test.compose, "random", "up", "--detach", "--wait"); got != test.want {
+			t.Errorf("Want command %q, got %q", test.want, got)
+		}
+	}
+}
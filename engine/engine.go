@@ -12,15 +12,22 @@ import (
 	"sync"
 	"time"
 
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 
+	"github.com/drone-runners/drone-runner-aws/internal/admission"
+	"github.com/drone-runners/drone-runner-aws/internal/diagnostics"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/internal/snapshot"
+	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/logger"
 	"github.com/drone/runner-go/pipeline/runtime"
 	leapi "github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
 )
 
 var (
@@ -28,6 +35,40 @@ var (
 	ErrorPoolNotDefined = errors.New("pool not defined")
 )
 
+// InfraError is returned when a step could not run because of the
+// instance or lite-engine, as opposed to a step that ran and failed.
+// The runner reports it as the step error, so the server displays it
+// as an infrastructure error.
+type InfraError struct {
+	Op  string
+	Err error
+}
+
+func (e *InfraError) Error() string {
+	return fmt.Sprintf("infrastructure error: %s: %s", e.Op, e.Err)
+}
+
+func (e *InfraError) Unwrap() error {
+	return e.Err
+}
+
+// IsInfraError returns true if the error is an infrastructure error.
+func IsInfraError(err error) bool {
+	var infraErr *InfraError
+	return errors.As(err, &infraErr)
+}
+
+// infraError wraps the error in an InfraError. Cancellation is returned
+// as is, the runner checks for it to cancel the pipeline.
+func infraError(op string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &InfraError{Op: op, Err: err}
+}
+
+const killStepTimeout = 2 * time.Minute
+
 // Opts configures the Engine.
 type Opts struct {
 	Repopulate bool
@@ -38,21 +79,61 @@ type Engine struct {
 	opts        Opts
 	poolManager *drivers.Manager
 	config      *config.EnvConfig
+	signer      *lehelper.Signer  // signs the scripts of host steps, if set
+	diagnostics diagnostics.Store // archives the diagnostics of instances failing with an infrastructure error, if set
+	admission   *admission.Client // evaluates the admission policies before the setup, if set
+	snapshots   *snapshot.Store   // hands the workspaces over between stages, if set
+	services    sync.Map          // service step id to *serviceGate
+	failed      sync.Map          // *Spec of the stages a step failed
+}
+
+// serviceGate records the health check of a service, which runs once
+// for all steps waiting for the service.
+type serviceGate struct {
+	once sync.Once
+	err  error
 }
 
 // New returns a new engine.
 func New(opts Opts, poolManager *drivers.Manager, envConfig *config.EnvConfig) (*Engine, error) {
+	signer, err := lehelper.LoadSigner(envConfig.Runner.ScriptSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	store, err := diagnostics.Open(envConfig)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := snapshot.Open(envConfig)
+	if err != nil {
+		return nil, err
+	}
 	return &Engine{
 		opts:        opts,
 		poolManager: poolManager,
 		config:      envConfig,
+		signer:      signer,
+		diagnostics: store,
+		admission:   admission.Open(envConfig),
+		snapshots:   snapshots,
 	}, nil
 }
 
 // Setup the pipeline environment.
 func (e *Engine) Setup(ctx context.Context, specv runtime.Spec) error {
 	spec := specv.(*Spec)
+	// the initialize step sets up the instance, with its own output.
+	if spec.hasStep(SyntheticInitialize) {
+		return nil
+	}
+	err := e.setup(ctx, spec, io.Discard)
+	e.diagnose(ctx, spec, err)
+	return err
+}
 
+// setup claims and sets up the instance of the stage, writing the
+// progress to the output.
+func (e *Engine) setup(ctx context.Context, spec *Spec, output io.Writer) error {
 	poolName := spec.CloudInstance.PoolName
 	manager := e.poolManager
 
@@ -65,21 +146,75 @@ func (e *Engine) Setup(ctx context.Context, specv runtime.Spec) error {
 		return ErrorPoolNameEmpty
 	}
 
-	// lets see if there is anything in the pool
-	instance, err := manager.Provision(ctx, poolName, e.config.Runner.Name, e.config.Runner.Name, "drone", "", e.config, nil)
+	scope := &audit.Scope{Pool: poolName, Stage: spec.Name}
+	ctx = audit.WithScope(ctx, scope)
+
+	if err := e.admission.Admit(ctx, spec.Admission); err != nil {
+		logr.WithError(err).Warnln("the stage is not admitted")
+		audit.Record(ctx, &audit.Event{Action: audit.ActionStageDeny, Error: err.Error()})
+		fmt.Fprintln(output, err)
+		return err
+	}
+
+	provisioning := spec.Provisioning
+	if provisioning == nil {
+		provisioning = &Provisioning{}
+	}
+	if provisioning.Accepted.IsZero() {
+		provisioning.Accepted = time.Now()
+	}
+
+	// untrusted pipelines do not run on the platforms without the firewall.
+	platform, _, _ := manager.Inspect(poolName)
+	blockMetadata, err := lehelper.MustBlockMetadata(platform.OS, manager.InspectSettings(poolName).Untrusted, spec.Untrusted)
 	if err != nil {
-		logr.WithError(err).Errorln("failed to provision an instance")
+		logr.WithError(err).Errorln("cannot run the untrusted stage on the pool")
+		fmt.Fprintf(output, "cannot run the untrusted stage on pool %s: %s\n", poolName, err)
 		return err
 	}
 
+	// the instance kept by the stage the pipeline depends on has its workspace.
+	var instance *types.Instance
+	if spec.Reuse != "" {
+		instance, err = manager.Reclaim(ctx, poolName, e.config.Runner.Name, spec.Reuse, "drone")
+		if err != nil {
+			logr.WithError(err).Warnln("failed to reclaim the kept instance, claiming another")
+		}
+	}
+	reused := instance != nil
+
+	if reused {
+		fmt.Fprintf(output, "Reusing instance %s\n", instance.ID)
+	} else {
+		// lets see if there is anything in the pool
+		fmt.Fprintf(output, "Claiming an instance of pool %s\n", poolName)
+		instance, err = manager.Provision(drivers.WithClaimTiming(ctx, &provisioning.Claim),
+			poolName, e.config.Runner.Name, e.config.Runner.Name, "drone", "", e.config, nil)
+		if err != nil {
+			logr.WithError(err).Errorln("failed to provision an instance")
+			return infraError("failed to provision an instance", err)
+		}
+	}
+
+	// the instance is destroyed with the spec if the setup fails.
+	spec.CloudInstance.ID = instance.ID
+
+	if !reused {
+		fmt.Fprintf(output, "Claimed instance %s\n", instance.ID)
+	}
+
 	if instance.IsHibernated {
+		fmt.Fprintln(output, "Resuming the instance from hibernation")
+		resumed := time.Now()
 		instance, err = manager.StartInstance(ctx, poolName, instance.ID)
 		if err != nil {
 			logr.WithError(err).Errorln("failed to start an instance")
-			return err
+			return infraError("failed to start an instance", err)
 		}
+		provisioning.Resume = time.Since(resumed)
 	}
 
+	scope.Instance = instance.ID
 	logr = logr.
 		WithField("ip", instance.Address).
 		WithField("id", instance.ID)
@@ -93,16 +228,24 @@ func (e *Engine) Setup(ctx context.Context, specv runtime.Spec) error {
 		return ErrorPoolNotDefined
 	}
 
+	// the reconciler terminates the instances claimed without a stage.
+	drivers.TagStage(instance, spec.Name)
 	err = manager.Update(ctx, instance)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to update instance")
-		return err
+		return infraError("failed to update instance", err)
+	}
+
+	err = manager.SetInstanceTags(ctx, poolName, instance, spec.CloudInstance.Tags)
+	if err != nil {
+		logr.WithError(err).Errorln("failed to add tags to the instance")
+		return infraError("failed to add tags to the instance", err)
 	}
 	// required for anka build where the port is dynamic
 	client, err := lehelper.GetClient(instance, e.config.Runner.Name, instance.Port, e.config.LiteEngine.EnableMock, e.config.LiteEngine.MockStepTimeoutSecs)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to create LE client")
-		return err
+		return infraError("failed to create lite-engine client", err)
 	}
 
 	const timeoutSetup = 20 * time.Minute // TODO: Move to configuration
@@ -111,11 +254,26 @@ func (e *Engine) Setup(ctx context.Context, specv runtime.Spec) error {
 	logr.Traceln("running healthcheck and waiting for an ok response")
 	performDNSLookup := drivers.ShouldPerformDNSLookup(ctx, instance.Platform.OS)
 
+	fmt.Fprintf(output, "Waiting for the lite-engine on %s\n", instance.Address)
+	healthStarted := time.Now()
 	healthResponse, err := client.RetryHealth(ctx, timeoutSetup, performDNSLookup)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to call LE.RetryHealth")
-		return err
+		// the console output, and the serial console of amazon pools, show why the instance is unreachable.
+		if out, logErr := manager.InstanceLogs(ctx, poolName, instance.ID); logErr != nil {
+			logr.WithError(logErr).Warnln("failed to fetch the console output")
+		} else {
+			const maxConsoleOutput = 60000
+			if len(out) > maxConsoleOutput {
+				out = out[len(out)-maxConsoleOutput:]
+			}
+			logr.Infof("console output: %s", out)
+		}
+		return infraError("lite-engine is not healthy", err)
 	}
+	setupStarted := time.Now()
+	provisioning.Health = setupStarted.Sub(healthStarted)
+	fmt.Fprintln(output, "Setting up the instance")
 
 	logr.WithField("response", fmt.Sprintf("%+v", healthResponse)).
 		Traceln("LE.RetryHealth check complete")
@@ -135,26 +293,81 @@ func (e *Engine) Setup(ctx context.Context, specv runtime.Spec) error {
 		setupRequest.MountDockerSocket = &b
 	}
 
+	settings := manager.InspectSettings(poolName)
+	lehelper.PrepareSetup(setupRequest, instance.Platform.OS, settings)
+
 	logr.WithField("request", fmt.Sprintf("%+v", setupRequest)).Traceln("Calling LE.Setup")
+	// the files of the pipeline, the netrc and the scripts, are created by the setup.
+	if size := settings.TmpfsSize; size != "" && !reused {
+		_, rootDir, _ := manager.Inspect(poolName)
+		if err = lehelper.MountTmpfs(ctx, client, instance.Platform.OS, size,
+			oshelp.JoinPaths(instance.Platform.OS, rootDir, "opt"),
+			oshelp.JoinPaths(instance.Platform.OS, rootDir, "home")); err != nil {
+			logr.WithError(err).Errorln("failed to mount the tmpfs")
+			return infraError("failed to mount the tmpfs", err)
+		}
+	}
+
 	setupResponse, err := client.Setup(ctx, setupRequest)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to call LE.Setup")
-		return err
+		return infraError("failed to setup lite-engine", err)
 	}
 
 	logr.WithField("response", fmt.Sprintf("%+v", setupResponse)).
 		Traceln("LE.Setup complete")
 
+	// the reused instance has the workspace of the stage it was kept by.
+	if spec.Restore != "" && !reused {
+		fmt.Fprintln(output, "Restoring the workspace snapshot")
+		if err = e.restoreSnapshot(ctx, client, instance, spec); err != nil {
+			logr.WithError(err).Errorln("failed to restore the workspace snapshot")
+			return infraError("failed to restore the workspace snapshot", err)
+		}
+	}
+
+	// the reused instance was configured by the setup of the stage it was kept by.
+	if reused {
+		provisioning.Setup = time.Since(setupStarted)
+		provisioning.Total = time.Since(provisioning.Accepted)
+		return nil
+	}
+
+	if err = lehelper.ConfigureHost(ctx, client, instance.Platform.OS, &lehelper.HostConfig{
+		Settings:      settings,
+		Signer:        e.signer,
+		BlockMetadata: blockMetadata,
+		FIPS:          fips.Enabled(),
+		MaxClockSkew:  time.Duration(e.config.Runner.MaxClockSkewSecs) * time.Second,
+	}, logr); err != nil {
+		logr.WithError(err).Errorln("failed to configure the instance")
+		return infraError("failed to configure the instance", err)
+	}
+
+	provisioning.Setup = time.Since(setupStarted)
+	provisioning.Total = time.Since(provisioning.Accepted)
 	return nil
 }
 
 // Destroy the pipeline environment.
 func (e *Engine) Destroy(ctx context.Context, specv runtime.Spec) error {
+	spec := specv.(*Spec)
+	for _, step := range spec.Steps {
+		e.services.Delete(step.ID)
+	}
+	defer e.failed.Delete(spec)
+	// the cleanup step destroyed the instance, or none was claimed.
+	if spec.CloudInstance.ID == "" {
+		return nil
+	}
+	return e.destroy(ctx, spec)
+}
+
+// destroy destroys the instance of the stage.
+func (e *Engine) destroy(ctx context.Context, spec *Spec) error {
 	const destroyTimeout = time.Second * 5 // HACK: this timeout delays deleting the instance to ensure there is enough time to stream the logs.
 	time.Sleep(destroyTimeout)
 
-	spec := specv.(*Spec)
-
 	poolName := spec.CloudInstance.PoolName
 	poolMngr := e.poolManager
 
@@ -167,6 +380,22 @@ func (e *Engine) Destroy(ctx context.Context, specv runtime.Spec) error {
 		WithField("id", instanceID).
 		WithField("ip", instanceIP)
 
+	if spec.Snapshot != "" {
+		e.saveSnapshot(ctx, spec)
+	}
+
+	// the instance is kept, with its workspace, for the stage reusing it.
+	// The reusing stage does not run if the stage failed.
+	if spec.Keep != "" && e.succeeded(spec) {
+		logr.Infof("keeping instance %s", instanceID)
+		if err := poolMngr.Keep(ctx, poolName, instanceID, spec.Keep); err != nil {
+			logr.WithError(err).Errorln("cannot keep the instance, destroying it")
+		} else {
+			spec.CloudInstance.ID = ""
+			return nil
+		}
+	}
+
 	logr.Infof("destroying instance %s", instanceID)
 
 	if err := poolMngr.Destroy(ctx, poolName, instanceID); err != nil {
@@ -174,14 +403,73 @@ func (e *Engine) Destroy(ctx context.Context, specv runtime.Spec) error {
 		return err
 	}
 	logr.Traceln("destroyed instance")
+	spec.CloudInstance.ID = ""
 
 	return nil
 }
 
+// initialize runs the initialize step, setting up the instance.
+func (e *Engine) initialize(ctx context.Context, spec *Spec, output io.Writer) (*runtime.State, error) {
+	if err := e.setup(ctx, spec, output); err != nil {
+		fmt.Fprintln(output, err)
+		return nil, err
+	}
+	if spec.Provisioning != nil {
+		fmt.Fprintf(output, "\n%s", spec.Provisioning.report(spec.CloudInstance.PoolName, spec.CloudInstance.ID))
+	}
+	return &runtime.State{ExitCode: 0, Exited: true}, nil
+}
+
+// cleanup runs the cleanup step, destroying the instance. If it fails,
+// the instance is destroyed again with the pipeline environment.
+func (e *Engine) cleanup(ctx context.Context, spec *Spec, output io.Writer) (*runtime.State, error) {
+	instanceID := spec.CloudInstance.ID
+	if instanceID == "" {
+		fmt.Fprintln(output, "No instance to destroy")
+		return &runtime.State{ExitCode: 0, Exited: true}, nil
+	}
+	if spec.Snapshot != "" {
+		fmt.Fprintln(output, "Saving the workspace snapshot")
+	}
+	if spec.Keep != "" && e.succeeded(spec) {
+		fmt.Fprintf(output, "Keeping instance %s for the stage reusing it\n", instanceID)
+	} else {
+		fmt.Fprintf(output, "Destroying instance %s\n", instanceID)
+	}
+	started := time.Now()
+	if err := e.destroy(ctx, spec); err != nil {
+		fmt.Fprintf(output, "Failed to destroy the instance: %s\n", err)
+		return nil, err
+	}
+	fmt.Fprintf(output, "Released the instance in %s\n", round(time.Since(started)))
+	return &runtime.State{ExitCode: 0, Exited: true}, nil
+}
+
+// stepFailed reports whether the step failed the stage, the failures of
+// the steps whose errors are ignored do not.
+func stepFailed(step *Step, state *runtime.State, err error) bool {
+	if err != nil {
+		return true
+	}
+	return state != nil && state.ExitCode != 0 && step.ErrPolicy != runtime.ErrIgnore
+}
+
+// succeeded reports whether no step failed the stage.
+func (e *Engine) succeeded(spec *Spec) bool {
+	_, failed := e.failed.Load(spec)
+	return !failed
+}
+
 // Run runs the pipeline step.
-func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step, output io.Writer) (*runtime.State, error) {
+func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step, output io.Writer) (state *runtime.State, err error) {
 	spec := specv.(*Spec)
 	step := stepv.(*Step)
+	defer func() {
+		e.diagnose(ctx, spec, err)
+		if step.Synthetic == "" && stepFailed(step, state, err) {
+			e.failed.Store(spec, true)
+		}
+	}()
 
 	poolName := spec.CloudInstance.PoolName
 	instanceID := spec.CloudInstance.ID
@@ -194,18 +482,54 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 		WithField("id", instanceID).
 		WithField("ip", instanceIP)
 
+	switch step.Synthetic {
+	case SyntheticInitialize:
+		return e.initialize(ctx, spec, output)
+	case SyntheticCleanup:
+		return e.cleanup(ctx, spec, output)
+	}
+
+	// a failed initialize step leaves no instance to the steps running
+	// on failure.
+	if instanceID == "" {
+		fmt.Fprintln(output, "The instance of the stage was not set up, the step cannot run")
+		return &runtime.State{ExitCode: 1, Exited: true}, nil
+	}
+
 	instance, err := e.poolManager.Find(ctx, instanceID)
 	if err != nil {
 		logr.WithError(err).Errorln("cannot find instance")
-		return nil, err
+		return nil, infraError("cannot find instance", err)
 	}
 	client, err := lehelper.GetClient(instance, e.config.Runner.Name, instance.Port, e.config.LiteEngine.EnableMock, e.config.LiteEngine.MockStepTimeoutSecs)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to create LE client")
-		return nil, err
+		return nil, infraError("failed to create lite-engine client", err)
+	}
+
+	// the steps running on failure, e.g. notifications, run even if a
+	// service is not healthy, the failure they report.
+	if !step.Detach {
+		if err = e.waitServices(ctx, client, instance.Platform.OS, spec, output); err != nil {
+			logr.WithError(err).Warnln("service is not healthy")
+			fmt.Fprintf(output, "%s\n", err)
+			if step.RunPolicy != runtime.RunOnFailure && step.RunPolicy != runtime.RunAlways {
+				return &runtime.State{ExitCode: 1, Exited: true}, nil
+			}
+		}
 	}
 
-	const timeoutStep = 4 * time.Hour // TODO: Move to configuration
+	timeoutStep := 4 * time.Hour // TODO: Move to configuration
+	if !spec.Deadline.IsZero() {
+		remaining := time.Until(spec.Deadline).Round(time.Second)
+		if remaining <= 0 {
+			fmt.Fprintln(output, "the stage exceeded the timeout of untrusted repositories")
+			return &runtime.State{ExitCode: 1, Exited: true}, nil
+		}
+		if remaining < timeoutStep {
+			timeoutStep = remaining
+		}
+	}
 
 	secretEnvs := make(map[string]string, len(step.Secrets))
 	for _, secret := range step.Secrets {
@@ -257,14 +581,31 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 		WorkingDir: step.WorkingDir,
 	}
 
+	// the step fails with a clear message instead of the error of the operating system.
+	if step.CheckWorkingDir {
+		exists, err := lehelper.DirExists(ctx, client, instance.Platform.OS, step.WorkingDir)
+		if err != nil {
+			logr.WithError(err).Errorln("failed to check the working directory")
+			return nil, infraError("failed to check the working directory", err)
+		}
+		if !exists {
+			fmt.Fprintf(output, "working directory not found: %s\n", step.WorkingDir)
+			return &runtime.State{ExitCode: 1, Exited: true}, nil
+		}
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 
 	go func(ctx context.Context) {
 		var totalWritten counterWriter
-		w := io.MultiWriter(output, &totalWritten)
+		capped := newStepLogWriter(output, e.config.LiveLog.StepLimit, e.config.LiveLog.StepTailLines)
+		w := io.MultiWriter(capped, &totalWritten)
 
 		defer func() {
+			if flushErr := capped.Flush(); flushErr != nil {
+				logr.WithError(flushErr).Warnln("failed to write the tail of the truncated step output")
+			}
 			wg.Done()
 			logr.WithField("len", int(totalWritten)).Traceln("finished streaming step output")
 		}()
@@ -287,19 +628,41 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 		b := false
 		req.MountDockerSocket = &b
 	}
+	// record the pid of host steps, so they can be terminated when the pipeline is canceled.
+	tracked := false
+	if step.Image == "" {
+		req.Run.Command = lehelper.SignCommand(instance.Platform.OS, e.signer, req.Run.Entrypoint, req.Run.Command, req.Files)
+		req.Run.Command = lehelper.LimitCommand(instance.Platform.OS, req.Run.Entrypoint, req.Run.Command,
+			step.CPUQuota, step.CPUPeriod, step.MemLimit)
+		req.Run.Command, tracked = lehelper.TrackCommand(instance.Platform.OS, req.ID, req.Run.Entrypoint, req.Run.Command)
+	}
+	started := time.Now()
 	startStepResponse, err := client.StartStep(ctx, req)
+	event := audit.StepEvent(req, err)
+	event.Pool, event.Instance = poolName, instanceID
+	audit.Record(ctx, event)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to start step")
-		return nil, err
+		return nil, infraError("failed to start step", err)
 	}
 
 	logr.WithField("startStepResponse", startStepResponse).
 		Traceln("LE.StartStep complete")
 
-	pollResponse, err := client.RetryPollStep(ctx, &leapi.PollStepRequest{ID: req.ID}, timeoutStep)
+	pollResponse, err := lehelper.PollStep(ctx, client, req.ID, timeoutStep,
+		time.Duration(e.config.LiteEngine.HeartbeatSecs)*time.Second,
+		time.Duration(e.config.LiteEngine.MaxUnreachableSecs)*time.Second)
 	if err != nil {
+		if tracked && ctx.Err() != nil {
+			// the step keeps running on the instance when the pipeline is canceled.
+			killCtx, cancel := context.WithTimeout(context.Background(), killStepTimeout)
+			if killErr := lehelper.KillStep(killCtx, client, instance.Platform.OS, req.ID); killErr != nil {
+				logr.WithError(killErr).Warnln("failed to terminate the canceled step")
+			}
+			cancel()
+		}
 		logr.WithError(err).Errorln("failed to poll step result")
-		return nil, err
+		return nil, infraError("failed to poll step result", err)
 	}
 
 	logr.WithField("pollResponse", pollResponse).
@@ -307,7 +670,14 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 
 	wg.Wait()
 
-	state := &runtime.State{
+	events, oomErr := lehelper.CheckOOM(ctx, client, instance.Platform.OS, started, pollResponse, e.config.Runner.DetectOOM)
+	if oomErr != nil {
+		logr.WithError(oomErr).Warnln("failed to look for OOM killer events")
+	} else if events != "" {
+		fmt.Fprintf(output, "\nthe instance ran out of memory while the step was running, consider a larger instance type:\n%s\n", events)
+	}
+
+	state = &runtime.State{
 		ExitCode:  pollResponse.ExitCode,
 		Exited:    pollResponse.Exited,
 		OOMKilled: pollResponse.OOMKilled,
@@ -316,6 +686,59 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 	return state, nil
 }
 
+// diagnose collects the diagnostics bundle of the instance of the stage,
+// once, if the error is an infrastructure error. The instance is
+// destroyed with the pipeline environment, after the bundle is saved.
+func (e *Engine) diagnose(ctx context.Context, spec *Spec, err error) {
+	if e.diagnostics == nil || !IsInfraError(err) || spec.CloudInstance.ID == "" || spec.Diagnostics != "" {
+		return
+	}
+	const diagnoseTimeout = 3 * time.Minute
+
+	logr := logger.FromContext(ctx).
+		WithField("pool", spec.CloudInstance.PoolName).
+		WithField("id", spec.CloudInstance.ID)
+	instance, err := e.poolManager.Find(ctx, spec.CloudInstance.ID)
+	if err != nil {
+		logr.WithError(err).Warnln("failed to find the instance to collect its diagnostics")
+		return
+	}
+	client, err := lehelper.GetClient(instance, e.config.Runner.Name, instance.Port, e.config.LiteEngine.EnableMock, e.config.LiteEngine.MockStepTimeoutSecs)
+	if err != nil {
+		logr.WithError(err).Warnln("failed to create LE client to collect the diagnostics")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, diagnoseTimeout)
+	defer cancel()
+	location, err := diagnostics.Collect(ctx, e.diagnostics, client, instance)
+	if err != nil {
+		logr.WithError(err).Warnln("failed to collect the diagnostics of the instance")
+		return
+	}
+	spec.Diagnostics = location
+	logr.WithField("bundle", location).Infoln("collected the diagnostics of the instance")
+}
+
+// waitServices waits until the services of the pipeline with a health
+// check are healthy. Services skipped by their conditions are ignored.
+func (e *Engine) waitServices(ctx context.Context, client lehttp.Client, platformOS string, spec *Spec, output io.Writer) error {
+	for _, step := range spec.Steps {
+		if !step.Detach || step.Health == nil || step.RunPolicy == runtime.RunNever {
+			continue
+		}
+		v, _ := e.services.LoadOrStore(step.ID, new(serviceGate))
+		gate := v.(*serviceGate)
+		gate.once.Do(func() {
+			fmt.Fprintf(output, "waiting for service %s to be healthy\n", step.Name)
+			gate.err = lehelper.WaitService(ctx, client, platformOS, step.ID, step.Health)
+		})
+		if gate.err != nil {
+			return fmt.Errorf("service %s is not healthy: %w", step.Name, gate.err)
+		}
+	}
+	return nil
+}
+
 type counterWriter int
 
 func (q *counterWriter) Write(data []byte) (int, error) {
@@ -0,0 +1,134 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone/runner-go/pipeline/runtime"
+)
+
+func TestInfraError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("step: %w", infraError("failed to start step", cause))
+	if !IsInfraError(err) {
+		t.Errorf("Want infrastructure error")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("Want the cause unwrapped")
+	}
+	if got, want := infraError("failed to start step", cause).Error(), "infrastructure error: failed to start step: connection refused"; got != want {
+		t.Errorf("Want message %q, got %q", want, got)
+	}
+	if IsInfraError(cause) {
+		t.Errorf("Want plain errors not reported as infrastructure errors")
+	}
+}
+
+func TestInfraError_Canceled(t *testing.T) {
+	if err := infraError("failed to poll step result", context.Canceled); err != context.Canceled { //nolint:errorlint
+		t.Errorf("Want cancellation returned as is, the runner compares it directly")
+	}
+}
+
+func TestProvisioningReport(t *testing.T) {
+	p := &Provisioning{
+		Queued: 72 * time.Second,
+		Claim:  drivers.ClaimTiming{Lock: 100 * time.Millisecond, Store: 230 * time.Millisecond, Total: 330 * time.Millisecond},
+		Health: 45 * time.Second,
+		Setup:  2 * time.Second,
+		Total:  47330 * time.Millisecond,
+	}
+	want := "Queued for 1m12s before the runner accepted the stage\n" +
+		"Claimed instance i-1 of pool ubuntu in 300ms (lock 100ms, store 200ms, create 0s)\n" +
+		"Lite-engine responded in 45s\n" +
+		"Set up the instance in 2s\n" +
+		"Waited 47.3s for the instance\n"
+	if got := p.report("ubuntu", "i-1"); got != want {
+		t.Errorf("Want report %q, got %q", want, got)
+	}
+}
+
+func TestDestroy_Destroyed(t *testing.T) {
+	e := &Engine{}
+	spec := &Spec{Steps: []*Step{{Synthetic: SyntheticCleanup}}}
+	var output strings.Builder
+	state, err := e.cleanup(context.Background(), spec, &output)
+	if err != nil || state.ExitCode != 0 || output.String() != "No instance to destroy\n" {
+		t.Errorf("Want the cleanup step to succeed without an instance, got %v %v %q", state, err, output.String())
+	}
+	if err = e.Destroy(context.Background(), spec); err != nil {
+		t.Errorf("Want the destroyed instance not destroyed again, got %v", err)
+	}
+}
+
+func TestRun_NoInstance(t *testing.T) {
+	e := &Engine{}
+	spec := &Spec{CloudInstance: CloudInstance{PoolName: "linux"}}
+	var output strings.Builder
+	state, err := e.Run(context.Background(), spec, &Step{RunPolicy: runtime.RunOnFailure}, &output)
+	if err != nil || state == nil || state.ExitCode != 1 {
+		t.Errorf("Want the step failed without an instance, got %v %v", state, err)
+	}
+	if !strings.Contains(output.String(), "not set up") {
+		t.Errorf("Want the step output to explain the failure, got %q", output.String())
+	}
+}
+
+func TestRun_Failed(t *testing.T) {
+	e := &Engine{}
+	var output strings.Builder
+	spec := &Spec{CloudInstance: CloudInstance{PoolName: "linux"}}
+	if _, err := e.Run(context.Background(), spec, &Step{ErrPolicy: runtime.ErrIgnore}, &output); err != nil {
+		t.Fatal(err)
+	}
+	if !e.succeeded(spec) {
+		t.Errorf("Want the ignored failure not to fail the stage")
+	}
+	if _, err := e.Run(context.Background(), spec, &Step{}, &output); err != nil {
+		t.Fatal(err)
+	}
+	if e.succeeded(spec) {
+		t.Errorf("Want the failed step to fail the stage, the instance is not kept")
+	}
+}
+
+func TestStepLogWriter(t *testing.T) {
+	var out strings.Builder
+	w := newStepLogWriter(&out, 10, 2)
+	for _, chunk := range []string{"one\n", "two\nthree\n", "four\nfive\nsix"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "one\ntwo\n" +
+		"\n... (the output of the step exceeded 10 bytes, it is truncated until the step ends)\n" +
+		"... (11 bytes truncated, the last 2 lines of the step follow)\n" +
+		"five\nsix\n"
+	if got := out.String(); got != want {
+		t.Errorf("want the output\n%q\ngot\n%q", want, got)
+	}
+}
+
+func TestStepLogWriter_Unlimited(t *testing.T) {
+	var out strings.Builder
+	w := newStepLogWriter(&out, 0, 2)
+	w.Write([]byte("one\ntwo\nthree\n")) //nolint:errcheck
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "one\ntwo\nthree\n" {
+		t.Errorf("want the output as is, got %q", got)
+	}
+}
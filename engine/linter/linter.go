@@ -13,6 +13,7 @@ import (
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
 )
@@ -27,6 +28,8 @@ var ErrDuplicateStepName = errors.New("linter: duplicate step names")
 type Linter struct {
 	PoolManager    *drivers.Manager
 	EnableAutoPool bool
+	Privileges     *resource.Privileges
+	Policy         *resource.Policy
 }
 
 // New returns a new Linter.
@@ -37,21 +40,60 @@ func New(enableAutoPool bool) *Linter {
 }
 
 // Lint executes the linting rules for the pipeline configuration.
-func (l *Linter) Lint(pipeline manifest.Resource, _ *drone.Repo) error {
+func (l *Linter) Lint(pipeline manifest.Resource, repo *drone.Repo) error {
 	if err := checkPipeline(pipeline.(*resource.Pipeline)); err != nil {
 		return err
 	}
-	return checkPools(pipeline.(*resource.Pipeline), l.PoolManager, l.EnableAutoPool)
+	if err := checkPrivileges(pipeline.(*resource.Pipeline), l.Privileges); err != nil {
+		return err
+	}
+	if err := checkPools(pipeline.(*resource.Pipeline), l.PoolManager, l.EnableAutoPool); err != nil {
+		return err
+	}
+	if l.Policy.Untrusted(repo) {
+		return checkPolicy(pipeline.(*resource.Pipeline), l.PoolManager, l.Policy)
+	}
+	return nil
 }
 
 func checkPipeline(pipeline *resource.Pipeline) error {
 	if err := checkSteps(pipeline); err != nil {
 		return err
 	}
+	if err := checkCompose(pipeline); err != nil {
+		return err
+	}
+	if err := checkReuse(pipeline); err != nil {
+		return err
+	}
 	err := checkVolumes(pipeline)
 	return err
 }
 
+// checkReuse returns an error if the pipeline reuses the instance, or
+// restores the workspace, of a stage it does not depend on.
+func checkReuse(pipeline *resource.Pipeline) error {
+	if err := checkDependsOn(pipeline, pipeline.Pool.Reuse, "reuses the instance of"); err != nil {
+		return err
+	}
+	return checkDependsOn(pipeline, pipeline.Workspace.Restore, "restores the workspace of")
+}
+
+func checkDependsOn(pipeline *resource.Pipeline, stage, what string) error {
+	if stage == "" {
+		return nil
+	}
+	if stage == pipeline.Name {
+		return fmt.Errorf("linter: the pipeline %s itself", what)
+	}
+	for _, dep := range pipeline.Deps {
+		if dep == stage {
+			return nil
+		}
+	}
+	return fmt.Errorf("linter: the pipeline %s %s, it must depend on it", what, stage)
+}
+
 func checkPools(pipeline *resource.Pipeline, poolManager *drivers.Manager, enableAutoPool bool) error {
 	if poolManager.Count() == 0 {
 		return fmt.Errorf("linter: there are no pools defined")
@@ -91,6 +133,11 @@ func checkSteps(pipeline *resource.Pipeline) error {
 	if !pipeline.Clone.Disable {
 		names["clone"] = struct{}{}
 	}
+	if pipeline.Compose != nil {
+		names["compose"] = struct{}{}
+		names["compose-logs"] = struct{}{}
+		names["compose-down"] = struct{}{}
+	}
 
 	for _, step := range steps {
 		if step == nil {
@@ -107,10 +154,47 @@ func checkSteps(pipeline *resource.Pipeline) error {
 		if err := checkStep(step); err != nil {
 			return err
 		}
+		if err := checkShell(pipeline.Platform.OS, step); err != nil {
+			return err
+		}
+		if err := checkResources(pipeline.Platform.OS, step); err != nil {
+			return err
+		}
 		if err := checkDeps(step, names); err != nil {
 			return err
 		}
 	}
+	for _, step := range pipeline.Steps {
+		if step != nil && step.Health != nil && !step.Detach {
+			return fmt.Errorf("linter: health check in step %s, only services and detached steps support it", step.Name)
+		}
+	}
+	for _, step := range steps {
+		if err := checkHealth(pipeline.Platform.OS, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkHealth(pipelineOS string, step *resource.Step) error {
+	if step.Health == nil {
+		return nil
+	}
+	if step.Image == "" {
+		return fmt.Errorf("linter: health check in step %s, only steps that use an image support it", step.Name)
+	}
+	if pipelineOS == oshelp.OSMac {
+		return fmt.Errorf("linter: health check in step %s, %s pipelines do not support it", step.Name, oshelp.OSMac)
+	}
+	if len(step.Health.Ports) == 0 && step.Health.Test == "" {
+		return fmt.Errorf("linter: health check in step %s has neither ports nor a test", step.Name)
+	}
+	for _, port := range step.Health.Ports {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("linter: invalid health check port %d in step %s", port, step.Name)
+		}
+	}
 	return nil
 }
 
@@ -128,6 +212,93 @@ func checkStep(step *resource.Step) error {
 	return nil
 }
 
+func checkShell(pipelineOS string, step *resource.Step) error {
+	if step.Shell == "" || pipelineOS != oshelp.OSWindows {
+		return nil
+	}
+	switch step.Shell {
+	case oshelp.ShellCmd, oshelp.ShellPowershell:
+		return nil
+	default:
+		return fmt.Errorf("linter: unsupported shell %s in step %s, windows steps support cmd and powershell", step.Shell, step.Name)
+	}
+}
+
+func checkCompose(pipeline *resource.Pipeline) error {
+	if pipeline.Compose == nil {
+		return nil
+	}
+	if pipeline.Platform.OS == oshelp.OSMac {
+		return fmt.Errorf("linter: docker compose is not supported on %s", oshelp.OSMac)
+	}
+	if strings.ContainsAny(pipeline.Compose.File, " \t\n'\"$`;&|<>") {
+		return fmt.Errorf("linter: invalid docker compose file: %s", pipeline.Compose.File)
+	}
+	for _, r := range pipeline.Compose.Project {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+			return fmt.Errorf("linter: invalid docker compose project: %s, has to be lowercase letters, digits, dashes and underscores", pipeline.Compose.Project)
+		}
+	}
+	return nil
+}
+
+func checkPrivileges(pipeline *resource.Pipeline, privileges *resource.Privileges) error {
+	devices := map[string]string{}
+	for _, volume := range pipeline.Volumes {
+		if volume.HostPath != nil {
+			devices[volume.Name] = volume.HostPath.Path
+		}
+	}
+	for _, step := range append(pipeline.Services, pipeline.Steps...) { //nolint:gocritic // creating a new slice is ok
+		if step.Image == "" {
+			continue
+		}
+		if privileges.IsPrivileged(step) && !privileges.AllowsImage(step.Image) {
+			return fmt.Errorf("linter: image %s of step %s is not allowed to run privileged", step.Image, step.Name)
+		}
+		for _, capability := range step.CapAdd {
+			if !privileges.AllowsCapability(capability) {
+				return fmt.Errorf("linter: capability %s of step %s is not allowed", capability, step.Name)
+			}
+		}
+		for _, device := range step.Devices {
+			if path, ok := devices[device.Name]; ok && !privileges.AllowsDevice(path) {
+				return fmt.Errorf("linter: device %s of step %s is not allowed", path, step.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkPolicy returns an error if the pipeline of an untrusted repository
+// overrides a setting the policy denies, or no pool of the policy runs it.
+func checkPolicy(pipeline *resource.Pipeline, poolManager *drivers.Manager, policy *resource.Policy) error {
+	if err := policy.Check(pipeline); err != nil {
+		return fmt.Errorf("linter: %w", err)
+	}
+	platformOf := func(pool string) types.Platform {
+		platform, _, _ := poolManager.Inspect(pool)
+		return platform
+	}
+	if _, err := policy.PoolFor(pipeline.Pool.Use, pipeline.Platform, platformOf); err != nil {
+		return fmt.Errorf("linter: %w", err)
+	}
+	return nil
+}
+
+func checkResources(pipelineOS string, step *resource.Step) error {
+	if step.Resources == nil {
+		return nil
+	}
+	if step.Resources.Limits.CPU < 0 || step.Resources.Limits.Memory < 0 {
+		return fmt.Errorf("linter: invalid resource limits in step %s", step.Name)
+	}
+	if step.Image == "" && pipelineOS != "" && pipelineOS != oshelp.OSLinux {
+		return fmt.Errorf("linter: resource limits in step %s, %s host steps do not support them", step.Name, pipelineOS)
+	}
+	return nil
+}
+
 func checkVolumes(pipeline *resource.Pipeline) error {
 	for _, volume := range pipeline.Volumes {
 		switch volume.Name {
@@ -28,6 +28,36 @@ func TestLint(t *testing.T) {
 			trusted: false,
 			invalid: false,
 		},
+		{
+			path:    "testdata/windows_shell.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: unsupported shell bash in step test, windows steps support cmd and powershell",
+		},
+		{
+			path:    "testdata/service_health.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: health check in step test, only services and detached steps support it",
+		},
+		{
+			path:    "testdata/compose_project.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: invalid docker compose project: Integration, has to be lowercase letters, digits, dashes and underscores",
+		},
+		{
+			path:    "testdata/reuse.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: the pipeline reuses the instance of build, it must depend on it",
+		},
+		{
+			path:    "testdata/restore.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: the pipeline restores the workspace of build, it must depend on it",
+		},
 	}
 	for _, test := range tests {
 		name := path.Base(test.path)
@@ -189,6 +219,65 @@ func Test_checkPools(t *testing.T) {
 	}
 }
 
+func Test_checkPrivileges(t *testing.T) {
+	privileged := true
+	privileges := &resource.Privileges{
+		Images:       []string{"docker:dind"},
+		Devices:      []string{"/dev/kvm"},
+		Capabilities: []string{"NET_ADMIN"},
+	}
+	volumes := []*resource.Volume{
+		{Name: "kvm", HostPath: &resource.VolumeHostPath{Path: "/dev/kvm"}},
+		{Name: "fuse", HostPath: &resource.VolumeHostPath{Path: "/dev/fuse"}},
+	}
+
+	tests := []struct {
+		name    string
+		step    *resource.Step
+		wantErr bool
+	}{
+		{
+			name: "allowed privileged image",
+			step: &resource.Step{Name: "dind", Image: "docker:20", Privileged: &privileged},
+		},
+		{
+			name:    "privileged image not allowed",
+			step:    &resource.Step{Name: "build", Image: "golang", Privileged: &privileged},
+			wantErr: true,
+		},
+		{
+			name: "unprivileged by default",
+			step: &resource.Step{Name: "build", Image: "golang"},
+		},
+		{
+			name: "allowed capability",
+			step: &resource.Step{Name: "dind", Image: "docker:dind", CapAdd: []string{"CAP_NET_ADMIN"}},
+		},
+		{
+			name:    "capability not allowed",
+			step:    &resource.Step{Name: "dind", Image: "docker:dind", CapAdd: []string{"SYS_ADMIN"}},
+			wantErr: true,
+		},
+		{
+			name: "allowed device",
+			step: &resource.Step{Name: "test", Image: "golang", Devices: []*resource.VolumeDevice{{Name: "kvm", DevicePath: "/dev/kvm"}}},
+		},
+		{
+			name:    "device not allowed",
+			step:    &resource.Step{Name: "test", Image: "golang", Devices: []*resource.VolumeDevice{{Name: "fuse", DevicePath: "/dev/fuse"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := &resource.Pipeline{Volumes: volumes, Steps: []*resource.Step{tt.step}}
+			if err := checkPrivileges(pipeline, privileges); (err != nil) != tt.wantErr {
+				t.Errorf("checkPrivileges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func DummyPool(name, runnerName string) drivers.Pool {
 	var pool drivers.Pool
 	pool.Name = name
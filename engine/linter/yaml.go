@@ -0,0 +1,347 @@
+package linter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/engine/resource"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// instanceTypePattern matches the ec2 instance types, e.g. t3.large or
+// m7i-flex.xlarge.
+var instanceTypePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*\.[a-z0-9-]+$`)
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Problem is a mistake in a yaml file, at the path and line of the value.
+type Problem struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s: %s", p.Line, p.Path, p.Message)
+}
+
+// LintPipelineYAML checks the pool and platform sections of the vm
+// pipelines of a .drone.yml. Pools are the platforms of the pools of the
+// pool file by name, the pool a pipeline uses is not checked if nil. It
+// returns an error only if the yaml cannot be parsed.
+func LintPipelineYAML(data []byte, pools map[string]types.Platform) ([]Problem, error) {
+	l := &yamlLint{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		kind, typ := l.value(root, "kind"), l.value(root, "type")
+		if kind != resource.Kind || (typ != resource.Type && typ != "") {
+			continue
+		}
+		l.pipeline(root, fmt.Sprintf("pipeline[%s]", l.value(root, "name")), pools)
+	}
+	return l.problems, nil
+}
+
+// LintPoolYAML checks the instances of a pool file: unknown fields, the
+// instance types of amazon pools and options that exclude each other. It
+// returns an error only if the yaml cannot be parsed.
+func LintPoolYAML(data []byte) ([]Problem, error) {
+	root, err := parseRoot(data)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	// the pool file is decoded as json, its keys are case insensitive.
+	l := &yamlLint{fold: true}
+	l.walk(root, "", reflect.TypeOf(config.PoolFile{}))
+	if _, instances := l.lookup(root, "instances"); instances != nil && instances.Kind == yaml.SequenceNode {
+		for i, instance := range instances.Content {
+			l.instance(instance, fmt.Sprintf("instances[%d]", i), false)
+		}
+	}
+	if _, bases := l.lookup(root, "bases"); bases != nil && bases.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(bases.Content); i += 2 {
+			l.instance(bases.Content[i+1], "bases."+bases.Content[i].Value, true)
+		}
+	}
+	return l.problems, nil
+}
+
+// PoolPlatforms returns the platforms of the pools of a pool file by
+// name, with the os and arch the pool file sets, empty if it does not.
+func PoolPlatforms(data []byte) (map[string]types.Platform, error) {
+	pools := map[string]types.Platform{}
+	root, err := parseRoot(data)
+	if err != nil || root == nil {
+		return pools, err
+	}
+	l := &yamlLint{fold: true}
+	_, instances := l.lookup(root, "instances")
+	if instances == nil || instances.Kind != yaml.SequenceNode {
+		return pools, nil
+	}
+	for _, instance := range instances.Content {
+		platform := types.Platform{}
+		if _, n := l.lookup(instance, "platform"); n != nil {
+			platform.OS = l.value(n, "os")
+			platform.Arch = l.value(n, "arch")
+		}
+		pools[l.value(instance, "name")] = platform
+	}
+	return pools, nil
+}
+
+func parseRoot(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+type yamlLint struct {
+	fold     bool
+	problems []Problem
+}
+
+func (l *yamlLint) add(n *yaml.Node, path, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{Line: n.Line, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *yamlLint) pipeline(root *yaml.Node, path string, pools map[string]types.Platform) {
+	if key, _ := l.lookup(root, "instance"); key != nil {
+		l.add(key, path+".instance", "vm pipelines do not define instances, select a pool of the pool file with pool.use")
+	}
+
+	var osNode, archNode *yaml.Node
+	if _, platform := l.lookup(root, "platform"); platform != nil {
+		l.walk(platform, path+".platform", reflect.TypeOf(types.Platform{}))
+		_, osNode = l.lookup(platform, "os")
+		_, archNode = l.lookup(platform, "arch")
+		if osNode != nil && osNode.Value != oshelp.OSLinux && osNode.Value != oshelp.OSWindows && osNode.Value != oshelp.OSMac {
+			l.add(osNode, path+".platform.os", "invalid os %q, %s, %s or %s", osNode.Value, oshelp.OSLinux, oshelp.OSWindows, oshelp.OSMac)
+		}
+		if archNode != nil && archNode.Value != oshelp.ArchAMD64 && archNode.Value != oshelp.ArchARM64 {
+			l.add(archNode, path+".platform.arch", "invalid arch %q, %s or %s", archNode.Value, oshelp.ArchAMD64, oshelp.ArchARM64)
+		}
+	}
+
+	_, pool := l.lookup(root, "pool")
+	if pool == nil {
+		return
+	}
+	l.walk(pool, path+".pool", reflect.TypeOf(resource.Pool{}))
+	_, use := l.lookup(pool, "use")
+	if use == nil || use.Value == "" {
+		l.add(pool, path+".pool.use", "is empty, name the pool of the pool file the pipeline runs in")
+		return
+	}
+	if pools == nil {
+		return
+	}
+	platform, ok := pools[use.Value]
+	if !ok {
+		names := make([]string, 0, len(pools))
+		for name := range pools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		l.add(use, path+".pool.use", "unknown pool %q, the pool file defines %s", use.Value, strings.Join(names, ", "))
+		return
+	}
+	if osNode != nil && platform.OS != "" && osNode.Value != platform.OS {
+		l.add(osNode, path+".platform.os", "pool %s runs %s instances", use.Value, platform.OS)
+	}
+	if archNode != nil && platform.Arch != "" && archNode.Value != platform.Arch {
+		l.add(archNode, path+".platform.arch", "pool %s runs %s instances", use.Value, platform.Arch)
+	}
+}
+
+// instance checks an instance or a base. The type of a base, or of an
+// instance extending one, may be set by the base it extends.
+func (l *yamlLint) instance(n *yaml.Node, path string, base bool) {
+	l.fields(n, path, reflect.TypeOf(config.Instance{}))
+	_, typ := l.lookup(n, "type")
+	if typ == nil {
+		if _, extends := l.lookup(n, "extends"); !base && extends == nil {
+			l.add(n, path+".type", "is empty, set the driver of the pool")
+		}
+		return
+	}
+	spec, err := config.NewSpec(typ.Value)
+	if err != nil {
+		l.add(typ, path+".type", "%s", err)
+		return
+	}
+	_, specNode := l.lookup(n, "spec")
+	if specNode == nil {
+		return
+	}
+	path += ".spec"
+	l.walk(specNode, path, reflect.TypeOf(spec))
+	l.exclusive(specNode, path, "user_data", "user_data_path")
+	if _, stack := l.lookup(specNode, "stack"); stack != nil {
+		l.exclusive(stack, path+".stack", "template", "template_path")
+	}
+
+	if typ.Value != string(types.Amazon) && typ.Value != "aws" {
+		return
+	}
+	for _, key := range []string{"size", "size_alt"} {
+		if _, size := l.lookup(specNode, key); size != nil {
+			l.instanceType(size, path+"."+key)
+		}
+	}
+	if _, cheapest := l.lookup(specNode, "cheapest"); cheapest != nil {
+		if _, sizes := l.lookup(cheapest, "sizes"); sizes != nil {
+			for i, size := range sizes.Content {
+				l.instanceType(size, fmt.Sprintf("%s.cheapest.sizes[%d]", path, i))
+			}
+		}
+	}
+}
+
+func (l *yamlLint) instanceType(n *yaml.Node, path string) {
+	if n.Kind != yaml.ScalarNode || !instanceTypePattern.MatchString(n.Value) {
+		l.add(n, path, "invalid instance type %q, e.g. t3.large", n.Value)
+	}
+}
+
+func (l *yamlLint) exclusive(n *yaml.Node, path, a, b string) {
+	keyA, _ := l.lookup(n, a)
+	keyB, _ := l.lookup(n, b)
+	if keyA != nil && keyB != nil {
+		l.add(keyB, path+"."+b, "%s and %s are mutually exclusive", a, b)
+	}
+}
+
+// walk reports the unknown fields of the node decoded into a value of
+// type t. Values with their own decoding are not checked.
+func (l *yamlLint) walk(n *yaml.Node, path string, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Struct:
+		l.fields(n, path, t)
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			l.walk(n.Content[i+1], path+"."+n.Content[i].Value, t.Elem())
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range n.Content {
+			l.walk(item, fmt.Sprintf("%s[%d]", path, i), t.Elem())
+		}
+	}
+}
+
+func (l *yamlLint) fields(n *yaml.Node, path string, t reflect.Type) {
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	known := map[string]reflect.Type{}
+	l.collectFields(t, known)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		name := key.Value
+		if l.fold {
+			name = strings.ToLower(name)
+		}
+		field := strings.TrimPrefix(path+"."+key.Value, ".")
+		ft, ok := known[name]
+		if !ok {
+			l.add(key, field, "unknown field")
+			continue
+		}
+		l.walk(n.Content[i+1], field, ft)
+	}
+}
+
+// collectFields adds the keys of the fields of the struct, with those of
+// its embedded structs.
+func (l *yamlLint) collectFields(t reflect.Type, known map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			l.collectFields(f.Type, known)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name := l.fieldName(f)
+		if name == "-" {
+			continue
+		}
+		known[name] = f.Type
+	}
+}
+
+// fieldName returns the key of the field. The pool file is decoded as
+// json with case insensitive keys, pipelines as yaml.
+func (l *yamlLint) fieldName(f reflect.StructField) string {
+	if l.fold {
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" {
+			return strings.ToLower(name)
+		}
+		return strings.ToLower(f.Name)
+	}
+	if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+// lookup returns the key and value nodes of the key of a mapping.
+func (l *yamlLint) lookup(n *yaml.Node, key string) (k, v *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key || (l.fold && strings.EqualFold(n.Content[i].Value, key)) {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func (l *yamlLint) value(n *yaml.Node, key string) string {
+	if _, v := l.lookup(n, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
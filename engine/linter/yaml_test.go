@@ -0,0 +1,79 @@
+package linter
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLintPipelineYAML(t *testing.T) {
+	data, err := os.ReadFile("testdata/lint_pipeline.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := os.ReadFile("testdata/lint_pool.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools, err := PoolPlatforms(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := LintPipelineYAML(data, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"line 9: pipeline[build].platform.flavor: unknown field",
+		"line 8: pipeline[build].platform.arch: pool ubuntu runs amd64 instances",
+		"line 24: pipeline[release].instance: vm pipelines do not define instances, select a pool of the pool file with pool.use",
+		"line 28: pipeline[release].pool.usee: unknown field",
+		"line 28: pipeline[release].pool.use: is empty, name the pool of the pool file the pipeline runs in",
+	}
+	if got := problemStrings(problems); !reflect.DeepEqual(got, want) {
+		t.Errorf("want problems\n%v\ngot\n%v", want, got)
+	}
+
+	problems, err = LintPipelineYAML([]byte("kind: pipeline\ntype: vm\nname: test\npool:\n  use: macos\n"), pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{`line 5: pipeline[test].pool.use: unknown pool "macos", the pool file defines ubuntu, windows`}
+	if got := problemStrings(problems); !reflect.DeepEqual(got, want) {
+		t.Errorf("want problems %v, got %v", want, got)
+	}
+
+	if _, err = LintPipelineYAML([]byte("kind: pipeline\n  type: vm"), nil); err == nil {
+		t.Errorf("want an error for malformed yaml")
+	}
+}
+
+func TestLintPoolYAML(t *testing.T) {
+	data, err := os.ReadFile("testdata/lint_pool.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := LintPoolYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"line 25: instances[0].spec.network.subnet: unknown field",
+		"line 17: instances[0].spec.user_data_path: user_data and user_data_path are mutually exclusive",
+		`line 15: instances[0].spec.size: invalid instance type "t3large", e.g. t3.large`,
+		`line 21: instances[0].spec.cheapest.sizes[1]: invalid instance type "large", e.g. t3.large`,
+		"line 27: instances[1].type: unknown instance type amazom",
+	}
+	if got := problemStrings(problems); !reflect.DeepEqual(got, want) {
+		t.Errorf("want problems\n%v\ngot\n%v", want, got)
+	}
+}
+
+func problemStrings(problems []Problem) []string {
+	out := make([]string, len(problems))
+	for i, p := range problems {
+		out[i] = p.String()
+	}
+	return out
+}
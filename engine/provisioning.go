@@ -0,0 +1,48 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+)
+
+// Provisioning is the time a stage waited before its first step, shown by
+// the initialize step so that users see the wait for the instance apart
+// from their steps.
+type Provisioning struct {
+	Queued   time.Duration // in the queue of the server, until the runner accepted the stage
+	Accepted time.Time     // when the runner accepted the stage
+	Claim    drivers.ClaimTiming
+	Resume   time.Duration // starting the instance from hibernation
+	Health   time.Duration // waiting for the lite-engine to respond
+	Setup    time.Duration // setting up the lite-engine and the instance
+	Total    time.Duration // from the accept until the instance was ready
+}
+
+// report returns the summary of the initialize step.
+func (p *Provisioning) report(pool, instanceID string) string {
+	var b strings.Builder
+	if p.Queued > 0 {
+		fmt.Fprintf(&b, "Queued for %s before the runner accepted the stage\n", round(p.Queued))
+	}
+	fmt.Fprintf(&b, "Claimed instance %s of pool %s in %s (lock %s, store %s, create %s)\n",
+		instanceID, pool, round(p.Claim.Total), round(p.Claim.Lock), round(p.Claim.Store), round(p.Claim.Create))
+	if p.Resume > 0 {
+		fmt.Fprintf(&b, "Resumed the instance from hibernation in %s\n", round(p.Resume))
+	}
+	fmt.Fprintf(&b, "Lite-engine responded in %s\n", round(p.Health))
+	fmt.Fprintf(&b, "Set up the instance in %s\n", round(p.Setup))
+	fmt.Fprintf(&b, "Waited %s for the instance\n", round(p.Total))
+	return b.String()
+}
+
+func round(d time.Duration) time.Duration {
+	const precision = 100 * time.Millisecond
+	return d.Round(precision)
+}
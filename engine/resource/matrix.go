@@ -0,0 +1,296 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/buildkite/yaml"
+)
+
+// maxMatrixSize is the maximum number of pipelines a matrix expands to.
+const maxMatrixSize = 64
+
+var (
+	// matrixPattern matches the references to the value of an axis,
+	// e.g. {{ matrix.arch }}. Unlike ${arch}, they are not substituted
+	// with the build variables.
+	matrixPattern = regexp.MustCompile(`\{\{\s*matrix\.([A-Za-z0-9_]*)\s*\}\}`)
+	axisPattern   = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// Expand expands every vm pipeline of the configuration with a matrix into
+// a pipeline per combination of the values of its axes, e.g. on a pool
+// per os and arch. The references to the axes in the pipeline are
+// replaced with their values, and the values are appended to its name.
+// The pipelines depending on an expanded pipeline depend on all of its
+// combinations, so that they run once every combination passed. The
+// configuration is returned as is if no pipeline has a matrix.
+func Expand(data []byte) ([]byte, error) {
+	docs := splitDocuments(data)
+	parsed := make([]yaml.MapSlice, len(docs))
+	combinations := map[string][]string{}
+	for i, doc := range docs {
+		var m yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(doc), &m); err != nil || !isVMPipeline(m) {
+			continue // the other documents are left to the server.
+		}
+		parsed[i] = m
+		if _, ok := lookup(m, "matrix"); ok {
+			combinations[pipelineName(m)] = nil
+		}
+	}
+	if len(combinations) == 0 {
+		return data, nil
+	}
+
+	expanded := make([][]yaml.MapSlice, len(docs))
+	for i, m := range parsed {
+		if m == nil {
+			continue
+		}
+		name := pipelineName(m)
+		if _, ok := lookup(m, "matrix"); !ok {
+			expanded[i] = []yaml.MapSlice{m}
+			continue
+		}
+		pipelines, err := expandMatrix(m)
+		if err != nil {
+			return nil, fmt.Errorf("matrix of pipeline %s: %w", name, err)
+		}
+		expanded[i] = pipelines
+		for _, p := range pipelines {
+			combinations[name] = append(combinations[name], pipelineName(p))
+		}
+	}
+
+	var out bytes.Buffer
+	for i, doc := range docs {
+		changed := false
+		for j, p := range expanded[i] {
+			deps, ok := lookup(p, "depends_on")
+			if !ok {
+				continue
+			}
+			if list, ok := deps.([]interface{}); ok {
+				if expandedDeps, depsChanged := expandDeps(list, combinations); depsChanged {
+					expanded[i][j] = set(p, "depends_on", expandedDeps)
+					changed = true
+				}
+			}
+		}
+		if _, ok := lookup(parsed[i], "matrix"); !ok && !changed {
+			writeDocument(&out, doc)
+			continue
+		}
+		for _, p := range expanded[i] {
+			b, err := yaml.Marshal(p)
+			if err != nil {
+				return nil, err
+			}
+			writeDocument(&out, string(b))
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// expandMatrix returns a pipeline per combination of the values of the
+// axes of the matrix, in the order of the axes.
+func expandMatrix(pipeline yaml.MapSlice) ([]yaml.MapSlice, error) {
+	matrix, _ := lookup(pipeline, "matrix")
+	axes, ok := matrix.(yaml.MapSlice)
+	if !ok || len(axes) == 0 {
+		return nil, errors.New("the matrix must map axes to their values")
+	}
+	// the combinations of the values, and the values in the order of the axes.
+	combinations := []map[string]string{{}}
+	names := [][]string{nil}
+	for _, axis := range axes {
+		key := fmt.Sprint(axis.Key)
+		if !axisPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid axis %q, it must be letters, digits and underscores", key)
+		}
+		values, ok := axis.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("axis %s must list its values", key)
+		}
+		if len(combinations)*len(values) > maxMatrixSize {
+			return nil, fmt.Errorf("the matrix expands to more than %d pipelines", maxMatrixSize)
+		}
+		var next []map[string]string
+		var nextNames [][]string
+		for i, combination := range combinations {
+			for _, v := range values {
+				switch v.(type) {
+				case yaml.MapSlice, []interface{}, nil:
+					return nil, fmt.Errorf("the values of axis %s must be scalars", key)
+				}
+				value := fmt.Sprint(v)
+				c := map[string]string{key: value}
+				for k, prev := range combination {
+					c[k] = prev
+				}
+				next = append(next, c)
+				nextNames = append(nextNames, append(append([]string{}, names[i]...), value))
+			}
+		}
+		combinations, names = next, nextNames
+	}
+
+	name := pipelineName(pipeline)
+	pipelines := make([]yaml.MapSlice, 0, len(combinations))
+	for i, combination := range combinations {
+		var p yaml.MapSlice
+		for _, item := range pipeline {
+			switch item.Key {
+			case "matrix":
+				continue
+			case "name":
+				item.Value = name + "-" + strings.Join(names[i], "-")
+			default:
+				value, err := substitute(item.Value, combination)
+				if err != nil {
+					return nil, err
+				}
+				item.Value = value
+			}
+			p = append(p, item)
+		}
+		if _, ok := lookup(p, "name"); !ok {
+			p = append(yaml.MapSlice{{Key: "name", Value: name + "-" + strings.Join(names[i], "-")}}, p...)
+		}
+		pipelines = append(pipelines, p)
+	}
+	return pipelines, nil
+}
+
+// substitute returns a copy of the value with the references to the axes
+// replaced with their values in the combination.
+func substitute(value interface{}, combination map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var err error
+		s := matrixPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			axis := matrixPattern.FindStringSubmatch(ref)[1]
+			value, ok := combination[axis]
+			if !ok && err == nil {
+				err = fmt.Errorf("unknown axis in %s", ref)
+			}
+			return value
+		})
+		return s, err
+	case yaml.MapSlice:
+		out := make(yaml.MapSlice, 0, len(v))
+		for _, item := range v {
+			value, err := substitute(item.Value, combination)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, yaml.MapItem{Key: item.Key, Value: value})
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			value, err := substitute(item, combination)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		}
+		return out, nil
+	}
+	return value, nil
+}
+
+// expandDeps replaces the expanded pipelines of the dependencies with
+// their combinations.
+func expandDeps(deps []interface{}, combinations map[string][]string) ([]interface{}, bool) {
+	var out []interface{}
+	changed := false
+	for _, dep := range deps {
+		names, ok := combinations[fmt.Sprint(dep)]
+		if !ok {
+			out = append(out, dep)
+			continue
+		}
+		for _, name := range names {
+			out = append(out, name)
+		}
+		changed = true
+	}
+	return out, changed
+}
+
+// splitDocuments splits the configuration into its yaml documents.
+func splitDocuments(data []byte) []string {
+	var docs []string
+	var doc strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "---") && strings.TrimSpace(line[3:]) == "" {
+			if strings.TrimSpace(doc.String()) != "" {
+				docs = append(docs, doc.String())
+			}
+			doc.Reset()
+			continue
+		}
+		doc.WriteString(line)
+		doc.WriteByte('\n')
+	}
+	if strings.TrimSpace(doc.String()) != "" {
+		docs = append(docs, doc.String())
+	}
+	return docs
+}
+
+func writeDocument(out *bytes.Buffer, doc string) {
+	out.WriteString("---\n")
+	out.WriteString(doc)
+	if !strings.HasSuffix(doc, "\n") {
+		out.WriteByte('\n')
+	}
+}
+
+func isVMPipeline(m yaml.MapSlice) bool {
+	kind, _ := lookup(m, "kind")
+	typ, _ := lookup(m, "type")
+	return kind == Kind && (typ == Type || typ == nil)
+}
+
+func pipelineName(m yaml.MapSlice) string {
+	name, _ := lookup(m, "name")
+	if name == nil || name == "" {
+		return "default"
+	}
+	return fmt.Sprint(name)
+}
+
+func lookup(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func set(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	out := make(yaml.MapSlice, 0, len(m))
+	for _, item := range m {
+		if item.Key == key {
+			item.Value = value
+		}
+		out = append(out, item)
+	}
+	return out
+}
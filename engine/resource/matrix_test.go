@@ -0,0 +1,91 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package resource
+
+import (
+	"os"
+	"testing"
+
+	"github.com/drone/runner-go/manifest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpand(t *testing.T) {
+	data, err := os.ReadFile("testdata/matrix.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded, err := Expand(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfst, err := manifest.ParseString(string(expanded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names, pools, commands []string
+	var deps []string
+	secrets := 0
+	for _, r := range mfst.Resources {
+		switch r := r.(type) {
+		case *Pipeline:
+			if r.Name == "release" {
+				deps = r.Deps
+				continue
+			}
+			names = append(names, r.Name)
+			pools = append(pools, r.Pool.Use)
+			commands = append(commands, r.Steps[0].Commands...)
+		case *manifest.Secret:
+			secrets++
+		}
+	}
+	want := []string{"test-linux-amd64", "test-linux-arm64", "test-darwin-amd64", "test-darwin-arm64"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("unexpected pipelines:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"linux-amd64", "linux-arm64", "darwin-amd64", "darwin-arm64"}, pools); diff != "" {
+		t.Errorf("unexpected pools:\n%s", diff)
+	}
+	if got, want := commands[1], "GOARCH=arm64 go test ./..."; got != want {
+		t.Errorf("want the command %q, got %q", want, got)
+	}
+	if diff := cmp.Diff(append([]string{"lint"}, want...), deps); diff != "" {
+		t.Errorf("want the release to depend on every combination:\n%s", diff)
+	}
+	if secrets != 1 {
+		t.Errorf("want the secret kept, got %d secrets", secrets)
+	}
+}
+
+func TestExpand_NoMatrix(t *testing.T) {
+	data, err := os.ReadFile("testdata/manifest.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded, err := Expand(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(expanded) != string(data) {
+		t.Errorf("want the configuration without a matrix as is")
+	}
+}
+
+func TestExpand_Invalid(t *testing.T) {
+	tests := []string{
+		"kind: pipeline\ntype: vm\nname: test\nmatrix: [linux]\n",
+		"kind: pipeline\ntype: vm\nname: test\nmatrix:\n  os: []\n",
+		"kind: pipeline\ntype: vm\nname: test\nmatrix:\n  os: [linux]\npool:\n  use: '{{ matrix.arch }}'\n",
+		"kind: pipeline\ntype: vm\nname: test\nmatrix:\n  os: [[linux]]\n",
+	}
+	for _, test := range tests {
+		if _, err := Expand([]byte(test)); err == nil {
+			t.Errorf("want an error expanding %q", test)
+		}
+	}
+}
@@ -28,9 +28,13 @@ type Pipeline struct {
 	Kind    string   `json:"kind,omitempty"`
 	Type    string   `json:"type,omitempty"`
 	Name    string   `json:"name,omitempty"`
-	Deps    []string `json:"depends_on,omitempty"`
+	Deps    []string `json:"depends_on,omitempty" yaml:"depends_on"`
+	// Matrix maps the axes of the pipeline to their values, it is
+	// expanded into a pipeline per combination before it is parsed.
+	Matrix map[string][]string `json:"matrix,omitempty"`
 
 	Clone       manifest.Clone       `json:"clone,omitempty"`
+	Compose     *Compose             `json:"compose,omitempty"`
 	Concurrency manifest.Concurrency `json:"concurrency,omitempty"`
 	Node        map[string]string    `json:"node,omitempty"`
 	Platform    types.Platform       `json:"platform,omitempty"`
@@ -86,6 +90,7 @@ func (p *Pipeline) GetStep(name string) *Step {
 type (
 	// Step defines a Pipeline step.
 	Step struct {
+		CapAdd       []string                       `json:"cap_add,omitempty" yaml:"cap_add"`
 		Commands     []string                       `json:"commands,omitempty"`
 		Detach       bool                           `json:"detach,omitempty"`
 		DependsOn    []string                       `json:"depends_on,omitempty" yaml:"depends_on"`
@@ -96,11 +101,14 @@ type (
 		Environment  map[string]*manifest.Variable  `json:"environment,omitempty"`
 		ExtraHosts   []string                       `json:"extra_hosts,omitempty" yaml:"extra_hosts"`
 		Failure      string                         `json:"failure,omitempty"`
+		Health       *Health                        `json:"health,omitempty"`
 		Image        string                         `json:"image,omitempty"`
 		Name         string                         `json:"name,omitempty"`
 		Network      string                         `json:"network_mode,omitempty" yaml:"network_mode"`
 		PortBindings map[string]string              `json:"port_bindings" yaml:"port_bindings"`
+		Privileged   *bool                          `json:"privileged,omitempty"`
 		Pull         string                         `json:"pull,omitempty"`
+		Resources    *Resources                     `json:"resources,omitempty"`
 		Settings     map[string]*manifest.Parameter `json:"settings,omitempty"`
 		Shell        string                         `json:"shell,omitempty"`
 		ShmSize      manifest.BytesSize             `json:"shm_size,omitempty" yaml:"shm_size"`
@@ -110,13 +118,50 @@ type (
 		WorkingDir   string                         `json:"working_dir,omitempty" yaml:"working_dir"`
 	}
 
+	// Health defines the readiness check of a service. Steps
+	// wait until the service is healthy. The interval and
+	// timeout are in seconds.
+	Health struct {
+		Ports    []int  `json:"ports,omitempty"`
+		Test     string `json:"test,omitempty"`
+		Interval int    `json:"interval,omitempty"`
+		Timeout  int    `json:"timeout,omitempty"`
+	}
+
+	// Compose defines a docker compose project started on the
+	// instance before the steps and stopped after the steps.
+	// The file is relative to the workspace.
+	Compose struct {
+		File    string `json:"file,omitempty"`
+		Project string `json:"project,omitempty"`
+	}
+
+	// Resources describes the compute resource requirements
+	// of a step.
+	Resources struct {
+		Limits ResourceObject `json:"limits,omitempty"`
+	}
+
+	// ResourceObject describes compute resource requirements.
+	// The cpu is in millicores.
+	ResourceObject struct {
+		CPU    int64              `json:"cpu"`
+		Memory manifest.BytesSize `json:"memory"`
+	}
+
 	// Workspace represents the pipeline workspace configuration.
 	Workspace struct {
 		Path string `json:"path,omitempty"`
+		// Restore is the stage whose workspace snapshot is restored
+		// into the workspace before the steps run.
+		Restore string `json:"restore,omitempty"`
 	}
 
 	Pool struct {
 		Use string `json:"use,omitempty" yaml:"use"`
+		// Reuse is the stage, of the same pool, whose instance and
+		// workspace the pipeline reuses instead of claiming an instance.
+		Reuse string `json:"reuse,omitempty" yaml:"reuse"`
 	}
 
 	// Volume that can be mounted by containers.
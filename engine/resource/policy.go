@@ -0,0 +1,87 @@
+package resource
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/drone-go/drone"
+)
+
+// Policy restricts the pipelines of untrusted repositories, the
+// repositories drone does not mark trusted. They run on the pools of the
+// policy, their steps never run privileged, the instance metadata is
+// firewalled and their steps are stopped after the timeout. A nil policy
+// restricts nothing.
+type Policy struct {
+	// Pools are the pools untrusted pipelines run on, any pool if empty.
+	Pools []string
+	// Timeout caps the duration of the steps of untrusted stages, the
+	// timeout of the repository applies if 0.
+	Timeout time.Duration
+}
+
+// Untrusted returns true if the policy restricts the pipelines of the
+// repository.
+func (p *Policy) Untrusted(repo *drone.Repo) bool {
+	return p != nil && repo != nil && !repo.Trusted
+}
+
+// AllowsPool returns true if untrusted pipelines may run on the pool.
+func (p *Policy) AllowsPool(name string) bool {
+	if p == nil || len(p.Pools) == 0 {
+		return true
+	}
+	for _, pool := range p.Pools {
+		if pool == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PoolFor returns the pool an untrusted pipeline runs on: the requested
+// pool if the policy allows it, otherwise the first pool of the policy of
+// the platform of the pipeline, or of the requested pool.
+func (p *Policy) PoolFor(requested string, platform types.Platform, platformOf func(pool string) types.Platform) (string, error) {
+	if requested != "" && p.AllowsPool(requested) {
+		return requested, nil
+	}
+	if p == nil || len(p.Pools) == 0 {
+		return requested, nil
+	}
+	if platform.OS == "" && requested != "" {
+		platform = platformOf(requested)
+	}
+	for _, name := range p.Pools {
+		got := platformOf(name)
+		if (platform.OS == "" || got.OS == platform.OS) && (platform.Arch == "" || got.Arch == platform.Arch) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no pool of untrusted repositories runs %s/%s pipelines", platform.OS, platform.Arch)
+}
+
+// Check returns an error if the pipeline overrides a setting untrusted
+// pipelines cannot: privileged steps, added capabilities, devices, host
+// volumes and the host network.
+func (p *Policy) Check(pipeline *Pipeline) error {
+	for _, volume := range pipeline.Volumes {
+		if volume.HostPath != nil {
+			return fmt.Errorf("untrusted repositories cannot mount the host path %s", volume.HostPath.Path)
+		}
+	}
+	for _, step := range append(pipeline.Services, pipeline.Steps...) { //nolint:gocritic // creating a new slice is ok
+		switch {
+		case step.Privileged != nil && *step.Privileged:
+			return fmt.Errorf("step %s: untrusted repositories cannot run privileged steps", step.Name)
+		case len(step.CapAdd) != 0:
+			return fmt.Errorf("step %s: untrusted repositories cannot add capabilities", step.Name)
+		case len(step.Devices) != 0:
+			return fmt.Errorf("step %s: untrusted repositories cannot mount devices", step.Name)
+		case step.Network == "host":
+			return fmt.Errorf("step %s: untrusted repositories cannot use the host network", step.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/drone-go/drone"
+)
+
+func TestPolicy_Untrusted(t *testing.T) {
+	var disabled *Policy
+	if disabled.Untrusted(&drone.Repo{}) {
+		t.Errorf("Want no repository untrusted without policy")
+	}
+	policy := &Policy{}
+	if !policy.Untrusted(&drone.Repo{}) || policy.Untrusted(&drone.Repo{Trusted: true}) {
+		t.Errorf("Want the repositories not trusted by drone untrusted")
+	}
+}
+
+func TestPolicy_PoolFor(t *testing.T) {
+	platforms := map[string]types.Platform{
+		"linux":           {OS: "linux", Arch: "amd64"},
+		"linux-arm":       {OS: "linux", Arch: "arm64"},
+		"untrusted":       {OS: "linux", Arch: "amd64"},
+		"untrusted-arm":   {OS: "linux", Arch: "arm64"},
+		"windows":         {OS: "windows", Arch: "amd64"},
+		"untrusted-macos": {OS: "darwin", Arch: "arm64"},
+	}
+	platformOf := func(pool string) types.Platform { return platforms[pool] }
+	policy := &Policy{Pools: []string{"untrusted", "untrusted-arm", "untrusted-macos"}}
+	tests := []struct {
+		requested string
+		platform  types.Platform
+		want      string
+		valid     bool
+	}{
+		{requested: "untrusted-arm", want: "untrusted-arm", valid: true},
+		{requested: "linux", want: "untrusted", valid: true},
+		{requested: "linux-arm", want: "untrusted-arm", valid: true},
+		{requested: "linux", platform: types.Platform{OS: "linux", Arch: "arm64"}, want: "untrusted-arm", valid: true},
+		{platform: types.Platform{OS: "darwin"}, want: "untrusted-macos", valid: true},
+		{requested: "windows"},
+	}
+	for _, test := range tests {
+		got, err := policy.PoolFor(test.requested, test.platform, platformOf)
+		if (err == nil) != test.valid {
+			t.Errorf("Want pool %q for %q valid %v, got %v", test.want, test.requested, test.valid, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Want pool %q for %q, got %q", test.want, test.requested, got)
+		}
+	}
+	if got, _ := (&Policy{}).PoolFor("windows", types.Platform{}, platformOf); got != "windows" {
+		t.Errorf("Want any pool allowed without pools, got %q", got)
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	yes, no := true, false
+	policy := &Policy{}
+	tests := []struct {
+		pipeline *Pipeline
+		valid    bool
+	}{
+		{pipeline: &Pipeline{Steps: []*Step{{Name: "build", Image: "golang"}}}, valid: true},
+		{pipeline: &Pipeline{Steps: []*Step{{Name: "build", Image: "golang", Privileged: &no}}}, valid: true},
+		{pipeline: &Pipeline{Steps: []*Step{{Name: "build", Image: "docker:dind", Privileged: &yes}}}},
+		{pipeline: &Pipeline{Services: []*Step{{Name: "db", Image: "postgres", CapAdd: []string{"NET_ADMIN"}}}}},
+		{pipeline: &Pipeline{Steps: []*Step{{Name: "build", Image: "golang", Devices: []*VolumeDevice{{Name: "kvm"}}}}}},
+		{pipeline: &Pipeline{Steps: []*Step{{Name: "build", Image: "golang", Network: "host"}}}},
+		{pipeline: &Pipeline{Volumes: []*Volume{{Name: "docker", HostPath: &VolumeHostPath{Path: "/var/run/docker.sock"}}}}},
+	}
+	for i, test := range tests {
+		if err := policy.Check(test.pipeline); (err == nil) != test.valid {
+			t.Errorf("Want the pipeline of test %d valid %v, got %v", i, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package resource
+
+import (
+	"path"
+	"strings"
+
+	leimage "github.com/harness/lite-engine/engine/docker/image"
+)
+
+// Privileges limit the privileges steps may request. Empty
+// image and device lists allow all images and devices, an
+// empty capability list allows no capabilities.
+type Privileges struct {
+	Images       []string
+	Devices      []string
+	Capabilities []string
+}
+
+// AllowsImage returns true if containers of the image may
+// run privileged. The image tag is not used in the matching.
+func (p *Privileges) AllowsImage(image string) bool {
+	if p == nil || len(p.Images) == 0 {
+		return true
+	}
+	return leimage.Match(image, p.Images...)
+}
+
+// AllowsDevice returns true if the host device may be
+// mounted in containers.
+func (p *Privileges) AllowsDevice(device string) bool {
+	if p == nil || len(p.Devices) == 0 {
+		return true
+	}
+	for _, allowed := range p.Devices {
+		if path.Clean(allowed) == path.Clean(device) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsCapability returns true if containers may add the
+// capability, with or without the CAP_ prefix.
+func (p *Privileges) AllowsCapability(capability string) bool {
+	if p == nil {
+		return false
+	}
+	for _, allowed := range p.Capabilities {
+		if normalizeCapability(allowed) == normalizeCapability(capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivileged returns true if the step runs in privileged
+// mode. Steps that use an image run privileged by default if
+// the image is allowed to. Lite engine cannot add individual
+// capabilities, so steps adding capabilities run privileged.
+func (p *Privileges) IsPrivileged(step *Step) bool {
+	switch {
+	case step.Image == "":
+		return false
+	case len(step.CapAdd) > 0:
+		return true
+	case step.Privileged != nil:
+		return *step.Privileged
+	default:
+		return p.AllowsImage(step.Image)
+	}
+}
+
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+}
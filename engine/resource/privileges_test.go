@@ -0,0 +1,41 @@
+package resource
+
+import "testing"
+
+func TestPrivileges_IsPrivileged(t *testing.T) {
+	yes, no := true, false
+	restricted := &Privileges{Images: []string{"docker:dind", "plugins/docker"}}
+	tests := []struct {
+		privileges *Privileges
+		step       *Step
+		want       bool
+	}{
+		{privileges: nil, step: &Step{Image: "golang"}, want: true},
+		{privileges: nil, step: &Step{}, want: false},
+		{privileges: nil, step: &Step{Image: "golang", Privileged: &no}, want: false},
+		{privileges: restricted, step: &Step{Image: "golang"}, want: false},
+		{privileges: restricted, step: &Step{Image: "plugins/docker:20"}, want: true},
+		{privileges: restricted, step: &Step{Image: "docker:dind", Privileged: &no}, want: false},
+		{privileges: restricted, step: &Step{Image: "golang", Privileged: &yes}, want: true},
+		{privileges: restricted, step: &Step{Image: "golang", CapAdd: []string{"NET_ADMIN"}}, want: true},
+	}
+	for i, test := range tests {
+		if got := test.privileges.IsPrivileged(test.step); got != test.want {
+			t.Errorf("Want privileged %v for test %d, got %v", test.want, i, got)
+		}
+	}
+}
+
+func TestPrivileges_Allows(t *testing.T) {
+	var unrestricted *Privileges
+	if !unrestricted.AllowsDevice("/dev/kvm") || unrestricted.AllowsCapability("NET_ADMIN") {
+		t.Errorf("Want all devices and no capabilities allowed without privileges")
+	}
+	privileges := &Privileges{Devices: []string{"/dev/kvm/"}, Capabilities: []string{"cap_net_admin"}}
+	if !privileges.AllowsDevice("/dev/kvm") || privileges.AllowsDevice("/dev/fuse") {
+		t.Errorf("Want only /dev/kvm allowed")
+	}
+	if !privileges.AllowsCapability("NET_ADMIN") || privileges.AllowsCapability("SYS_ADMIN") {
+		t.Errorf("Want only NET_ADMIN allowed")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+var errNoSnapshotStore = errors.New("workspace snapshots are not configured")
+
+// restoreSnapshot restores the workspace snapshot saved by the stage the
+// pipeline depends on.
+func (e *Engine) restoreSnapshot(ctx context.Context, client lehttp.Client, instance *types.Instance, spec *Spec) error {
+	if e.snapshots == nil {
+		return errNoSnapshotStore
+	}
+	url, err := e.snapshots.GetURL(spec.Restore)
+	if err != nil {
+		return err
+	}
+	return lehelper.RestoreWorkspace(ctx, client, instance.Platform.OS, spec.Workspace, url)
+}
+
+// saveSnapshot saves the workspace snapshot of the stage for the stages
+// restoring it, before the instance is released. A stage restoring a
+// snapshot which was not saved fails its setup.
+func (e *Engine) saveSnapshot(ctx context.Context, spec *Spec) {
+	const saveTimeout = 30 * time.Minute
+
+	logr := logger.FromContext(ctx).
+		WithField("pool", spec.CloudInstance.PoolName).
+		WithField("id", spec.CloudInstance.ID)
+	if e.snapshots == nil {
+		logr.WithError(errNoSnapshotStore).Warnln("failed to save the workspace snapshot")
+		return
+	}
+	instance, err := e.poolManager.Find(ctx, spec.CloudInstance.ID)
+	if err != nil {
+		logr.WithError(err).Warnln("failed to find the instance to save its workspace snapshot")
+		return
+	}
+	client, err := lehelper.GetClient(instance, e.config.Runner.Name, instance.Port, e.config.LiteEngine.EnableMock, e.config.LiteEngine.MockStepTimeoutSecs)
+	if err != nil {
+		logr.WithError(err).Warnln("failed to create LE client to save the workspace snapshot")
+		return
+	}
+	url, err := e.snapshots.PutURL(spec.Snapshot)
+	if err != nil {
+		logr.WithError(err).Warnln("failed to presign the url of the workspace snapshot")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, saveTimeout)
+	defer cancel()
+	started := time.Now()
+	if err = lehelper.SaveWorkspace(ctx, client, instance.Platform.OS, spec.Workspace, url); err != nil {
+		logr.WithError(err).Warnln("failed to save the workspace snapshot")
+		return
+	}
+	logr.WithField("snapshot", e.snapshots.Name(spec.Snapshot)).
+		WithField("duration", round(time.Since(started))).
+		Infoln("saved the workspace snapshot")
+}
@@ -5,6 +5,9 @@
 package engine
 
 import (
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/admission"
 	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/pipeline/runtime"
@@ -24,26 +27,68 @@ type (
 		Steps         []*Step          `json:"steps,omitempty"`
 		Volumes       []*lespec.Volume `json:"volumes,omitempty"`
 		Network       lespec.Network   `json:"network"`
+		// Provisioning records the wait for the instance, if the
+		// stage has an initialize step.
+		Provisioning *Provisioning `json:"-"`
+		// Diagnostics is the location of the diagnostics bundle of
+		// the instance, once collected.
+		Diagnostics string `json:"-"`
+		// Untrusted is set for the pipelines of untrusted repositories,
+		// the instance metadata is firewalled.
+		Untrusted bool `json:"untrusted,omitempty"`
+		// Deadline stops the steps of untrusted pipelines, if set.
+		Deadline time.Time `json:"-"`
+		// Admission is the input of the admission policies evaluated
+		// before the setup.
+		Admission *admission.Input `json:"-"`
+		// Reuse is the key of the instance, kept by the stage the
+		// pipeline depends on, the setup reclaims.
+		Reuse string `json:"reuse,omitempty"`
+		// Keep is the key the instance is kept with, instead of being
+		// destroyed, for the stage reusing it.
+		Keep string `json:"keep,omitempty"`
+		// Workspace is the directory of the workspace on the instance.
+		Workspace string `json:"workspace,omitempty"`
+		// Restore is the key of the workspace snapshot, saved by the
+		// stage the pipeline depends on, the setup restores.
+		Restore string `json:"restore,omitempty"`
+		// Snapshot is the key the workspace snapshot is saved with,
+		// before the instance is released, for the stage restoring it.
+		Snapshot string `json:"snapshot,omitempty"`
 	}
 
 	// CloudInstance provides basic instance information
 	CloudInstance struct {
-		PoolName string `json:"pool_name"`
-		ID       string `json:"id,omitempty"`
-		IP       string `json:"ip,omitempty"`
+		PoolName string            `json:"pool_name"`
+		ID       string            `json:"id,omitempty"`
+		IP       string            `json:"ip,omitempty"`
+		Tags     map[string]string `json:"tags,omitempty"`
 	}
 
 	Step struct {
 		lespec.Step
-		DependsOn []string          `json:"depends_on,omitempty"`
-		ErrPolicy runtime.ErrPolicy `json:"err_policy,omitempty"`
-		RunPolicy runtime.RunPolicy `json:"run_policy,omitempty"`
+		DependsOn []string             `json:"depends_on,omitempty"`
+		ErrPolicy runtime.ErrPolicy    `json:"err_policy,omitempty"`
+		RunPolicy runtime.RunPolicy    `json:"run_policy,omitempty"`
+		Health    *types.ServiceHealth `json:"health,omitempty"`
+		// CheckWorkingDir fails the step before it runs if its working
+		// directory does not exist.
+		CheckWorkingDir bool `json:"check_working_dir,omitempty"`
+		// Synthetic steps are run by the runner rather than on
+		// the instance, they set up and destroy it.
+		Synthetic string `json:"synthetic,omitempty"`
 	}
 	// Secret represents a secret variable.
 	// TODO: This type implements runtime.Secret unlike the one in LiteEngine. Move the interface methods to LE and remove the type.
 	Secret lespec.Secret
 )
 
+// Synthetic steps.
+const (
+	SyntheticInitialize = "initialize" // sets up the instance before the other steps
+	SyntheticCleanup    = "cleanup"    // destroys the instance after the other steps
+)
+
 //
 // implements the Spec interface
 //
@@ -51,6 +96,16 @@ type (
 func (s *Spec) StepLen() int              { return len(s.Steps) }
 func (s *Spec) StepAt(i int) runtime.Step { return s.Steps[i] }
 
+// hasStep reports whether the spec has the synthetic step.
+func (s *Spec) hasStep(synthetic string) bool {
+	for _, step := range s.Steps {
+		if step.Synthetic == synthetic {
+			return true
+		}
+	}
+	return false
+}
+
 //
 // implements the Secret interface
 //
@@ -0,0 +1,114 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// stepLogWriter caps the output of a step, so that a step flooding its
+// log does not push the output of the other steps out of the log of the
+// stage. Once the limit is reached the output is dropped after a marker,
+// but for its last lines, which are written when the step ends.
+type stepLogWriter struct {
+	w         io.Writer
+	limit     int
+	tailLines int
+
+	written int
+	dropped int
+	tail    [][]byte // the last complete lines past the limit
+	partial []byte   // the incomplete line past the limit
+}
+
+// newStepLogWriter returns the writer capping the output to the limit in
+// bytes and keeping the tail lines, the output is not capped if the limit
+// is 0.
+func newStepLogWriter(w io.Writer, limit, tailLines int) *stepLogWriter {
+	return &stepLogWriter{w: w, limit: limit, tailLines: tailLines}
+}
+
+func (s *stepLogWriter) Write(p []byte) (int, error) {
+	if s.limit <= 0 {
+		return s.w.Write(p)
+	}
+	if s.dropped == 0 {
+		if s.written+len(p) <= s.limit {
+			s.written += len(p)
+			return s.w.Write(p)
+		}
+		// the lines within the limit are written whole.
+		n := bytes.LastIndexByte(p[:s.limit-s.written], '\n') + 1
+		if _, err := s.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+		s.written += n
+		if _, err := fmt.Fprintf(s.w, "\n... (the output of the step exceeded %d bytes, it is truncated until the step ends)\n", s.limit); err != nil {
+			return 0, err
+		}
+		s.keep(p[n:])
+		return len(p), nil
+	}
+	s.keep(p)
+	return len(p), nil
+}
+
+// keep keeps the last lines of the output past the limit.
+func (s *stepLogWriter) keep(p []byte) {
+	s.dropped += len(p)
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.tail = append(s.tail, append([]byte(nil), s.partial[:i+1]...))
+		s.partial = s.partial[i+1:]
+		if len(s.tail) > s.tailLines {
+			s.tail = s.tail[1:]
+		}
+	}
+	// an incomplete line is cut to the limit.
+	if len(s.partial) > s.limit {
+		s.partial = s.partial[len(s.partial)-s.limit:]
+	}
+	s.partial = append([]byte(nil), s.partial...)
+}
+
+// Flush writes the last lines of the output past the limit, once the
+// step ended.
+func (s *stepLogWriter) Flush() error {
+	if s.dropped == 0 {
+		return nil
+	}
+	// the incomplete line ends the output.
+	partial := len(s.partial) > 0 && s.tailLines > 0
+	if partial {
+		s.tail = append(s.tail, append(s.partial, '\n'))
+		if len(s.tail) > s.tailLines {
+			s.tail = s.tail[1:]
+		}
+	}
+	shown := 0
+	for _, line := range s.tail {
+		shown += len(line)
+	}
+	// the newline ending the incomplete line was not written by the step.
+	if partial {
+		shown--
+	}
+	if _, err := fmt.Fprintf(s.w, "... (%d bytes truncated, the last %d lines of the step follow)\n", s.dropped-shown, len(s.tail)); err != nil {
+		return err
+	}
+	for _, line := range s.tail {
+		if _, err := s.w.Write(line); err != nil {
+			return err
+		}
+	}
+	s.dropped, s.tail, s.partial = 0, nil, nil
+	return nil
+}
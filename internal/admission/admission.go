@@ -0,0 +1,237 @@
+// Package admission evaluates the compiled stages against the admission
+// policies of the operators before their instances are set up. The rego
+// policies are evaluated by an Open Policy Agent server, e.g. the policy
+//
+//	package drone.admission
+//
+//	deny[msg] {
+//		input.pool.machine_type == "m5.24xlarge"
+//		input.repo.slug != "acme/heavy"
+//		msg := "m5.24xlarge instances are reserved to acme/heavy"
+//	}
+//
+// is queried at http://localhost:8181/v1/data/drone/admission/deny.
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Input is the input of the policies: the stage, its repository and build,
+// the pool of its instance and the secrets its steps request.
+type Input struct {
+	Repo      Repo    `json:"repo"`
+	Build     Build   `json:"build"`
+	Stage     Stage   `json:"stage"`
+	Pool      Pool    `json:"pool"`
+	Untrusted bool    `json:"untrusted"`
+	Steps     []*Step `json:"steps"`
+}
+
+// Repo is the repository of the stage.
+type Repo struct {
+	Slug    string `json:"slug"`
+	Private bool   `json:"private"`
+	Trusted bool   `json:"trusted"`
+}
+
+// Build is the build of the stage.
+type Build struct {
+	Number int64  `json:"number"`
+	Event  string `json:"event"`
+	Action string `json:"action,omitempty"`
+	Ref    string `json:"ref"`
+	Branch string `json:"branch"`
+	Deploy string `json:"deploy_to,omitempty"`
+	Author string `json:"author"`
+}
+
+// Stage is the stage set up.
+type Stage struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// Pool is the pool of the instance of the stage. The machine type and the
+// disk size are empty if the driver does not know them.
+type Pool struct {
+	Name        string `json:"name"`
+	Driver      string `json:"driver"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	MachineType string `json:"machine_type,omitempty"`
+	DiskSize    int64  `json:"disk_size,omitempty"` // GB
+}
+
+// Step is a step of the stage, with the names of the secrets it requests.
+type Step struct {
+	Name       string   `json:"name"`
+	Image      string   `json:"image,omitempty"`
+	Privileged bool     `json:"privileged"`
+	Detach     bool     `json:"detach"`
+	Secrets    []string `json:"secrets,omitempty"`
+}
+
+// DeniedError is returned for the stages the policies deny.
+type DeniedError struct {
+	Messages []string
+}
+
+func (e *DeniedError) Error() string {
+	return "denied by the admission policy: " + strings.Join(e.Messages, "; ")
+}
+
+// Client queries the decisions of an Open Policy Agent server.
+type Client struct {
+	endpoint string
+	token    string
+	failOpen bool
+	client   *http.Client
+}
+
+// New returns a client querying the decisions at the endpoint, e.g.
+// http://localhost:8181/v1/data/drone/admission/deny. The token, if set, is
+// sent as a bearer token. Stages are admitted if the decision cannot be
+// queried and failOpen is set.
+func New(endpoint, token string, failOpen bool, timeout time.Duration) *Client {
+	return &Client{
+		endpoint: endpoint,
+		token:    token,
+		failOpen: failOpen,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Open returns the client of the runner configuration, nil if admission
+// control is disabled.
+func Open(env *config.EnvConfig) *Client {
+	if env.Admission.Endpoint == "" {
+		return nil
+	}
+	return New(env.Admission.Endpoint, env.Admission.Token, env.Admission.FailOpen,
+		time.Duration(env.Admission.TimeoutSecs)*time.Second)
+}
+
+// Admit returns a DeniedError, with the messages of the policies, if they
+// deny the stage. A nil client admits all stages.
+func (c *Client) Admit(ctx context.Context, input *Input) error {
+	if c == nil || input == nil {
+		return nil
+	}
+	messages, err := c.query(ctx, input)
+	if err != nil {
+		if c.failOpen {
+			logrus.WithError(err).WithField("repo", input.Repo.Slug).WithField("stage", input.Stage.Name).
+				Warnln("admission: cannot query the decision, the stage is admitted")
+			return nil
+		}
+		return fmt.Errorf("admission: cannot query the decision: %w", err)
+	}
+	if len(messages) != 0 {
+		return &DeniedError{Messages: messages}
+	}
+	return nil
+}
+
+func (c *Client) query(ctx context.Context, input *Input) ([]string, error) {
+	data, err := json.Marshal(struct {
+		Input *Input `json:"input"`
+	}{input})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20)) //nolint:gomnd
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 { //nolint:gomnd
+		if len(body) > 512 { //nolint:gomnd
+			body = body[:512]
+		}
+		return nil, fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(body))
+	}
+	return parseDecision(body)
+}
+
+// parseDecision returns the deny messages of the decision of the server.
+// The result is a set of deny messages, as strings or objects with a msg
+// field, a boolean allow decision, or the document of the package with its
+// deny set or allow decision. An undefined result, e.g. the policy is not
+// loaded, is an error and does not admit the stage.
+func parseDecision(body []byte) ([]string, error) {
+	var decision struct {
+		Result interface{} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &decision); err != nil {
+		return nil, fmt.Errorf("invalid decision: %w", err)
+	}
+	switch result := decision.Result.(type) {
+	case nil:
+		return nil, errors.New("undefined decision, the policy may not be loaded")
+	case bool:
+		if !result {
+			return []string{"the stage is not allowed"}, nil
+		}
+		return nil, nil
+	case []interface{}:
+		return denyMessages(result), nil
+	case map[string]interface{}:
+		deny, hasDeny := result["deny"].([]interface{})
+		allow, hasAllow := result["allow"].(bool)
+		if !hasDeny && !hasAllow {
+			return nil, fmt.Errorf("invalid decision %s, the document has no deny set or allow decision", bytes.TrimSpace(body))
+		}
+		messages := denyMessages(deny)
+		if hasAllow && !allow && len(messages) == 0 {
+			messages = []string{"the stage is not allowed"}
+		}
+		return messages, nil
+	}
+	return nil, fmt.Errorf("invalid decision %s, want a set of deny messages or an allow decision", bytes.TrimSpace(body))
+}
+
+func denyMessages(deny []interface{}) []string {
+	messages := make([]string, 0, len(deny))
+	for _, v := range deny {
+		switch v := v.(type) {
+		case string:
+			messages = append(messages, v)
+		case map[string]interface{}:
+			if msg, ok := v["msg"].(string); ok {
+				messages = append(messages, msg)
+				continue
+			}
+			data, _ := json.Marshal(v)
+			messages = append(messages, string(data))
+		default:
+			data, _ := json.Marshal(v)
+			messages = append(messages, string(data))
+		}
+	}
+	return messages
+}
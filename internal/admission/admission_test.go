@@ -0,0 +1,104 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDecision(t *testing.T) {
+	tests := []struct {
+		body  string
+		want  []string
+		valid bool
+	}{
+		{body: `{}`},
+		{body: `{"result": null}`},
+		{body: `{"result": []}`, want: []string{}, valid: true},
+		{body: `{"result": ["too large", "no secrets"]}`, want: []string{"too large", "no secrets"}, valid: true},
+		{body: `{"result": [{"msg": "too large", "code": 1}, {"code": 2}]}`, want: []string{"too large", `{"code":2}`}, valid: true},
+		{body: `{"result": true}`, valid: true},
+		{body: `{"result": false}`, want: []string{"the stage is not allowed"}, valid: true},
+		{body: `{"result": {"allow": true, "deny": []}}`, want: []string{}, valid: true},
+		{body: `{"result": {"allow": false}}`, want: []string{"the stage is not allowed"}, valid: true},
+		{body: `{"result": {"deny": ["too large"]}}`, want: []string{"too large"}, valid: true},
+		{body: `{"result": {}}`},
+		{body: `{"result": {"rules": true}}`},
+		{body: `{"result": "deny"}`},
+		{body: `deny`},
+	}
+	for _, test := range tests {
+		got, err := parseDecision([]byte(test.body))
+		if (err == nil) != test.valid {
+			t.Errorf("Want the decision %s valid %t, got %v", test.body, test.valid, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Want the messages %q of %s, got %q", test.want, test.body, got)
+		}
+	}
+}
+
+func TestClient_Admit(t *testing.T) {
+	var got struct {
+		Input *Input `json:"input"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		if got.Input.Repo.Slug == "acme/undefined" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if got.Input.Pool.MachineType == "m5.24xlarge" {
+			_, _ = w.Write([]byte(`{"result": ["m5.24xlarge instances are reserved"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"result": []}`))
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "token", false, time.Second)
+	input := &Input{Repo: Repo{Slug: "acme/app"}, Pool: Pool{Name: "linux", MachineType: "t3.large"}}
+	if err := client.Admit(context.Background(), input); err != nil {
+		t.Errorf("Want the stage admitted, got %v", err)
+	}
+	if got.Input == nil || got.Input.Repo.Slug != "acme/app" {
+		t.Errorf("Want the input sent, got %+v", got.Input)
+	}
+
+	input.Pool.MachineType = "m5.24xlarge"
+	err := client.Admit(context.Background(), input)
+	denied := &DeniedError{}
+	if !errors.As(err, &denied) || len(denied.Messages) != 1 {
+		t.Errorf("Want the stage denied with the message of the policy, got %v", err)
+	}
+
+	if err = New(server.URL, "", false, time.Second).Admit(context.Background(), input); err == nil || errors.As(err, &denied) {
+		t.Errorf("Want an error querying the decision, got %v", err)
+	}
+	if err = New(server.URL, "", true, time.Second).Admit(context.Background(), input); err != nil {
+		t.Errorf("Want the stage admitted when failing open, got %v", err)
+	}
+
+	undefined := &Input{Repo: Repo{Slug: "acme/undefined"}}
+	if err = client.Admit(context.Background(), undefined); err == nil {
+		t.Errorf("Want an error for an undefined decision")
+	}
+	if err = New(server.URL, "token", true, time.Second).Admit(context.Background(), undefined); err != nil {
+		t.Errorf("Want the stage admitted for an undefined decision when failing open, got %v", err)
+	}
+
+	var disabled *Client
+	if err = disabled.Admit(context.Background(), input); err != nil {
+		t.Errorf("Want all stages admitted without client, got %v", err)
+	}
+}
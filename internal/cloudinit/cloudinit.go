@@ -449,9 +449,9 @@ func Linux(params *Params) (payload string) {
 	return sb.String()
 }
 
-const windowsScript = `
-<powershell>
-$ProgressPreference = 'SilentlyContinue'
+// windowsSetupScript sets up the runner on windows, it is run by the
+// <powershell> tags of the userdata.
+const windowsSetupScript = `$ProgressPreference = 'SilentlyContinue'
 echo "[DRONE] Initialization Starting"
 
 echo "[DRONE] Installing Scoop Package Manager"
@@ -508,20 +508,60 @@ if (${{ .IsHosted }} -eq $true) {
 	Write-Host "DNS server added to Ethernet interface."
 } 
 echo "[DRONE] Initialization Complete"
+`
 
-</powershell>`
+const windowsScript = "\n<powershell>\n" + windowsSetupScript + "\n</powershell>"
 
 var windowsTemplate = template.Must(template.New(oshelp.OSWindows).Funcs(funcs).Parse(windowsScript))
+var windowsSetupTemplate = template.Must(template.New(oshelp.OSWindows).Funcs(funcs).Parse(windowsSetupScript))
 
 // Windows creates a userdata file for the Windows operating system.
 func Windows(params *Params) (payload string) {
+	return executeWindows(windowsTemplate, params)
+}
+
+// WindowsFragments creates a userdata file for the Windows operating system
+// running the fragments, powershell scripts, after the runner setup. The
+// script is wrapped in the <powershell> tags, with the <persist> tag if
+// persist.
+func WindowsFragments(params *Params, persist bool, fragments ...string) (payload string) {
+	scripts := []string{executeWindows(windowsSetupTemplate, params)}
+	for _, fragment := range fragments {
+		if strings.TrimSpace(fragment) != "" {
+			scripts = append(scripts, fragment)
+		}
+	}
+	return PowerShell(strings.Join(scripts, "\n"), persist)
+}
+
+// PowerShell wraps a script in the <powershell> tags EC2Launch runs, unless
+// it has them, and adds the <persist> tag, running the script on every
+// boot, if persist. Line endings are normalized to CRLF.
+func PowerShell(script string, persist bool) string {
+	script = strings.ReplaceAll(script, "\r\n", "\n")
+	if !HasPowerShellTags(script) {
+		script = "<powershell>\n" + strings.Trim(script, "\n") + "\n</powershell>"
+	}
+	if persist && !strings.Contains(strings.ToLower(script), "<persist>") {
+		script = strings.TrimRight(script, "\n") + "\n<persist>true</persist>"
+	}
+	return strings.ReplaceAll(script, "\n", "\r\n")
+}
+
+// HasPowerShellTags reports whether windows userdata has the <powershell>
+// tags, it is a whole script rather than a fragment.
+func HasPowerShellTags(userdata string) bool {
+	return strings.Contains(strings.ToLower(userdata), "<powershell>")
+}
+
+func executeWindows(t *template.Template, params *Params) string {
 	sb := &strings.Builder{}
 
 	caCertPath := filepath.Join(certsDir, "ca-cert.pem")
 	certPath := filepath.Join(certsDir, "server-cert.pem")
 	keyPath := filepath.Join(certsDir, "server-key.pem")
 
-	_ = windowsTemplate.Execute(sb, struct {
+	_ = t.Execute(sb, struct {
 		Params
 		CertDir    string
 		CaCertPath string
@@ -53,3 +53,57 @@ func TestWindows(t *testing.T) {
 		t.Error("windows init script does not contain LE path")
 	}
 }
+
+func TestPowerShell(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		persist bool
+		want    string
+	}{
+		{
+			name:   "wrapped",
+			script: "echo one\necho two\n",
+			want:   "<powershell>\r\necho one\r\necho two\r\n</powershell>",
+		},
+		{
+			name:   "line endings normalized",
+			script: "<powershell>\r\necho one\necho two\r\n</powershell>",
+			want:   "<powershell>\r\necho one\r\necho two\r\n</powershell>",
+		},
+		{
+			name:    "persisted",
+			script:  "echo one",
+			persist: true,
+			want:    "<powershell>\r\necho one\r\n</powershell>\r\n<persist>true</persist>",
+		},
+		{
+			name:    "persist tag kept",
+			script:  "<PowerShell>\necho one\n</PowerShell>\n<persist>true</persist>\n",
+			persist: true,
+			want:    "<PowerShell>\r\necho one\r\n</PowerShell>\r\n<persist>true</persist>\r\n",
+		},
+	}
+	for _, test := range tests {
+		if got := cloudinit.PowerShell(test.script, test.persist); got != test.want {
+			t.Errorf("%s: want %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestWindowsFragments(t *testing.T) {
+	params := &cloudinit.Params{
+		LiteEnginePath: liteEnginePath,
+		CACert:         caCertFile + "\n",
+		TLSCert:        certFile + "\n",
+		TLSKey:         keyFile + "\n",
+	}
+
+	s := cloudinit.WindowsFragments(params, false, "choco install jq", "  ")
+	if strings.Count(s, "<powershell>") != 1 || !strings.HasSuffix(s, "choco install jq\r\n</powershell>") {
+		t.Errorf("want the fragment run after the setup in one script, got %q", s)
+	}
+	if !strings.Contains(s, "lite-engine") || strings.Contains(strings.ReplaceAll(s, "\r\n", ""), "\n") {
+		t.Error("want the setup with CRLF line endings")
+	}
+}
@@ -0,0 +1,164 @@
+// Package diagnostics collects a bundle of diagnostics from the instances
+// failing with an infrastructure error, before they are destroyed, and
+// archives it to a directory or an S3 bucket.
+package diagnostics
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+	lehttp "github.com/harness/lite-engine/cli/client"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Store archives the bundles.
+type Store interface {
+	// Save stores the archive under the name and returns its location.
+	Save(ctx context.Context, name string, archive []byte) (string, error)
+}
+
+// Open returns the store of the runner configuration, nil if the
+// collection of bundles is disabled.
+func Open(env *config.EnvConfig) (Store, error) {
+	switch {
+	case env.Diagnostics.S3Bucket != "":
+		return NewS3(env.Diagnostics.S3Bucket, env.Diagnostics.S3Prefix, env.Diagnostics.S3Region)
+	case env.Diagnostics.Dir != "":
+		return NewDir(env.Diagnostics.Dir)
+	}
+	return nil, nil
+}
+
+// Collect collects the diagnostics of the instance through lite-engine and
+// saves them as a gzipped tarball. It returns the location of the bundle.
+func Collect(ctx context.Context, store Store, client lehttp.Client, instance *types.Instance) (string, error) {
+	if store == nil {
+		return "", errors.New("diagnostics: no store")
+	}
+	if _, err := client.Health(ctx, false); err != nil {
+		return "", fmt.Errorf("diagnostics: lite-engine of %s is not reachable: %w", instance.ID, err)
+	}
+	files, err := lehelper.CollectDiagnostics(ctx, client, instance.Platform.OS)
+	if err != nil {
+		return "", fmt.Errorf("diagnostics: cannot collect the diagnostics of %s: %w", instance.ID, err)
+	}
+	archive, err := Archive(files, time.Now())
+	if err != nil {
+		return "", err
+	}
+	name := path.Join(instance.Pool, fmt.Sprintf("%s-%s.tar.gz", instance.ID, time.Now().UTC().Format("20060102T150405Z")))
+	location, err := store.Save(ctx, name, archive)
+	if err != nil {
+		return "", fmt.Errorf("diagnostics: cannot save the bundle of %s: %w", instance.ID, err)
+	}
+	return location, nil
+}
+
+// Archive returns the files as a gzipped tarball, in name order.
+func Archive(files map[string][]byte, modTime time.Time) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		data := files[name]
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644, //nolint:gomnd
+			Size:    int64(len(data)),
+			ModTime: modTime,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Dir is a store which writes the bundles to a directory.
+type Dir struct {
+	dir string
+}
+
+// NewDir returns a store writing to the directory, created if missing.
+func NewDir(dir string) (*Dir, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd
+		return nil, err
+	}
+	return &Dir{dir: dir}, nil
+}
+
+func (s *Dir) Save(_ context.Context, name string, archive []byte) (string, error) {
+	file := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil { //nolint:gomnd
+		return "", err
+	}
+	if err := os.WriteFile(file, archive, 0o600); err != nil { //nolint:gomnd
+		return "", err
+	}
+	return file, nil
+}
+
+// S3 is a store which uploads the bundles to an S3 bucket.
+type S3 struct {
+	bucket   string
+	prefix   string
+	uploader *s3manager.Uploader
+}
+
+// NewS3 returns a store uploading to the bucket, under the prefix.
+// Credentials are taken from the default AWS credential chain.
+func NewS3(bucket, prefix, region string) (*S3, error) {
+	cfg := fips.AWS(aws.NewConfig())
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{bucket: bucket, prefix: prefix, uploader: s3manager.NewUploader(sess)}, nil
+}
+
+func (s *S3) Save(ctx context.Context, name string, archive []byte) (string, error) {
+	key := path.Join(s.prefix, name)
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(archive),
+		ContentType: aws.String("application/gzip"),
+	})
+	if err != nil {
+		return "", err
+	}
+	return "s3://" + s.bucket + "/" + key, nil
+}
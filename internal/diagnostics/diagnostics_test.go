@@ -0,0 +1,64 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	files := map[string][]byte{
+		"free.txt": []byte("Mem: 7953\n"),
+		"df.txt":   []byte("/dev/root 20G\n"),
+	}
+	archive, err := Archive(files, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := store.Save(context.Background(), "linux/i-1.tar.gz", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(filepath.Dir(location)) != "linux" {
+		t.Errorf("want the bundle saved under the pool directory, got %s", location)
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		if string(content) != string(files[header.Name]) {
+			t.Errorf("want %s %q, got %q", header.Name, files[header.Name], content)
+		}
+		names = append(names, header.Name)
+	}
+	if len(names) != 2 || names[0] != "df.txt" || names[1] != "free.txt" {
+		t.Errorf("want the files in name order, got %v", names)
+	}
+}
@@ -0,0 +1,279 @@
+package amazon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/pricing"
+)
+
+const (
+	// pricingRegion is the region of the AWS price list API endpoint.
+	pricingRegion = "us-east-1"
+	// defaultRefresh is how long a selection is used if no refresh is configured.
+	defaultRefresh = time.Hour
+)
+
+// Cheapest selects the cheapest of equivalent instance types and zones.
+type Cheapest struct {
+	Sizes        []string // candidate instance types
+	Zones        []string // candidate availability zones, the pool zone if empty
+	MinVCPUs     int64
+	MinMemoryMiB int64
+	Refresh      time.Duration // how long a selection is used before the prices are queried again
+}
+
+// placement is an instance type in an availability zone.
+type placement struct {
+	size string
+	zone string
+}
+
+type instanceSpec struct {
+	vcpus     int64
+	memoryMiB int64
+}
+
+// priceSource returns the instance type specs and prices.
+type priceSource interface {
+	specs(ctx context.Context, sizes []string) (map[string]instanceSpec, error)
+	spotPrices(ctx context.Context, sizes, zones []string) (map[placement]float64, error)
+	onDemandPrices(ctx context.Context, sizes []string) (map[string]float64, error)
+}
+
+// cheapestSelector keeps the current selection of a pool and refreshes it
+// when it is older than the refresh interval.
+type cheapestSelector struct {
+	Cheapest
+	spot   bool
+	source priceSource
+
+	mu      sync.Mutex
+	current placement
+	price   float64
+	updated time.Time
+}
+
+// placement returns the selected instance type and zone. If the prices
+// cannot be queried the previous selection, or the fallback, is used.
+func (s *cheapestSelector) placement(ctx context.Context, fallback placement) placement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current.size != "" && time.Since(s.updated) < s.Refresh {
+		return s.current
+	}
+	logr := logger.FromContext(ctx).WithField("spot", s.spot)
+	zones := s.Zones
+	if len(zones) == 0 {
+		zones = []string{fallback.zone}
+	}
+	next, price, err := s.selectCheapest(ctx, zones)
+	// retry after the refresh interval, not on every create.
+	s.updated = time.Now()
+	if err != nil {
+		logr.WithError(err).Warnln("amazon: cannot select the cheapest instance type")
+		if s.current.size == "" {
+			s.current = fallback
+		}
+		return s.current
+	}
+	if next != s.current {
+		logr.WithField("size", next.size).
+			WithField("zone", next.zone).
+			WithField("price", price).
+			Infoln("amazon: selected the cheapest instance type")
+	}
+	s.current, s.price = next, price
+	return s.current
+}
+
+func (s *cheapestSelector) selectCheapest(ctx context.Context, zones []string) (placement, float64, error) {
+	specs, err := s.source.specs(ctx, s.Sizes)
+	if err != nil {
+		return placement{}, 0, err
+	}
+	prices := map[placement]float64{}
+	if s.spot {
+		if prices, err = s.source.spotPrices(ctx, s.Sizes, zones); err != nil {
+			return placement{}, 0, err
+		}
+	} else {
+		onDemand, priceErr := s.source.onDemandPrices(ctx, s.Sizes)
+		if priceErr != nil {
+			return placement{}, 0, priceErr
+		}
+		// on-demand prices are the same in every zone of the region.
+		for size, price := range onDemand {
+			prices[placement{size: size, zone: zones[0]}] = price
+		}
+	}
+	return cheapest(prices, specs, s.MinVCPUs, s.MinMemoryMiB)
+}
+
+// cheapest returns the cheapest placement whose instance type has at least
+// the vcpus and memory. Ties go to the first size and zone in name order.
+func cheapest(prices map[placement]float64, specs map[string]instanceSpec, minVCPUs, minMemoryMiB int64) (placement, float64, error) {
+	var candidates []placement
+	for pl := range prices {
+		spec, ok := specs[pl.size]
+		if !ok || spec.vcpus < minVCPUs || spec.memoryMiB < minMemoryMiB {
+			continue
+		}
+		candidates = append(candidates, pl)
+	}
+	if len(candidates) == 0 {
+		return placement{}, 0, fmt.Errorf("no instance type with %d vcpus and %d MiB memory has a price", minVCPUs, minMemoryMiB)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if prices[a] != prices[b] {
+			return prices[a] < prices[b]
+		}
+		if a.size != b.size {
+			return a.size < b.size
+		}
+		return a.zone < b.zone
+	})
+	return candidates[0], prices[candidates[0]], nil
+}
+
+// awsPrices queries the ec2 api for specs and spot prices, and the price
+// list api for on-demand prices.
+type awsPrices struct {
+	service *ec2.EC2
+	pricing *pricing.Pricing
+	region  string
+	windows bool
+}
+
+func newAWSPrices(p *config, windows bool) *awsPrices {
+	return &awsPrices{
+		service: p.service,
+		pricing: pricing.New(session.Must(session.NewSession()), p.service.Config.Copy(aws.NewConfig().WithRegion(pricingRegion))),
+		region:  p.region,
+		windows: windows,
+	}
+}
+
+func (a *awsPrices) specs(ctx context.Context, sizes []string) (map[string]instanceSpec, error) {
+	out := map[string]instanceSpec{}
+	err := a.service.DescribeInstanceTypesPagesWithContext(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice(sizes),
+	}, func(page *ec2.DescribeInstanceTypesOutput, _ bool) bool {
+		for _, t := range page.InstanceTypes {
+			spec := instanceSpec{}
+			if t.VCpuInfo != nil {
+				spec.vcpus = aws.Int64Value(t.VCpuInfo.DefaultVCpus)
+			}
+			if t.MemoryInfo != nil {
+				spec.memoryMiB = aws.Int64Value(t.MemoryInfo.SizeInMiB)
+			}
+			out[aws.StringValue(t.InstanceType)] = spec
+		}
+		return true
+	})
+	return out, err
+}
+
+func (a *awsPrices) spotPrices(ctx context.Context, sizes, zones []string) (map[placement]float64, error) {
+	product := "Linux/UNIX"
+	if a.windows {
+		product = "Windows"
+	}
+	wanted := map[string]bool{}
+	for _, zone := range zones {
+		wanted[zone] = true
+	}
+	out := map[placement]float64{}
+	// the history is sorted newest first, the first price is the current one.
+	err := a.service.DescribeSpotPriceHistoryPagesWithContext(ctx, &ec2.DescribeSpotPriceHistoryInput{
+		InstanceTypes:       aws.StringSlice(sizes),
+		ProductDescriptions: []*string{aws.String(product)},
+		StartTime:           aws.Time(time.Now()),
+	}, func(page *ec2.DescribeSpotPriceHistoryOutput, _ bool) bool {
+		for _, h := range page.SpotPriceHistory {
+			pl := placement{size: aws.StringValue(h.InstanceType), zone: aws.StringValue(h.AvailabilityZone)}
+			if _, seen := out[pl]; seen || !wanted[pl.zone] {
+				continue
+			}
+			if price, err := strconv.ParseFloat(aws.StringValue(h.SpotPrice), 64); err == nil {
+				out[pl] = price
+			}
+		}
+		return true
+	})
+	return out, err
+}
+
+func (a *awsPrices) onDemandPrices(ctx context.Context, sizes []string) (map[string]float64, error) {
+	osName := "Linux"
+	if a.windows {
+		osName = "Windows"
+	}
+	out := map[string]float64{}
+	for _, size := range sizes {
+		res, err := a.pricing.GetProductsWithContext(ctx, &pricing.GetProductsInput{
+			ServiceCode: aws.String("AmazonEC2"),
+			Filters: []*pricing.Filter{
+				termMatch("instanceType", size),
+				termMatch("regionCode", a.region),
+				termMatch("operatingSystem", osName),
+				termMatch("tenancy", "Shared"),
+				termMatch("preInstalledSw", "NA"),
+				termMatch("capacitystatus", "Used"),
+			},
+			MaxResults: aws.Int64(1),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range res.PriceList {
+			if price, ok := onDemandPrice(product); ok {
+				out[size] = price
+			}
+		}
+	}
+	return out, nil
+}
+
+func termMatch(field, value string) *pricing.Filter {
+	return &pricing.Filter{Type: aws.String(pricing.FilterTypeTermMatch), Field: aws.String(field), Value: aws.String(value)}
+}
+
+// onDemandPrice returns the hourly USD price of a price list product.
+func onDemandPrice(product aws.JSONValue) (float64, bool) {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return 0, false
+	}
+	var doc struct {
+		Terms struct {
+			OnDemand map[string]struct {
+				PriceDimensions map[string]struct {
+					PricePerUnit map[string]string `json:"pricePerUnit"`
+				} `json:"priceDimensions"`
+			} `json:"OnDemand"`
+		} `json:"terms"`
+	}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return 0, false
+	}
+	for _, term := range doc.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			if price, parseErr := strconv.ParseFloat(dimension.PricePerUnit["USD"], 64); parseErr == nil {
+				return price, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,205 @@
+package amazon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func Test_cheapest(t *testing.T) {
+	specs := map[string]instanceSpec{
+		"m5.large":  {vcpus: 2, memoryMiB: 8192},
+		"m5a.large": {vcpus: 2, memoryMiB: 8192},
+		"m5.xlarge": {vcpus: 4, memoryMiB: 16384},
+	}
+	tests := []struct {
+		name      string
+		prices    map[placement]float64
+		minVCPUs  int64
+		minMemory int64
+		want      placement
+		wantErr   bool
+	}{
+		{
+			name: "lowest price",
+			prices: map[placement]float64{
+				{size: "m5.large", zone: "us-east-1a"}:  0.096,
+				{size: "m5a.large", zone: "us-east-1a"}: 0.086,
+				{size: "m5a.large", zone: "us-east-1b"}: 0.031,
+			},
+			want: placement{size: "m5a.large", zone: "us-east-1b"},
+		},
+		{
+			name: "minimum vcpus",
+			prices: map[placement]float64{
+				{size: "m5a.large", zone: "us-east-1a"}: 0.086,
+				{size: "m5.xlarge", zone: "us-east-1a"}: 0.192,
+			},
+			minVCPUs: 4,
+			want:     placement{size: "m5.xlarge", zone: "us-east-1a"},
+		},
+		{
+			name: "tie goes to the first name",
+			prices: map[placement]float64{
+				{size: "m5a.large", zone: "us-east-1b"}: 0.05,
+				{size: "m5.large", zone: "us-east-1b"}:  0.05,
+				{size: "m5.large", zone: "us-east-1a"}:  0.05,
+			},
+			want: placement{size: "m5.large", zone: "us-east-1a"},
+		},
+		{
+			name: "unknown size is skipped",
+			prices: map[placement]float64{
+				{size: "c5.large", zone: "us-east-1a"}: 0.01,
+				{size: "m5.large", zone: "us-east-1a"}: 0.096,
+			},
+			want: placement{size: "m5.large", zone: "us-east-1a"},
+		},
+		{
+			name: "no match",
+			prices: map[placement]float64{
+				{size: "m5.large", zone: "us-east-1a"}: 0.096,
+			},
+			minMemory: 32768,
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _, err := cheapest(test.prices, specs, test.minVCPUs, test.minMemory)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("cheapest() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("cheapest() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func Test_onDemandPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		product string
+		want    float64
+		wantOK  bool
+	}{
+		{
+			name:    "price",
+			product: `{"terms":{"OnDemand":{"ABC.JRTCKXETXF":{"priceDimensions":{"ABC.JRTCKXETXF.6YS6EN2CT7":{"pricePerUnit":{"USD":"0.0960000000"}}}}}}}`,
+			want:    0.096,
+			wantOK:  true,
+		},
+		{
+			name:    "no on-demand terms",
+			product: `{"terms":{"Reserved":{}}}`,
+		},
+		{
+			name:    "invalid price",
+			product: `{"terms":{"OnDemand":{"A":{"priceDimensions":{"B":{"pricePerUnit":{"USD":"n/a"}}}}}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			product := aws.JSONValue{}
+			if err := json.Unmarshal([]byte(test.product), &product); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := onDemandPrice(product)
+			if ok != test.wantOK {
+				t.Fatalf("onDemandPrice() ok = %v, want %v", ok, test.wantOK)
+			}
+			if got != test.want {
+				t.Errorf("onDemandPrice() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+type fakePrices struct {
+	spot     map[placement]float64
+	onDemand map[string]float64
+	err      error
+	calls    int
+}
+
+func (f *fakePrices) specs(ctx context.Context, sizes []string) (map[string]instanceSpec, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := map[string]instanceSpec{}
+	for _, size := range sizes {
+		out[size] = instanceSpec{vcpus: 2, memoryMiB: 8192}
+	}
+	return out, nil
+}
+
+func (f *fakePrices) spotPrices(ctx context.Context, sizes, zones []string) (map[placement]float64, error) {
+	return f.spot, nil
+}
+
+func (f *fakePrices) onDemandPrices(ctx context.Context, sizes []string) (map[string]float64, error) {
+	return f.onDemand, nil
+}
+
+func TestCheapestSelector(t *testing.T) {
+	fallback := placement{size: "m5.large", zone: "us-east-1a"}
+
+	t.Run("on-demand uses the pool zone", func(t *testing.T) {
+		s := &cheapestSelector{
+			Cheapest: Cheapest{Sizes: []string{"m5.large", "m5a.large"}, Refresh: time.Hour},
+			source:   &fakePrices{onDemand: map[string]float64{"m5.large": 0.096, "m5a.large": 0.086}},
+		}
+		want := placement{size: "m5a.large", zone: "us-east-1a"}
+		if got := s.placement(context.Background(), fallback); got != want {
+			t.Errorf("placement() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("spot is cached until refresh", func(t *testing.T) {
+		source := &fakePrices{spot: map[placement]float64{
+			{size: "m5.large", zone: "us-east-1b"}: 0.03,
+			{size: "m5.large", zone: "us-east-1a"}: 0.04,
+		}}
+		s := &cheapestSelector{
+			Cheapest: Cheapest{Sizes: []string{"m5.large"}, Zones: []string{"us-east-1a", "us-east-1b"}, Refresh: time.Hour},
+			spot:     true,
+			source:   source,
+		}
+		want := placement{size: "m5.large", zone: "us-east-1b"}
+		for i := 0; i < 3; i++ {
+			if got := s.placement(context.Background(), fallback); got != want {
+				t.Errorf("placement() = %v, want %v", got, want)
+			}
+		}
+		if source.calls != 1 {
+			t.Errorf("prices queried %d times, want 1", source.calls)
+		}
+		s.updated = time.Now().Add(-2 * time.Hour)
+		s.placement(context.Background(), fallback)
+		if source.calls != 2 {
+			t.Errorf("prices queried %d times after refresh, want 2", source.calls)
+		}
+	})
+
+	t.Run("error keeps the previous selection", func(t *testing.T) {
+		source := &fakePrices{err: errors.New("throttled")}
+		s := &cheapestSelector{
+			Cheapest: Cheapest{Sizes: []string{"m5a.large"}, Refresh: time.Hour},
+			source:   source,
+		}
+		if got := s.placement(context.Background(), fallback); got != fallback {
+			t.Errorf("placement() = %v, want the fallback %v", got, fallback)
+		}
+		previous := placement{size: "m5a.large", zone: "us-east-1a"}
+		s.current, s.updated = previous, time.Time{}
+		if got := s.placement(context.Background(), fallback); got != previous {
+			t.Errorf("placement() = %v, want the previous selection %v", got, previous)
+		}
+	})
+}
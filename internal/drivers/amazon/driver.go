@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/runner-go/logger"
@@ -18,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/dchest/uniuri"
@@ -27,6 +30,7 @@ import (
 type config struct {
 	spotInstance     bool
 	region           string
+	partition        string // aws, aws-cn or aws-us-gov, derived from region
 	availabilityZone string
 	retries          int
 
@@ -42,6 +46,9 @@ type config struct {
 	sizeAlt       string
 	user          string
 	userData      string
+	persist       bool   // windows userdata is run on every boot
+	nameTemplate  string // template of the Name tag, runner-pool-random if empty
+	serialConsole bool   // fetch the latest console output and give access to the serial console
 	subnet        string
 	vpc           string
 	groups        []string
@@ -50,11 +57,27 @@ type config struct {
 	volumeSize    int64
 	volumeIops    int64
 	kmsKeyID      string
-	deviceName    string
+	deviceName    string // root device, the one of the image if empty
 	iamProfileArn string
 	tags          map[string]string // user defined tags
 	hibernate     bool
 
+	defaultDeviceName string // root device if the image cannot be described
+
+	cheapestSpec    *Cheapest
+	cheapestWindows bool
+	cheapest        *cheapestSelector // picks size and zone by price, if set
+
+	stack          *Stack // created and deleted with each instance, if set
+	stackService   *cloudformation.CloudFormation
+	auditInterface *AuditInterface // attached to each instance, if set
+	metadata       *Metadata       // instance metadata service options, if set
+
+	failoverSpecs []Failover
+	failover      []*failoverRegion // secondary regions, in order
+
+	validation *validationCache // image, subnet and security groups checked last
+
 	service *ec2.EC2
 }
 
@@ -68,25 +91,82 @@ func New(opts ...Option) (drivers.Driver, error) {
 	for _, opt := range opts {
 		opt(p)
 	}
+	if p.region != "" {
+		partition, err := partitionForRegion(p.region)
+		if err != nil {
+			return nil, err
+		}
+		p.partition = partition
+		if err := p.validatePartition(); err != nil {
+			return nil, err
+		}
+	}
 	// setup service
 	if p.service == nil {
-		config := &aws.Config{
-			Region:     aws.String(p.region),
-			MaxRetries: aws.Int(p.retries),
-		}
-		if p.accessKeyID != "" && p.secretAccessKey != "" {
-			if p.sessionToken != "" {
-				config.Credentials = credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, p.sessionToken)
-			} else {
-				config.Credentials = credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, "")
-			}
+		p.service = p.newService()
+	}
+	if err := validateNameTemplate(p.nameTemplate); err != nil {
+		return nil, err
+	}
+	p.validation = &validationCache{}
+	if p.cheapestSpec != nil && len(p.cheapestSpec.Sizes) > 0 {
+		if p.cheapestSpec.Refresh <= 0 {
+			p.cheapestSpec.Refresh = defaultRefresh
+		}
+		p.cheapest = &cheapestSelector{
+			Cheapest: *p.cheapestSpec,
+			spot:     p.spotInstance,
+			source:   newAWSPrices(p, p.cheapestWindows),
 		}
-		mySession := session.Must(session.NewSession())
-		p.service = ec2.New(mySession, config)
+	}
+	if p.stack != nil {
+		if p.stack.Template == "" {
+			return nil, errors.New("amazon: stack template is required")
+		}
+		p.stackService = p.newStackService()
+	}
+	if p.metadata != nil {
+		if err := p.metadata.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if p.auditInterface != nil {
+		if len(p.auditInterface.SecurityGroups) == 0 {
+			return nil, errors.New("amazon: audit interface security groups are required")
+		}
+		// the subnet and security groups of the audit interface belong to the region of the pool.
+		if len(p.failoverSpecs) > 0 {
+			return nil, errors.New("amazon: audit interface cannot be used with failover regions")
+		}
+	}
+	for _, spec := range p.failoverSpecs {
+		region, err := p.newFailoverRegion(spec)
+		if err != nil {
+			return nil, err
+		}
+		p.failover = append(p.failover, region)
 	}
 	return p, nil
 }
 
+// newService returns an ec2 client for the region of the config.
+func (p *config) newService() *ec2.EC2 {
+	config := &aws.Config{
+		Region:     aws.String(p.region),
+		MaxRetries: aws.Int(p.retries),
+	}
+	fips.AWS(config)
+	if p.accessKeyID != "" && p.secretAccessKey != "" {
+		if p.sessionToken != "" {
+			config.Credentials = credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, p.sessionToken)
+		} else {
+			config.Credentials = credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, "")
+		}
+	}
+	mySession := session.Must(session.NewSession())
+	return ec2.New(mySession, config)
+}
+
 func (p *config) DriverName() string {
 	return string(types.Amazon)
 }
@@ -103,11 +183,21 @@ func (p *config) CanHibernate() bool {
 	return p.hibernate
 }
 
+func (p *config) MachineType() string {
+	return p.size
+}
+
+func (p *config) DiskSize() int64 {
+	return p.volumeSize
+}
+
 const (
 	defaultSecurityGroupName = "harness-runner"
 )
 
-// Ping checks that we can log into EC2, and the regions respond
+// Ping checks that we can log into EC2, the regions respond, the image,
+// the subnet and the security groups of the pool exist, and that an
+// instance of the pool can be launched.
 func (p *config) Ping(ctx context.Context) error {
 	client := p.service
 
@@ -116,8 +206,13 @@ func (p *config) Ping(ctx context.Context) error {
 		AllRegions: &allRegions,
 	}
 	_, err := client.DescribeRegionsWithContext(ctx, input)
-
-	return err
+	if err != nil {
+		return err
+	}
+	if err = p.validate(ctx); err != nil {
+		return err
+	}
+	return p.dryRun(ctx)
 }
 
 func lookupCreateSecurityGroupID(ctx context.Context, client *ec2.EC2, vpc string) (string, error) {
@@ -187,16 +282,52 @@ func checkIngressRules(ctx context.Context, client *ec2.EC2, groupID string) err
 }
 
 // Create an AWS instance for the pool, it will not perform build specific setup.
+// If the region has no capacity or is unavailable, the instance is created in
+// the failover regions in turn.
 func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	instance, err = p.create(ctx, opts)
+	region := p.region
+	for _, next := range p.failover {
+		if !isRegionUnavailable(err) {
+			break
+		}
+		logr := logger.FromContext(ctx).
+			WithField("driver", types.Amazon).
+			WithField("pool", opts.PoolName)
+		logr.WithError(err).Warnf("amazon: cannot provision in region %s, failing over to region %s", region, next.region)
+		if imageErr := next.resolveImage(ctx, p); imageErr != nil {
+			logr.WithError(imageErr).Errorf("amazon: cannot resolve the image in region %s", next.region)
+			continue
+		}
+		instance, err = next.create(ctx, opts)
+		region = next.region
+	}
+	if err == nil && region != p.region {
+		logger.FromContext(ctx).
+			WithField("driver", types.Amazon).
+			WithField("pool", opts.PoolName).
+			WithField("id", instance.ID).
+			Infof("amazon: instance provisioned in failover region %s", region)
+	}
+	return instance, err
+}
+
+func (p *config) create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
 	client := p.service
 	startTime := time.Now()
+	size, zone := p.size, p.availabilityZone
+	if p.cheapest != nil {
+		selected := p.cheapest.placement(ctx, placement{size: size, zone: zone})
+		size, zone = selected.size, selected.zone
+	}
 	logr := logger.FromContext(ctx).
 		WithField("driver", types.Amazon).
 		WithField("ami", p.InstanceType()).
 		WithField("pool", opts.PoolName).
 		WithField("region", p.region).
 		WithField("image", p.image).
-		WithField("size", p.size).
+		WithField("size", size).
+		WithField("zone", zone).
 		WithField("hibernate", p.CanHibernate())
 	var name = fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
 	var tags = map[string]string{
@@ -206,29 +337,147 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 	for k, v := range p.tags {
 		tags[k] = v
 	}
+	if p.nameTemplate != "" {
+		tags["Name"] = renderName(p.nameTemplate, nameValues(opts, ""))
+	}
+	tags[ownerTag] = opts.RunnerName
 	if p.vpc == "" {
 		logr.Traceln("amazon: using default vpc, checking security groups")
 	} else {
 		logr.Tracef("amazon: using vpc %s, checking security groups", p.vpc)
 	}
-	// check security group exists
-	if p.groups == nil || len(p.groups) == 0 {
-		logr.Warnf("aws: no security group specified assuming '%s'", defaultSecurityGroupName)
-		// lookup/create group
-		returnedGroupID, lookupErr := lookupCreateSecurityGroupID(ctx, client, p.vpc)
-		if lookupErr != nil {
-			return nil, lookupErr
+	// check the image, the subnet and the security groups, the result is
+	// cached so that not every instance describes them.
+	if validateErr := p.validate(ctx); validateErr != nil {
+		return nil, validateErr
+	}
+
+	logr.Traceln("amazon: provisioning VM")
+
+	generated, err := p.generateUserData(opts)
+	if err != nil {
+		logr.WithError(err).Errorln("amazon: [provision] invalid user data")
+		return nil, err
+	}
+	userData, err := encodeUserData(generated,
+		userDataSections(generated, p.userData, opts.CACert, opts.TLSCert, opts.TLSKey),
+		opts.Platform.OS == oshelp.OSLinux)
+	if err != nil {
+		logr.WithError(err).Errorln("amazon: [provision] invalid user data")
+		return nil, err
+	}
+	in := p.runInstancesInput(size, zone, userData, tags)
+
+	runResult, err := client.RunInstancesWithContext(ctx, in)
+	if err != nil {
+		err = withRequestID(err)
+		logr.WithError(err).
+			Errorln("amazon: [provision] failed to create VMs")
+		if isCapacityOrOutage(err) {
+			return nil, &regionUnavailableError{region: p.region, err: err}
 		}
-		p.groups = append(p.groups, returnedGroupID)
+		return nil, err
 	}
-	// check the security group ingress rules
-	rulesErr := checkIngressRules(ctx, client, p.groups[0])
-	if rulesErr != nil {
-		return nil, rulesErr
+
+	if len(runResult.Instances) == 0 {
+		err = fmt.Errorf("failed to create an AWS EC2 instance")
+		return nil, err
 	}
 
-	logr.Traceln("amazon: provisioning VM")
+	awsInstanceID := runResult.Instances[0].InstanceId
+
+	logr = logr.
+		WithField("id", *awsInstanceID)
+
+	logr.Debugln("amazon: [provision] created instance")
+
+	// poll the amazon endpoint for server updates and exit when a network address is allocated.
+	var amazonInstance *ec2.Instance
+	amazonInstance, err = p.pollInstanceIPAddr(ctx, *awsInstanceID, logr)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.auditInterface != nil {
+		if err = p.attachAuditInterface(ctx, amazonInstance, tags); err != nil {
+			logr.WithError(err).Errorln("amazon: [provision] failed to attach the audit interface, terminating the instance")
+			if destroyErr := p.destroy(ctx, []*types.Instance{{ID: *amazonInstance.InstanceId}}); destroyErr != nil {
+				logr.WithError(destroyErr).Errorln("amazon: [provision] failed to terminate the instance")
+			}
+			return nil, err
+		}
+	}
+
+	if p.stack != nil {
+		if err = p.createStack(ctx, amazonInstance); err != nil {
+			logr.WithError(err).Errorln("amazon: [provision] failed to create the stack, terminating the instance")
+			if destroyErr := p.destroy(ctx, []*types.Instance{{ID: *amazonInstance.InstanceId}}); destroyErr != nil {
+				logr.WithError(destroyErr).Errorln("amazon: [provision] failed to terminate the instance")
+			}
+			return nil, err
+		}
+	}
+
+	instanceID := *amazonInstance.InstanceId
+	instanceIP := p.getIP(amazonInstance)
+	launchTime := p.getLaunchTime(amazonInstance)
+
+	instance = &types.Instance{
+		ID:           instanceID,
+		Name:         instanceID,
+		Provider:     types.Amazon, // this is driver, though its the old legacy name of provider
+		State:        types.StateCreated,
+		Pool:         opts.PoolName,
+		Image:        p.image,
+		Zone:         zone,
+		Region:       p.region,
+		Size:         size,
+		Platform:     opts.Platform,
+		Address:      instanceIP,
+		CACert:       opts.CACert,
+		CAKey:        opts.CAKey,
+		TLSCert:      opts.TLSCert,
+		TLSKey:       opts.TLSKey,
+		Started:      launchTime.Unix(),
+		Updated:      time.Now().Unix(),
+		IsHibernated: false,
+		Port:         lehelper.LiteEnginePort,
+	}
+	// the short id is the end of the instance id, known once it is created.
+	if usesPlaceholder(p.nameTemplate, "short-id") {
+		name := renderName(p.nameTemplate, nameValues(opts, instanceID))
+		if tagErr := p.SetTags(ctx, instance, map[string]string{"Name": name}); tagErr != nil {
+			logr.WithError(tagErr).Warnln("amazon: [provision] failed to set the name of the instance")
+		}
+	}
+	logr.
+		WithField("ip", instanceIP).
+		WithField("time", fmt.Sprintf("%.2fs", time.Since(startTime).Seconds())).
+		Debugln("amazon: [provision] complete")
+
+	return instance, nil
+}
 
+// runInstancesInput returns the request launching an instance of the pool.
+// tagSpecifications returns the tags of the instance and of the resources
+// created with it, so that its volumes and network interfaces are
+// attributed and cleaned up with it.
+func (p *config) tagSpecifications(tags map[string]string) []*ec2.TagSpecification {
+	resources := []string{ec2.ResourceTypeInstance, ec2.ResourceTypeVolume, ec2.ResourceTypeNetworkInterface}
+	if p.spotInstance {
+		resources = append(resources, ec2.ResourceTypeSpotInstancesRequest)
+	}
+	specs := make([]*ec2.TagSpecification, len(resources))
+	for i, resource := range resources {
+		specs[i] = &ec2.TagSpecification{
+			ResourceType: aws.String(resource),
+			Tags:         convertTags(tags),
+		}
+	}
+	return specs
+}
+
+func (p *config) runInstancesInput(size, zone string, userData []byte, tags map[string]string) *ec2.RunInstancesInput {
 	var iamProfile *ec2.IamInstanceProfileSpecification
 	if p.iamProfileArn != "" {
 		iamProfile = &ec2.IamInstanceProfileSpecification{
@@ -238,16 +487,12 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 
 	in := &ec2.RunInstancesInput{
 		ImageId:            aws.String(p.image),
-		InstanceType:       aws.String(p.size),
-		Placement:          &ec2.Placement{AvailabilityZone: aws.String(p.availabilityZone)},
+		InstanceType:       aws.String(size),
+		Placement:          &ec2.Placement{AvailabilityZone: aws.String(zone)},
 		MinCount:           aws.Int64(1),
 		MaxCount:           aws.Int64(1),
 		IamInstanceProfile: iamProfile,
-		UserData: aws.String(
-			base64.StdEncoding.EncodeToString(
-				[]byte(lehelper.GenerateUserdata(p.userData, opts)),
-			),
-		),
+		UserData:           aws.String(base64.StdEncoding.EncodeToString(userData)),
 		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
 			{
 				AssociatePublicIpAddress: aws.Bool(p.allocPublicIP),
@@ -256,15 +501,10 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 				Groups:                   aws.StringSlice(p.groups),
 			},
 		},
-		TagSpecifications: []*ec2.TagSpecification{
-			{
-				ResourceType: aws.String("instance"),
-				Tags:         convertTags(tags),
-			},
-		},
+		TagSpecifications: p.tagSpecifications(tags),
 		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
 			{
-				DeviceName: aws.String(p.deviceName),
+				DeviceName: aws.String(p.rootDeviceName()),
 				Ebs: &ec2.EbsBlockDevice{
 					VolumeSize:          aws.Int64(p.volumeSize),
 					VolumeType:          aws.String(p.volumeType),
@@ -273,9 +513,15 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 			},
 		},
 	}
+	in.MetadataOptions = metadataOptions(p.metadata)
 	if p.keyPairName != "" {
 		in.KeyName = aws.String(p.keyPairName)
 	}
+	if p.spotInstance {
+		in.InstanceMarketOptions = &ec2.InstanceMarketOptionsRequest{
+			MarketType: aws.String(ec2.MarketTypeSpot),
+		}
+	}
 
 	if p.volumeType == "io1" {
 		for _, blockDeviceMapping := range in.BlockDeviceMappings {
@@ -299,99 +545,63 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 			Configured: aws.Bool(true),
 		}
 	}
+	return in
+}
 
-	runResult, err := client.RunInstancesWithContext(ctx, in)
-	if err != nil {
-		logr.WithError(err).
-			Errorln("amazon: [provision] failed to create VMs")
-		return nil, err
-	}
-
-	if len(runResult.Instances) == 0 {
-		err = fmt.Errorf("failed to create an AWS EC2 instance")
-		return nil, err
+// Destroy destroys the server AWS EC2 instances.
+func (p *config) Destroy(ctx context.Context, instances []*types.Instance) (err error) {
+	if len(instances) == 0 {
+		return fmt.Errorf("no instance IDs provided")
 	}
 
-	awsInstanceID := runResult.Instances[0].InstanceId
-
-	logr = logr.
-		WithField("id", *awsInstanceID)
-
-	logr.Debugln("amazon: [provision] created instance")
-
-	// poll the amazon endpoint for server updates and exit when a network address is allocated.
-	var amazonInstance *ec2.Instance
-	amazonInstance, err = p.pollInstanceIPAddr(ctx, *awsInstanceID, logr)
-	if err != nil {
-		return nil, err
+	// instances created in a failover region are terminated there.
+	byRegion := map[*config][]*types.Instance{}
+	for _, instance := range instances {
+		c := p.regionOf(instance.Region)
+		byRegion[c] = append(byRegion[c], instance)
 	}
-
-	instanceID := *amazonInstance.InstanceId
-	instanceIP := p.getIP(amazonInstance)
-	launchTime := p.getLaunchTime(amazonInstance)
-
-	instance = &types.Instance{
-		ID:           instanceID,
-		Name:         instanceID,
-		Provider:     types.Amazon, // this is driver, though its the old legacy name of provider
-		State:        types.StateCreated,
-		Pool:         opts.PoolName,
-		Image:        p.image,
-		Zone:         p.availabilityZone,
-		Region:       p.region,
-		Size:         p.size,
-		Platform:     opts.Platform,
-		Address:      instanceIP,
-		CACert:       opts.CACert,
-		CAKey:        opts.CAKey,
-		TLSCert:      opts.TLSCert,
-		TLSKey:       opts.TLSKey,
-		Started:      launchTime.Unix(),
-		Updated:      time.Now().Unix(),
-		IsHibernated: false,
-		Port:         lehelper.LiteEnginePort,
+	for c, regionInstances := range byRegion {
+		if destroyErr := c.destroy(ctx, regionInstances); destroyErr != nil {
+			err = destroyErr
+		}
 	}
-	logr.
-		WithField("ip", instanceIP).
-		WithField("time", fmt.Sprintf("%.2fs", time.Since(startTime).Seconds())).
-		Debugln("amazon: [provision] complete")
-
-	return instance, nil
+	return err
 }
 
-// Destroy destroys the server AWS EC2 instances.
-func (p *config) Destroy(ctx context.Context, instances []*types.Instance) (err error) {
+func (p *config) destroy(ctx context.Context, instances []*types.Instance) (err error) {
 	var instanceIDs []string
 	for _, instance := range instances {
 		instanceIDs = append(instanceIDs, instance.ID)
 	}
-	if len(instanceIDs) == 0 {
-		return fmt.Errorf("no instance IDs provided")
-	}
-
-	client := p.service
 
 	logr := logger.FromContext(ctx).
 		WithField("id", instanceIDs).
 		WithField("driver", types.Amazon)
 
-	awsIDs := make([]*string, len(instanceIDs))
-	for i, instanceID := range instanceIDs {
-		awsIDs[i] = aws.String(instanceID)
-	}
-
-	_, err = client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: awsIDs})
+	err = p.terminate(instanceIDs, logr)
 	if err != nil {
-		err = fmt.Errorf("failed to terminate instances: %v", err)
 		logr.Error(err)
 		return err
 	}
 
 	logr.Traceln("amazon: VM terminated")
+
+	// the stack resources may be attached to the instances, they are deleted once the instances terminate.
+	if p.stack != nil {
+		for _, instanceID := range instanceIDs {
+			p.deleteStack(ctx, instanceID)
+		}
+	}
 	return nil
 }
 
 func (p *config) Logs(ctx context.Context, instanceID string) (string, error) {
+	if c := p.lookupRegion(ctx, instanceID); c != p {
+		return c.Logs(ctx, instanceID)
+	}
+	if p.serialConsole {
+		return p.serialConsoleLogs(ctx, instanceID)
+	}
 	client := p.service
 
 	output, err := client.GetConsoleOutputWithContext(ctx, &ec2.GetConsoleOutputInput{
@@ -421,9 +631,25 @@ func (p *config) SetTags(ctx context.Context, instance *types.Instance,
 			Value: aws.String(value),
 		})
 	}
+	c := p.regionOf(instance.Region)
+	client := c.service
+	if name := claimName(c.nameTemplate, instance, tags); name != "" && tags["Name"] == "" {
+		in.Tags = append(in.Tags, &ec2.Tag{
+			Key:   aws.String("Name"),
+			Value: aws.String(name),
+		})
+	}
+	// the interfaces carry the tags too, so that flow logs can be attributed to the build.
+	if c.auditInterface != nil {
+		ids, err := c.networkInterfaces(ctx, instance.ID)
+		if err != nil {
+			return fmt.Errorf("amazon: failed to list the network interfaces: %w", err)
+		}
+		in.Resources = append(in.Resources, ids...)
+	}
 	var err error
 	for i := 0; i < tagRetries; i++ {
-		_, err = p.service.CreateTagsWithContext(ctx, in)
+		_, err = client.CreateTagsWithContext(ctx, in)
 		if err == nil {
 			return nil
 		}
@@ -435,6 +661,9 @@ func (p *config) SetTags(ctx context.Context, instance *types.Instance,
 }
 
 func (p *config) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	if c := p.lookupRegion(ctx, instanceID); c != p {
+		return c.Hibernate(ctx, instanceID, poolName)
+	}
 	logr := logger.FromContext(ctx).
 		WithField("driver", types.Amazon).
 		WithField("pool", poolName).
@@ -475,6 +704,9 @@ func isHibernateRetryable(origErr error) bool {
 }
 
 func (p *config) Start(ctx context.Context, instanceID, poolName string) (string, error) {
+	if c := p.lookupRegion(ctx, instanceID); c != p {
+		return c.Start(ctx, instanceID, poolName)
+	}
 	client := p.service
 
 	logr := logger.FromContext(ctx).
@@ -501,6 +733,7 @@ func (p *config) Start(ctx context.Context, instanceID, poolName string) (string
 	_, err = client.StartInstancesWithContext(ctx,
 		&ec2.StartInstancesInput{InstanceIds: []*string{aws.String(instanceID)}})
 	if err != nil {
+		err = withRequestID(err)
 		logr.WithError(err).
 			Errorln("aws: failed to start VMs")
 		return "", err
@@ -0,0 +1,108 @@
+package amazon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const auditInterfaceDeviceIndex = 1
+
+// AuditInterface is a network interface attached to each instance, in a
+// fixed subnet and with fixed security groups, so that flow logs of the
+// interface capture the traffic of a single build. The interface carries
+// the tags of the build and is deleted with the instance.
+type AuditInterface struct {
+	SubnetID       string
+	SecurityGroups []string
+}
+
+// attachAuditInterface creates the audit interface of the instance and
+// attaches it as the secondary interface.
+func (p *config) attachAuditInterface(ctx context.Context, instance *ec2.Instance, tags map[string]string) error {
+	instanceID := aws.StringValue(instance.InstanceId)
+	logr := logger.FromContext(ctx).
+		WithField("driver", types.Amazon).
+		WithField("id", instanceID)
+
+	subnet := p.auditInterface.SubnetID
+	if subnet == "" {
+		subnet = aws.StringValue(instance.SubnetId)
+	}
+	created, err := p.service.CreateNetworkInterfaceWithContext(ctx, &ec2.CreateNetworkInterfaceInput{
+		SubnetId:    aws.String(subnet),
+		Groups:      aws.StringSlice(p.auditInterface.SecurityGroups),
+		Description: aws.String("drone audit interface of " + instanceID),
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String(ec2.ResourceTypeNetworkInterface),
+				Tags:         convertTags(tags),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("amazon: failed to create the audit interface: %w", err)
+	}
+	interfaceID := created.NetworkInterface.NetworkInterfaceId
+	logr = logr.WithField("interface", aws.StringValue(interfaceID))
+
+	attached, err := p.service.AttachNetworkInterfaceWithContext(ctx, &ec2.AttachNetworkInterfaceInput{
+		DeviceIndex:        aws.Int64(auditInterfaceDeviceIndex),
+		InstanceId:         instance.InstanceId,
+		NetworkInterfaceId: interfaceID,
+	})
+	if err != nil {
+		p.deleteAuditInterface(ctx, interfaceID, logr)
+		return fmt.Errorf("amazon: failed to attach the audit interface: %w", err)
+	}
+
+	_, err = p.service.ModifyNetworkInterfaceAttributeWithContext(ctx, &ec2.ModifyNetworkInterfaceAttributeInput{
+		NetworkInterfaceId: interfaceID,
+		Attachment: &ec2.NetworkInterfaceAttachmentChanges{
+			AttachmentId:        attached.AttachmentId,
+			DeleteOnTermination: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		// the interface is deleted when it is detached from the terminated instance.
+		return fmt.Errorf("amazon: failed to delete the audit interface on termination: %w", err)
+	}
+	logr.Debugln("amazon: [provision] attached the audit interface")
+	return nil
+}
+
+// deleteAuditInterface deletes an audit interface that is not attached.
+func (p *config) deleteAuditInterface(ctx context.Context, interfaceID *string, logr logger.Logger) {
+	_, err := p.service.DeleteNetworkInterfaceWithContext(ctx, &ec2.DeleteNetworkInterfaceInput{
+		NetworkInterfaceId: interfaceID,
+	})
+	if err != nil {
+		logr.WithError(err).Errorln("amazon: failed to delete the audit interface")
+	}
+}
+
+// networkInterfaces returns the ids of the network interfaces attached to
+// the instance.
+func (p *config) networkInterfaces(ctx context.Context, instanceID string) ([]*string, error) {
+	out, err := p.service.DescribeNetworkInterfacesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("attachment.instance-id"),
+				Values: []*string{aws.String(instanceID)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]*string, len(out.NetworkInterfaces))
+	for i, iface := range out.NetworkInterfaces {
+		ids[i] = iface.NetworkInterfaceId
+	}
+	return ids, nil
+}
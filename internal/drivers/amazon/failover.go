@@ -0,0 +1,186 @@
+package amazon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Failover is a secondary region of a pool. Instances are created in it
+// when the regions before it have no capacity or their API is unavailable.
+type Failover struct {
+	Region           string
+	AvailabilityZone string
+	// AMI is the image in the region. If empty, the image with the name and
+	// owner of the primary image is used, AMIs are copied per region.
+	AMI            string
+	SubnetID       string
+	VPC            string
+	SecurityGroups []string
+}
+
+// failoverRegion is a copy of the pool config for a secondary region.
+type failoverRegion struct {
+	*config
+	mu sync.Mutex // guards the image resolution
+}
+
+// capacityCodes are the RunInstances error codes of a region without
+// capacity for the instance.
+var capacityCodes = map[string]bool{
+	"InsufficientInstanceCapacity":         true,
+	"InsufficientHostCapacity":             true,
+	"InsufficientReservedInstanceCapacity": true,
+	"InsufficientCapacity":                 true,
+	"InsufficientAddressCapacity":          true,
+	"InsufficientFreeAddressesInSubnet":    true,
+	"Unavailable":                          true,
+	"ServiceUnavailable":                   true,
+	"InternalError":                        true,
+	"RequestLimitExceeded":                 true,
+}
+
+// regionUnavailableError is returned when the region cannot create the
+// instance, and the next region should be tried.
+type regionUnavailableError struct {
+	region string
+	err    error
+}
+
+func (e *regionUnavailableError) Error() string {
+	return fmt.Sprintf("region %s unavailable: %s", e.region, e.err)
+}
+
+func (e *regionUnavailableError) Unwrap() error {
+	return e.err
+}
+
+func isRegionUnavailable(err error) bool {
+	var target *regionUnavailableError
+	return errors.As(err, &target)
+}
+
+// isCapacityOrOutage returns true if the error reports missing capacity,
+// a server side error or a region which cannot be reached.
+func isCapacityOrOutage(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return capacityCodes[awsErr.Code()] || awsErr.Code() == request.ErrCodeRequestError
+	}
+	return false
+}
+
+func (p *config) newFailoverRegion(spec Failover) (*failoverRegion, error) {
+	c := *p
+	c.failoverSpecs = nil
+	c.failover = nil
+	// prices are selected in the pool region, failover uses the pool size.
+	c.cheapestSpec = nil
+	c.cheapest = nil
+	c.region = spec.Region
+	if c.region == "" {
+		c.region = regionFromZone(spec.AvailabilityZone)
+	}
+	if c.region == "" {
+		return nil, errors.New("amazon: failover region is required")
+	}
+	partition, err := partitionForRegion(c.region)
+	if err != nil {
+		return nil, err
+	}
+	c.partition = partition
+	if err = c.validatePartition(); err != nil {
+		return nil, fmt.Errorf("amazon: failover region %s: %w", c.region, err)
+	}
+	c.availabilityZone = spec.AvailabilityZone
+	c.image = spec.AMI
+	c.subnet = spec.SubnetID
+	c.vpc = spec.VPC
+	c.groups = spec.SecurityGroups
+	c.service = c.newService()
+	c.validation = &validationCache{}
+	if c.stack != nil {
+		c.stackService = c.newStackService()
+	}
+	return &failoverRegion{config: &c}, nil
+}
+
+// resolveImage finds the image of the region by the name and owner of the
+// primary image, unless the AMI of the region is configured.
+func (f *failoverRegion) resolveImage(ctx context.Context, primary *config) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.image != "" {
+		return nil
+	}
+	images, err := primary.service.DescribeImagesWithContext(ctx, &ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(primary.image)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(images.Images) == 0 || images.Images[0].Name == nil {
+		return fmt.Errorf("amazon: image %s not found in region %s", primary.image, primary.region)
+	}
+	name := *images.Images[0].Name
+
+	in := &ec2.DescribeImagesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("name"), Values: []*string{aws.String(name)}}},
+	}
+	if owner := images.Images[0].OwnerId; owner != nil {
+		in.Owners = []*string{owner}
+	}
+	images, err = f.service.DescribeImagesWithContext(ctx, in)
+	if err != nil {
+		return err
+	}
+	if len(images.Images) == 0 {
+		return fmt.Errorf("amazon: no image named %q in region %s", name, f.region)
+	}
+	// the newest copy, if the image was copied more than once.
+	sort.Slice(images.Images, func(i, j int) bool {
+		return aws.StringValue(images.Images[i].CreationDate) > aws.StringValue(images.Images[j].CreationDate)
+	})
+	f.image = aws.StringValue(images.Images[0].ImageId)
+	return nil
+}
+
+// regionOf returns the config of the region, the primary region if the
+// region is empty or not a failover region.
+func (p *config) regionOf(region string) *config {
+	for _, f := range p.failover {
+		if f.region == region {
+			return f.config
+		}
+	}
+	return p
+}
+
+// lookupRegion returns the config of the region the instance runs in, for
+// callers which only know the instance id.
+func (p *config) lookupRegion(ctx context.Context, instanceID string) *config {
+	if len(p.failover) == 0 {
+		return p
+	}
+	if _, err := p.getInstance(ctx, instanceID); err == nil {
+		return p
+	}
+	for _, f := range p.failover {
+		if _, err := f.getInstance(ctx, instanceID); err == nil {
+			return f.config
+		}
+	}
+	return p
+}
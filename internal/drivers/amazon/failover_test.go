@@ -0,0 +1,99 @@
+package amazon
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func Test_isCapacityOrOutage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "insufficient capacity",
+			err:  awserr.New("InsufficientInstanceCapacity", "no capacity", nil),
+			want: true,
+		},
+		{
+			name: "server error",
+			err:  awserr.NewRequestFailure(awserr.New("Unknown", "oops", nil), 503, "req"),
+			want: true,
+		},
+		{
+			name: "network error",
+			err:  awserr.New("RequestError", "send request failed", errors.New("dial tcp: i/o timeout")),
+			want: true,
+		},
+		{
+			name: "invalid ami",
+			err:  awserr.NewRequestFailure(awserr.New("InvalidAMIID.NotFound", "not found", nil), 400, "req"),
+			want: false,
+		},
+		{
+			name: "other error",
+			err:  errors.New("failed"),
+			want: false,
+		},
+	}
+	for _, test := range tests {
+		if got := isCapacityOrOutage(test.err); got != test.want {
+			t.Errorf("%s: want %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func Test_isRegionUnavailable(t *testing.T) {
+	err := fmt.Errorf("create: %w", &regionUnavailableError{region: "us-east-1", err: errors.New("no capacity")})
+	if !isRegionUnavailable(err) {
+		t.Error("want wrapped region error detected")
+	}
+	if isRegionUnavailable(errors.New("no capacity")) {
+		t.Error("want other errors not detected")
+	}
+	if isRegionUnavailable(nil) {
+		t.Error("want nil not detected")
+	}
+}
+
+func Test_newFailoverRegion(t *testing.T) {
+	p := &config{
+		region: "us-east-1",
+		image:  "ami-primary",
+		subnet: "subnet-primary",
+		groups: []string{"sg-primary"},
+		size:   "t3.large",
+	}
+	f, err := p.newFailoverRegion(Failover{AvailabilityZone: "us-west-2b", SubnetID: "subnet-west"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.region != "us-west-2" || f.partition != "aws" {
+		t.Errorf("want region us-west-2 in partition aws, got %s in %s", f.region, f.partition)
+	}
+	if f.image != "" || f.subnet != "subnet-west" || f.groups != nil {
+		t.Errorf("want region specific image, subnet and groups, got %s, %s, %v", f.image, f.subnet, f.groups)
+	}
+	if f.size != p.size {
+		t.Errorf("want size %s inherited, got %s", p.size, f.size)
+	}
+	if f.service == nil || f.service == p.service {
+		t.Error("want a service for the failover region")
+	}
+
+	p.failover = []*failoverRegion{f}
+	if got := p.regionOf("us-west-2"); got != f.config {
+		t.Error("want the failover config for its region")
+	}
+	if got := p.regionOf(""); got != p {
+		t.Error("want the primary config for an empty region")
+	}
+
+	if _, err = p.newFailoverRegion(Failover{}); err == nil {
+		t.Error("want error without region")
+	}
+}
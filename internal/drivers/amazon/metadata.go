@@ -0,0 +1,55 @@
+package amazon
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const maxMetadataHopLimit = 64
+
+// Metadata configures the instance metadata service of the instances.
+// Tokens set to required enforces IMDSv2. A hop limit of 2 or more lets
+// containers reach the service, and the credentials of the instance role.
+// Disabled turns the service off for untrusted workloads.
+type Metadata struct {
+	Tokens   string
+	HopLimit int64
+	Disabled bool
+}
+
+func (m *Metadata) validate() error {
+	switch m.Tokens {
+	case "", ec2.HttpTokensStateOptional, ec2.HttpTokensStateRequired:
+	default:
+		return fmt.Errorf("amazon: metadata tokens must be %q or %q", ec2.HttpTokensStateOptional, ec2.HttpTokensStateRequired)
+	}
+	if m.HopLimit < 0 || m.HopLimit > maxMetadataHopLimit {
+		return fmt.Errorf("amazon: metadata hop limit must be between 1 and %d", maxMetadataHopLimit)
+	}
+	return nil
+}
+
+// metadataOptions returns the metadata options of the instances, or nil
+// to keep the defaults of the account and image.
+func metadataOptions(m *Metadata) *ec2.InstanceMetadataOptionsRequest {
+	if m == nil {
+		return nil
+	}
+	if m.Disabled {
+		return &ec2.InstanceMetadataOptionsRequest{
+			HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateDisabled),
+		}
+	}
+	opts := &ec2.InstanceMetadataOptionsRequest{
+		HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateEnabled),
+	}
+	if m.Tokens != "" {
+		opts.HttpTokens = aws.String(m.Tokens)
+	}
+	if m.HopLimit > 0 {
+		opts.HttpPutResponseHopLimit = aws.Int64(m.HopLimit)
+	}
+	return opts
+}
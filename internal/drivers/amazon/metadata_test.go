@@ -0,0 +1,64 @@
+package amazon
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func Test_metadataOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *Metadata
+		want     *ec2.InstanceMetadataOptionsRequest
+		wantErr  bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:     "imdsv2 with hop limit",
+			metadata: &Metadata{Tokens: "required", HopLimit: 2},
+			want: &ec2.InstanceMetadataOptionsRequest{
+				HttpEndpoint:            aws.String("enabled"),
+				HttpTokens:              aws.String("required"),
+				HttpPutResponseHopLimit: aws.Int64(2),
+			},
+		},
+		{
+			name:     "disabled",
+			metadata: &Metadata{Tokens: "required", Disabled: true},
+			want: &ec2.InstanceMetadataOptionsRequest{
+				HttpEndpoint: aws.String("disabled"),
+			},
+		},
+		{
+			name:     "invalid tokens",
+			metadata: &Metadata{Tokens: "v2"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid hop limit",
+			metadata: &Metadata{HopLimit: 65},
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.metadata != nil {
+				err := test.metadata.validate()
+				if (err != nil) != test.wantErr {
+					t.Fatalf("want error %v, got %v", test.wantErr, err)
+				}
+				if err != nil {
+					return
+				}
+			}
+			if got := metadataOptions(test.metadata); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want metadata options %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package amazon
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// maxTagValue is the length limit of ec2 on a tag value.
+const maxTagValue = 256
+
+var namePlaceholder = regexp.MustCompile(`{{\s*([a-z-]+)\s*}}`)
+
+// namePlaceholders are the values of a name template. short-id is the end
+// of the instance id. build, repo and stage are known once the instance is
+// claimed by a stage, the tags of the build set them.
+var namePlaceholders = map[string]string{
+	"runner":   "",
+	"pool":     "",
+	"os":       "",
+	"arch":     "",
+	"short-id": "",
+	"build":    "drone_build",
+	"repo":     "drone_repo",
+	"stage":    "drone_stage",
+}
+
+// validateNameTemplate returns an error if the template of the Name tag
+// has an unknown placeholder.
+func validateNameTemplate(template string) error {
+	for _, match := range namePlaceholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := namePlaceholders[match[1]]; !ok {
+			return fmt.Errorf("amazon: unknown placeholder {{%s}} in the name template", match[1])
+		}
+	}
+	return nil
+}
+
+// usesPlaceholder reports whether the template has one of the placeholders.
+func usesPlaceholder(template string, names ...string) bool {
+	for _, match := range namePlaceholder.FindAllStringSubmatch(template, -1) {
+		for _, name := range names {
+			if match[1] == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderName renders the template of the Name tag. Placeholders without a
+// value are removed, with the separators they leave repeated or at the
+// ends.
+func renderName(template string, values map[string]string) string {
+	name := namePlaceholder.ReplaceAllStringFunc(template, func(s string) string {
+		return values[namePlaceholder.FindStringSubmatch(s)[1]]
+	})
+	for _, sep := range []string{"-", "_", "."} {
+		for strings.Contains(name, sep+sep) {
+			name = strings.ReplaceAll(name, sep+sep, sep)
+		}
+	}
+	name = strings.Trim(name, "-_.")
+	if len(name) > maxTagValue {
+		name = name[:maxTagValue]
+	}
+	return name
+}
+
+// nameValues returns the values of the name template known when an
+// instance is created.
+func nameValues(opts *types.InstanceCreateOpts, instanceID string) map[string]string {
+	return map[string]string{
+		"runner":   opts.RunnerName,
+		"pool":     opts.PoolName,
+		"os":       opts.OS,
+		"arch":     opts.Arch,
+		"short-id": shortID(instanceID),
+	}
+}
+
+// claimName returns the Name tag of an instance claimed by a stage, empty
+// if the template does not use the values of the build or the tags do not
+// set them.
+func claimName(template string, instance *types.Instance, tags map[string]string) string {
+	if !usesPlaceholder(template, "build", "repo", "stage") {
+		return ""
+	}
+	values := map[string]string{
+		"runner":   instance.RunnerName,
+		"pool":     instance.Pool,
+		"os":       instance.OS,
+		"arch":     instance.Arch,
+		"short-id": shortID(instance.ID),
+	}
+	found := false
+	for placeholder, tag := range namePlaceholders {
+		if value, ok := tags[tag]; tag != "" && ok {
+			values[placeholder] = value
+			found = true
+		}
+	}
+	if !found {
+		return ""
+	}
+	return renderName(template, values)
+}
+
+func shortID(instanceID string) string {
+	id := strings.TrimPrefix(instanceID, "i-")
+	const length = 8
+	if len(id) > length {
+		id = id[len(id)-length:]
+	}
+	return id
+}
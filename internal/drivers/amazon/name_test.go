@@ -0,0 +1,50 @@
+package amazon
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func Test_renderName(t *testing.T) {
+	opts := &types.InstanceCreateOpts{PoolName: "ubuntu", RunnerName: "runner", Platform: types.Platform{OS: "linux", Arch: "arm64"}}
+	tests := []struct {
+		name       string
+		template   string
+		instanceID string
+		want       string
+	}{
+		{name: "all values", template: "drone-{{pool}}-{{os}}-{{arch}}-{{short-id}}", instanceID: "i-0123456789abcdef0", want: "drone-ubuntu-linux-arm64-9abcdef0"},
+		{name: "missing values removed", template: "drone-{{pool}}-{{build}}-{{short-id}}", want: "drone-ubuntu"},
+		{name: "spaces in placeholders", template: "{{ runner }}.{{ pool }}", want: "runner.ubuntu"},
+	}
+	for _, test := range tests {
+		if got := renderName(test.template, nameValues(opts, test.instanceID)); got != test.want {
+			t.Errorf("%s: want %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func Test_claimName(t *testing.T) {
+	instance := &types.Instance{ID: "i-0123456789abcdef0", Pool: "ubuntu"}
+	tags := map[string]string{"drone_build": "42", "drone_repo": "octocat/hello"}
+
+	if got := claimName("drone-{{pool}}-{{build}}-{{short-id}}", instance, tags); got != "drone-ubuntu-42-9abcdef0" {
+		t.Errorf("want the name with the build, got %q", got)
+	}
+	if got := claimName("drone-{{pool}}-{{short-id}}", instance, tags); got != "" {
+		t.Errorf("want no name for a template without the build values, got %q", got)
+	}
+	if got := claimName("drone-{{build}}", instance, map[string]string{"team": "ci"}); got != "" {
+		t.Errorf("want no name for tags without the build values, got %q", got)
+	}
+}
+
+func Test_validateNameTemplate(t *testing.T) {
+	if err := validateNameTemplate("drone-{{pool}}-{{build}}-{{short-id}}"); err != nil {
+		t.Error(err)
+	}
+	if err := validateNameTemplate("drone-{{branch}}"); err == nil {
+		t.Error("want an error for an unknown placeholder")
+	}
+}
@@ -65,17 +65,16 @@ func WithRootDirectory(dir string) Option {
 	}
 }
 
-// WithDeviceName returns an option to set the device name.
+// WithDeviceName returns an option to set the name of the root device the
+// disk settings apply to. If empty, the root device of the image is used,
+// or the default device of the os if the image cannot be described.
 func WithDeviceName(deviceName, osName string) Option {
 	return func(p *config) {
-		if p.deviceName == "" {
-			if osName == oshelp.AmazonLinux {
-				p.deviceName = "/dev/xvda"
-			} else {
-				p.deviceName = "/dev/sda1"
-			}
+		p.deviceName = deviceName
+		if osName == oshelp.AmazonLinux {
+			p.defaultDeviceName = "/dev/xvda"
 		} else {
-			p.deviceName = deviceName
+			p.defaultDeviceName = "/dev/sda1"
 		}
 	}
 }
@@ -109,14 +108,72 @@ func WithRetries(retries int) Option {
 func WithRegion(region, zone string) Option {
 	return func(p *config) {
 		if region == "" && zone != "" {
-			// Only set region if zone not set
-			p.region = "us-east-2"
+			// derive the region from the zone so that zones outside
+			// the standard partition (aws-cn, aws-us-gov) resolve.
+			p.region = regionFromZone(zone)
+			if p.region == "" {
+				p.region = defaultRegion
+			}
 		} else {
 			p.region = region
 		}
 	}
 }
 
+// WithCheapest returns an option to select the cheapest instance type and
+// zone from the candidates, by spot price for spot pools and by on-demand
+// price otherwise.
+func WithCheapest(cheapest *Cheapest, platformOS string) Option {
+	return func(p *config) {
+		p.cheapestSpec = cheapest
+		p.cheapestWindows = platformOS == oshelp.OSWindows
+	}
+}
+
+// WithStack returns an option to create a CloudFormation stack with each
+// instance. The template is read from the path if it is not inline.
+func WithStack(stack *Stack, templatePath string) Option {
+	return func(p *config) {
+		if stack == nil {
+			return
+		}
+		if stack.Template == "" && templatePath != "" {
+			data, err := os.ReadFile(templatePath)
+			if err != nil {
+				logrus.WithError(err).
+					Fatalln("failed to read stack template file")
+				return
+			}
+			stack.Template = string(data)
+		}
+		p.stack = stack
+	}
+}
+
+// WithAuditInterface returns an option to attach an audit network
+// interface to each instance.
+func WithAuditInterface(iface *AuditInterface) Option {
+	return func(p *config) {
+		p.auditInterface = iface
+	}
+}
+
+// WithMetadata returns an option to set the instance metadata service
+// options.
+func WithMetadata(metadata *Metadata) Option {
+	return func(p *config) {
+		p.metadata = metadata
+	}
+}
+
+// WithFailover returns an option to set the secondary regions, in the order
+// they are tried when the region of the pool cannot create instances.
+func WithFailover(regions ...Failover) Option {
+	return func(p *config) {
+		p.failoverSpecs = regions
+	}
+}
+
 // WithSecurityGroup returns an option to set the instance size.
 func WithSecurityGroup(group ...string) Option {
 	return func(p *config) {
@@ -175,6 +232,31 @@ func WithUserData(text, path string) Option {
 	}
 }
 
+// WithNameTemplate returns an option to set the template of the Name tag
+// of the instances, e.g. drone-{{pool}}-{{build}}-{{short-id}}.
+func WithNameTemplate(template string) Option {
+	return func(p *config) {
+		p.nameTemplate = template
+	}
+}
+
+// WithSerialConsole returns an option to fetch the latest console output
+// of the instances, and to enable the serial console access of the account
+// so that operators can connect to unreachable instances.
+func WithSerialConsole(enabled bool) Option {
+	return func(p *config) {
+		p.serialConsole = enabled
+	}
+}
+
+// WithUserDataPersist returns an option to run the userdata of windows
+// instances on every boot rather than the first one.
+func WithUserDataPersist(persist bool) Option {
+	return func(p *config) {
+		p.persist = persist
+	}
+}
+
 // WithVolumeSize returns an option to set the volume size in gigabytes.
 func WithVolumeSize(s int64) Option {
 	return func(p *config) {
@@ -0,0 +1,82 @@
+package amazon
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/drone/runner-go/logger"
+)
+
+// serialConsoleLogs returns the latest console output of the instance,
+// followed by the commands connecting to its serial console. The serial
+// console access of the account is enabled in the region if it is not.
+func (p *config) serialConsoleLogs(ctx context.Context, instanceID string) (string, error) {
+	logr := logger.FromContext(ctx).WithField("id", instanceID)
+
+	// only nitro instances return the latest output, the others return the output of the boot.
+	output, err := p.service.GetConsoleOutputWithContext(ctx, &ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+		Latest:     aws.Bool(true),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "UnsupportedOperation" {
+		output, err = p.service.GetConsoleOutputWithContext(ctx, &ec2.GetConsoleOutputInput{
+			InstanceId: aws.String(instanceID),
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("amazon: failed to get console output: %s", err)
+	}
+	var b strings.Builder
+	if output.Output == nil {
+		b.WriteString("'console output is empty'\n")
+	} else {
+		decoded, _ := base64.StdEncoding.DecodeString(*output.Output)
+		b.Write(decoded)
+		if !strings.HasSuffix(b.String(), "\n") {
+			b.WriteByte('\n')
+		}
+	}
+
+	if err = p.enableSerialConsole(ctx); err != nil {
+		logr.WithError(err).Warnln("amazon: cannot enable the serial console access")
+		fmt.Fprintf(&b, "\nthe serial console access cannot be enabled in %s: %s\n", p.region, err)
+		return b.String(), nil
+	}
+	b.WriteString("\n")
+	b.WriteString(serialConsoleCommands(p.region, instanceID))
+	return b.String(), nil
+}
+
+// enableSerialConsole enables the serial console access of the account in
+// the region, if it is disabled.
+func (p *config) enableSerialConsole(ctx context.Context) error {
+	status, err := p.service.GetSerialConsoleAccessStatusWithContext(ctx, &ec2.GetSerialConsoleAccessStatusInput{})
+	if err != nil {
+		return err
+	}
+	if aws.BoolValue(status.SerialConsoleAccessEnabled) {
+		return nil
+	}
+	_, err = p.service.EnableSerialConsoleAccessWithContext(ctx, &ec2.EnableSerialConsoleAccessInput{})
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).WithField("region", p.region).Infoln("amazon: enabled the serial console access of the account")
+	return nil
+}
+
+// serialConsoleCommands returns the aws-cli commands connecting to the
+// serial console of the instance, with an ssh key pushed for 60 seconds.
+func serialConsoleCommands(region, instanceID string) string {
+	return fmt.Sprintf(`connect to the serial console of the instance with:
+  aws ec2-instance-connect send-serial-console-ssh-public-key --region %[1]s --instance-id %[2]s --serial-port 0 --ssh-public-key file://~/.ssh/id_ed25519.pub
+  ssh %[2]s.port0@serial-console.ec2-instance-connect.%[1]s.aws
+`, region, instanceID)
+}
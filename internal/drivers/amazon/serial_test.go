@@ -0,0 +1,18 @@
+package amazon
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_serialConsoleCommands(t *testing.T) {
+	got := serialConsoleCommands("us-east-2", "i-0abc")
+	for _, want := range []string{
+		"aws ec2-instance-connect send-serial-console-ssh-public-key --region us-east-2 --instance-id i-0abc --serial-port 0",
+		"ssh i-0abc.port0@serial-console.ec2-instance-connect.us-east-2.aws",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in the commands, got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package amazon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	defaultStackTimeout = 15 * time.Minute
+	stackPollInterval   = 10 * time.Second
+)
+
+// Stack is a CloudFormation template created with each instance and
+// deleted with it, for resources a build needs beyond the instance, like
+// network interfaces, security groups or volumes. The template receives
+// the InstanceId, AvailabilityZone, SubnetId and VpcId of the instance in
+// the parameters of these names it declares.
+type Stack struct {
+	Template     string
+	Parameters   map[string]string
+	Capabilities []string
+	Timeout      time.Duration
+}
+
+// stackName returns the name of the stack of the instance.
+func stackName(instanceID string) string {
+	return "drone-" + instanceID
+}
+
+// stackParameters returns the parameters of the stack of the instance,
+// the instance parameters declared by the template and the configured
+// parameters, which take precedence.
+func stackParameters(declared []string, configured map[string]string, instance *ec2.Instance) []*cloudformation.Parameter {
+	values := map[string]string{}
+	for _, name := range declared {
+		switch name {
+		case "InstanceId":
+			values[name] = aws.StringValue(instance.InstanceId)
+		case "AvailabilityZone":
+			if instance.Placement != nil {
+				values[name] = aws.StringValue(instance.Placement.AvailabilityZone)
+			}
+		case "SubnetId":
+			values[name] = aws.StringValue(instance.SubnetId)
+		case "VpcId":
+			values[name] = aws.StringValue(instance.VpcId)
+		}
+	}
+	for name, value := range configured {
+		values[name] = value
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]*cloudformation.Parameter, 0, len(values))
+	for _, name := range names {
+		params = append(params, &cloudformation.Parameter{
+			ParameterKey:   aws.String(name),
+			ParameterValue: aws.String(values[name]),
+		})
+	}
+	return params
+}
+
+// newStackService returns a CloudFormation client for the region of the
+// config.
+func (p *config) newStackService() *cloudformation.CloudFormation {
+	config := &aws.Config{
+		Region:     aws.String(p.region),
+		MaxRetries: aws.Int(p.retries),
+	}
+	fips.AWS(config)
+	if p.accessKeyID != "" && p.secretAccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, p.sessionToken)
+	}
+	return cloudformation.New(session.Must(session.NewSession()), config)
+}
+
+// createStack creates the stack of the instance and waits until it is
+// complete.
+func (p *config) createStack(ctx context.Context, instance *ec2.Instance) error {
+	name := stackName(aws.StringValue(instance.InstanceId))
+	logr := logger.FromContext(ctx).
+		WithField("driver", types.Amazon).
+		WithField("id", aws.StringValue(instance.InstanceId)).
+		WithField("stack", name)
+
+	summary, err := p.stackService.GetTemplateSummaryWithContext(ctx, &cloudformation.GetTemplateSummaryInput{
+		TemplateBody: aws.String(p.stack.Template),
+	})
+	if err != nil {
+		return fmt.Errorf("amazon: invalid stack template: %w", err)
+	}
+	var declared []string
+	for _, param := range summary.Parameters {
+		declared = append(declared, aws.StringValue(param.ParameterKey))
+	}
+
+	timeout := p.stack.Timeout
+	if timeout <= 0 {
+		timeout = defaultStackTimeout
+	}
+	_, err = p.stackService.CreateStackWithContext(ctx, &cloudformation.CreateStackInput{
+		StackName:        aws.String(name),
+		TemplateBody:     aws.String(p.stack.Template),
+		Parameters:       stackParameters(declared, p.stack.Parameters, instance),
+		Capabilities:     aws.StringSlice(p.stack.Capabilities),
+		TimeoutInMinutes: aws.Int64(int64(timeout.Minutes())),
+		Tags: []*cloudformation.Tag{
+			{Key: aws.String("Name"), Value: aws.String(name)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("amazon: failed to create stack %s: %w", name, err)
+	}
+	logr.Traceln("amazon: waiting for the stack")
+
+	err = p.stackService.WaitUntilStackCreateCompleteWithContext(ctx,
+		&cloudformation.DescribeStacksInput{StackName: aws.String(name)},
+		request.WithWaiterMaxAttempts(int(timeout/stackPollInterval)+1),
+		request.WithWaiterDelay(request.ConstantWaiterDelay(stackPollInterval)),
+	)
+	if err != nil {
+		return fmt.Errorf("amazon: stack %s was not created: %w", name, err)
+	}
+	logr.Debugln("amazon: stack created")
+	return nil
+}
+
+// deleteStack deletes the stack of the instance. CloudFormation deletes
+// the resources in the background.
+func (p *config) deleteStack(ctx context.Context, instanceID string) {
+	name := stackName(instanceID)
+	_, err := p.stackService.DeleteStackWithContext(ctx, &cloudformation.DeleteStackInput{
+		StackName: aws.String(name),
+	})
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			WithField("driver", types.Amazon).
+			WithField("stack", name).
+			Errorln("amazon: failed to delete stack")
+	}
+}
@@ -0,0 +1,70 @@
+package amazon
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func Test_stackParameters(t *testing.T) {
+	instance := &ec2.Instance{
+		InstanceId: aws.String("i-123"),
+		SubnetId:   aws.String("subnet-1"),
+		VpcId:      aws.String("vpc-1"),
+		Placement:  &ec2.Placement{AvailabilityZone: aws.String("us-east-1a")},
+	}
+	tests := []struct {
+		name       string
+		declared   []string
+		configured map[string]string
+		want       map[string]string
+	}{
+		{
+			name: "no parameters",
+			want: map[string]string{},
+		},
+		{
+			name:     "instance parameters declared by the template",
+			declared: []string{"InstanceId", "AvailabilityZone", "SubnetId", "VpcId", "VolumeSize"},
+			want: map[string]string{
+				"InstanceId":       "i-123",
+				"AvailabilityZone": "us-east-1a",
+				"SubnetId":         "subnet-1",
+				"VpcId":            "vpc-1",
+			},
+		},
+		{
+			name:       "configured parameters take precedence",
+			declared:   []string{"InstanceId", "SubnetId"},
+			configured: map[string]string{"SubnetId": "subnet-2", "VolumeSize": "100"},
+			want: map[string]string{
+				"InstanceId": "i-123",
+				"SubnetId":   "subnet-2",
+				"VolumeSize": "100",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := stackParameters(test.declared, test.configured, instance)
+			got := map[string]string{}
+			for i, param := range params {
+				if i > 0 && aws.StringValue(params[i-1].ParameterKey) >= aws.StringValue(param.ParameterKey) {
+					t.Errorf("parameters are not sorted: %v", params)
+				}
+				got[aws.StringValue(param.ParameterKey)] = aws.StringValue(param.ParameterValue)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want parameters %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_stackName(t *testing.T) {
+	if got, want := stackName("i-123"), "drone-i-123"; got != want {
+		t.Errorf("want stack name %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,124 @@
+package amazon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/drone/runner-go/logger"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ownerTag is the tag of the instances created by the runner, its value
+// is the name of the runner. The termination protection of these
+// instances is disabled to terminate them.
+const ownerTag = "drone-runner"
+
+// terminate terminates the instances. Termination protection is disabled
+// on the instances created by the runner, the ones protected by someone
+// else are left running and named in the error.
+func (p *config) terminate(ids []string, logr logger.Logger) error {
+	client := p.service
+	out, err := client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: aws.StringSlice(ids)})
+	var protected []string
+	if isTerminationProtected(err) {
+		var unprotectErr error
+		ids, protected, unprotectErr = p.unprotect(ids, logr)
+		if unprotectErr != nil {
+			return fmt.Errorf("failed to disable the termination protection: %w", withRequestID(unprotectErr))
+		}
+		err = nil
+		if len(ids) != 0 {
+			out, err = client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: aws.StringSlice(ids)})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to terminate instances: %w", withRequestID(err))
+	}
+	if out != nil {
+		for _, id := range shuttingDown(out) {
+			logr.WithField("id", id).
+				Warnln("amazon: instance is still shutting down from an earlier termination, it needs the AWS support if it does not terminate")
+		}
+	}
+	if len(protected) != 0 {
+		return fmt.Errorf("instances %s have termination protection and were not created by the runner, "+
+			"disable the protection in the AWS console to terminate them", strings.Join(protected, ", "))
+	}
+	return nil
+}
+
+// unprotect disables the termination protection of the instances created
+// by the runner. It returns the instances that can be terminated and the
+// ones protected by someone else.
+func (p *config) unprotect(ids []string, logr logger.Logger) (terminable, protected []string, err error) {
+	client := p.service
+	desc, err := client.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice(ids)})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, reservation := range desc.Reservations {
+		for _, instance := range reservation.Instances {
+			id := aws.StringValue(instance.InstanceId)
+			attr, attrErr := client.DescribeInstanceAttribute(&ec2.DescribeInstanceAttributeInput{
+				InstanceId: instance.InstanceId,
+				Attribute:  aws.String(ec2.InstanceAttributeNameDisableApiTermination),
+			})
+			if attrErr != nil {
+				return nil, nil, attrErr
+			}
+			if attr.DisableApiTermination == nil || !aws.BoolValue(attr.DisableApiTermination.Value) {
+				terminable = append(terminable, id)
+				continue
+			}
+			if !createdByRunner(instance.Tags) {
+				logr.WithField("id", id).Errorln("amazon: instance has termination protection and was not created by the runner")
+				protected = append(protected, id)
+				continue
+			}
+			_, err = client.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+				InstanceId:            instance.InstanceId,
+				DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(false)},
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			logr.WithField("id", id).Warnln("amazon: disabled the termination protection of the instance")
+			terminable = append(terminable, id)
+		}
+	}
+	return terminable, protected, nil
+}
+
+// isTerminationProtected reports whether the termination failed because
+// an instance has termination protection.
+func isTerminationProtected(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == "OperationNotPermitted"
+}
+
+// createdByRunner reports whether the tags are the ones of an instance
+// created by the runner.
+func createdByRunner(tags []*ec2.Tag) bool {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == ownerTag {
+			return true
+		}
+	}
+	return false
+}
+
+// shuttingDown returns the instances that were already shutting down
+// before they were terminated.
+func shuttingDown(out *ec2.TerminateInstancesOutput) []string {
+	var ids []string
+	for _, change := range out.TerminatingInstances {
+		if change.PreviousState != nil && aws.StringValue(change.PreviousState.Name) == ec2.InstanceStateNameShuttingDown {
+			ids = append(ids, aws.StringValue(change.InstanceId))
+		}
+	}
+	return ids
+}
@@ -0,0 +1,45 @@
+package amazon
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func Test_isTerminationProtected(t *testing.T) {
+	protected := awserr.New("OperationNotPermitted", "The instance 'i-1' may not be terminated", nil)
+	if !isTerminationProtected(fmt.Errorf("terminate: %w", protected)) {
+		t.Error("want a protected instance detected")
+	}
+	if isTerminationProtected(awserr.New("InvalidInstanceID.NotFound", "not found", nil)) || isTerminationProtected(errors.New("timeout")) {
+		t.Error("want other errors not detected as protected instances")
+	}
+}
+
+func Test_createdByRunner(t *testing.T) {
+	if !createdByRunner([]*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("a")}, {Key: aws.String(ownerTag), Value: aws.String("")}}) {
+		t.Error("want the instance with the owner tag created by the runner")
+	}
+	if createdByRunner([]*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("drone-runner")}}) {
+		t.Error("want the instance without the owner tag not created by the runner")
+	}
+}
+
+func Test_shuttingDown(t *testing.T) {
+	change := func(id, previous string) *ec2.InstanceStateChange {
+		return &ec2.InstanceStateChange{InstanceId: aws.String(id), PreviousState: &ec2.InstanceState{Name: aws.String(previous)}}
+	}
+	out := &ec2.TerminateInstancesOutput{TerminatingInstances: []*ec2.InstanceStateChange{
+		change("i-1", ec2.InstanceStateNameRunning),
+		change("i-2", ec2.InstanceStateNameShuttingDown),
+		{InstanceId: aws.String("i-3")},
+	}}
+	if got := shuttingDown(out); !reflect.DeepEqual(got, []string{"i-2"}) {
+		t.Errorf("want the instances already shutting down, got %v", got)
+	}
+}
@@ -0,0 +1,94 @@
+package amazon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// maxUserDataSize is the limit of ec2 on the user data of an instance,
+// before it is base64 encoded.
+const maxUserDataSize = 16 * 1024
+
+// generateUserData returns the userdata of an instance. The userdata of
+// windows instances is a powershell script, custom userdata without the
+// <powershell> tags is run after the runner setup.
+func (p *config) generateUserData(opts *types.InstanceCreateOpts) (string, error) {
+	if opts.Platform.OS == oshelp.OSWindows {
+		return lehelper.GenerateWindowsUserdata(p.userData, p.persist, opts)
+	}
+	return lehelper.GenerateUserdata(p.userData, opts), nil
+}
+
+// userDataSection is a part of the user data and its size in bytes.
+type userDataSection struct {
+	name string
+	size int
+}
+
+// encodeUserData returns the user data of an instance, gzip compressed if
+// it is over the limit of ec2 and the instance decompresses it, which
+// cloud-init does on linux. If it is still over the limit, the error
+// lists the size of the sections, largest first.
+func encodeUserData(userData string, sections []userDataSection, compressible bool) ([]byte, error) {
+	if len(userData) <= maxUserDataSize {
+		return []byte(userData), nil
+	}
+	size := len(userData)
+	if compressible {
+		var b bytes.Buffer
+		w, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+		if _, err := w.Write([]byte(userData)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if b.Len() <= maxUserDataSize {
+			return b.Bytes(), nil
+		}
+		size = b.Len()
+	}
+
+	sorted := append([]userDataSection(nil), sections...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].size > sorted[j].size })
+	parts := make([]string, 0, len(sorted))
+	for _, s := range sorted {
+		parts = append(parts, fmt.Sprintf("%s %s", s.name, kib(s.size)))
+	}
+	qualifier := ""
+	if compressible {
+		qualifier = " compressed"
+	}
+	return nil, fmt.Errorf("amazon: the user data is %s%s, over the %s limit of ec2, its sections are: %s",
+		kib(size), qualifier, kib(maxUserDataSize), strings.Join(parts, ", "))
+}
+
+func kib(n int) string {
+	return fmt.Sprintf("%.1fKB", float64(n)/1024) //nolint:gomnd
+}
+
+// userDataSections splits the size of the user data between the
+// certificates of lite-engine, the user data of the pool and the runner
+// script around them.
+func userDataSections(userData, poolUserData string, certs ...[]byte) []userDataSection {
+	certSize := 0
+	for _, c := range certs {
+		certSize += len(c)
+	}
+	script := len(userData) - certSize - len(poolUserData)
+	if script < 0 {
+		script = 0
+	}
+	return []userDataSection{
+		{name: "certificates", size: certSize},
+		{name: "user_data", size: len(poolUserData)},
+		{name: "runner script", size: script},
+	}
+}
@@ -0,0 +1,72 @@
+package amazon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_encodeUserData(t *testing.T) {
+	small := "#cloud-config\n"
+	large := "#cloud-config\n" + strings.Repeat("runcmd: echo hello\n", 1500)
+	random := make([]byte, 20*1024)
+	rand.New(rand.NewSource(1)).Read(random) //nolint:gosec
+	incompressible := string(random)
+
+	tests := []struct {
+		name         string
+		userData     string
+		compressible bool
+		wantGzip     bool
+		wantErr      string
+	}{
+		{name: "under the limit", userData: small, compressible: true},
+		{name: "compressed over the limit", userData: large, compressible: true, wantGzip: true},
+		{name: "windows over the limit", userData: large, wantErr: "27.8KB, over the 16.0KB limit"},
+		{name: "over the limit compressed", userData: incompressible, compressible: true, wantErr: "compressed, over the 16.0KB limit"},
+	}
+	for _, test := range tests {
+		sections := userDataSections(test.userData, test.userData[:len(test.userData)/2], []byte("cert"))
+		got, err := encodeUserData(test.userData, sections, test.compressible)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: want error %q, got %v", test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(got) > maxUserDataSize {
+			t.Errorf("%s: want at most %d bytes, got %d", test.name, maxUserDataSize, len(got))
+		}
+		if !test.wantGzip {
+			if string(got) != test.userData {
+				t.Errorf("%s: want the user data unchanged", test.name)
+			}
+			continue
+		}
+		r, err := gzip.NewReader(bytes.NewReader(got))
+		if err != nil {
+			t.Errorf("%s: want gzip, got %v", test.name, err)
+			continue
+		}
+		if b, _ := io.ReadAll(r); string(b) != test.userData {
+			t.Errorf("%s: want the user data decompressed", test.name)
+		}
+	}
+}
+
+func Test_encodeUserData_Sections(t *testing.T) {
+	userData := strings.Repeat("a", 20*1024)
+	sections := userDataSections(userData, userData[:12*1024], make([]byte, 3*1024), make([]byte, 1024))
+	_, err := encodeUserData(userData, sections, false)
+	want := "sections are: user_data 12.0KB, certificates 4.0KB, runner script 4.0KB"
+	if err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("want error ending with %q, got %v", want, err)
+	}
+}
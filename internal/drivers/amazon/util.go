@@ -5,12 +5,23 @@
 package amazon
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/pricing"
 )
 
+const defaultRegion = "us-east-2"
+
 // helper function converts an array of tags in string
 // format to an array of ec2 tags.
 func convertTags(in map[string]string) []*ec2.Tag {
@@ -30,8 +41,107 @@ func tempdir(inputOS string) string {
 
 	switch inputOS {
 	case oshelp.OSWindows:
-		return oshelp.JoinPaths(inputOS, "C:\\Windows\\Temp", dir)
+		return oshelp.JoinPaths(inputOS, oshelp.WindowsRootDir, dir)
 	default:
 		return oshelp.JoinPaths(inputOS, "/tmp", dir)
 	}
 }
+
+// helper function returns the region of an availability zone,
+// e.g. us-gov-west-1a is in region us-gov-west-1.
+func regionFromZone(zone string) string {
+	zone = strings.TrimSpace(zone)
+	if len(zone) < 2 { //nolint:gomnd
+		return ""
+	}
+	last := zone[len(zone)-1]
+	if last < 'a' || last > 'z' {
+		return ""
+	}
+	return zone[:len(zone)-1]
+}
+
+// helper function returns the partition (aws, aws-cn, aws-us-gov, ...)
+// that the region belongs to, or an error if the region is unknown.
+func partitionForRegion(region string) (string, error) {
+	partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+	if !ok {
+		return "", fmt.Errorf("amazon: unknown region %q", region)
+	}
+	return partition.ID(), nil
+}
+
+// helper function verifies that the arn is well formed and belongs
+// to the given partition.
+func validateARN(in, partition string) error {
+	parsed, err := arn.Parse(in)
+	if err != nil {
+		return fmt.Errorf("amazon: invalid arn %q: %w", in, err)
+	}
+	if parsed.Partition != partition {
+		return fmt.Errorf("amazon: arn %q is in partition %s, expected %s", in, parsed.Partition, partition)
+	}
+	return nil
+}
+
+// helper function verifies that the endpoint of the service in the region
+// belongs to the given partition.
+func validateEndpoint(service, region, partition string) error {
+	resolved, err := endpoints.DefaultResolver().EndpointFor(service, region)
+	if err != nil {
+		return fmt.Errorf("amazon: cannot resolve the %s endpoint of region %s: %w", service, region, err)
+	}
+	if resolved.PartitionID != partition {
+		return fmt.Errorf("amazon: %s endpoint %s is in partition %s, expected %s", service, resolved.URL, resolved.PartitionID, partition)
+	}
+	return nil
+}
+
+// validatePartition verifies that the arns and the service endpoints of
+// the config belong to the partition of its region, e.g. a GovCloud pool
+// cannot use a commercial instance profile or KMS key.
+func (p *config) validatePartition() error {
+	if p.iamProfileArn != "" {
+		if err := validateARN(p.iamProfileArn, p.partition); err != nil {
+			return err
+		}
+	}
+	// the key may be an id or an alias, only arns name a partition.
+	if strings.HasPrefix(p.kmsKeyID, "arn:") {
+		if err := validateARN(p.kmsKeyID, p.partition); err != nil {
+			return err
+		}
+	}
+	services := []string{ec2.EndpointsID}
+	if p.stack != nil {
+		services = append(services, cloudformation.EndpointsID)
+	}
+	for _, service := range services {
+		if err := validateEndpoint(service, p.region, p.partition); err != nil {
+			return err
+		}
+	}
+	// the price list api is only served in the commercial partition.
+	if p.cheapestSpec != nil && len(p.cheapestSpec.Sizes) > 0 {
+		if err := validateEndpoint(pricing.EndpointsID, pricingRegion, p.partition); err != nil {
+			return fmt.Errorf("amazon: cheapest is not supported in partition %s: %w", p.partition, err)
+		}
+	}
+	return nil
+}
+
+// IsMetal returns true if the instance type is a bare metal type, the
+// types exposing kvm to the instance for nested virtualization.
+func IsMetal(size string) bool {
+	return strings.Contains(size, ".metal")
+}
+
+// withRequestID adds the id of a failed aws request to the error, aws
+// support traces the request with it.
+func withRequestID(err error) error {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.RequestID() != "" {
+		return fmt.Errorf("%w (aws request id %s)", err, reqErr.RequestID())
+	}
+	return err
+}
@@ -5,9 +5,12 @@
 package amazon
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
 )
 
 func Test_tempdir(t *testing.T) {
@@ -15,7 +18,7 @@ func Test_tempdir(t *testing.T) {
 		os   string
 		path string
 	}{
-		{os: oshelp.OSWindows, path: "C:\\Windows\\Temp\\aws"},
+		{os: oshelp.OSWindows, path: "C:\\h\\aws"},
 		{os: oshelp.OSLinux, path: "/tmp/aws"},
 	}
 
@@ -25,3 +28,174 @@ func Test_tempdir(t *testing.T) {
 		}
 	}
 }
+
+func Test_regionFromZone(t *testing.T) {
+	tests := []struct {
+		zone   string
+		region string
+	}{
+		{zone: "us-east-2a", region: "us-east-2"},
+		{zone: "us-gov-west-1b", region: "us-gov-west-1"},
+		{zone: "cn-north-1a", region: "cn-north-1"},
+		{zone: "us-east-2", region: ""},
+		{zone: "", region: ""},
+	}
+
+	for _, test := range tests {
+		if got, want := regionFromZone(test.zone), test.region; got != want {
+			t.Errorf("Want region %q for zone %q, got %q", want, test.zone, got)
+		}
+	}
+}
+
+func Test_partitionForRegion(t *testing.T) {
+	tests := []struct {
+		region    string
+		partition string
+		err       bool
+	}{
+		{region: "us-east-2", partition: "aws"},
+		{region: "us-gov-west-1", partition: "aws-us-gov"},
+		{region: "cn-northwest-1", partition: "aws-cn"},
+		{region: "mars-central-1", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := partitionForRegion(test.region)
+		if test.err {
+			if err == nil {
+				t.Errorf("Want error for region %s", test.region)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for region %s: %s", test.region, err)
+		}
+		if want := test.partition; got != want {
+			t.Errorf("Want partition %s for region %s, got %s", want, test.region, got)
+		}
+	}
+}
+
+func Test_validateARN(t *testing.T) {
+	tests := []struct {
+		arn       string
+		partition string
+		err       bool
+	}{
+		{arn: "arn:aws:iam::123456789012:instance-profile/runner", partition: "aws"},
+		{arn: "arn:aws-us-gov:iam::123456789012:instance-profile/runner", partition: "aws-us-gov"},
+		{arn: "arn:aws-cn:iam::123456789012:instance-profile/runner", partition: "aws-cn"},
+		{arn: "arn:aws:iam::123456789012:instance-profile/runner", partition: "aws-us-gov", err: true},
+		{arn: "runner", partition: "aws", err: true},
+		{arn: "arn:aws-us-gov:kms:us-gov-west-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab", partition: "aws-us-gov"},
+		{arn: "arn:aws-cn:kms:cn-north-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab", partition: "aws-cn"},
+		{arn: "arn:aws:kms:us-east-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab", partition: "aws-cn", err: true},
+	}
+
+	for _, test := range tests {
+		err := validateARN(test.arn, test.partition)
+		if test.err && err == nil {
+			t.Errorf("Want error for arn %s in partition %s", test.arn, test.partition)
+		}
+		if !test.err && err != nil {
+			t.Errorf("Unexpected error for arn %s: %s", test.arn, err)
+		}
+	}
+}
+
+func Test_validateEndpoint(t *testing.T) {
+	tests := []struct {
+		service   string
+		region    string
+		partition string
+		err       bool
+	}{
+		{service: "ec2", region: "us-east-2", partition: "aws"},
+		{service: "ec2", region: "us-gov-west-1", partition: "aws-us-gov"},
+		{service: "cloudformation", region: "us-gov-east-1", partition: "aws-us-gov"},
+		{service: "ec2", region: "cn-north-1", partition: "aws-cn"},
+		{service: "cloudformation", region: "cn-northwest-1", partition: "aws-cn"},
+		{service: "api.pricing", region: pricingRegion, partition: "aws"},
+		{service: "api.pricing", region: pricingRegion, partition: "aws-us-gov", err: true},
+		{service: "api.pricing", region: pricingRegion, partition: "aws-cn", err: true},
+	}
+
+	for _, test := range tests {
+		err := validateEndpoint(test.service, test.region, test.partition)
+		if test.err && err == nil {
+			t.Errorf("Want error for %s in region %s and partition %s", test.service, test.region, test.partition)
+		}
+		if !test.err && err != nil {
+			t.Errorf("Unexpected error for %s in region %s: %s", test.service, test.region, err)
+		}
+	}
+}
+
+func Test_validatePartition(t *testing.T) {
+	const (
+		govProfile = "arn:aws-us-gov:iam::123456789012:instance-profile/runner"
+		govKey     = "arn:aws-us-gov:kms:us-gov-west-1:123456789012:key/1234abcd"
+		cnProfile  = "arn:aws-cn:iam::123456789012:instance-profile/runner"
+		cnKey      = "arn:aws-cn:kms:cn-north-1:123456789012:key/1234abcd"
+		awsKey     = "arn:aws:kms:us-east-2:123456789012:key/1234abcd"
+	)
+	cheapest := &Cheapest{Sizes: []string{"t3.large"}}
+	tests := []struct {
+		name string
+		conf *config
+		err  bool
+	}{
+		{name: "govcloud", conf: &config{region: "us-gov-west-1", partition: "aws-us-gov", iamProfileArn: govProfile, kmsKeyID: govKey}},
+		{name: "govcloud stack", conf: &config{region: "us-gov-east-1", partition: "aws-us-gov", stack: &Stack{}}},
+		{name: "govcloud key id", conf: &config{region: "us-gov-west-1", partition: "aws-us-gov", kmsKeyID: "1234abcd"}},
+		{name: "govcloud alias", conf: &config{region: "us-gov-west-1", partition: "aws-us-gov", kmsKeyID: "alias/runner"}},
+		{name: "govcloud commercial key", conf: &config{region: "us-gov-west-1", partition: "aws-us-gov", iamProfileArn: govProfile, kmsKeyID: awsKey}, err: true},
+		{name: "govcloud cheapest", conf: &config{region: "us-gov-west-1", partition: "aws-us-gov", cheapestSpec: cheapest}, err: true},
+		{name: "china", conf: &config{region: "cn-north-1", partition: "aws-cn", iamProfileArn: cnProfile, kmsKeyID: cnKey}},
+		{name: "china govcloud key", conf: &config{region: "cn-north-1", partition: "aws-cn", kmsKeyID: govKey}, err: true},
+		{name: "china cheapest", conf: &config{region: "cn-northwest-1", partition: "aws-cn", cheapestSpec: cheapest}, err: true},
+		{name: "commercial cheapest", conf: &config{region: "us-east-2", partition: "aws", kmsKeyID: awsKey, cheapestSpec: cheapest}},
+	}
+
+	for _, test := range tests {
+		err := test.conf.validatePartition()
+		if test.err && err == nil {
+			t.Errorf("%s: want error", test.name)
+		}
+		if !test.err && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+	}
+}
+
+func TestIsMetal(t *testing.T) {
+	tests := []struct {
+		size  string
+		metal bool
+	}{
+		{size: "c5.metal", metal: true},
+		{size: "m7i.metal-24xl", metal: true},
+		{size: "c5.24xlarge", metal: false},
+		{size: "", metal: false},
+	}
+	for _, test := range tests {
+		if got := IsMetal(test.size); got != test.metal {
+			t.Errorf("Want metal %v for %q, got %v", test.metal, test.size, got)
+		}
+	}
+}
+
+func Test_withRequestID(t *testing.T) {
+	failure := awserr.NewRequestFailure(awserr.New("InsufficientInstanceCapacity", "no capacity", nil), 500, "req-1")
+	err := withRequestID(failure)
+	if want := failure.Error() + " (aws request id req-1)"; err.Error() != want {
+		t.Errorf("want %q, got %q", want, err)
+	}
+	if !isCapacityOrOutage(err) {
+		t.Errorf("want the aws error kept")
+	}
+	if err = withRequestID(errors.New("failed")); err.Error() != "failed" {
+		t.Errorf("want other errors as they are, got %q", err)
+	}
+}
@@ -0,0 +1,188 @@
+package amazon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// validationTTL is the time the image, subnet and security groups of
+	// a pool are known to be valid before they are described again.
+	validationTTL = 15 * time.Minute
+	// validationErrorTTL is the time an invalid configuration is reported
+	// before it is described again, so that a fix is picked up quickly.
+	validationErrorTTL = time.Minute
+)
+
+// validationCache is the result of the last validation of the
+// configuration of a pool.
+type validationCache struct {
+	sync.Mutex
+	err        error
+	expires    time.Time
+	rootDevice string // root device of the image, empty if not described
+}
+
+// get returns the cached result, or the result of check if it expired.
+func (c *validationCache) get(now time.Time, check func() error) error {
+	c.Lock()
+	defer c.Unlock()
+	if now.Before(c.expires) {
+		return c.err
+	}
+	c.err = check()
+	ttl := validationTTL
+	if c.err != nil {
+		ttl = validationErrorTTL
+	}
+	c.expires = now.Add(ttl)
+	return c.err
+}
+
+// device returns the root device of the image, empty if the image was not
+// described.
+func (c *validationCache) device() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.rootDevice
+}
+
+// rootDeviceName returns the device the disk settings apply to: the
+// configured one, the root device of the image, or the default of the os.
+func (p *config) rootDeviceName() string {
+	if p.deviceName != "" {
+		return p.deviceName
+	}
+	if p.validation != nil {
+		if device := p.validation.device(); device != "" {
+			return device
+		}
+	}
+	return p.defaultDeviceName
+}
+
+// validate checks the image, the subnet and the security groups of the
+// pool, the result is cached.
+func (p *config) validate(ctx context.Context) error {
+	return p.validation.get(time.Now(), func() error {
+		return p.describeConfig(ctx)
+	})
+}
+
+// describeConfig checks that the image, the subnet and the security groups
+// of the pool exist, and that the first security group opens the port of
+// lite-engine. The default security group is looked up, or created, if the
+// pool has none. The root device of the image is kept in the cache, it is
+// called with the lock of the cache held.
+func (p *config) describeConfig(ctx context.Context) error {
+	client := p.service
+	// images may also be resolved from ssm parameters.
+	if strings.HasPrefix(p.image, "ami-") {
+		out, err := client.DescribeImagesWithContext(ctx, &ec2.DescribeImagesInput{ImageIds: []*string{aws.String(p.image)}})
+		if err != nil {
+			return fmt.Errorf("amazon: cannot find the image %s in region %s: %w", p.image, p.region, withRequestID(err))
+		}
+		if len(out.Images) == 0 {
+			return fmt.Errorf("amazon: cannot find the image %s in region %s", p.image, p.region)
+		}
+		p.validation.rootDevice = aws.StringValue(out.Images[0].RootDeviceName)
+		if p.deviceName != "" && p.validation.rootDevice != "" && p.deviceName != p.validation.rootDevice {
+			logger.FromContext(ctx).
+				WithField("image", p.image).
+				WithField("device_name", p.deviceName).
+				WithField("root_device", p.validation.rootDevice).
+				Warnln("amazon: the device name is not the root device of the image, the disk settings add a volume instead of sizing the root volume")
+		}
+	}
+	if p.subnet != "" {
+		out, err := client.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{SubnetIds: []*string{aws.String(p.subnet)}})
+		if err != nil {
+			return fmt.Errorf("amazon: cannot find the subnet %s in region %s: %w", p.subnet, p.region, withRequestID(err))
+		}
+		if len(out.Subnets) == 0 {
+			return fmt.Errorf("amazon: cannot find the subnet %s in region %s", p.subnet, p.region)
+		}
+	}
+	if len(p.groups) == 0 {
+		logger.FromContext(ctx).Warnf("aws: no security group specified assuming '%s'", defaultSecurityGroupName)
+		groupID, err := lookupCreateSecurityGroupID(ctx, client, p.vpc)
+		if err != nil {
+			return err
+		}
+		p.groups = []string{groupID}
+		return checkIngressRules(ctx, client, groupID)
+	}
+	out, err := client.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: aws.StringSlice(p.groups)})
+	if err != nil {
+		return fmt.Errorf("amazon: cannot find the security groups %s in region %s: %w", strings.Join(p.groups, ", "), p.region, withRequestID(err))
+	}
+	found := map[string]*ec2.SecurityGroup{}
+	for _, group := range out.SecurityGroups {
+		found[aws.StringValue(group.GroupId)] = group
+	}
+	for _, id := range p.groups {
+		if found[id] == nil {
+			return fmt.Errorf("amazon: cannot find the security group %s in region %s", id, p.region)
+		}
+	}
+	if !opensLiteEnginePort(found[p.groups[0]]) {
+		return fmt.Errorf("security group %s does not have the correct ingress rules. There is no rule for port %d",
+			aws.StringValue(found[p.groups[0]].GroupName), lehelper.LiteEnginePort)
+	}
+	return nil
+}
+
+// opensLiteEnginePort reports whether the security group allows tcp to
+// the port of lite-engine.
+func opensLiteEnginePort(group *ec2.SecurityGroup) bool {
+	for _, permission := range group.IpPermissions {
+		if aws.StringValue(permission.IpProtocol) == "tcp" &&
+			aws.Int64Value(permission.FromPort) == lehelper.LiteEnginePort &&
+			aws.Int64Value(permission.ToPort) == lehelper.LiteEnginePort {
+			return true
+		}
+	}
+	return false
+}
+
+// dryRun asks ec2 to launch an instance of the pool without launching it,
+// ec2 checks the image, the instance type, the subnet, the security
+// groups, the iam profile and the permissions of the runner together.
+func (p *config) dryRun(ctx context.Context) error {
+	size := p.size
+	if size == "" && p.cheapestSpec != nil && len(p.cheapestSpec.Sizes) > 0 {
+		size = p.cheapestSpec.Sizes[0]
+	}
+	tags := map[string]string{"Name": "dry-run"}
+	for k, v := range p.tags {
+		tags[k] = v
+	}
+	in := p.runInstancesInput(size, p.availabilityZone, nil, tags)
+	in.DryRun = aws.Bool(true)
+	_, err := p.service.RunInstancesWithContext(ctx, in)
+	if err = dryRunError(err); err != nil {
+		return fmt.Errorf("amazon: cannot launch %s instances of the image %s in region %s: %w", size, p.image, p.region, err)
+	}
+	return nil
+}
+
+// dryRunError returns the error of a dry run, nil if the instance would
+// have been launched.
+func dryRunError(err error) error {
+	var awsErr awserr.Error
+	if err == nil || (errors.As(err, &awsErr) && awsErr.Code() == "DryRunOperation") {
+		return nil
+	}
+	return withRequestID(err)
+}
@@ -0,0 +1,139 @@
+package amazon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func Test_validationCache(t *testing.T) {
+	c := &validationCache{}
+	calls := 0
+	var result error
+	check := func() error {
+		calls++
+		return result
+	}
+	now := time.Now()
+
+	if err := c.get(now, check); err != nil || calls != 1 {
+		t.Fatalf("want the configuration checked, got %v after %d calls", err, calls)
+	}
+	if err := c.get(now.Add(validationTTL/2), check); err != nil || calls != 1 {
+		t.Errorf("want the cached result, got %v after %d calls", err, calls)
+	}
+
+	// an invalid configuration is checked again sooner.
+	result = errors.New("amazon: cannot find the image ami-1")
+	now = now.Add(validationTTL + time.Second)
+	if err := c.get(now, check); err != result || calls != 2 {
+		t.Errorf("want the configuration checked again, got %v after %d calls", err, calls)
+	}
+	if err := c.get(now.Add(validationErrorTTL/2), check); err != result || calls != 2 {
+		t.Errorf("want the cached error, got %v after %d calls", err, calls)
+	}
+	result = nil
+	if err := c.get(now.Add(validationErrorTTL+time.Second), check); err != nil || calls != 3 {
+		t.Errorf("want the fixed configuration, got %v after %d calls", err, calls)
+	}
+}
+
+func Test_opensLiteEnginePort(t *testing.T) {
+	permission := func(protocol string, from, to int64) *ec2.IpPermission {
+		return &ec2.IpPermission{IpProtocol: aws.String(protocol), FromPort: aws.Int64(from), ToPort: aws.Int64(to)}
+	}
+	tests := []struct {
+		name        string
+		permissions []*ec2.IpPermission
+		want        bool
+	}{
+		{name: "lite-engine port", permissions: []*ec2.IpPermission{permission("tcp", 22, 22), permission("tcp", lehelper.LiteEnginePort, lehelper.LiteEnginePort)}, want: true},
+		{name: "other port", permissions: []*ec2.IpPermission{permission("tcp", 22, 22)}},
+		// all traffic rules have no ports.
+		{name: "all traffic", permissions: []*ec2.IpPermission{{IpProtocol: aws.String("-1")}}},
+		{name: "no rules"},
+	}
+	for _, test := range tests {
+		if got := opensLiteEnginePort(&ec2.SecurityGroup{IpPermissions: test.permissions}); got != test.want {
+			t.Errorf("%s: want %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func Test_dryRunError(t *testing.T) {
+	if err := dryRunError(awserr.New("DryRunOperation", "Request would have succeeded, but DryRun flag is set.", nil)); err != nil {
+		t.Errorf("want a launchable instance, got %v", err)
+	}
+	if err := dryRunError(nil); err != nil {
+		t.Errorf("want a launchable instance, got %v", err)
+	}
+	failure := awserr.NewRequestFailure(awserr.New("InvalidParameterValue", "Value (ghost) for parameter iamInstanceProfile.name is invalid", nil), 400, "req-1")
+	err := dryRunError(failure)
+	if err == nil || !strings.Contains(err.Error(), "iamInstanceProfile") || !strings.Contains(err.Error(), "req-1") {
+		t.Errorf("want the error with the request id, got %v", err)
+	}
+}
+
+func Test_runInstancesInput(t *testing.T) {
+	p := &config{
+		image:         "ami-1",
+		subnet:        "subnet-1",
+		groups:        []string{"sg-1"},
+		iamProfileArn: "arn:aws:iam::123456789012:instance-profile/runner",
+		volumeType:    "gp3",
+		volumeSize:    50,
+		deviceName:    "/dev/sda1",
+		hibernate:     true,
+	}
+	in := p.runInstancesInput("t3.large", "us-east-2a", []byte("#cloud-config"), map[string]string{"Name": "runner"})
+	if aws.StringValue(in.ImageId) != "ami-1" || aws.StringValue(in.InstanceType) != "t3.large" ||
+		aws.StringValue(in.Placement.AvailabilityZone) != "us-east-2a" ||
+		aws.StringValue(in.IamInstanceProfile.Arn) != p.iamProfileArn {
+		t.Errorf("want the image, size, zone and iam profile of the pool, got %s", in)
+	}
+	if iface := in.NetworkInterfaces[0]; aws.StringValue(iface.SubnetId) != "subnet-1" || aws.StringValue(iface.Groups[0]) != "sg-1" {
+		t.Errorf("want the subnet and security groups of the pool, got %s", iface)
+	}
+	if in.HibernationOptions == nil || !aws.BoolValue(in.BlockDeviceMappings[0].Ebs.Encrypted) {
+		t.Errorf("want a hibernating instance with an encrypted volume")
+	}
+	var resources []string
+	for _, spec := range in.TagSpecifications {
+		if aws.StringValue(spec.Tags[0].Key) != "Name" || aws.StringValue(spec.Tags[0].Value) != "runner" {
+			t.Errorf("want the tags on the %s, got %s", aws.StringValue(spec.ResourceType), spec.Tags)
+		}
+		resources = append(resources, aws.StringValue(spec.ResourceType))
+	}
+	if got := strings.Join(resources, ","); got != "instance,volume,network-interface" {
+		t.Errorf("want the instance, its volumes and network interfaces tagged, got %s", got)
+	}
+}
+
+func Test_rootDeviceName(t *testing.T) {
+	tests := []struct {
+		name       string
+		deviceName string
+		osName     string
+		rootDevice string
+		want       string
+	}{
+		{name: "configured", deviceName: "/dev/sdf", rootDevice: "/dev/xvda", want: "/dev/sdf"},
+		{name: "root device of the image", rootDevice: "/dev/nvme0n1", want: "/dev/nvme0n1"},
+		{name: "default of amazon linux", osName: "amazon-linux", want: "/dev/xvda"},
+		{name: "default", osName: "ubuntu", want: "/dev/sda1"},
+	}
+	for _, test := range tests {
+		p := &config{validation: &validationCache{rootDevice: test.rootDevice}}
+		WithDeviceName(test.deviceName, test.osName)(p)
+		if got := p.rootDeviceName(); got != test.want {
+			t.Errorf("%s: want %s, got %s", test.name, test.want, got)
+		}
+	}
+}
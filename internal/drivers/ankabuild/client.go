@@ -247,7 +247,7 @@ func tempdir(inputOS string) string {
 
 	switch inputOS {
 	case oshelp.OSWindows:
-		return oshelp.JoinPaths(inputOS, "C:\\Windows\\Temp", dir)
+		return oshelp.JoinPaths(inputOS, oshelp.WindowsRootDir, dir)
 	case oshelp.OSMac:
 		return oshelp.JoinPaths(inputOS, "/tmp", dir)
 	default:
@@ -0,0 +1,72 @@
+package drivers
+
+import (
+	"context"
+
+	"github.com/drone-runners/drone-runner-aws/audit"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// auditDriver records the instances created, destroyed, hibernated and
+// started by the driver of a pool in the audit trail.
+type auditDriver struct {
+	Driver
+	pool string
+}
+
+func (d *auditDriver) Create(ctx context.Context, opts *types.InstanceCreateOpts) (*types.Instance, error) {
+	instance, err := d.Driver.Create(ctx, opts)
+	event := &audit.Event{
+		Action:  audit.ActionInstanceCreate,
+		Pool:    d.pool,
+		Owner:   opts.AccountID,
+		Error:   audit.ErrorOf(err),
+		Details: map[string]string{"driver": d.DriverName()},
+	}
+	if instance != nil {
+		event.Instance = instance.ID
+		event.Details["address"] = instance.Address
+		event.Details["image"] = instance.Image
+		event.Details["region"] = instance.Region
+		event.Details["size"] = instance.Size
+	}
+	audit.Record(ctx, event)
+	return instance, err
+}
+
+func (d *auditDriver) Destroy(ctx context.Context, instances []*types.Instance) error {
+	err := d.Driver.Destroy(ctx, instances)
+	for _, instance := range instances {
+		audit.Record(ctx, &audit.Event{
+			Action:   audit.ActionInstanceDestroy,
+			Pool:     d.pool,
+			Instance: instance.ID,
+			Stage:    instance.Stage,
+			Owner:    instance.OwnerID,
+			Error:    audit.ErrorOf(err),
+		})
+	}
+	return err
+}
+
+func (d *auditDriver) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	err := d.Driver.Hibernate(ctx, instanceID, poolName)
+	audit.Record(ctx, &audit.Event{
+		Action:   audit.ActionInstanceHibernate,
+		Pool:     d.pool,
+		Instance: instanceID,
+		Error:    audit.ErrorOf(err),
+	})
+	return err
+}
+
+func (d *auditDriver) Start(ctx context.Context, instanceID, poolName string) (string, error) {
+	address, err := d.Driver.Start(ctx, instanceID, poolName)
+	audit.Record(ctx, &audit.Event{
+		Action:   audit.ActionInstanceStart,
+		Pool:     d.pool,
+		Instance: instanceID,
+		Error:    audit.ErrorOf(err),
+	})
+	return address, err
+}
@@ -0,0 +1,90 @@
+package drivers
+
+import (
+	"context"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// Phases of the claim of an instance.
+const (
+	ClaimPhaseLock   = "lock"
+	ClaimPhaseStore  = "store"
+	ClaimPhaseCreate = "create"
+)
+
+// ClaimTiming is the time the claim of an instance spent in each phase.
+type ClaimTiming struct {
+	Lock   time.Duration // waiting for the lock of the pool
+	Store  time.Duration // listing and tagging the instances in the instance store
+	Create time.Duration // creating an instance with the driver, if no free instance was claimed
+	Total  time.Duration
+}
+
+// Phases returns the time spent in each phase by name.
+func (t *ClaimTiming) Phases() map[string]time.Duration {
+	return map[string]time.Duration{
+		ClaimPhaseLock:   t.Lock,
+		ClaimPhaseStore:  t.Store,
+		ClaimPhaseCreate: t.Create,
+	}
+}
+
+// slowest returns the phase the claim spent the most time in.
+func (t *ClaimTiming) slowest() string {
+	phase, longest := ClaimPhaseLock, t.Lock
+	if t.Store > longest {
+		phase, longest = ClaimPhaseStore, t.Store
+	}
+	if t.Create > longest {
+		phase = ClaimPhaseCreate
+	}
+	return phase
+}
+
+type claimTimingKey struct{}
+
+// WithClaimTiming returns a context recording the timing of the claim of
+// an instance into t.
+func WithClaimTiming(ctx context.Context, t *ClaimTiming) context.Context {
+	return context.WithValue(ctx, claimTimingKey{}, t)
+}
+
+func claimTimingFrom(ctx context.Context) *ClaimTiming {
+	if t, ok := ctx.Value(claimTimingKey{}).(*ClaimTiming); ok {
+		return t
+	}
+	return &ClaimTiming{}
+}
+
+// observeClaim logs the timing of a claim, as a warning with the phase it
+// spent the most time in if it exceeds the claim SLO.
+func (m *Manager) observeClaim(ctx context.Context, poolName string, t *ClaimTiming, err error) {
+	logr := logger.FromContext(ctx).
+		WithField("pool", poolName).
+		WithField("claim_ms", t.Total.Milliseconds()).
+		WithField("lock_ms", t.Lock.Milliseconds()).
+		WithField("store_ms", t.Store.Milliseconds()).
+		WithField("create_ms", t.Create.Milliseconds())
+	if err != nil {
+		logr = logr.WithError(err)
+	}
+	if m.claimSLO <= 0 || t.Total <= m.claimSLO {
+		logr.Debugln("manager: claimed an instance")
+		return
+	}
+	logr.WithField("slowest", t.slowest()).
+		Warnf("manager: the claim of an instance took longer than %s, most of it spent on %s", m.claimSLO, describePhase(t.slowest()))
+}
+
+func describePhase(phase string) string {
+	switch phase {
+	case ClaimPhaseLock:
+		return "waiting for the lock of the pool"
+	case ClaimPhaseStore:
+		return "the instance store"
+	default:
+		return "creating an instance with the cloud api"
+	}
+}
@@ -0,0 +1,33 @@
+package drivers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClaimTiming_Slowest(t *testing.T) {
+	tests := []struct {
+		timing ClaimTiming
+		want   string
+	}{
+		{timing: ClaimTiming{Lock: 3 * time.Second, Store: time.Second}, want: ClaimPhaseLock},
+		{timing: ClaimTiming{Lock: time.Second, Store: 3 * time.Second}, want: ClaimPhaseStore},
+		{timing: ClaimTiming{Lock: time.Second, Store: time.Second, Create: time.Minute}, want: ClaimPhaseCreate},
+	}
+	for _, test := range tests {
+		if got := test.timing.slowest(); got != test.want {
+			t.Errorf("%+v: want %s, got %s", test.timing, test.want, got)
+		}
+	}
+}
+
+func TestWithClaimTiming(t *testing.T) {
+	timing := &ClaimTiming{}
+	if got := claimTimingFrom(WithClaimTiming(context.Background(), timing)); got != timing {
+		t.Errorf("want the timing of the context")
+	}
+	if got := claimTimingFrom(context.Background()); got == nil {
+		t.Errorf("want a timing without one in the context")
+	}
+}
@@ -0,0 +1,96 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+const minDiskGCInterval = 10 * time.Minute
+
+// StartDiskGC frees the disks of the free instances of the runner every
+// interval, when their usage reaches the threshold in percent. Docker
+// objects unused for pruneAge are removed, with the large container logs,
+// the journal and the old temporary files, so that instances kept warm for
+// days do not fail builds with full disks.
+func (m *Manager) StartDiskGC(ctx context.Context, interval time.Duration, threshold int, pruneAge time.Duration) error {
+	return m.startDiskGC(ctx, m.GetTLSServerName(), interval, threshold, pruneAge)
+}
+
+func (m *Manager) startDiskGC(ctx context.Context, tlsServerName string, interval time.Duration, threshold int, pruneAge time.Duration) error {
+	if interval < minDiskGCInterval {
+		return fmt.Errorf("minimum disk gc interval is %.2f minutes", minDiskGCInterval.Minutes())
+	}
+	if threshold < 1 || threshold > 100 {
+		return fmt.Errorf("disk gc threshold must be a percentage, got %d", threshold)
+	}
+	logrus.Infof("disk gc started. It will run every %.2f minutes", interval.Minutes())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						logrus.Errorf("PANIC %v\n%s", r, debug.Stack())
+					}
+				}()
+				m.diskGC(ctx, tlsServerName, threshold, pruneAge)
+			}()
+		}
+	}()
+	return nil
+}
+
+// diskGC frees the disks of the free instances of the runner. Busy
+// instances are skipped, their builds may use the objects removed.
+func (m *Manager) diskGC(ctx context.Context, tlsServerName string, threshold int, pruneAge time.Duration) {
+	for _, pool := range m.poolMap {
+		if pool.Platform.OS == oshelp.OSMac {
+			continue
+		}
+		_, free, _, err := m.List(ctx, pool, &types.QueryParams{RunnerName: m.runnerName})
+		if err != nil {
+			logrus.WithError(err).WithField("pool", pool.Name).Errorln("disk gc: failed to list the instances")
+			continue
+		}
+		for _, inst := range free {
+			if inst.Address == "" || inst.IsHibernated {
+				continue
+			}
+			logr := logrus.WithField("pool", pool.Name).WithField("instanceID", inst.ID)
+			client, err := lehelper.GetClient(inst, tlsServerName, inst.Port, false, 0)
+			if err != nil {
+				logr.WithError(err).Errorln("disk gc: failed to create the lite-engine client")
+				continue
+			}
+			before, after, err := lehelper.DiskGC(ctx, client, inst.Platform.OS, threshold, pruneAge)
+			if err != nil {
+				logr.WithError(err).Warnln("disk gc: failed to free the disk")
+				continue
+			}
+			logr = logr.WithField("before", before).WithField("after", after)
+			switch {
+			case after >= threshold:
+				logr.Warnln("disk gc: the disk usage is above the threshold after the gc")
+			case after < before:
+				logr.Infoln("disk gc: freed the disk")
+			default:
+				logr.Traceln("disk gc: the disk usage is below the threshold")
+			}
+		}
+	}
+}
@@ -62,6 +62,18 @@ func (d *DistributedManager) IsDistributed() bool {
 	return true
 }
 
+// StartSSHKeyRotation rotates the ssh key of the instances of the runner,
+// lite-engine is reached with the server name of distributed dlite.
+func (d *DistributedManager) StartSSHKeyRotation(ctx context.Context, dir, user string, rotation time.Duration) error {
+	return d.startSSHKeyRotation(ctx, d.GetTLSServerName(), dir, user, rotation)
+}
+
+// StartDiskGC frees the disks of the free instances of the runner,
+// lite-engine is reached with the server name of distributed dlite.
+func (d *DistributedManager) StartDiskGC(ctx context.Context, interval time.Duration, threshold int, pruneAge time.Duration) error {
+	return d.startDiskGC(ctx, d.GetTLSServerName(), interval, threshold, pruneAge)
+}
+
 // Instance purger for distributed dlite
 // Delete all instances irrespective of runner name
 func (d *DistributedManager) StartInstancePurger(ctx context.Context, maxAgeBusy, maxAgeFree, purgerTime time.Duration) error {
@@ -62,6 +62,7 @@ type config struct {
 	diskSize            int64
 	diskType            string
 	hibernate           bool
+	nestedVirt          bool
 	image               string
 	network             string
 	noServiceAccount    bool
@@ -125,6 +126,14 @@ func (p *config) CanHibernate() bool {
 	return p.hibernate
 }
 
+func (p *config) MachineType() string {
+	return p.size
+}
+
+func (p *config) DiskSize() int64 {
+	return p.diskSize
+}
+
 func (p *config) Logs(ctx context.Context, instance string) (string, error) {
 	zone, err := p.findInstanceZone(ctx, instance)
 	if err != nil {
@@ -263,6 +272,9 @@ func (p *config) create(ctx context.Context, opts *types.InstanceCreateOpts, nam
 		},
 		Labels: p.labels,
 	}
+	if p.nestedVirt {
+		in.AdvancedMachineFeatures = &compute.AdvancedMachineFeatures{EnableNestedVirtualization: true}
+	}
 	if !p.noServiceAccount {
 		in.ServiceAccounts = []*compute.ServiceAccount{
 			{
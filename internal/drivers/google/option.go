@@ -36,7 +36,7 @@ func WithRootDirectory(platform *types.Platform) Option {
 		const dir = "gcp"
 		switch platform.OS {
 		case oshelp.OSWindows:
-			p.rootDir = oshelp.JoinPaths(platform.OS, "C:\\Windows\\Temp", dir)
+			p.rootDir = oshelp.JoinPaths(platform.OS, oshelp.WindowsRootDir, dir)
 		default:
 			p.rootDir = oshelp.JoinPaths(platform.OS, "/tmp", dir)
 		}
@@ -217,6 +217,14 @@ func WithHibernate(hibernate bool) Option {
 	}
 }
 
+// WithNestedVirtualization returns an option to enable nested
+// virtualization on the instances.
+func WithNestedVirtualization(enable bool) Option {
+	return func(p *config) {
+		p.nestedVirt = enable
+	}
+}
+
 func WithLabels(labels map[string]string) Option {
 	return func(p *config) {
 		p.labels = labels
@@ -11,6 +11,8 @@ import (
 
 type IManager interface {
 	Inspect(name string) (platform types.Platform, rootDir, driver string)
+	InspectSettings(name string) *types.PoolSettings
+	InspectSize(name string) (machineType string, diskSize int64)
 	Exists(name string) bool
 	Find(ctx context.Context, instanceID string) (*types.Instance, error)
 	GetInstanceByStageID(ctx context.Context, poolName, stage string) (*types.Instance, error)
@@ -18,8 +20,13 @@ type IManager interface {
 	AddTmate(env *config.EnvConfig) error
 	Add(pools ...Pool) error
 	StartInstancePurger(ctx context.Context, maxAgeBusy, maxAgeFree time.Duration, purgerTime time.Duration) error
+	StartSSHKeyRotation(ctx context.Context, dir, user string, rotation time.Duration) error
+	StartDiskGC(ctx context.Context, interval time.Duration, threshold int, pruneAge time.Duration) error
+	StartInstanceReconciler(ctx context.Context, setupTimeout time.Duration) error
 	Provision(ctx context.Context, poolName, runnerName, serverName, ownerID, resourceClass string, env *config.EnvConfig, query *types.QueryParams) (*types.Instance, error)
 	Destroy(ctx context.Context, poolName, instanceID string) error
+	Keep(ctx context.Context, poolName, instanceID, key string) error
+	Reclaim(ctx context.Context, poolName, runnerName, key, ownerID string) (*types.Instance, error)
 	BuildPools(ctx context.Context) error
 	CleanPools(ctx context.Context, destroyBusy, destroyFree bool) error
 	StartInstance(ctx context.Context, poolName, instanceID string) (*types.Instance, error)
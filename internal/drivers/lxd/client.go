@@ -0,0 +1,196 @@
+package lxd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+)
+
+const operationTimeout = 5 * time.Minute
+
+// Host is an LXD server instances are created on.
+type Host struct {
+	Address        string // e.g. https://10.0.0.5:8443
+	ClientCertPath string
+	ClientKeyPath  string
+	ServerCertPath string // pins the server certificate, optional
+	Insecure       bool
+}
+
+// client is a minimal client of the LXD REST API.
+type client struct {
+	address string
+	project string
+	http    *http.Client
+}
+
+// response is the envelope of every LXD API response.
+type response struct {
+	Type      string          `json:"type"`
+	Status    string          `json:"status"`
+	ErrorCode int             `json:"error_code"`
+	Error     string          `json:"error"`
+	Operation string          `json:"operation"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+type operation struct {
+	Status string `json:"status"`
+	Err    string `json:"err"`
+}
+
+type instanceState struct {
+	Status  string `json:"status"`
+	Network map[string]struct {
+		Addresses []struct {
+			Family  string `json:"family"`
+			Address string `json:"address"`
+			Scope   string `json:"scope"`
+		} `json:"addresses"`
+	} `json:"network"`
+}
+
+// errNotFound is returned when the requested object does not exist.
+var errNotFound = errors.New("lxd: not found")
+
+func newClient(host *Host, project string) (*client, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: host.Insecure} //nolint:gosec
+	if host.ClientCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(host.ClientCertPath, host.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("lxd: cannot load the client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if host.ServerCertPath != "" {
+		pem, err := os.ReadFile(host.ServerCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("lxd: cannot read the server certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("lxd: invalid server certificate %s", host.ServerCertPath)
+		}
+		cfg.RootCAs = pool
+	}
+	fips.RestrictTLS(cfg)
+	return &client{
+		address: strings.TrimSuffix(host.Address, "/"),
+		project: project,
+		// no client timeout, waiting for an operation takes up to operationTimeout.
+		http: &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}},
+	}, nil
+}
+
+// do sends the request and waits for the operation, if the request started one.
+func (c *client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	res, err := c.request(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	if res.Type == "async" {
+		return c.wait(ctx, res.Operation)
+	}
+	if out != nil {
+		return json.Unmarshal(res.Metadata, out)
+	}
+	return nil
+}
+
+func (c *client) request(ctx context.Context, method, path string, in interface{}) (*response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out := new(response)
+	if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("lxd: %s %s: cannot decode response: %w", method, path, err)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if out.Type == "error" || res.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("lxd: %s %s: %s", method, path, out.Error)
+	}
+	return out, nil
+}
+
+// wait blocks until the operation is finished.
+func (c *client) wait(ctx context.Context, op string) error {
+	path := fmt.Sprintf("%s/wait?timeout=%d", strings.TrimPrefix(op, c.address), int(operationTimeout.Seconds()))
+	res, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	out := new(operation)
+	if err = json.Unmarshal(res.Metadata, out); err != nil {
+		return err
+	}
+	if out.Status != "Success" {
+		return fmt.Errorf("lxd: operation %s: %s %s", op, out.Status, out.Err)
+	}
+	return nil
+}
+
+// plain returns the raw body of a request which does not return json.
+func (c *client) plain(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(path), http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	switch {
+	case err != nil:
+		return "", err
+	case res.StatusCode == http.StatusNotFound:
+		return "", errNotFound
+	case res.StatusCode >= http.StatusBadRequest:
+		return "", fmt.Errorf("lxd: GET %s: %s", path, res.Status)
+	}
+	return string(b), nil
+}
+
+// url returns the url of the api path in the project of the client.
+func (c *client) url(path string) string {
+	u := c.address + path
+	if c.project == "" {
+		return u
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return u + sep + "project=" + url.QueryEscape(c.project)
+}
@@ -0,0 +1,323 @@
+package lxd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/dchest/uniuri"
+)
+
+const (
+	typeContainer      = "container"
+	typeVirtualMachine = "virtual-machine"
+	addressTimeout     = 5 * time.Minute
+)
+
+// config is a struct that implements drivers.Pool interface
+type config struct {
+	hosts   []*Host
+	project string
+
+	image         string
+	imageServer   string
+	imageProtocol string
+	instanceType  string
+	profiles      []string
+	cpus          string
+	memory        string
+	extraConfig   map[string]string
+
+	userData string
+	rootDir  string
+
+	mu   sync.Mutex
+	next int // index of the host the next instance is created on
+}
+
+func New(opts ...Option) (drivers.Driver, error) {
+	p := new(config)
+	for _, opt := range opts {
+		opt(p)
+	}
+	if len(p.hosts) == 0 {
+		return nil, errors.New("lxd: at least one host is required")
+	}
+	if p.image == "" {
+		return nil, errors.New("lxd: image is required")
+	}
+	if p.instanceType != typeContainer && p.instanceType != typeVirtualMachine {
+		return nil, fmt.Errorf("lxd: invalid instance type %q, has to be '%s' or '%s'", p.instanceType, typeContainer, typeVirtualMachine)
+	}
+	for _, host := range p.hosts {
+		if _, err := newClient(host, p.project); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *config) DriverName() string {
+	return string(types.LXD)
+}
+
+func (p *config) InstanceType() string {
+	return p.image
+}
+
+func (p *config) RootDir() string {
+	return p.rootDir
+}
+
+func (p *config) CanHibernate() bool {
+	return false
+}
+
+// Ping checks that every host is reachable.
+func (p *config) Ping(ctx context.Context) error {
+	for _, host := range p.hosts {
+		c, err := newClient(host, p.project)
+		if err != nil {
+			return err
+		}
+		if err = c.do(ctx, http.MethodGet, "/1.0", nil, nil); err != nil {
+			return fmt.Errorf("lxd: host %s: %w", host.Address, err)
+		}
+	}
+	return nil
+}
+
+// Create creates and starts an LXD instance on one of the hosts, it will not perform build specific setup.
+func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	startTime := time.Now()
+	host := p.pickHost()
+	logr := logger.FromContext(ctx).
+		WithField("driver", types.LXD).
+		WithField("pool", opts.PoolName).
+		WithField("host", host.Address).
+		WithField("image", p.image)
+
+	c, err := newClient(host, p.project)
+	if err != nil {
+		return nil, err
+	}
+
+	// lxd instance names are hostnames, lowercase letters, digits and dashes only.
+	name := strings.ToLower(fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8))) //nolint:gomnd
+	name = strings.NewReplacer("_", "-", ".", "-").Replace(name)
+	logr.Infof("lxd: creating instance %s", name)
+
+	source := map[string]string{"type": "image"}
+	if p.imageServer != "" {
+		source["server"] = p.imageServer
+		source["protocol"] = p.imageProtocol
+	}
+	if isFingerprint(p.image) {
+		source["fingerprint"] = p.image
+	} else {
+		source["alias"] = p.image
+	}
+	cfg := map[string]string{
+		"cloud-init.user-data": lehelper.GenerateUserdata(p.userData, opts),
+	}
+	if p.instanceType == typeContainer {
+		// the build runs docker inside the container
+		cfg["security.nesting"] = "true"
+	}
+	if p.cpus != "" {
+		cfg["limits.cpu"] = p.cpus
+	}
+	if p.memory != "" {
+		cfg["limits.memory"] = p.memory
+	}
+	for k, v := range p.extraConfig {
+		cfg[k] = v
+	}
+	req := map[string]interface{}{
+		"name":     name,
+		"type":     p.instanceType,
+		"source":   source,
+		"profiles": p.profiles,
+		"config":   cfg,
+	}
+	if err = c.do(ctx, http.MethodPost, "/1.0/instances", req, nil); err != nil {
+		logr.WithError(err).Errorln("lxd: cannot create instance")
+		return nil, err
+	}
+	instance = &types.Instance{
+		ID:       name,
+		Name:     name,
+		Provider: types.LXD,
+		State:    types.StateCreated,
+		Pool:     opts.PoolName,
+		Image:    p.image,
+		Zone:     host.Address, // the host of the instance
+		Platform: opts.Platform,
+		CAKey:    opts.CAKey,
+		CACert:   opts.CACert,
+		TLSKey:   opts.TLSKey,
+		TLSCert:  opts.TLSCert,
+		Started:  startTime.Unix(),
+		Updated:  startTime.Unix(),
+		Port:     lehelper.LiteEnginePort,
+	}
+
+	if err = c.setState(ctx, name, "start"); err != nil {
+		logr.WithError(err).Errorln("lxd: cannot start instance")
+		return instance, err
+	}
+	instance.Address, err = c.address4(ctx, name)
+	if err != nil {
+		logr.WithError(err).Errorln("lxd: cannot find the instance address")
+		return instance, err
+	}
+	logr.WithField("ip", instance.Address).
+		Infof("lxd: instance %s started in %s", name, time.Since(startTime).Truncate(time.Second))
+	return instance, nil
+}
+
+// Destroy stops and deletes the instances.
+func (p *config) Destroy(ctx context.Context, instances []*types.Instance) error {
+	if len(instances) == 0 {
+		return errors.New("no instances provided")
+	}
+	var errs []string
+	for _, instance := range instances {
+		logr := logger.FromContext(ctx).
+			WithField("id", instance.ID).
+			WithField("host", instance.Zone).
+			WithField("driver", types.LXD)
+
+		c, err := p.clientOf(instance)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		path := "/1.0/instances/" + url.PathEscape(instance.ID)
+		if err = c.setState(ctx, instance.ID, "stop"); err != nil && !errors.Is(err, errNotFound) {
+			logr.WithError(err).Warnln("lxd: cannot stop instance, deleting it anyway")
+		}
+		if err = c.do(ctx, http.MethodDelete, path, nil, nil); err != nil && !errors.Is(err, errNotFound) {
+			logr.WithError(err).Errorln("lxd: cannot delete instance")
+			errs = append(errs, err.Error())
+			continue
+		}
+		logr.Traceln("lxd: instance deleted")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("lxd: cannot destroy instances: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Logs returns the console log of the instance.
+func (p *config) Logs(ctx context.Context, instanceID string) (string, error) {
+	// only the id is known here, look for the instance on every host.
+	for _, host := range p.hosts {
+		c, err := newClient(host, p.project)
+		if err != nil {
+			return "", err
+		}
+		out, err := c.plain(ctx, "/1.0/instances/"+url.PathEscape(instanceID)+"/console")
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		return out, err
+	}
+	return "", fmt.Errorf("lxd: instance %s not found", instanceID)
+}
+
+func (p *config) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	return errors.New("lxd: hibernate is not supported")
+}
+
+func (p *config) Start(ctx context.Context, instanceID, poolName string) (string, error) {
+	return "", errors.New("lxd: start is not supported")
+}
+
+// SetTags stores the tags in the user config keys of the instance.
+func (p *config) SetTags(ctx context.Context, instance *types.Instance, tags map[string]string) error {
+	c, err := p.clientOf(instance)
+	if err != nil {
+		return err
+	}
+	cfg := map[string]string{}
+	for k, v := range tags {
+		cfg["user."+k] = v
+	}
+	return c.do(ctx, http.MethodPatch, "/1.0/instances/"+url.PathEscape(instance.ID), map[string]interface{}{"config": cfg}, nil)
+}
+
+// pickHost returns the hosts in turn, spreading the instances over the hosts.
+func (p *config) pickHost() *Host {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	host := p.hosts[p.next%len(p.hosts)]
+	p.next++
+	return host
+}
+
+// clientOf returns the client of the host the instance runs on.
+func (p *config) clientOf(instance *types.Instance) (*client, error) {
+	for _, host := range p.hosts {
+		if host.Address == instance.Zone {
+			return newClient(host, p.project)
+		}
+	}
+	return nil, fmt.Errorf("lxd: host %s of instance %s is not configured", instance.Zone, instance.ID)
+}
+
+func (c *client) setState(ctx context.Context, name, action string) error {
+	return c.do(ctx, http.MethodPut, "/1.0/instances/"+url.PathEscape(name)+"/state",
+		map[string]interface{}{"action": action, "timeout": 30, "force": action == "stop"}, nil) //nolint:gomnd
+}
+
+// address4 waits until the instance has a global IPv4 address and returns it.
+func (c *client) address4(ctx context.Context, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, addressTimeout)
+	defer cancel()
+	for {
+		state := new(instanceState)
+		if err := c.do(ctx, http.MethodGet, "/1.0/instances/"+url.PathEscape(name)+"/state", nil, state); err != nil {
+			return "", err
+		}
+		for iface, network := range state.Network {
+			if iface == "lo" {
+				continue
+			}
+			for _, addr := range network.Addresses {
+				if addr.Family == "inet" && addr.Scope == "global" {
+					return addr.Address, nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// isFingerprint returns true if the image is referenced by its fingerprint instead of an alias.
+func isFingerprint(image string) bool {
+	if len(image) < 12 { //nolint:gomnd
+		return false
+	}
+	for _, r := range image {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
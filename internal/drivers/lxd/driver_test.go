@@ -0,0 +1,144 @@
+package lxd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// fakeServer is a minimal LXD API keeping the instances in memory.
+type fakeServer struct {
+	mu        sync.Mutex
+	instances map[string]map[string]interface{}
+	running   map[string]bool
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply := func(metadata interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"type": "sync", "metadata": metadata})
+	}
+	async := func() {
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"type": "async", "operation": "/1.0/operations/1"})
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/1.0/instances/"), "/state")
+
+	switch {
+	case r.URL.Path == "/1.0/operations/1/wait":
+		reply(map[string]string{"status": "Success"})
+	case r.URL.Path == "/1.0/instances" && r.Method == http.MethodPost:
+		req := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.instances[req["name"].(string)] = req
+		async()
+	case s.instances[name] == nil:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"type": "error", "error_code": 404, "error": "Instance not found"})
+	case strings.HasSuffix(r.URL.Path, "/state") && r.Method == http.MethodPut:
+		req := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.running[name] = req["action"] == "start"
+		async()
+	case strings.HasSuffix(r.URL.Path, "/state"):
+		reply(map[string]interface{}{"network": map[string]interface{}{
+			"lo":   map[string]interface{}{"addresses": []map[string]string{{"family": "inet", "address": "127.0.0.1", "scope": "local"}}},
+			"eth0": map[string]interface{}{"addresses": []map[string]string{{"family": "inet", "address": "10.1.2.3", "scope": "global"}}},
+		}})
+	case r.Method == http.MethodDelete:
+		delete(s.instances, name)
+		async()
+	}
+}
+
+func TestCreateDestroy(t *testing.T) {
+	fake := &fakeServer{instances: map[string]map[string]interface{}{}, running: map[string]bool{}}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+
+	driver, err := New(
+		WithHosts(&Host{Address: server.URL, Insecure: true}),
+		WithImage("ubuntu/22.04", "https://images.linuxcontainers.org", ""),
+		WithType(""),
+		WithProfiles(nil),
+		WithLimits("2", "4GiB"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	instance, err := driver.Create(ctx, &types.InstanceCreateOpts{RunnerName: "Runner", PoolName: "linux_pool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := instance.Address, "10.1.2.3"; got != want {
+		t.Errorf("want address %s, got %s", want, got)
+	}
+	if !strings.HasPrefix(instance.ID, "runner-linux-pool-") {
+		t.Errorf("unexpected instance name %s", instance.ID)
+	}
+	if !fake.running[instance.ID] {
+		t.Errorf("want instance started")
+	}
+
+	req := fake.instances[instance.ID]
+	source := req["source"].(map[string]interface{})
+	if source["alias"] != "ubuntu/22.04" || source["protocol"] != "simplestreams" {
+		t.Errorf("unexpected image source %v", source)
+	}
+	cfg := req["config"].(map[string]interface{})
+	if cfg["security.nesting"] != "true" || cfg["limits.cpu"] != "2" || cfg["limits.memory"] != "4GiB" {
+		t.Errorf("unexpected instance config %v", cfg)
+	}
+
+	if err = driver.Destroy(ctx, []*types.Instance{instance}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.instances[instance.ID]; ok {
+		t.Errorf("want instance deleted")
+	}
+	// destroying an instance which is already gone is not an error.
+	if err = driver.Destroy(ctx, []*types.Instance{instance}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	host := &Host{Address: "https://127.0.0.1:8443"}
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "no hosts", opts: []Option{WithImage("ubuntu/22.04", "", ""), WithType("")}},
+		{name: "no image", opts: []Option{WithHosts(host), WithType("")}},
+		{name: "bad type", opts: []Option{WithHosts(host), WithImage("ubuntu/22.04", "", ""), WithType("vm")}},
+	}
+	for _, test := range tests {
+		if _, err := New(test.opts...); err == nil {
+			t.Errorf("%s: want error", test.name)
+		}
+	}
+}
+
+func TestIsFingerprint(t *testing.T) {
+	tests := map[string]bool{
+		"ubuntu/22.04": false,
+		"a8f2c3e4b5d6": true,
+		"abc":          false,
+		"A8F2C3E4B5D6": false,
+	}
+	for image, want := range tests {
+		if got := isFingerprint(image); got != want {
+			t.Errorf("isFingerprint(%q) = %v, want %v", image, got, want)
+		}
+	}
+}
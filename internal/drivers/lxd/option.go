@@ -0,0 +1,122 @@
+package lxd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*config)
+
+func SetPlatformDefaults(platform *types.Platform) (*types.Platform, error) {
+	if platform.Arch == "" {
+		platform.Arch = oshelp.ArchAMD64
+	}
+	if platform.Arch != oshelp.ArchAMD64 && platform.Arch != oshelp.ArchARM64 {
+		return platform, fmt.Errorf("invalid arch %s, has to be '%s/%s'", platform.Arch, oshelp.ArchAMD64, oshelp.ArchARM64)
+	}
+	// verify that we are using sane values for OS
+	if platform.OS == "" {
+		platform.OS = oshelp.OSLinux
+	}
+	if platform.OS != oshelp.OSLinux {
+		return platform, fmt.Errorf("lxd - invalid OS %s, has to be '%s'", platform.OS, oshelp.OSLinux)
+	}
+	if platform.OSName == "" {
+		platform.OSName = oshelp.Ubuntu
+	}
+	return platform, nil
+}
+
+func WithHosts(hosts ...*Host) Option {
+	return func(p *config) {
+		p.hosts = hosts
+	}
+}
+
+func WithProject(project string) Option {
+	return func(p *config) {
+		p.project = project
+	}
+}
+
+// WithImage sets the image alias or fingerprint, and the image server it
+// is downloaded from. Without a server the image must exist on the hosts.
+func WithImage(image, server, protocol string) Option {
+	return func(p *config) {
+		p.image = image
+		p.imageServer = server
+		p.imageProtocol = protocol
+		if server != "" && protocol == "" {
+			p.imageProtocol = "simplestreams"
+		}
+	}
+}
+
+// WithType sets the instance type, container (default) or virtual-machine.
+func WithType(instanceType string) Option {
+	return func(p *config) {
+		if instanceType == "" {
+			p.instanceType = typeContainer
+		} else {
+			p.instanceType = instanceType
+		}
+	}
+}
+
+func WithProfiles(profiles []string) Option {
+	return func(p *config) {
+		if len(profiles) == 0 {
+			p.profiles = []string{"default"}
+		} else {
+			p.profiles = profiles
+		}
+	}
+}
+
+func WithLimits(cpus, memory string) Option {
+	return func(p *config) {
+		p.cpus = cpus
+		p.memory = memory
+	}
+}
+
+// WithConfig sets additional instance config keys, e.g. security.privileged.
+func WithConfig(cfg map[string]string) Option {
+	return func(p *config) {
+		p.extraConfig = cfg
+	}
+}
+
+func WithUserData(text, path string) Option {
+	if text != "" {
+		return func(p *config) {
+			p.userData = text
+		}
+	}
+	return func(p *config) {
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				logrus.WithError(err).
+					Fatalln("failed to read user_data file")
+				return
+			}
+			p.userData = string(data)
+		}
+	}
+}
+
+// WithRootDirectory sets the root directory for the virtual machine.
+func WithRootDirectory(dir string) Option {
+	return func(p *config) {
+		if dir == "" {
+			p.rootDir = oshelp.JoinPaths(oshelp.OSLinux, "/tmp", "lxd")
+		} else {
+			p.rootDir = dir
+		}
+	}
+}
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"runtime/debug"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/drone-runners/drone-runner-aws/audit"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/internal/certs"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/notify"
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/runner-go/logger"
@@ -34,6 +38,7 @@ type (
 		harnessTestBinaryURI string
 		pluginBinaryURI      string
 		tmate                types.Tmate
+		claimSLO             time.Duration // claims taking longer are logged as warnings, disabled if 0
 	}
 
 	poolEntry struct {
@@ -54,6 +59,7 @@ func New(
 		liteEnginePath:       env.LiteEngine.Path,
 		harnessTestBinaryURI: env.Settings.HarnessTestBinaryURI,
 		pluginBinaryURI:      env.Settings.PluginBinaryURI,
+		claimSLO:             time.Duration(env.Settings.ClaimSLOMillis) * time.Millisecond,
 	}
 }
 
@@ -71,6 +77,7 @@ func NewManager(
 		liteEnginePath:       env.LiteEngine.Path,
 		harnessTestBinaryURI: env.Settings.HarnessTestBinaryURI,
 		pluginBinaryURI:      env.Settings.PluginBinaryURI,
+		claimSLO:             time.Duration(env.Settings.ClaimSLOMillis) * time.Millisecond,
 	}
 }
 
@@ -88,6 +95,30 @@ func (m *Manager) Inspect(name string) (platform types.Platform, rootDir, driver
 	return
 }
 
+// InspectSettings returns the settings applied on the pool instances
+// during the setup.
+func (m *Manager) InspectSettings(name string) *types.PoolSettings {
+	entry := m.poolMap[name]
+	if entry == nil {
+		return &types.PoolSettings{}
+	}
+	settings := entry.PoolSettings
+	return &settings
+}
+
+// InspectSize returns the machine type and the root disk size, in GB, of
+// the pool instances, if the driver knows them.
+func (m *Manager) InspectSize(name string) (machineType string, diskSize int64) {
+	entry := m.poolMap[name]
+	if entry == nil {
+		return
+	}
+	if sizer, ok := entry.Driver.(Sizer); ok {
+		machineType, diskSize = sizer.MachineType(), sizer.DiskSize()
+	}
+	return
+}
+
 // Exists returns true if a pool with given name exists.
 func (m *Manager) Exists(name string) bool {
 	return m.poolMap[name] != nil
@@ -97,6 +128,16 @@ func (m *Manager) Count() int {
 	return len(m.poolMap)
 }
 
+// PoolNames returns the names of all pools, sorted.
+func (m *Manager) PoolNames() []string {
+	names := make([]string, 0, len(m.poolMap))
+	for name := range m.poolMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (m *Manager) MatchPoolNameFromPlatform(requested *types.Platform) string {
 	for _, pool := range m.poolMap {
 		if pool.Platform.OS == requested.OS && pool.Platform.Arch == requested.Arch {
@@ -151,7 +192,7 @@ func (m *Manager) List(ctx context.Context, pool *poolEntry, queryParams *types.
 		loopInstance := instance
 		if instance.State == types.StateInUse {
 			busy = append(busy, loopInstance)
-		} else if instance.State == types.StateHibernating {
+		} else if instance.State == types.StateHibernating || instance.State == types.StatePreparing {
 			hibernating = append(hibernating, loopInstance)
 		} else {
 			free = append(free, loopInstance)
@@ -193,9 +234,11 @@ func (m *Manager) Add(pools ...Pool) error {
 			return fmt.Errorf("pool %q already defined", name)
 		}
 
+		pool := pools[i]
+		pool.Driver = &auditDriver{Driver: pool.Driver, pool: name}
 		m.poolMap[name] = &poolEntry{
 			Mutex: sync.Mutex{},
-			Pool:  pools[i],
+			Pool:  pool,
 		}
 	}
 
@@ -275,6 +318,11 @@ func (m *Manager) StartInstancePurger(ctx context.Context, maxAgeBusy, maxAgeFre
 							logr.Infof("purger: Terminating %d stale instances\n", len(instances))
 
 							err = pool.Driver.Destroy(ctx, instances)
+							alert := &notify.Alert{Kind: notify.KindReaped, Pool: pool.Name, Instances: instanceIDs(instances), Reason: "purger: over the max age"}
+							if err != nil {
+								alert.Kind, alert.Error = notify.KindDestroyFailed, err.Error()
+							}
+							notify.Send(alert)
 							if err != nil {
 								return fmt.Errorf("failed to delete instances of pool=%q error: %w", pool.Name, err)
 							}
@@ -306,7 +354,23 @@ func (m *Manager) StartInstancePurger(ctx context.Context, maxAgeBusy, maxAgeFre
 
 // Provision returns an instance for a job execution and tags it as in use.
 // This method and BuildPool method contain logic for maintaining pool size.
+// The timing of the claim is recorded into the ClaimTiming of the context.
 func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverName, ownerID, resourceClass string, env *config.EnvConfig, query *types.QueryParams) (*types.Instance, error) {
+	start := time.Now()
+	timing := claimTimingFrom(ctx)
+	inst, err := m.provision(ctx, timing, poolName, runnerName, serverName, ownerID, resourceClass, env, query)
+	timing.Total = time.Since(start)
+	m.observeClaim(ctx, poolName, timing, err)
+	switch {
+	case errors.Is(err, ErrorNoInstanceAvailable):
+		notify.Send(&notify.Alert{Kind: notify.KindPoolExhausted, Pool: poolName})
+	case err != nil:
+		notify.Send(&notify.Alert{Kind: notify.KindProvisionFailed, Pool: poolName, Error: err.Error()})
+	}
+	return inst, err
+}
+
+func (m *Manager) provision(ctx context.Context, timing *ClaimTiming, poolName, runnerName, serverName, ownerID, resourceClass string, env *config.EnvConfig, query *types.QueryParams) (*types.Instance, error) {
 	m.runnerName = runnerName
 	m.liteEnginePath = env.LiteEngine.Path
 	m.tmate = types.Tmate(env.Tmate)
@@ -321,47 +385,73 @@ func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverNam
 		strategy = Greedy{}
 	}
 
+	lockStart := time.Now()
 	pool.Lock()
+	timing.Lock = time.Since(lockStart)
 
-	busy, free, _, err := m.List(ctx, pool, query)
+	storeStart := time.Now()
+	busy, free, hibernating, err := m.List(ctx, pool, query)
+	timing.Store = time.Since(storeStart)
 	if err != nil {
 		pool.Unlock()
 		return nil, fmt.Errorf("provision: failed to list instances of %q pool: %w", poolName, err)
 	}
+	// the instances installing their tools are not free but count against
+	// the size of the pool.
+	busyCount := len(busy)
+	for _, inst := range hibernating {
+		if inst.State == types.StatePreparing {
+			busyCount++
+		}
+	}
 
-	if len(free) == 0 {
+	// stages without a priority leave the reserved free instances.
+	claimable := free
+	if pool.Reserved > 0 && PriorityFrom(ctx) <= 0 && len(free) <= pool.Reserved {
+		claimable = nil
+	}
+
+	if len(claimable) == 0 {
 		pool.Unlock()
-		if canCreate := strategy.CanCreate(pool.MinSize, pool.MaxSize, len(busy), len(free)); !canCreate {
+		if canCreate := strategy.CanCreate(pool.MinSize, pool.MaxSize, busyCount, len(free)); !canCreate {
 			return nil, ErrorNoInstanceAvailable
 		}
 		var inst *types.Instance
+		createStart := time.Now()
 		inst, err = m.setupInstance(ctx, pool, serverName, ownerID, resourceClass, true)
+		timing.Create = time.Since(createStart)
 		if err != nil {
 			return nil, fmt.Errorf("provision: failed to create instance: %w", err)
 		}
+		m.auditClaim(ctx, inst)
 		return inst, nil
 	}
 
-	sort.Slice(free, func(i, j int) bool {
-		iTime := time.Unix(free[i].Started, 0)
-		jTime := time.Unix(free[j].Started, 0)
+	sort.Slice(claimable, func(i, j int) bool {
+		iTime := time.Unix(claimable[i].Started, 0)
+		jTime := time.Unix(claimable[j].Started, 0)
 		return iTime.Before(jTime)
 	})
 
-	inst := free[0]
+	inst := claimable[0]
 	inst.State = types.StateInUse
 	inst.OwnerID = ownerID
+	// the reconciler measures the setup of the stage from the claim.
+	inst.Updated = time.Now().Unix()
 	if inst.IsHibernated {
 		// update started time after bringing instance from hibernate
 		// this will make sure that purger only picks it when it is actually used for max age
 		inst.Started = time.Now().Unix()
 	}
+	storeStart = time.Now()
 	err = m.instanceStore.Update(ctx, inst)
+	timing.Store += time.Since(storeStart)
 	if err != nil {
 		pool.Unlock()
 		return nil, fmt.Errorf("provision: failed to tag an instance in %q pool: %w", poolName, err)
 	}
 	pool.Unlock()
+	m.auditClaim(ctx, inst)
 
 	// the go routine here uses the global context because this function is called
 	// from setup API call (and we can't use HTTP request context for async tasks)
@@ -372,6 +462,15 @@ func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverNam
 	return inst, nil
 }
 
+func (m *Manager) auditClaim(ctx context.Context, inst *types.Instance) {
+	audit.Record(ctx, &audit.Event{
+		Action:   audit.ActionInstanceClaim,
+		Pool:     inst.Pool,
+		Instance: inst.ID,
+		Owner:    inst.OwnerID,
+	})
+}
+
 // Destroy destroys an instance in a pool.
 func (m *Manager) Destroy(ctx context.Context, poolName, instanceID string) error {
 	pool := m.poolMap[poolName]
@@ -386,6 +485,7 @@ func (m *Manager) Destroy(ctx context.Context, poolName, instanceID string) erro
 
 	err = pool.Driver.Destroy(ctx, []*types.Instance{instance})
 	if err != nil {
+		notify.Send(&notify.Alert{Kind: notify.KindDestroyFailed, Pool: poolName, Instances: []string{instanceID}, Error: err.Error()})
 		return fmt.Errorf("provision: failed to destroy an instance of %q pool: %w", poolName, err)
 	}
 
@@ -450,17 +550,28 @@ func (m *Manager) CleanPools(ctx context.Context, destroyBusy, destroyFree bool)
 	return returnError
 }
 
+// PingDriver checks the driver and the configuration of each pool. The
+// error of each pool failing the check is logged, so that all of them are
+// reported at once.
 func (m *Manager) PingDriver(ctx context.Context) error {
+	var failed []string
 	for _, pool := range m.poolMap {
 		err := pool.Driver.Ping(ctx)
 		if err != nil {
-			return err
+			logrus.WithError(err).
+				WithField("pool", pool.Name).
+				WithField("driver", pool.Driver.DriverName()).
+				Errorln("manager: pool failed the ping")
+			failed = append(failed, pool.Name)
 		}
 
 		const pauseBetweenChecks = 500 * time.Millisecond
 		time.Sleep(pauseBetweenChecks)
 	}
-
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("pools failed the ping: %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
@@ -585,6 +696,9 @@ func (m *Manager) setupInstance(ctx context.Context, pool *poolEntry, tlsServerN
 	if inuse {
 		inst.State = types.StateInUse
 		inst.OwnerID = ownerID
+	} else if len(pool.Toolcache) > 0 {
+		// the instance is claimed once the tools are installed.
+		inst.State = types.StatePreparing
 	}
 
 	inst.RunnerName = m.runnerName
@@ -599,6 +713,9 @@ func (m *Manager) setupInstance(ctx context.Context, pool *poolEntry, tlsServerN
 
 	if !inuse {
 		go func() {
+			if len(pool.Toolcache) > 0 {
+				m.installTools(context.Background(), pool, tlsServerName, inst.ID)
+			}
 			herr := m.hibernateWithRetries(context.Background(), pool.Name, tlsServerName, inst.ID)
 			if herr != nil {
 				logrus.WithError(herr).Errorln("failed to hibernate the vm")
@@ -733,6 +850,36 @@ func (m *Manager) hibernate(ctx context.Context, instanceID, poolName string, po
 	return nil
 }
 
+// installTools pre-installs the toolcache of the pool on a free instance.
+// The instance is created in the preparing state, it is freed for the
+// builds once the installation ended, whether or not it succeeded.
+func (m *Manager) installTools(ctx context.Context, pool *poolEntry, tlsServerName, instanceID string) {
+	logr := logrus.WithField("pool", pool.Name).WithField("instanceID", instanceID)
+	defer func() {
+		if err := m.updateInstState(ctx, pool, instanceID, types.StateCreated); err != nil {
+			logr.WithError(err).Errorln("toolcache: failed to free the instance")
+		}
+	}()
+	m.waitForInstanceConnectivity(ctx, tlsServerName, instanceID)
+
+	inst, err := m.Find(ctx, instanceID)
+	if err != nil {
+		logr.WithError(err).Errorln("toolcache: failed to find the instance")
+		return
+	}
+	client, err := lehelper.GetClient(inst, tlsServerName, inst.Port, false, 0)
+	if err != nil {
+		logr.WithError(err).Errorln("toolcache: failed to create the lite-engine client")
+		return
+	}
+	st := time.Now()
+	if err = lehelper.InstallTools(ctx, client, inst.Platform.OS, inst.Platform.Arch, pool.Toolcache); err != nil {
+		logr.WithError(err).Errorln("toolcache: failed to install the tools")
+		return
+	}
+	logr.WithField("duration", time.Since(st).Truncate(time.Second)).Infoln("toolcache: tools installed")
+}
+
 func (m *Manager) updateInstState(ctx context.Context, pool *poolEntry, instanceID string, state types.InstanceState) error {
 	pool.Lock()
 	defer pool.Unlock()
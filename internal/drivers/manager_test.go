@@ -0,0 +1,73 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/store/database/ldb"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func TestManager_ListPreparing(t *testing.T) {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	m := &Manager{instanceStore: ldb.NewInstanceStore(db)}
+	for id, state := range map[string]types.InstanceState{
+		"busy":      types.StateInUse,
+		"free":      types.StateCreated,
+		"preparing": types.StatePreparing,
+	} {
+		if err = m.instanceStore.Create(ctx, &types.Instance{ID: id, Pool: "linux", State: state}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	busy, free, hibernating, err := m.List(ctx, &poolEntry{Pool: Pool{Name: "linux"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(busy) != 1 || len(free) != 1 || free[0].ID != "free" {
+		t.Errorf("Want the preparing instance not free, got %d busy and %d free", len(busy), len(free))
+	}
+	if len(hibernating) != 1 || hibernating[0].ID != "preparing" {
+		t.Errorf("Want the preparing instance with the hibernating ones, got %d", len(hibernating))
+	}
+}
+
+func TestManager_ProvisionPreparing(t *testing.T) {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	m := &Manager{
+		instanceStore: ldb.NewInstanceStore(db),
+		strategy:      MinMax{},
+		poolMap:       map[string]*poolEntry{"linux": {Pool: Pool{Name: "linux", MaxSize: 2}}},
+	}
+	for id, state := range map[string]types.InstanceState{
+		"busy":      types.StateInUse,
+		"preparing": types.StatePreparing,
+	} {
+		if err = m.instanceStore.Create(ctx, &types.Instance{ID: id, Pool: "linux", State: state}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the pool is full with the instance installing its tools.
+	_, err = m.Provision(ctx, "linux", "runner", "runner", "", "", &config.EnvConfig{}, nil)
+	if !errors.Is(err, ErrorNoInstanceAvailable) {
+		t.Errorf("Want no instance available, got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/dchest/uniuri"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// config is a struct that implements drivers.Pool interface
+type config struct {
+	provider common.ConfigurationProvider
+	region   string
+
+	compartmentID      string
+	availabilityDomain string
+	shape              string
+	ocpus              float32
+	memoryGBs          float32
+	imageID            string
+	subnetID           string
+	assignPublicIP     bool
+	bootVolumeGBs      int64
+	freeformTags       map[string]string
+
+	userData string
+	rootDir  string
+}
+
+func New(opts ...Option) (drivers.Driver, error) {
+	p := new(config)
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.provider == nil {
+		p.provider = common.DefaultConfigProvider()
+	}
+	if p.compartmentID == "" || p.availabilityDomain == "" || p.shape == "" || p.imageID == "" || p.subnetID == "" {
+		return nil, errors.New("oci: compartment, availability domain, shape, image and subnet are required")
+	}
+	return p, nil
+}
+
+func (p *config) DriverName() string {
+	return string(types.OCI)
+}
+
+func (p *config) InstanceType() string {
+	return p.imageID
+}
+
+func (p *config) RootDir() string {
+	return p.rootDir
+}
+
+func (p *config) CanHibernate() bool {
+	return false
+}
+
+func (p *config) Ping(ctx context.Context) error {
+	client, err := p.compute()
+	if err != nil {
+		return err
+	}
+	_, err = client.ListInstances(ctx, core.ListInstancesRequest{
+		CompartmentId: common.String(p.compartmentID),
+		Limit:         common.Int(1),
+	})
+	return err
+}
+
+// Create launches an OCI compute instance for the pool, it will not perform build specific setup.
+func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	startTime := time.Now()
+	logr := logger.FromContext(ctx).
+		WithField("driver", types.OCI).
+		WithField("pool", opts.PoolName).
+		WithField("image", p.imageID).
+		WithField("shape", p.shape)
+
+	client, err := p.compute()
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
+	logr.Infof("oci: creating instance %s", name)
+
+	source := core.InstanceSourceViaImageDetails{ImageId: common.String(p.imageID)}
+	if p.bootVolumeGBs > 0 {
+		source.BootVolumeSizeInGBs = common.Int64(p.bootVolumeGBs)
+	}
+	details := core.LaunchInstanceDetails{
+		DisplayName:        common.String(name),
+		CompartmentId:      common.String(p.compartmentID),
+		AvailabilityDomain: common.String(p.availabilityDomain),
+		Shape:              common.String(p.shape),
+		SourceDetails:      source,
+		CreateVnicDetails: &core.CreateVnicDetails{
+			SubnetId:       common.String(p.subnetID),
+			AssignPublicIp: common.Bool(p.assignPublicIP),
+		},
+		Metadata: map[string]string{
+			"user_data": base64.StdEncoding.EncodeToString([]byte(lehelper.GenerateUserdata(p.userData, opts))),
+		},
+		FreeformTags: p.freeformTags,
+	}
+	// flexible shapes take the ocpus and memory, fixed shapes have neither.
+	if p.ocpus > 0 || p.memoryGBs > 0 {
+		details.ShapeConfig = &core.LaunchInstanceShapeConfigDetails{}
+		if p.ocpus > 0 {
+			details.ShapeConfig.Ocpus = common.Float32(p.ocpus)
+		}
+		if p.memoryGBs > 0 {
+			details.ShapeConfig.MemoryInGBs = common.Float32(p.memoryGBs)
+		}
+	}
+	res, err := client.LaunchInstance(ctx, core.LaunchInstanceRequest{LaunchInstanceDetails: details})
+	if err != nil {
+		logr.WithError(err).Errorln("oci: cannot create instance")
+		return nil, err
+	}
+
+	instance = &types.Instance{
+		ID:       *res.Id,
+		Name:     name,
+		Provider: types.OCI,
+		State:    types.StateCreated,
+		Pool:     opts.PoolName,
+		Region:   p.region,
+		Zone:     p.availabilityDomain,
+		Image:    p.imageID,
+		Size:     p.shape,
+		Platform: opts.Platform,
+		CAKey:    opts.CAKey,
+		CACert:   opts.CACert,
+		TLSKey:   opts.TLSKey,
+		TLSCert:  opts.TLSCert,
+		Started:  startTime.Unix(),
+		Updated:  startTime.Unix(),
+		Port:     lehelper.LiteEnginePort,
+	}
+
+	// poll the instance until it is running and its vnic has an address.
+	for {
+		select {
+		case <-ctx.Done():
+			logr.WithField("name", name).Debugln("oci: cannot ascertain network")
+			return instance, ctx.Err()
+		case <-time.After(5 * time.Second): //nolint:gomnd
+		}
+		got, getErr := client.GetInstance(ctx, core.GetInstanceRequest{InstanceId: res.Id})
+		if getErr != nil {
+			logr.WithError(getErr).Errorln("oci: cannot find instance")
+			return instance, getErr
+		}
+		switch got.LifecycleState {
+		case core.InstanceLifecycleStateRunning:
+		case core.InstanceLifecycleStateTerminating, core.InstanceLifecycleStateTerminated:
+			return instance, fmt.Errorf("oci: instance %s terminated while starting", name)
+		default:
+			continue
+		}
+		if instance.Address, err = p.address(ctx, client, instance.ID); err != nil {
+			logr.WithError(err).Errorln("oci: cannot find the instance address")
+			return instance, err
+		}
+		if instance.Address != "" {
+			break
+		}
+	}
+	logr.WithField("ip", instance.Address).
+		Infof("oci: instance %s running in %s", name, time.Since(startTime).Truncate(time.Second))
+	return instance, nil
+}
+
+// Destroy terminates the instances and their boot volumes.
+func (p *config) Destroy(ctx context.Context, instances []*types.Instance) error {
+	if len(instances) == 0 {
+		return errors.New("no instances provided")
+	}
+	client, err := p.compute()
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, instance := range instances {
+		logr := logger.FromContext(ctx).
+			WithField("id", instance.ID).
+			WithField("driver", types.OCI)
+
+		_, err = client.TerminateInstance(ctx, core.TerminateInstanceRequest{
+			InstanceId:         common.String(instance.ID),
+			PreserveBootVolume: common.Bool(false),
+		})
+		if se, ok := common.IsServiceError(err); ok && se.GetHTTPStatusCode() == http.StatusNotFound {
+			logr.Warnln("oci: instance does not exist")
+			continue
+		}
+		if err != nil {
+			logr.WithError(err).Errorln("oci: cannot terminate instance")
+			errs = append(errs, err.Error())
+			continue
+		}
+		logr.Traceln("oci: instance terminated")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("oci: cannot destroy instances: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (p *config) Logs(ctx context.Context, instanceID string) (string, error) {
+	return "no logs here", nil
+}
+
+func (p *config) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	return errors.New("oci: hibernate is not supported")
+}
+
+func (p *config) Start(ctx context.Context, instanceID, poolName string) (string, error) {
+	return "", errors.New("oci: start is not supported")
+}
+
+// SetTags adds the tags to the freeform tags of the instance.
+func (p *config) SetTags(ctx context.Context, instance *types.Instance, tags map[string]string) error {
+	client, err := p.compute()
+	if err != nil {
+		return err
+	}
+	merged := map[string]string{}
+	for k, v := range p.freeformTags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	_, err = client.UpdateInstance(ctx, core.UpdateInstanceRequest{
+		InstanceId:            common.String(instance.ID),
+		UpdateInstanceDetails: core.UpdateInstanceDetails{FreeformTags: merged},
+	})
+	return err
+}
+
+func (p *config) compute() (core.ComputeClient, error) {
+	client, err := core.NewComputeClientWithConfigurationProvider(p.provider)
+	if err != nil {
+		return client, err
+	}
+	if p.region != "" {
+		client.SetRegion(p.region)
+	}
+	return client, nil
+}
+
+// address returns the address of the primary vnic of the instance, the
+// public address if one is assigned. It is empty until the vnic is attached.
+func (p *config) address(ctx context.Context, client core.ComputeClient, instanceID string) (string, error) {
+	attachments, err := client.ListVnicAttachments(ctx, core.ListVnicAttachmentsRequest{
+		CompartmentId: common.String(p.compartmentID),
+		InstanceId:    common.String(instanceID),
+	})
+	if err != nil {
+		return "", err
+	}
+	network, err := core.NewVirtualNetworkClientWithConfigurationProvider(p.provider)
+	if err != nil {
+		return "", err
+	}
+	if p.region != "" {
+		network.SetRegion(p.region)
+	}
+	for _, attachment := range attachments.Items {
+		if attachment.LifecycleState != core.VnicAttachmentLifecycleStateAttached || attachment.VnicId == nil {
+			continue
+		}
+		vnic, vnicErr := network.GetVnic(ctx, core.GetVnicRequest{VnicId: attachment.VnicId})
+		if vnicErr != nil {
+			return "", vnicErr
+		}
+		if vnic.IsPrimary == nil || !*vnic.IsPrimary {
+			continue
+		}
+		if p.assignPublicIP && vnic.PublicIp != nil {
+			return *vnic.PublicIp, nil
+		}
+		if !p.assignPublicIP && vnic.PrivateIp != nil {
+			return *vnic.PrivateIp, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,152 @@
+package oci
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/common/auth"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*config)
+
+func SetPlatformDefaults(platform *types.Platform) (*types.Platform, error) {
+	if platform.Arch == "" {
+		platform.Arch = oshelp.ArchAMD64
+	}
+	if platform.Arch != oshelp.ArchAMD64 && platform.Arch != oshelp.ArchARM64 {
+		return platform, fmt.Errorf("invalid arch %s, has to be '%s/%s'", platform.Arch, oshelp.ArchAMD64, oshelp.ArchARM64)
+	}
+	// verify that we are using sane values for OS
+	if platform.OS == "" {
+		platform.OS = oshelp.OSLinux
+	}
+	if platform.OS != oshelp.OSLinux {
+		return platform, fmt.Errorf("oci - invalid OS %s, has to be '%s'", platform.OS, oshelp.OSLinux)
+	}
+	if platform.OSName == "" {
+		platform.OSName = oshelp.Ubuntu
+	}
+	return platform, nil
+}
+
+// WithConfigFile reads the credentials from the profile of an oci cli
+// config file, e.g. ~/.oci/config.
+func WithConfigFile(path, profile string) Option {
+	return func(p *config) {
+		if path == "" {
+			return
+		}
+		if profile == "" {
+			profile = "DEFAULT"
+		}
+		provider, err := common.ConfigurationProviderFromFileWithProfile(path, profile, "")
+		if err != nil {
+			logrus.WithError(err).
+				Fatalln("failed to read the oci config file")
+			return
+		}
+		p.provider = provider
+	}
+}
+
+// WithInstancePrincipal authenticates as the instance the runner runs on.
+func WithInstancePrincipal(enabled bool) Option {
+	return func(p *config) {
+		if !enabled {
+			return
+		}
+		provider, err := auth.InstancePrincipalConfigurationProvider()
+		if err != nil {
+			logrus.WithError(err).
+				Fatalln("failed to create the oci instance principal provider")
+			return
+		}
+		p.provider = provider
+	}
+}
+
+func WithRegion(region string) Option {
+	return func(p *config) {
+		p.region = region
+	}
+}
+
+func WithCompartment(compartmentID string) Option {
+	return func(p *config) {
+		p.compartmentID = compartmentID
+	}
+}
+
+func WithAvailabilityDomain(domain string) Option {
+	return func(p *config) {
+		p.availabilityDomain = domain
+	}
+}
+
+// WithShape sets the shape, the ocpus and memory are only used by
+// flexible shapes, e.g. VM.Standard.A1.Flex.
+func WithShape(shape string, ocpus, memoryGBs float32) Option {
+	return func(p *config) {
+		p.shape = shape
+		p.ocpus = ocpus
+		p.memoryGBs = memoryGBs
+	}
+}
+
+// WithImage sets the image OCID and the boot volume size, zero keeps the
+// image default.
+func WithImage(imageID string, bootVolumeGBs int64) Option {
+	return func(p *config) {
+		p.imageID = imageID
+		p.bootVolumeGBs = bootVolumeGBs
+	}
+}
+
+// WithSubnet sets the VCN subnet OCID of the instances, and whether they
+// get a public address the runner connects to.
+func WithSubnet(subnetID string, assignPublicIP bool) Option {
+	return func(p *config) {
+		p.subnetID = subnetID
+		p.assignPublicIP = assignPublicIP
+	}
+}
+
+func WithTags(tags map[string]string) Option {
+	return func(p *config) {
+		p.freeformTags = tags
+	}
+}
+
+func WithUserData(text, path string) Option {
+	if text != "" {
+		return func(p *config) {
+			p.userData = text
+		}
+	}
+	return func(p *config) {
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				logrus.WithError(err).
+					Fatalln("failed to read user_data file")
+				return
+			}
+			p.userData = string(data)
+		}
+	}
+}
+
+// WithRootDirectory sets the root directory for the virtual machine.
+func WithRootDirectory(dir string) Option {
+	return func(p *config) {
+		if dir == "" {
+			p.rootDir = oshelp.JoinPaths(oshelp.OSLinux, "/tmp", "oci")
+		} else {
+			p.rootDir = dir
+		}
+	}
+}
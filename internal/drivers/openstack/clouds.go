@@ -0,0 +1,135 @@
+package openstack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gophercloud/gophercloud"
+	"gopkg.in/yaml.v2"
+)
+
+// clouds is the content of a clouds.yaml file, as used by the openstack cli.
+type clouds struct {
+	Clouds map[string]cloud `yaml:"clouds"`
+}
+
+type cloud struct {
+	AuthType   string    `yaml:"auth_type"`
+	Auth       cloudAuth `yaml:"auth"`
+	RegionName string    `yaml:"region_name"`
+}
+
+type cloudAuth struct {
+	AuthURL                     string `yaml:"auth_url"`
+	Username                    string `yaml:"username"`
+	UserID                      string `yaml:"user_id"`
+	Password                    string `yaml:"password"`
+	ProjectID                   string `yaml:"project_id"`
+	ProjectName                 string `yaml:"project_name"`
+	DomainID                    string `yaml:"domain_id"`
+	DomainName                  string `yaml:"domain_name"`
+	UserDomainID                string `yaml:"user_domain_id"`
+	UserDomainName              string `yaml:"user_domain_name"`
+	ProjectDomainID             string `yaml:"project_domain_id"`
+	ProjectDomainName           string `yaml:"project_domain_name"`
+	ApplicationCredentialID     string `yaml:"application_credential_id"`
+	ApplicationCredentialName   string `yaml:"application_credential_name"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+}
+
+// cloudsPaths returns the locations searched for clouds.yaml, in the
+// order used by the openstack cli.
+func cloudsPaths() []string {
+	if path := os.Getenv("OS_CLIENT_CONFIG_FILE"); path != "" {
+		return []string{path}
+	}
+	paths := []string{"clouds.yaml"}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "openstack", "clouds.yaml"))
+	}
+	return append(paths, "/etc/openstack/clouds.yaml")
+}
+
+// loadCloud reads the named cloud from the clouds.yaml file. If path is
+// empty the default locations are searched.
+func loadCloud(path, name string) (*cloud, error) {
+	paths := cloudsPaths()
+	if path != "" {
+		paths = []string{path}
+	}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out := new(clouds)
+		if err = yaml.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("openstack: cannot parse %s: %w", p, err)
+		}
+		c, ok := out.Clouds[name]
+		if !ok {
+			return nil, fmt.Errorf("openstack: cloud %q not found in %s", name, p)
+		}
+		return &c, nil
+	}
+	return nil, fmt.Errorf("openstack: clouds.yaml not found")
+}
+
+// authOptions converts the cloud auth to gophercloud auth options.
+// Application credentials are unscoped, the project is implied by them.
+func (c *cloud) authOptions() gophercloud.AuthOptions {
+	a := c.Auth
+	opts := gophercloud.AuthOptions{
+		IdentityEndpoint: a.AuthURL,
+		AllowReauth:      true,
+	}
+	if c.AuthType == "v3applicationcredential" || a.ApplicationCredentialID != "" || a.ApplicationCredentialName != "" {
+		opts.ApplicationCredentialID = a.ApplicationCredentialID
+		opts.ApplicationCredentialName = a.ApplicationCredentialName
+		opts.ApplicationCredentialSecret = a.ApplicationCredentialSecret
+		opts.UserID = a.UserID
+		opts.Username = a.Username
+		opts.DomainID = first(a.UserDomainID, a.DomainID)
+		opts.DomainName = first(a.UserDomainName, a.DomainName)
+		if opts.DomainID != "" {
+			opts.DomainName = ""
+		}
+		return opts
+	}
+	opts.Username = a.Username
+	opts.UserID = a.UserID
+	opts.Password = a.Password
+	opts.DomainID = first(a.UserDomainID, a.DomainID)
+	opts.DomainName = first(a.UserDomainName, a.DomainName)
+	// a project id is unique, only a project name needs its domain.
+	switch {
+	case a.ProjectID != "":
+		opts.Scope = &gophercloud.AuthScope{ProjectID: a.ProjectID}
+	case a.ProjectName != "":
+		opts.Scope = &gophercloud.AuthScope{
+			ProjectName: a.ProjectName,
+			DomainID:    first(a.ProjectDomainID, a.DomainID),
+			DomainName:  first(a.ProjectDomainName, a.DomainName),
+		}
+		if opts.Scope.DomainID != "" {
+			opts.Scope.DomainName = ""
+		}
+	}
+	if opts.DomainID != "" {
+		opts.DomainName = ""
+	}
+	return opts
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
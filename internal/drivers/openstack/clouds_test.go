@@ -0,0 +1,73 @@
+package openstack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gophercloud/gophercloud"
+)
+
+const testClouds = `
+clouds:
+  password:
+    auth:
+      auth_url: https://keystone.example.com:5000/v3
+      username: ci
+      password: secret
+      project_name: builds
+      user_domain_name: Default
+      project_domain_id: default
+    region_name: RegionOne
+  appcred:
+    auth_type: v3applicationcredential
+    auth:
+      auth_url: https://keystone.example.com:5000/v3
+      application_credential_id: 0123abcd
+      application_credential_secret: secret
+`
+
+func TestLoadCloud(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clouds.yaml")
+	if err := os.WriteFile(path, []byte(testClouds), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadCloud(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.RegionName, "RegionOne"; got != want {
+		t.Errorf("want region %s, got %s", want, got)
+	}
+	want := gophercloud.AuthOptions{
+		IdentityEndpoint: "https://keystone.example.com:5000/v3",
+		Username:         "ci",
+		Password:         "secret",
+		DomainName:       "Default",
+		AllowReauth:      true,
+		Scope:            &gophercloud.AuthScope{ProjectName: "builds", DomainID: "default"},
+	}
+	if diff := cmp.Diff(want, c.authOptions()); diff != "" {
+		t.Error(diff)
+	}
+
+	c, err = loadCloud(path, "appcred")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = gophercloud.AuthOptions{
+		IdentityEndpoint:            "https://keystone.example.com:5000/v3",
+		ApplicationCredentialID:     "0123abcd",
+		ApplicationCredentialSecret: "secret",
+		AllowReauth:                 true,
+	}
+	if diff := cmp.Diff(want, c.authOptions()); diff != "" {
+		t.Error(diff)
+	}
+
+	if _, err = loadCloud(path, "missing"); err == nil {
+		t.Error("want error for an unknown cloud")
+	}
+}
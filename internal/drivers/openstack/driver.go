@@ -0,0 +1,410 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/dchest/uniuri"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+const (
+	statusActive = "ACTIVE"
+	statusError  = "ERROR"
+)
+
+// config is a struct that implements drivers.Pool interface
+type config struct {
+	cloud      string
+	cloudsFile string
+	auth       gophercloud.AuthOptions
+	region     string
+
+	flavor           string
+	image            string
+	network          string
+	securityGroups   []string
+	availabilityZone string
+	metadata         map[string]string
+
+	userData string
+	rootDir  string
+
+	mu       sync.Mutex
+	provider *gophercloud.ProviderClient
+	refs     map[string]string // flavor, image and network names resolved to ids
+}
+
+func New(opts ...Option) (drivers.Driver, error) {
+	p := &config{refs: map[string]string{}}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.cloud != "" {
+		c, err := loadCloud(p.cloudsFile, p.cloud)
+		if err != nil {
+			return nil, err
+		}
+		p.auth = c.authOptions()
+		if p.region == "" {
+			p.region = c.RegionName
+		}
+	}
+	if p.auth.IdentityEndpoint == "" {
+		return nil, errors.New("openstack: auth url is required, set the cloud or the account")
+	}
+	if p.flavor == "" || p.image == "" || p.network == "" {
+		return nil, errors.New("openstack: flavor, image and network are required")
+	}
+	return p, nil
+}
+
+func (p *config) DriverName() string {
+	return string(types.OpenStack)
+}
+
+func (p *config) InstanceType() string {
+	return p.image
+}
+
+func (p *config) RootDir() string {
+	return p.rootDir
+}
+
+func (p *config) CanHibernate() bool {
+	return false
+}
+
+func (p *config) Ping(ctx context.Context) error {
+	client, err := p.compute()
+	if err != nil {
+		return err
+	}
+	return servers.List(client, servers.ListOpts{Limit: 1}).EachPage(func(pagination.Page) (bool, error) {
+		return false, nil
+	})
+}
+
+// Create creates an OpenStack server for the pool, it will not perform build specific setup.
+func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	startTime := time.Now()
+	logr := logger.FromContext(ctx).
+		WithField("driver", types.OpenStack).
+		WithField("pool", opts.PoolName).
+		WithField("image", p.image).
+		WithField("flavor", p.flavor)
+
+	client, err := p.compute()
+	if err != nil {
+		return nil, err
+	}
+	flavorID, imageID, networkID, err := p.resolve()
+	if err != nil {
+		logr.WithError(err).Errorln("openstack: cannot resolve the flavor, image or network")
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
+	logr.Infof("openstack: creating instance %s", name)
+
+	server, err := servers.Create(client, servers.CreateOpts{
+		Name:             name,
+		FlavorRef:        flavorID,
+		ImageRef:         imageID,
+		Networks:         []servers.Network{{UUID: networkID}},
+		SecurityGroups:   p.securityGroups,
+		AvailabilityZone: p.availabilityZone,
+		Metadata:         p.metadata,
+		UserData:         []byte(lehelper.GenerateUserdata(p.userData, opts)),
+	}).Extract()
+	if err != nil {
+		logr.WithError(err).Errorln("openstack: cannot create instance")
+		return nil, err
+	}
+	instance = &types.Instance{
+		ID:       server.ID,
+		Name:     name,
+		Provider: types.OpenStack,
+		State:    types.StateCreated,
+		Pool:     opts.PoolName,
+		Region:   p.region,
+		Zone:     p.availabilityZone,
+		Image:    p.image,
+		Size:     p.flavor,
+		Platform: opts.Platform,
+		CAKey:    opts.CAKey,
+		CACert:   opts.CACert,
+		TLSKey:   opts.TLSKey,
+		TLSCert:  opts.TLSCert,
+		Started:  startTime.Unix(),
+		Updated:  startTime.Unix(),
+		Port:     lehelper.LiteEnginePort,
+	}
+
+	// poll the server until it is active and has an address on the network.
+	for {
+		select {
+		case <-ctx.Done():
+			logr.WithField("name", name).Debugln("openstack: cannot ascertain network")
+			return instance, ctx.Err()
+		case <-time.After(5 * time.Second): //nolint:gomnd
+		}
+		server, err = servers.Get(client, instance.ID).Extract()
+		if err != nil {
+			logr.WithError(err).Errorln("openstack: cannot find instance")
+			return instance, err
+		}
+		if server.Status == statusError {
+			msg := ""
+			if server.Fault.Message != "" {
+				msg = ": " + server.Fault.Message
+			}
+			return instance, fmt.Errorf("openstack: instance %s failed to build%s", name, msg)
+		}
+		if server.Status != statusActive {
+			continue
+		}
+		if instance.Address = address4(server.Addresses); instance.Address != "" {
+			break
+		}
+	}
+	logr.WithField("ip", instance.Address).
+		Infof("openstack: instance %s active in %s", name, time.Since(startTime).Truncate(time.Second))
+	return instance, nil
+}
+
+// Destroy deletes the OpenStack servers.
+func (p *config) Destroy(ctx context.Context, instances []*types.Instance) error {
+	if len(instances) == 0 {
+		return errors.New("no instances provided")
+	}
+	client, err := p.compute()
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, instance := range instances {
+		logr := logger.FromContext(ctx).
+			WithField("id", instance.ID).
+			WithField("driver", types.OpenStack)
+
+		err = servers.Delete(client, instance.ID).ExtractErr()
+		if errors.As(err, new(gophercloud.ErrDefault404)) {
+			logr.Warnln("openstack: instance does not exist")
+			continue
+		}
+		if err != nil {
+			logr.WithError(err).Errorln("openstack: cannot delete instance")
+			errs = append(errs, err.Error())
+			continue
+		}
+		logr.Traceln("openstack: instance deleted")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("openstack: cannot destroy instances: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Logs returns the console output of the server.
+func (p *config) Logs(ctx context.Context, instanceID string) (string, error) {
+	client, err := p.compute()
+	if err != nil {
+		return "", err
+	}
+	return servers.ShowConsoleOutput(client, instanceID, servers.ShowConsoleOutputOpts{}).Extract()
+}
+
+func (p *config) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	return errors.New("openstack: hibernate is not supported")
+}
+
+func (p *config) Start(ctx context.Context, instanceID, poolName string) (string, error) {
+	return "", errors.New("openstack: start is not supported")
+}
+
+// SetTags stores the tags in the server metadata.
+func (p *config) SetTags(ctx context.Context, instance *types.Instance, tags map[string]string) error {
+	client, err := p.compute()
+	if err != nil {
+		return err
+	}
+	_, err = servers.UpdateMetadata(client, instance.ID, servers.MetadataOpts(tags)).Extract()
+	return err
+}
+
+// authenticate returns the provider client, authenticating on first use.
+// The token is renewed by gophercloud when it expires.
+func (p *config) authenticate() (*gophercloud.ProviderClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+	provider, err := openstack.AuthenticatedClient(p.auth)
+	if err != nil {
+		return nil, fmt.Errorf("openstack: cannot authenticate: %w", err)
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *config) compute() (*gophercloud.ServiceClient, error) {
+	provider, err := p.authenticate()
+	if err != nil {
+		return nil, err
+	}
+	return openstack.NewComputeV2(provider, gophercloud.EndpointOpts{Region: p.region})
+}
+
+// resolve returns the ids of the flavor, image and network, which may be
+// configured by name or by id. Resolved ids are cached.
+func (p *config) resolve() (flavorID, imageID, networkID string, err error) {
+	provider, err := p.authenticate()
+	if err != nil {
+		return "", "", "", err
+	}
+	eo := gophercloud.EndpointOpts{Region: p.region}
+
+	if flavorID, err = p.lookup("flavor", p.flavor, func() (string, error) {
+		client, cerr := openstack.NewComputeV2(provider, eo)
+		if cerr != nil {
+			return "", cerr
+		}
+		page, cerr := flavors.ListDetail(client, flavors.ListOpts{AccessType: flavors.AllAccess}).AllPages()
+		if cerr != nil {
+			return "", cerr
+		}
+		list, cerr := flavors.ExtractFlavors(page)
+		if cerr != nil {
+			return "", cerr
+		}
+		for i := range list {
+			if list[i].ID == p.flavor || list[i].Name == p.flavor {
+				return list[i].ID, nil
+			}
+		}
+		return "", nil
+	}); err != nil {
+		return "", "", "", err
+	}
+
+	if imageID, err = p.lookup("image", p.image, func() (string, error) {
+		client, cerr := openstack.NewImageServiceV2(provider, eo)
+		if cerr != nil {
+			return "", cerr
+		}
+		page, cerr := images.List(client, images.ListOpts{Name: p.image}).AllPages()
+		if cerr != nil {
+			return "", cerr
+		}
+		list, cerr := images.ExtractImages(page)
+		if cerr != nil || len(list) == 0 {
+			return "", cerr
+		}
+		return list[0].ID, nil
+	}); err != nil {
+		return "", "", "", err
+	}
+
+	networkID, err = p.lookup("network", p.network, func() (string, error) {
+		client, cerr := openstack.NewNetworkV2(provider, eo)
+		if cerr != nil {
+			return "", cerr
+		}
+		page, cerr := networks.List(client, networks.ListOpts{Name: p.network}).AllPages()
+		if cerr != nil {
+			return "", cerr
+		}
+		list, cerr := networks.ExtractNetworks(page)
+		if cerr != nil || len(list) == 0 {
+			return "", cerr
+		}
+		return list[0].ID, nil
+	})
+	return flavorID, imageID, networkID, err
+}
+
+// lookup returns the id of the named object. Values which look like ids
+// are returned as is, names are resolved with find.
+func (p *config) lookup(kind, value string, find func() (string, error)) (string, error) {
+	if isUUID(value) && kind != "flavor" { // flavor ids are not always uuids
+		return value, nil
+	}
+	p.mu.Lock()
+	id, ok := p.refs[kind+"/"+value]
+	p.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	id, err := find()
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fmt.Errorf("openstack: %s %q not found", kind, value)
+	}
+	p.mu.Lock()
+	p.refs[kind+"/"+value] = id
+	p.mu.Unlock()
+	return id, nil
+}
+
+// address4 returns the first fixed IPv4 address of the server, or a
+// floating address if one is assigned.
+func address4(addresses map[string]interface{}) string {
+	var fixed, floating string
+	for _, network := range addresses {
+		list, _ := network.([]interface{})
+		for _, item := range list {
+			addr, _ := item.(map[string]interface{})
+			if version, _ := addr["version"].(float64); version != 4 { //nolint:gomnd
+				continue
+			}
+			ip, _ := addr["addr"].(string)
+			if kind, _ := addr["OS-EXT-IPS:type"].(string); kind == "floating" {
+				floating = ip
+			} else if fixed == "" {
+				fixed = ip
+			}
+		}
+	}
+	if floating != "" {
+		return floating
+	}
+	return fixed
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 { //nolint:gomnd
+		return false
+	}
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23: //nolint:gomnd
+			if r != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+	}
+	return true
+}
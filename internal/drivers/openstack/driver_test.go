@@ -0,0 +1,52 @@
+package openstack
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddress4(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses string
+		want      string
+	}{
+		{
+			name:      "fixed",
+			addresses: `{"private":[{"version":6,"addr":"fd00::5"},{"version":4,"addr":"10.0.0.5","OS-EXT-IPS:type":"fixed"}]}`,
+			want:      "10.0.0.5",
+		},
+		{
+			name:      "floating preferred",
+			addresses: `{"private":[{"version":4,"addr":"10.0.0.5","OS-EXT-IPS:type":"fixed"},{"version":4,"addr":"203.0.113.7","OS-EXT-IPS:type":"floating"}]}`,
+			want:      "203.0.113.7",
+		},
+		{
+			name:      "not yet assigned",
+			addresses: `{}`,
+			want:      "",
+		},
+	}
+	for _, test := range tests {
+		addresses := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(test.addresses), &addresses); err != nil {
+			t.Fatal(err)
+		}
+		if got := address4(addresses); got != test.want {
+			t.Errorf("%s: want address %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestIsUUID(t *testing.T) {
+	tests := map[string]bool{
+		"3f1c9e2a-6b4d-4e8f-9a0b-1c2d3e4f5a6b": true,
+		"ubuntu-22.04":                         false,
+		"3f1c9e2a6b4d4e8f9a0b1c2d3e4f5a6b":     false,
+	}
+	for value, want := range tests {
+		if got := isUUID(value); got != want {
+			t.Errorf("isUUID(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
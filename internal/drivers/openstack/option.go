@@ -0,0 +1,129 @@
+package openstack
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/gophercloud/gophercloud"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*config)
+
+func SetPlatformDefaults(platform *types.Platform) (*types.Platform, error) {
+	if platform.Arch == "" {
+		platform.Arch = oshelp.ArchAMD64
+	}
+	if platform.Arch != oshelp.ArchAMD64 && platform.Arch != oshelp.ArchARM64 {
+		return platform, fmt.Errorf("invalid arch %s, has to be '%s/%s'", platform.Arch, oshelp.ArchAMD64, oshelp.ArchARM64)
+	}
+	// verify that we are using sane values for OS
+	if platform.OS == "" {
+		platform.OS = oshelp.OSLinux
+	}
+	if platform.OS != oshelp.OSLinux && platform.OS != oshelp.OSWindows {
+		return platform, fmt.Errorf("openstack - invalid OS %s, has to be either'%s/%s'", platform.OS, oshelp.OSLinux, oshelp.OSWindows)
+	}
+	// set osname
+	if platform.OS == oshelp.OSLinux && platform.OSName == "" {
+		platform.OSName = oshelp.Ubuntu
+	}
+	return platform, nil
+}
+
+// WithCloud reads the credentials and region of the named cloud from a
+// clouds.yaml file. If path is empty the standard locations are searched.
+func WithCloud(name, path string) Option {
+	return func(p *config) {
+		p.cloud = name
+		p.cloudsFile = path
+	}
+}
+
+// WithAuth sets the credentials when no cloud is configured, either a
+// username and password or an application credential.
+func WithAuth(opts gophercloud.AuthOptions) Option {
+	return func(p *config) {
+		opts.AllowReauth = true
+		p.auth = opts
+	}
+}
+
+func WithRegion(region string) Option {
+	return func(p *config) {
+		p.region = region
+	}
+}
+
+// WithFlavor sets the flavor name or id.
+func WithFlavor(flavor string) Option {
+	return func(p *config) {
+		p.flavor = flavor
+	}
+}
+
+// WithImage sets the image name or id.
+func WithImage(image string) Option {
+	return func(p *config) {
+		p.image = image
+	}
+}
+
+// WithNetwork sets the name or id of the network the instances are attached to.
+func WithNetwork(network string) Option {
+	return func(p *config) {
+		p.network = network
+	}
+}
+
+func WithSecurityGroups(groups ...string) Option {
+	return func(p *config) {
+		p.securityGroups = groups
+	}
+}
+
+func WithAvailabilityZone(zone string) Option {
+	return func(p *config) {
+		p.availabilityZone = zone
+	}
+}
+
+func WithMetadata(metadata map[string]string) Option {
+	return func(p *config) {
+		p.metadata = metadata
+	}
+}
+
+func WithUserData(text, path string) Option {
+	if text != "" {
+		return func(p *config) {
+			p.userData = text
+		}
+	}
+	return func(p *config) {
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				logrus.WithError(err).
+					Fatalln("failed to read user_data file")
+				return
+			}
+			p.userData = string(data)
+		}
+	}
+}
+
+// WithRootDirectory returns an OS specific temp directory
+func WithRootDirectory(platform *types.Platform) Option {
+	return func(p *config) {
+		const dir = "openstack"
+		switch platform.OS {
+		case oshelp.OSWindows:
+			p.rootDir = oshelp.JoinPaths(platform.OS, oshelp.WindowsRootDir, dir)
+		default:
+			p.rootDir = oshelp.JoinPaths(platform.OS, "/tmp", dir)
+		}
+	}
+}
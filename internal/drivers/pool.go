@@ -18,6 +18,11 @@ type Pool struct {
 	MinSize int
 
 	Platform types.Platform
+	// Reserved free instances are only claimed by stages with a priority
+	// above zero.
+	Reserved int
+
+	types.PoolSettings
 
 	Driver Driver
 }
@@ -36,3 +41,14 @@ type Driver interface {
 	DriverName() string
 	CanHibernate() bool
 }
+
+// Sizer is implemented by the drivers which know the size of the instances
+// they create.
+type Sizer interface {
+	// MachineType returns the machine type of the instances, e.g.
+	// t3.large.
+	MachineType() string
+	// DiskSize returns the size of the root disk of the instances in GB, 0
+	// for the default of the image.
+	DiskSize() int64
+}
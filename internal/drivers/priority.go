@@ -0,0 +1,18 @@
+package drivers
+
+import "context"
+
+type priorityKey struct{}
+
+// WithPriority returns a context carrying the priority of the stage that
+// provisions an instance. Stages with a priority above zero may claim the
+// reserved free instances of a pool.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFrom returns the priority of the stage, zero if not set.
+func PriorityFrom(ctx context.Context) int {
+	priority, _ := ctx.Value(priorityKey{}).(int)
+	return priority
+}
@@ -0,0 +1,138 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/audit"
+	"github.com/drone-runners/drone-runner-aws/notify"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+const minSetupTimeout = 5 * time.Minute
+
+// reasonDetails completes the warning logged for the reasons an instance
+// is terminated by the reconciler.
+var reasonDetails = map[string]string{
+	"setup did not complete":       "setup did not complete",
+	"kept instance was not reused": "reusing stage did not claim it",
+}
+
+// orphaned reports whether an instance was claimed for a stage whose
+// setup never completed. The setup tags the claimed instance with its
+// stage, an instance in use without one past the setup timeout was left
+// by a setup that failed or a runner that stopped mid-setup.
+func orphaned(inst *types.Instance, setupTimeout time.Duration, now time.Time) bool {
+	return inst.State == types.StateInUse &&
+		inst.Stage == "" &&
+		now.Sub(time.Unix(inst.Updated, 0)) > setupTimeout
+}
+
+// TagStage tags the instance claimed by the stage with its name, the
+// reconciler never terminates the instances tagged with a stage. A stage
+// without a name is tagged default.
+func TagStage(inst *types.Instance, stage string) {
+	inst.Stage = stage
+	if inst.Stage == "" {
+		inst.Stage = "default"
+	}
+	inst.Updated = time.Now().Unix()
+}
+
+// StartInstanceReconciler terminates the orphaned instances of the pools,
+// and the instances kept for a stage which did not reuse them, every setup
+// timeout, they would otherwise hold the capacity of their pool until the
+// purger terminates them.
+func (m *Manager) StartInstanceReconciler(ctx context.Context, setupTimeout time.Duration) error {
+	if setupTimeout < minSetupTimeout {
+		return fmt.Errorf("minimum setup timeout is %.2f minutes", minSetupTimeout.Minutes())
+	}
+	logrus.WithField("setup_timeout", setupTimeout).
+		Infof("instance reconciler started, the instances claimed by a stage whose setup did not complete in %.2f minutes are terminated", setupTimeout.Minutes())
+
+	go func() {
+		ticker := time.NewTicker(setupTimeout)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						logrus.Errorf("PANIC %v\n%s", r, debug.Stack())
+					}
+				}()
+				for _, pool := range m.poolMap {
+					if err := m.reconcilePool(ctx, pool, setupTimeout); err != nil {
+						logrus.WithError(err).WithField("pool", pool.Name).
+							Errorln("reconciler: failed to terminate the orphaned instances")
+					}
+				}
+			}()
+		}
+	}()
+	return nil
+}
+
+// reconcilePool terminates the orphaned and unclaimed instances of the
+// pool and replaces them.
+func (m *Manager) reconcilePool(ctx context.Context, pool *poolEntry, setupTimeout time.Duration) error {
+	pool.Lock()
+	defer pool.Unlock()
+
+	busy, _, _, err := m.List(ctx, pool, &types.QueryParams{RunnerName: m.runnerName})
+	if err != nil {
+		return err
+	}
+	var instances []*types.Instance
+	reason := ""
+	now := time.Now()
+	for _, inst := range busy {
+		switch {
+		case orphaned(inst, setupTimeout, now):
+			reason = "setup did not complete"
+		case unclaimed(inst, setupTimeout, now):
+			reason = "kept instance was not reused"
+		default:
+			continue
+		}
+		instances = append(instances, inst)
+		logrus.WithField("pool", pool.Name).
+			WithField("instanceID", inst.ID).
+			WithField("owner", inst.OwnerID).
+			Warnf("reconciler: terminating the instance, it is in use but its %s in %.2f minutes", reasonDetails[reason], setupTimeout.Minutes())
+		audit.Record(ctx, &audit.Event{
+			Action:   audit.ActionInstanceReconcile,
+			Pool:     pool.Name,
+			Instance: inst.ID,
+			Owner:    inst.OwnerID,
+			Details:  map[string]string{"reason": reason},
+		})
+	}
+	if len(instances) == 0 {
+		return nil
+	}
+
+	err = pool.Driver.Destroy(ctx, instances)
+	alert := &notify.Alert{Kind: notify.KindReaped, Pool: pool.Name, Instances: instanceIDs(instances), Reason: "reconciler: " + reason}
+	if err != nil {
+		alert.Kind, alert.Error = notify.KindDestroyFailed, err.Error()
+	}
+	notify.Send(alert)
+	if err != nil {
+		return fmt.Errorf("failed to destroy the instances: %w", err)
+	}
+	for _, inst := range instances {
+		if err = m.Delete(ctx, inst.ID); err != nil {
+			return fmt.Errorf("failed to delete %s from the instance store: %w", inst.ID, err)
+		}
+	}
+	return m.buildPool(ctx, pool, m.GetTLSServerName(), nil)
+}
@@ -0,0 +1,85 @@
+package drivers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestOrphaned(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour).Unix()
+	recent := now.Add(-time.Minute).Unix()
+	tests := []struct {
+		name string
+		inst *types.Instance
+		want bool
+	}{
+		{
+			name: "claimed without a stage past the timeout",
+			inst: &types.Instance{State: types.StateInUse, Updated: old},
+			want: true,
+		},
+		{
+			name: "claimed without a stage within the timeout",
+			inst: &types.Instance{State: types.StateInUse, Updated: recent},
+		},
+		{
+			name: "running a stage",
+			inst: &types.Instance{State: types.StateInUse, Stage: "stage-1", Updated: old},
+		},
+		{
+			name: "free",
+			inst: &types.Instance{State: types.StateCreated, Updated: old},
+		},
+	}
+	for _, test := range tests {
+		if got := orphaned(test.inst, 10*time.Minute, now); got != test.want {
+			t.Errorf("%s: want %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestUnclaimed(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour).Unix()
+	recent := now.Add(-time.Minute).Unix()
+	tests := []struct {
+		name string
+		inst *types.Instance
+		want bool
+	}{
+		{
+			name: "kept past the timeout",
+			inst: &types.Instance{State: types.StateInUse, Stage: keptPrefix + "key", Updated: old},
+			want: true,
+		},
+		{
+			name: "kept within the timeout",
+			inst: &types.Instance{State: types.StateInUse, Stage: keptPrefix + "key", Updated: recent},
+		},
+		{
+			name: "running a stage",
+			inst: &types.Instance{State: types.StateInUse, Stage: "stage-1", Updated: old},
+		},
+	}
+	for _, test := range tests {
+		if got := unclaimed(test.inst, 10*time.Minute, now); got != test.want {
+			t.Errorf("%s: want %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+// TestTagStage checks that the instances claimed by the drone engine are
+// never terminated by the reconciler, whatever the name of their stage.
+func TestTagStage(t *testing.T) {
+	for _, stage := range []string{"", "build"} {
+		inst := &types.Instance{State: types.StateInUse}
+		TagStage(inst, stage)
+		later := time.Unix(inst.Updated, 0).Add(24 * time.Hour)
+		if orphaned(inst, 10*time.Minute, later) || unclaimed(inst, 10*time.Minute, later) {
+			t.Errorf("Want the instance of stage %q not reconciled, got tagged %q", stage, inst.Stage)
+		}
+	}
+}
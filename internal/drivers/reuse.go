@@ -0,0 +1,82 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/audit"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// keptPrefix prefixes the stage of the instances kept for the stage
+// reusing them.
+const keptPrefix = "kept:"
+
+// unclaimed reports whether an instance was kept for a stage which did
+// not reuse it within the timeout, e.g. a stage that was skipped or ran on
+// another runner.
+func unclaimed(inst *types.Instance, timeout time.Duration, now time.Time) bool {
+	return inst.State == types.StateInUse &&
+		strings.HasPrefix(inst.Stage, keptPrefix) &&
+		now.Sub(time.Unix(inst.Updated, 0)) > timeout
+}
+
+// Keep keeps the instance, in use, for the stage reusing it with the key.
+func (m *Manager) Keep(ctx context.Context, poolName, instanceID, key string) error {
+	pool := m.poolMap[poolName]
+	if pool == nil {
+		return fmt.Errorf("keep: pool name %q not found", poolName)
+	}
+	pool.Lock()
+	defer pool.Unlock()
+
+	inst, err := m.Find(ctx, instanceID)
+	if err != nil {
+		return fmt.Errorf("keep: failed to find instance %s: %w", instanceID, err)
+	}
+	inst.Stage = keptPrefix + key
+	inst.Updated = time.Now().Unix()
+	if err = m.instanceStore.Update(ctx, inst); err != nil {
+		return fmt.Errorf("keep: failed to update instance %s: %w", instanceID, err)
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:   audit.ActionInstanceKeep,
+		Pool:     poolName,
+		Instance: inst.ID,
+		Owner:    inst.OwnerID,
+		Details:  map[string]string{"key": key},
+	})
+	return nil
+}
+
+// Reclaim claims the instance of the runner kept for the stage reusing it
+// with the key, nil if there is none. An instance is reclaimed once.
+func (m *Manager) Reclaim(ctx context.Context, poolName, runnerName, key, ownerID string) (*types.Instance, error) {
+	pool := m.poolMap[poolName]
+	if pool == nil {
+		return nil, fmt.Errorf("reclaim: pool name %q not found", poolName)
+	}
+	pool.Lock()
+	defer pool.Unlock()
+
+	query := &types.QueryParams{Status: types.StateInUse, Stage: keptPrefix + key, RunnerName: runnerName}
+	list, err := m.instanceStore.List(ctx, pool.Name, query)
+	if err != nil {
+		return nil, fmt.Errorf("reclaim: failed to list instances of %q pool: %w", poolName, err)
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	inst := list[0]
+	// the setup tags the instance with the stage reusing it.
+	inst.Stage = ""
+	inst.OwnerID = ownerID
+	inst.Updated = time.Now().Unix()
+	if err = m.instanceStore.Update(ctx, inst); err != nil {
+		return nil, fmt.Errorf("reclaim: failed to update instance %s: %w", inst.ID, err)
+	}
+	m.auditClaim(ctx, inst)
+	return inst, nil
+}
@@ -0,0 +1,228 @@
+package drivers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// sshKeyReconcileInterval is the interval at which the current key is
+	// authorized on the instances that do not authorize it yet.
+	sshKeyReconcileInterval = time.Minute
+	minSSHKeyRotation       = 10 * time.Minute
+
+	sshKeyFile = "id_ed25519"
+)
+
+// sshKey is the ssh key of the runner. The private key is kept in a
+// directory, so that operators can reach the instances with it.
+type sshKey struct {
+	dir         string
+	authorized  string // line of authorized_keys
+	fingerprint string
+	created     time.Time
+}
+
+// loadSSHKey loads the key of the directory, if any.
+func loadSSHKey(dir string) (*sshKey, error) {
+	k := &sshKey{dir: dir}
+	path := filepath.Join(dir, sshKeyFile)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	} else if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh key %s: %w", path, err)
+	}
+	k.set(signer.PublicKey(), info.ModTime())
+	return k, nil
+}
+
+func (k *sshKey) set(pub ssh.PublicKey, created time.Time) {
+	k.authorized = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) + " " + lehelper.SSHKeyComment
+	k.fingerprint = ssh.FingerprintSHA256(pub)
+	k.created = created
+}
+
+func (k *sshKey) expired(rotation time.Duration) bool {
+	return k.fingerprint == "" || time.Since(k.created) >= rotation
+}
+
+// rotate generates a new key and replaces the key files. The files are
+// renamed into place, readers never see a partial key.
+func (k *sshKey) rotate() error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, lehelper.SSHKeyComment)
+	if err != nil {
+		return err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(k.dir, 0o700); err != nil { //nolint:gomnd
+		return err
+	}
+	path := filepath.Join(k.dir, sshKeyFile)
+	next := *k
+	next.set(sshPub, time.Now())
+	if err = writeFileAtomic(path+".pub", []byte(next.authorized+"\n"), 0o644); err != nil { //nolint:gomnd
+		return err
+	}
+	if err = writeFileAtomic(path, pem.EncodeToMemory(block), 0o600); err != nil { //nolint:gomnd
+		return err
+	}
+	*k = next
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// StartSSHKeyRotation generates a new ssh key every rotation period and
+// authorizes it for the user of the linux instances of the runner. The
+// previous key is revoked on each instance when the new one is
+// authorized, and the fingerprint of the authorized key is kept in the
+// instance store.
+func (m *Manager) StartSSHKeyRotation(ctx context.Context, dir, user string, rotation time.Duration) error {
+	return m.startSSHKeyRotation(ctx, m.GetTLSServerName(), dir, user, rotation)
+}
+
+func (m *Manager) startSSHKeyRotation(ctx context.Context, tlsServerName, dir, user string, rotation time.Duration) error {
+	if rotation < minSSHKeyRotation {
+		return fmt.Errorf("minimum ssh key rotation is %.2f minutes", minSSHKeyRotation.Minutes())
+	}
+	key, err := loadSSHKey(dir)
+	if err != nil {
+		return err
+	}
+	if key.expired(rotation) {
+		if err = key.rotate(); err != nil {
+			return fmt.Errorf("failed to generate the ssh key: %w", err)
+		}
+	}
+	logrus.WithField("fingerprint", key.fingerprint).
+		Infof("ssh key rotation started. The key is rotated every %.2f minutes", rotation.Minutes())
+
+	go func() {
+		ticker := time.NewTicker(sshKeyReconcileInterval)
+		defer ticker.Stop()
+		for {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						logrus.Errorf("PANIC %v\n%s", r, debug.Stack())
+					}
+				}()
+				if key.expired(rotation) {
+					if rotateErr := key.rotate(); rotateErr != nil {
+						logrus.WithError(rotateErr).Errorln("ssh key: failed to rotate the key")
+					} else {
+						logrus.WithField("fingerprint", key.fingerprint).Infoln("ssh key: rotated the key")
+					}
+				}
+				m.authorizeSSHKey(ctx, tlsServerName, user, key)
+			}()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// authorizeSSHKey authorizes the key on the running linux instances of
+// the runner that do not authorize it yet. Hibernating instances are
+// updated once they are started.
+func (m *Manager) authorizeSSHKey(ctx context.Context, tlsServerName, user string, key *sshKey) {
+	for _, pool := range m.poolMap {
+		if pool.Platform.OS != oshelp.OSLinux {
+			continue
+		}
+		busy, free, _, err := m.List(ctx, pool, &types.QueryParams{RunnerName: m.runnerName})
+		if err != nil {
+			logrus.WithError(err).WithField("pool", pool.Name).Errorln("ssh key: failed to list the instances")
+			continue
+		}
+		for _, inst := range append(busy, free...) {
+			if inst.SSHKey == key.fingerprint || inst.Address == "" {
+				continue
+			}
+			logr := logrus.WithField("pool", pool.Name).WithField("instanceID", inst.ID)
+			client, err := lehelper.GetClient(inst, tlsServerName, inst.Port, false, 0)
+			if err != nil {
+				logr.WithError(err).Errorln("ssh key: failed to create the lite-engine client")
+				continue
+			}
+			if err = lehelper.AuthorizeSSHKey(ctx, client, inst.Platform.OS, user, key.authorized); err != nil {
+				logr.WithError(err).Errorln("ssh key: failed to authorize the key")
+				continue
+			}
+			if err = m.setSSHKey(ctx, pool, inst.ID, key.fingerprint); err != nil {
+				logr.WithError(err).Errorln("ssh key: failed to store the key")
+				continue
+			}
+			logr.WithField("fingerprint", key.fingerprint).Debugln("ssh key: authorized the key")
+		}
+	}
+}
+
+// setSSHKey stores the fingerprint of the key authorized on the instance.
+// The instance is read again under the lock of the pool, so that a
+// concurrent state change is not overwritten.
+func (m *Manager) setSSHKey(ctx context.Context, pool *poolEntry, instanceID, fingerprint string) error {
+	pool.Lock()
+	defer pool.Unlock()
+
+	inst, err := m.Find(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	inst.SSHKey = fingerprint
+	return m.instanceStore.Update(ctx, inst)
+}
@@ -0,0 +1,55 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+)
+
+func TestSSHKeyRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ssh")
+
+	key, err := loadSSHKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.expired(time.Hour) {
+		t.Fatal("want a missing key to be expired")
+	}
+	if err = key.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if key.expired(time.Hour) {
+		t.Error("want a new key not to be expired")
+	}
+	if !strings.HasPrefix(key.authorized, "ssh-ed25519 ") || !strings.HasSuffix(key.authorized, " "+lehelper.SSHKeyComment) {
+		t.Errorf("unexpected authorized key %q", key.authorized)
+	}
+	info, err := os.Stat(filepath.Join(dir, sshKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("want the private key readable by the owner only, got %v", perm)
+	}
+
+	loaded, err := loadSSHKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.fingerprint != key.fingerprint || loaded.authorized != key.authorized {
+		t.Errorf("want the stored key %s, got %s", key.fingerprint, loaded.fingerprint)
+	}
+
+	previous := key.fingerprint
+	if err = key.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if key.fingerprint == previous {
+		t.Error("want a new key after rotation")
+	}
+}
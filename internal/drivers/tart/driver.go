@@ -0,0 +1,207 @@
+package tart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/dchest/uniuri"
+	"github.com/sirupsen/logrus"
+)
+
+// BIN is the tart cli, see https://tart.run
+var BIN = "tart"
+
+const ipWaitSecs = 120
+
+type config struct {
+	image    string
+	cpus     int
+	memoryMB int
+	rootDir  string
+	userData string
+}
+
+func New(opts ...Option) (drivers.Driver, error) {
+	p := new(config)
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.image == "" {
+		return nil, errors.New("tart: image is required")
+	}
+	return p, nil
+}
+
+func (p *config) RootDir() string {
+	return p.rootDir
+}
+
+func (p *config) DriverName() string {
+	return string(types.Tart)
+}
+
+func (p *config) Ping(_ context.Context) error {
+	_, err := exec.LookPath(BIN)
+	return err
+}
+
+func (p *config) CanHibernate() bool {
+	return false
+}
+
+// Create clones the image into a new VM, boots it and runs the user data
+// script in the guest with the tart guest agent.
+func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	startTime := time.Now()
+	machineName := fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
+
+	logr := logger.FromContext(ctx).
+		WithField("cloud", types.Tart).
+		WithField("name", machineName).
+		WithField("image", p.image).
+		WithField("pool", opts.PoolName)
+
+	// clones are copy-on-write, remote images are pulled on first use.
+	if out, cloneErr := commandTart(ctx, "clone", p.image, machineName).CombinedOutput(); cloneErr != nil {
+		logr.WithError(cloneErr).WithField("output", string(out)).Errorln("tart: failed to clone VM")
+		return nil, cloneErr
+	}
+	if args := p.setArgs(machineName); args != nil {
+		if out, setErr := commandTart(ctx, args...).CombinedOutput(); setErr != nil {
+			logr.WithError(setErr).WithField("output", string(out)).Errorln("tart: failed to set VM resources")
+			_ = p.delete(machineName)
+			return nil, setErr
+		}
+	}
+
+	// tart run blocks for the lifetime of the VM, it is stopped by Destroy.
+	run := exec.Command(BIN, "run", "--no-graphics", machineName) //nolint:gosec
+	if err = run.Start(); err != nil {
+		logr.WithError(err).Errorln("tart: failed to start VM")
+		_ = p.delete(machineName)
+		return nil, err
+	}
+	go func() {
+		if waitErr := run.Wait(); waitErr != nil {
+			logrus.WithError(waitErr).WithField("name", machineName).Debugln("tart: VM exited")
+		}
+	}()
+
+	instance = &types.Instance{
+		ID:       machineName,
+		Name:     machineName,
+		Provider: types.Tart,
+		State:    types.StateCreated,
+		Pool:     opts.PoolName,
+		Image:    p.image,
+		Platform: opts.Platform,
+		CACert:   opts.CACert,
+		CAKey:    opts.CAKey,
+		TLSCert:  opts.TLSCert,
+		TLSKey:   opts.TLSKey,
+		Started:  startTime.Unix(),
+		Updated:  time.Now().Unix(),
+		Port:     lehelper.LiteEnginePort,
+	}
+
+	out, err := commandTart(ctx, "ip", "--wait", strconv.Itoa(ipWaitSecs), machineName).Output()
+	if err != nil {
+		logr.WithError(err).Errorln("tart: failed to get the VM address")
+		return instance, err
+	}
+	instance.Address = strings.TrimSpace(string(out))
+
+	logr.Info("tart: running user data script in VM")
+	script := commandTart(ctx, "exec", "-i", machineName, "sudo", "/bin/bash", "-s")
+	script.Stdin = strings.NewReader(lehelper.GenerateUserdata(p.userData, opts))
+	if out, err = script.CombinedOutput(); err != nil {
+		logr.WithError(err).WithField("output", string(out)).Errorln("tart: failed to run script in VM")
+		return instance, err
+	}
+
+	logr.
+		WithField("ip", instance.Address).
+		WithField("time", fmt.Sprintf("%.2fs", time.Since(startTime).Seconds())).
+		Debugln("tart: [creation] complete")
+	return instance, nil
+}
+
+func (p *config) Destroy(ctx context.Context, instances []*types.Instance) error {
+	if len(instances) == 0 {
+		return nil
+	}
+	var errs []string
+	for _, instance := range instances {
+		logr := logger.FromContext(ctx).
+			WithField("id", instance.ID).
+			WithField("driver", types.Tart)
+		if err := p.delete(instance.ID); err != nil {
+			logr.WithError(err).Errorln("tart: error deleting VM")
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("tart: cannot destroy instances: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (p *config) Hibernate(_ context.Context, _, _ string) error {
+	return errors.New("unimplemented")
+}
+
+func (p *config) Start(_ context.Context, _, _ string) (string, error) {
+	return "", errors.New("unimplemented")
+}
+
+func (p *config) Logs(ctx context.Context, instance string) (string, error) {
+	return "", nil
+}
+
+func (p *config) SetTags(ctx context.Context, instance *types.Instance,
+	tags map[string]string) error {
+	return nil
+}
+
+// setArgs returns the arguments of tart set for the configured resources,
+// nil if the image settings are kept.
+func (p *config) setArgs(name string) []string {
+	if p.cpus <= 0 && p.memoryMB <= 0 {
+		return nil
+	}
+	args := []string{"set", name}
+	if p.cpus > 0 {
+		args = append(args, "--cpu", strconv.Itoa(p.cpus))
+	}
+	if p.memoryMB > 0 {
+		args = append(args, "--memory", strconv.Itoa(p.memoryMB))
+	}
+	return args
+}
+
+// delete stops the VM, if it is running, and deletes it. It does not use
+// the request context, a canceled build must still clean up.
+func (p *config) delete(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_ = commandTart(ctx, "stop", name).Run()
+	out, err := commandTart(ctx, "delete", name).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "does not exist") {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func commandTart(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, BIN, args...)
+}
@@ -0,0 +1,83 @@
+package tart
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// fakeTart writes a tart stand-in which records its invocations.
+func fakeTart(t *testing.T) (bin, calls string) {
+	dir := t.TempDir()
+	calls = filepath.Join(dir, "calls")
+	bin = filepath.Join(dir, "tart")
+	script := `#!/bin/sh
+echo "$@" >> ` + calls + `
+case "$1" in
+ip) echo 192.168.64.5 ;;
+exec) cat > /dev/null ;;
+esac
+`
+	if err := os.WriteFile(bin, []byte(script), 0700); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	return bin, calls
+}
+
+func TestCreateDestroy(t *testing.T) {
+	bin, calls := fakeTart(t)
+	defer func(old string) { BIN = old }(BIN)
+	BIN = bin
+
+	driver, err := New(
+		WithImage("ghcr.io/cirruslabs/macos-sonoma-base:latest"),
+		WithResources(4, 8192),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	instance, err := driver.Create(ctx, &types.InstanceCreateOpts{RunnerName: "runner", PoolName: "mac", Platform: types.Platform{OS: "darwin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := instance.Address, "192.168.64.5"; got != want {
+		t.Errorf("want address %s, got %s", want, got)
+	}
+	if err = driver.Destroy(ctx, []*types.Instance{instance}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := instance.ID
+	for _, want := range []string{
+		"clone ghcr.io/cirruslabs/macos-sonoma-base:latest " + name,
+		"set " + name + " --cpu 4 --memory 8192",
+		"ip --wait 120 " + name,
+		"exec -i " + name + " sudo /bin/bash -s",
+		"stop " + name,
+		"delete " + name,
+	} {
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("want tart %s, got calls:\n%s", want, data)
+		}
+	}
+}
+
+func TestSetArgs(t *testing.T) {
+	p := &config{}
+	if args := p.setArgs("vm"); args != nil {
+		t.Errorf("want no tart set without resources, got %v", args)
+	}
+	p.memoryMB = 4096
+	if got, want := strings.Join(p.setArgs("vm"), " "), "set vm --memory 4096"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,75 @@
+package tart
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*config)
+
+func SetPlatformDefaults(platform *types.Platform) (*types.Platform, error) {
+	// tart runs on apple silicon only
+	if platform.Arch == "" {
+		platform.Arch = oshelp.ArchARM64
+	}
+	if platform.Arch != oshelp.ArchARM64 {
+		return platform, fmt.Errorf("invalid arch %s, has to be '%s'", platform.Arch, oshelp.ArchARM64)
+	}
+	// verify that we are using sane values for OS
+	if platform.OS == "" {
+		platform.OS = oshelp.OSMac
+	}
+	if platform.OS != oshelp.OSMac && platform.OS != oshelp.OSLinux {
+		return platform, fmt.Errorf("tart - invalid OS %s, has to be either'%s/%s'", platform.OS, oshelp.OSMac, oshelp.OSLinux)
+	}
+
+	return platform, nil
+}
+
+// WithImage sets the VM template, a local VM name or a remote OCI image
+// such as ghcr.io/cirruslabs/macos-sonoma-xcode:latest.
+func WithImage(image string) Option {
+	return func(p *config) {
+		p.image = image
+	}
+}
+
+// WithResources overrides the cpus and memory of the image, zero values
+// keep the image settings.
+func WithResources(cpus, memoryMB int) Option {
+	return func(p *config) {
+		p.cpus = cpus
+		p.memoryMB = memoryMB
+	}
+}
+
+// WithUserData returns an option to set the cloud-init template from a file location or passed in text.
+func WithUserData(text, path string) Option {
+	if text != "" {
+		return func(p *config) {
+			p.userData = text
+		}
+	}
+	return func(p *config) {
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				logrus.WithError(err).
+					Fatalln("failed to read user_data file")
+				return
+			}
+			p.userData = string(data)
+		}
+	}
+}
+
+// WithRootDirectory sets the root directory for the virtual machine.
+func WithRootDirectory(platform *types.Platform) Option {
+	return func(p *config) {
+		p.rootDir = oshelp.JoinPaths(platform.OS, "/tmp", "tart")
+	}
+}
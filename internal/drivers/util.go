@@ -21,3 +21,11 @@ func ShouldPerformDNSLookup(ctx context.Context, os string) bool {
 	}
 	return false
 }
+
+func instanceIDs(instances []*types.Instance) []string {
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = instance.ID
+	}
+	return ids
+}
@@ -0,0 +1,320 @@
+package vsphere
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/dchest/uniuri"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	vim "github.com/vmware/govmomi/vim25/types"
+)
+
+const ipTimeout = 10 * time.Minute
+
+// config is a struct that implements drivers.Pool interface
+type config struct {
+	address  string
+	username string
+	password string
+	insecure bool
+
+	datacenter   string
+	template     string
+	snapshot     string
+	linkedClone  bool
+	folder       string
+	resourcePool string
+	datastore    string
+	cpus         int32
+	memoryMB     int64
+
+	userData string
+	rootDir  string
+}
+
+func New(opts ...Option) (drivers.Driver, error) {
+	p := new(config)
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.address == "" {
+		return nil, errors.New("vsphere: address is required")
+	}
+	if p.template == "" {
+		return nil, errors.New("vsphere: template is required")
+	}
+	return p, nil
+}
+
+func (p *config) DriverName() string {
+	return string(types.VSphere)
+}
+
+func (p *config) InstanceType() string {
+	return p.template
+}
+
+func (p *config) RootDir() string {
+	return p.rootDir
+}
+
+func (p *config) CanHibernate() bool {
+	return false
+}
+
+func (p *config) Ping(ctx context.Context) error {
+	client, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Logout(ctx)
+}
+
+// Create clones the template, powers on the clone and waits for the guest
+// tools to report its address. It will not perform build specific setup.
+func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	startTime := time.Now()
+	logr := logger.FromContext(ctx).
+		WithField("driver", types.VSphere).
+		WithField("pool", opts.PoolName).
+		WithField("template", p.template).
+		WithField("linked_clone", p.linkedClone)
+
+	client, err := p.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Logout(context.Background()) //nolint:errcheck
+
+	finder, err := p.finder(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	template, err := finder.VirtualMachine(ctx, p.template)
+	if err != nil {
+		logr.WithError(err).Errorln("vsphere: cannot find template")
+		return nil, err
+	}
+	folder, err := finder.FolderOrDefault(ctx, p.folder)
+	if err != nil {
+		return nil, err
+	}
+	// without a resource pool the clone stays in the pool of the template.
+	var pool *object.ResourcePool
+	if p.resourcePool != "" {
+		pool, err = finder.ResourcePool(ctx, p.resourcePool)
+	} else {
+		pool, err = template.ResourcePool(ctx)
+	}
+	if err != nil {
+		logr.WithError(err).Errorln("vsphere: cannot find resource pool")
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
+	logr.Infof("vsphere: cloning instance %s", name)
+
+	poolRef := pool.Reference()
+	spec := vim.VirtualMachineCloneSpec{
+		Location: vim.VirtualMachineRelocateSpec{Pool: &poolRef},
+		PowerOn:  true,
+		Config: &vim.VirtualMachineConfigSpec{
+			NumCPUs:  p.cpus,
+			MemoryMB: p.memoryMB,
+			// read by the cloud-init VMware datasource.
+			ExtraConfig: []vim.BaseOptionValue{
+				&vim.OptionValue{Key: "guestinfo.userdata", Value: base64.StdEncoding.EncodeToString([]byte(lehelper.GenerateUserdata(p.userData, opts)))},
+				&vim.OptionValue{Key: "guestinfo.userdata.encoding", Value: "base64"},
+			},
+		},
+	}
+	if p.datastore != "" {
+		datastore, dsErr := finder.Datastore(ctx, p.datastore)
+		if dsErr != nil {
+			return nil, dsErr
+		}
+		ref := datastore.Reference()
+		spec.Location.Datastore = &ref
+	}
+	if p.linkedClone {
+		snapshot, snapErr := p.templateSnapshot(ctx, template)
+		if snapErr != nil {
+			logr.WithError(snapErr).Errorln("vsphere: cannot find the template snapshot")
+			return nil, snapErr
+		}
+		// the clone disks are children of the snapshot disks, nothing is copied.
+		spec.Snapshot = snapshot
+		spec.Location.DiskMoveType = string(vim.VirtualMachineRelocateDiskMoveOptionsCreateNewChildDiskBacking)
+	}
+
+	task, err := template.Clone(ctx, folder, name, spec)
+	if err != nil {
+		logr.WithError(err).Errorln("vsphere: cannot clone template")
+		return nil, err
+	}
+	info, err := task.WaitForResult(ctx)
+	if err != nil {
+		logr.WithError(err).Errorln("vsphere: cannot clone template")
+		return nil, err
+	}
+	ref, ok := info.Result.(vim.ManagedObjectReference)
+	if !ok {
+		return nil, fmt.Errorf("vsphere: unexpected clone result %T", info.Result)
+	}
+
+	instance = &types.Instance{
+		ID:       ref.Value,
+		Name:     name,
+		Provider: types.VSphere,
+		State:    types.StateCreated,
+		Pool:     opts.PoolName,
+		Region:   p.datacenter,
+		Image:    p.template,
+		Platform: opts.Platform,
+		CAKey:    opts.CAKey,
+		CACert:   opts.CACert,
+		TLSKey:   opts.TLSKey,
+		TLSCert:  opts.TLSCert,
+		Started:  startTime.Unix(),
+		Updated:  startTime.Unix(),
+		Port:     lehelper.LiteEnginePort,
+	}
+
+	ipCtx, cancel := context.WithTimeout(ctx, ipTimeout)
+	defer cancel()
+	instance.Address, err = object.NewVirtualMachine(client.Client, ref).WaitForIP(ipCtx, true)
+	if err != nil {
+		logr.WithError(err).Errorln("vsphere: guest tools did not report an address")
+		return instance, err
+	}
+	logr.WithField("ip", instance.Address).
+		Infof("vsphere: instance %s started in %s", name, time.Since(startTime).Truncate(time.Second))
+	return instance, nil
+}
+
+// Destroy powers off and deletes the virtual machines.
+func (p *config) Destroy(ctx context.Context, instances []*types.Instance) error {
+	if len(instances) == 0 {
+		return errors.New("no instances provided")
+	}
+	client, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Logout(context.Background()) //nolint:errcheck
+
+	var errs []string
+	for _, instance := range instances {
+		logr := logger.FromContext(ctx).
+			WithField("id", instance.ID).
+			WithField("name", instance.Name).
+			WithField("driver", types.VSphere)
+
+		if err = destroy(ctx, object.NewVirtualMachine(client.Client, vmRef(instance.ID))); err != nil {
+			logr.WithError(err).Errorln("vsphere: cannot destroy instance")
+			errs = append(errs, err.Error())
+			continue
+		}
+		logr.Traceln("vsphere: instance destroyed")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("vsphere: cannot destroy instances: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (p *config) Logs(ctx context.Context, instanceID string) (string, error) {
+	return "no logs here", nil
+}
+
+func (p *config) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	return errors.New("vsphere: hibernate is not supported")
+}
+
+func (p *config) Start(ctx context.Context, instanceID, poolName string) (string, error) {
+	return "", errors.New("vsphere: start is not supported")
+}
+
+func (p *config) SetTags(ctx context.Context, instance *types.Instance, tags map[string]string) error {
+	return nil
+}
+
+func (p *config) login(ctx context.Context) (*govmomi.Client, error) {
+	u, err := url.Parse(p.address)
+	if err != nil {
+		return nil, fmt.Errorf("vsphere: invalid address: %w", err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/sdk"
+	}
+	u.User = url.UserPassword(p.username, p.password)
+	client, err := govmomi.NewClient(ctx, u, p.insecure)
+	if err != nil {
+		return nil, fmt.Errorf("vsphere: cannot login: %w", err)
+	}
+	return client, nil
+}
+
+func (p *config) finder(ctx context.Context, client *govmomi.Client) (*find.Finder, error) {
+	finder := find.NewFinder(client.Client, true)
+	dc, err := finder.DatacenterOrDefault(ctx, p.datacenter)
+	if err != nil {
+		return nil, fmt.Errorf("vsphere: cannot find datacenter: %w", err)
+	}
+	return finder.SetDatacenter(dc), nil
+}
+
+// templateSnapshot returns the configured snapshot of the template, or its
+// current snapshot.
+func (p *config) templateSnapshot(ctx context.Context, template *object.VirtualMachine) (*vim.ManagedObjectReference, error) {
+	if p.snapshot != "" {
+		return template.FindSnapshot(ctx, p.snapshot)
+	}
+	var vm mo.VirtualMachine
+	if err := template.Properties(ctx, template.Reference(), []string{"snapshot"}, &vm); err != nil {
+		return nil, err
+	}
+	if vm.Snapshot == nil || vm.Snapshot.CurrentSnapshot == nil {
+		return nil, fmt.Errorf("template %s has no snapshot, linked clones need one", p.template)
+	}
+	return vm.Snapshot.CurrentSnapshot, nil
+}
+
+// destroy powers off the virtual machine if it is running, and deletes it.
+func destroy(ctx context.Context, vm *object.VirtualMachine) error {
+	state, err := vm.PowerState(ctx)
+	if err != nil {
+		return err
+	}
+	if state == vim.VirtualMachinePowerStatePoweredOn {
+		task, powerErr := vm.PowerOff(ctx)
+		if powerErr != nil {
+			return powerErr
+		}
+		if powerErr = task.Wait(ctx); powerErr != nil {
+			return powerErr
+		}
+	}
+	task, err := vm.Destroy(ctx)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+func vmRef(id string) vim.ManagedObjectReference {
+	return vim.ManagedObjectReference{Type: "VirtualMachine", Value: id}
+}
@@ -0,0 +1,98 @@
+package vsphere
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	vim "github.com/vmware/govmomi/vim25/types"
+)
+
+func TestCreateDestroy(t *testing.T) {
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		// linked clones need a snapshot of the template.
+		template, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		task, err := template.CreateSnapshot(ctx, "base", "", false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = task.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		u := c.URL()
+		password, _ := simulator.DefaultLogin.Password()
+		driver, err := New(
+			WithServer(u.Scheme+"://"+u.Host, simulator.DefaultLogin.Username(), password, true),
+			WithTemplate("DC0_H0_VM0", "", true),
+			WithHardware(2, 2048),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the simulator has no guest tools, report an address for the clone.
+		done := make(chan struct{})
+		defer close(done)
+		go assignAddress(done, "runner-pool-", "10.0.0.9")
+
+		instance, err := driver.Create(ctx, &types.InstanceCreateOpts{RunnerName: "runner", PoolName: "pool"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := instance.Address, "10.0.0.9"; got != want {
+			t.Errorf("want address %s, got %s", want, got)
+		}
+
+		if err = driver.Destroy(ctx, []*types.Instance{instance}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = find.NewFinder(c).VirtualMachine(ctx, instance.Name); err == nil {
+			t.Errorf("want instance %s deleted", instance.Name)
+		}
+	})
+}
+
+func TestCreate_NoSnapshot(t *testing.T) {
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		u := c.URL()
+		password, _ := simulator.DefaultLogin.Password()
+		driver, err := New(
+			WithServer(u.Scheme+"://"+u.Host, simulator.DefaultLogin.Username(), password, true),
+			WithTemplate("DC0_H0_VM0", "", true),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = driver.Create(ctx, &types.InstanceCreateOpts{RunnerName: "runner", PoolName: "pool"}); err == nil {
+			t.Error("want error when the template has no snapshot")
+		}
+	})
+}
+
+// assignAddress sets the guest address of the simulated virtual machines
+// whose name has the prefix, until done is closed.
+func assignAddress(done chan struct{}, prefix, ip string) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		for _, e := range simulator.Map.All("VirtualMachine") {
+			vm := e.(*simulator.VirtualMachine)
+			if strings.HasPrefix(vm.Name, prefix) && vm.Guest.IpAddress == "" {
+				simulator.Map.Update(vm, []vim.PropertyChange{{Name: "guest.ipAddress", Val: ip}})
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package vsphere
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*config)
+
+func SetPlatformDefaults(platform *types.Platform) (*types.Platform, error) {
+	if platform.Arch == "" {
+		platform.Arch = oshelp.ArchAMD64
+	}
+	if platform.Arch != oshelp.ArchAMD64 {
+		return platform, fmt.Errorf("invalid arch %s, has to be '%s'", platform.Arch, oshelp.ArchAMD64)
+	}
+	// verify that we are using sane values for OS
+	if platform.OS == "" {
+		platform.OS = oshelp.OSLinux
+	}
+	if platform.OS != oshelp.OSLinux && platform.OS != oshelp.OSWindows {
+		return platform, fmt.Errorf("vsphere - invalid OS %s, has to be either'%s/%s'", platform.OS, oshelp.OSLinux, oshelp.OSWindows)
+	}
+	// set osname
+	if platform.OS == oshelp.OSLinux && platform.OSName == "" {
+		platform.OSName = oshelp.Ubuntu
+	}
+	return platform, nil
+}
+
+// WithServer sets the vCenter or ESXi address and credentials.
+func WithServer(address, username, password string, insecure bool) Option {
+	return func(p *config) {
+		p.address = address
+		p.username = username
+		p.password = password
+		p.insecure = insecure
+	}
+}
+
+func WithDatacenter(datacenter string) Option {
+	return func(p *config) {
+		p.datacenter = datacenter
+	}
+}
+
+// WithTemplate sets the template virtual machine which is cloned. Linked
+// clones are created from the named snapshot, or the current snapshot of
+// the template if the name is empty.
+func WithTemplate(template, snapshot string, linkedClone bool) Option {
+	return func(p *config) {
+		p.template = template
+		p.snapshot = snapshot
+		p.linkedClone = linkedClone
+	}
+}
+
+// WithLocation sets the folder, resource pool and datastore of the clones.
+// Empty values use the default folder of the datacenter, and the resource
+// pool and datastore of the template.
+func WithLocation(folder, resourcePool, datastore string) Option {
+	return func(p *config) {
+		p.folder = folder
+		p.resourcePool = resourcePool
+		p.datastore = datastore
+	}
+}
+
+// WithHardware overrides the cpus and memory of the template, zero values
+// keep the template settings.
+func WithHardware(cpus int32, memoryMB int64) Option {
+	return func(p *config) {
+		p.cpus = cpus
+		p.memoryMB = memoryMB
+	}
+}
+
+func WithUserData(text, path string) Option {
+	if text != "" {
+		return func(p *config) {
+			p.userData = text
+		}
+	}
+	return func(p *config) {
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				logrus.WithError(err).
+					Fatalln("failed to read user_data file")
+				return
+			}
+			p.userData = string(data)
+		}
+	}
+}
+
+// WithRootDirectory returns an OS specific temp directory
+func WithRootDirectory(platform *types.Platform) Option {
+	return func(p *config) {
+		const dir = "vsphere"
+		switch platform.OS {
+		case oshelp.OSWindows:
+			p.rootDir = oshelp.JoinPaths(platform.OS, oshelp.WindowsRootDir, dir)
+		default:
+			p.rootDir = oshelp.JoinPaths(platform.OS, "/tmp", dir)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build boringcrypto
+
+package fips
+
+// restrict TLS in the whole process to the FIPS approved configuration.
+import _ "crypto/tls/fipsonly"
+
+func init() {
+	boring = true
+}
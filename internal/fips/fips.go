@@ -0,0 +1,69 @@
+// Package fips restricts the runner to FIPS approved algorithms. The mode
+// is enabled with DRONE_FIPS, or by building the runner with
+// GOEXPERIMENT=boringcrypto, which links BoringCrypto and restricts TLS
+// in the whole process.
+package fips
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+var enabled atomic.Bool
+
+// boring is true if the runner is linked against BoringCrypto.
+var boring bool
+
+// Enable enables the FIPS mode. The mode cannot be disabled in runners
+// linked against BoringCrypto.
+func Enable(enable bool) {
+	enabled.Store(enable)
+}
+
+// Enabled returns true if the runner runs in FIPS mode.
+func Enabled() bool {
+	return boring || enabled.Load()
+}
+
+// Boring returns true if the runner is linked against BoringCrypto.
+func Boring() bool {
+	return boring
+}
+
+// CipherSuites are the FIPS approved TLS 1.2 cipher suites. TLS 1.3 cipher
+// suites cannot be configured, the crypto module restricts them.
+var CipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// Curves are the FIPS approved key exchange curves.
+var Curves = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+
+// RestrictTLS restricts the config to FIPS approved versions, cipher
+// suites and curves if the runner runs in FIPS mode. A minimum version
+// above TLS 1.2 is kept.
+func RestrictTLS(cfg *tls.Config) {
+	if cfg == nil || !Enabled() {
+		return
+	}
+	if cfg.MinVersion < tls.VersionTLS12 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	cfg.CipherSuites = CipherSuites
+	cfg.CurvePreferences = Curves
+}
+
+// AWS resolves the FIPS endpoints of the AWS services if the runner runs
+// in FIPS mode. It returns the config.
+func AWS(cfg *aws.Config) *aws.Config {
+	if Enabled() {
+		cfg.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+	return cfg
+}
@@ -0,0 +1,51 @@
+package fips
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+func TestRestrictTLS(t *testing.T) {
+	defer Enable(false)
+	tests := []struct {
+		name    string
+		enabled bool
+		min     uint16
+		wantMin uint16
+	}{
+		{name: "disabled", min: tls.VersionTLS10, wantMin: tls.VersionTLS10},
+		{name: "raises the minimum version", enabled: true, min: tls.VersionTLS10, wantMin: tls.VersionTLS12},
+		{name: "keeps a higher minimum version", enabled: true, min: tls.VersionTLS13, wantMin: tls.VersionTLS13},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if Boring() && !test.enabled {
+				t.Skip("the mode cannot be disabled with BoringCrypto")
+			}
+			Enable(test.enabled)
+			cfg := &tls.Config{MinVersion: test.min} //nolint:gosec
+			RestrictTLS(cfg)
+			if cfg.MinVersion != test.wantMin {
+				t.Errorf("want minimum version %x, got %x", test.wantMin, cfg.MinVersion)
+			}
+			if test.enabled && !reflect.DeepEqual(cfg.CipherSuites, CipherSuites) {
+				t.Errorf("want cipher suites %v, got %v", CipherSuites, cfg.CipherSuites)
+			}
+			if !test.enabled && cfg.CipherSuites != nil {
+				t.Errorf("want default cipher suites, got %v", cfg.CipherSuites)
+			}
+		})
+	}
+}
+
+func TestAWS(t *testing.T) {
+	defer Enable(false)
+	Enable(true)
+	if got := AWS(aws.NewConfig()).UseFIPSEndpoint; got != endpoints.FIPSEndpointStateEnabled {
+		t.Errorf("want the FIPS endpoints, got %v", got)
+	}
+}
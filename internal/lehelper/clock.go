@@ -0,0 +1,129 @@
+package lehelper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const clockTimeout = time.Minute
+
+// the clock scripts print the unix time of the instance as the last line.
+const (
+	clockScript        = `date +%s`
+	clockScriptWindows = `[DateTimeOffset]::UtcNow.ToUnixTimeSeconds()`
+)
+
+// the sync scripts force a time sync with the configured time service, and
+// then print the unix time of the instance.
+const (
+	syncScript = `
+if command -v chronyc >/dev/null 2>&1; then
+	chronyc -a makestep >/dev/null 2>&1 || chronyc -a 'burst 4/4' >/dev/null 2>&1
+elif command -v ntpdate >/dev/null 2>&1; then
+	ntpdate -u pool.ntp.org >/dev/null 2>&1
+elif command -v timedatectl >/dev/null 2>&1; then
+	timedatectl set-ntp false >/dev/null 2>&1; timedatectl set-ntp true >/dev/null 2>&1
+	sleep 5
+fi
+date +%s
+`
+	syncScriptMac = `
+sudo -n sntp -sS time.apple.com >/dev/null 2>&1
+date +%s
+`
+	syncScriptWindows = `
+Start-Service w32time -ErrorAction SilentlyContinue
+w32tm /resync /force | Out-Null
+[DateTimeOffset]::UtcNow.ToUnixTimeSeconds()
+`
+)
+
+// CorrectClockSkew compares the clock of the instance with the clock of
+// the runner and forces a time sync if the skew exceeds maxSkew. It returns
+// the skew before and after the sync, both are the same if no sync was
+// required. A positive skew means the instance clock is ahead.
+func CorrectClockSkew(ctx context.Context, client lehttp.Client, platformOS string, maxSkew time.Duration) (skew, corrected time.Duration, err error) {
+	script := clockScript
+	if platformOS == oshelp.OSWindows {
+		script = clockScriptWindows
+	}
+	skew, err = clockSkew(ctx, client, platformOS, script)
+	if err != nil || absDuration(skew) <= maxSkew {
+		return skew, skew, err
+	}
+
+	switch platformOS {
+	case oshelp.OSWindows:
+		script = syncScriptWindows
+	case oshelp.OSMac:
+		script = syncScriptMac
+	default:
+		script = syncScript
+	}
+	corrected, err = clockSkew(ctx, client, platformOS, script)
+	if err != nil {
+		return skew, skew, fmt.Errorf("cannot sync the instance clock: %w", err)
+	}
+	return skew, corrected, nil
+}
+
+// clockSkew runs the script printing the instance time and returns the
+// skew to the runner time while the script ran.
+func clockSkew(ctx context.Context, client lehttp.Client, platformOS, script string) (time.Duration, error) {
+	var buf bytes.Buffer
+	before := time.Now()
+	resp, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    script,
+		Timeout: clockTimeout,
+	}, &buf)
+	after := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if resp.ExitCode != 0 {
+		return 0, fmt.Errorf("clock script exited with code %d: %s", resp.ExitCode, resp.Error)
+	}
+	instant, err := lastUnixTime(buf.String())
+	if err != nil {
+		return 0, err
+	}
+	return skewBetween(instant, before, after), nil
+}
+
+// skewBetween returns how far the instance time, with second precision,
+// is outside of the runner time interval in which it was read.
+func skewBetween(instant, before, after time.Time) time.Duration {
+	switch {
+	case instant.Before(before.Truncate(time.Second)):
+		return instant.Sub(before.Truncate(time.Second))
+	case instant.After(after):
+		return instant.Sub(after)
+	default:
+		return 0
+	}
+}
+
+// lastUnixTime parses the unix time on the last non-empty line of out.
+func lastUnixTime(out string) (time.Time, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	sec, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse the instance time %q: %w", last, err)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,101 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSkewBetween(t *testing.T) {
+	before := time.Unix(1000, 400*int64(time.Millisecond))
+	after := time.Unix(1002, 0)
+	tests := []struct {
+		name    string
+		instant time.Time
+		want    time.Duration
+	}{
+		{name: "same second as before", instant: time.Unix(1000, 0), want: 0},
+		{name: "in the interval", instant: time.Unix(1001, 0), want: 0},
+		{name: "behind", instant: time.Unix(940, 0), want: -60 * time.Second},
+		{name: "ahead", instant: time.Unix(1032, 0), want: 30 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := skewBetween(test.instant, before, after); got != test.want {
+				t.Errorf("Want skew %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestLastUnixTime(t *testing.T) {
+	got, err := lastUnixTime("Synchronizing\r\n1700000000\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1700000000, 0); !got.Equal(want) {
+		t.Errorf("Want time %s, got %s", want, got)
+	}
+	if _, err = lastUnixTime("command not found"); err == nil {
+		t.Errorf("Want error for output without a time")
+	}
+}
+
+// clockClient prints an instance clock an hour ahead, and fails the sync.
+type clockClient struct {
+	lehttp.Client
+	mu      sync.Mutex
+	scripts chan string
+	last    string
+}
+
+func (c *clockClient) RetryStartStep(_ context.Context, req *api.StartStepRequest) (*api.StartStepResponse, error) {
+	c.mu.Lock()
+	c.last = req.Files[0].Data
+	c.mu.Unlock()
+	c.scripts <- req.Files[0].Data
+	return &api.StartStepResponse{}, nil
+}
+
+func (c *clockClient) RetryPollStep(context.Context, *api.PollStepRequest, time.Duration) (*api.PollStepResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != clockScript {
+		return &api.PollStepResponse{Exited: true, ExitCode: 1, Error: "no time service"}, nil
+	}
+	return &api.PollStepResponse{Exited: true}, nil
+}
+
+func (c *clockClient) GetStepLogOutput(_ context.Context, _ *api.StreamOutputRequest, w io.Writer) error {
+	if script := <-c.scripts; script == clockScript {
+		_, err := fmt.Fprintln(w, time.Now().Add(time.Hour).Unix())
+		return err
+	}
+	return nil
+}
+
+func TestConfigureHost_ClockSyncFailed(t *testing.T) {
+	client := &clockClient{scripts: make(chan string, 2)}
+	log, hook := logrustest.NewNullLogger()
+	err := ConfigureHost(context.Background(), client, "linux", &HostConfig{
+		Settings:     &types.PoolSettings{},
+		MaxClockSkew: 5 * time.Second,
+	}, logger.Logrus(logrus.NewEntry(log)))
+	if err != nil {
+		t.Errorf("Want the setup to continue when the clock cannot be synced, got %v", err)
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.WarnLevel || entry.Message != "failed to check the instance clock" {
+		t.Errorf("Want a warning logged, got %+v", entry)
+	}
+}
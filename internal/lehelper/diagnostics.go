@@ -0,0 +1,88 @@
+package lehelper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const diagnosticsTimeout = 2 * time.Minute
+
+// diagnosticsScripts print the diagnostics of an instance, each file of
+// the bundle starts with a "==> name <==" line.
+var diagnosticsScripts = map[string]string{
+	oshelp.OSLinux: `
+section() { echo "==> $1 <=="; }
+section cloud-init-output.log; tail -n 500 /var/log/cloud-init-output.log 2>&1
+section cloud-init-status.txt; cloud-init status --long 2>&1
+section docker-info.txt; docker info 2>&1
+section dmesg.txt; dmesg 2>&1 | tail -n 200
+section df.txt; df -h 2>&1
+section free.txt; free -m 2>&1
+exit 0
+`,
+	oshelp.OSMac: `
+section() { echo "==> $1 <=="; }
+section docker-info.txt; docker info 2>&1
+section system.log; tail -n 200 /var/log/system.log 2>&1
+section df.txt; df -h 2>&1
+section vm_stat.txt; vm_stat 2>&1
+exit 0
+`,
+	oshelp.OSWindows: `
+function Section($name) { Write-Output "==> $name <==" }
+Section user-data.log
+foreach ($log in 'C:\ProgramData\Amazon\EC2Launch\log\agent.log', 'C:\ProgramData\Amazon\EC2-Windows\Launch\Log\UserdataExecution.log') {
+	if (Test-Path $log) { Get-Content -Tail 500 $log }
+}
+Section docker-info.txt; docker info 2>&1 | Out-String -Width 200
+Section system-events.txt; Get-WinEvent -LogName System -MaxEvents 200 -ErrorAction SilentlyContinue | Format-Table -AutoSize -Wrap | Out-String -Width 200
+Section df.txt; Get-PSDrive -PSProvider FileSystem | Format-Table -AutoSize | Out-String -Width 200
+Section free.txt; Get-CimInstance Win32_OperatingSystem | Format-List FreePhysicalMemory, TotalVisibleMemorySize | Out-String -Width 200
+exit 0
+`,
+}
+
+// CollectDiagnostics collects the diagnostics of the instance: the
+// cloud-init logs, docker info, the tail of the kernel log, the disks and
+// the memory. It returns the files of the bundle by name.
+func CollectDiagnostics(ctx context.Context, client lehttp.Client, platformOS string) (map[string][]byte, error) {
+	script, ok := diagnosticsScripts[platformOS]
+	if !ok {
+		script = diagnosticsScripts[oshelp.OSLinux]
+	}
+	var buf bytes.Buffer
+	if _, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    script,
+		Timeout: diagnosticsTimeout,
+	}, &buf); err != nil {
+		return nil, err
+	}
+	return splitDiagnostics(buf.Bytes()), nil
+}
+
+// splitDiagnostics splits the output of the diagnostics script into the
+// files of the bundle. Output before the first file is dropped.
+func splitDiagnostics(out []byte) map[string][]byte {
+	files := map[string][]byte{}
+	var name string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1<<20) //nolint:gomnd
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "==> ") && strings.HasSuffix(line, " <==") {
+			name = strings.TrimSuffix(strings.TrimPrefix(line, "==> "), " <==")
+			files[name] = []byte{}
+			continue
+		}
+		if name != "" {
+			files[name] = append(append(files[name], line...), '\n')
+		}
+	}
+	return files
+}
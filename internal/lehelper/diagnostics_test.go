@@ -0,0 +1,23 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestSplitDiagnostics(t *testing.T) {
+	out := "script banner\n==> df.txt <==\n/dev/root 20G\r\n/dev/sdb 100G\n==> free.txt <==\n==> docker-info.txt <==\nServer Version: 24.0.5\n"
+	files := splitDiagnostics([]byte(out))
+	want := map[string]string{
+		"df.txt":          "/dev/root 20G\n/dev/sdb 100G\n",
+		"free.txt":        "",
+		"docker-info.txt": "Server Version: 24.0.5\n",
+	}
+	if len(files) != len(want) {
+		t.Errorf("want files %v, got %v", want, files)
+	}
+	for name, data := range want {
+		if got, ok := files[name]; !ok || string(got) != data {
+			t.Errorf("want %s %q, got %q", name, data, got)
+		}
+	}
+}
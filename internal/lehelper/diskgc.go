@@ -0,0 +1,90 @@
+package lehelper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const diskGCTimeout = 15 * time.Minute
+
+// diskGCScripts free the disk of an instance when its usage, in percent,
+// reaches the %[1]d verb: the docker objects unused for the %[2]s verb,
+// the container logs, the journal and the old temporary files. They print
+// the usage before and after on a "disk usage" line.
+var diskGCScripts = map[string]string{
+	oshelp.OSLinux: `
+usage() {
+	root=$(docker info --format '{{.DockerRootDir}}' 2>/dev/null || echo /)
+	df -P / "$root" | awk 'NR > 1 { sub("%%", "", $5); if ($5 > max) max = $5 } END { print max + 0 }'
+}
+before=$(usage)
+if [ "$before" -lt %[1]d ]; then
+	echo "disk usage $before $before"
+	exit 0
+fi
+docker system prune --force --all --filter until=%[2]s >/dev/null 2>&1 || true
+find /var/lib/docker/containers -name '*-json.log' -size +100M -exec truncate -s 0 {} + 2>/dev/null || true
+journalctl --vacuum-size=200M >/dev/null 2>&1 || true
+find /tmp /var/tmp -mindepth 1 -mtime +1 -delete 2>/dev/null || true
+echo "disk usage $before $(usage)"
+`,
+	oshelp.OSWindows: `
+$ErrorActionPreference = 'Continue'
+function Usage { $d = Get-PSDrive C; [int](100 * $d.Used / ($d.Used + $d.Free)) }
+$before = Usage
+if ($before -lt %[1]d) {
+	Write-Output "disk usage $before $before"
+	exit 0
+}
+docker system prune --force --all --filter until=%[2]s | Out-Null
+Get-ChildItem $env:TEMP, C:\Windows\Temp -Force -ErrorAction SilentlyContinue |
+	Where-Object { $_.LastWriteTime -lt (Get-Date).AddDays(-1) } |
+	Remove-Item -Recurse -Force -ErrorAction SilentlyContinue
+Write-Output "disk usage $before $(Usage)"
+exit 0
+`,
+}
+
+// DiskGC frees the disk of the instance if its usage reaches the
+// threshold, in percent. Docker objects unused for pruneAge are removed.
+// It returns the disk usage before and after.
+func DiskGC(ctx context.Context, client lehttp.Client, platformOS string, threshold int, pruneAge time.Duration) (before, after int, err error) {
+	script, ok := diskGCScripts[platformOS]
+	if !ok {
+		return 0, 0, fmt.Errorf("disk gc is not supported on %s", platformOS)
+	}
+	var out strings.Builder
+	resp, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    fmt.Sprintf(script, threshold, pruneAge),
+		Timeout: diskGCTimeout,
+	}, &out)
+	if err != nil {
+		return 0, 0, err
+	}
+	if resp.ExitCode != 0 {
+		return 0, 0, fmt.Errorf("disk gc exited with code %d: %s", resp.ExitCode, strings.TrimSpace(out.String()))
+	}
+	return parseDiskUsage(out.String())
+}
+
+// parseDiskUsage returns the usage of the "disk usage" line of the output
+// of the disk gc scripts.
+func parseDiskUsage(out string) (before, after int, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "disk usage ") {
+			continue
+		}
+		if _, err = fmt.Sscanf(line, "disk usage %d %d", &before, &after); err == nil {
+			return before, after, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("disk gc did not report the disk usage: %s", strings.TrimSpace(out))
+}
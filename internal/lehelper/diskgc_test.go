@@ -0,0 +1,29 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestParseDiskUsage(t *testing.T) {
+	tests := []struct {
+		out           string
+		before, after int
+		valid         bool
+	}{
+		{out: "disk usage 42 42\n", before: 42, after: 42, valid: true},
+		{out: "Total reclaimed space: 3GB\r\ndisk usage 91 57\r\n", before: 91, after: 57, valid: true},
+		{out: "df: /var/lib/docker: No such file or directory\n"},
+		{out: "disk usage 91\n"},
+		{out: ""},
+	}
+	for _, test := range tests {
+		before, after, err := parseDiskUsage(test.out)
+		if (err == nil) != test.valid {
+			t.Errorf("want the output %q valid %t, got %v", test.out, test.valid, err)
+			continue
+		}
+		if before != test.before || after != test.after {
+			t.Errorf("want the usage %d %d of %q, got %d %d", test.before, test.after, test.out, before, after)
+		}
+	}
+}
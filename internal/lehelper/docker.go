@@ -0,0 +1,74 @@
+package lehelper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const dockerTimeout = 5 * time.Minute
+
+// dockerDaemonScript writes the daemon configuration in the %s verb and
+// restarts docker, unless the configuration is unchanged.
+const dockerDaemonScript = `
+set -e
+config=/etc/docker/daemon.json
+next=$(mktemp)
+cat > "$next" <<'JSON'
+%s
+JSON
+if cmp -s "$next" "$config"; then
+	rm -f "$next"
+	exit 0
+fi
+mkdir -p /etc/docker
+mv "$next" "$config"
+chmod 0644 "$config"
+systemctl restart docker 2>/dev/null || service docker restart
+`
+
+const dockerDaemonScriptWindows = `
+$ErrorActionPreference = 'Stop'
+$config = 'C:\ProgramData\docker\config\daemon.json'
+$next = @'
+%s
+'@
+if ((Test-Path $config) -and ([IO.File]::ReadAllText($config) -eq $next)) { exit 0 }
+New-Item -ItemType Directory -Force -Path (Split-Path $config) | Out-Null
+[IO.File]::WriteAllText($config, $next)
+Restart-Service docker
+`
+
+// DaemonJSON returns the docker daemon configuration of a pool as json,
+// with sorted keys so unchanged configurations compare equal.
+func DaemonJSON(platformOS string, daemon map[string]interface{}) (string, error) {
+	if len(daemon) == 0 {
+		return "", nil
+	}
+	if platformOS == oshelp.OSMac {
+		return "", fmt.Errorf("docker daemon configuration is not supported on %s", oshelp.OSMac)
+	}
+	out, err := json.MarshalIndent(daemon, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("invalid docker daemon configuration: %w", err)
+	}
+	return string(out), nil
+}
+
+// ConfigureDocker writes the docker daemon configuration of the instance
+// and restarts docker to apply it.
+func ConfigureDocker(ctx context.Context, client lehttp.Client, platformOS string, daemon map[string]interface{}) error {
+	daemonJSON, err := DaemonJSON(platformOS, daemon)
+	if err != nil || daemonJSON == "" {
+		return err
+	}
+	script := fmt.Sprintf(dockerDaemonScript, daemonJSON)
+	if platformOS == oshelp.OSWindows {
+		script = fmt.Sprintf(dockerDaemonScriptWindows, daemonJSON)
+	}
+	return runSetupScript(ctx, client, platformOS, "docker daemon script", script, dockerTimeout)
+}
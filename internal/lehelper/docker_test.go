@@ -0,0 +1,36 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestDaemonJSON(t *testing.T) {
+	daemon := map[string]interface{}{
+		"mtu":                 1400,
+		"insecure-registries": []interface{}{"registry.internal:5000"},
+		"log-opts":            map[string]interface{}{"max-size": "10m", "max-file": "3"},
+	}
+	got, err := DaemonJSON("linux", daemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "insecure-registries": [
+    "registry.internal:5000"
+  ],
+  "log-opts": {
+    "max-file": "3",
+    "max-size": "10m"
+  },
+  "mtu": 1400
+}`
+	if got != want {
+		t.Errorf("Want daemon json %s, got %s", want, got)
+	}
+	if got, err = DaemonJSON("linux", nil); err != nil || got != "" {
+		t.Errorf("Want no daemon json without configuration, got %q, %v", got, err)
+	}
+	if _, err = DaemonJSON("darwin", daemon); err == nil {
+		t.Errorf("Want error for mac instances")
+	}
+}
@@ -0,0 +1,168 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/audit"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+	lespec "github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/logger"
+)
+
+// Script is an arbitrary script run on an instance through lite-engine.
+type Script struct {
+	Data       string
+	Envs       map[string]string
+	WorkingDir string
+	Timeout    time.Duration
+}
+
+// RunScript uploads the script to the instance, runs it and writes the
+// combined stdout/stderr of the script to output as it is produced. It
+// returns once the script has exited and its output has been written.
+func RunScript(ctx context.Context, client lehttp.Client, platformOS string, script *Script, output io.Writer) (*api.PollStepResponse, error) {
+	resp, err := runScript(ctx, client, platformOS, script, output)
+	// the digest identifies the script without recording the secrets it may hold.
+	event := &audit.Event{
+		Action:  audit.ActionScriptRun,
+		Error:   audit.ErrorOf(err),
+		Details: map[string]string{"script_sha256": audit.Digest(script.Data)},
+	}
+	if resp != nil {
+		event.Details["exit_code"] = strconv.Itoa(resp.ExitCode)
+	}
+	audit.Record(ctx, event)
+	return resp, err
+}
+
+func runScript(ctx context.Context, client lehttp.Client, platformOS string, script *Script, output io.Writer) (*api.PollStepResponse, error) {
+	logr := logger.FromContext(ctx)
+
+	id := oshelp.Random()
+	scriptDir := "/tmp"
+	if platformOS == oshelp.OSWindows {
+		scriptDir = `C:\Windows\Temp`
+	}
+	scriptPath := oshelp.JoinPaths(platformOS, scriptDir, oshelp.GetExt(platformOS, id))
+
+	noDocker := false
+	req := &api.StartStepRequest{
+		ID:                id,
+		Name:              "exec",
+		Kind:              api.Run,
+		Envs:              script.Envs,
+		WorkingDir:        script.WorkingDir,
+		LogKey:            id,
+		LogDrone:          true, // required to stream the output back
+		MountDockerSocket: &noDocker,
+		Timeout:           int(script.Timeout.Seconds()),
+		Files: []*lespec.File{
+			{
+				Path: scriptPath,
+				Mode: 0700, //nolint:gomnd
+				Data: script.Data,
+			},
+		},
+		Run: api.RunConfig{
+			Entrypoint: oshelp.GetEntrypoint(platformOS),
+			Command:    []string{scriptPath},
+		},
+	}
+
+	// output is usually the http response writer, it is not written once
+	// the script returned. The stream is drained for streamDrainTimeout at
+	// most, lite-engine may not close it.
+	guarded := &guardedWriter{w: output}
+	streamCtx, cancel := context.WithCancel(ctx)
+	streamed := make(chan struct{})
+	defer func() {
+		cancel()
+		waitStream(ctx, streamed, streamDrainTimeout)
+		guarded.close()
+	}()
+	go func() {
+		defer close(streamed)
+		if streamErr := client.GetStepLogOutput(streamCtx, &api.StreamOutputRequest{ID: id}, guarded); streamErr != nil {
+			logr.WithError(streamErr).Warnln("failed to stream script output")
+		}
+	}()
+
+	if _, err := client.RetryStartStep(ctx, req); err != nil {
+		return nil, fmt.Errorf("failed to call LE.RetryStartStep: %w", err)
+	}
+
+	pollResponse, err := client.RetryPollStep(ctx, &api.PollStepRequest{ID: id}, script.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call LE.RetryPollStep: %w", err)
+	}
+	waitStream(ctx, streamed, streamDrainTimeout)
+	return pollResponse, nil
+}
+
+// streamDrainTimeout bounds the wait for the output of an exited script.
+var streamDrainTimeout = 5 * time.Second
+
+// waitStream waits for the output stream to end, for ctx to be done or for
+// the timeout.
+func waitStream(ctx context.Context, streamed <-chan struct{}, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-streamed:
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// guardedWriter drops the writes once it is closed, so that a stream which
+// outlives the script does not write to a released writer.
+type guardedWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+func (g *guardedWriter) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return g.w.Write(p)
+}
+
+func (g *guardedWriter) close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// runSetupScript runs a script configuring the instance. The error of a
+// script exiting with a non zero code has its output, what names the
+// script in the error.
+func runSetupScript(ctx context.Context, client lehttp.Client, platformOS, what, data string, timeout time.Duration) error {
+	var out strings.Builder
+	resp, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    data,
+		Timeout: timeout,
+	}, &out)
+	if err != nil {
+		return err
+	}
+	if resp.ExitCode != 0 {
+		msg := strings.TrimSpace(out.String())
+		if msg == "" {
+			msg = resp.Error
+		}
+		return fmt.Errorf("%s exited with code %d: %s", what, resp.ExitCode, msg)
+	}
+	return nil
+}
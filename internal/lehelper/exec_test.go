@@ -0,0 +1,114 @@
+package lehelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+// scriptClient runs the scripts with the exit code. Its output stream is
+// never closed by lite-engine, and ignores the cancellation: it writes
+// once more when late is closed.
+type scriptClient struct {
+	lehttp.Client
+	exitCode int
+	late     chan struct{}
+	lateErr  chan error
+}
+
+func (c *scriptClient) RetryStartStep(context.Context, *api.StartStepRequest) (*api.StartStepResponse, error) {
+	return &api.StartStepResponse{}, nil
+}
+
+func (c *scriptClient) RetryPollStep(context.Context, *api.PollStepRequest, time.Duration) (*api.PollStepResponse, error) {
+	return &api.PollStepResponse{Exited: true, ExitCode: c.exitCode}, nil
+}
+
+func (c *scriptClient) GetStepLogOutput(_ context.Context, _ *api.StreamOutputRequest, w io.Writer) error {
+	if _, err := w.Write([]byte("output\n")); err != nil {
+		return err
+	}
+	<-c.late
+	_, err := w.Write([]byte("late\n"))
+	c.lateErr <- err
+	return err
+}
+
+func TestRunScript_StreamNotClosed(t *testing.T) {
+	defer func(prev time.Duration) { streamDrainTimeout = prev }(streamDrainTimeout)
+	streamDrainTimeout = 10 * time.Millisecond
+
+	client := &scriptClient{exitCode: 3, late: make(chan struct{}), lateErr: make(chan error, 1)}
+	var out bytes.Buffer
+	done := make(chan struct{})
+	var resp *api.PollStepResponse
+	var err error
+	go func() {
+		resp, err = runScript(context.Background(), client, "linux", &Script{Data: "exit 3", Timeout: time.Minute}, &out)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Want the script to return without the end of its output stream")
+	}
+	if err != nil || resp.ExitCode != 3 {
+		t.Errorf("Want exit code 3, got %v %v", resp, err)
+	}
+
+	close(client.late)
+	if lateErr := <-client.lateErr; !errors.Is(lateErr, io.ErrClosedPipe) {
+		t.Errorf("Want the output closed once the script returned, got %v", lateErr)
+	}
+	if got := out.String(); got != "output\n" {
+		t.Errorf("Want %q, got %q", "output\n", got)
+	}
+}
+
+func TestGuardedWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &guardedWriter{w: &buf}
+	if _, err := w.Write([]byte("before")); err != nil {
+		t.Fatal(err)
+	}
+	w.close()
+	if _, err := w.Write([]byte("after")); err == nil {
+		t.Errorf("Want an error writing to the closed writer")
+	}
+	if got := buf.String(); got != "before" {
+		t.Errorf("Want %q, got %q", "before", got)
+	}
+}
+
+func TestWaitStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     time.Duration
+		timeout time.Duration
+	}{
+		{name: "context", ctx: 10 * time.Millisecond, timeout: time.Hour},
+		{name: "timeout", ctx: time.Hour, timeout: 10 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), test.ctx)
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				waitStream(ctx, make(chan struct{}), test.timeout)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Errorf("Want the wait bounded by the %s", test.name)
+			}
+		})
+	}
+}
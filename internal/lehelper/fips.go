@@ -0,0 +1,49 @@
+package lehelper
+
+import (
+	"context"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const restrictSSHTimeout = time.Minute
+
+// restrictSSHScript restricts the ssh server and client of the instance to
+// FIPS approved algorithms. The settings are written to drop-in files that
+// are included first, the first value of a setting wins. The server keeps
+// its configuration if the restricted one is invalid.
+const restrictSSHScript = `
+set -e
+settings='Ciphers aes256-gcm@openssh.com,aes128-gcm@openssh.com,aes256-ctr,aes192-ctr,aes128-ctr
+MACs hmac-sha2-512-etm@openssh.com,hmac-sha2-256-etm@openssh.com,hmac-sha2-512,hmac-sha2-256
+KexAlgorithms ecdh-sha2-nistp521,ecdh-sha2-nistp384,ecdh-sha2-nistp256,diffie-hellman-group16-sha512,diffie-hellman-group14-sha256
+HostKeyAlgorithms ecdsa-sha2-nistp521,ecdsa-sha2-nistp384,ecdsa-sha2-nistp256,rsa-sha2-512,rsa-sha2-256'
+include() {
+	conf=$1; dir=$2
+	[ -f "$conf" ] || return 0
+	mkdir -p "$dir"
+	grep -q "^Include $dir/\*.conf" "$conf" || sed -i "1i Include $dir/*.conf" "$conf"
+	printf '%s\n' "$settings" > "$dir/drone-fips.conf"
+}
+include /etc/ssh/ssh_config /etc/ssh/ssh_config.d
+command -v sshd >/dev/null 2>&1 || exit 0
+include /etc/ssh/sshd_config /etc/ssh/sshd_config.d
+if ! sshd -t; then
+	rm -f /etc/ssh/sshd_config.d/drone-fips.conf
+	echo "the restricted sshd configuration is invalid"
+	exit 1
+fi
+systemctl reload ssh 2>/dev/null || systemctl reload sshd 2>/dev/null || true
+`
+
+// RestrictSSH restricts ssh on the instance to FIPS approved algorithms.
+// Only linux instances are configured, windows and mac instances do not
+// run an ssh server by default.
+func RestrictSSH(ctx context.Context, client lehttp.Client, platformOS string) error {
+	if platformOS != oshelp.OSLinux {
+		return nil
+	}
+	return runSetupScript(ctx, client, platformOS, "restricting ssh", restrictSSHScript, restrictSSHTimeout)
+}
@@ -0,0 +1,237 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const firewallTimeout = 2 * time.Minute
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+// firewallFuncs are the functions of the firewall script. $cmd is the
+// iptables command of the address family and $family the getent database
+// resolving its addresses.
+const firewallFuncs = `
+set -e
+command -v iptables >/dev/null 2>&1 || { echo "iptables is not installed"; exit 1; }
+chain() {
+	$cmd -N "$1" 2>/dev/null || $cmd -F "$1"
+}
+hook() {
+	$cmd -n -L "$1" >/dev/null 2>&1 || return 0
+	$cmd -C "$1" -j "$2" 2>/dev/null || $cmd -I "$1" -j "$2"
+}
+allow() {
+	if [ -n "$4" ]; then
+		$cmd -A "$1" "$2" "$3" -p tcp --dport "$4" -j RETURN
+	else
+		$cmd -A "$1" "$2" "$3" -j RETURN
+	fi
+}
+allow_host() {
+	addrs=$(getent "$family" "$3" | awk '{ print $1 }' | grep -v '^::ffff:' | sort -u || true)
+	if [ -z "$addrs" ] && [ "$family" = ahostsv4 ]; then
+		echo "cannot resolve $3"
+		exit 1
+	fi
+	for addr in $addrs; do
+		allow "$1" "$2" "$addr" "$4"
+	done
+}
+nameservers() {
+	cat /etc/resolv.conf /run/systemd/resolve/resolv.conf 2>/dev/null | awk '$1 == "nameserver" { print $2 }' | sort -u
+}
+`
+
+// firewallRule is an entry of the firewall of a pool: a host name, an
+// address or a subnet, and a tcp port, any port if 0.
+type firewallRule struct {
+	host   string
+	family int // 4 or 6, 0 for host names
+	port   int
+}
+
+// parseFirewallRule parses an entry of the firewall, e.g. github.com:443,
+// 10.0.0.0/16 or [fd00::/8]:443.
+func parseFirewallRule(s string) (*firewallRule, error) {
+	host, port := s, ""
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid firewall entry %q", s)
+		}
+		rest := s[end+1:]
+		if rest != "" && !strings.HasPrefix(rest, ":") {
+			return nil, fmt.Errorf("invalid firewall entry %q", s)
+		}
+		host, port = s[1:end], strings.TrimPrefix(rest, ":")
+	case strings.Count(s, ":") == 1:
+		host, port, _ = strings.Cut(s, ":")
+	}
+	rule := &firewallRule{host: host}
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port of the firewall entry %q", s)
+		}
+		rule.port = n
+	}
+	addr := host
+	if ip, ipNet, err := net.ParseCIDR(host); err == nil {
+		addr, rule.host = ip.String(), ipNet.String()
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		rule.family = 6
+		if ip.To4() != nil {
+			rule.family = 4
+		}
+		return rule, nil
+	}
+	if strings.Contains(host, "/") || !hostnamePattern.MatchString(host) {
+		return nil, fmt.Errorf("invalid firewall entry %q, e.g. github.com:443 or 10.0.0.0/16", s)
+	}
+	return rule, nil
+}
+
+// ValidateFirewall returns an error if the firewall of a pool is invalid.
+func ValidateFirewall(platformOS string, firewall *types.Firewall) error {
+	if firewall == nil || (len(firewall.Egress) == 0 && len(firewall.Ingress) == 0) {
+		return nil
+	}
+	if platformOS != oshelp.OSLinux {
+		return fmt.Errorf("the firewall is only supported on %s", oshelp.OSLinux)
+	}
+	for _, entry := range append(append([]string{}, firewall.Egress...), firewall.Ingress...) {
+		if _, err := parseFirewallRule(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FirewallScript returns the script applying the firewall, empty if the
+// firewall is disabled. The traffic of the loopback, of the docker
+// networks and of the established connections, DNS to the nameservers and
+// lite-engine are always allowed.
+func FirewallScript(firewall *types.Firewall) (string, error) {
+	if firewall == nil || (len(firewall.Egress) == 0 && len(firewall.Ingress) == 0) {
+		return "", nil
+	}
+	egress, err := parseFirewallRules(firewall.Egress)
+	if err != nil {
+		return "", err
+	}
+	ingress, err := parseFirewallRules(firewall.Ingress)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(firewallFuncs)
+	b.WriteString("\ncmd=iptables; family=ahostsv4\n")
+	writeFirewallRules(&b, 4, egress, ingress) //nolint:gomnd
+	b.WriteString("if command -v ip6tables >/dev/null 2>&1; then\ncmd=ip6tables; family=ahostsv6\n")
+	writeFirewallRules(&b, 6, egress, ingress) //nolint:gomnd
+	b.WriteString("fi\n")
+	return b.String(), nil
+}
+
+func parseFirewallRules(entries []string) ([]*firewallRule, error) {
+	rules := make([]*firewallRule, 0, len(entries))
+	for _, entry := range entries {
+		rule, err := parseFirewallRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// writeFirewallRules writes the chains of the address family. A direction
+// without entries is not firewalled.
+func writeFirewallRules(b *strings.Builder, family int, egress, ingress []*firewallRule) {
+	icmp, dhcpClient, dhcpServer := "icmp", 68, 67
+	if family == 6 { //nolint:gomnd
+		icmp, dhcpClient, dhcpServer = "ipv6-icmp", 546, 547
+	}
+	write := func(chain, flag string, rules []*firewallRule) {
+		for _, rule := range rules {
+			port := ""
+			if rule.port != 0 {
+				port = strconv.Itoa(rule.port)
+			}
+			switch rule.family {
+			case 0:
+				fmt.Fprintf(b, "allow_host %s %s %s %q\n", chain, flag, quoteShell(rule.host), port)
+			case family:
+				fmt.Fprintf(b, "allow %s %s %s %q\n", chain, flag, rule.host, port)
+			}
+		}
+	}
+	if len(egress) != 0 {
+		b.WriteString(`chain DRONE-EGRESS
+$cmd -A DRONE-EGRESS -o lo -j RETURN
+$cmd -A DRONE-EGRESS -o docker0 -j RETURN
+$cmd -A DRONE-EGRESS -o br-+ -j RETURN
+$cmd -A DRONE-EGRESS -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN
+`)
+		fmt.Fprintf(b, "$cmd -A DRONE-EGRESS -p %s -j RETURN\n", icmp)
+		fmt.Fprintf(b, "$cmd -A DRONE-EGRESS -p udp --dport %d -j RETURN\n", dhcpServer)
+		b.WriteString(`for ns in $(nameservers); do
+	case "$ns" in *:*) [ "$cmd" = ip6tables ] || continue ;; *) [ "$cmd" = iptables ] || continue ;; esac
+	$cmd -A DRONE-EGRESS -d "$ns" -p udp --dport 53 -j RETURN
+	$cmd -A DRONE-EGRESS -d "$ns" -p tcp --dport 53 -j RETURN
+done
+`)
+		write("DRONE-EGRESS", "-d", egress)
+		b.WriteString(`$cmd -A DRONE-EGRESS -j REJECT
+hook OUTPUT DRONE-EGRESS
+if $cmd -n -L DOCKER-USER >/dev/null 2>&1; then
+	hook DOCKER-USER DRONE-EGRESS
+else
+	hook FORWARD DRONE-EGRESS
+fi
+`)
+	}
+	if len(ingress) != 0 {
+		b.WriteString(`chain DRONE-INGRESS
+$cmd -A DRONE-INGRESS -i lo -j RETURN
+$cmd -A DRONE-INGRESS -i docker0 -j RETURN
+$cmd -A DRONE-INGRESS -i br-+ -j RETURN
+$cmd -A DRONE-INGRESS -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN
+`)
+		fmt.Fprintf(b, "$cmd -A DRONE-INGRESS -p %s -j RETURN\n", icmp)
+		fmt.Fprintf(b, "$cmd -A DRONE-INGRESS -p udp --dport %d -j RETURN\n", dhcpClient)
+		fmt.Fprintf(b, "$cmd -A DRONE-INGRESS -p tcp --dport %d -j RETURN\n", LiteEnginePort)
+		write("DRONE-INGRESS", "-s", ingress)
+		b.WriteString(`$cmd -A DRONE-INGRESS -j DROP
+hook INPUT DRONE-INGRESS
+`)
+	}
+}
+
+// ConfigureFirewall restricts the traffic of the instance and of its
+// containers to the destinations and sources of the firewall, so that
+// builds cannot reach internal services. Host names are resolved once.
+func ConfigureFirewall(ctx context.Context, client lehttp.Client, platformOS string, firewall *types.Firewall) error {
+	if err := ValidateFirewall(platformOS, firewall); err != nil {
+		return err
+	}
+	script, err := FirewallScript(firewall)
+	if err != nil || script == "" {
+		return err
+	}
+	return runSetupScript(ctx, client, platformOS, "firewall script", script, firewallTimeout)
+}
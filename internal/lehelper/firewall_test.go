@@ -0,0 +1,77 @@
+package lehelper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestParseFirewallRule(t *testing.T) {
+	tests := []struct {
+		entry  string
+		want   firewallRule
+		family int
+		valid  bool
+	}{
+		{entry: "github.com", want: firewallRule{host: "github.com"}, valid: true},
+		{entry: "registry-1.docker.io:443", want: firewallRule{host: "registry-1.docker.io", port: 443}, valid: true},
+		{entry: "10.0.0.0/16", want: firewallRule{host: "10.0.0.0/16", family: 4}, valid: true},
+		{entry: "10.0.1.5/16:5432", want: firewallRule{host: "10.0.0.0/16", family: 4, port: 5432}, valid: true},
+		{entry: "169.254.169.254", want: firewallRule{host: "169.254.169.254", family: 4}, valid: true},
+		{entry: "fd00::/8", want: firewallRule{host: "fd00::/8", family: 6}, valid: true},
+		{entry: "[fd00:ec2::254]:80", want: firewallRule{host: "fd00:ec2::254", family: 6, port: 80}, valid: true},
+		{entry: "github.com:0"},
+		{entry: "github.com:https"},
+		{entry: "github.com:443:22"},
+		{entry: "[fd00::1"},
+		{entry: "[fd00::1]443"},
+		{entry: "10.0.0.0/33"},
+		{entry: "github.com; reboot"},
+		{entry: "-j ACCEPT"},
+		{entry: ""},
+	}
+	for _, test := range tests {
+		got, err := parseFirewallRule(test.entry)
+		if (err == nil) != test.valid {
+			t.Errorf("want the entry %q valid %t, got %v", test.entry, test.valid, err)
+			continue
+		}
+		if test.valid && *got != test.want {
+			t.Errorf("want the rule %+v of %q, got %+v", test.want, test.entry, *got)
+		}
+	}
+}
+
+func TestFirewallScript(t *testing.T) {
+	if got, err := FirewallScript(nil); err != nil || got != "" {
+		t.Errorf("want no script without firewall, got %q, %v", got, err)
+	}
+	got, err := FirewallScript(&types.Firewall{
+		Egress: []string{"github.com:443", "10.0.0.0/16", "fd00::/8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`allow_host DRONE-EGRESS -d 'github.com' "443"`,
+		`allow DRONE-EGRESS -d 10.0.0.0/16 ""`,
+		`allow DRONE-EGRESS -d fd00::/8 ""`,
+		"hook DOCKER-USER DRONE-EGRESS",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want the script to contain %q, got %s", want, got)
+		}
+	}
+	if strings.Contains(got, "DRONE-INGRESS") {
+		t.Errorf("want the ingress not firewalled without entries")
+	}
+	v4, v6, _ := strings.Cut(got, "cmd=ip6tables")
+	if strings.Contains(v4, "fd00::/8") || strings.Contains(v6, "10.0.0.0/16") {
+		t.Errorf("want the addresses in the chains of their family, got %s", got)
+	}
+
+	if err = ValidateFirewall("windows", &types.Firewall{Ingress: []string{"10.0.0.0/8"}}); err == nil {
+		t.Errorf("want error for windows")
+	}
+}
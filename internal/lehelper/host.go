@@ -0,0 +1,114 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+// HostConfig is the configuration applied on an instance once lite-engine
+// is set up, by the drone and the harness setups alike.
+type HostConfig struct {
+	// Settings are the settings of the pool of the instance.
+	Settings *types.PoolSettings
+	// Signer signs the scripts of the host steps, the verifier is not
+	// installed if nil.
+	Signer *Signer
+	// BlockMetadata blocks the instance metadata service, see
+	// MustBlockMetadata.
+	BlockMetadata bool
+	// FIPS restricts ssh to FIPS approved algorithms.
+	FIPS bool
+	// MaxClockSkew forces a time sync of the instances whose clock is
+	// skewed more, disabled if 0.
+	MaxClockSkew time.Duration
+}
+
+// PrepareSetup adds the environment and the network settings of the pool
+// to the setup request of lite-engine.
+func PrepareSetup(req *api.SetupRequest, platformOS string, settings *types.PoolSettings) {
+	req.Envs = WithLocaleEnvs(req.Envs, platformOS, settings.Timezone, settings.Locale)
+	req.Envs = WithToolcacheEnvs(req.Envs, platformOS, settings.Toolcache)
+	req.Envs = WithMirrorEnvs(req.Envs, settings.Mirror)
+	req.Network = WithNetworkMTU(req.Network, settings.NetworkMTU)
+}
+
+// ConfigureHost configures the instance once lite-engine is set up. The
+// steps the builds can do without, the mirrors, the long paths and the
+// clock, are logged on failure, the others return an error.
+func ConfigureHost(ctx context.Context, client lehttp.Client, platformOS string, cfg *HostConfig, logr logger.Logger) error {
+	settings := cfg.Settings
+	if settings.NestedVirtualization {
+		if err := CheckKVM(ctx, client, platformOS); err != nil {
+			return fmt.Errorf("kvm is not available: %w", err)
+		}
+	}
+
+	if settings.SwapSize != "" {
+		if err := EnableSwap(ctx, client, platformOS, settings.SwapSize); err != nil {
+			return fmt.Errorf("failed to enable the swap: %w", err)
+		}
+	}
+
+	if err := ConfigureSysctl(ctx, client, platformOS, settings.Sysctl); err != nil {
+		return fmt.Errorf("failed to set the kernel parameters: %w", err)
+	}
+
+	if err := ConfigureLocale(ctx, client, platformOS, settings.Timezone, settings.Locale); err != nil {
+		return fmt.Errorf("failed to set the timezone and locale: %w", err)
+	}
+
+	if err := ConfigureSecurityModules(ctx, client, platformOS, settings.SELinux, settings.AppArmorProfile); err != nil {
+		return fmt.Errorf("failed to configure selinux and apparmor: %w", err)
+	}
+
+	// the mirror is merged into the daemon configuration, it is applied first.
+	if err := ConfigureDocker(ctx, client, platformOS, settings.DockerDaemon); err != nil {
+		return fmt.Errorf("failed to configure the docker daemon: %w", err)
+	}
+
+	if err := StartMirror(ctx, client, platformOS, settings.Mirror); err != nil {
+		logr.WithError(err).Warnln("failed to start the mirrors, builds use the upstream registries")
+	}
+
+	if err := EnableLongPaths(ctx, client, platformOS); err != nil {
+		logr.WithError(err).Warnln("failed to enable long paths, deep workspace paths may fail")
+	}
+
+	if err := InstallVerifier(ctx, client, platformOS, cfg.Signer); err != nil {
+		return fmt.Errorf("failed to install the script verifier: %w", err)
+	}
+
+	// docker is configured first, the daemon sets up its chains when it starts.
+	if cfg.BlockMetadata {
+		if err := BlockMetadata(ctx, client, platformOS); err != nil {
+			return fmt.Errorf("failed to block the instance metadata: %w", err)
+		}
+	}
+
+	// docker is configured first, the egress of the containers is filtered in its DOCKER-USER chain.
+	if err := ConfigureFirewall(ctx, client, platformOS, settings.Firewall); err != nil {
+		return fmt.Errorf("failed to configure the firewall: %w", err)
+	}
+
+	if cfg.FIPS {
+		if err := RestrictSSH(ctx, client, platformOS); err != nil {
+			return fmt.Errorf("failed to restrict ssh to FIPS approved algorithms: %w", err)
+		}
+	}
+
+	if cfg.MaxClockSkew > 0 {
+		if skew, corrected, err := CorrectClockSkew(ctx, client, platformOS, cfg.MaxClockSkew); err != nil {
+			logr.WithError(err).Warnln("failed to check the instance clock")
+		} else if skew != corrected {
+			logr.WithField("skew", skew).WithField("corrected", corrected).
+				Infoln("instance clock was skewed, forced a time sync")
+		}
+	}
+	return nil
+}
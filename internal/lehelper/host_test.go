@@ -0,0 +1,27 @@
+package lehelper
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/harness/lite-engine/api"
+)
+
+func TestPrepareSetup(t *testing.T) {
+	envs := map[string]string{"CI": "true"}
+	req := &api.SetupRequest{Envs: envs}
+	PrepareSetup(req, "linux", &types.PoolSettings{
+		Locale:     "de_DE.UTF-8",
+		Mirror:     &types.Mirror{NPM: "http://npm.internal"},
+		NetworkMTU: 1400,
+	})
+	if req.Envs["CI"] != "true" || req.Envs["LANG"] != "de_DE.UTF-8" || req.Envs["npm_config_registry"] == "" {
+		t.Errorf("Want the envs of the pool added, got %v", req.Envs)
+	}
+	if req.Network.Options[NetworkMTUOption] != "1400" {
+		t.Errorf("Want the mtu of the pool, got %v", req.Network.Options)
+	}
+	if len(envs) != 1 {
+		t.Errorf("Want the envs of the request unmodified, got %v", envs)
+	}
+}
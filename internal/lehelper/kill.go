@@ -0,0 +1,53 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const killTimeout = time.Minute
+
+// killScript terminates the process tree of the step, whose pid is in the
+// file in the %[1]s verb. lite-engine does not start steps in their own
+// process group, so the tree is walked instead of killing the group.
+const killScript = `
+pid=$(cat %[1]s 2>/dev/null) || exit 0
+killtree() {
+	for child in $(pgrep -P "$1"); do
+		killtree "$child" "$2"
+	done
+	kill "-$2" "$1" 2>/dev/null
+}
+killtree "$pid" TERM
+sleep 5
+killtree "$pid" KILL
+rm -f %[1]s
+exit 0
+`
+
+func stepPidFile(id string) string {
+	return "/tmp/drone-step-" + id + ".pid"
+}
+
+// TrackCommand wraps the command of a host step run with sh -c so that
+// the shell records its pid before running the step script, and returns
+// true. KillStep uses the pid to terminate the step. Other commands are
+// returned unchanged with false.
+func TrackCommand(platformOS, id string, entrypoint, command []string) ([]string, bool) {
+	if platformOS == oshelp.OSWindows || len(command) != 1 ||
+		len(entrypoint) != 2 || entrypoint[0] != "sh" || entrypoint[1] != "-c" { //nolint:gomnd
+		return command, false
+	}
+	return []string{fmt.Sprintf("echo $$ > %s; %s", stepPidFile(id), command[0])}, true
+}
+
+// KillStep terminates the processes of a step whose command was wrapped
+// with TrackCommand, first with SIGTERM and, after a grace period, with
+// SIGKILL.
+func KillStep(ctx context.Context, client lehttp.Client, platformOS, id string) error {
+	return runSetupScript(ctx, client, platformOS, "kill script", fmt.Sprintf(killScript, stepPidFile(id)), killTimeout)
+}
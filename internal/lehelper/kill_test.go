@@ -0,0 +1,19 @@
+package lehelper
+
+import "testing"
+
+func TestTrackCommand(t *testing.T) {
+	command, ok := TrackCommand("linux", "abc", []string{"sh", "-c"}, []string{"/tmp/drone/opt/abc"})
+	if !ok {
+		t.Fatalf("Want host step command tracked")
+	}
+	if got, want := command[0], "echo $$ > /tmp/drone-step-abc.pid; /tmp/drone/opt/abc"; got != want {
+		t.Errorf("Want command %q, got %q", want, got)
+	}
+	if _, ok = TrackCommand("windows", "abc", []string{"powershell"}, []string{`C:\opt\abc.ps1`}); ok {
+		t.Errorf("Want windows commands not tracked")
+	}
+	if _, ok = TrackCommand("linux", "abc", []string{"/bin/entrypoint"}, nil); ok {
+		t.Errorf("Want custom entrypoints not tracked")
+	}
+}
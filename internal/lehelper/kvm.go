@@ -0,0 +1,63 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const kvmTimeout = time.Minute
+
+// kvmScript loads the kvm module, if needed, and prints the reason kvm
+// is unavailable.
+const kvmScript = `
+if [ ! -e /dev/kvm ]; then
+	modprobe kvm_intel 2>/dev/null || modprobe kvm_amd 2>/dev/null || true
+fi
+if [ ! -c /dev/kvm ]; then
+	if ! grep -Eqw 'vmx|svm' /proc/cpuinfo; then
+		echo "the instance cpu does not expose virtualization extensions"
+	else
+		echo "/dev/kvm does not exist"
+	fi
+	exit 1
+fi
+if ! [ -r /dev/kvm ] || ! [ -w /dev/kvm ]; then
+	echo "/dev/kvm is not readable and writable"
+	exit 1
+fi
+`
+
+// ValidateNestedVirtualization returns an error if pools of the platform
+// cannot require nested virtualization, which is supported on linux only.
+func ValidateNestedVirtualization(platformOS string) error {
+	if platformOS != "" && platformOS != oshelp.OSLinux {
+		return fmt.Errorf("nested virtualization is supported on %s only", oshelp.OSLinux)
+	}
+	return nil
+}
+
+// CheckKVM returns an error with guidance if kvm is not usable on the
+// instance.
+func CheckKVM(ctx context.Context, client lehttp.Client, platformOS string) error {
+	if platformOS != oshelp.OSLinux {
+		return nil
+	}
+	var out strings.Builder
+	resp, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    kvmScript,
+		Timeout: kvmTimeout,
+	}, &out)
+	if err != nil {
+		return err
+	}
+	if resp.ExitCode != 0 {
+		return fmt.Errorf("the pool requires nested virtualization, but %s: use a metal instance type "+
+			"or a machine type with nested virtualization enabled", strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -2,9 +2,11 @@ package lehelper
 
 import (
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/drone-runners/drone-runner-aws/internal/cloudinit"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/harness/lite-engine/api"
@@ -16,7 +18,43 @@ const (
 )
 
 func GenerateUserdata(userdata string, opts *types.InstanceCreateOpts) string {
-	var params = cloudinit.Params{
+	params := userdataParams(opts)
+
+	if userdata == "" {
+		if opts.Platform.OS == oshelp.OSWindows {
+			userdata = cloudinit.Windows(params)
+		} else if opts.Platform.OS == oshelp.OSMac {
+			userdata = cloudinit.Mac(params)
+		} else {
+			userdata = cloudinit.Linux(params)
+		}
+	} else {
+		userdata, _ = cloudinit.Custom(userdata, params)
+	}
+	return userdata
+}
+
+// GenerateWindowsUserdata returns the userdata of an EC2 windows instance.
+// Custom userdata with the <powershell> tags replaces the runner setup,
+// without them it is a fragment run after the setup. The script is wrapped
+// in the tags, with the <persist> tag if persist.
+func GenerateWindowsUserdata(userdata string, persist bool, opts *types.InstanceCreateOpts) (string, error) {
+	params := userdataParams(opts)
+	if userdata == "" {
+		return cloudinit.WindowsFragments(params, persist), nil
+	}
+	custom, err := cloudinit.Custom(userdata, params)
+	if err != nil {
+		return "", err
+	}
+	if cloudinit.HasPowerShellTags(custom) {
+		return cloudinit.PowerShell(custom, persist), nil
+	}
+	return cloudinit.WindowsFragments(params, persist, custom), nil
+}
+
+func userdataParams(opts *types.InstanceCreateOpts) *cloudinit.Params {
+	return &cloudinit.Params{
 		Platform:             opts.Platform,
 		CACert:               string(opts.CACert),
 		TLSCert:              string(opts.TLSCert),
@@ -28,19 +66,6 @@ func GenerateUserdata(userdata string, opts *types.InstanceCreateOpts) string {
 		Tmate:                opts.Tmate,
 		IsHosted:             opts.IsHosted,
 	}
-
-	if userdata == "" {
-		if opts.Platform.OS == oshelp.OSWindows {
-			userdata = cloudinit.Windows(&params)
-		} else if opts.Platform.OS == oshelp.OSMac {
-			userdata = cloudinit.Mac(&params)
-		} else {
-			userdata = cloudinit.Linux(&params)
-		}
-	} else {
-		userdata, _ = cloudinit.Custom(userdata, &params)
-	}
-	return userdata
 }
 
 func GetClient(instance *types.Instance, serverName string, liteEnginePort int64, mock bool, mockTimeoutSecs int) (lehttp.Client, error) {
@@ -48,7 +73,14 @@ func GetClient(instance *types.Instance, serverName string, liteEnginePort int64
 	if mock {
 		return lehttp.NewNoopClient(&api.PollStepResponse{}, nil, time.Duration(mockTimeoutSecs)*time.Second, 0, 0), nil
 	}
-	return lehttp.NewHTTPClient(leURL,
+	client, err := lehttp.NewHTTPClient(leURL,
 		serverName, string(instance.CACert),
 		string(instance.TLSCert), string(instance.TLSKey))
+	if err != nil {
+		return nil, err
+	}
+	if transport, ok := client.Client.Transport.(*http.Transport); ok {
+		fips.RestrictTLS(transport.TLSClientConfig)
+	}
+	return client, nil
 }
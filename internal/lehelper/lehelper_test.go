@@ -0,0 +1,32 @@
+package lehelper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestGenerateWindowsUserdata(t *testing.T) {
+	opts := &types.InstanceCreateOpts{Platform: types.Platform{OS: "windows", Arch: "amd64"}}
+
+	fragment, err := GenerateWindowsUserdata("echo {{ .Platform.Arch }}", true, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fragment, "lite-engine") || !strings.HasSuffix(fragment, "echo amd64\r\n</powershell>\r\n<persist>true</persist>") {
+		t.Errorf("want the fragment run after the setup, got %q", fragment)
+	}
+
+	script, err := GenerateWindowsUserdata("<powershell>\necho {{ .Platform.OS }}\n</powershell>", false, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script != "<powershell>\r\necho windows\r\n</powershell>" {
+		t.Errorf("want the script replacing the setup, got %q", script)
+	}
+
+	if _, err = GenerateWindowsUserdata("{{ .Missing", false, opts); err == nil {
+		t.Error("want an error for an invalid template")
+	}
+}
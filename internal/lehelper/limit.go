@@ -0,0 +1,36 @@
+package lehelper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+)
+
+// limitScript runs the command in the %[2]s verb in a transient systemd
+// scope with the limits in the %[1]s verb. systemd-run execs the command
+// in the scope, so the process tree of the step is kept. Instances without
+// systemd run the command without limits.
+const limitScript = `if command -v systemd-run >/dev/null 2>&1; then systemd-run --scope --quiet --collect%[1]s -- %[2]s; else %[2]s; fi`
+
+// LimitCommand wraps the command of a host step run with sh -c so that it
+// runs in a cgroup with the cpu and memory limits of the step. The cpu
+// quota is in microseconds per cpu period, as for containers. Commands
+// without limits or not run with sh -c on linux are returned unchanged.
+func LimitCommand(platformOS string, entrypoint, command []string, cpuQuota, cpuPeriod, memLimit int64) []string {
+	if platformOS != oshelp.OSLinux || len(command) != 1 ||
+		len(entrypoint) != 2 || entrypoint[0] != "sh" || entrypoint[1] != "-c" { //nolint:gomnd
+		return command
+	}
+	var props strings.Builder
+	if cpuQuota > 0 && cpuPeriod > 0 {
+		fmt.Fprintf(&props, " -p CPUQuota=%d%%", cpuQuota*100/cpuPeriod) //nolint:gomnd
+	}
+	if memLimit > 0 {
+		fmt.Fprintf(&props, " -p MemoryMax=%d -p MemorySwapMax=0", memLimit)
+	}
+	if props.Len() == 0 {
+		return command
+	}
+	return []string{fmt.Sprintf(limitScript, props.String(), command[0])}
+}
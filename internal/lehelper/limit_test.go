@@ -0,0 +1,19 @@
+package lehelper
+
+import "testing"
+
+func TestLimitCommand(t *testing.T) {
+	entrypoint := []string{"sh", "-c"}
+	command := LimitCommand("linux", entrypoint, []string{"/tmp/drone/opt/abc"}, 150000, 100000, 1<<30)
+	want := "if command -v systemd-run >/dev/null 2>&1; then systemd-run --scope --quiet --collect" +
+		" -p CPUQuota=150% -p MemoryMax=1073741824 -p MemorySwapMax=0 -- /tmp/drone/opt/abc; else /tmp/drone/opt/abc; fi"
+	if got := command[0]; got != want {
+		t.Errorf("Want command %q, got %q", want, got)
+	}
+	if got := LimitCommand("linux", entrypoint, []string{"/tmp/drone/opt/abc"}, 0, 0, 0); got[0] != "/tmp/drone/opt/abc" {
+		t.Errorf("Want commands without limits unchanged, got %q", got)
+	}
+	if got := LimitCommand("windows", []string{"powershell"}, []string{`C:\opt\abc.ps1`}, 0, 0, 1<<30); got[0] != `C:\opt\abc.ps1` {
+		t.Errorf("Want windows commands unchanged, got %q", got)
+	}
+}
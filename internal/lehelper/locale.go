@@ -0,0 +1,145 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const localeTimeout = 2 * time.Minute
+
+var (
+	// timezones are IANA names on linux and mac, e.g. Europe/Berlin, and
+	// windows ids on windows, e.g. W. Europe Standard Time.
+	timezonePattern = regexp.MustCompile(`^[A-Za-z0-9_+\-/. ]+$`)
+	// locales are e.g. en_US.UTF-8 on linux and mac, and en-US on windows.
+	localePattern = regexp.MustCompile(`^[A-Za-z0-9_.@\-]+$`)
+)
+
+// linuxTimezoneScript sets the timezone in the %[1]s verb.
+const linuxTimezoneScript = `
+if command -v timedatectl >/dev/null 2>&1 && timedatectl set-timezone %[1]s 2>/dev/null; then
+	:
+else
+	test -f /usr/share/zoneinfo/%[1]s || { echo "unknown timezone %[1]s"; exit 1; }
+	ln -sf /usr/share/zoneinfo/%[1]s /etc/localtime
+	echo %[1]s > /etc/timezone
+fi
+`
+
+// linuxLocaleScript generates, if needed, and sets the locale in the %[1]s verb.
+const linuxLocaleScript = `
+if command -v locale-gen >/dev/null 2>&1; then
+	locale-gen %[1]s >/dev/null 2>&1 || true
+fi
+if command -v localectl >/dev/null 2>&1 && localectl set-locale LANG=%[1]s 2>/dev/null; then
+	:
+elif command -v update-locale >/dev/null 2>&1; then
+	update-locale LANG=%[1]s
+else
+	echo LANG=%[1]s > /etc/locale.conf
+fi
+`
+
+const macTimezoneScript = `
+sudo -n systemsetup -settimezone %[1]s >/dev/null
+`
+
+const windowsTimezoneScript = `
+Set-TimeZone -Id %[1]s
+`
+
+const windowsLocaleScript = `
+Set-WinSystemLocale -SystemLocale %[1]s
+Set-Culture -CultureInfo %[1]s
+`
+
+// ValidateLocale returns an error if the timezone or locale of a pool is
+// malformed. Empty values are valid, the instance defaults are kept.
+func ValidateLocale(timezone, locale string) error {
+	if timezone != "" && !timezonePattern.MatchString(timezone) {
+		return fmt.Errorf("invalid timezone %q", timezone)
+	}
+	if locale != "" && !localePattern.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q", locale)
+	}
+	return nil
+}
+
+// WithLocaleEnvs returns the environment variables with the variables
+// selecting the timezone and locale added, for the processes which do not
+// read the system settings. Variables already in envs take precedence.
+func WithLocaleEnvs(envs map[string]string, platformOS, timezone, locale string) map[string]string {
+	if platformOS == oshelp.OSWindows || (timezone == "" && locale == "") {
+		// windows reads both from the system settings.
+		return envs
+	}
+	out := map[string]string{}
+	if timezone != "" {
+		out["TZ"] = timezone
+	}
+	if locale != "" {
+		out["LANG"] = locale
+		out["LC_ALL"] = locale
+	}
+	for k, v := range envs {
+		out[k] = v
+	}
+	return out
+}
+
+// ConfigureLocale sets the system timezone and locale of the instance.
+// Empty values keep the instance defaults.
+func ConfigureLocale(ctx context.Context, client lehttp.Client, platformOS, timezone, locale string) error {
+	script := localeScript(platformOS, timezone, locale)
+	if script == "" {
+		return nil
+	}
+	return runSetupScript(ctx, client, platformOS, "locale script", script, localeTimeout)
+}
+
+// localeScript returns the script setting the timezone and locale, or an
+// empty string if there is nothing to set.
+func localeScript(platformOS, timezone, locale string) string {
+	var b strings.Builder
+	switch platformOS {
+	case oshelp.OSWindows:
+		b.WriteString("$ErrorActionPreference = 'Stop'\n")
+		if timezone != "" {
+			fmt.Fprintf(&b, windowsTimezoneScript, quotePowershell(timezone))
+		}
+		if locale != "" {
+			fmt.Fprintf(&b, windowsLocaleScript, quotePowershell(locale))
+		}
+	case oshelp.OSMac:
+		// the locale of mac instances is selected with WithLocaleEnvs only.
+		if timezone != "" {
+			fmt.Fprintf(&b, macTimezoneScript, quoteShell(timezone))
+		}
+	default:
+		b.WriteString("set -e\n")
+		if timezone != "" {
+			fmt.Fprintf(&b, linuxTimezoneScript, quoteShell(timezone))
+		}
+		if locale != "" {
+			fmt.Fprintf(&b, linuxLocaleScript, quoteShell(locale))
+		}
+	}
+	if timezone == "" && (locale == "" || platformOS == oshelp.OSMac) {
+		return ""
+	}
+	return b.String()
+}
+
+func quoteShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func quotePowershell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
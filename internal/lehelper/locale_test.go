@@ -0,0 +1,54 @@
+package lehelper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLocale(t *testing.T) {
+	tests := []struct {
+		timezone, locale string
+		valid            bool
+	}{
+		{timezone: "", locale: "", valid: true},
+		{timezone: "Europe/Berlin", locale: "de_DE.UTF-8", valid: true},
+		{timezone: "America/Argentina/Buenos_Aires", locale: "sr_RS@latin", valid: true},
+		{timezone: "W. Europe Standard Time", locale: "de-DE", valid: true},
+		{timezone: "Etc/GMT+5", valid: true},
+		{timezone: "UTC; reboot", valid: false},
+		{locale: "en_US.UTF-8 $(id)", valid: false},
+	}
+	for _, test := range tests {
+		if err := ValidateLocale(test.timezone, test.locale); (err == nil) != test.valid {
+			t.Errorf("Want valid %v for %q and %q, got %v", test.valid, test.timezone, test.locale, err)
+		}
+	}
+}
+
+func TestWithLocaleEnvs(t *testing.T) {
+	got := WithLocaleEnvs(map[string]string{"TZ": "UTC", "CI": "true"}, "linux", "Europe/Berlin", "de_DE.UTF-8")
+	want := map[string]string{"TZ": "UTC", "CI": "true", "LANG": "de_DE.UTF-8", "LC_ALL": "de_DE.UTF-8"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want envs %v, got %v", want, got)
+	}
+	if got = WithLocaleEnvs(nil, "windows", "W. Europe Standard Time", "de-DE"); got != nil {
+		t.Errorf("Want no envs on windows, got %v", got)
+	}
+}
+
+func TestLocaleScript(t *testing.T) {
+	if got := localeScript("linux", "", ""); got != "" {
+		t.Errorf("Want no script without timezone and locale, got %q", got)
+	}
+	if got := localeScript("darwin", "", "en_US.UTF-8"); got != "" {
+		t.Errorf("Want no script for a mac locale, got %q", got)
+	}
+	if got := localeScript("linux", "Europe/Berlin", ""); !strings.Contains(got, "timedatectl set-timezone 'Europe/Berlin'") {
+		t.Errorf("Want the timezone set with timedatectl, got %q", got)
+	}
+	got := localeScript("windows", "W. Europe Standard Time", "de-DE")
+	if !strings.Contains(got, "Set-TimeZone -Id 'W. Europe Standard Time'") || !strings.Contains(got, "Set-Culture -CultureInfo 'de-DE'") {
+		t.Errorf("Want the timezone and culture set, got %q", got)
+	}
+}
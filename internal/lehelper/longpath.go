@@ -0,0 +1,37 @@
+package lehelper
+
+import (
+	"context"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const longPathsTimeout = time.Minute
+
+// longPathsScript enables win32 long paths, both the file system value and
+// the value of the "Enable Win32 long paths" group policy, and makes git
+// use them. New processes pick up the change, no reboot is required.
+const longPathsScript = `
+$ErrorActionPreference = 'Stop'
+Set-ItemProperty -Path 'HKLM:\SYSTEM\CurrentControlSet\Control\FileSystem' -Name LongPathsEnabled -Value 1 -Type DWord
+if (-not (Test-Path 'HKLM:\SYSTEM\CurrentControlSet\Policies')) {
+	New-Item -Path 'HKLM:\SYSTEM\CurrentControlSet\Policies' -Force | Out-Null
+}
+Set-ItemProperty -Path 'HKLM:\SYSTEM\CurrentControlSet\Policies' -Name LongPathsEnabled -Value 1 -Type DWord
+if (Get-Command git -ErrorAction SilentlyContinue) {
+	git config --system core.longpaths true
+}
+exit 0
+`
+
+// EnableLongPaths enables paths longer than MAX_PATH on windows instances,
+// deep trees like node_modules fail to build without it. Other platforms
+// are not affected.
+func EnableLongPaths(ctx context.Context, client lehttp.Client, platformOS string) error {
+	if platformOS != oshelp.OSWindows {
+		return nil
+	}
+	return runSetupScript(ctx, client, platformOS, "enabling long paths", longPathsScript, longPathsTimeout)
+}
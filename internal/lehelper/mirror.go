@@ -0,0 +1,188 @@
+package lehelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const (
+	mirrorTimeout = 5 * time.Minute
+
+	// MirrorLocal runs the registry mirror on the instance.
+	MirrorLocal = "local"
+
+	defaultRegistryImage = "registry:2"
+	localRegistryAddress = "http://127.0.0.1:5000"
+	// the settings are on the lite-engine shared volume, which is mounted
+	// at the same path in host and container steps.
+	mavenSettingsPath = "/tmp/engine/maven-mirror-settings.xml"
+)
+
+// localRegistryScript starts a pull-through cache of docker hub in the
+// image in the %[1]s verb, unless it is running already.
+const localRegistryScript = `
+if ! docker inspect drone-registry-mirror >/dev/null 2>&1; then
+	docker run -d --restart always --name drone-registry-mirror -p 127.0.0.1:5000:5000 \
+		-e REGISTRY_PROXY_REMOTEURL=https://registry-1.docker.io \
+		-v drone-registry-mirror:/var/lib/registry %[1]s >/dev/null
+fi
+`
+
+// registryMirrorScript adds the mirror in the %[1]s verb to the docker
+// daemon configuration and restarts the daemon, existing configurations
+// are merged with python3.
+const registryMirrorScript = `
+config=/etc/docker/daemon.json
+if ! grep -qF %[1]s "$config" 2>/dev/null; then
+	if [ -s "$config" ]; then
+		python3 - "$config" %[1]s <<'PY'
+import json, sys
+path, mirror = sys.argv[1], sys.argv[2]
+with open(path) as f:
+    data = json.load(f)
+data["registry-mirrors"] = [mirror] + [m for m in data.get("registry-mirrors", []) if m != mirror]
+with open(path, "w") as f:
+    json.dump(data, f, indent=2)
+PY
+	else
+		mkdir -p /etc/docker
+		printf '{\n  "registry-mirrors": ["%%s"]\n}\n' %[1]s > "$config"
+	fi
+	systemctl restart docker 2>/dev/null || service docker restart
+fi
+`
+
+// mavenSettingsScript writes the maven settings in the %[2]s verb to the
+// path in the %[1]s verb.
+const mavenSettingsScript = `
+mkdir -p "$(dirname %[1]s)"
+cat > %[1]s <<'XML'
+%[2]s
+XML
+`
+
+// ValidateMirror returns an error if the mirror configuration of a pool
+// is invalid. Mirrors are supported on linux pools only.
+func ValidateMirror(platformOS string, mirror *types.Mirror) error {
+	if mirror == nil {
+		return nil
+	}
+	if platformOS != "" && platformOS != oshelp.OSLinux {
+		return fmt.Errorf("mirrors are supported on %s only", oshelp.OSLinux)
+	}
+	urls := map[string]string{"npm": mirror.NPM, "pypi": mirror.PyPI, "maven": mirror.Maven}
+	if mirror.Registry != MirrorLocal {
+		urls["registry"] = mirror.Registry
+	}
+	for name, raw := range urls {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s mirror %q, has to be an http or https url", name, raw)
+		}
+	}
+	if strings.ContainsAny(mirror.RegistryImage, " \t\n'\"") {
+		return fmt.Errorf("invalid registry mirror image %q", mirror.RegistryImage)
+	}
+	return nil
+}
+
+// WithMirrorEnvs returns the environment variables with the variables
+// selecting the package proxies added. Variables already in envs take
+// precedence.
+func WithMirrorEnvs(envs map[string]string, mirror *types.Mirror) map[string]string {
+	if mirror == nil || (mirror.NPM == "" && mirror.PyPI == "" && mirror.Maven == "") {
+		return envs
+	}
+	out := map[string]string{}
+	if mirror.NPM != "" {
+		out["npm_config_registry"] = mirror.NPM
+	}
+	if mirror.PyPI != "" {
+		out["PIP_INDEX_URL"] = mirror.PyPI
+		if u, err := url.Parse(mirror.PyPI); err == nil && u.Scheme == "http" {
+			out["PIP_TRUSTED_HOST"] = u.Hostname()
+		}
+	}
+	if mirror.Maven != "" {
+		out["MAVEN_ARGS"] = "--global-settings " + mavenSettingsPath
+	}
+	for k, v := range envs {
+		out[k] = v
+	}
+	return out
+}
+
+// StartMirror starts the local registry mirror, if configured, and points
+// the docker daemon and maven of the instance at the mirrors.
+func StartMirror(ctx context.Context, client lehttp.Client, platformOS string, mirror *types.Mirror) error {
+	if mirror == nil || platformOS != oshelp.OSLinux {
+		return nil
+	}
+	script, err := mirrorScript(mirror)
+	if err != nil || script == "" {
+		return err
+	}
+	return runSetupScript(ctx, client, platformOS, "mirror script", script, mirrorTimeout)
+}
+
+func mirrorScript(mirror *types.Mirror) (string, error) {
+	if mirror.Registry == "" && mirror.Maven == "" {
+		return "", nil
+	}
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	if mirror.Maven != "" {
+		settings, err := mavenSettings(mirror.Maven)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, mavenSettingsScript, quoteShell(mavenSettingsPath), settings)
+	}
+	registry := mirror.Registry
+	if registry == MirrorLocal {
+		image := mirror.RegistryImage
+		if image == "" {
+			image = defaultRegistryImage
+		}
+		fmt.Fprintf(&b, localRegistryScript, quoteShell(image))
+		registry = localRegistryAddress
+	}
+	if registry != "" {
+		fmt.Fprintf(&b, registryMirrorScript, quoteShell(registry))
+	}
+	return b.String(), nil
+}
+
+// mavenSettings returns maven settings mirroring every repository.
+func mavenSettings(mirrorURL string) (string, error) {
+	type mirror struct {
+		ID       string `xml:"id"`
+		MirrorOf string `xml:"mirrorOf"`
+		URL      string `xml:"url"`
+	}
+	settings := struct {
+		XMLName xml.Name `xml:"settings"`
+		Mirrors []mirror `xml:"mirrors>mirror"`
+	}{
+		Mirrors: []mirror{{ID: "drone-mirror", MirrorOf: "*", URL: mirrorURL}},
+	}
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(settings); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,71 @@
+package lehelper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestValidateMirror(t *testing.T) {
+	tests := []struct {
+		name   string
+		os     string
+		mirror *types.Mirror
+		valid  bool
+	}{
+		{name: "none", os: "windows", valid: true},
+		{name: "local", os: "linux", mirror: &types.Mirror{Registry: "local", NPM: "https://npm.internal/"}, valid: true},
+		{name: "default os", mirror: &types.Mirror{Registry: "http://10.0.0.5:5000"}, valid: true},
+		{name: "windows", os: "windows", mirror: &types.Mirror{Registry: "local"}, valid: false},
+		{name: "no scheme", os: "linux", mirror: &types.Mirror{PyPI: "pypi.internal/simple"}, valid: false},
+		{name: "image", os: "linux", mirror: &types.Mirror{Registry: "local", RegistryImage: "registry:2; reboot"}, valid: false},
+	}
+	for _, test := range tests {
+		if err := ValidateMirror(test.os, test.mirror); (err == nil) != test.valid {
+			t.Errorf("%s: want valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestWithMirrorEnvs(t *testing.T) {
+	mirror := &types.Mirror{
+		NPM:   "https://npm.internal/",
+		PyPI:  "http://pypi.internal:8080/simple",
+		Maven: "https://maven.internal/repository/all",
+	}
+	got := WithMirrorEnvs(map[string]string{"npm_config_registry": "https://registry.npmjs.org/"}, mirror)
+	want := map[string]string{
+		"npm_config_registry": "https://registry.npmjs.org/",
+		"PIP_INDEX_URL":       "http://pypi.internal:8080/simple",
+		"PIP_TRUSTED_HOST":    "pypi.internal",
+		"MAVEN_ARGS":          "--global-settings /tmp/engine/maven-mirror-settings.xml",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want envs %v, got %v", want, got)
+	}
+	if got = WithMirrorEnvs(nil, &types.Mirror{Registry: "local"}); got != nil {
+		t.Errorf("Want no envs for a registry mirror, got %v", got)
+	}
+}
+
+func TestMirrorScript(t *testing.T) {
+	got, err := mirrorScript(&types.Mirror{Registry: "local", Maven: "https://maven.internal/all?a=1&b=2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"--name drone-registry-mirror",
+		"'registry:2'",
+		`grep -qF 'http://127.0.0.1:5000' "$config"`,
+		"<url>https://maven.internal/all?a=1&amp;b=2</url>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Want script to contain %q, got %q", want, got)
+		}
+	}
+	if got, _ = mirrorScript(&types.Mirror{NPM: "https://npm.internal/"}); got != "" {
+		t.Errorf("Want no script for package proxies, got %q", got)
+	}
+}
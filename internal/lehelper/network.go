@@ -0,0 +1,102 @@
+package lehelper
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lespec "github.com/harness/lite-engine/engine/spec"
+)
+
+// NetworkMTUOption is the option of the bridge driver setting the MTU of
+// a network.
+const NetworkMTUOption = "com.docker.network.driver.mtu"
+
+const (
+	minNetworkMTU = 576
+	maxNetworkMTU = 9001
+
+	// networkSubnetSize is the prefix length of the subnets of the build
+	// networks carved from the subnet of a pool.
+	networkSubnetSize = 24
+)
+
+// ValidateNetwork returns an error if the subnet or the MTU of the build
+// networks of a pool are invalid. Empty values are valid, the docker
+// defaults are kept.
+func ValidateNetwork(platformOS, subnet string, mtu int) error {
+	if subnet == "" && mtu == 0 {
+		return nil
+	}
+	if platformOS != oshelp.OSLinux {
+		return fmt.Errorf("the network subnet and mtu are only supported on %s", oshelp.OSLinux)
+	}
+	if subnet != "" {
+		ip, _, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return fmt.Errorf("invalid network subnet %q, e.g. 10.200.0.0/16", subnet)
+		}
+		if ip.To4() == nil {
+			return fmt.Errorf("the network subnet %s is not an ipv4 subnet", subnet)
+		}
+	}
+	if mtu != 0 && (mtu < minNetworkMTU || mtu > maxNetworkMTU) {
+		return fmt.Errorf("invalid network mtu %d, between %d and %d", mtu, minNetworkMTU, maxNetworkMTU)
+	}
+	return nil
+}
+
+// WithNetworkDaemon returns the docker daemon configuration with the
+// networks allocated from the subnet and the MTU of the default bridge
+// set. The daemon configuration is not modified.
+func WithNetworkDaemon(daemon map[string]interface{}, subnet string, mtu int) (map[string]interface{}, error) {
+	if subnet == "" && mtu == 0 {
+		return daemon, nil
+	}
+	out := make(map[string]interface{}, len(daemon))
+	for k, v := range daemon {
+		out[k] = v
+	}
+	if subnet != "" {
+		if _, ok := daemon["default-address-pools"]; ok {
+			return nil, errors.New("default-address-pools of the docker daemon conflicts with the network subnet")
+		}
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network subnet %q: %w", subnet, err)
+		}
+		size, _ := ipNet.Mask.Size()
+		if size < networkSubnetSize {
+			size = networkSubnetSize
+		}
+		out["default-address-pools"] = []interface{}{
+			map[string]interface{}{"base": ipNet.String(), "size": size},
+		}
+	}
+	if mtu != 0 {
+		if _, ok := daemon["mtu"]; ok {
+			return nil, errors.New("mtu of the docker daemon conflicts with the network mtu")
+		}
+		out["mtu"] = mtu
+	}
+	return out, nil
+}
+
+// WithNetworkMTU returns the network with the MTU option set, unless it
+// is set already. The options of the network are not modified.
+func WithNetworkMTU(network lespec.Network, mtu int) lespec.Network {
+	if mtu == 0 {
+		return network
+	}
+	if _, ok := network.Options[NetworkMTUOption]; ok {
+		return network
+	}
+	options := make(map[string]string, len(network.Options)+1)
+	for k, v := range network.Options {
+		options[k] = v
+	}
+	options[NetworkMTUOption] = fmt.Sprint(mtu)
+	network.Options = options
+	return network
+}
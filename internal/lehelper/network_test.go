@@ -0,0 +1,83 @@
+package lehelper
+
+import (
+	"testing"
+
+	lespec "github.com/harness/lite-engine/engine/spec"
+)
+
+func TestValidateNetwork(t *testing.T) {
+	tests := []struct {
+		os, subnet string
+		mtu        int
+		valid      bool
+	}{
+		{os: "linux", valid: true},
+		{os: "windows", valid: true},
+		{os: "linux", subnet: "10.200.0.0/16", valid: true},
+		{os: "linux", subnet: "172.31.240.0/20", mtu: 1400, valid: true},
+		{os: "linux", mtu: 9001, valid: true},
+		{os: "linux", subnet: "10.200.0.0"},
+		{os: "linux", subnet: "fd00::/64"},
+		{os: "linux", mtu: 100},
+		{os: "linux", mtu: 65535},
+		{os: "windows", mtu: 1400},
+	}
+	for _, test := range tests {
+		if err := ValidateNetwork(test.os, test.subnet, test.mtu); (err == nil) != test.valid {
+			t.Errorf("want the subnet %q and mtu %d on %s valid %t, got %v", test.subnet, test.mtu, test.os, test.valid, err)
+		}
+	}
+}
+
+func TestWithNetworkDaemon(t *testing.T) {
+	daemon := map[string]interface{}{"log-driver": "json-file"}
+	got, err := WithNetworkDaemon(daemon, "10.200.1.0/16", 1400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := DaemonJSON("linux", got)
+	want := `{
+  "default-address-pools": [
+    {
+      "base": "10.200.0.0/16",
+      "size": 24
+    }
+  ],
+  "log-driver": "json-file",
+  "mtu": 1400
+}`
+	if out != want {
+		t.Errorf("Want daemon json %s, got %s", want, out)
+	}
+	if len(daemon) != 1 {
+		t.Errorf("Want the daemon configuration unmodified, got %v", daemon)
+	}
+
+	got, _ = WithNetworkDaemon(nil, "10.200.0.0/26", 0)
+	if size := got["default-address-pools"].([]interface{})[0].(map[string]interface{})["size"]; size != 26 {
+		t.Errorf("Want the networks of a small subnet as large as the subnet, got size %v", size)
+	}
+
+	if _, err = WithNetworkDaemon(map[string]interface{}{"mtu": 1500}, "", 1400); err == nil {
+		t.Errorf("Want error for a conflicting mtu")
+	}
+	if _, err = WithNetworkDaemon(map[string]interface{}{"default-address-pools": nil}, "10.200.0.0/16", 0); err == nil {
+		t.Errorf("Want error for conflicting address pools")
+	}
+}
+
+func TestWithNetworkMTU(t *testing.T) {
+	network := lespec.Network{ID: "net", Options: map[string]string{"com.docker.network.bridge.enable_icc": "true"}}
+	got := WithNetworkMTU(network, 1400)
+	if got.Options[NetworkMTUOption] != "1400" || got.Options["com.docker.network.bridge.enable_icc"] != "true" {
+		t.Errorf("Want the mtu option added, got %v", got.Options)
+	}
+	if _, ok := network.Options[NetworkMTUOption]; ok {
+		t.Errorf("Want the network options unmodified, got %v", network.Options)
+	}
+	network.Options[NetworkMTUOption] = "1300"
+	if got = WithNetworkMTU(network, 1400); got.Options[NetworkMTUOption] != "1300" {
+		t.Errorf("Want the mtu option of the runner kept, got %v", got.Options)
+	}
+}
@@ -0,0 +1,61 @@
+package lehelper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const oomDetectTimeout = 30 * time.Second
+
+// oomScript prints the kernel OOM killer events and the docker OOM events
+// since the unix time in the %d verbs.
+const oomScript = `
+{ journalctl -k --no-pager -q --since @%d 2>/dev/null || dmesg 2>/dev/null; } | grep -iE 'out of memory|oom-kill|killed process' | tail -n 5
+if command -v docker >/dev/null 2>&1; then
+	docker events --since %d --until "$(date +%%s)" --filter event=oom --format 'container {{.Actor.Attributes.name}} was killed by the OOM killer' 2>/dev/null | tail -n 5
+fi
+exit 0
+`
+
+// CheckOOM looks for the OOM killer events of a failed step when detect is
+// set, and marks the step OOM killed if there are any. It returns the events.
+// No script is run for the steps which succeeded or are known OOM killed.
+func CheckOOM(ctx context.Context, client lehttp.Client, platformOS string, since time.Time, resp *api.PollStepResponse, detect bool) (string, error) {
+	if !detect || resp.ExitCode == 0 || resp.OOMKilled {
+		return "", nil
+	}
+	events, err := DetectOOM(ctx, client, platformOS, since)
+	if err != nil {
+		return "", err
+	}
+	if events != "" {
+		resp.OOMKilled = true
+	}
+	return events, nil
+}
+
+// DetectOOM looks for OOM killer events on the instance since the given
+// time. It returns the matching log lines, or an empty string if the
+// instance did not run out of memory. Only linux instances are supported.
+func DetectOOM(ctx context.Context, client lehttp.Client, platformOS string, since time.Time) (string, error) {
+	if platformOS != oshelp.OSLinux {
+		return "", nil
+	}
+	unix := since.Unix()
+	var buf bytes.Buffer
+	_, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    fmt.Sprintf(oomScript, unix, unix),
+		Timeout: oomDetectTimeout,
+	}, &buf)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,71 @@
+package lehelper
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+// oomClient counts the scripts started and prints the events.
+type oomClient struct {
+	lehttp.Client
+	events  string
+	started int
+}
+
+func (c *oomClient) RetryStartStep(context.Context, *api.StartStepRequest) (*api.StartStepResponse, error) {
+	c.started++
+	return &api.StartStepResponse{}, nil
+}
+
+func (c *oomClient) RetryPollStep(context.Context, *api.PollStepRequest, time.Duration) (*api.PollStepResponse, error) {
+	return &api.PollStepResponse{Exited: true}, nil
+}
+
+func (c *oomClient) GetStepLogOutput(_ context.Context, _ *api.StreamOutputRequest, w io.Writer) error {
+	_, err := io.WriteString(w, c.events)
+	return err
+}
+
+func TestCheckOOM(t *testing.T) {
+	tests := []struct {
+		name      string
+		os        string
+		detect    bool
+		resp      api.PollStepResponse
+		events    string
+		started   int
+		oomKilled bool
+	}{
+		{name: "disabled", os: "linux", resp: api.PollStepResponse{ExitCode: 137}, events: "Out of memory: Killed process 42"},
+		{name: "succeeded", os: "linux", detect: true, resp: api.PollStepResponse{}},
+		{name: "known", os: "linux", detect: true, resp: api.PollStepResponse{ExitCode: 137, OOMKilled: true}, oomKilled: true},
+		{name: "windows", os: "windows", detect: true, resp: api.PollStepResponse{ExitCode: 1}},
+		{name: "no events", os: "linux", detect: true, resp: api.PollStepResponse{ExitCode: 1}, started: 1},
+		{name: "killed", os: "linux", detect: true, resp: api.PollStepResponse{ExitCode: 137}, events: "Out of memory: Killed process 42\n",
+			started: 1, oomKilled: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &oomClient{events: test.events}
+			resp := test.resp
+			events, err := CheckOOM(context.Background(), client, test.os, time.Now(), &resp, test.detect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.started != test.started {
+				t.Errorf("Want %d scripts run, got %d", test.started, client.started)
+			}
+			if resp.OOMKilled != test.oomKilled {
+				t.Errorf("Want OOM killed %v, got %v", test.oomKilled, resp.OOMKilled)
+			}
+			if test.oomKilled && test.started > 0 && events != "Out of memory: Killed process 42" {
+				t.Errorf("Unexpected events %q", events)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+	"github.com/harness/lite-engine/logger"
+)
+
+// ErrConnectionLost is returned when lite-engine was unreachable for too
+// long while a step was running.
+type ErrConnectionLost struct {
+	Running     time.Duration // time the step was running when the connection was lost
+	Unreachable time.Duration // time lite-engine has been unreachable
+}
+
+func (e *ErrConnectionLost) Error() string {
+	return fmt.Sprintf("connection to lite-engine lost after %s, unreachable for %s",
+		e.Running.Truncate(time.Second), e.Unreachable.Truncate(time.Second))
+}
+
+// PollStep waits for the step to finish like RetryPollStep. While it waits
+// it checks the health of lite-engine every heartbeat. A dropped
+// connection is re-established by polling again, but once lite-engine has
+// been unreachable for longer than maxUnreachable PollStep gives up with
+// ErrConnectionLost instead of waiting until the step timeout. A zero
+// heartbeat or maxUnreachable disables the health checks.
+func PollStep(ctx context.Context, client lehttp.Client, id string, timeout, heartbeat, maxUnreachable time.Duration) (*api.PollStepResponse, error) {
+	if heartbeat <= 0 || maxUnreachable <= 0 {
+		return client.RetryPollStep(ctx, &api.PollStepRequest{ID: id}, timeout)
+	}
+
+	pollCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		lostErr error
+		done    = make(chan struct{})
+		started = time.Now()
+	)
+	go func() {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		lastSeen := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-pollCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			hctx, hcancel := context.WithTimeout(pollCtx, heartbeat)
+			_, err := client.Health(hctx, false)
+			hcancel()
+			if err == nil {
+				lastSeen = time.Now()
+				continue
+			}
+			unreachable := time.Since(lastSeen)
+			logger.FromContext(ctx).WithError(err).WithField("unreachable", unreachable.Truncate(time.Second)).
+				Warnln("lite-engine health check failed while the step is running")
+			if unreachable >= maxUnreachable {
+				mu.Lock()
+				lostErr = &ErrConnectionLost{Running: time.Since(started), Unreachable: unreachable}
+				mu.Unlock()
+				cancel()
+				return
+			}
+		}
+	}()
+
+	resp, err := client.RetryPollStep(pollCtx, &api.PollStepRequest{ID: id}, timeout)
+	close(done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if lostErr != nil && ctx.Err() == nil {
+		return nil, lostErr
+	}
+	return resp, err
+}
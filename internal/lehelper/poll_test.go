@@ -0,0 +1,94 @@
+package lehelper
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+type fakeClient struct {
+	lehttp.Client
+	healthErr error
+}
+
+func (c *fakeClient) Health(context.Context, bool) (*api.HealthResponse, error) {
+	return &api.HealthResponse{OK: c.healthErr == nil}, c.healthErr
+}
+
+// RetryPollStep blocks until the context is canceled, like a poll request
+// on a connection dropped without a reset.
+func (c *fakeClient) RetryPollStep(ctx context.Context, _ *api.PollStepRequest, _ time.Duration) (*api.PollStepResponse, error) {
+	if c.healthErr == nil {
+		return &api.PollStepResponse{Exited: true}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestPollStep(t *testing.T) {
+	resp, err := PollStep(context.Background(), &fakeClient{}, "step", time.Minute, time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Exited {
+		t.Errorf("Want the poll response")
+	}
+}
+
+func TestPollStep_ConnectionLost(t *testing.T) {
+	client := &fakeClient{healthErr: errors.New("i/o timeout")}
+	_, err := PollStep(context.Background(), client, "step", time.Minute, time.Millisecond, 20*time.Millisecond)
+	var lostErr *ErrConnectionLost
+	if !errors.As(err, &lostErr) {
+		t.Fatalf("Want connection lost error, got %v", err)
+	}
+	if lostErr.Unreachable < 20*time.Millisecond {
+		t.Errorf("Want unreachable for at least 20ms, got %s", lostErr.Unreachable)
+	}
+}
+
+// flakyClient fails every health check but one in five, and the step
+// exits after the duration.
+type flakyClient struct {
+	lehttp.Client
+	checks   int32
+	duration time.Duration
+}
+
+func (c *flakyClient) Health(context.Context, bool) (*api.HealthResponse, error) {
+	if atomic.AddInt32(&c.checks, 1)%5 != 0 {
+		return nil, errors.New("i/o timeout")
+	}
+	return &api.HealthResponse{OK: true}, nil
+}
+
+func (c *flakyClient) RetryPollStep(ctx context.Context, _ *api.PollStepRequest, _ time.Duration) (*api.PollStepResponse, error) {
+	select {
+	case <-time.After(c.duration):
+		return &api.PollStepResponse{Exited: true}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TestPollStep_TransientFailures checks that the health checks failing for
+// less than maxUnreachable at a time do not fail the step, even when the
+// failures add up to more.
+func TestPollStep_TransientFailures(t *testing.T) {
+	client := &flakyClient{duration: 300 * time.Millisecond}
+	resp, err := PollStep(context.Background(), client, "step", time.Minute, 2*time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Want the step to complete, got %v", err)
+	}
+	if !resp.Exited {
+		t.Errorf("Want the poll response")
+	}
+	if checks := atomic.LoadInt32(&client.checks); checks < 10 {
+		t.Errorf("Want the health checked through the step, got %d checks", checks)
+	}
+}
@@ -0,0 +1,108 @@
+package lehelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const securityModulesTimeout = 2 * time.Minute
+
+const (
+	SELinuxPermissive = "permissive"
+	SELinuxEnforcing  = "enforcing"
+)
+
+// dockerAppArmorProfile is the profile docker applies to the containers.
+// docker only generates it when it is not loaded, a profile of the same
+// name replaces it.
+const dockerAppArmorProfile = "docker-default"
+
+var appArmorProfilePattern = regexp.MustCompile(`(?m)^\s*profile\s+` + dockerAppArmorProfile + `[\s{]`)
+
+// selinuxScript sets selinux to the mode in the %[1]s verb, now and after
+// a reboot. A disabled selinux needs a reboot to be enabled, it is already
+// permissive.
+const selinuxScript = `
+set -e
+if ! command -v getenforce >/dev/null 2>&1 || [ "$(getenforce)" = Disabled ]; then
+	[ %[1]s = permissive ] && exit 0
+	echo "selinux is disabled, it cannot be set to %[1]s without a reboot"
+	exit 1
+fi
+setenforce %[2]d
+if [ -f /etc/selinux/config ]; then
+	sed -i 's/^SELINUX=.*/SELINUX=%[1]s/' /etc/selinux/config
+fi
+`
+
+// appArmorScript loads the profile in the %s verb, it is kept in
+// apparmor.d so that it is loaded again after a reboot.
+const appArmorScript = `
+set -e
+if [ ! -d /sys/kernel/security/apparmor ]; then
+	echo "apparmor is not enabled"
+	exit 1
+fi
+config=/etc/apparmor.d/drone-docker-default
+cat > "$config" <<'DRONE_APPARMOR_PROFILE'
+%s
+DRONE_APPARMOR_PROFILE
+apparmor_parser -r -W "$config"
+`
+
+// ValidateSecurityModules returns an error if the selinux mode or the
+// apparmor profile of a pool is invalid. Empty values are valid, the
+// instance defaults are kept.
+func ValidateSecurityModules(platformOS, selinux, appArmorProfile string) error {
+	if selinux == "" && appArmorProfile == "" {
+		return nil
+	}
+	if platformOS != oshelp.OSLinux {
+		return fmt.Errorf("selinux and apparmor are only supported on %s", oshelp.OSLinux)
+	}
+	switch selinux {
+	case "", SELinuxPermissive, SELinuxEnforcing:
+	default:
+		return fmt.Errorf("invalid selinux mode %q, %s or %s", selinux, SELinuxPermissive, SELinuxEnforcing)
+	}
+	if appArmorProfile != "" {
+		if !appArmorProfilePattern.MatchString(appArmorProfile) {
+			return fmt.Errorf("the apparmor profile must be named %s, the profile docker applies to the containers", dockerAppArmorProfile)
+		}
+		if strings.Contains(appArmorProfile, "DRONE_APPARMOR_PROFILE") {
+			return errors.New("the apparmor profile cannot contain DRONE_APPARMOR_PROFILE")
+		}
+	}
+	return nil
+}
+
+// ConfigureSecurityModules sets the selinux mode of the instance and loads
+// the apparmor profile of the build containers.
+func ConfigureSecurityModules(ctx context.Context, client lehttp.Client, platformOS, selinux, appArmorProfile string) error {
+	if err := ValidateSecurityModules(platformOS, selinux, appArmorProfile); err != nil {
+		return err
+	}
+	var scripts []string
+	switch selinux {
+	case SELinuxPermissive:
+		scripts = append(scripts, fmt.Sprintf(selinuxScript, selinux, 0))
+	case SELinuxEnforcing:
+		scripts = append(scripts, fmt.Sprintf(selinuxScript, selinux, 1))
+	}
+	if appArmorProfile != "" {
+		scripts = append(scripts, fmt.Sprintf(appArmorScript, strings.TrimRight(appArmorProfile, "\n")))
+	}
+	for _, script := range scripts {
+		if err := runSetupScript(ctx, client, platformOS, "security modules script", script, securityModulesTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestValidateSecurityModules(t *testing.T) {
+	const profile = `#include <tunables/global>
+
+profile docker-default flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+  file,
+  network,
+  capability,
+}
+`
+	tests := []struct {
+		os, selinux, apparmor string
+		valid                 bool
+	}{
+		{os: "linux", valid: true},
+		{os: "windows", valid: true},
+		{os: "linux", selinux: "permissive", valid: true},
+		{os: "linux", selinux: "enforcing", valid: true},
+		{os: "linux", apparmor: profile, valid: true},
+		{os: "linux", selinux: "enforcing", apparmor: profile, valid: true},
+		{os: "linux", selinux: "disabled"},
+		{os: "linux", selinux: "Permissive"},
+		{os: "windows", selinux: "permissive"},
+		{os: "darwin", apparmor: profile},
+		{os: "linux", apparmor: "profile build-containers {\n}\n"},
+		{os: "linux", apparmor: "profile docker-defaults {\n}\n"},
+		{os: "linux", apparmor: profile + "DRONE_APPARMOR_PROFILE\n"},
+	}
+	for _, test := range tests {
+		if err := ValidateSecurityModules(test.os, test.selinux, test.apparmor); (err == nil) != test.valid {
+			t.Errorf("want selinux %q and apparmor %q on %s valid %t, got %v", test.selinux, test.apparmor, test.os, test.valid, err)
+		}
+	}
+}
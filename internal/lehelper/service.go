@@ -0,0 +1,143 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const (
+	defaultServiceInterval = 2 * time.Second
+	defaultServiceTimeout  = time.Minute
+	serviceExitedCode      = 2
+)
+
+// serviceHealthScript probes the service container in the %[1]s verb
+// until it is healthy. The ports in the %[2]s verb are probed on the
+// address of the container on the build network, or on the host if the
+// container is not on a network, and the test command in the %[3]s verb
+// runs in the container. It exits with code 2 if the container stops.
+const serviceHealthScript = `
+container=%[1]s
+ports=%[2]s
+test_cmd=%[3]s
+deadline=$(( $(date +%%s) + %[4]d ))
+while :; do
+	healthy=1
+	if [ "$(docker inspect -f '{{.State.Running}}' "$container" 2>/dev/null)" = "false" ]; then
+		echo "service container exited"
+		exit 2
+	fi
+	ip=$(docker inspect -f '{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}' "$container" 2>/dev/null | awk '{print $1}')
+	[ -z "$ip" ] && ip=127.0.0.1
+	for port in $ports; do
+		timeout 2 bash -c "</dev/tcp/$ip/$port" 2>/dev/null || healthy=0
+	done
+	if [ "$healthy" = 1 ] && [ -n "$test_cmd" ]; then
+		docker exec "$container" sh -c "$test_cmd" >/dev/null 2>&1 || healthy=0
+	fi
+	[ "$healthy" = 1 ] && exit 0
+	[ "$(date +%%s)" -ge "$deadline" ] && exit 1
+	sleep %[5]d
+done
+`
+
+const serviceHealthScriptWindows = `
+$container = %[1]s
+$ports = @(%[2]s)
+$test = %[3]s
+$deadline = (Get-Date).AddSeconds(%[4]d)
+while ($true) {
+	$healthy = $true
+	if ((docker inspect -f '{{.State.Running}}' $container 2>$null) -eq 'false') {
+		Write-Output 'service container exited'
+		exit 2
+	}
+	$ip = ((docker inspect -f '{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}' $container 2>$null) -split ' ')[0]
+	if (-not $ip) { $ip = '127.0.0.1' }
+	foreach ($port in $ports) {
+		$tcp = New-Object Net.Sockets.TcpClient
+		try { if (-not $tcp.ConnectAsync($ip, $port).Wait(2000)) { $healthy = $false } } catch { $healthy = $false } finally { $tcp.Dispose() }
+	}
+	if ($healthy -and $test) {
+		docker exec $container cmd /S /C $test | Out-Null
+		if ($LASTEXITCODE -ne 0) { $healthy = $false }
+	}
+	if ($healthy) { exit 0 }
+	if ((Get-Date) -ge $deadline) { exit 1 }
+	Start-Sleep -Seconds %[5]d
+}
+`
+
+// WaitService waits until the service running in the container with the
+// given id is healthy, or the timeout of the health check expires.
+func WaitService(ctx context.Context, client lehttp.Client, platformOS, containerID string, health *types.ServiceHealth) error {
+	if health == nil || (len(health.Ports) == 0 && health.Test == "") {
+		return nil
+	}
+	if platformOS == oshelp.OSMac {
+		return fmt.Errorf("service health checks are not supported on %s", oshelp.OSMac)
+	}
+	timeout := health.Timeout
+	if timeout <= 0 {
+		timeout = defaultServiceTimeout
+	}
+	resp, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    serviceScript(platformOS, containerID, health),
+		Timeout: timeout + time.Minute,
+	}, io.Discard)
+	if err != nil {
+		return err
+	}
+	switch resp.ExitCode {
+	case 0:
+		return nil
+	case serviceExitedCode:
+		return fmt.Errorf("service exited before it was healthy")
+	default:
+		return fmt.Errorf("service was not healthy within %s", timeout)
+	}
+}
+
+func serviceScript(platformOS, containerID string, health *types.ServiceHealth) string {
+	interval, timeout := health.Interval, health.Timeout
+	if interval < time.Second {
+		interval = defaultServiceInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultServiceTimeout
+	}
+	ports := make([]string, len(health.Ports))
+	for i, port := range health.Ports {
+		ports[i] = strconv.Itoa(port)
+	}
+	if platformOS == oshelp.OSWindows {
+		return fmt.Sprintf(serviceHealthScriptWindows, quotePowershell(containerID), strings.Join(ports, ","),
+			quotePowershell(health.Test), int(timeout.Seconds()), int(interval.Seconds()))
+	}
+	return fmt.Sprintf(serviceHealthScript, quoteShell(containerID), quoteShell(strings.Join(ports, " ")),
+		quoteShell(health.Test), int(timeout.Seconds()), int(interval.Seconds()))
+}
+
+// ServiceHostEnv returns the name of the environment variable holding the
+// hostname of the named service.
+func ServiceHostEnv(name string) string {
+	var b strings.Builder
+	b.WriteString("DRONE_SERVICE_")
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	b.WriteString("_HOST")
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package lehelper
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestServiceHostEnv(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{name: "redis", want: "DRONE_SERVICE_REDIS_HOST"},
+		{name: "my-db.v2", want: "DRONE_SERVICE_MY_DB_V2_HOST"},
+	}
+	for _, test := range tests {
+		if got := ServiceHostEnv(test.name); got != test.want {
+			t.Errorf("Want env %q for %q, got %q", test.want, test.name, got)
+		}
+	}
+}
+
+func TestServiceScript(t *testing.T) {
+	health := &types.ServiceHealth{Ports: []int{5432, 8080}, Test: "pg_isready -U 'postgres'"}
+	got := serviceScript("linux", "abc", health)
+	for _, want := range []string{"container='abc'", "ports='5432 8080'", `test_cmd='pg_isready -U '\''postgres'\'''`, "+ 60 ))", "sleep 2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Want %q in the script, got %q", want, got)
+		}
+	}
+	health = &types.ServiceHealth{Ports: []int{1433}, Interval: 5 * time.Second, Timeout: 2 * time.Minute}
+	got = serviceScript("windows", "abc", health)
+	for _, want := range []string{"$ports = @(1433)", "$test = ''", "AddSeconds(120)", "Start-Sleep -Seconds 5"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Want %q in the script, got %q", want, got)
+		}
+	}
+}
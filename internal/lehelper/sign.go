@@ -0,0 +1,145 @@
+package lehelper
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+	lespec "github.com/harness/lite-engine/engine/spec"
+)
+
+const (
+	verifierPath           = "/usr/local/bin/drone-verify"
+	verifierKeyPath        = "/etc/drone/script.pub"
+	installVerifierTimeout = time.Minute
+)
+
+// verifierScript runs the script in the second argument if its signature,
+// base64 encoded in the first argument, is valid. The script is copied to
+// a private directory first, so it cannot change between the verification
+// and its execution.
+const verifierScript = `#!/bin/sh
+set -e
+dir=$(mktemp -d)
+trap 'rm -rf "$dir"' EXIT
+cp "$2" "$dir/script"
+chmod 700 "$dir/script"
+printf '%%s' "$1" | base64 -d > "$dir/sig"
+if ! openssl pkeyutl -verify -pubin -inkey %[1]s -rawin -in "$dir/script" -sigfile "$dir/sig" >/dev/null 2>&1; then
+	echo "the signature of $2 is invalid, the script was modified after it was uploaded" >&2
+	exit 1
+fi
+"$dir/script"
+`
+
+// installVerifierScript installs the public key and the verifier, and
+// checks that openssl can verify ed25519 signatures.
+const installVerifierScript = `
+set -e
+command -v openssl >/dev/null 2>&1 || { echo "openssl is not installed"; exit 1; }
+mkdir -p %[1]s
+printf '%%s' %[2]s > %[3]s
+printf '%%s' %[4]s > %[5]s
+chmod 755 %[5]s
+openssl pkeyutl -help 2>&1 | grep -q rawin || { echo "openssl does not support ed25519 signatures"; exit 1; }
+`
+
+// Signer signs the step scripts with the private key of the runner.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner returns a signer with the ed25519 private key of the PEM file
+// at path, e.g. created with openssl genpkey -algorithm ed25519.
+func NewSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the script signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("the script signing key is not a PEM file")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the script signing key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("the script signing key is not an ed25519 key")
+	}
+	return &Signer{key: edKey}, nil
+}
+
+var signers sync.Map // key path to *Signer
+
+// LoadSigner returns the signer of the key file at path, loaded once, or
+// nil if the path is empty.
+func LoadSigner(path string) (*Signer, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if signer, ok := signers.Load(path); ok {
+		return signer.(*Signer), nil
+	}
+	signer, err := NewSigner(path)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := signers.LoadOrStore(path, signer)
+	return actual.(*Signer), nil
+}
+
+// PublicKey returns the PEM encoded public key of the signer.
+func (s *Signer) PublicKey() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(s.key.Public())
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// InstallVerifier installs the verifier of the signed scripts on linux
+// instances.
+func InstallVerifier(ctx context.Context, client lehttp.Client, platformOS string, signer *Signer) error {
+	if signer == nil || platformOS != oshelp.OSLinux {
+		return nil
+	}
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	script := fmt.Sprintf(installVerifierScript, quoteShell(path.Dir(verifierKeyPath)), quoteShell(publicKey),
+		quoteShell(verifierKeyPath), quoteShell(fmt.Sprintf(verifierScript, verifierKeyPath)), quoteShell(verifierPath))
+	return runSetupScript(ctx, client, platformOS, "installing the script verifier", script, installVerifierTimeout)
+}
+
+// SignCommand wraps the command of a linux host step run with sh -c, whose
+// script is one of the step files, so that the verifier checks the
+// signature of the script before it runs. Other commands are returned
+// unchanged.
+func SignCommand(platformOS string, signer *Signer, entrypoint, command []string, files []*lespec.File) []string {
+	if signer == nil || platformOS != oshelp.OSLinux || len(command) != 1 ||
+		len(entrypoint) != 2 || entrypoint[0] != "sh" || entrypoint[1] != "-c" { //nolint:gomnd
+		return command
+	}
+	for _, file := range files {
+		if file.IsDir || file.Path != command[0] {
+			continue
+		}
+		signature := ed25519.Sign(signer.key, []byte(file.Data))
+		return []string{fmt.Sprintf("%s %s %s", verifierPath,
+			base64.StdEncoding.EncodeToString(signature), quoteShell(file.Path))}
+	}
+	return command
+}
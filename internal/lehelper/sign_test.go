@@ -0,0 +1,58 @@
+package lehelper
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lespec "github.com/harness/lite-engine/engine/spec"
+)
+
+func TestSignCommand(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entrypoint := []string{"sh", "-c"}
+	files := []*lespec.File{{Path: "/tmp/drone/opt/abc", Data: "echo hello"}}
+	command := SignCommand("linux", signer, entrypoint, []string{"/tmp/drone/opt/abc"}, files)
+	fields := strings.Fields(command[0])
+	if len(fields) != 3 || fields[0] != verifierPath || fields[2] != "'/tmp/drone/opt/abc'" {
+		t.Fatalf("Want the script run by the verifier, got %q", command[0])
+	}
+	signature, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(public, []byte("echo hello"), signature) {
+		t.Errorf("Want a valid signature of the script")
+	}
+
+	if got := SignCommand("linux", nil, entrypoint, []string{"/tmp/drone/opt/abc"}, files); got[0] != "/tmp/drone/opt/abc" {
+		t.Errorf("Want commands unchanged without a signer, got %q", got)
+	}
+	if got := SignCommand("linux", signer, entrypoint, []string{"/tmp/drone/opt/other"}, files); got[0] != "/tmp/drone/opt/other" {
+		t.Errorf("Want commands not running a step file unchanged, got %q", got)
+	}
+	if got := SignCommand("windows", signer, []string{"powershell"}, []string{`C:\opt\abc.ps1`}, files); got[0] != `C:\opt\abc.ps1` {
+		t.Errorf("Want windows commands unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,45 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const authorizeSSHKeyTimeout = time.Minute
+
+// SSHKeyComment marks the key of the runner in authorized_keys, the
+// previous key of the runner is revoked when a new key is authorized.
+const SSHKeyComment = "drone-runner-key"
+
+// authorizeSSHKeyScript replaces the runner key in the authorized_keys of
+// the user, the file is replaced at once so that sshd never reads a
+// partial file. The %[1]s verb is the user, the %[2]s verb is the key.
+const authorizeSSHKeyScript = `
+set -e
+home=$(getent passwd %[1]s | cut -d: -f6)
+[ -n "$home" ] || { echo "user "%[1]s" does not exist"; exit 1; }
+mkdir -p "$home/.ssh"
+chmod 700 "$home/.ssh"
+keys="$home/.ssh/authorized_keys"
+tmp=$(mktemp "$keys.XXXXXX")
+[ -f "$keys" ] && grep -v ' ` + SSHKeyComment + `$' "$keys" > "$tmp" || true
+echo %[2]s >> "$tmp"
+chmod 600 "$tmp"
+chown %[1]s: "$home/.ssh" "$tmp"
+mv "$tmp" "$keys"
+`
+
+// AuthorizeSSHKey authorizes the key for the user of a linux instance and
+// revokes the previous key of the runner. The key is a line of
+// authorized_keys ending with SSHKeyComment.
+func AuthorizeSSHKey(ctx context.Context, client lehttp.Client, platformOS, user, key string) error {
+	if platformOS != oshelp.OSLinux {
+		return fmt.Errorf("ssh keys cannot be authorized on %s", platformOS)
+	}
+	script := fmt.Sprintf(authorizeSSHKeyScript, quoteShell(user), quoteShell(key))
+	return runSetupScript(ctx, client, platformOS, "authorizing the ssh key", script, authorizeSSHKeyTimeout)
+}
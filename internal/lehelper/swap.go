@@ -0,0 +1,74 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const enableSwapTimeout = 5 * time.Minute
+
+var swapSizePattern = regexp.MustCompile(`^([1-9][0-9]*)([mg])$`)
+
+// enableSwapScript creates and enables a swap file of the size in MiB of
+// the %[1]d verb. fallocate is not supported for swap files by every file
+// system, the file is written with dd if enabling it fails. The swap file
+// of a reused instance is left as is.
+const enableSwapScript = `
+set -e
+file=/drone.swap
+if swapon --show=NAME --noheadings | grep -qx "$file"; then
+	exit 0
+fi
+swapoff "$file" 2>/dev/null || true
+rm -f "$file"
+if ! { fallocate -l %[1]dM "$file" && chmod 600 "$file" && mkswap "$file" && swapon "$file"; } >/dev/null 2>&1; then
+	rm -f "$file"
+	dd if=/dev/zero of="$file" bs=1M count=%[1]d status=none
+	chmod 600 "$file"
+	mkswap "$file" >/dev/null
+	swapon "$file"
+fi
+`
+
+// swapMegabytes returns the size of the swap file in MiB.
+func swapMegabytes(size string) (int, error) {
+	m := swapSizePattern.FindStringSubmatch(size)
+	if m == nil {
+		return 0, fmt.Errorf("invalid swap size %q, e.g. 512m or 4g", size)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid swap size %q: %w", size, err)
+	}
+	if m[2] == "g" {
+		n *= 1024 //nolint:gomnd
+	}
+	return n, nil
+}
+
+// ValidateSwap returns an error if the size of the swap file is invalid,
+// or if the platform is not supported.
+func ValidateSwap(platformOS, size string) error {
+	if platformOS != oshelp.OSLinux {
+		return fmt.Errorf("swap is only supported on %s", oshelp.OSLinux)
+	}
+	_, err := swapMegabytes(size)
+	return err
+}
+
+// EnableSwap creates and enables a swap file of the size, so that builds
+// exceeding the memory of small instances slow down instead of being
+// killed.
+func EnableSwap(ctx context.Context, client lehttp.Client, platformOS, size string) error {
+	if err := ValidateSwap(platformOS, size); err != nil {
+		return err
+	}
+	mb, _ := swapMegabytes(size)
+	return runSetupScript(ctx, client, platformOS, "enabling the swap", fmt.Sprintf(enableSwapScript, mb), enableSwapTimeout)
+}
@@ -0,0 +1,34 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestSwapMegabytes(t *testing.T) {
+	tests := []struct {
+		os, size string
+		want     int
+		valid    bool
+	}{
+		{os: "linux", size: "512m", want: 512, valid: true},
+		{os: "linux", size: "4g", want: 4096, valid: true},
+		{os: "linux", size: "0g"},
+		{os: "linux", size: "4G"},
+		{os: "linux", size: "4096"},
+		{os: "linux", size: "4g; reboot"},
+		{os: "windows", size: "4g"},
+		{os: "darwin", size: "4g"},
+	}
+	for _, test := range tests {
+		if err := ValidateSwap(test.os, test.size); (err == nil) != test.valid {
+			t.Errorf("want the size %q on %s valid %t, got %v", test.size, test.os, test.valid, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		if got, _ := swapMegabytes(test.size); got != test.want {
+			t.Errorf("want %d MiB for %q, got %d", test.want, test.size, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const sysctlTimeout = time.Minute
+
+var (
+	sysctlKeyPattern   = regexp.MustCompile(`^[a-z0-9_-]+(\.[a-zA-Z0-9_-]+)+$`)
+	sysctlValuePattern = regexp.MustCompile(`^[a-zA-Z0-9_.:,/ \t-]+$`)
+)
+
+// sysctlScript writes the kernel parameters in the %s verb to a sysctl.d
+// file, so that they survive a reboot, and applies them.
+const sysctlScript = `
+set -e
+config=/etc/sysctl.d/90-drone.conf
+cat > "$config" <<'CONF'
+%s
+CONF
+chmod 0644 "$config"
+sysctl -q -p "$config"
+`
+
+// SysctlConf returns the kernel parameters of a pool in the sysctl.conf
+// format, in key order.
+func SysctlConf(platformOS string, settings map[string]string) (string, error) {
+	if len(settings) == 0 {
+		return "", nil
+	}
+	if platformOS != oshelp.OSLinux {
+		return "", fmt.Errorf("sysctl is only supported on %s", oshelp.OSLinux)
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		value := strings.TrimSpace(settings[key])
+		if !sysctlKeyPattern.MatchString(key) {
+			return "", fmt.Errorf("invalid sysctl key %q, e.g. vm.max_map_count", key)
+		}
+		if !sysctlValuePattern.MatchString(value) {
+			return "", fmt.Errorf("invalid sysctl value %q of %s", settings[key], key)
+		}
+		fmt.Fprintf(&b, "%s = %s\n", key, value)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// ConfigureSysctl sets the kernel parameters of the instance, e.g. the
+// inotify limits or vm.max_map_count.
+func ConfigureSysctl(ctx context.Context, client lehttp.Client, platformOS string, settings map[string]string) error {
+	conf, err := SysctlConf(platformOS, settings)
+	if err != nil || conf == "" {
+		return err
+	}
+	return runSetupScript(ctx, client, platformOS, "sysctl script", fmt.Sprintf(sysctlScript, conf), sysctlTimeout)
+}
@@ -0,0 +1,47 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestSysctlConf(t *testing.T) {
+	settings := map[string]string{
+		"vm.max_map_count":                "262144",
+		"fs.inotify.max_user_watches":     "524288",
+		"net.ipv4.ip_local_port_range":    "1024 65535",
+		"net.ipv4.conf.eth0.rp_filter":    " 0 ",
+		"net.ipv4.tcp_congestion_control": "bbr",
+	}
+	got, err := SysctlConf("linux", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `fs.inotify.max_user_watches = 524288
+net.ipv4.conf.eth0.rp_filter = 0
+net.ipv4.ip_local_port_range = 1024 65535
+net.ipv4.tcp_congestion_control = bbr
+vm.max_map_count = 262144`
+	if got != want {
+		t.Errorf("Want sysctl conf %s, got %s", want, got)
+	}
+	if got, err = SysctlConf("linux", nil); err != nil || got != "" {
+		t.Errorf("Want no sysctl conf without settings, got %q, %v", got, err)
+	}
+
+	invalid := []struct {
+		os       string
+		settings map[string]string
+	}{
+		{os: "windows", settings: map[string]string{"vm.swappiness": "10"}},
+		{os: "linux", settings: map[string]string{"swappiness": "10"}},
+		{os: "linux", settings: map[string]string{"vm.swappiness; reboot": "10"}},
+		{os: "linux", settings: map[string]string{"vm.swappiness": ""}},
+		{os: "linux", settings: map[string]string{"vm.swappiness": "10\nCONF"}},
+		{os: "linux", settings: map[string]string{"vm.swappiness": "$(reboot)"}},
+	}
+	for _, test := range invalid {
+		if _, err := SysctlConf(test.os, test.settings); err == nil {
+			t.Errorf("Want error for %v on %s", test.settings, test.os)
+		}
+	}
+}
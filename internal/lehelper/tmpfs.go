@@ -0,0 +1,56 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const mountTmpfsTimeout = time.Minute
+
+var tmpfsSizePattern = regexp.MustCompile(`^[1-9][0-9]*[kmg]?$`)
+
+// mountTmpfsScript mounts a tmpfs of the size in the %s verb on each
+// directory of the arguments, readable by root only. Directories already
+// mounted are left as is.
+const mountTmpfsScript = `
+set -e
+for dir in "$@"; do
+	mkdir -p "$dir"
+	if ! mountpoint -q "$dir"; then
+		mount -t tmpfs -o size=%s,mode=0700,nosuid,nodev tmpfs "$dir"
+	fi
+done
+`
+
+// ValidateTmpfs returns an error if the size of the tmpfs is invalid, or if
+// the platform has no tmpfs.
+func ValidateTmpfs(platformOS, size string) error {
+	if platformOS != oshelp.OSLinux {
+		return fmt.Errorf("tmpfs is only supported on %s", oshelp.OSLinux)
+	}
+	if !tmpfsSizePattern.MatchString(size) {
+		return fmt.Errorf("invalid tmpfs size %q, e.g. 64m or 1g", size)
+	}
+	return nil
+}
+
+// MountTmpfs mounts a tmpfs of the size on the directories, so that the
+// files written to them never reach the disks of the instance. It must run
+// before lite-engine creates the files of the pipeline.
+func MountTmpfs(ctx context.Context, client lehttp.Client, platformOS, size string, dirs ...string) error {
+	if err := ValidateTmpfs(platformOS, size); err != nil {
+		return err
+	}
+	args := make([]string, len(dirs))
+	for i, dir := range dirs {
+		args[i] = "'" + strings.ReplaceAll(dir, "'", `'\''`) + "'"
+	}
+	script := "set -- " + strings.Join(args, " ") + "\n" + fmt.Sprintf(mountTmpfsScript, size)
+	return runSetupScript(ctx, client, platformOS, "mounting the tmpfs", script, mountTmpfsTimeout)
+}
@@ -0,0 +1,27 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestValidateTmpfs(t *testing.T) {
+	tests := []struct {
+		os, size string
+		valid    bool
+	}{
+		{os: "linux", size: "64m", valid: true},
+		{os: "linux", size: "1g", valid: true},
+		{os: "linux", size: "1048576", valid: true},
+		{os: "linux", size: "0m"},
+		{os: "linux", size: "64M"},
+		{os: "linux", size: "50%"},
+		{os: "linux", size: "64m,exec"},
+		{os: "windows", size: "64m"},
+		{os: "darwin", size: "64m"},
+	}
+	for _, test := range tests {
+		if err := ValidateTmpfs(test.os, test.size); (err == nil) != test.valid {
+			t.Errorf("want the size %q on %s valid %t, got %v", test.size, test.os, test.valid, err)
+		}
+	}
+}
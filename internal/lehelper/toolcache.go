@@ -0,0 +1,208 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const toolcacheTimeout = 20 * time.Minute
+
+const (
+	ToolNode = "node"
+	ToolGo   = "go"
+	ToolJDK  = "jdk"
+)
+
+var (
+	// node and go versions are exact releases, e.g. 18.17.1 and 1.21.0.
+	releasePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){1,2}$`)
+	// jdk versions are feature releases, e.g. 17, the latest GA build is installed.
+	featurePattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// the toolcache follows the layout of the hosted toolcache,
+// <root>/<name>/<version>/<arch> with a <arch>.complete marker, so
+// setup tools looking for RUNNER_TOOL_CACHE find the versions.
+const (
+	toolcacheDir        = "/opt/hostedtoolcache"
+	toolcacheDirMac     = "/Users/Shared/hostedtoolcache"
+	toolcacheDirWindows = `C:\hostedtoolcache`
+)
+
+// toolcacheScript installs the tool in the arguments, the archive is
+// extracted to a temporary directory which is moved into the cache once
+// complete, so builds never see partially installed tools.
+const toolcacheScript = `
+set -e
+install_tool() {
+	dir="%[1]s/$1/$2/$3"
+	[ -f "$dir.complete" ] && return 0
+	tmp=$(mktemp -d)
+	curl -fsSL --retry 3 -o "$tmp/archive" "$4"
+	mkdir -p "$tmp/out"
+	tar -xzf "$tmp/archive" -C "$tmp/out" --strip-components=1
+	rm -rf "$dir"
+	mkdir -p "$(dirname "$dir")"
+	mv "$tmp/out" "$dir"
+	touch "$dir.complete"
+	rm -rf "$tmp"
+	echo "installed $1 $2"
+}
+`
+
+const toolcacheScriptWindows = `
+$ErrorActionPreference = 'Stop'
+$ProgressPreference = 'SilentlyContinue'
+function Install-Tool($name, $version, $arch, $url) {
+	$dir = Join-Path '%[1]s' "$name\$version\$arch"
+	if (Test-Path "$dir.complete") { return }
+	$tmp = Join-Path $env:TEMP ([guid]::NewGuid())
+	New-Item -ItemType Directory -Path $tmp | Out-Null
+	Invoke-WebRequest -UseBasicParsing -Uri $url -OutFile "$tmp\archive.zip"
+	Expand-Archive -Path "$tmp\archive.zip" -DestinationPath "$tmp\out"
+	$top = Get-ChildItem "$tmp\out" | Select-Object -First 1
+	if (Test-Path $dir) { Remove-Item -Recurse -Force $dir }
+	New-Item -ItemType Directory -Path (Split-Path $dir) -Force | Out-Null
+	Move-Item $top.FullName $dir
+	New-Item -ItemType File -Path "$dir.complete" | Out-Null
+	Remove-Item -Recurse -Force $tmp
+	Write-Output "installed $name $version"
+}
+`
+
+// ValidateTools returns an error if a tool of a pool is unknown or its
+// version is malformed.
+func ValidateTools(tools []types.Tool) error {
+	for _, tool := range tools {
+		switch tool.Name {
+		case ToolNode, ToolGo:
+			if !releasePattern.MatchString(tool.Version) {
+				return fmt.Errorf("invalid %s version %q, has to be a release like 1.2.3", tool.Name, tool.Version)
+			}
+		case ToolJDK:
+			if !featurePattern.MatchString(tool.Version) {
+				return fmt.Errorf("invalid %s version %q, has to be a feature release like 17", tool.Name, tool.Version)
+			}
+		default:
+			return fmt.Errorf("unknown tool %q, has to be one of %s, %s or %s", tool.Name, ToolNode, ToolGo, ToolJDK)
+		}
+	}
+	return nil
+}
+
+// ToolcacheDir returns the root of the toolcache on the platform.
+func ToolcacheDir(platformOS string) string {
+	switch platformOS {
+	case oshelp.OSWindows:
+		return toolcacheDirWindows
+	case oshelp.OSMac:
+		return toolcacheDirMac
+	default:
+		return toolcacheDir
+	}
+}
+
+// WithToolcacheEnvs returns the environment variables with the variables
+// pointing setup tools at the toolcache added, if the pool has tools.
+// Variables already in envs take precedence.
+func WithToolcacheEnvs(envs map[string]string, platformOS string, tools []types.Tool) map[string]string {
+	if len(tools) == 0 {
+		return envs
+	}
+	dir := ToolcacheDir(platformOS)
+	out := map[string]string{
+		"RUNNER_TOOL_CACHE":    dir,
+		"AGENT_TOOLSDIRECTORY": dir,
+	}
+	for k, v := range envs {
+		out[k] = v
+	}
+	return out
+}
+
+// InstallTools installs the tools missing from the toolcache of the
+// instance.
+func InstallTools(ctx context.Context, client lehttp.Client, platformOS, arch string, tools []types.Tool) error {
+	if len(tools) == 0 {
+		return nil
+	}
+	script, err := installScript(platformOS, arch, tools)
+	if err != nil {
+		return err
+	}
+	return runSetupScript(ctx, client, platformOS, "toolcache script", script, toolcacheTimeout)
+}
+
+func installScript(platformOS, arch string, tools []types.Tool) (string, error) {
+	var b strings.Builder
+	if platformOS == oshelp.OSWindows {
+		fmt.Fprintf(&b, toolcacheScriptWindows, ToolcacheDir(platformOS))
+	} else {
+		fmt.Fprintf(&b, toolcacheScript, ToolcacheDir(platformOS))
+	}
+	for _, tool := range tools {
+		url, err := toolURL(tool, platformOS, arch)
+		if err != nil {
+			return "", err
+		}
+		if platformOS == oshelp.OSWindows {
+			fmt.Fprintf(&b, "Install-Tool %s %s %s %s\n",
+				quotePowershell(tool.Name), quotePowershell(tool.Version), quotePowershell(cacheArch(arch)), quotePowershell(url))
+		} else {
+			fmt.Fprintf(&b, "install_tool %s %s %s %s\n",
+				quoteShell(tool.Name), quoteShell(tool.Version), quoteShell(cacheArch(arch)), quoteShell(url))
+		}
+	}
+	return b.String(), nil
+}
+
+// toolURL returns the download url of the tool archive, a zip on windows
+// and a gzipped tarball otherwise.
+func toolURL(tool types.Tool, platformOS, arch string) (string, error) {
+	if err := ValidateTools([]types.Tool{tool}); err != nil {
+		return "", err
+	}
+	if arch != oshelp.ArchAMD64 && arch != oshelp.ArchARM64 {
+		return "", fmt.Errorf("unsupported toolcache arch %q", arch)
+	}
+	ext := "tar.gz"
+	if platformOS == oshelp.OSWindows {
+		ext = "zip"
+	}
+	switch tool.Name {
+	case ToolNode:
+		nodeOS := platformOS
+		if platformOS == oshelp.OSWindows {
+			nodeOS = "win"
+		}
+		return fmt.Sprintf("https://nodejs.org/dist/v%[1]s/node-v%[1]s-%[2]s-%[3]s.%[4]s",
+			tool.Version, nodeOS, cacheArch(arch), ext), nil
+	case ToolGo:
+		return fmt.Sprintf("https://go.dev/dl/go%s.%s-%s.%s", tool.Version, platformOS, arch, ext), nil
+	default:
+		jdkOS, jdkArch := platformOS, "x64"
+		if platformOS == oshelp.OSMac {
+			jdkOS = "mac"
+		}
+		if arch == oshelp.ArchARM64 {
+			jdkArch = "aarch64"
+		}
+		return fmt.Sprintf("https://api.adoptium.net/v3/binary/latest/%s/ga/%s/%s/jdk/hotspot/normal/eclipse",
+			tool.Version, jdkOS, jdkArch), nil
+	}
+}
+
+// cacheArch returns the arch directory name of the toolcache.
+func cacheArch(arch string) string {
+	if arch == oshelp.ArchAMD64 {
+		return "x64"
+	}
+	return arch
+}
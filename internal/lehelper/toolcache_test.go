@@ -0,0 +1,83 @@
+package lehelper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestValidateTools(t *testing.T) {
+	tests := []struct {
+		tool  types.Tool
+		valid bool
+	}{
+		{tool: types.Tool{Name: "node", Version: "18.17.1"}, valid: true},
+		{tool: types.Tool{Name: "go", Version: "1.21"}, valid: true},
+		{tool: types.Tool{Name: "jdk", Version: "17"}, valid: true},
+		{tool: types.Tool{Name: "jdk", Version: "17.0.8"}, valid: false},
+		{tool: types.Tool{Name: "node", Version: "lts"}, valid: false},
+		{tool: types.Tool{Name: "python", Version: "3.11.4"}, valid: false},
+	}
+	for _, test := range tests {
+		if err := ValidateTools([]types.Tool{test.tool}); (err == nil) != test.valid {
+			t.Errorf("Want valid %v for %s %s, got %v", test.valid, test.tool.Name, test.tool.Version, err)
+		}
+	}
+}
+
+func TestToolURL(t *testing.T) {
+	tests := []struct {
+		tool     types.Tool
+		os, arch string
+		want     string
+	}{
+		{
+			tool: types.Tool{Name: "node", Version: "18.17.1"}, os: "linux", arch: "amd64",
+			want: "https://nodejs.org/dist/v18.17.1/node-v18.17.1-linux-x64.tar.gz",
+		},
+		{
+			tool: types.Tool{Name: "node", Version: "18.17.1"}, os: "windows", arch: "amd64",
+			want: "https://nodejs.org/dist/v18.17.1/node-v18.17.1-win-x64.zip",
+		},
+		{
+			tool: types.Tool{Name: "go", Version: "1.21.0"}, os: "darwin", arch: "arm64",
+			want: "https://go.dev/dl/go1.21.0.darwin-arm64.tar.gz",
+		},
+		{
+			tool: types.Tool{Name: "jdk", Version: "17"}, os: "linux", arch: "arm64",
+			want: "https://api.adoptium.net/v3/binary/latest/17/ga/linux/aarch64/jdk/hotspot/normal/eclipse",
+		},
+	}
+	for _, test := range tests {
+		got, err := toolURL(test.tool, test.os, test.arch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("Want url %s, got %s", test.want, got)
+		}
+	}
+}
+
+func TestInstallScript(t *testing.T) {
+	tools := []types.Tool{{Name: "go", Version: "1.21.0"}}
+	got, err := installScript("linux", "amd64", tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "install_tool 'go' '1.21.0' 'x64' 'https://go.dev/dl/go1.21.0.linux-amd64.tar.gz'"; !strings.Contains(got, want) {
+		t.Errorf("Want script to contain %q, got %q", want, got)
+	}
+	if !strings.Contains(got, `dir="/opt/hostedtoolcache/$1/$2/$3"`) {
+		t.Errorf("Want the linux toolcache dir, got %q", got)
+	}
+
+	envs := WithToolcacheEnvs(map[string]string{"CI": "true"}, "windows", tools)
+	if envs["RUNNER_TOOL_CACHE"] != `C:\hostedtoolcache` || envs["CI"] != "true" {
+		t.Errorf("Want the toolcache envs added, got %v", envs)
+	}
+	if envs = WithToolcacheEnvs(nil, "linux", nil); envs != nil {
+		t.Errorf("Want no envs without tools, got %v", envs)
+	}
+}
@@ -0,0 +1,70 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const blockMetadataTimeout = time.Minute
+
+// blockMetadataScript rejects the traffic of host processes and containers
+// to the instance metadata service of amazon, google and azure, and to the
+// ipv6 address of the amazon service. Rules are only added once.
+const blockMetadataScript = `
+set -e
+block() {
+	cmd=$1; chain=$2; addr=$3
+	command -v "$cmd" >/dev/null 2>&1 || return 0
+	$cmd -n -L "$chain" >/dev/null 2>&1 || return 0
+	$cmd -C "$chain" -d "$addr" -j REJECT 2>/dev/null || $cmd -I "$chain" -d "$addr" -j REJECT
+}
+command -v iptables >/dev/null 2>&1 || { echo "iptables is not installed"; exit 1; }
+for chain in OUTPUT FORWARD DOCKER-USER; do
+	block iptables "$chain" 169.254.169.254
+	block ip6tables "$chain" fd00:ec2::254
+done
+`
+
+const blockMetadataScriptWindows = `
+$ErrorActionPreference = 'Stop'
+if (-not (Get-NetFirewallRule -Name 'drone-block-metadata' -ErrorAction SilentlyContinue)) {
+	New-NetFirewallRule -Name 'drone-block-metadata' -DisplayName 'drone block instance metadata' -Direction Outbound -Action Block -RemoteAddress 169.254.169.254,fd00:ec2::254 | Out-Null
+}
+`
+
+// ValidateUntrusted returns an error if pools of the platform cannot be
+// marked untrusted, the metadata service cannot be blocked on mac.
+func ValidateUntrusted(platformOS string) error {
+	if platformOS == oshelp.OSMac {
+		return fmt.Errorf("untrusted pools are not supported on %s", oshelp.OSMac)
+	}
+	return nil
+}
+
+// MustBlockMetadata returns true if the instance metadata must be blocked
+// for a stage, the pool runs untrusted builds or the pipeline is untrusted.
+// An error is returned if it cannot be blocked on the platform, the stage
+// must not run on the instance then.
+func MustBlockMetadata(platformOS string, untrustedPool, untrustedPipeline bool) (bool, error) {
+	if !untrustedPool && !untrustedPipeline {
+		return false, nil
+	}
+	if err := ValidateUntrusted(platformOS); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BlockMetadata firewalls the instance metadata service, so that build
+// steps cannot read the credentials of the instance role.
+func BlockMetadata(ctx context.Context, client lehttp.Client, platformOS string) error {
+	script := blockMetadataScript
+	if platformOS == oshelp.OSWindows {
+		script = blockMetadataScriptWindows
+	}
+	return runSetupScript(ctx, client, platformOS, "blocking the instance metadata", script, blockMetadataTimeout)
+}
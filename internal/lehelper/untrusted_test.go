@@ -0,0 +1,30 @@
+package lehelper
+
+import (
+	"testing"
+)
+
+func TestMustBlockMetadata(t *testing.T) {
+	tests := []struct {
+		os                string
+		pool, pipeline    bool
+		want, wantInvalid bool
+	}{
+		{os: "linux"},
+		{os: "linux", pool: true, want: true},
+		{os: "windows", pipeline: true, want: true},
+		{os: "darwin"},
+		{os: "darwin", pipeline: true, wantInvalid: true},
+		{os: "darwin", pool: true, wantInvalid: true},
+	}
+	for _, test := range tests {
+		got, err := MustBlockMetadata(test.os, test.pool, test.pipeline)
+		if (err != nil) != test.wantInvalid {
+			t.Errorf("want an error for %+v %t, got %v", test, test.wantInvalid, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("want the metadata of %+v blocked %t, got %t", test, test.want, got)
+		}
+	}
+}
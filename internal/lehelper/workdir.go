@@ -0,0 +1,29 @@
+package lehelper
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const dirExistsTimeout = time.Minute
+
+// DirExists returns true if the directory exists on the instance, e.g. the
+// working directory of a step before it runs.
+func DirExists(ctx context.Context, client lehttp.Client, platformOS, dir string) (bool, error) {
+	script := "test -d " + quoteShell(dir)
+	if platformOS == oshelp.OSWindows {
+		script = "if (-not (Test-Path -LiteralPath " + quotePowershell(dir) + " -PathType Container)) { exit 1 }"
+	}
+	resp, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    script,
+		Timeout: dirExistsTimeout,
+	}, io.Discard)
+	if err != nil {
+		return false, err
+	}
+	return resp.ExitCode == 0, nil
+}
@@ -0,0 +1,75 @@
+package lehelper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	lehttp "github.com/harness/lite-engine/cli/client"
+)
+
+const workspaceSnapshotTimeout = 30 * time.Minute
+
+// saveWorkspaceScript uploads the workspace as a gzipped tarball to the
+// presigned url. The tarball is written to a file first, presigned
+// uploads need its length.
+const saveWorkspaceScript = `
+set -e
+file=$(mktemp)
+trap 'rm -f "$file"' EXIT
+tar -czf "$file" -C "$DRONE_SNAPSHOT_DIR" .
+curl -sSf --retry 3 -T "$file" "$DRONE_SNAPSHOT_URL"
+`
+
+// restoreWorkspaceScript extracts the gzipped tarball of the presigned
+// url into the workspace.
+const restoreWorkspaceScript = `
+set -e
+mkdir -p "$DRONE_SNAPSHOT_DIR"
+curl -sSf --retry 3 "$DRONE_SNAPSHOT_URL" | tar -xzf - -C "$DRONE_SNAPSHOT_DIR"
+`
+
+// ValidateWorkspaceSnapshot returns an error if the workspace of pipelines
+// of the platform cannot be snapshotted.
+func ValidateWorkspaceSnapshot(platformOS string) error {
+	if platformOS == oshelp.OSWindows {
+		return fmt.Errorf("workspace snapshots are not supported on %s", oshelp.OSWindows)
+	}
+	return nil
+}
+
+// SaveWorkspace uploads the snapshot of the workspace directory to the
+// url.
+func SaveWorkspace(ctx context.Context, client lehttp.Client, platformOS, dir, url string) error {
+	return runWorkspaceScript(ctx, client, platformOS, saveWorkspaceScript, dir, url, "saving")
+}
+
+// RestoreWorkspace extracts the snapshot of the url into the workspace
+// directory.
+func RestoreWorkspace(ctx context.Context, client lehttp.Client, platformOS, dir, url string) error {
+	return runWorkspaceScript(ctx, client, platformOS, restoreWorkspaceScript, dir, url, "restoring")
+}
+
+// runWorkspaceScript runs the script with the directory and the url in
+// its environment, the signature of the url is not recorded with the
+// script.
+func runWorkspaceScript(ctx context.Context, client lehttp.Client, platformOS, script, dir, url, action string) error {
+	if err := ValidateWorkspaceSnapshot(platformOS); err != nil {
+		return err
+	}
+	var out strings.Builder
+	resp, err := RunScript(ctx, client, platformOS, &Script{
+		Data:    script,
+		Envs:    map[string]string{"DRONE_SNAPSHOT_DIR": dir, "DRONE_SNAPSHOT_URL": url},
+		Timeout: workspaceSnapshotTimeout,
+	}, &out)
+	if err != nil {
+		return err
+	}
+	if resp.ExitCode != 0 {
+		return fmt.Errorf("%s the workspace snapshot exited with code %d: %s", action, resp.ExitCode, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+// Stage returns a new match function that returns true if the
+// stage matches the filter the runner polls the server with. The
+// server routes stages by the filter, a stage that does not match
+// it was routed by a misconfigured server or runner and must not
+// run on the pools of this runner.
+func Stage(filter *client.Filter) func(*drone.Stage) bool {
+	return func(stage *drone.Stage) bool {
+		if stage.Kind != "" && stage.Kind != filter.Kind {
+			return false
+		}
+		if stage.Type != "" && stage.Type != filter.Type {
+			return false
+		}
+		if !matchPlatform(stage.OS, filter.OS) ||
+			!matchPlatform(stage.Arch, filter.Arch) ||
+			!matchPlatform(stage.Variant, filter.Variant) ||
+			!matchPlatform(stage.Kernel, filter.Kernel) {
+			return false
+		}
+		return matchLabels(stage.Labels, filter.Labels)
+	}
+}
+
+// matchPlatform returns true if the runner does not restrict the
+// value, or if the stage has the value of the runner.
+func matchPlatform(stage, runner string) bool {
+	return runner == "" || stage == runner
+}
+
+// matchLabels returns true if the stage and the runner have the
+// same labels, like the server does when it routes the stage.
+func matchLabels(stage, runner map[string]string) bool {
+	if len(stage) != len(runner) {
+		return false
+	}
+	for k, v := range stage {
+		if w, ok := runner[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
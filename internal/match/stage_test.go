@@ -0,0 +1,68 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestStage(t *testing.T) {
+	filter := &client.Filter{
+		Kind:   "pipeline",
+		Type:   "vm",
+		OS:     "linux",
+		Labels: map[string]string{"pool": "aws"},
+	}
+	tests := []struct {
+		name  string
+		stage *drone.Stage
+		match bool
+	}{
+		{
+			name:  "same kind, type, os and labels",
+			stage: &drone.Stage{Kind: "pipeline", Type: "vm", OS: "linux", Arch: "arm64", Labels: map[string]string{"pool": "aws"}},
+			match: true,
+		},
+		{
+			name:  "stage without kind and type",
+			stage: &drone.Stage{OS: "linux", Labels: map[string]string{"pool": "aws"}},
+			match: true,
+		},
+		{
+			name:  "docker pipeline",
+			stage: &drone.Stage{Kind: "pipeline", Type: "docker", OS: "linux", Labels: map[string]string{"pool": "aws"}},
+			match: false,
+		},
+		{
+			name:  "other os",
+			stage: &drone.Stage{Kind: "pipeline", Type: "vm", OS: "windows", Labels: map[string]string{"pool": "aws"}},
+			match: false,
+		},
+		{
+			name:  "other labels",
+			stage: &drone.Stage{Kind: "pipeline", Type: "vm", OS: "linux", Labels: map[string]string{"pool": "gcp"}},
+			match: false,
+		},
+		{
+			name:  "no labels",
+			stage: &drone.Stage{Kind: "pipeline", Type: "vm", OS: "linux"},
+			match: false,
+		},
+		{
+			name:  "more labels",
+			stage: &drone.Stage{Kind: "pipeline", Type: "vm", OS: "linux", Labels: map[string]string{"pool": "aws", "gpu": "true"}},
+			match: false,
+		},
+	}
+	match := Stage(filter)
+	for _, test := range tests {
+		if got := match(test.stage); got != test.match {
+			t.Errorf("%s: want match %v, got %v", test.name, test.match, got)
+		}
+	}
+}
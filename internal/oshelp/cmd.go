@@ -0,0 +1,41 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package oshelp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// cmdEscaper escapes the characters interpreted by cmd.exe, so the
+// command is echoed verbatim.
+var cmdEscaper = strings.NewReplacer(
+	"^", "^^",
+	"&", "^&",
+	"|", "^|",
+	"<", "^<",
+	">", "^>",
+	"(", "^(",
+	")", "^)",
+	"%", "%%",
+)
+
+// CmdScript converts a slice of individual shell commands to a windows
+// batch script executed by cmd.exe. Every command is echoed before it is
+// executed, and the script exits with the exit code of the first failing
+// command.
+func CmdScript(commands []string) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, "@echo off")
+	for _, command := range commands {
+		for _, line := range strings.Split(strings.TrimRight(command, "\r\n"), "\n") {
+			fmt.Fprintf(buf, "echo + %s\n", cmdEscaper.Replace(strings.TrimRight(line, "\r")))
+		}
+		fmt.Fprintln(buf, command)
+		buf.WriteString("if %errorlevel% neq 0 exit /b %errorlevel%\n")
+	}
+	return buf.String()
+}
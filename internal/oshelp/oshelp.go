@@ -20,6 +20,14 @@ const OSMac = "darwin"
 const ArchAMD64 = "amd64"
 const ArchARM64 = "arm64"
 
+const ShellCmd = "cmd"
+const ShellPowershell = "powershell"
+
+// WindowsRootDir is the root of the build workspaces on windows. It is
+// kept short, deep trees like node_modules quickly exceed MAX_PATH below
+// a long root.
+const WindowsRootDir = `C:\h`
+
 const Ubuntu = "ubuntu"
 const AmazonLinux = "amazon-linux"
 
@@ -33,6 +41,35 @@ func JoinPaths(os string, paths ...string) string {
 	}
 }
 
+// NormalizePath helper function converts the separators of the path to
+// the separators of the target platform. On windows repeated separators
+// are collapsed, except the leading \\ of UNC and \\?\ paths.
+func NormalizePath(os, path string) string {
+	if os != OSWindows {
+		return path
+	}
+	path = strings.ReplaceAll(path, "/", `\`)
+	prefix := ""
+	if strings.HasPrefix(path, `\\`) {
+		prefix = `\\`
+		path = strings.TrimLeft(path, `\`)
+	}
+	for strings.Contains(path, `\\`) {
+		path = strings.ReplaceAll(path, `\\`, `\`)
+	}
+	return prefix + path
+}
+
+// IsAbs returns true if the path is absolute on the target platform. On
+// windows paths starting with a drive or a separator are absolute.
+func IsAbs(os, path string) bool {
+	if os == OSWindows {
+		path = NormalizePath(os, path)
+		return strings.HasPrefix(path, `\`) || (len(path) > 1 && path[1] == ':')
+	}
+	return strings.HasPrefix(path, "/")
+}
+
 // GetExt helper function returns the shell extension based on the
 // target platform.
 func GetExt(os, file string) (s string) {
@@ -56,6 +93,15 @@ func GetLiteEngineLogsPath(os string) string {
 	}
 }
 
+// GetShellExt helper function returns the script extension based on
+// the target platform and the shell of the step.
+func GetShellExt(os, shell, file string) string {
+	if os == OSWindows && shell == ShellCmd {
+		return file + ".cmd"
+	}
+	return GetExt(os, file)
+}
+
 // GetNetrc helper function returns the netrc file name based on the target platform.
 func GetNetrc(os string) string {
 	switch os {
@@ -83,6 +129,16 @@ func GenScript(os, arch string, commands []string) string {
 	}
 }
 
+// GenShellScript helper function generates and returns a script to
+// execute the provided commands with the shell of the step. Only windows
+// supports selecting the shell, cmd.exe or powershell (default).
+func GenShellScript(os, arch, shell string, commands []string) string {
+	if os == OSWindows && shell == ShellCmd {
+		return CmdScript(commands)
+	}
+	return GenScript(os, arch, commands)
+}
+
 func returnTmateScript(arch string) (script string) {
 	script = fmt.Sprintf(
 		`
@@ -119,6 +175,15 @@ func GetEntrypoint(pipelineOS string) []string {
 	return []string{"sh", "-c"}
 }
 
+// GetShellEntrypoint returns the entrypoint executing the script
+// generated by GenShellScript.
+func GetShellEntrypoint(pipelineOS, shell string) []string {
+	if pipelineOS == OSWindows && shell == ShellCmd {
+		return []string{"cmd", "/S", "/C"}
+	}
+	return GetEntrypoint(pipelineOS)
+}
+
 // Random generator function
 var Random = func() string {
 	return "drone-" + uniuri.NewLen(20) //nolint:gomnd
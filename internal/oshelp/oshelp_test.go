@@ -28,6 +28,26 @@ func Test_join(t *testing.T) {
 	}
 }
 
+func Test_normalizePath(t *testing.T) {
+	tests := []struct {
+		os   string
+		path string
+		want string
+	}{
+		{os: OSWindows, path: "C:/h/aws/drone/src", want: `C:\h\aws\drone\src`},
+		{os: OSWindows, path: `web//app\\node_modules`, want: `web\app\node_modules`},
+		{os: OSWindows, path: `\\server\share\build`, want: `\\server\share\build`},
+		{os: OSWindows, path: "//server/share/build", want: `\\server\share\build`},
+		{os: OSWindows, path: `\\?\C:\h\aws`, want: `\\?\C:\h\aws`},
+		{os: OSLinux, path: `/tmp/aws\file`, want: `/tmp/aws\file`},
+	}
+	for _, test := range tests {
+		if got := NormalizePath(test.os, test.path); got != test.want {
+			t.Errorf("Want %s for %s on %s, got %s", test.want, test.path, test.os, got)
+		}
+	}
+}
+
 func Test_getExt(t *testing.T) {
 	tests := []struct {
 		os string
@@ -77,3 +97,38 @@ func Test_getScript(t *testing.T) {
 		t.Errorf("Generated invalid linux script")
 	}
 }
+
+func Test_getShellScript(t *testing.T) {
+	commands := []string{"go build"}
+
+	if got, want := GenShellScript(OSWindows, ArchAMD64, "", commands), powershell.Script(commands); got != want {
+		t.Errorf("Want powershell script by default on windows")
+	}
+	if got, want := GenShellScript(OSWindows, ArchAMD64, ShellCmd, commands), CmdScript(commands); got != want {
+		t.Errorf("Want batch script for the cmd shell")
+	}
+	if got, want := GenShellScript(OSLinux, ArchAMD64, ShellCmd, commands), GenScript(OSLinux, ArchAMD64, commands); got != want {
+		t.Errorf("Want the shell ignored on linux")
+	}
+	if got, want := GetShellExt(OSWindows, ShellCmd, "step"), "step.cmd"; got != want {
+		t.Errorf("Want %s, got %s", want, got)
+	}
+	if got, want := GetShellEntrypoint(OSWindows, ShellCmd), []string{"cmd", "/S", "/C"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %v, got %v", want, got)
+	}
+}
+
+func Test_cmdScript(t *testing.T) {
+	got := CmdScript([]string{"echo %PATH% & dir > out.txt", "go test ./..."})
+	want := `@echo off
+echo + echo %%PATH%% ^& dir ^> out.txt
+echo %PATH% & dir > out.txt
+if %errorlevel% neq 0 exit /b %errorlevel%
+echo + go test ./...
+go test ./...
+if %errorlevel% neq 0 exit /b %errorlevel%
+`
+	if got != want {
+		t.Errorf("Want script\n%s\ngot\n%s", want, got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
@@ -15,11 +16,18 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/drivers/azure"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers/digitalocean"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers/google"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/lxd"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers/nomad"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers/noop"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/oci"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/openstack"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/tart"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers/vmfusion"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/vsphere"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/gophercloud/gophercloud"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
@@ -34,6 +42,62 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 	for i := range poolFile.Instances {
 		instance := poolFile.Instances[i]
 		logrus.Infoln(fmt.Sprintf("Parsing pool '%s', of type '%s'", instance.Name, instance.Type))
+		if err := lehelper.ValidateLocale(instance.Timezone, instance.Locale); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		if err := lehelper.ValidateTools(instance.Toolcache); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		if err := lehelper.ValidateMirror(instance.Platform.OS, instance.Mirror); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		if err := lehelper.ValidateNetwork(instance.Platform.OS, instance.NetworkSubnet, instance.NetworkMTU); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		// the subnet and the mtu are applied with the docker daemon configuration.
+		daemon, err := lehelper.WithNetworkDaemon(instance.DockerDaemon, instance.NetworkSubnet, instance.NetworkMTU)
+		if err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		instance.DockerDaemon = daemon
+		if _, err := lehelper.DaemonJSON(instance.Platform.OS, instance.DockerDaemon); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		if instance.NestedVirtualization {
+			if err := lehelper.ValidateNestedVirtualization(instance.Platform.OS); err != nil {
+				return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+			}
+		}
+		if instance.Untrusted {
+			if err := lehelper.ValidateUntrusted(instance.Platform.OS); err != nil {
+				return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+			}
+		}
+		if instance.Reserved < 0 {
+			return nil, fmt.Errorf("%s pool: reserved instances cannot be negative", instance.Name)
+		}
+		if instance.TmpfsSize != "" {
+			if err := lehelper.ValidateTmpfs(instance.Platform.OS, instance.TmpfsSize); err != nil {
+				return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+			}
+		}
+		if instance.SwapSize != "" {
+			if err := lehelper.ValidateSwap(instance.Platform.OS, instance.SwapSize); err != nil {
+				return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+			}
+		}
+		if _, err := lehelper.SysctlConf(instance.Platform.OS, instance.Sysctl); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		if err := lehelper.ValidateFirewall(instance.Platform.OS, instance.Firewall); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		if err := lehelper.ValidateSecurityModules(instance.Platform.OS, instance.SELinux, instance.AppArmorProfile); err != nil {
+			return nil, fmt.Errorf("%s pool: %w", instance.Name, err)
+		}
+		if instance.Workspace != "" && !oshelp.IsAbs(instance.Platform.OS, instance.Workspace) {
+			return nil, fmt.Errorf("%s pool: the workspace %s is not an absolute path", instance.Name, instance.Workspace)
+		}
 		switch instance.Type {
 		case string(types.VMFusion):
 			var v, ok = instance.Spec.(*config.VMFusion)
@@ -76,6 +140,67 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 				return nil, platformErr
 			}
 			instance.Platform = *platform
+			failover := make([]amazon.Failover, len(a.Failover))
+			for i, f := range a.Failover {
+				failover[i] = amazon.Failover{
+					Region:           f.Region,
+					AvailabilityZone: f.AvailabilityZone,
+					AMI:              f.AMI,
+					SubnetID:         f.SubnetID,
+					VPC:              f.VPC,
+					SecurityGroups:   f.SecurityGroups,
+				}
+			}
+			if instance.NestedVirtualization {
+				sizes := []string{a.Size}
+				if a.SizeAlt != "" {
+					sizes = append(sizes, a.SizeAlt)
+				}
+				if a.Cheapest != nil {
+					sizes = append(sizes, a.Cheapest.Sizes...)
+				}
+				for _, size := range sizes {
+					if !amazon.IsMetal(size) {
+						return nil, fmt.Errorf("%s pool: instance type %q does not support nested virtualization, use a metal instance type", instance.Name, size)
+					}
+				}
+			}
+			var cheapest *amazon.Cheapest
+			if a.Cheapest != nil {
+				cheapest = &amazon.Cheapest{
+					Sizes:        a.Cheapest.Sizes,
+					Zones:        a.Cheapest.Zones,
+					MinVCPUs:     a.Cheapest.MinVCPUs,
+					MinMemoryMiB: a.Cheapest.MinMemoryMiB,
+					Refresh:      time.Duration(a.Cheapest.RefreshMins) * time.Minute,
+				}
+			}
+			var stack *amazon.Stack
+			var stackTemplatePath string
+			if a.Stack != nil {
+				stack = &amazon.Stack{
+					Template:     a.Stack.Template,
+					Parameters:   a.Stack.Parameters,
+					Capabilities: a.Stack.Capabilities,
+					Timeout:      time.Duration(a.Stack.TimeoutMins) * time.Minute,
+				}
+				stackTemplatePath = a.Stack.TemplatePath
+			}
+			var auditInterface *amazon.AuditInterface
+			if a.Network.AuditInterface != nil {
+				auditInterface = &amazon.AuditInterface{
+					SubnetID:       a.Network.AuditInterface.SubnetID,
+					SecurityGroups: a.Network.AuditInterface.SecurityGroups,
+				}
+			}
+			var metadata *amazon.Metadata
+			if a.Metadata != nil {
+				metadata = &amazon.Metadata{
+					Tokens:   a.Metadata.Tokens,
+					HopLimit: a.Metadata.HopLimit,
+					Disabled: a.Metadata.Disabled,
+				}
+			}
 			var driver, err = amazon.New(
 				amazon.WithAccessKeyID(a.Account.AccessKeyID),
 				amazon.WithSecretAccessKey(a.Account.AccessKeySecret),
@@ -87,7 +212,7 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 				amazon.WithAMI(a.AMI),
 				amazon.WithVpc(a.VPC),
 				amazon.WithUser(a.User, instance.Platform.OS),
-				amazon.WithRegion(a.Account.Region, a.Account.Region),
+				amazon.WithRegion(a.Account.Region, a.Account.AvailabilityZone),
 				amazon.WithRetries(a.Account.Retries),
 				amazon.WithPrivateIP(a.Network.PrivateIP),
 				amazon.WithSecurityGroup(a.Network.SecurityGroups...),
@@ -95,6 +220,9 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 				amazon.WithSizeAlt(a.SizeAlt),
 				amazon.WithSubnet(a.Network.SubnetID),
 				amazon.WithUserData(a.UserData, a.UserDataPath),
+				amazon.WithUserDataPersist(a.UserDataPersist),
+				amazon.WithNameTemplate(a.NameTemplate),
+				amazon.WithSerialConsole(a.SerialConsole),
 				amazon.WithVolumeSize(a.Disk.Size),
 				amazon.WithVolumeType(a.Disk.Type),
 				amazon.WithVolumeIops(a.Disk.Iops, a.Disk.Type),
@@ -103,6 +231,11 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 				amazon.WithMarketType(a.MarketType),
 				amazon.WithTags(a.Tags),
 				amazon.WithHibernate(a.Hibernate),
+				amazon.WithFailover(failover...),
+				amazon.WithCheapest(cheapest, instance.Platform.OS),
+				amazon.WithStack(stack, stackTemplatePath),
+				amazon.WithAuditInterface(auditInterface),
+				amazon.WithMetadata(metadata),
 			)
 			if err != nil {
 				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
@@ -177,6 +310,7 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 				google.WithZones(g.Zone...),
 				google.WithUserDataKey(g.UserDataKey, instance.Platform.OS),
 				google.WithHibernate(g.Hibernate),
+				google.WithNestedVirtualization(instance.NestedVirtualization),
 				google.WithLabels(map[string]string{
 					instance.Name: instance.Name,
 				}),
@@ -309,6 +443,162 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 			pool := mapPool(&instance, runnerName)
 			pool.Driver = driver
 			pools = append(pools, pool)
+		case string(types.LXD):
+			var lx, ok = instance.Spec.(*config.LXD)
+			if !ok {
+				return nil, fmt.Errorf("%s pool parsing failed", instance.Name)
+			}
+			platform, platformErr := lxd.SetPlatformDefaults(&instance.Platform)
+			if platformErr != nil {
+				return nil, platformErr
+			}
+			instance.Platform = *platform
+			hosts := make([]*lxd.Host, len(lx.Hosts))
+			for i := range lx.Hosts {
+				hosts[i] = &lxd.Host{
+					Address:        lx.Hosts[i].Address,
+					ClientCertPath: lx.Hosts[i].ClientCertPath,
+					ClientKeyPath:  lx.Hosts[i].ClientKeyPath,
+					ServerCertPath: lx.Hosts[i].ServerCertPath,
+					Insecure:       lx.Hosts[i].Insecure,
+				}
+			}
+			driver, err := lxd.New(
+				lxd.WithHosts(hosts...),
+				lxd.WithProject(lx.Project),
+				lxd.WithImage(lx.Image, lx.ImageServer, lx.ImageProtocol),
+				lxd.WithType(lx.Type),
+				lxd.WithProfiles(lx.Profiles),
+				lxd.WithLimits(lx.CPUs, lx.Memory),
+				lxd.WithConfig(lx.Config),
+				lxd.WithUserData(lx.UserData, lx.UserDataPath),
+				lxd.WithRootDirectory(lx.RootDirectory),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
+			pool := mapPool(&instance, runnerName)
+			pool.Driver = driver
+			pools = append(pools, pool)
+		case string(types.OpenStack):
+			var ostack, ok = instance.Spec.(*config.OpenStack)
+			if !ok {
+				return nil, fmt.Errorf("%s pool parsing failed", instance.Name)
+			}
+			platform, platformErr := openstack.SetPlatformDefaults(&instance.Platform)
+			if platformErr != nil {
+				return nil, platformErr
+			}
+			instance.Platform = *platform
+			var scope *gophercloud.AuthScope
+			if ostack.Account.ProjectID != "" {
+				scope = &gophercloud.AuthScope{ProjectID: ostack.Account.ProjectID}
+			}
+			driver, err := openstack.New(
+				openstack.WithCloud(ostack.Cloud, ostack.CloudsFile),
+				openstack.WithAuth(gophercloud.AuthOptions{
+					IdentityEndpoint:            ostack.Account.AuthURL,
+					Username:                    ostack.Account.Username,
+					Password:                    ostack.Account.Password,
+					DomainName:                  ostack.Account.DomainName,
+					Scope:                       scope,
+					ApplicationCredentialID:     ostack.Account.ApplicationCredentialID,
+					ApplicationCredentialSecret: ostack.Account.ApplicationCredentialSecret,
+				}),
+				openstack.WithRegion(ostack.Region),
+				openstack.WithFlavor(ostack.Flavor),
+				openstack.WithImage(ostack.Image),
+				openstack.WithNetwork(ostack.Network),
+				openstack.WithSecurityGroups(ostack.SecurityGroups...),
+				openstack.WithAvailabilityZone(ostack.AvailabilityZone),
+				openstack.WithMetadata(ostack.Metadata),
+				openstack.WithUserData(ostack.UserData, ostack.UserDataPath),
+				openstack.WithRootDirectory(&instance.Platform),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
+			pool := mapPool(&instance, runnerName)
+			pool.Driver = driver
+			pools = append(pools, pool)
+		case string(types.VSphere):
+			var vs, ok = instance.Spec.(*config.VSphere)
+			if !ok {
+				return nil, fmt.Errorf("%s pool parsing failed", instance.Name)
+			}
+			platform, platformErr := vsphere.SetPlatformDefaults(&instance.Platform)
+			if platformErr != nil {
+				return nil, platformErr
+			}
+			instance.Platform = *platform
+			// linked clones are the default, they are created in seconds.
+			linkedClone := vs.LinkedClone == nil || *vs.LinkedClone
+			driver, err := vsphere.New(
+				vsphere.WithServer(vs.Account.Address, vs.Account.Username, vs.Account.Password, vs.Account.Insecure),
+				vsphere.WithDatacenter(vs.Datacenter),
+				vsphere.WithTemplate(vs.Template, vs.Snapshot, linkedClone),
+				vsphere.WithLocation(vs.Folder, vs.ResourcePool, vs.Datastore),
+				vsphere.WithHardware(vs.CPUs, vs.MemoryMB),
+				vsphere.WithUserData(vs.UserData, vs.UserDataPath),
+				vsphere.WithRootDirectory(&instance.Platform),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
+			pool := mapPool(&instance, runnerName)
+			pool.Driver = driver
+			pools = append(pools, pool)
+		case string(types.OCI):
+			var oc, ok = instance.Spec.(*config.OCI)
+			if !ok {
+				return nil, fmt.Errorf("%s pool parsing failed", instance.Name)
+			}
+			platform, platformErr := oci.SetPlatformDefaults(&instance.Platform)
+			if platformErr != nil {
+				return nil, platformErr
+			}
+			instance.Platform = *platform
+			driver, err := oci.New(
+				oci.WithConfigFile(oc.Account.ConfigFile, oc.Account.Profile),
+				oci.WithInstancePrincipal(oc.Account.InstancePrincipal),
+				oci.WithRegion(oc.Account.Region),
+				oci.WithCompartment(oc.Compartment),
+				oci.WithAvailabilityDomain(oc.AvailabilityDomain),
+				oci.WithShape(oc.Shape, oc.OCPUs, oc.MemoryGBs),
+				oci.WithImage(oc.Image, oc.BootVolumeGBs),
+				oci.WithSubnet(oc.Subnet, oc.AssignPublicIP),
+				oci.WithTags(oc.Tags),
+				oci.WithUserData(oc.UserData, oc.UserDataPath),
+				oci.WithRootDirectory(oc.RootDirectory),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
+			pool := mapPool(&instance, runnerName)
+			pool.Driver = driver
+			pools = append(pools, pool)
+		case string(types.Tart):
+			var t, ok = instance.Spec.(*config.Tart)
+			if !ok {
+				return nil, fmt.Errorf("%s pool parsing failed", instance.Name)
+			}
+			platform, platformErr := tart.SetPlatformDefaults(&instance.Platform)
+			if platformErr != nil {
+				return nil, platformErr
+			}
+			instance.Platform = *platform
+			driver, err := tart.New(
+				tart.WithImage(t.Image),
+				tart.WithResources(t.CPUs, t.MemoryMB),
+				tart.WithUserData(t.UserData, t.UserDataPath),
+				tart.WithRootDirectory(&instance.Platform),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
+			pool := mapPool(&instance, runnerName)
+			pool.Driver = driver
+			pools = append(pools, pool)
 		default:
 			return nil, fmt.Errorf("unknown instance tip %s", instance.Type)
 		}
@@ -334,11 +624,68 @@ func mapPool(instance *config.Instance, runnerName string) (pool drivers.Pool) {
 		MaxSize:    instance.Limit,
 		MinSize:    instance.Pool,
 		Platform:   instance.Platform,
+		Reserved:   instance.Reserved,
+		PoolSettings: types.PoolSettings{
+			Timezone:             instance.Timezone,
+			Locale:               instance.Locale,
+			Toolcache:            instance.Toolcache,
+			Mirror:               instance.Mirror,
+			DockerDaemon:         instance.DockerDaemon,
+			NestedVirtualization: instance.NestedVirtualization,
+			Untrusted:            instance.Untrusted,
+			Workspace:            instance.Workspace,
+			TmpfsSize:            instance.TmpfsSize,
+			SwapSize:             instance.SwapSize,
+			Sysctl:               instance.Sysctl,
+			SELinux:              instance.SELinux,
+			AppArmorProfile:      instance.AppArmorProfile,
+			NetworkMTU:           instance.NetworkMTU,
+			Firewall:             instance.Firewall,
+		},
 	}
 	return pool
 }
 
 func ConfigPoolFile(path string, conf *config.EnvConfig) (pool *config.PoolFile, err error) {
+	pool, err = configPoolFile(path, conf)
+	if err != nil {
+		return pool, err
+	}
+	return pool, applyAmazonSettings(pool, conf)
+}
+
+// applyAmazonSettings applies the name template and the tags of the runner
+// settings to the amazon pools, and checks that they set the required tags.
+func applyAmazonSettings(pool *config.PoolFile, conf *config.EnvConfig) error {
+	settings := conf.Settings
+	for i := range pool.Instances {
+		a, ok := pool.Instances[i].Spec.(*config.Amazon)
+		if !ok {
+			continue
+		}
+		if a.NameTemplate == "" {
+			a.NameTemplate = settings.InstanceNameTemplate
+		}
+		if len(settings.InstanceTags) != 0 && a.Tags == nil {
+			a.Tags = map[string]string{}
+		}
+		for key, value := range settings.InstanceTags {
+			a.Tags[key] = value
+		}
+		var missing []string
+		for _, key := range settings.RequiredTags {
+			if a.Tags[key] == "" {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) != 0 {
+			return fmt.Errorf("%s pool: missing the required tags %s", pool.Instances[i].Name, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+func configPoolFile(path string, conf *config.EnvConfig) (pool *config.PoolFile, err error) {
 	if path == "" {
 		logrus.Infof("no pool file provided")
 		switch {
@@ -372,13 +719,15 @@ func ConfigPoolFile(path string, conf *config.EnvConfig) (pool *config.PoolFile,
 					"for digitalocean DIGITALOCEAN_PAT")
 		}
 	}
-	pool, err = config.ParseFile(path)
+	pool, err = config.ParseFile(path, config.WithDecrypter(NewDecrypter(conf)), config.WithLookup(conf.PoolFileEnv()))
 	if err != nil {
 		logrus.WithError(err).
 			WithField("path", path).
 			Errorln("exec: unable to parse pool file")
+		return pool, err
 	}
-	return pool, err
+	validatePoolFile(path)
+	return pool, nil
 }
 
 func PrintPoolFile(pool *config.PoolFile) {
@@ -0,0 +1,38 @@
+package poolfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+func TestApplyAmazonSettings(t *testing.T) {
+	pool := &config.PoolFile{Instances: []config.Instance{
+		{Name: "ubuntu", Type: "amazon", Spec: &config.Amazon{NameTemplate: "ci-{{pool}}", Tags: map[string]string{"team": "ci", "owner": "pool"}}},
+		{Name: "windows", Type: "amazon", Spec: &config.Amazon{}},
+		{Name: "mac", Type: "anka", Spec: &config.Anka{}},
+	}}
+	conf := &config.EnvConfig{}
+	conf.Settings.InstanceNameTemplate = "drone-{{pool}}-{{short-id}}"
+	conf.Settings.InstanceTags = map[string]string{"owner": "platform"}
+	conf.Settings.RequiredTags = []string{"owner"}
+
+	if err := applyAmazonSettings(pool, conf); err != nil {
+		t.Fatal(err)
+	}
+	ubuntu, windows := pool.Instances[0].Spec.(*config.Amazon), pool.Instances[1].Spec.(*config.Amazon)
+	if ubuntu.NameTemplate != "ci-{{pool}}" || windows.NameTemplate != "drone-{{pool}}-{{short-id}}" {
+		t.Errorf("want the template of the pool, or of the settings, got %q and %q", ubuntu.NameTemplate, windows.NameTemplate)
+	}
+	if ubuntu.Tags["owner"] != "platform" || ubuntu.Tags["team"] != "ci" || windows.Tags["owner"] != "platform" {
+		t.Errorf("want the tags of the settings enforced, got %v and %v", ubuntu.Tags, windows.Tags)
+	}
+
+	conf.Settings.InstanceTags = nil
+	conf.Settings.RequiredTags = []string{"cost-center", "team"}
+	err := applyAmazonSettings(pool, conf)
+	if err == nil || !strings.Contains(err.Error(), "ubuntu pool: missing the required tags cost-center") {
+		t.Errorf("want the missing tags of the pool, got %v", err)
+	}
+}
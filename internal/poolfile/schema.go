@@ -0,0 +1,21 @@
+package poolfile
+
+import (
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/schema"
+
+	"github.com/sirupsen/logrus"
+)
+
+// validatePoolFile logs the values of the pool file that do not match
+// its schema. The pool file decoding ignores unknown fields and its keys
+// are case insensitive, mismatches are warnings.
+func validatePoolFile(path string) {
+	doc, err := config.ResolveFile(path)
+	if err != nil {
+		return
+	}
+	for _, e := range schema.Validate(schema.Pool(), doc) {
+		logrus.WithField("path", path).Warnf("pool file does not match its schema: %s", e)
+	}
+}
@@ -0,0 +1,242 @@
+package poolfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+const (
+	schemeKMS = "kms"
+	schemeAge = "age"
+)
+
+// Decrypter decrypts the encrypted values of a pool file.
+//
+// kms values are either a ciphertext blob of KMS, as printed by aws kms
+// encrypt, or an envelope of a data key encrypted by KMS and the value
+// encrypted with the data key, separated by a colon. Envelopes are not
+// limited to the 4KB that KMS encrypts directly.
+//
+// age values are base64 encoded or armored age files, decrypted with the
+// identities of DRONE_POOL_SECRETS_AGE_IDENTITY_FILE.
+type Decrypter struct {
+	kmsRegion       string
+	ageIdentityFile string
+
+	mu         sync.Mutex
+	kms        kmsiface.KMSAPI
+	identities []age.Identity
+}
+
+// NewDecrypter returns a decrypter of the pool file values. Clients and
+// identities are loaded when the first value is decrypted.
+func NewDecrypter(conf *config.EnvConfig) *Decrypter {
+	region := conf.PoolSecrets.KMSRegion
+	if region == "" {
+		region = conf.AWS.Region
+	}
+	return &Decrypter{
+		kmsRegion:       region,
+		ageIdentityFile: conf.PoolSecrets.AgeIdentityFile,
+	}
+}
+
+func (d *Decrypter) Decrypt(scheme, ciphertext string) (string, error) {
+	switch scheme {
+	case schemeKMS:
+		return d.decryptKMS(ciphertext)
+	case schemeAge:
+		return d.decryptAge(ciphertext)
+	default:
+		return "", fmt.Errorf("unsupported encryption scheme %q", scheme)
+	}
+}
+
+func (d *Decrypter) decryptKMS(ciphertext string) (string, error) {
+	d.mu.Lock()
+	if d.kms == nil {
+		client, err := NewKMSClient(d.kmsRegion)
+		if err != nil {
+			d.mu.Unlock()
+			return "", err
+		}
+		d.kms = client
+	}
+	client := d.kms
+	d.mu.Unlock()
+
+	encodedKey, encodedValue, envelope := strings.Cut(ciphertext, ":")
+	blob, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return "", fmt.Errorf("kms: invalid ciphertext: %w", err)
+	}
+	out, err := client.Decrypt(&kms.DecryptInput{CiphertextBlob: blob})
+	if err != nil {
+		return "", fmt.Errorf("kms: %w", err)
+	}
+	if !envelope {
+		return string(out.Plaintext), nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encodedValue)
+	if err != nil {
+		return "", fmt.Errorf("kms: invalid envelope: %w", err)
+	}
+	plaintext, err := openEnvelope(out.Plaintext, sealed)
+	if err != nil {
+		return "", fmt.Errorf("kms: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func (d *Decrypter) decryptAge(ciphertext string) (string, error) {
+	d.mu.Lock()
+	if d.identities == nil {
+		identities, err := loadIdentities(d.ageIdentityFile)
+		if err != nil {
+			d.mu.Unlock()
+			return "", err
+		}
+		d.identities = identities
+	}
+	identities := d.identities
+	d.mu.Unlock()
+
+	var src io.Reader
+	if strings.HasPrefix(ciphertext, armor.Header) {
+		src = armor.NewReader(strings.NewReader(ciphertext))
+	} else {
+		b, err := base64.StdEncoding.DecodeString(ciphertext)
+		if err != nil {
+			return "", fmt.Errorf("age: invalid ciphertext: %w", err)
+		}
+		src = bytes.NewReader(b)
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func loadIdentities(path string) ([]age.Identity, error) {
+	if path == "" {
+		return nil, errors.New("age: DRONE_POOL_SECRETS_AGE_IDENTITY_FILE is not set")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("age: cannot open the identity file: %w", err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("age: cannot parse the identity file: %w", err)
+	}
+	return identities, nil
+}
+
+// NewKMSClient returns a KMS client of the region. Credentials are taken
+// from the default AWS credential chain.
+func NewKMSClient(region string) (kmsiface.KMSAPI, error) {
+	cfg := fips.AWS(aws.NewConfig())
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return kms.New(sess), nil
+}
+
+// EncryptKMS encrypts the plaintext in an envelope, with a data key
+// generated by the KMS key, and returns the encrypted pool file value.
+func EncryptKMS(client kmsiface.KMSAPI, keyID string, plaintext []byte) (string, error) {
+	out, err := client.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return "", fmt.Errorf("kms: %w", err)
+	}
+	sealed, err := sealEnvelope(out.Plaintext, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("kms: %w", err)
+	}
+	return config.EncryptedPrefix + schemeKMS + ":" +
+		base64.StdEncoding.EncodeToString(out.CiphertextBlob) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// EncryptAge encrypts the plaintext to the recipients and returns the
+// encrypted pool file value.
+func EncryptAge(recipients []age.Recipient, plaintext []byte) (string, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+	if _, err = w.Write(plaintext); err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+	return config.EncryptedPrefix + schemeAge + ":" + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// sealEnvelope encrypts the plaintext with AES-GCM, the nonce is
+// prepended to the ciphertext.
+func sealEnvelope(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openEnvelope(key, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("envelope is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,115 @@
+package poolfile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+
+	"filippo.io/age"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// fakeKMS wraps keys by prefixing them, so that tests do not call AWS.
+type fakeKMS struct {
+	kmsiface.KMSAPI
+}
+
+const fakeWrap = "wrapped:"
+
+func (fakeKMS) GenerateDataKey(*kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	key := bytes.Repeat([]byte{7}, 32)
+	return &kms.GenerateDataKeyOutput{
+		Plaintext:      key,
+		CiphertextBlob: append([]byte(fakeWrap), key...),
+	}, nil
+}
+
+func (fakeKMS) Decrypt(in *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if !bytes.HasPrefix(in.CiphertextBlob, []byte(fakeWrap)) {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return &kms.DecryptOutput{Plaintext: bytes.TrimPrefix(in.CiphertextBlob, []byte(fakeWrap))}, nil
+}
+
+func TestDecrypter(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Decrypter{kms: fakeKMS{}, identities: []age.Identity{identity}}
+
+	envelope, err := EncryptKMS(fakeKMS{}, "alias/drone", []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := EncryptAge([]age.Recipient{identity.Recipient()}, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := config.EncryptedPrefix + "kms:" + base64.StdEncoding.EncodeToString([]byte(fakeWrap+"hunter2"))
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "kms envelope", value: envelope},
+		{name: "kms ciphertext blob", value: blob},
+		{name: "age", value: sealed},
+		{name: "tampered envelope", value: envelope[:len(envelope)-4] + "AAA=", wantErr: true},
+		{name: "unknown scheme", value: config.EncryptedPrefix + "vault:abc", wantErr: true},
+		{name: "missing scheme", value: config.EncryptedPrefix + "abc", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, err := config.Parse(strings.NewReader(`
+version: "1"
+instances:
+- name: pool
+  type: amazon
+  spec:
+    account:
+      region: us-east-2
+      access_key_secret: `+test.value+`
+`), config.WithDecrypter(d))
+			if test.wantErr {
+				if err == nil {
+					t.Error("want an error")
+				} else if strings.Contains(err.Error(), "hunter2") {
+					t.Errorf("error leaks the plaintext: %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec, ok := pool.Instances[0].Spec.(*config.Amazon)
+			if !ok {
+				t.Fatalf("want an amazon spec, got %T", pool.Instances[0].Spec)
+			}
+			if got := spec.Account.AccessKeySecret; got != "hunter2" {
+				t.Errorf("want the decrypted secret, got %q", got)
+			}
+		})
+	}
+}
+
+func TestParseWithoutDecrypter(t *testing.T) {
+	_, err := config.Parse(strings.NewReader(`
+version: "1"
+instances:
+- name: pool
+  type: amazon
+  spec:
+    account:
+      access_key_secret: encrypted:kms:abc
+`))
+	if err == nil {
+		t.Error("want an error for encrypted values without a decrypter")
+	}
+}
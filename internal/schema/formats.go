@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"reflect"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/engine/resource"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// The ids of the schemas are the urls they are published at.
+const (
+	PoolID     = "https://raw.githubusercontent.com/drone-runners/drone-runner-aws/master/schema/pool.json"
+	PipelineID = "https://raw.githubusercontent.com/drone-runners/drone-runner-aws/master/schema/pipeline.json"
+)
+
+// Pool returns the schema of the pool file. The spec of an instance is
+// the spec of its instance type.
+func Pool() *Schema {
+	g := newGenerator(jsonKeys)
+	// instances decode themselves to pick the spec of their type.
+	instance := g.structOf(reflect.TypeOf(config.Instance{}))
+	instance.Properties["type"] = &Schema{Type: "string", Enum: config.InstanceTypes}
+	// the type of an instance extending a base may be set by the base.
+	instance.Properties["spec"] = &Schema{Type: "object"}
+	for _, typ := range config.InstanceTypes {
+		spec, err := config.NewSpec(typ)
+		if err != nil {
+			continue
+		}
+		instance.AllOf = append(instance.AllOf, &Schema{
+			If: &Schema{
+				Properties: map[string]*Schema{"type": {Const: typ}},
+				Required:   []string{"type"},
+			},
+			Then: &Schema{
+				Properties: map[string]*Schema{"spec": g.schemaOf(reflect.TypeOf(spec))},
+			},
+		})
+	}
+	g.defs["config.Instance"] = instance
+
+	s := g.root(PoolID, "drone-runner-aws pool file", reflect.TypeOf(config.PoolFile{}))
+	s.Properties["instances"] = &Schema{Type: "array", Items: &Schema{Ref: "#/$defs/config.Instance"}}
+	s.Required = []string{"instances"}
+	g.platform()
+	return s
+}
+
+// Pipeline returns the schema of the vm pipelines of a .drone.yml.
+func Pipeline() *Schema {
+	g := newGenerator(yamlKeys)
+	s := g.root(PipelineID, "drone-runner-aws vm pipeline", reflect.TypeOf(resource.Pipeline{}))
+	s.Properties["kind"] = &Schema{Type: "string", Const: resource.Kind}
+	s.Properties["type"] = &Schema{Type: "string", Const: resource.Type}
+	s.Required = []string{"kind"}
+	g.platform()
+	return s
+}
+
+// platform restricts the os and arch of the platforms to the supported
+// ones.
+func (g *generator) platform() {
+	platform, ok := g.defs[reflect.TypeOf(types.Platform{}).String()]
+	if !ok {
+		return
+	}
+	platform.Properties["os"] = &Schema{Type: "string", Enum: []string{oshelp.OSLinux, oshelp.OSWindows, oshelp.OSMac}}
+	platform.Properties["arch"] = &Schema{Type: "string", Enum: []string{oshelp.ArchAMD64, oshelp.ArchARM64}}
+}
@@ -0,0 +1,180 @@
+// Package schema generates the JSON Schemas of the pool file and the vm
+// pipelines from the structs they are decoded into, and validates
+// documents against them.
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Draft is the JSON Schema dialect of the schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a subset of the JSON Schema vocabulary.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Const                string             `json:"const,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	If                   *Schema            `json:"if,omitempty"`
+	Then                 *Schema            `json:"then,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// closed is the schema of the additional properties of structs, no
+// value matches it. It is encoded as false.
+var closed = &Schema{Not: &Schema{}}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s == closed {
+		return []byte("false"), nil
+	}
+	type plain Schema
+	return json.Marshal((*plain)(s))
+}
+
+// keyStyle names the keys of struct fields like the decoder of the
+// document does.
+type keyStyle int
+
+const (
+	// jsonKeys are the json tag or the lowercase field name, the pool
+	// file is decoded as json.
+	jsonKeys keyStyle = iota
+	// yamlKeys are the yaml tag or the lowercase field name, pipelines
+	// are decoded as yaml.
+	yamlKeys
+)
+
+// generator converts go types to schemas. Named struct types are added
+// to the definitions and referenced.
+type generator struct {
+	keys keyStyle
+	defs map[string]*Schema
+}
+
+func newGenerator(keys keyStyle) *generator {
+	return &generator{keys: keys, defs: map[string]*Schema{}}
+}
+
+// root returns the schema of the type with the definitions it references.
+func (g *generator) root(id, title string, t reflect.Type) *Schema {
+	s := g.structOf(deref(t))
+	s.Schema = Draft
+	s.ID = id
+	s.Title = title
+	s.Defs = g.defs
+	return s
+}
+
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	t = deref(t)
+	// values with their own decoding take several forms.
+	if g.customDecoding(t) {
+		return &Schema{}
+	}
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		// yaml decodes any scalar into a string.
+		if g.keys == yamlKeys {
+			return &Schema{}
+		}
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structOf(t)
+		}
+		name := t.String()
+		if _, ok := g.defs[name]; !ok {
+			// reserve the name first so recursive types terminate.
+			g.defs[name] = &Schema{}
+			*g.defs[name] = *g.structOf(t)
+		}
+		return &Schema{Ref: "#/$defs/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+func (g *generator) structOf(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: closed}
+	g.addFields(s, t)
+	return s
+}
+
+func (g *generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, inline := g.key(f)
+		if name == "-" {
+			continue
+		}
+		// embedded structs are inlined, by json without a key and by yaml
+		// with the inline option.
+		if f.Anonymous && ((g.keys == jsonKeys && name == "") || inline) {
+			if ft := deref(f.Type); ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		// json matches the field name case insensitively.
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		s.Properties[name] = g.schemaOf(f.Type)
+	}
+}
+
+// key returns the key of the field from its tag and whether the field is
+// inlined.
+func (g *generator) key(f reflect.StructField) (name string, inline bool) {
+	tag := "json"
+	if g.keys == yamlKeys {
+		tag = "yaml"
+	}
+	name, opts, _ := strings.Cut(f.Tag.Get(tag), ",")
+	return name, strings.Contains(opts, "inline")
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// customDecoding reports whether values of the type decode themselves.
+func (g *generator) customDecoding(t reflect.Type) bool {
+	method := "UnmarshalJSON"
+	if g.keys == yamlKeys {
+		method = "UnmarshalYAML"
+	}
+	_, ok := reflect.PtrTo(t).MethodByName(method)
+	return ok
+}
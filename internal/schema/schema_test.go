@@ -0,0 +1,151 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	ghyaml "github.com/ghodss/yaml"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPublished(t *testing.T) {
+	tests := []struct {
+		path   string
+		format string
+		schema *Schema
+	}{
+		{path: "../../schema/pool.json", format: "pool", schema: Pool()},
+		{path: "../../schema/pipeline.json", format: "pipeline", schema: Pipeline()},
+	}
+	for _, test := range tests {
+		published, err := os.ReadFile(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(test.schema); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), published) {
+			t.Errorf("%s is outdated, run: go run . schema %s > schema/%s.json", test.path, test.format, test.format)
+		}
+	}
+}
+
+func TestValidate_Pool(t *testing.T) {
+	data, err := os.ReadFile("../../pool_example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(Pool(), poolDoc(t, data)); len(errs) != 0 {
+		t.Errorf("want the example pool file valid, got %v", errs)
+	}
+
+	doc := poolDoc(t, []byte(`
+instances:
+- name: ubuntu
+  type: amazon
+  pool: two
+  platform:
+    os: linux
+    arch: x86
+  spec:
+    ami: ami-123
+    size: t3.large
+    subnet: subnet-1
+- name: mac
+  type: anka
+  spec:
+    ami: ami-123
+- name: unknown
+  type: amazom
+`))
+	want := []string{
+		"instances[0].platform.arch: want one of amd64, arm64",
+		"instances[0].pool: want an integer, got a string",
+		"instances[0].spec.subnet: unknown field",
+		"instances[1].spec.ami: unknown field",
+		"instances[2].type: want one of " + joined(),
+	}
+	if got := errorStrings(Validate(Pool(), doc)); !reflect.DeepEqual(got, want) {
+		t.Errorf("want errors\n%v\ngot\n%v", want, got)
+	}
+}
+
+func TestValidate_Pipeline(t *testing.T) {
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(`
+kind: pipeline
+type: vm
+name: test
+depends_on: [build]
+pool:
+  use: ubuntu
+platform:
+  os: windows
+trigger:
+  branch: [main]
+steps:
+- name: test
+  commands: [go test]
+  environment:
+    TOKEN:
+      from_secret: token
+`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(Pipeline(), doc); len(errs) != 0 {
+		t.Errorf("want the pipeline valid, got %v", errs)
+	}
+
+	err = yaml.Unmarshal([]byte(`
+kind: pipeline
+type: docker
+pool:
+  usee: ubuntu
+steps:
+- name: test
+  command: go test
+`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"pool.usee: unknown field",
+		"steps[0].command: unknown field",
+		`type: want "vm"`,
+	}
+	if got := errorStrings(Validate(Pipeline(), doc)); !reflect.DeepEqual(got, want) {
+		t.Errorf("want errors\n%v\ngot\n%v", want, got)
+	}
+}
+
+func poolDoc(t *testing.T, data []byte) interface{} {
+	data, err := ghyaml.YAMLToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc interface{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func joined() string {
+	return "amazon, aws, anka, ankabuild, azure, digitalocean, google, gcp, vmfusion, noop, nomad, lxd, openstack, vsphere, oci, tart"
+}
+
+func errorStrings(errs []*Error) []string {
+	out := make([]string, len(errs))
+	for i, e := range errs {
+		out[i] = e.Error()
+	}
+	return out
+}
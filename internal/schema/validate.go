@@ -0,0 +1,182 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Error is a value of a document that does not match the schema.
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Validate validates a document decoded from json, with float or
+// json.Number numbers, or from yaml with string keys, against the schema.
+func Validate(s *Schema, doc interface{}) []*Error {
+	v := &validator{root: s}
+	v.validate(s, doc, "")
+	return v.errors
+}
+
+type validator struct {
+	root   *Schema
+	errors []*Error
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// matches reports whether the value matches the schema.
+func (v *validator) matches(s *Schema, value interface{}) bool {
+	sub := &validator{root: v.root}
+	sub.validate(s, value, "")
+	return len(sub.errors) == 0
+}
+
+func (v *validator) validate(s *Schema, value interface{}, path string) {
+	if s.Ref != "" {
+		def, ok := v.root.Defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+		if !ok {
+			v.add(path, "unknown schema %s", s.Ref)
+			return
+		}
+		s = def
+	}
+	// decoders leave the zero value for null.
+	if value == nil {
+		return
+	}
+	if s.Not != nil && v.matches(s.Not, value) {
+		v.add(path, "is not allowed")
+		return
+	}
+	if s.Type != "" && !hasType(s.Type, value) {
+		v.add(path, "want %s, got %s", article(s.Type), typeOf(value))
+		return
+	}
+	if s.Const != "" && value != s.Const {
+		v.add(path, "want %q", s.Const)
+	}
+	if len(s.Enum) != 0 && !contains(s.Enum, value) {
+		v.add(path, "want one of %s", strings.Join(s.Enum, ", "))
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			if prop, ok := s.Properties[key]; ok {
+				v.validate(prop, value[key], field)
+			} else if s.AdditionalProperties == closed {
+				v.add(field, "unknown field")
+			} else if s.AdditionalProperties != nil {
+				v.validate(s.AdditionalProperties, value[key], field)
+			}
+		}
+		for _, key := range s.Required {
+			if _, ok := value[key]; !ok {
+				v.add(path, "missing field %s", key)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		v.validate(sub, value, path)
+	}
+	if s.If != nil && s.Then != nil && v.matches(s.If, value) {
+		v.validate(s.Then, value, path)
+	}
+}
+
+func hasType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		switch n := value.(type) {
+		case int, int64, uint64:
+			return true
+		case float64:
+			return n == math.Trunc(n)
+		case json.Number:
+			_, err := n.Int64()
+			return err == nil
+		}
+		return false
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64, json.Number:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func typeOf(value interface{}) string {
+	for _, typ := range []string{"object", "array", "string", "boolean", "integer", "number"} {
+		if hasType(typ, value) {
+			return article(typ)
+		}
+	}
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func article(typ string) string {
+	if typ == "object" || typ == "array" || typ == "integer" {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func contains(values []string, value interface{}) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// Package snapshot hands the workspace of a stage over to the stages
+// restoring it, through an S3 bucket. The instances upload and download
+// the snapshots with presigned urls, they need no credentials. The
+// snapshots are tarballs of the workspace, EBS snapshots are not supported.
+package snapshot
+
+import (
+	"path"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Store presigns the urls of the workspace snapshots in an S3 bucket.
+type Store struct {
+	bucket string
+	prefix string
+	expiry time.Duration
+	client *s3.S3
+}
+
+// Open returns the store of the runner configuration, nil if the
+// snapshots are disabled.
+func Open(env *config.EnvConfig) (*Store, error) {
+	if env.Snapshot.S3Bucket == "" {
+		return nil, nil
+	}
+	return New(env.Snapshot.S3Bucket, env.Snapshot.S3Prefix, env.Snapshot.S3Region,
+		time.Duration(env.Snapshot.ExpiryMins)*time.Minute)
+}
+
+// New returns a store of the bucket, under the prefix, whose urls expire
+// after the duration. Credentials are taken from the default AWS
+// credential chain.
+func New(bucket, prefix, region string, expiry time.Duration) (*Store, error) {
+	cfg := fips.AWS(aws.NewConfig())
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{bucket: bucket, prefix: prefix, expiry: expiry, client: s3.New(sess)}, nil
+}
+
+// Name returns the object name of the snapshot with the key.
+func (s *Store) Name(key string) string {
+	return path.Join(s.prefix, key+".tar.gz")
+}
+
+// PutURL returns the url the snapshot with the key is uploaded to.
+func (s *Store) PutURL(key string) (string, error) {
+	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.Name(key)),
+	})
+	return req.Presign(s.expiry)
+}
+
+// GetURL returns the url the snapshot with the key is downloaded from.
+func (s *Store) GetURL(key string) (string, error) {
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.Name(key)),
+	})
+	return req.Presign(s.expiry)
+}
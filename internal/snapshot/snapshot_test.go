@@ -0,0 +1,36 @@
+package snapshot
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresign(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	store, err := New("snapshots", "drone", "us-east-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.Name("f00d"), "drone/f00d.tar.gz"; got != want {
+		t.Errorf("want the name %s, got %s", want, got)
+	}
+	for _, presign := range []func(string) (string, error){store.PutURL, store.GetURL} {
+		raw, err := presign("f00d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(u.Path, "/drone/f00d.tar.gz") {
+			t.Errorf("want the url of the snapshot, got %s", raw)
+		}
+		if u.Query().Get("X-Amz-Expires") != "3600" || u.Query().Get("X-Amz-Signature") == "" {
+			t.Errorf("want a url presigned for an hour, got %s", raw)
+		}
+	}
+}
@@ -35,3 +35,13 @@ func NewNotFoundError(msg string) *NotFoundError {
 }
 
 func (e *NotFoundError) Error() string { return e.Msg }
+
+type ConflictError struct {
+	Msg string
+}
+
+func NewConflictError(msg string) *ConflictError {
+	return &ConflictError{Msg: msg}
+}
+
+func (e *ConflictError) Error() string { return e.Msg }
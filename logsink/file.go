@@ -0,0 +1,97 @@
+package logsink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/harness/lite-engine/logstream"
+)
+
+func init() {
+	Register("file", func(env *config.EnvConfig) (logstream.Client, error) {
+		return NewFile(env.LiveLog.FileDir)
+	})
+}
+
+// File is a sink which writes the log of every key to a file in a directory.
+type File struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewFile returns a sink writing to files in dir.
+func NewFile(dir string) (*File, error) {
+	if dir == "" {
+		return nil, errors.New("the file sink requires DRONE_LIVELOG_FILE_DIR")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd
+		return nil, err
+	}
+	return &File{dir: dir, files: map[string]*os.File{}}, nil
+}
+
+// Path returns the path of the log file of a key.
+func (s *File) Path(key string) string {
+	return filepath.Join(s.dir, strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(key)+".log")
+}
+
+func (s *File) Open(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.open(key)
+	return err
+}
+
+func (s *File) Write(_ context.Context, key string, lines []*logstream.Line) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.open(key)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		msg := line.Message
+		if !strings.HasSuffix(msg, "\n") {
+			msg += "\n"
+		}
+		if _, err := f.WriteString(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upload is a no-op, every line has already been written.
+func (s *File) Upload(context.Context, string, []*logstream.Line) error {
+	return nil
+}
+
+func (s *File) Close(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[key]
+	if !ok {
+		return nil
+	}
+	delete(s.files, key)
+	return f.Close()
+}
+
+func (s *File) open(key string) (*os.File, error) {
+	if f, ok := s.files[key]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(s.Path(key), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gomnd
+	if err != nil {
+		return nil, err
+	}
+	s.files[key] = f
+	return f, nil
+}
@@ -0,0 +1,111 @@
+// Package logsink provides the registry of log sinks. A log sink receives
+// the log lines the runner streams to the log service, e.g. to archive
+// them. Sinks are registered by name and enabled with DRONE_LIVELOG_SINKS.
+package logsink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/harness/lite-engine/logstream"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Factory creates a sink from the runner configuration.
+type Factory func(env *config.EnvConfig) (logstream.Client, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a sink available by name. It panics if the name is
+// already registered.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("logsink: sink registered twice: " + name)
+	}
+	factories[name] = factory
+}
+
+// Names returns the sorted names of the registered sinks.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open creates the sinks with the given names.
+func Open(env *config.EnvConfig, names ...string) ([]logstream.Client, error) {
+	sinks := make([]logstream.Client, 0, len(names))
+	for _, name := range names {
+		mu.RLock()
+		factory, ok := factories[name]
+		mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("logsink: unknown sink %q, registered sinks are %v", name, Names())
+		}
+		sink, err := factory(env)
+		if err != nil {
+			return nil, fmt.Errorf("logsink: cannot create sink %q: %w", name, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// Fanout returns a client which sends every call to the primary client and
+// to all sinks. Only the errors of the primary client are returned; the
+// errors of the sinks are logged so that a failing sink does not affect
+// the others.
+func Fanout(primary logstream.Client, sinks ...logstream.Client) logstream.Client {
+	if len(sinks) == 0 {
+		return primary
+	}
+	return &fanout{primary: primary, sinks: sinks}
+}
+
+type fanout struct {
+	primary logstream.Client
+	sinks   []logstream.Client
+}
+
+func (f *fanout) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
+	f.each(key, "upload", func(c logstream.Client) error { return c.Upload(ctx, key, lines) })
+	return f.primary.Upload(ctx, key, lines)
+}
+
+func (f *fanout) Open(ctx context.Context, key string) error {
+	f.each(key, "open", func(c logstream.Client) error { return c.Open(ctx, key) })
+	return f.primary.Open(ctx, key)
+}
+
+func (f *fanout) Close(ctx context.Context, key string) error {
+	f.each(key, "close", func(c logstream.Client) error { return c.Close(ctx, key) })
+	return f.primary.Close(ctx, key)
+}
+
+func (f *fanout) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	f.each(key, "write", func(c logstream.Client) error { return c.Write(ctx, key, lines) })
+	return f.primary.Write(ctx, key, lines)
+}
+
+func (f *fanout) each(key, op string, fn func(logstream.Client) error) {
+	for _, sink := range f.sinks {
+		if err := fn(sink); err != nil {
+			logrus.WithError(err).WithField("key", key).WithField("sink", fmt.Sprintf("%T", sink)).
+				Warnf("logsink: %s failed", op)
+		}
+	}
+}
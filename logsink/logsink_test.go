@@ -0,0 +1,91 @@
+package logsink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/harness/lite-engine/logstream"
+)
+
+type fakeClient struct {
+	err     error
+	written int
+}
+
+func (c *fakeClient) Upload(context.Context, string, []*logstream.Line) error { return c.err }
+func (c *fakeClient) Open(context.Context, string) error                      { return c.err }
+func (c *fakeClient) Close(context.Context, string) error                     { return c.err }
+
+func (c *fakeClient) Write(_ context.Context, _ string, lines []*logstream.Line) error {
+	c.written += len(lines)
+	return c.err
+}
+
+func TestFanout(t *testing.T) {
+	ctx := context.Background()
+	lines := []*logstream.Line{{Message: "hello"}, {Message: "world"}}
+
+	primary := &fakeClient{}
+	failing := &fakeClient{err: errors.New("sink unavailable")}
+	healthy := &fakeClient{}
+	client := Fanout(primary, failing, healthy)
+
+	if err := client.Write(ctx, "key", lines); err != nil {
+		t.Errorf("Want sink errors ignored, got %s", err)
+	}
+	for name, c := range map[string]*fakeClient{"primary": primary, "failing": failing, "healthy": healthy} {
+		if c.written != len(lines) {
+			t.Errorf("Want %d lines written to the %s client, got %d", len(lines), name, c.written)
+		}
+	}
+
+	primary.err = errors.New("log service unreachable")
+	if err := client.Write(ctx, "key", lines); err == nil {
+		t.Errorf("Want the error of the primary client")
+	}
+}
+
+func TestFanout_NoSinks(t *testing.T) {
+	primary := &fakeClient{}
+	if got := Fanout(primary); got != primary {
+		t.Errorf("Want the primary client when there are no sinks")
+	}
+}
+
+func TestOpen_Unknown(t *testing.T) {
+	if _, err := Open(&config.EnvConfig{}, "unknown"); err == nil {
+		t.Errorf("Want error for an unknown sink")
+	}
+}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	env := &config.EnvConfig{}
+	env.LiveLog.FileDir = t.TempDir()
+	sinks, err := Open(env, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := sinks[0].(*File)
+
+	if err = sink.Open(ctx, "a/../b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(ctx, "a/../b", []*logstream.Line{{Message: "hello\n"}, {Message: "world"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Close(ctx, "a/../b"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(sink.Path("a/../b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello\nworld\n"; string(got) != want {
+		t.Errorf("Want file content %q, got %q", want, got)
+	}
+}
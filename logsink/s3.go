@@ -0,0 +1,73 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/fips"
+	"github.com/harness/lite-engine/logstream"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func init() {
+	Register("s3", func(env *config.EnvConfig) (logstream.Client, error) {
+		return NewS3(env.LiveLog.S3Bucket, env.LiveLog.S3Prefix, env.LiveLog.S3Region)
+	})
+}
+
+// S3 is a sink which archives the complete log of every key to an S3 bucket
+// when the log is uploaded.
+type S3 struct {
+	bucket   string
+	prefix   string
+	uploader *s3manager.Uploader
+}
+
+// NewS3 returns a sink archiving logs to the bucket, under the prefix.
+// Credentials are taken from the default AWS credential chain.
+func NewS3(bucket, prefix, region string) (*S3, error) {
+	if bucket == "" {
+		return nil, errors.New("the s3 sink requires DRONE_LIVELOG_S3_BUCKET")
+	}
+	cfg := fips.AWS(aws.NewConfig())
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{bucket: bucket, prefix: prefix, uploader: s3manager.NewUploader(sess)}, nil
+}
+
+func (s *S3) Upload(ctx context.Context, key string, lines []*logstream.Line) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line.Message)
+		if n := len(line.Message); n == 0 || line.Message[n-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(path.Join(s.prefix, key+".log")),
+		Body:        &buf,
+		ContentType: aws.String("text/plain; charset=utf-8"),
+	})
+	return err
+}
+
+// Open is a no-op, the log is archived on upload.
+func (s *S3) Open(context.Context, string) error { return nil }
+
+// Close is a no-op, the log is archived on upload.
+func (s *S3) Close(context.Context, string) error { return nil }
+
+// Write is a no-op, the log is archived on upload.
+func (s *S3) Write(context.Context, string, []*logstream.Line) error { return nil }
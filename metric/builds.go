@@ -19,6 +19,7 @@ type Metrics struct {
 	RunningPerAccountCount *prometheus.GaugeVec
 	PoolFallbackCount      *prometheus.CounterVec
 	WaitDurationCount      *prometheus.HistogramVec
+	ClaimDurationCount     *prometheus.HistogramVec
 	CPUPercentile          *prometheus.HistogramVec
 	MemoryPercentile       *prometheus.HistogramVec
 
@@ -197,6 +198,18 @@ func WaitDurationCount() *prometheus.HistogramVec {
 	)
 }
 
+// ClaimDurationCount provides metrics for the time the claim of an instance spends in each phase
+func ClaimDurationCount() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "harness_ci_runner_claim_duration_seconds",
+			Help:    "Time the claim of an instance from a pool spends waiting for the lock of the pool, on the instance store and creating an instance",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 30, 60, 300},
+		},
+		[]string{"pool_id", "driver", "phase", "distributed"},
+	)
+}
+
 func RegisterMetrics() *Metrics {
 	buildCount := BuildCount()
 	failedBuildCount := FailedBuildCount()
@@ -204,10 +217,11 @@ func RegisterMetrics() *Metrics {
 	runningPerAccountCount := RunningPerAccountCount()
 	poolFallbackCount := PoolFallbackCount()
 	waitDurationCount := WaitDurationCount()
+	claimDurationCount := ClaimDurationCount()
 	cpuPercentile := CPUPercentile()
 	memoryPercentile := MemoryPercentile()
 	errorCount := ErrorCount()
-	prometheus.MustRegister(buildCount, failedBuildCount, runningCount, runningPerAccountCount, poolFallbackCount, waitDurationCount, cpuPercentile, memoryPercentile, errorCount)
+	prometheus.MustRegister(buildCount, failedBuildCount, runningCount, runningPerAccountCount, poolFallbackCount, waitDurationCount, claimDurationCount, cpuPercentile, memoryPercentile, errorCount)
 	return &Metrics{
 		BuildCount:             buildCount,
 		FailedCount:            failedBuildCount,
@@ -215,6 +229,7 @@ func RegisterMetrics() *Metrics {
 		RunningPerAccountCount: runningPerAccountCount,
 		PoolFallbackCount:      poolFallbackCount,
 		WaitDurationCount:      waitDurationCount,
+		ClaimDurationCount:     claimDurationCount,
 		MemoryPercentile:       memoryPercentile,
 		CPUPercentile:          cpuPercentile,
 		ErrorCount:             errorCount,
@@ -0,0 +1,228 @@
+// Package notify alerts the operators of the runner about the failures of
+// the infrastructure: instances that cannot be provisioned or destroyed,
+// exhausted pools and the instances terminated by the purger and the
+// reconciler. Alerts of the same kind and pool are rate limited. Notifiers
+// are registered by name and enabled with DRONE_NOTIFY_SINKS.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds of alerts.
+const (
+	KindProvisionFailed = "provision.failed"
+	KindPoolExhausted   = "pool.exhausted"
+	KindDestroyFailed   = "destroy.failed"
+	KindReaped          = "instance.reaped"
+)
+
+var summaries = map[string]string{
+	KindProvisionFailed: "cannot provision an instance",
+	KindPoolExhausted:   "the pool is exhausted",
+	KindDestroyFailed:   "cannot destroy instances",
+	KindReaped:          "terminated instances",
+}
+
+// DefaultTemplate is the text/template of the messages, executed with the
+// alert.
+const DefaultTemplate = `{{with .Runner}}[{{.}}] {{end}}{{summary .Kind}}{{with .Pool}} in pool {{.}}{{end}}` +
+	`{{with .Instances}} ({{join . ", "}}){{end}}{{with .Reason}}: {{.}}{{end}}{{with .Error}}: {{.}}{{end}}` +
+	`{{with .Suppressed}} ({{.}} more since the last alert){{end}}`
+
+// Alert is a failure of the infrastructure.
+type Alert struct {
+	Kind       string    `json:"kind"`
+	Time       time.Time `json:"time"`
+	Runner     string    `json:"runner,omitempty"`
+	Pool       string    `json:"pool,omitempty"`
+	Instances  []string  `json:"instances,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Suppressed int       `json:"suppressed,omitempty"` // alerts of the kind and pool dropped by the rate limit since the last one
+}
+
+// Notifier sends the alerts and their rendered messages.
+type Notifier interface {
+	Notify(ctx context.Context, alert *Alert, message string) error
+}
+
+// Factory creates a notifier from the runner configuration.
+type Factory func(env *config.EnvConfig) (Notifier, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a notifier available by name. It panics if the name is
+// already registered.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("notify: notifier registered twice: " + name)
+	}
+	factories[name] = factory
+}
+
+// Names returns the sorted names of the registered notifiers.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispatcher renders the alerts and sends them to the notifiers, at most
+// one per kind and pool in an interval.
+type Dispatcher struct {
+	runner    string
+	notifiers []Notifier
+	tmpl      *template.Template
+	interval  time.Duration
+	now       func() time.Time
+
+	mu         sync.Mutex
+	sent       map[string]time.Time
+	suppressed map[string]int
+}
+
+// New returns a dispatcher of the alerts of the runner. The text is the
+// template of the messages, the default if empty. An interval of 0
+// disables the rate limit.
+func New(runner, text string, interval time.Duration, notifiers ...Notifier) (*Dispatcher, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("notify").Funcs(template.FuncMap{
+		"join": strings.Join,
+		"summary": func(kind string) string {
+			if s, ok := summaries[kind]; ok {
+				return s
+			}
+			return kind
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("notify: invalid template: %w", err)
+	}
+	return &Dispatcher{
+		runner:     runner,
+		notifiers:  notifiers,
+		tmpl:       tmpl,
+		interval:   interval,
+		now:        time.Now,
+		sent:       map[string]time.Time{},
+		suppressed: map[string]int{},
+	}, nil
+}
+
+// Notify sends the alert to the notifiers, unless an alert of the same kind
+// and pool was sent within the interval. It reports whether it was sent.
+// The errors of the notifiers are logged so that a failing notifier does
+// not affect the others or the runner.
+func (d *Dispatcher) Notify(ctx context.Context, alert *Alert) bool {
+	if d == nil {
+		return false
+	}
+	now := d.now()
+	key := alert.Kind + "/" + alert.Pool
+	d.mu.Lock()
+	if last, ok := d.sent[key]; ok && now.Sub(last) < d.interval {
+		d.suppressed[key]++
+		d.mu.Unlock()
+		return false
+	}
+	d.sent[key] = now
+	alert.Suppressed = d.suppressed[key]
+	delete(d.suppressed, key)
+	d.mu.Unlock()
+
+	alert.Runner = d.runner
+	if alert.Time.IsZero() {
+		alert.Time = now.UTC()
+	}
+	var message bytes.Buffer
+	if err := d.tmpl.Execute(&message, alert); err != nil {
+		logrus.WithError(err).WithField("kind", alert.Kind).Errorln("notify: cannot render the message")
+		return false
+	}
+	for _, notifier := range d.notifiers {
+		if err := notifier.Notify(ctx, alert, message.String()); err != nil {
+			logrus.WithError(err).WithField("kind", alert.Kind).WithField("notifier", fmt.Sprintf("%T", notifier)).
+				Errorln("notify: failed to send the alert")
+		}
+	}
+	return true
+}
+
+var std *Dispatcher
+
+// timeout bounds the time spent sending an alert of the default dispatcher.
+const timeout = 30 * time.Second
+
+// Open creates the default dispatcher with the notifiers enabled in the
+// runner configuration. The default dispatcher sends nothing if no
+// notifier is enabled.
+func Open(env *config.EnvConfig) error {
+	if len(env.Notify.Sinks) == 0 {
+		return nil
+	}
+	notifiers := make([]Notifier, 0, len(env.Notify.Sinks))
+	for _, name := range env.Notify.Sinks {
+		mu.RLock()
+		factory, ok := factories[name]
+		mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("notify: unknown notifier %q, registered notifiers are %v", name, Names())
+		}
+		notifier, err := factory(env)
+		if err != nil {
+			return fmt.Errorf("notify: cannot create notifier %q: %w", name, err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	d, err := New(env.Runner.Name, env.Notify.Template, time.Duration(env.Notify.IntervalSecs)*time.Second, notifiers...)
+	if err != nil {
+		return err
+	}
+	std = d
+	return nil
+}
+
+// Send sends the alert with the default dispatcher in the background, so
+// that slow notifiers do not hold the caller.
+func Send(alert *Alert) {
+	if std == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		std.Notify(ctx, alert)
+	}()
+}
+
+// ErrorOf returns the message of the error, or an empty string.
+func ErrorOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type memoryNotifier struct {
+	messages []string
+}
+
+func (n *memoryNotifier) Notify(_ context.Context, _ *Alert, message string) error {
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func TestDispatcher_Template(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		alert *Alert
+		want  string
+	}{
+		{
+			name:  "provision failed",
+			alert: &Alert{Kind: KindProvisionFailed, Pool: "linux", Error: "InsufficientInstanceCapacity"},
+			want:  "[runner] cannot provision an instance in pool linux: InsufficientInstanceCapacity",
+		},
+		{
+			name:  "reaped",
+			alert: &Alert{Kind: KindReaped, Pool: "linux", Instances: []string{"i-1", "i-2"}, Reason: "purger: over the max age"},
+			want:  "[runner] terminated instances in pool linux (i-1, i-2): purger: over the max age",
+		},
+		{
+			name:  "custom template",
+			text:  `:fire: {{.Kind}} {{.Pool}}`,
+			alert: &Alert{Kind: KindPoolExhausted, Pool: "windows"},
+			want:  ":fire: pool.exhausted windows",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := &memoryNotifier{}
+			d, err := New("runner", test.text, 0, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Notify(context.Background(), test.alert)
+			if len(n.messages) != 1 || n.messages[0] != test.want {
+				t.Errorf("want message %q, got %q", test.want, n.messages)
+			}
+		})
+	}
+
+	if _, err := New("runner", "{{.Kind", 0); err == nil {
+		t.Errorf("want an invalid template rejected")
+	}
+}
+
+func TestDispatcher_RateLimit(t *testing.T) {
+	n := &memoryNotifier{}
+	d, err := New("", "{{.Kind}} {{.Pool}} {{.Suppressed}}", time.Minute, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	d.Notify(ctx, &Alert{Kind: KindPoolExhausted, Pool: "linux"})
+	d.Notify(ctx, &Alert{Kind: KindPoolExhausted, Pool: "linux"})
+	d.Notify(ctx, &Alert{Kind: KindPoolExhausted, Pool: "linux"})
+	d.Notify(ctx, &Alert{Kind: KindPoolExhausted, Pool: "windows"})
+	d.Notify(ctx, &Alert{Kind: KindDestroyFailed, Pool: "linux"})
+	now = now.Add(time.Minute)
+	d.Notify(ctx, &Alert{Kind: KindPoolExhausted, Pool: "linux"})
+
+	want := []string{
+		"pool.exhausted linux 0",
+		"pool.exhausted windows 0",
+		"destroy.failed linux 0",
+		"pool.exhausted linux 2",
+	}
+	if len(n.messages) != len(want) {
+		t.Fatalf("want %q, got %q", want, n.messages)
+	}
+	for i := range want {
+		if n.messages[i] != want[i] {
+			t.Errorf("want %q, got %q", want[i], n.messages[i])
+		}
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	var got map[string]interface{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	alert := &Alert{Kind: KindDestroyFailed, Pool: "linux", Instances: []string{"i-1"}}
+
+	slack, err := NewSlack(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = slack.Notify(ctx, alert, "message"); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != "message" {
+		t.Errorf("want the slack message posted as text, got %v", got)
+	}
+
+	webhook, err := NewWebhook(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = webhook.Notify(ctx, alert, "message"); err != nil {
+		t.Fatal(err)
+	}
+	if got["message"] != "message" || got["kind"] != KindDestroyFailed || got["pool"] != "linux" {
+		t.Errorf("want the alert posted with the message, got %v", got)
+	}
+
+	status = http.StatusForbidden
+	if err = webhook.Notify(ctx, alert, "message"); err == nil {
+		t.Errorf("want the error status returned")
+	}
+
+	if _, err = NewSlack(""); err == nil {
+		t.Errorf("want the slack notifier to require the webhook")
+	}
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+func init() {
+	Register("slack", func(env *config.EnvConfig) (Notifier, error) {
+		return NewSlack(env.Notify.SlackWebhook)
+	})
+	Register("webhook", func(env *config.EnvConfig) (Notifier, error) {
+		return NewWebhook(env.Notify.WebhookURL)
+	})
+}
+
+// Slack is a notifier which posts the messages to a Slack incoming webhook.
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlack returns a notifier posting to the Slack incoming webhook.
+func NewSlack(url string) (*Slack, error) {
+	if url == "" {
+		return nil, errors.New("the slack notifier requires DRONE_NOTIFY_SLACK_WEBHOOK")
+	}
+	return &Slack{url: url, client: http.DefaultClient}, nil
+}
+
+func (n *Slack) Notify(ctx context.Context, _ *Alert, message string) error {
+	return post(ctx, n.client, n.url, map[string]string{"text": message})
+}
+
+// Webhook is a notifier which posts the alerts, with their messages, as
+// json to an url.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook returns a notifier posting to the url.
+func NewWebhook(url string) (*Webhook, error) {
+	if url == "" {
+		return nil, errors.New("the webhook notifier requires DRONE_NOTIFY_WEBHOOK_URL")
+	}
+	return &Webhook{url: url, client: http.DefaultClient}, nil
+}
+
+func (n *Webhook) Notify(ctx context.Context, alert *Alert, message string) error {
+	return post(ctx, n.client, n.url, struct {
+		*Alert
+		Message string `json:"message"`
+	}{alert, message})
+}
+
+func post(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 { //nolint:gomnd
+		out, _ := io.ReadAll(io.LimitReader(res.Body, 512)) //nolint:gomnd
+		return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1 @@
+ALTER TABLE instances ADD COLUMN IF NOT EXISTS instance_ssh_key TEXT NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE instances ADD COLUMN instance_ssh_key TEXT NOT NULL DEFAULT '';
\ No newline at end of file
@@ -148,6 +148,7 @@ const instanceColumns = `
 ,is_hibernated
 ,instance_port
 ,instance_owner_id
+,instance_ssh_key
 `
 
 const instanceFindByID = `SELECT ` + instanceColumns + `
@@ -184,6 +185,7 @@ INSERT INTO instances (
 ,instance_port
 ,instance_owner_id
 ,runner_name
+,instance_ssh_key
 ) values (
  :instance_id
 ,:instance_node_id
@@ -212,6 +214,7 @@ INSERT INTO instances (
 ,:instance_port
 ,:instance_owner_id
 ,:runner_name
+,:instance_ssh_key
 ) RETURNING instance_id
 `
 
@@ -230,5 +233,6 @@ SET
  ,instance_address  = :instance_address
  ,instance_owner_id = :instance_owner_id
  ,instance_started  = :instance_started
+ ,instance_ssh_key  = :instance_ssh_key
 WHERE instance_id   = :instance_id
 `
@@ -2,6 +2,7 @@ package types
 
 import (
 	"database/sql/driver"
+	"time"
 )
 
 type InstanceState string
@@ -32,6 +33,11 @@ const (
 	VMFusion     = DriverType("vmfusion")
 	Noop         = DriverType("noop")
 	Nomad        = DriverType("nomad")
+	LXD          = DriverType("lxd")
+	OpenStack    = DriverType("openstack")
+	VSphere      = DriverType("vsphere")
+	OCI          = DriverType("oci")
+	Tart         = DriverType("tart")
 )
 
 // InstanceState type enumeration.
@@ -39,6 +45,7 @@ const (
 	StateCreated     = InstanceState("created")
 	StateInUse       = InstanceState("inuse")
 	StateHibernating = InstanceState("hibernating")
+	StatePreparing   = InstanceState("preparing") // the toolcache is installed, the instance cannot be claimed
 )
 
 type Instance struct {
@@ -65,6 +72,7 @@ type Instance struct {
 	IsHibernated bool   `db:"is_hibernated" json:"is_hibernated"`
 	Port         int64  `db:"instance_port" json:"port"`
 	RunnerName   string `db:"runner_name" json:"runner_name"`
+	SSHKey       string `db:"instance_ssh_key" json:"ssh_key"` // fingerprint of the runner ssh key authorized on the instance
 }
 
 type Tmate struct {
@@ -104,6 +112,82 @@ type Platform struct {
 	OSName  string `json:"os_name,omitempty" yaml:"os_name,omitempty" db:"instance_os_name"`
 }
 
+// Tool is a tool version pre-installed into the toolcache of pool instances.
+type Tool struct {
+	Name    string `json:"name" yaml:"name"` // node, go or jdk
+	Version string `json:"version" yaml:"version"`
+}
+
+// Mirror configures the pull-through caches the instances of a pool use.
+type Mirror struct {
+	// Registry is the url of a docker registry mirror, or local to run
+	// one on the instance.
+	Registry      string `json:"registry,omitempty" yaml:"registry,omitempty"`
+	RegistryImage string `json:"registry_image,omitempty" yaml:"registry_image,omitempty"`
+	NPM           string `json:"npm,omitempty" yaml:"npm,omitempty"`
+	PyPI          string `json:"pypi,omitempty" yaml:"pypi,omitempty"`
+	Maven         string `json:"maven,omitempty" yaml:"maven,omitempty"`
+}
+
+// Firewall restricts the traffic of the instances of a pool. Entries are
+// host names, addresses or subnets, with an optional tcp port, e.g.
+// github.com:443 or 10.0.0.0/16. A direction without entries is not
+// firewalled.
+type Firewall struct {
+	// Egress are the destinations the instances and containers reach.
+	Egress []string `json:"egress,omitempty" yaml:"egress,omitempty"`
+	// Ingress are the sources reaching the instances.
+	Ingress []string `json:"ingress,omitempty" yaml:"ingress,omitempty"`
+}
+
+// PoolSettings configures the instances of a pool during the setup.
+type PoolSettings struct {
+	// Timezone and Locale are applied on the instances during setup, empty
+	// values keep the defaults of the image.
+	Timezone string
+	Locale   string
+	// Toolcache are the tools pre-installed on the free instances of the pool.
+	Toolcache []Tool
+	// Mirror are the pull-through caches of the pool instances.
+	Mirror *Mirror
+	// DockerDaemon is the docker daemon.json content of the pool instances.
+	DockerDaemon map[string]interface{}
+	// NestedVirtualization requires kvm on the pool instances.
+	NestedVirtualization bool
+	// Untrusted blocks the instance metadata service from build steps.
+	Untrusted bool
+	// Workspace is the directory the pipelines are built in, the drone
+	// directory of the root directory if empty.
+	Workspace string
+	// TmpfsSize is the size of the tmpfs mounted on the script and home
+	// directories of the pool instances, disabled if empty.
+	TmpfsSize string
+	// SwapSize is the size of the swap file enabled on the pool instances,
+	// disabled if empty.
+	SwapSize string
+	// Sysctl are the kernel parameters set on the pool instances.
+	Sysctl map[string]string
+	// SELinux and AppArmorProfile are the selinux mode and the apparmor
+	// profile of the build containers, the image defaults if empty.
+	SELinux         string
+	AppArmorProfile string
+	// NetworkMTU is the MTU of the build networks of the pool instances,
+	// the docker default if 0.
+	NetworkMTU int
+	// Firewall restricts the traffic of the pool instances.
+	Firewall *Firewall
+}
+
+// ServiceHealth configures the readiness check of a pipeline service.
+// The service is healthy once its ports accept connections and its test
+// command exits with code zero.
+type ServiceHealth struct {
+	Ports    []int         `json:"ports,omitempty"`
+	Test     string        `json:"test,omitempty"`
+	Interval time.Duration `json:"interval,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+}
+
 type QueryParams struct {
 	Status     InstanceState
 	Stage      string